@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/crelay"
+	router "github.com/hetu-project/cRelay-crdt-db/internal/api"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	adapter "github.com/hetu-project/cRelay-crdt-db/orbitdb"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// subcommand is a command of the binary, e.g. ./api-service export -db /orbitdb/... -filter '{"kinds":[1]}'
+type subcommand struct {
+	name    string
+	aliases []string // Former names still accepted
+	summary string
+	flags   []func(*cliFlags, *flag.FlagSet) // Flag groups the command accepts
+	run     func(ctx context.Context, cfg *config.Config, f *cliFlags, args []string) error
+}
+
+// subcommands are the commands of the binary, serve runs when none is given
+var subcommands = []*subcommand{
+	{
+		name:    "serve",
+		summary: "Serve the API for the configured database",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore, (*cliFlags).registerServe},
+		run:     runServe,
+	},
+	{
+		name:    "create-db",
+		summary: "Create a new database named by -db-name and serve it, bootstrapping a new network",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore, (*cliFlags).registerServe},
+		run:     runCreateDB,
+	},
+	{
+		name:    "backup",
+		summary: "Write every document of the database to a JSONL archive",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore, (*cliFlags).registerFile},
+		run:     withStore(runBackup),
+	},
+	{
+		name:    "restore",
+		summary: "Restore the documents of a JSONL archive written by backup",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore, (*cliFlags).registerFile},
+		run:     withStore(runRestore),
+	},
+	{
+		name:    "export",
+		summary: "Write the events matching -filter as JSONL",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore, (*cliFlags).registerFile, (*cliFlags).registerFilter},
+		run:     withStore(runExport),
+	},
+	{
+		name:    "import",
+		summary: "Save the events of a JSONL file",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore, (*cliFlags).registerFile},
+		run:     withStore(runImport),
+	},
+	{
+		name:    "backfill",
+		summary: "Pull the historical events matching -filter from external Nostr relays",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore, (*cliFlags).registerFilter, (*cliFlags).registerRelays},
+		run:     withStore(runBackfill),
+	},
+	{
+		name:    "rebuild-stats",
+		aliases: []string{"rebuild"},
+		summary: "Regenerate causality and user statistics from the stored events",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore},
+		run:     withStore(runRebuildStats),
+	},
+	{
+		name:    "migrate",
+		summary: "Upgrade documents older than the current schema version of their type",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore},
+		run:     withStore(runMigrate),
+	},
+	{
+		name:    "fsck",
+		summary: "Check causality and user statistics against the stored events, -repair fixes discrepancies",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore, (*cliFlags).registerRepair},
+		run:     withStore(runFsck),
+	},
+	{
+		name:    "query",
+		summary: "Print events, causality or user statistics, from -node or the local store",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerStore, (*cliFlags).registerFilter, (*cliFlags).registerNode, (*cliFlags).registerOutput},
+		run:     runQueryCommand,
+	},
+	{
+		name:    "peers",
+		summary: "List the peers a running node exchanged heads with",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerNode, (*cliFlags).registerOutput},
+		run:     runPeers,
+	},
+	{
+		name:    "info",
+		summary: "Print the status of a running node: databases, documents and disk usage",
+		flags:   []func(*cliFlags, *flag.FlagSet){(*cliFlags).registerConfig, (*cliFlags).registerNode},
+		run:     runInfo,
+	},
+}
+
+// findSubcommand returns the command called name, nil if there is none
+func findSubcommand(name string) *subcommand {
+	for _, cmd := range subcommands {
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// parseCommandLine parses the arguments following the program name into the command and its
+// flags. Arguments starting with a flag run serve.
+func parseCommandLine(args []string, output io.Writer) (*subcommand, *flag.FlagSet, *cliFlags, error) {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage(output)
+		return nil, nil, nil, flag.ErrHelp
+	}
+	cmd := findSubcommand(name)
+	if cmd == nil {
+		printUsage(output)
+		return nil, nil, nil, fmt.Errorf("unknown command: %s", name)
+	}
+
+	f := &cliFlags{}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(output, "Usage: %s %s [flags] [arguments]\n\n%s\n\nFlags:\n", programName(), cmd.name, cmd.summary)
+		fs.PrintDefaults()
+	}
+	for _, register := range cmd.flags {
+		register(f, fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, nil, err
+	}
+	return cmd, fs, f, nil
+}
+
+// printUsage prints the commands of the binary
+func printUsage(out io.Writer) {
+	fmt.Fprintf(out, "Usage: %s [command] [flags] [arguments]\n\nCommands:\n", programName())
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, cmd := range subcommands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\nserve runs when no command is given. Run %s <command> -h for the flags of a command.\n", programName())
+}
+
+// programName returns the name the binary was run as
+func programName() string {
+	if len(os.Args) == 0 {
+		return "api-service"
+	}
+	return os.Args[0]
+}
+
+// cliFlags holds the values of the command-line flags. Each command registers the groups of
+// flags it accepts on its own flag set.
+type cliFlags struct {
+	configPath     string
+	logLevel       string
+	logFormat      string
+	dbAddress      string
+	relayMultiaddr string
+	orbitDBDir     string
+	swarmKey       string
+	port           string
+	createDB       bool
+	dbName         string
+	migrateTo      string
+	readOnly       bool
+	archiveFile    string
+	filter         string
+	node           string
+	apiKey         string
+	output         string
+	repair         bool
+	relays         stringList
+}
+
+// stringList is a flag that may be repeated, each value appended to the list
+type stringList []string
+
+// String returns the values of the flag
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set appends a value of the flag
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// registerConfig registers the configuration file and logging flags
+func (f *cliFlags) registerConfig(fs *flag.FlagSet) {
+	fs.StringVar(&f.configPath, "config", "", "Path to YAML configuration file")
+	fs.StringVar(&f.logLevel, "log-level", "", "Log level: debug|info|warn|error (overrides config)")
+	fs.StringVar(&f.logFormat, "log-format", "", "Log format: console|json (overrides config)")
+}
+
+// registerStore registers the flags locating the database and joining its network
+func (f *cliFlags) registerStore(fs *flag.FlagSet) {
+	fs.StringVar(&f.dbAddress, "db", "", "OrbitDB address to connect to (overrides config)")
+	fs.StringVar(&f.relayMultiaddr, "Multiaddr", "", "relayMultiaddr (overrides config)")
+	fs.StringVar(&f.orbitDBDir, "orbitdb-dir", "", "OrbitDB data storage directory (overrides config)")
+	fs.StringVar(&f.swarmKey, "swarm-key", "", "Path of a libp2p private network swarm key file (overrides config)")
+}
+
+// registerServe registers the flags of serving the API
+func (f *cliFlags) registerServe(fs *flag.FlagSet) {
+	fs.StringVar(&f.port, "port", "", "API service port (overrides config)")
+	fs.BoolVar(&f.createDB, "create", false, "Create a new database in this process instead of opening -db (overrides config)")
+	fs.StringVar(&f.dbName, "db-name", "", "Database name used with -create (overrides config)")
+	fs.StringVar(&f.migrateTo, "migrate-to", "", "Address of a new database to migrate -db into (overrides config)")
+	fs.BoolVar(&f.readOnly, "read-only", false, "Serve reads only, rejecting writes or forwarding them to read_only.primary (overrides config)")
+}
+
+// registerFile registers the archive file flag
+func (f *cliFlags) registerFile(fs *flag.FlagSet) {
+	fs.StringVar(&f.archiveFile, "file", "-", "File path of the archive or events, - for stdout/stdin; a trailing argument is accepted instead")
+}
+
+// registerFilter registers the event filter flag
+func (f *cliFlags) registerFilter(fs *flag.FlagSet) {
+	fs.StringVar(&f.filter, "filter", "{}", "Nostr filter as JSON selecting the events")
+}
+
+// registerNode registers the flags of talking to a running node
+func (f *cliFlags) registerNode(fs *flag.FlagSet) {
+	fs.StringVar(&f.node, "node", "", "Base URL of a running node, e.g. http://localhost:8080")
+	fs.StringVar(&f.apiKey, "api-key", "", "API key sent to the node")
+}
+
+// registerOutput registers the output format flag
+func (f *cliFlags) registerOutput(fs *flag.FlagSet) {
+	fs.StringVar(&f.output, "output", outputJSON, "Output format: json|table")
+}
+
+// registerRepair registers the flag of repairing the discrepancies fsck finds
+func (f *cliFlags) registerRepair(fs *flag.FlagSet) {
+	fs.BoolVar(&f.repair, "repair", false, "Repair the discrepancies found instead of only reporting them")
+}
+
+// registerRelays registers the flag of the external relays to backfill from
+func (f *cliFlags) registerRelays(fs *flag.FlagSet) {
+	fs.Var(&f.relays, "relay", "URL of a Nostr relay to pull events from, e.g. wss://relay.example; may be repeated")
+}
+
+// applyFlagOverrides applies explicitly set command-line flags on top of the configuration
+func applyFlagOverrides(fs *flag.FlagSet, f *cliFlags, cfg *config.Config) {
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "db":
+			cfg.OrbitDB.Address = f.dbAddress
+		case "Multiaddr":
+			cfg.Relay.Multiaddrs = []string{f.relayMultiaddr}
+		case "port":
+			cfg.API.Port = f.port
+		case "orbitdb-dir":
+			cfg.OrbitDB.Directory = f.orbitDBDir
+		case "create":
+			cfg.OrbitDB.Standalone = f.createDB
+		case "db-name":
+			cfg.OrbitDB.Name = f.dbName
+		case "migrate-to":
+			cfg.OrbitDB.MigrateTo = f.migrateTo
+		case "swarm-key":
+			cfg.Relay.SwarmKey = f.swarmKey
+		case "read-only":
+			cfg.ReadOnly.Enabled = f.readOnly
+		case "log-level":
+			cfg.Log.Level = f.logLevel
+		case "log-format":
+			cfg.Log.Format = f.logFormat
+		}
+	})
+}
+
+// noDatabaseHelp explains how to name the database when none is configured
+const noDatabaseHelp = `
+                   Error: Database address not specified!
+                   Please start the relay service first to generate a database address, then run this API service with the -db parameter
+                   or set orbitdb.address in the configuration file.
+                   To bootstrap a new network from this process instead, run create-db -db-name <name>.
+                   Example command:
+                   ./api-service serve -db /orbitdb/zdpuAm... -port 8080
+	`
+
+// withStore wraps a command run against the local store, opened without the API
+func withStore(run func(ctx context.Context, store *adapter.OrbitDBAdapter, f *cliFlags, args []string) error) func(context.Context, *config.Config, *cliFlags, []string) error {
+	return func(ctx context.Context, cfg *config.Config, f *cliFlags, args []string) error {
+		node, err := crelay.New(ctx, crelay.WithConfig(cfg), crelay.WithStoreOnly())
+		if errors.Is(err, crelay.ErrNoDatabase) {
+			zap.L().Fatal(noDatabaseHelp)
+		}
+		if err != nil {
+			return err
+		}
+		defer node.Close()
+		return run(ctx, node.Store(), f, args)
+	}
+}
+
+// archivePath returns the file of a backup, restore, export or import command, a trailing
+// argument taking precedence over -file, e.g. ./api-service import events.jsonl
+func archivePath(f *cliFlags, args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return f.archiveFile
+}
+
+// createArchive opens the output file of a command, stdout for -
+func createArchive(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// openArchive opens the input file of a command, stdin for -
+func openArchive(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// nopWriteCloser leaves stdout open
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// runBackup writes every document of the store to a JSONL archive
+func runBackup(ctx context.Context, store *adapter.OrbitDBAdapter, f *cliFlags, args []string) error {
+	out, err := createArchive(archivePath(f, args))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	count, err := store.Backup(ctx, out)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("Backed up documents", zap.Int("documents", count))
+	return nil
+}
+
+// runRestore restores the documents of a JSONL archive written by backup
+func runRestore(ctx context.Context, store *adapter.OrbitDBAdapter, f *cliFlags, args []string) error {
+	in, err := openArchive(archivePath(f, args))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	count, err := store.Restore(ctx, in)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("Restored documents", zap.Int("documents", count))
+	return nil
+}
+
+// runExport writes the raw Nostr events matching -filter as JSONL
+func runExport(ctx context.Context, store *adapter.OrbitDBAdapter, f *cliFlags, args []string) error {
+	var filter nostr.Filter
+	if err := json.Unmarshal([]byte(f.filter), &filter); err != nil {
+		return fmt.Errorf("invalid -filter: %w", err)
+	}
+	out, err := createArchive(archivePath(f, args))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	count, err := store.ExportEvents(ctx, filter, out)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("Exported events", zap.Int("events", count))
+	return nil
+}
+
+// runImport saves the raw Nostr events of a JSONL file
+func runImport(ctx context.Context, store *adapter.OrbitDBAdapter, f *cliFlags, args []string) error {
+	in, err := openArchive(archivePath(f, args))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	count, err := store.ImportEvents(ctx, in)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("Imported events", zap.Int("events", count))
+	return nil
+}
+
+// runBackfill pulls the events matching -filter from the -relay relays and prints the report.
+// It fails if a relay's history is incomplete, so the backfill can be retried.
+func runBackfill(ctx context.Context, store *adapter.OrbitDBAdapter, f *cliFlags, args []string) error {
+	var filter nostr.Filter
+	if err := json.Unmarshal([]byte(f.filter), &filter); err != nil {
+		return fmt.Errorf("invalid -filter: %w", err)
+	}
+
+	report, err := store.BackfillFromRelays(ctx, f.relays, nostr.Filters{filter})
+	if report != nil {
+		if err := printJSON(os.Stdout, report); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if failed := report.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d relays failed, %d events saved", failed, len(report.Relays), report.Saved)
+	}
+	return nil
+}
+
+// runRebuildStats regenerates the derived data, causality and user statistics, from the stored events
+func runRebuildStats(ctx context.Context, store *adapter.OrbitDBAdapter, f *cliFlags, args []string) error {
+	result, err := store.RebuildDerivedData(ctx)
+	if err != nil {
+		return err
+	}
+	if result.Failures > 0 {
+		return fmt.Errorf("%d of %d events failed to update derived data, last error: %s",
+			result.Failures, result.Events, result.LastError)
+	}
+	return nil
+}
+
+// runMigrate upgrades the documents older than the current schema version of their type
+func runMigrate(ctx context.Context, store *adapter.OrbitDBAdapter, f *cliFlags, args []string) error {
+	result, err := store.MigrateSchema(ctx)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("Migrated documents", zap.Int("documents", result.Documents), zap.Any("migrated", result.Migrated),
+		zap.Any("newer", result.Newer), zap.Int64("duration_ms", result.DurationMsec))
+	return nil
+}
+
+// runFsck checks the derived documents against the stored events and prints the report. It
+// fails if discrepancies are left unrepaired, so scripts can alert on them.
+func runFsck(ctx context.Context, store *adapter.OrbitDBAdapter, f *cliFlags, args []string) error {
+	report, err := store.Fsck(ctx, f.repair)
+	if report != nil {
+		if err := printJSON(os.Stdout, report); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	unrepaired := 0
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			unrepaired++
+		}
+	}
+	if unrepaired > 0 {
+		return fmt.Errorf("%d of %d discrepancies unrepaired", unrepaired, len(report.Issues))
+	}
+	return nil
+}
+
+// runQueryCommand runs a query against -node, or the local store if it isn't set
+func runQueryCommand(ctx context.Context, cfg *config.Config, f *cliFlags, args []string) error {
+	// Queries against a running node don't open the local store
+	if f.node != "" {
+		return runQuery(ctx, newHTTPSource(f.node, f.apiKey), args, f.filter, f.output, os.Stdout)
+	}
+	return withStore(func(ctx context.Context, store *adapter.OrbitDBAdapter, f *cliFlags, args []string) error {
+		return runQuery(ctx, &storeSource{store: store}, args, f.filter, f.output, os.Stdout)
+	})(ctx, cfg, f, args)
+}
+
+// runPeers lists the peers a running node exchanged heads with
+func runPeers(ctx context.Context, cfg *config.Config, f *cliFlags, args []string) error {
+	if f.output != outputJSON && f.output != outputTable {
+		return fmt.Errorf("invalid -output %q, must be json or table", f.output)
+	}
+	var status adapter.ReplicationStatus
+	if err := newHTTPSource(nodeURL(cfg, f), f.apiKey).do(ctx, http.MethodGet, "/api/status/replication", nil, &status); err != nil {
+		return err
+	}
+	if f.output == outputTable {
+		return printPeersTable(os.Stdout, status.Peers)
+	}
+	return printJSON(os.Stdout, status.Peers)
+}
+
+// runInfo prints the status of a running node
+func runInfo(ctx context.Context, cfg *config.Config, f *cliFlags, args []string) error {
+	var status router.NodeStatus
+	if err := newHTTPSource(nodeURL(cfg, f), f.apiKey).do(ctx, http.MethodGet, "/api/status", nil, &status); err != nil {
+		return err
+	}
+	return printJSON(os.Stdout, status)
+}
+
+// nodeURL returns the base URL of the node of the peers and info commands, the local node on
+// the configured port if -node isn't set
+func nodeURL(cfg *config.Config, f *cliFlags) string {
+	if f.node != "" {
+		return f.node
+	}
+	return "http://localhost:" + cfg.API.Port
+}
+
+// printPeersTable prints the peers heads were exchanged with
+func printPeersTable(out io.Writer, peers []adapter.PeerExchangeStats) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PEER\tEXCHANGES\tHEADS\tLAST EXCHANGE")
+	for _, peer := range peers {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", peer.Peer, peer.Exchanges, peer.HeadsReceived, formatTimestamp(peer.LastExchange.Unix()))
+	}
+	return w.Flush()
+}
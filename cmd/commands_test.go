@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// Test that the command line selects the command and parses only the flags it accepts
+func TestParseCommandLine(t *testing.T) {
+	var out bytes.Buffer
+
+	cmd, fs, f, err := parseCommandLine([]string{"-db", "/orbitdb/abc/events", "-port", "9090"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "serve", cmd.name)
+	cfg := config.Default()
+	applyFlagOverrides(fs, f, cfg)
+	assert.Equal(t, "/orbitdb/abc/events", cfg.OrbitDB.Address)
+	assert.Equal(t, "9090", cfg.API.Port)
+
+	cmd, fs, f, err = parseCommandLine([]string{"import", "-db", "/orbitdb/abc/events", "events.jsonl"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "import", cmd.name)
+	assert.Equal(t, "events.jsonl", archivePath(f, fs.Args()))
+
+	cmd, _, _, err = parseCommandLine([]string{"rebuild"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "rebuild-stats", cmd.name)
+
+	cmd, _, f, err = parseCommandLine([]string{"peers", "-node", "http://node:8080", "-output", "table"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "peers", cmd.name)
+	assert.Equal(t, "http://node:8080", nodeURL(config.Default(), f))
+
+	cmd, _, f, err = parseCommandLine([]string{"backfill", "--relay", "wss://a.example", "--relay", "wss://b.example", "--filter", `{"kinds":[1]}`}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "backfill", cmd.name)
+	assert.Equal(t, []string{"wss://a.example", "wss://b.example"}, []string(f.relays))
+	assert.Equal(t, `{"kinds":[1]}`, f.filter)
+
+	_, _, _, err = parseCommandLine([]string{"peers", "-port", "9090"}, &out)
+	assert.Error(t, err, "peers doesn't take -port")
+
+	_, _, _, err = parseCommandLine([]string{"compact"}, &out)
+	assert.EqualError(t, err, "unknown command: compact")
+
+	out.Reset()
+	_, _, _, err = parseCommandLine([]string{"help"}, &out)
+	assert.ErrorIs(t, err, flag.ErrHelp)
+	for _, cmd := range subcommands {
+		assert.Contains(t, out.String(), cmd.name)
+	}
+}
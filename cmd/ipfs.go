@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 
@@ -19,6 +18,7 @@ import (
 	"github.com/ipfs/kubo/core/node/libp2p"
 	// "github.com/ipfs/kubo/plugin/loader"
 	"github.com/ipfs/kubo/repo/fsrepo"
+	"go.uber.org/zap"
 
 	// 导入 IPFS 数据存储驱动
 	_ "github.com/ipfs/go-ds-badger"
@@ -47,7 +47,7 @@ func InitIPFS(repoPath string) (coreiface.CoreAPI, *core.IpfsNode, error) {
 		repoPath = filepath.Join(home, repoPath[1:])
 	}
 
-	log.Printf("使用 IPFS 仓库路径: %s", repoPath)
+	zap.L().Info("Using IPFS repository", zap.String("path", repoPath))
 	plugins, err := loader.NewPluginLoader(repoPath)
 	if err != nil {
 		panic(fmt.Errorf("error loading plugins: %s", err))
@@ -66,7 +66,7 @@ func InitIPFS(repoPath string) (coreiface.CoreAPI, *core.IpfsNode, error) {
 
 	// 如果仓库不存在，初始化它
 	if !exists {
-		log.Printf("初始化 IPFS 仓库: %s", repoPath)
+		zap.L().Info("Initializing IPFS repository", zap.String("path", repoPath))
 		if err := initRepo(repoPath); err != nil {
 			return nil, nil, fmt.Errorf("初始化 IPFS 仓库失败: %w", err)
 		}
@@ -99,7 +99,7 @@ func InitIPFS(repoPath string) (coreiface.CoreAPI, *core.IpfsNode, error) {
 		return nil, nil, fmt.Errorf("创建 IPFS API 失败: %w", err)
 	}
 
-	log.Println("IPFS 节点初始化成功")
+	zap.L().Info("IPFS node initialized")
 	return api, node, nil
 }
 
@@ -2,34 +2,33 @@ package main
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
-	// "encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
 
 	orbitdb "berty.tech/go-orbit-db"
 	"berty.tech/go-orbit-db/iface"
 	coreiface "github.com/ipfs/kubo/core/coreiface"
 
 	// shell "github.com/ipfs/go-ipfs-api"
-	core "github.com/ipfs/kubo/core"
-	"github.com/ipfs/kubo/core/coreapi"
 
 	// coreapi "github.com/ipfs/kubo/client/rpc"
+	"github.com/hetu-project/cRelay-crdt-db/crelay"
 	router "github.com/hetu-project/cRelay-crdt-db/internal/api"
-	adapter "github.com/hetu-project/cRelay-crdt-db/orbitdb"
-	"github.com/libp2p/go-libp2p"
-	"github.com/libp2p/go-libp2p/core/crypto"
-	"github.com/libp2p/go-libp2p/core/host"
-	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/logging"
+	"github.com/hetu-project/cRelay-crdt-db/internal/tracing"
+	"go.uber.org/zap"
 
 	// "github.com/multiformats/go-multiaddr"
-	ma "github.com/multiformats/go-multiaddr"
 
 	// Import IPFS data storage drivers
 	_ "github.com/ipfs/go-ds-badger"
@@ -39,168 +38,137 @@ import (
 	// "github.com/ipfs/kubo/core/node/libp2p"
 )
 
-var (
-	dbAddress      = flag.String("db", "", "OrbitDB address to connect to")
-	relayMultiaddr = flag.String("Multiaddr", "", "relayMultiaddr")
-	port           = flag.String("port", "8080", "API service port")
-	orbitDBDir     = flag.String("orbitdb-dir", "", "OrbitDB data storage directory")
-	// dbName        = flag.String("db-name", "", "Database name")
-	StoreType = "docstore" // eventlog|keyvalue|docstore
-	Create    = true
-)
-
 func main() {
-	flag.Parse()
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	cmd, fs, f, err := parseCommandLine(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	if *orbitDBDir == "" {
-		home, _ := os.UserHomeDir()
-		*orbitDBDir = filepath.Join(home, "api-data", "orbitdb")
+	cfg, err := config.Load(f.configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
-	log.Printf("API service OrbitDB database address: %s", *orbitDBDir)
-	// Ensure directories exist
-	if err := os.MkdirAll(*orbitDBDir, 0755); err != nil {
-		log.Fatalf("Failed to create directory %s: %v", *orbitDBDir, err)
+	applyFlagOverrides(fs, f, cfg)
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	node, _ := core.NewNode(ctx, &core.BuildCfg{
-		Online: true, // Must be true, OrbitDB requires network functionality
-		// NilRepo: false, // Requires persistent storage
-		ExtraOpts: map[string]bool{
-			"pubsub": true, // OrbitDB depends on PubSub
-			"mplex":  true, // Multiplexing support
-		},
-	})
-	api, _ := coreapi.NewCoreAPI(node)
+	restoreLogger, err := logging.Setup(cfg.Log)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer restoreLogger()
 
-	orbit, err := orbitdb.NewOrbitDB(ctx, api, &orbitdb.NewOrbitDBOptions{
-		Directory: orbitDBDir,
-	})
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		log.Fatalf("Failed to create OrbitDB instance: %v", err)
-	}
-	// Open or create database
-	var db iface.DocumentStore
-	if *dbAddress != "" {
-		// Connect to existing database
-		log.Printf("Connecting to database: %s", *dbAddress)
-		dbInstance, err := orbit.Open(ctx, *dbAddress, &orbitdb.CreateDBOptions{
-			Directory: orbitDBDir,
-			Create:    &Create,
-			StoreType: &StoreType,
-		})
-		if err != nil {
-			log.Fatalf("Failed to open database: %v", err)
-		}
-		addr, _ := ma.NewMultiaddr(*relayMultiaddr)
-		addrInfo, _ := peer.AddrInfoFromP2pAddr(addr)
-		err = api.Swarm().Connect(ctx, *addrInfo)
-		if err != nil {
-			log.Printf("Failed to connect to Relay node: %v", err)
-		} else {
-			log.Printf("Successfully connected to Relay node")
-		}
-		defer orbit.Close()
-		db = dbInstance.(iface.DocumentStore)
-		newadd := db.Address().String()
-		log.Printf("API database address: %s", newadd)
-		// Create API router
-		router := router.NewRouter(adapter.NewOrbitDBAdapter(db))
-
-		// Start HTTP server
-		addrs := fmt.Sprintf(":%s", *port)
-		log.Printf("API service starting on %s", addrs)
-		if err := http.ListenAndServe(addrs, router.Handler()); err != nil {
-			log.Fatalf("HTTP server error: %v", err)
+		zap.L().Fatal("Failed to set up tracing", zap.Error(err))
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			zap.L().Warn("Failed to flush traces", zap.Error(err))
 		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	} else {
-		log.Fatal(`
-                   Error: Database address not specified!
-                   Please start the relay service first to generate a database address, then run this API service with the -db parameter.
-                   Example command:
-                   ./api-service -db /orbitdb/zdpuAm... -port 8080
-		`)
-		//log.Printf("Database created with address: %s", db.Address().String())
+	if err := cmd.run(ctx, cfg, f, fs.Args()); err != nil {
+		zap.L().Fatal("Command failed", zap.String("command", cmd.name), zap.Error(err))
 	}
 }
 
-// getOrCreatePeerID loads or creates a peer ID
-func getOrCreatePeerID(settingsDir string) (crypto.PrivKey, peer.ID, error) {
-	keyFile := filepath.Join(settingsDir, "peer.key")
-
-	// Check if key file exists
-	if _, err := os.Stat(keyFile); os.IsNotExist(err) {
-		// Generate new key
-		priv, pub, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to generate key pair: %w", err)
-		}
-
-		// Get peer ID from public key
-		pid, err := peer.IDFromPublicKey(pub)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to get peer ID: %w", err)
-		}
-
-		// Serialize private key
-		keyBytes, err := crypto.MarshalPrivateKey(priv)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to marshal private key: %w", err)
-		}
+// runCreateDB creates a new database in this process and serves it
+func runCreateDB(ctx context.Context, cfg *config.Config, f *cliFlags, args []string) error {
+	if cfg.OrbitDB.Name == "" {
+		return fmt.Errorf("create-db requires -db-name")
+	}
+	cfg.OrbitDB.Standalone = true
+	return runServe(ctx, cfg, f, args)
+}
 
-		// Save to file
-		if err := ioutil.WriteFile(keyFile, keyBytes, 0600); err != nil {
-			return nil, "", fmt.Errorf("failed to save key: %w", err)
-		}
+// runServe opens the node and serves the API until SIGINT or SIGTERM
+func runServe(ctx context.Context, cfg *config.Config, f *cliFlags, args []string) error {
+	// Cancelled on SIGINT/SIGTERM to trigger graceful shutdown
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		log.Printf("Generated new peer ID: %s", pid.String())
-		return priv, pid, nil
+	zap.L().Info("API service OrbitDB directory", zap.String("directory", cfg.OrbitDB.Directory))
+	node, err := crelay.New(ctx, crelay.WithConfig(cfg))
+	if errors.Is(err, crelay.ErrNoDatabase) {
+		zap.L().Fatal(noDatabaseHelp)
 	}
-
-	// Load existing key
-	keyBytes, err := ioutil.ReadFile(keyFile)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to read key file: %w", err)
+		return fmt.Errorf("failed to start node: %w", err)
+	}
+	if cfg.OrbitDB.Standalone {
+		// Other API nodes connect to this database with -db
+		fmt.Printf("Database address: %s\n", node.Address())
 	}
 
-	// Unmarshal private key
-	priv, err := crypto.UnmarshalPrivateKey(keyBytes)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to unmarshal private key: %w", err)
+	// Start HTTP server
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%s", cfg.API.Port),
+		Handler: node.Router().Handler(),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	serverErr := make(chan error, 2)
+	go func() {
+		zap.L().Info("API service starting", zap.String("address", srv.Addr))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+	// Co-located services such as the relay can use the Unix socket instead of the port
+	if cfg.API.UnixSocket != "" {
+		go serveUnix(srv, cfg.API, serverErr)
 	}
 
-	// Get peer ID from public key
-	pub := priv.GetPublic()
-	pid, err := peer.IDFromPublicKey(pub)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to get peer ID: %w", err)
+	select {
+	case <-sigCtx.Done():
+		zap.L().Info("Shutdown signal received")
+	case err := <-serverErr:
+		zap.L().Error("HTTP server error", zap.Error(err))
 	}
 
-	log.Printf("Loaded existing peer ID: %s", pid.String())
-	return priv, pid, nil
+	shutdown(srv, node, cfg.API.ShutdownTimeout)
+	return nil
 }
 
-// setupLibp2p creates a libp2p host
-func setupLibp2p(ctx context.Context, privKey crypto.PrivKey, listenAddr string) (host.Host, error) {
-	addr, err := ma.NewMultiaddr(listenAddr)
+// serveUnix serves the API on the configured Unix domain socket until the server is shut down
+func serveUnix(srv *http.Server, cfg config.APIConfig, serverErr chan<- error) {
+	mode, _ := cfg.SocketMode() // Checked by config validation
+	listener, err := router.ListenUnix(cfg.UnixSocket, mode)
 	if err != nil {
-		return nil, fmt.Errorf("invalid listen address: %w", err)
+		serverErr <- fmt.Errorf("failed to listen on %s: %w", cfg.UnixSocket, err)
+		return
 	}
 
-	// Create libp2p host with only necessary options
-	host, err := libp2p.New(
-		libp2p.ListenAddrs(addr),
-		libp2p.Identity(privKey),
-		libp2p.EnableRelay(),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create libp2p host: %w", err)
+	zap.L().Info("API service starting", zap.String("address", "unix:"+cfg.UnixSocket))
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		serverErr <- err
+	}
+}
+
+// shutdown stops the HTTP server, waiting for in-flight requests, then closes the node
+func shutdown(srv *http.Server, node *crelay.Node, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		zap.L().Error("HTTP server shutdown error", zap.Error(err))
 	}
 
-	return host, nil
+	node.Close()
+
+	zap.L().Info("Shutdown complete")
 }
 
 // connectToExistingDB connects to the database created by relay
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	router "github.com/hetu-project/cRelay-crdt-db/internal/api"
+	adapter "github.com/hetu-project/cRelay-crdt-db/orbitdb"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Targets of the query command, e.g. ./api-service query -node http://localhost:8080 stats <pubkey>
+// or ./api-service query -db /orbitdb/... -filter '{"kinds":[30300]}' -output table events
+const (
+	queryEvents   = "events"   // Events matching -filter
+	querySubspace = "subspace" // Causality document of a subspace
+	queryKeys     = "keys"     // Causality keys of a subspace
+	queryStats    = "stats"    // Statistics of a user
+)
+
+// Output formats of the query command
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+)
+
+// querySource answers the query command, either from a running node or from the local store
+type querySource interface {
+	Events(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error)
+	Subspace(ctx context.Context, subspaceID string) (*adapter.SubspaceCausality, error)
+	Keys(ctx context.Context, subspaceID string) ([]*adapter.CausalityKey, error)
+	UserStats(ctx context.Context, pubkey string) (*adapter.UserStats, error)
+}
+
+// runQuery runs the query named by args against source and prints the result to out
+func runQuery(ctx context.Context, source querySource, args []string, filterJSON, output string, out io.Writer) error {
+	if output != outputJSON && output != outputTable {
+		return fmt.Errorf("invalid -output %q, must be json or table", output)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing query target: events, subspace <id>, keys <id> or stats <pubkey>")
+	}
+
+	target := args[0]
+	var argument string
+	if target != queryEvents {
+		if len(args) < 2 {
+			return fmt.Errorf("query %s requires an argument", target)
+		}
+		argument = args[1]
+	}
+
+	switch target {
+	case queryEvents:
+		var filter nostr.Filter
+		if err := json.Unmarshal([]byte(filterJSON), &filter); err != nil {
+			return fmt.Errorf("invalid -filter: %w", err)
+		}
+		events, err := source.Events(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if output == outputTable {
+			return printEventsTable(out, events)
+		}
+		return printJSON(out, events)
+	case querySubspace:
+		causality, err := source.Subspace(ctx, argument)
+		if err != nil {
+			return err
+		}
+		if causality == nil {
+			return fmt.Errorf("subspace %s does not exist", argument)
+		}
+		if output == outputTable {
+			return printSubspaceTable(out, causality)
+		}
+		return printJSON(out, causality)
+	case queryKeys:
+		keys, err := source.Keys(ctx, argument)
+		if err != nil {
+			return err
+		}
+		if output == outputTable {
+			return printKeysTable(out, keys)
+		}
+		return printJSON(out, keys)
+	case queryStats:
+		stats, err := source.UserStats(ctx, argument)
+		if err != nil {
+			return err
+		}
+		if stats == nil {
+			return fmt.Errorf("no statistics for user %s", argument)
+		}
+		if output == outputTable {
+			return printStatsTable(out, stats)
+		}
+		return printJSON(out, stats)
+	default:
+		return fmt.Errorf("unknown query target: %s", target)
+	}
+}
+
+// storeSource answers queries from the local store
+type storeSource struct {
+	store *adapter.OrbitDBAdapter
+}
+
+// Events returns the events matching filter, honoring its limit
+func (s *storeSource) Events(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	eventChan, err := s.store.QueryEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*nostr.Event, 0)
+	for event := range eventChan {
+		if filter.Limit > 0 && len(events) >= filter.Limit {
+			break
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Subspace returns the causality document of a subspace
+func (s *storeSource) Subspace(ctx context.Context, subspaceID string) (*adapter.SubspaceCausality, error) {
+	return s.store.GetSubspaceCausality(ctx, subspaceID)
+}
+
+// Keys returns the causality keys of a subspace
+func (s *storeSource) Keys(ctx context.Context, subspaceID string) ([]*adapter.CausalityKey, error) {
+	return s.store.ListCausalityKeys(ctx, subspaceID)
+}
+
+// UserStats returns the statistics of a user
+func (s *storeSource) UserStats(ctx context.Context, pubkey string) (*adapter.UserStats, error) {
+	return s.store.GetUserStats(ctx, pubkey)
+}
+
+// httpSource answers queries from a running node through its HTTP API
+type httpSource struct {
+	node   string // Base URL of the node, e.g. http://localhost:8080
+	apiKey string // Sent as X-API-Key if set
+	client *http.Client
+}
+
+// newHTTPSource creates a source querying the node at base URL node
+func newHTTPSource(node, apiKey string) *httpSource {
+	return &httpSource{
+		node:   strings.TrimSuffix(node, "/"),
+		apiKey: apiKey,
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Events returns the events matching filter. The query endpoint takes sid and parent tag
+// filters only, so other tag filters are rejected instead of being silently dropped.
+func (s *httpSource) Events(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	body := map[string]interface{}{}
+	if len(filter.IDs) > 0 {
+		body["ids"] = filter.IDs
+	}
+	if len(filter.Authors) > 0 {
+		body["authors"] = filter.Authors
+	}
+	if len(filter.Kinds) > 0 {
+		body["kinds"] = filter.Kinds
+	}
+	if filter.Limit > 0 {
+		body["limit"] = filter.Limit
+	}
+	if filter.Since != nil {
+		body["since"] = *filter.Since
+	}
+	if filter.Until != nil {
+		body["until"] = *filter.Until
+	}
+	for tag, values := range filter.Tags {
+		if tag != "sid" && tag != "parent" {
+			return nil, fmt.Errorf("tag filter #%s is not supported against a node", tag)
+		}
+		body[tag] = values
+	}
+
+	var events []*nostr.Event
+	if err := s.do(ctx, http.MethodPost, "/api/events/query", body, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Subspace returns the causality document of a subspace, nil if it doesn't exist
+func (s *httpSource) Subspace(ctx context.Context, subspaceID string) (*adapter.SubspaceCausality, error) {
+	var causality adapter.SubspaceCausality
+	err := s.do(ctx, http.MethodGet, "/api/subspaces/"+url.PathEscape(subspaceID), nil, &causality)
+	if err == errNotFound {
+		return nil, nil
+	}
+	return &causality, err
+}
+
+// Keys returns the causality keys of a subspace, following the pages of the listing
+func (s *httpSource) Keys(ctx context.Context, subspaceID string) ([]*adapter.CausalityKey, error) {
+	const pageSize = 500
+
+	keys := []*adapter.CausalityKey{}
+	for {
+		var page struct {
+			Total int                     `json:"total"`
+			Keys  []*adapter.CausalityKey `json:"keys"`
+		}
+		path := fmt.Sprintf("/api/subspaces/%s/keys?limit=%d&offset=%d", url.PathEscape(subspaceID), pageSize, len(keys))
+		if err := s.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+			return nil, err
+		}
+		keys = append(keys, page.Keys...)
+		if len(page.Keys) == 0 || len(keys) >= page.Total {
+			return keys, nil
+		}
+	}
+}
+
+// UserStats returns the statistics of a user, nil if there are none
+func (s *httpSource) UserStats(ctx context.Context, pubkey string) (*adapter.UserStats, error) {
+	var stats adapter.UserStats
+	err := s.do(ctx, http.MethodGet, "/api/users/"+url.PathEscape(pubkey)+"/stats", nil, &stats)
+	if err == errNotFound {
+		return nil, nil
+	}
+	return &stats, err
+}
+
+// errNotFound is returned by httpSource.do for 404 responses
+var errNotFound = errors.New("not found")
+
+// do sends a request to the node and decodes the JSON response into result
+func (s *httpSource) do(ctx context.Context, method, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.node+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.apiKey != "" {
+		req.Header.Set(router.APIKeyHeader, s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// printJSON prints a query result as indented JSON
+func printJSON(out io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// printEventsTable prints one row per event
+func printEventsTable(out io.Writer, events []*nostr.Event) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKIND\tAUTHOR\tCREATED\tCONTENT")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", event.ID, event.Kind, event.PubKey,
+			formatTimestamp(int64(event.CreatedAt)), truncate(event.Content, 40))
+	}
+	return w.Flush()
+}
+
+// printSubspaceTable prints the summary of a subspace followed by its key counters
+func printSubspaceTable(out io.Writer, causality *adapter.SubspaceCausality) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "SUBSPACE\t%s\n", causality.ID)
+	fmt.Fprintf(w, "EVENTS\t%d\n", causality.EventCount+len(causality.Events))
+	fmt.Fprintf(w, "CREATED\t%s\n", formatTimestamp(causality.Created))
+	fmt.Fprintf(w, "UPDATED\t%s\n", formatTimestamp(causality.Updated))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "KEY\tLABEL\tCOUNTER")
+	keyIDs := make([]uint32, 0, len(causality.Keys))
+	for keyID := range causality.Keys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Slice(keyIDs, func(i, j int) bool { return keyIDs[i] < keyIDs[j] })
+	for _, keyID := range keyIDs {
+		label := ""
+		if meta := causality.KeyMeta[keyID]; meta != nil {
+			label = meta.Label
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\n", keyID, label, causality.Keys[keyID])
+	}
+	return w.Flush()
+}
+
+// printKeysTable prints one row per causality key
+func printKeysTable(out io.Writer, keys []*adapter.CausalityKey) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tLABEL\tCOUNTER\tUPDATED\tLAST EVENT")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", key.Key, key.Label, key.Counter, formatTimestamp(key.Updated), key.LastEvent)
+	}
+	return w.Flush()
+}
+
+// printStatsTable prints the statistics of a user as field/value rows
+func printStatsTable(out io.Writer, stats *adapter.UserStats) error {
+	// Go through JSON so every statistic is listed under its API name
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tVALUE")
+	for _, name := range names {
+		value, err := json.Marshal(fields[name])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, truncate(string(value), 80))
+	}
+	return w.Flush()
+}
+
+// formatTimestamp formats a Unix timestamp for tables, empty if unset
+func formatTimestamp(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+// truncate shortens s to at most n runes for table cells, keeping it on one line
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return s
+}
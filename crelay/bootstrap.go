@@ -0,0 +1,542 @@
+package crelay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	orbitdb "berty.tech/go-orbit-db"
+	"berty.tech/go-orbit-db/accesscontroller"
+	"berty.tech/go-orbit-db/iface"
+	core "github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreapi"
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/repo"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+
+	router "github.com/hetu-project/cRelay-crdt-db/internal/api"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/index"
+	"github.com/hetu-project/cRelay-crdt-db/internal/p2p"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	adapter "github.com/hetu-project/cRelay-crdt-db/orbitdb"
+
+	// Import IPFS data storage drivers
+	_ "github.com/ipfs/go-ds-badger"
+	_ "github.com/ipfs/go-ds-flatfs"
+	_ "github.com/ipfs/go-ds-leveldb"
+	_ "github.com/ipfs/go-ds-measure"
+)
+
+// openExistingDB starts an IPFS node and OrbitDB instance and opens the configured database address,
+// or the databases split by document type, and the keyvalue store of the causality counters if
+// configured. Also returns the API of the IPFS node and a function closing the stores, the OrbitDB
+// instance and the IPFS node in that order.
+func openExistingDB(ctx context.Context, cfg *config.Config, monitor *adapter.ReplicationMonitor) (iface.DocumentStore, iface.KeyValueStore, coreiface.CoreAPI, func(), error) {
+	nodeRepo, err := ipfsRepo(cfg)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	node, err := core.NewNode(ctx, &core.BuildCfg{
+		Online: true, // Must be true, OrbitDB requires network functionality
+		Repo:   nodeRepo,
+		// NilRepo: false, // Requires persistent storage
+		ExtraOpts: map[string]bool{
+			"pubsub": true, // OrbitDB depends on PubSub
+			"mplex":  true, // Multiplexing support
+		},
+	})
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to create IPFS node: %w", err)
+	}
+	api, err := coreapi.NewCoreAPI(node)
+	if err != nil {
+		node.Close()
+		return nil, nil, nil, nil, fmt.Errorf("failed to create IPFS API: %w", err)
+	}
+
+	orbit, err := orbitdb.NewOrbitDB(ctx, api, &orbitdb.NewOrbitDBOptions{
+		Directory: &cfg.OrbitDB.Directory,
+		Logger:    zap.L(),
+		Tracer:    otel.Tracer("berty.tech/go-orbit-db"),
+	})
+	if err != nil {
+		node.Close()
+		return nil, nil, nil, nil, fmt.Errorf("failed to create OrbitDB instance: %w", err)
+	}
+
+	// Databases created with the nostr controller check event signatures on every entry,
+	// including replicated ones
+	if cfg.AccessController.Type == adapter.NostrAccessControllerType {
+		policy := &adapter.NostrWritePolicy{
+			PubKeys:   cfg.AccessController.PubKeys,
+			Subspaces: cfg.AccessController.Subspaces,
+		}
+		if err := orbit.RegisterAccessControllerType(adapter.NewNostrAccessControllerConstructor(policy)); err != nil {
+			orbit.Close()
+			node.Close()
+			return nil, nil, nil, nil, fmt.Errorf("failed to register nostr access controller: %w", err)
+		}
+	}
+
+	// Stores opened so far, closed in reverse order on failure and shutdown
+	var opened []iface.Store
+	closeOpened := func() {
+		for i := len(opened) - 1; i >= 0; i-- {
+			if err := opened[i].Close(); err != nil {
+				zap.L().Error("Failed to close document store", zap.Error(err))
+			}
+		}
+	}
+	fail := func(err error) (iface.DocumentStore, iface.KeyValueStore, coreiface.CoreAPI, func(), error) {
+		closeOpened()
+		orbit.Close()
+		node.Close()
+		return nil, nil, nil, nil, err
+	}
+
+	// Connect to existing database
+	var db iface.DocumentStore
+	if cfg.OrbitDB.Address != "" {
+		zap.L().Info("Connecting to database", zap.String("address", cfg.OrbitDB.Address))
+		db, err = openDocumentStore(ctx, orbit, cfg, cfg.OrbitDB.Address)
+		if err != nil {
+			return fail(fmt.Errorf("failed to open database: %w", err))
+		}
+		opened = append(opened, db)
+	}
+
+	// Open the migration target and dual-write into it
+	var newDB iface.DocumentStore
+	if cfg.OrbitDB.MigrateTo != "" {
+		zap.L().Info("Migrating to database", zap.String("address", cfg.OrbitDB.MigrateTo))
+		newDB, err = openDocumentStore(ctx, orbit, cfg, cfg.OrbitDB.MigrateTo)
+		if err != nil {
+			return fail(fmt.Errorf("failed to open migration database: %w", err))
+		}
+		opened = append(opened, newDB)
+	}
+
+	// Open the databases split by document type. With a single-store address also set, the
+	// split stores are the migration target.
+	if stores := cfg.OrbitDB.Stores; stores.Enabled() {
+		var split [3]iface.DocumentStore
+		for i, address := range []string{stores.Events, stores.Causality, stores.Stats} {
+			zap.L().Info("Connecting to split database", zap.String("address", address))
+			if split[i], err = openDocumentStore(ctx, orbit, cfg, address); err != nil {
+				return fail(fmt.Errorf("failed to open split database %s: %w", address, err))
+			}
+			opened = append(opened, split[i])
+		}
+		splitDB := adapter.NewSplitStore(split[0], split[1], split[2])
+		if db == nil {
+			db = splitDB
+		} else {
+			zap.L().Info("Migrating to split databases")
+			newDB = splitDB
+		}
+	}
+
+	// Open the keyvalue store of the causality counters
+	var counters iface.KeyValueStore
+	if cfg.Causality.CounterStore == adapter.CounterStoreKeyValue {
+		zap.L().Info("Connecting to causality counters", zap.String("address", cfg.Causality.CountersAddress))
+		if counters, err = openKeyValueStore(ctx, orbit, cfg, cfg.Causality.CountersAddress); err != nil {
+			return fail(fmt.Errorf("failed to open causality counters: %w", err))
+		}
+		opened = append(opened, counters)
+	}
+
+	// Record replicated entries and the heads exchanged with peers for the replication status
+	for _, bus := range append([]event.Bus{orbit.EventBus()}, eventBuses(opened)...) {
+		if err := monitor.Watch(ctx, bus); err != nil {
+			zap.L().Warn("Replication status incomplete", zap.Error(err))
+		}
+	}
+
+	// Keep the relay and bootstrap peers connected, replication stalls without them
+	dialer := swarmDialer{api: api, host: node.PeerHost}
+	peers := p2p.NewPeerKeeper(dialer, cfg.Relay)
+	peers.Start(ctx)
+
+	// Find the other nodes serving the opened databases
+	var discovery *p2p.Discovery
+	if cfg.P2P.DHTDiscovery {
+		addresses := make([]string, len(opened))
+		for i, store := range opened {
+			addresses[i] = store.Address().String()
+		}
+		if discovery, err = p2p.NewDiscovery(node.Routing, dialer, node.Identity, addresses, cfg.P2P.DiscoveryInterval); err != nil {
+			peers.Stop()
+			return fail(fmt.Errorf("failed to set up peer discovery: %w", err))
+		}
+		discovery.Start(ctx)
+	}
+
+	closeStore := func() {
+		discovery.Stop()
+		peers.Stop()
+		closeOpened()
+		if err := orbit.Close(); err != nil {
+			zap.L().Error("Failed to close OrbitDB instance", zap.Error(err))
+		}
+		if err := node.Close(); err != nil {
+			zap.L().Error("Failed to close IPFS node", zap.Error(err))
+		}
+	}
+
+	if newDB != nil {
+		return adapter.NewMigrationStore(db, newDB), counters, api, closeStore, nil
+	}
+	return db, counters, api, closeStore, nil
+}
+
+// openReadIndex opens the local event index in front of store, following the writes and
+// replication of the database of bus, and builds it in the background. Events are read from
+// the store until the index is built. Also returns a function closing the index.
+func openReadIndex(ctx context.Context, cfg *config.Config, store storage.Store, bus event.Bus) (*index.IndexedStore, func(), error) {
+	dir := cfg.ReadIndex.Directory
+	if dir == "" {
+		dir = filepath.Join(cfg.OrbitDB.Directory, "read-index")
+	}
+	idx, err := index.Open(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	indexed := index.NewIndexedStore(store, idx)
+	if err := indexed.Watch(ctx, bus); err != nil {
+		cancel()
+		idx.Close()
+		return nil, nil, err
+	}
+	built := make(chan struct{})
+	go func() {
+		defer close(built)
+		start := time.Now()
+		n, err := indexed.Build(ctx)
+		if err != nil {
+			zap.L().Warn("Event index build failed, events are read from OrbitDB", zap.Error(err))
+			return
+		}
+		zap.L().Info("Indexed events", zap.Int("events", n), zap.Duration("duration", time.Since(start).Round(time.Millisecond)))
+	}()
+
+	return indexed, func() {
+		cancel()
+		<-built
+		if err := idx.Close(); err != nil {
+			zap.L().Warn("Failed to close event index", zap.Error(err))
+		}
+	}, nil
+}
+
+// eventBuses returns the event buses of stores
+func eventBuses(stores []iface.Store) []event.Bus {
+	buses := make([]event.Bus, len(stores))
+	for i, store := range stores {
+		buses[i] = store.EventBus()
+	}
+	return buses
+}
+
+// openDocumentStore opens a document database address with the configured options
+func openDocumentStore(ctx context.Context, orbit iface.OrbitDB, cfg *config.Config, address string) (iface.DocumentStore, error) {
+	dbInstance, err := orbit.Open(ctx, address, &orbitdb.CreateDBOptions{
+		Directory: &cfg.OrbitDB.Directory,
+		Create:    &cfg.OrbitDB.Create,
+		StoreType: &cfg.OrbitDB.StoreType,
+		AccessController: &accesscontroller.CreateAccessControllerOptions{
+			Type: cfg.AccessController.Type,
+			Access: map[string][]string{
+				"write": cfg.AccessController.Write,
+			},
+		},
+		StoreSpecificOpts: adapter.DocumentStoreOptions(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db, ok := dbInstance.(iface.DocumentStore)
+	if !ok {
+		dbInstance.Close()
+		return nil, fmt.Errorf("database %s is not a document store", address)
+	}
+	loadSnapshot(ctx, cfg, db)
+	return db, nil
+}
+
+// loadSnapshot loads a store from its last snapshot when enabled, so a cold start doesn't
+// replay the full oplog. A store without a snapshot is used as opened.
+func loadSnapshot(ctx context.Context, cfg *config.Config, store iface.Store) {
+	if !cfg.Snapshot.LoadOnStart {
+		return
+	}
+	if err := store.LoadFromSnapshot(ctx); err != nil {
+		zap.L().Info("No snapshot loaded", zap.Stringer("address", store.Address()), zap.Error(err))
+		return
+	}
+	zap.L().Info("Loaded from snapshot", zap.Stringer("address", store.Address()))
+}
+
+// openKeyValueStore opens a keyvalue database address with the configured options
+func openKeyValueStore(ctx context.Context, orbit iface.OrbitDB, cfg *config.Config, address string) (iface.KeyValueStore, error) {
+	storeType := "keyvalue"
+	dbInstance, err := orbit.Open(ctx, address, &orbitdb.CreateDBOptions{
+		Directory: &cfg.OrbitDB.Directory,
+		Create:    &cfg.OrbitDB.Create,
+		StoreType: &storeType,
+		AccessController: &accesscontroller.CreateAccessControllerOptions{
+			Type: cfg.AccessController.Type,
+			Access: map[string][]string{
+				"write": cfg.AccessController.Write,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	kv, ok := dbInstance.(iface.KeyValueStore)
+	if !ok {
+		dbInstance.Close()
+		return nil, fmt.Errorf("database %s is not a keyvalue store", address)
+	}
+	loadSnapshot(ctx, cfg, kv)
+	return kv, nil
+}
+
+// createStandaloneDB creates a new document database in this process using the relay
+// bootstrap logic, so a single process can start a network
+func createStandaloneDB(cfg *config.Config) (iface.DocumentStore, coreiface.CoreAPI, func(), error) {
+	zap.L().Info("Creating standalone database", zap.String("name", cfg.OrbitDB.Name))
+	nodeRepo, err := ipfsRepo(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	adapter.SetRepo(nodeRepo)
+	if err := adapter.Init(cfg.OrbitDB.Name, cfg.OrbitDB.Directory); err != nil {
+		adapter.Close()
+		return nil, nil, nil, err
+	}
+
+	db, err := adapter.GetStore()
+	if err != nil {
+		adapter.Close()
+		return nil, nil, nil, err
+	}
+	api, err := adapter.GetCoreAPI()
+	if err != nil {
+		adapter.Close()
+		return nil, nil, nil, err
+	}
+
+	closeStore := func() {
+		if err := adapter.Close(); err != nil {
+			zap.L().Error("Failed to close database", zap.Error(err))
+		}
+	}
+
+	return db, api, closeStore, nil
+}
+
+// ipfsRepo returns the repository of the IPFS node, with the peer identity persisted in the
+// OrbitDB directory, the configured transports and NAT traversal, in the private network of
+// the swarm key if one is configured
+func ipfsRepo(cfg *config.Config) (repo.Repo, error) {
+	priv, _, err := getOrCreatePeerID(cfg.OrbitDB.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	if cfg.Relay.SwarmKey != "" {
+		if key, err = p2p.LoadSwarmKey(cfg.Relay.SwarmKey); err != nil {
+			return nil, err
+		}
+		zap.L().Info("Joining the private network of the swarm key", zap.String("swarm_key", cfg.Relay.SwarmKey))
+	}
+	return p2p.NewRepo(cfg.P2P, key, priv)
+}
+
+// publishDatabases describes the IPFS node in the router's well-known document and, if
+// enabled, publishes the document under the node's IPNS name
+func publishDatabases(ctx context.Context, cfg config.PublishConfig, api coreiface.CoreAPI, r *router.Router) *p2p.NamePublisher {
+	var publisher *p2p.NamePublisher
+	if cfg.IPNS {
+		publisher = p2p.NewNamePublisher(api, func() ([]byte, error) {
+			return json.Marshal(r.WellKnown())
+		}, cfg.Interval)
+	}
+	r.SetNodeInfo(func() router.NodeInfo {
+		return nodeInfo(ctx, api, publisher.Name())
+	})
+	publisher.Start(ctx)
+	return publisher
+}
+
+// forwardEvents forwards the events posted to this node over pubsub if a forwarding topic is
+// configured, and saves the events forwarded by edge nodes on the serve topic. Returns a
+// function stopping both.
+func forwardEvents(ctx context.Context, cfg config.ForwardConfig, api coreiface.CoreAPI, r *router.Router) (func(), error) {
+	var forwarder *p2p.PubSubForwarder
+	if cfg.Topic != "" {
+		self, err := api.Key().Self(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the node identity: %w", err)
+		}
+		forwarder = p2p.NewPubSubForwarder(api.PubSub(), cfg.Topic, self.ID())
+		if err := forwarder.Start(ctx); err != nil {
+			return nil, err
+		}
+		r.SetUpstream(forwarder)
+		zap.L().Info("Forwarding events over pubsub", zap.String("topic", cfg.Topic))
+	} else if cfg.Upstream != "" {
+		zap.L().Info("Forwarding events", zap.String("upstream", cfg.Upstream))
+	}
+
+	var server *p2p.ForwardServer
+	if cfg.ServeTopic != "" {
+		server = p2p.NewForwardServer(api.PubSub(), cfg.ServeTopic, r.SaveForwarded)
+		if err := server.Start(ctx); err != nil {
+			forwarder.Stop()
+			return nil, err
+		}
+		zap.L().Info("Saving events forwarded over pubsub", zap.String("topic", cfg.ServeTopic))
+	}
+	return func() {
+		forwarder.Stop()
+		server.Stop()
+	}, nil
+}
+
+// nodeInfo describes the IPFS node, with the IPNS path its document is published under
+func nodeInfo(ctx context.Context, api coreiface.CoreAPI, ipns string) router.NodeInfo {
+	info := router.NodeInfo{Multiaddrs: []string{}, IPNS: ipns}
+	self, err := api.Key().Self(ctx)
+	if err != nil {
+		zap.L().Warn("Failed to get the node identity", zap.Error(err))
+		return info
+	}
+	info.PeerID = self.ID().String()
+
+	addrs, err := api.Swarm().LocalAddrs(ctx)
+	if err != nil {
+		zap.L().Warn("Failed to get the node addresses", zap.Error(err))
+		return info
+	}
+	for _, addr := range addrs {
+		info.Multiaddrs = append(info.Multiaddrs, addr.String()+"/p2p/"+info.PeerID)
+	}
+	return info
+}
+
+// swarmDialer connects through the IPFS node's swarm and checks connections on its host
+type swarmDialer struct {
+	api  coreiface.CoreAPI
+	host host.Host
+}
+
+// Connect connects to a peer
+func (d swarmDialer) Connect(ctx context.Context, info peer.AddrInfo) error {
+	return d.api.Swarm().Connect(ctx, info)
+}
+
+// Connected reports whether the host has a live connection to a peer
+func (d swarmDialer) Connected(id peer.ID) bool {
+	return d.host.Network().Connectedness(id) == network.Connected
+}
+
+// getOrCreatePeerID loads or creates the peer identity of the IPFS node, so it keeps its peer
+// ID across restarts
+func getOrCreatePeerID(settingsDir string) (crypto.PrivKey, peer.ID, error) {
+	keyFile := filepath.Join(settingsDir, "peer.key")
+
+	// Check if key file exists
+	if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+		// Generate new key
+		priv, pub, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate key pair: %w", err)
+		}
+
+		// Get peer ID from public key
+		pid, err := peer.IDFromPublicKey(pub)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get peer ID: %w", err)
+		}
+
+		// Serialize private key
+		keyBytes, err := crypto.MarshalPrivateKey(priv)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal private key: %w", err)
+		}
+
+		// Save to file
+		if err := ioutil.WriteFile(keyFile, keyBytes, 0600); err != nil {
+			return nil, "", fmt.Errorf("failed to save key: %w", err)
+		}
+
+		zap.L().Info("Generated new peer ID", zap.Stringer("peer", pid))
+		return priv, pid, nil
+	}
+
+	// Load existing key
+	keyBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	// Unmarshal private key
+	priv, err := crypto.UnmarshalPrivateKey(keyBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal private key: %w", err)
+	}
+
+	// Get peer ID from public key
+	pub := priv.GetPublic()
+	pid, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get peer ID: %w", err)
+	}
+
+	zap.L().Info("Loaded existing peer ID", zap.Stringer("peer", pid))
+	return priv, pid, nil
+}
+
+// eventPolicies builds the acceptance policy chain of the configuration, nil if no policy
+// is configured
+func eventPolicies(cfg config.PolicyConfig) *adapter.PolicyChain {
+	var policies []adapter.EventPolicy
+	if cfg.MaxEventSize > 0 {
+		policies = append(policies, &adapter.MaxSizePolicy{MaxBytes: cfg.MaxEventSize})
+	}
+	if cfg.MaxTags > 0 {
+		policies = append(policies, &adapter.MaxTagsPolicy{MaxTags: cfg.MaxTags})
+	}
+	if len(cfg.AllowedKinds) > 0 {
+		policies = append(policies, &adapter.KindsPolicy{Allowed: cfg.AllowedKinds})
+	}
+	if len(cfg.AllowedPubKeys) > 0 || len(cfg.DeniedPubKeys) > 0 {
+		policies = append(policies, &adapter.PubKeyPolicy{Allow: cfg.AllowedPubKeys, Deny: cfg.DeniedPubKeys})
+	}
+	if cfg.MinPoW > 0 {
+		policies = append(policies, &adapter.ProofOfWorkPolicy{MinDifficulty: cfg.MinPoW})
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+	return adapter.NewPolicyChain(policies...)
+}
@@ -0,0 +1,317 @@
+// Package crelay embeds a cRelay CRDT database node in another Go service. New opens the
+// storage stack the api-service binary runs, IPFS node, OrbitDB databases and the adapter
+// with its configured features, and the API router, without serving it:
+//
+//	node, err := crelay.New(ctx, crelay.WithConfig(cfg))
+//	if err != nil {
+//		return err
+//	}
+//	defer node.Close()
+//	http.Handle("/", node.Router().Handler())
+//
+// Logging and tracing use the global zap logger and OpenTelemetry provider of the host
+// service.
+package crelay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"berty.tech/go-orbit-db/iface"
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+	"go.uber.org/zap"
+
+	router "github.com/hetu-project/cRelay-crdt-db/internal/api"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	adapter "github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Config is the node configuration, the same as the api-service YAML file
+type Config = config.Config
+
+// Router is the HTTP API of a node
+type Router = router.Router
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() *Config {
+	return config.Default()
+}
+
+// LoadConfig loads a YAML configuration file on top of the defaults
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// ErrNoDatabase is returned by New when the configuration names no database to open
+var ErrNoDatabase = errors.New("no database configured: set orbitdb.address, orbitdb.stores or orbitdb.standalone")
+
+// Option configures a node created by New
+type Option func(*options)
+
+// options are the settings of New
+type options struct {
+	cfg        *Config
+	db         iface.DocumentStore
+	processors []processor
+	storeOnly  bool
+}
+
+// processor is an event processor registered with WithProcessor
+type processor struct {
+	kinds []int
+	fn    adapter.EventProcessor
+}
+
+// WithConfig sets the node configuration, validated by New. The default configuration is used otherwise.
+func WithConfig(cfg *Config) Option {
+	return func(o *options) {
+		o.cfg = cfg
+	}
+}
+
+// WithDocumentStore serves an already opened document store instead of opening the configured
+// databases, e.g. an in-memory store in tests. No IPFS node is started, so publishing, pubsub
+// forwarding and the peer check are off. The store is not closed by Close.
+func WithDocumentStore(db iface.DocumentStore) Option {
+	return func(o *options) {
+		o.db = db
+	}
+}
+
+// WithProcessor registers an event processor on the store, see OrbitDBAdapter.RegisterProcessor
+func WithProcessor(kinds []int, fn adapter.EventProcessor) Option {
+	return func(o *options) {
+		o.processors = append(o.processors, processor{kinds: kinds, fn: fn})
+	}
+}
+
+// WithStoreOnly opens the store without the router and its background workers, for
+// maintenance tasks such as backups. Router returns nil.
+func WithStoreOnly() Option {
+	return func(o *options) {
+		o.storeOnly = true
+	}
+}
+
+// Node is a running cRelay CRDT database node
+type Node struct {
+	cfg    *Config
+	db     iface.DocumentStore
+	store  *adapter.OrbitDBAdapter
+	router *router.Router // nil with WithStoreOnly
+
+	stop       []func() // Stops the publisher and forwarding, in order
+	closeStore func()
+	cancel     context.CancelFunc
+	closeOnce  sync.Once
+}
+
+// New opens the databases of the configuration and starts the node's background workers.
+// Workers run until Close is called or ctx is done. A standalone database is kept in the
+// orbitdb package state, so a process runs one standalone node at most.
+func New(ctx context.Context, opts ...Option) (*Node, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cfg := o.cfg
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if o.db == nil && !cfg.OrbitDB.Standalone && cfg.OrbitDB.Address == "" && !cfg.OrbitDB.Stores.Enabled() {
+		return nil, ErrNoDatabase
+	}
+
+	validateSubspaceID, err := adapter.NewSubspaceIDValidator(cfg.SubspaceIDs.Format, cfg.SubspaceIDs.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	adapter.SetSubspaceIDValidator(validateSubspaceID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	n := &Node{cfg: cfg, cancel: cancel}
+	if err := n.open(ctx, o); err != nil {
+		cancel()
+		return nil, err
+	}
+	return n, nil
+}
+
+// open opens the storage stack and, unless the node is store-only, the router
+func (n *Node) open(ctx context.Context, o options) error {
+	cfg := n.cfg
+	var (
+		counters iface.KeyValueStore
+		api      coreiface.CoreAPI
+		monitor  = adapter.NewReplicationMonitor()
+		err      error
+	)
+	switch {
+	case o.db != nil:
+		n.db, n.closeStore = o.db, func() {}
+	case cfg.OrbitDB.Standalone:
+		if err := os.MkdirAll(cfg.OrbitDB.Directory, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", cfg.OrbitDB.Directory, err)
+		}
+		n.db, api, n.closeStore, err = createStandaloneDB(cfg)
+	default:
+		if err := os.MkdirAll(cfg.OrbitDB.Directory, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", cfg.OrbitDB.Directory, err)
+		}
+		n.db, counters, api, n.closeStore, err = openExistingDB(ctx, cfg, monitor)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set up database: %w", err)
+	}
+	zap.L().Info("API database address", zap.Stringer("address", n.db.Address()))
+	if cfg.ReadOnly.Enabled {
+		if cfg.ReadOnly.Primary != "" {
+			zap.L().Info("Read-only follower, forwarding writes", zap.String("primary", cfg.ReadOnly.Primary))
+		} else {
+			zap.L().Info("Read-only follower, rejecting writes")
+		}
+	}
+
+	store := adapter.NewOrbitDBAdapter(n.db)
+	store.EnableReplicationMonitor(monitor)
+	if counters != nil {
+		store.EnableKeyValueCounters(counters)
+	}
+	for _, p := range o.processors {
+		store.RegisterProcessor(p.kinds, p.fn)
+	}
+	// Webhook secrets stay on this node, outside the replicated stores
+	if cfg.OrbitDB.Directory != "" {
+		if err := store.EnableWebhookSecretsFile(filepath.Join(cfg.OrbitDB.Directory, adapter.WebhookSecretsFile)); err != nil {
+			return fmt.Errorf("failed to load webhook secrets: %w", err)
+		}
+	}
+	n.store = store
+	if o.storeOnly {
+		return nil
+	}
+
+	fail := func(err error) error {
+		n.Close()
+		return err
+	}
+	// Old documents are upgraded before they are read
+	if cfg.Schema.MigrateOnStart && !cfg.ReadOnly.Enabled {
+		result, err := store.MigrateSchema(ctx)
+		if err != nil {
+			return fail(fmt.Errorf("failed to migrate documents: %w", err))
+		}
+		if len(result.Migrated) > 0 {
+			zap.L().Info("Migrated documents", zap.Any("migrated", result.Migrated))
+		}
+	}
+	if cfg.Warmup.Enabled {
+		store.EnableReadCache(cfg.Warmup.CacheTTL)
+	}
+	if cfg.UserStatsCache.Size > 0 {
+		if err := store.EnableUserStatsCache(ctx, cfg.UserStatsCache.Size); err != nil {
+			return fail(fmt.Errorf("failed to enable user statistics cache: %w", err))
+		}
+	}
+	store.EnableStaleEventCheck(cfg.Causality.StaleEvents)
+	store.SetQueryTimeout(cfg.API.QueryTimeout, cfg.API.PartialResults)
+	store.SetEventPolicies(eventPolicies(cfg.Policy))
+	store.SetModerators(cfg.Moderation.PubKeys)
+	if cfg.DerivedData.Async {
+		store.EnableAsyncDerivedData(adapter.DerivedDataOptions{
+			QueueSize:    cfg.DerivedData.QueueSize,
+			MaxRetries:   cfg.DerivedData.MaxRetries,
+			RetryBackoff: cfg.DerivedData.RetryBackoff,
+		})
+	}
+	var routerStore storage.Store = store
+	if cfg.ReadIndex.Enabled {
+		indexed, closeIndex, err := openReadIndex(ctx, cfg, store, n.db.EventBus())
+		if err != nil {
+			return fail(fmt.Errorf("failed to open event index: %w", err))
+		}
+		routerStore = indexed
+		closeDB := n.closeStore
+		n.closeStore = func() {
+			closeIndex()
+			closeDB()
+		}
+	}
+
+	n.router = router.NewRouter(routerStore, cfg)
+	n.router.Start(ctx)
+	if err := n.router.NotifyReplicated(ctx, n.db.EventBus()); err != nil {
+		return fail(fmt.Errorf("failed to watch replicated events for webhooks: %w", err))
+	}
+	if err := store.WatchReplicatedEvents(ctx, n.db.EventBus()); err != nil {
+		return fail(fmt.Errorf("failed to watch replicated events for processors: %w", err))
+	}
+	if api == nil {
+		return nil
+	}
+
+	publisher := publishDatabases(ctx, cfg.Publish, api, n.router)
+	n.stop = append(n.stop, publisher.Stop)
+	n.router.SetPeerCounter(func(ctx context.Context) (int, error) {
+		peers, err := api.Swarm().Peers(ctx)
+		return len(peers), err
+	})
+	stopForwarding, err := forwardEvents(ctx, cfg.Forward, api, n.router)
+	if err != nil {
+		return fail(fmt.Errorf("failed to set up event forwarding: %w", err))
+	}
+	n.stop = append(n.stop, stopForwarding)
+	return nil
+}
+
+// Store returns the node's store. Reads through it skip the event index, which only the
+// router uses.
+func (n *Node) Store() *adapter.OrbitDBAdapter {
+	return n.store
+}
+
+// Router returns the node's HTTP API, nil if the node was created with WithStoreOnly
+func (n *Node) Router() *Router {
+	return n.router
+}
+
+// Address returns the address of the node's database
+func (n *Node) Address() string {
+	return n.db.Address().String()
+}
+
+// Close stops publishing and forwarding, stops the router's background workers and flushes
+// the derived data queue within the configured API shutdown timeout, stops the derived data
+// worker, then closes the storage stack. Serving the router's handler
+// should be stopped first. Close is safe to call more than once.
+func (n *Node) Close() {
+	n.closeOnce.Do(func() {
+		for _, stop := range n.stop {
+			stop()
+		}
+		if n.router != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), n.cfg.API.ShutdownTimeout)
+			n.router.Stop(ctx)
+			cancel()
+		}
+		if n.store != nil {
+			// Queued derived data updates are applied before the worker stops
+			ctx, cancel := context.WithTimeout(context.Background(), n.cfg.API.ShutdownTimeout)
+			if err := n.store.FlushDerivedData(ctx); err != nil {
+				zap.L().Warn("Failed to flush derived data", zap.Error(err))
+			}
+			cancel()
+			n.store.CloseDerivedData()
+		}
+		n.closeStore()
+		n.cancel()
+	})
+}
@@ -0,0 +1,67 @@
+package crelay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Test that an embedded node runs its processors and serves the events of its store
+func TestNewWithDocumentStore(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.OrbitDB.Directory = t.TempDir()
+
+	var processed []string
+	node, err := New(ctx,
+		WithConfig(cfg),
+		WithDocumentStore(orbitdb.NewMemoryDocumentStore("embedded")),
+		WithProcessor([]int{1}, func(ctx context.Context, event *nostr.Event, source orbitdb.EventSource) error {
+			processed = append(processed, event.ID)
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+	defer node.Close()
+
+	key := nostr.GeneratePrivateKey()
+	note := &nostr.Event{CreatedAt: 1700000000, Kind: 1, Content: "hello"}
+	reaction := &nostr.Event{CreatedAt: 1700000100, Kind: 7, Content: "+"}
+	require.NoError(t, note.Sign(key))
+	require.NoError(t, reaction.Sign(key))
+	require.NoError(t, node.Store().SaveEvent(ctx, note))
+	require.NoError(t, node.Store().SaveEvent(ctx, reaction))
+	assert.Equal(t, []string{note.ID}, processed)
+
+	w := httptest.NewRecorder()
+	node.Router().Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/events/"+note.ID, nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var event nostr.Event
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&event))
+	assert.Equal(t, "hello", event.Content)
+
+	node.Close()
+	node.Close()
+}
+
+// Test that a store-only node has no router and a node without a database isn't created
+func TestNewOptions(t *testing.T) {
+	ctx := context.Background()
+
+	node, err := New(ctx, WithDocumentStore(orbitdb.NewMemoryDocumentStore("store-only")), WithStoreOnly())
+	require.NoError(t, err)
+	assert.NotNil(t, node.Store())
+	assert.Nil(t, node.Router())
+	node.Close()
+
+	_, err = New(ctx)
+	assert.ErrorIs(t, err, ErrNoDatabase)
+}
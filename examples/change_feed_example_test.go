@@ -0,0 +1,91 @@
+package examples_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/webhook"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Example_changeFeed subscribes to the change feed: every saved event is delivered as a
+// signed webhook, which the receiver verifies before trusting the payload.
+func Example_changeFeed() {
+	const secret = "example-secret"
+
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := webhook.Verify(secret, r.Header.Get(webhook.HeaderSignature), r.Header.Get(webhook.HeaderTimestamp),
+			body, webhook.DefaultTolerance, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var payload webhook.Payload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		received = append(received, payload.Type)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	dispatcher := webhook.NewDispatcher(config.WebhooksConfig{
+		Timeout:   5 * time.Second,
+		Endpoints: []config.WebhookEndpoint{{URL: receiver.URL, Secret: secret}},
+	})
+	store := webhook.NewNotifyingStore(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("feed")), dispatcher)
+
+	ctx := context.Background()
+	event := &nostr.Event{
+		CreatedAt: 1700000000,
+		Kind:      30100,
+		Tags: nostr.Tags{
+			{"sid", "0x00000000000000000000000000000000000000000000000000000000000000fe"},
+			{"subspace_name", "feed"},
+			{"ops", "post=30300"},
+		},
+	}
+	// Events must be signed by their authors
+	if err := event.Sign(nostr.GeneratePrivateKey()); err != nil {
+		fmt.Println("sign failed:", err)
+		return
+	}
+	if err := store.SaveEvent(ctx, event); err != nil {
+		fmt.Println("save failed:", err)
+		return
+	}
+
+	// Deliveries are asynchronous
+	dispatcher.Wait(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(received)
+	for _, payloadType := range received {
+		fmt.Println("received", payloadType)
+	}
+
+	// Output:
+	// received event.saved
+	// received subspace.created
+}
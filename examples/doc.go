@@ -0,0 +1,9 @@
+// Package examples contains runnable end-to-end examples of the cRelay CRDT database.
+//
+// Each example runs against an in-memory document store, so no IPFS node is needed:
+//
+//	go test -v ./examples/...
+//
+// The examples double as smoke tests of the public APIs: their printed output is
+// checked by go test.
+package examples
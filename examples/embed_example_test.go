@@ -0,0 +1,55 @@
+package examples_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Example_embedStore embeds the store as a library: save events, then read them back
+// by ID and by filter. Replace NewMemoryDocumentStore with an OrbitDB docstore to
+// persist and replicate the data.
+func Example_embedStore() {
+	ctx := context.Background()
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("example"))
+
+	// Events must be signed by their authors
+	alice, bob := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	events := []*nostr.Event{
+		{CreatedAt: 1700000000, Kind: 1, Content: "hello"},
+		{CreatedAt: 1700000100, Kind: 1, Content: "world"},
+		{CreatedAt: 1700000200, Kind: 7, Content: "+"},
+	}
+	for i, key := range []string{alice, bob, alice} {
+		if err := events[i].Sign(key); err != nil {
+			fmt.Println("sign failed:", err)
+			return
+		}
+	}
+	if err := store.SaveEvents(ctx, events); err != nil {
+		fmt.Println("save failed:", err)
+		return
+	}
+
+	event, err := store.GetEventByID(ctx, events[1].ID)
+	if err != nil {
+		fmt.Println("get failed:", err)
+		return
+	}
+	names := map[string]string{events[0].PubKey: "alice", events[1].PubKey: "bob"}
+	fmt.Printf("%s wrote %q\n", names[event.PubKey], event.Content)
+
+	count, err := store.CountEvents(ctx, nostr.Filter{Authors: []string{events[0].PubKey}})
+	if err != nil {
+		fmt.Println("count failed:", err)
+		return
+	}
+	fmt.Println("events by alice:", count)
+
+	// Output:
+	// bob wrote "world"
+	// events by alice: 2
+}
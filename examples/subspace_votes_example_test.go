@@ -0,0 +1,87 @@
+package examples_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Example_subspaceVotes creates a subspace declaring its operations, casts votes and
+// reads the tallies from the event index, the causality keys and the user statistics.
+func Example_subspaceVotes() {
+	ctx := context.Background()
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("votes"))
+
+	const sid = "0x00000000000000000000000000000000000000000000000000000000000000a1"
+
+	keys := make(map[string]string)
+	for _, user := range []string{"alice", "bob", "carol", "dave"} {
+		keys[user] = nostr.GeneratePrivateKey()
+	}
+
+	// The ops tag maps operation names to causality keys
+	events := []*nostr.Event{{
+		PubKey:    "alice",
+		CreatedAt: 1700000000,
+		Kind:      30100,
+		Tags:      nostr.Tags{{"sid", sid}, {"subspace_name", "dao"}, {"ops", "post=30300,vote=30302"}},
+	}}
+	for i, vote := range []struct{ voter, value string }{{"bob", "yes"}, {"carol", "yes"}, {"dave", "no"}} {
+		events = append(events, &nostr.Event{
+			PubKey:    vote.voter,
+			CreatedAt: nostr.Timestamp(1700000100 + i),
+			Kind:      30302,
+			Tags:      nostr.Tags{{"sid", sid}, {"op", "vote"}, {"vote", vote.value}},
+		})
+	}
+	// Events must be signed by their authors; signing replaces the user name with their key
+	for _, event := range events {
+		if err := event.Sign(keys[event.PubKey]); err != nil {
+			fmt.Println("sign failed:", err)
+			return
+		}
+	}
+	if err := store.SaveEvents(ctx, events); err != nil {
+		fmt.Println("save failed:", err)
+		return
+	}
+
+	// Tally from the event index
+	for _, value := range []string{"yes", "no"} {
+		count, err := store.CountEvents(ctx, nostr.Filter{
+			Kinds: []int{30302},
+			Tags:  nostr.TagMap{"sid": []string{sid}, "vote": []string{value}},
+		})
+		if err != nil {
+			fmt.Println("count failed:", err)
+			return
+		}
+		fmt.Printf("%s: %d\n", value, count)
+	}
+
+	// Every vote advances the vote causality key
+	counter, err := store.GetCausalityKey(ctx, sid, 30302)
+	if err != nil {
+		fmt.Println("causality failed:", err)
+		return
+	}
+	fmt.Println("vote key counter:", counter)
+
+	// Per-user tallies are kept in the user statistics
+	bob, _ := nostr.GetPublicKey(keys["bob"])
+	stats, err := store.GetUserStats(ctx, bob)
+	if err != nil || stats == nil || stats.VoteStats == nil {
+		fmt.Println("user stats missing:", err)
+		return
+	}
+	fmt.Printf("bob: %d yes, %d no\n", stats.VoteStats.YesVotes, stats.VoteStats.NoVotes)
+
+	// Output:
+	// yes: 2
+	// no: 1
+	// vote key counter: 3
+	// bob: 1 yes, 0 no
+}
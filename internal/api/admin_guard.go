@@ -0,0 +1,80 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// AdminGuard restricts the admin route group to requests with a configured API key or
+// signed with NIP-98 by an allowlisted public key. Without credentials it refuses every
+// request. A nil AdminGuard leaves the admin routes open.
+type AdminGuard struct {
+	apiKeys  []string
+	verifier *Authenticator // Verifies signed requests against the admin public keys
+}
+
+// NewAdminGuard creates the admin guard. auth supplies the URL and maximum age of signed
+// requests. Returns nil, which leaves the admin routes open, only if no credentials are
+// configured and cfg.Open is set.
+func NewAdminGuard(cfg config.AdminConfig, auth config.AuthConfig) *AdminGuard {
+	if !cfg.Enabled() && cfg.Open {
+		zap.L().Warn("Admin routes are open: no admin credentials are configured and admin.open is set")
+		return nil
+	}
+
+	guard := &AdminGuard{apiKeys: cfg.APIKeys}
+	if len(cfg.PubKeys) > 0 {
+		auth.PubKeys = cfg.PubKeys
+		guard.verifier = &Authenticator{cfg: auth, now: time.Now}
+	}
+	return guard
+}
+
+// allowed reports whether a request carries admin credentials
+func (g *AdminGuard) allowed(r *http.Request) bool {
+	if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+		for _, key := range g.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) == 1 {
+				return true
+			}
+		}
+	}
+	if g.verifier != nil && r.Header.Get("Authorization") != "" {
+		if _, err := g.verifier.VerifyRequest(r); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware rejects admin requests without credentials with 401 Unauthorized and those
+// with unknown credentials with 403 Forbidden. Every request gets 403 Forbidden when no
+// credentials are configured.
+func (g *AdminGuard) Middleware(next http.Handler) http.Handler {
+	if g == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(g.apiKeys) == 0 && g.verifier == nil {
+			handlers.Error(w, "Admin routes are disabled: configure admin.api_keys or admin.pubkeys", http.StatusForbidden)
+			return
+		}
+		if g.allowed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get(APIKeyHeader) == "" && r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", authScheme)
+			handlers.Error(w, "Admin credentials required", http.StatusUnauthorized)
+			return
+		}
+		handlers.Error(w, "Admin access denied", http.StatusForbidden)
+	})
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Test that admin routes, including event deletion, need an admin API key or public key
+func TestAdminGuard(t *testing.T) {
+	adminKey := nostr.GeneratePrivateKey()
+	adminPubKey, _ := nostr.GetPublicKey(adminKey)
+
+	cfg := config.Default()
+	cfg.OrbitDB.Directory = t.TempDir()
+	cfg.Admin.APIKeys = []string{"secret"}
+	cfg.Admin.PubKeys = []string{adminPubKey}
+	handler := NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("admin")), cfg).Handler()
+
+	request := func(method, path string, header func(*http.Request)) int {
+		req, err := http.NewRequest(method, "http://example.com"+path, nil)
+		require.NoError(t, err)
+		if header != nil {
+			header(req)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	apiKey := func(key string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set(APIKeyHeader, key) }
+	}
+	signedBy := func(key string) func(*http.Request) {
+		return func(req *http.Request) {
+			event := &nostr.Event{
+				Kind:      HTTPAuthKind,
+				CreatedAt: nostr.Now(),
+				Tags:      nostr.Tags{{"u", req.URL.String()}, {"method", req.Method}},
+			}
+			require.NoError(t, event.Sign(key))
+			data, _ := json.Marshal(event)
+			req.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString(data))
+		}
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/api/admin/usage", nil))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/api/admin/usage", apiKey("guess")))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/api/admin/usage", signedBy(nostr.GeneratePrivateKey())))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/admin/usage", apiKey("secret")))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/admin/usage", signedBy(adminKey)))
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodDelete, "/api/admin/events/missing", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodDelete, "/api/events/missing", apiKey("secret")),
+		"events are only deleted through the admin routes")
+
+	// Requests to versioned paths are checked against the URL the client signed
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api/v1/admin/usage", nil)
+	signedBy(adminKey)(req)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Other routes stay open
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/health", nil))
+
+	// The public keys allowed to authenticate route groups don't lock out the admins
+	cfg.Auth.Groups = map[string]string{"admin": config.AuthModeAuthenticated}
+	cfg.Auth.PubKeys = []string{"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"}
+	handler = NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("admin-allowlist")), cfg).Handler()
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/admin/usage", signedBy(adminKey)))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/api/admin/usage", signedBy(nostr.GeneratePrivateKey())))
+	cfg.Auth = config.Default().Auth
+
+	// Without credentials the admin routes are closed, unless explicitly left open
+	cfg.Admin.APIKeys, cfg.Admin.PubKeys = nil, nil
+	handler = NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("admin-closed")), cfg).Handler()
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/api/admin/usage", nil))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, "/api/admin/usage", apiKey("secret")))
+
+	cfg.Admin.Open = true
+	handler = NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("admin-open")), cfg).Handler()
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/admin/usage", nil))
+}
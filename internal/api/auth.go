@@ -0,0 +1,314 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// Nostr authentication event kinds
+const (
+	HTTPAuthKind  = 27235 // NIP-98 signed HTTP request
+	RelayAuthKind = 22242 // NIP-42 relay AUTH
+)
+
+// authScheme is the Authorization header scheme of NIP-98 requests
+const authScheme = "Nostr"
+
+// MaxAuthPayloadBytes is the largest request body hashed to check the payload tag of a
+// NIP-98 event
+const MaxAuthPayloadBytes = 4 << 20
+
+// readPostSuffixes are the POST endpoints that only read, left open in read-only mode
+var readPostSuffixes = []string{"/query", "/query/federated", "/count", "/simulate", "/graphql", "/users/stats"}
+
+// authPubKeyKey is the request context key of the authenticated public key
+type authPubKeyKey struct{}
+
+// AuthPubKey returns the public key a request was authenticated with, empty if it wasn't
+func AuthPubKey(ctx context.Context) string {
+	pubKey, _ := ctx.Value(authPubKeyKey{}).(string)
+	return pubKey
+}
+
+// Authenticator authenticates API requests signed with NIP-98 events. Each route group is
+// open, read-only (writes need authentication) or authenticated. Requests that carry an
+// Authorization header are verified even where authentication is optional, so handlers can
+// rely on AuthPubKey. A nil Authenticator leaves every route open.
+type Authenticator struct {
+	cfg     config.AuthConfig
+	now     func() time.Time
+	seen    seenAuthEvents      // NIP-98 events already accepted, refused if replayed
+	guarded map[*mux.Route]bool // Routes with their own guard, exempt from the allowed public keys
+}
+
+// seenAuthEvents remembers the IDs of accepted auth events until they are too old to be
+// accepted again
+type seenAuthEvents struct {
+	mu      sync.Mutex
+	expires map[string]time.Time // Expiry by event ID
+}
+
+// add records an event ID until expires. Returns false if it was already recorded.
+func (s *seenAuthEvents) add(id string, expires, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.expires == nil {
+		s.expires = make(map[string]time.Time)
+	}
+	for seen, at := range s.expires {
+		if !at.After(now) {
+			delete(s.expires, seen)
+		}
+	}
+	if _, replayed := s.expires[id]; replayed {
+		return false
+	}
+	s.expires[id] = expires
+	return true
+}
+
+// NewAuthenticator creates an authenticator. Returns nil, which leaves every route open,
+// if no route group needs authentication.
+func NewAuthenticator(cfg config.AuthConfig) *Authenticator {
+	open := cfg.DefaultMode == config.AuthModeOpen
+	for _, mode := range cfg.Groups {
+		open = open && mode == config.AuthModeOpen
+	}
+	if open {
+		return nil
+	}
+	return &Authenticator{cfg: cfg, now: time.Now, guarded: map[*mux.Route]bool{}}
+}
+
+// Guarded exempts a route from the public keys allowed to authenticate: its own guard, such
+// as the admin or subspace operator guard, decides who may use it. Signed requests to it
+// are still verified. Must be called before Middleware.
+func (a *Authenticator) Guarded(route *mux.Route) {
+	if a != nil {
+		a.guarded[route] = true
+	}
+}
+
+// routeGroup returns the route group of an API path, e.g. "events" for /api/events/query.
+// Returns an empty group for paths outside a group, such as the health checks.
+func routeGroup(path string) string {
+	rest, ok := strings.CutPrefix(path, "/api/")
+	if !ok {
+		return ""
+	}
+	group, _, _ := strings.Cut(rest, "/")
+	switch group {
+	case "health", "ready":
+		return ""
+	}
+	return group
+}
+
+// requiresAuth reports whether a request needs authentication in its route group
+func (a *Authenticator) requiresAuth(r *http.Request) bool {
+	group := routeGroup(r.URL.Path)
+	if group == "" {
+		return false
+	}
+
+	switch a.cfg.Mode(group) {
+	case config.AuthModeAuthenticated:
+		return true
+	case config.AuthModeReadOnly:
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return false
+		case http.MethodPost:
+			for _, suffix := range readPostSuffixes {
+				if strings.HasSuffix(r.URL.Path, suffix) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Middleware authenticates requests according to the mode of their route group. Requests
+// that fail authentication get 401 Unauthorized.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" && !a.requiresAuth(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		pubKey, err := a.verifyRequest(r)
+		if err == nil && !a.guarded[mux.CurrentRoute(r)] {
+			err = a.checkAuthor(pubKey)
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", authScheme)
+			handlers.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authPubKeyKey{}, pubKey)))
+	})
+}
+
+// VerifyRequest checks the NIP-98 event in the Authorization header of a request and
+// returns its public key. The event must be signed, recent, and name the request's URL and
+// method; if it has a payload tag, the tag must be the SHA-256 hash of the request body, of
+// at most MaxAuthPayloadBytes. Each event is accepted once: replaying it while it is recent
+// fails. Only the allowed public keys, if any, may authenticate.
+func (a *Authenticator) VerifyRequest(r *http.Request) (string, error) {
+	pubKey, err := a.verifyRequest(r)
+	if err != nil {
+		return "", err
+	}
+	return pubKey, a.checkAuthor(pubKey)
+}
+
+// verifyRequest is VerifyRequest without the allowed public keys
+func (a *Authenticator) verifyRequest(r *http.Request) (string, error) {
+	scheme, encoded, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if scheme != authScheme || encoded == "" {
+		return "", fmt.Errorf("missing %s authorization", authScheme)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", fmt.Errorf("authorization is not base64: %w", err)
+	}
+	var event nostr.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", fmt.Errorf("authorization is not a nostr event: %w", err)
+	}
+
+	if err := a.checkEvent(&event, HTTPAuthKind); err != nil {
+		return "", err
+	}
+	if u := tagValue(&event, "u"); u != a.requestURL(r) {
+		return "", fmt.Errorf("auth event is for URL %q", u)
+	}
+	if method := tagValue(&event, "method"); !strings.EqualFold(method, r.Method) {
+		return "", fmt.Errorf("auth event is for method %q", method)
+	}
+
+	if payload := tagValue(&event, "payload"); payload != "" {
+		body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, MaxAuthPayloadBytes))
+		if err != nil {
+			return "", fmt.Errorf("failed to read request body: %w", err)
+		}
+		// Handlers read the body again
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		if !strings.EqualFold(payload, hex.EncodeToString(sum[:])) {
+			return "", fmt.Errorf("auth event payload doesn't match the request body")
+		}
+	}
+
+	if !a.seen.add(event.ID, event.CreatedAt.Time().Add(a.cfg.MaxAge), a.now()) {
+		return "", fmt.Errorf("auth event was already used")
+	}
+	return event.PubKey, nil
+}
+
+// VerifyRelayAuth checks a NIP-42 AUTH event answering challenge on the relay at relayURL
+// and returns its public key. It is the WebSocket counterpart of VerifyRequest.
+func (a *Authenticator) VerifyRelayAuth(event *nostr.Event, challenge, relayURL string) (string, error) {
+	if err := a.checkEvent(event, RelayAuthKind); err != nil {
+		return "", err
+	}
+	if err := a.checkAuthor(event.PubKey); err != nil {
+		return "", err
+	}
+	if tagValue(event, "challenge") != challenge {
+		return "", fmt.Errorf("auth event answers another challenge")
+	}
+	if relay := tagValue(event, "relay"); strings.TrimRight(relay, "/") != strings.TrimRight(relayURL, "/") {
+		return "", fmt.Errorf("auth event is for relay %q", relay)
+	}
+	return event.PubKey, nil
+}
+
+// checkEvent checks the kind, signature and age of an auth event
+func (a *Authenticator) checkEvent(event *nostr.Event, kind int) error {
+	if event.Kind != kind {
+		return fmt.Errorf("auth event must be of kind %d", kind)
+	}
+	if ok, err := event.CheckSignature(); err != nil || !ok || event.GetID() != event.ID {
+		return fmt.Errorf("auth event has a bad signature")
+	}
+
+	age := a.now().Sub(event.CreatedAt.Time())
+	if age > a.cfg.MaxAge || age < -a.cfg.MaxAge {
+		return fmt.Errorf("auth event is expired")
+	}
+	return nil
+}
+
+// checkAuthor checks that a public key may authenticate, any may if none are configured
+func (a *Authenticator) checkAuthor(pubKey string) error {
+	if len(a.cfg.PubKeys) == 0 {
+		return nil
+	}
+	for _, allowed := range a.cfg.PubKeys {
+		if allowed == pubKey {
+			return nil
+		}
+	}
+	return fmt.Errorf("public key %s may not authenticate", pubKey)
+}
+
+// requestURL returns the absolute URL of a request as clients sign it
+func (a *Authenticator) requestURL(r *http.Request) string {
+	if a.cfg.URL != "" {
+		return strings.TrimRight(a.cfg.URL, "/") + sentRequestURI(r)
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + sentRequestURI(r)
+}
+
+// sentRequestURI returns the path and query of a request as the client sent them. r.URL
+// has the API version stripped from /api/v<n> paths by the time routes see it.
+func sentRequestURI(r *http.Request) string {
+	if r.RequestURI != "" {
+		if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+			return u.RequestURI()
+		}
+	}
+	return r.URL.RequestURI()
+}
+
+// tagValue returns the value of the first tag with a name, empty if there is none
+func tagValue(event *nostr.Event, name string) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == name {
+			return tag[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// Test that route groups require NIP-98 signed requests according to their mode
+func TestAuthenticatorModes(t *testing.T) {
+	cfg := config.Default().Auth
+	assert.Nil(t, NewAuthenticator(cfg), "open routes need no authenticator")
+
+	cfg.Groups = map[string]string{"events": config.AuthModeReadOnly, "admin": config.AuthModeAuthenticated}
+	auth := NewAuthenticator(cfg)
+	require.NotNil(t, auth)
+
+	var authenticated string
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticated = AuthPubKey(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	key := nostr.GeneratePrivateKey()
+	pubKey, _ := nostr.GetPublicKey(key)
+	sign := func(req *http.Request, url, body string) {
+		tags := nostr.Tags{{"u", url}, {"method", req.Method}}
+		if body != "" {
+			sum := sha256.Sum256([]byte(body))
+			tags = append(tags, nostr.Tag{"payload", hex.EncodeToString(sum[:])})
+		}
+		event := &nostr.Event{Kind: HTTPAuthKind, CreatedAt: nostr.Now(), Tags: tags}
+		require.NoError(t, event.Sign(key))
+		data, _ := json.Marshal(event)
+		req.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString(data))
+	}
+	serve := func(req *http.Request) int {
+		authenticated = ""
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Reads of read-only groups and open groups need no authentication
+	assert.Equal(t, http.StatusOK, serve(httptest.NewRequest(http.MethodGet, "/api/events/abc", nil)))
+	assert.Equal(t, http.StatusOK, serve(httptest.NewRequest(http.MethodPost, "/api/events/query", nil)))
+	assert.Equal(t, http.StatusOK, serve(httptest.NewRequest(http.MethodGet, "/api/users/top", nil)))
+	assert.Equal(t, http.StatusOK, serve(httptest.NewRequest(http.MethodGet, "/api/health", nil)))
+
+	// Writes of read-only groups and everything in authenticated groups do
+	assert.Equal(t, http.StatusUnauthorized, serve(httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader("{}"))))
+	assert.Equal(t, http.StatusUnauthorized, serve(httptest.NewRequest(http.MethodGet, "/api/admin/usage", nil)))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader("{}"))
+	sign(req, "http://example.com/api/events", "{}")
+	assert.Equal(t, http.StatusOK, serve(req))
+	assert.Equal(t, pubKey, authenticated)
+
+	// A signed request can't be replayed
+	replay := httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader("{}"))
+	replay.Header.Set("Authorization", req.Header.Get("Authorization"))
+	assert.Equal(t, http.StatusUnauthorized, serve(replay))
+
+	// Bodies larger than hashed for payload tags are refused
+	large := strings.Repeat(" ", MaxAuthPayloadBytes+1)
+	req = httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(large))
+	sign(req, "http://example.com/api/events", large)
+	assert.Equal(t, http.StatusUnauthorized, serve(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/usage", nil)
+	sign(req, "http://example.com/api/admin/usage", "")
+	assert.Equal(t, http.StatusOK, serve(req))
+
+	// Events signed for another URL, method or body are refused
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/derived", nil)
+	sign(req, "http://example.com/api/admin/usage", "")
+	assert.Equal(t, http.StatusUnauthorized, serve(req))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(`{"kind":1}`))
+	sign(req, "http://example.com/api/events", "{}")
+	assert.Equal(t, http.StatusUnauthorized, serve(req))
+
+	// Only listed public keys may authenticate when there are any
+	cfg.PubKeys = []string{strings.Repeat("0", 64)}
+	handler = NewAuthenticator(cfg).Middleware(handler)
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/usage", nil)
+	sign(req, "http://example.com/api/admin/usage", "")
+	assert.Equal(t, http.StatusUnauthorized, serve(req))
+}
+
+// Test that NIP-42 AUTH events must answer the challenge of the relay
+func TestVerifyRelayAuth(t *testing.T) {
+	cfg := config.Default().Auth
+	cfg.DefaultMode = config.AuthModeAuthenticated
+	auth := NewAuthenticator(cfg)
+
+	key := nostr.GeneratePrivateKey()
+	pubKey, _ := nostr.GetPublicKey(key)
+	event := &nostr.Event{
+		Kind:      RelayAuthKind,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"relay", "wss://relay.example.com/"}, {"challenge", "c1"}},
+	}
+	require.NoError(t, event.Sign(key))
+
+	got, err := auth.VerifyRelayAuth(event, "c1", "wss://relay.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, pubKey, got)
+
+	_, err = auth.VerifyRelayAuth(event, "c2", "wss://relay.example.com")
+	assert.Error(t, err)
+}
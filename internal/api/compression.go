@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// Content codings the compressor negotiates, preferred first on equal quality
+var compressionEncodings = []string{"zstd", "gzip"}
+
+// Compressor compresses responses with the content coding the client prefers among zstd
+// and gzip. Responses smaller than the configured threshold are sent as is, so small
+// answers don't pay the encoding overhead. A nil Compressor compresses nothing.
+type Compressor struct {
+	minSize int
+	gzip    sync.Pool
+	zstd    sync.Pool
+}
+
+// NewCompressor creates a response compressor. Returns nil, which compresses nothing, if
+// compression is disabled.
+func NewCompressor(cfg config.CompressionConfig) *Compressor {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	c := &Compressor{minSize: cfg.MinSize}
+	c.gzip.New = func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}
+	c.zstd.New = func() interface{} {
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return encoder
+	}
+	return c
+}
+
+// negotiate returns the content coding of the Accept-Encoding header with the highest
+// quality, empty if the client accepts none of the supported codings
+func negotiate(acceptEncoding string) string {
+	best, bestQuality := "", 0.0
+	for _, encoding := range compressionEncodings {
+		quality, explicit := 0.0, false
+		for _, accepted := range strings.Split(acceptEncoding, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(accepted), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != encoding && name != "*" {
+				continue
+			}
+			q := 1.0
+			if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+			// An explicit coding overrides the wildcard
+			if name == encoding {
+				quality, explicit = q, true
+			} else if !explicit {
+				quality = q
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// Middleware compresses the responses of clients accepting zstd or gzip
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, compressor: c, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter buffers the start of a response until it is known whether it reaches the
+// compression threshold, then writes it compressed or as is
+type compressWriter struct {
+	http.ResponseWriter
+	compressor *Compressor
+	encoding   string
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	encoder io.WriteCloser // nil when the response is sent as is
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.decided {
+		return w.write(data)
+	}
+
+	w.buf.Write(data)
+	if w.buf.Len() >= w.compressor.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// write writes to the encoder, or to the client if the response isn't compressed
+func (w *compressWriter) write(data []byte) (int, error) {
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// decide sends the header, compressed if compress is set and the response can be
+// compressed, and then the buffered start of the body
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	header := w.Header()
+	// Bodyless and already encoded responses are left alone
+	if compress && w.status >= http.StatusOK && w.status != http.StatusNoContent &&
+		w.status != http.StatusNotModified && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		w.encoder = w.compressor.encoder(w.encoding, w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// FlushError sends the response so far. Flushed responses are streamed, so they are
+// compressed whatever their size.
+func (w *compressWriter) FlushError() error {
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Flush implements http.Flusher for handlers flushing without a ResponseController
+func (w *compressWriter) Flush() {
+	w.FlushError()
+}
+
+// Unwrap returns the wrapped writer, so handlers can control the connection
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close sends responses below the threshold as is and finishes compressed ones
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.status == 0 {
+			// Nothing was written, let the server send its default response
+			return nil
+		}
+		return w.decide(false)
+	}
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	w.compressor.release(w.encoding, w.encoder)
+	w.encoder = nil
+	return err
+}
+
+// encoder returns a pooled encoder writing to dst
+func (c *Compressor) encoder(encoding string, dst io.Writer) io.WriteCloser {
+	if encoding == "zstd" {
+		encoder := c.zstd.Get().(*zstd.Encoder)
+		encoder.Reset(dst)
+		return encoder
+	}
+	encoder := c.gzip.Get().(*gzip.Writer)
+	encoder.Reset(dst)
+	return encoder
+}
+
+// release returns a closed encoder to its pool
+func (c *Compressor) release(encoding string, encoder io.WriteCloser) {
+	if encoding == "zstd" {
+		c.zstd.Put(encoder)
+		return
+	}
+	c.gzip.Put(encoder)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "", negotiate(""))
+	assert.Equal(t, "", negotiate("br, identity"))
+	assert.Equal(t, "gzip", negotiate("gzip, deflate, br"))
+	assert.Equal(t, "zstd", negotiate("gzip, zstd"), "zstd is preferred on equal quality")
+	assert.Equal(t, "gzip", negotiate("zstd;q=0.5, gzip"))
+	assert.Equal(t, "zstd", negotiate("*"))
+	assert.Equal(t, "gzip", negotiate("*, zstd;q=0"), "an explicit coding overrides the wildcard")
+	assert.Equal(t, "gzip", negotiate("zstd;q=0, *"))
+}
+
+// Test that large responses are compressed with the negotiated coding and small ones aren't
+func TestCompressorMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"kind":30300,"content":"hello"},`, 100)
+	handler := NewCompressor(config.CompressionConfig{Enabled: true, MinSize: 1024}).Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/small" {
+				w.Write([]byte("[]"))
+				return
+			}
+			w.Write([]byte(large))
+		}))
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/large", "gzip")
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Less(t, w.Body.Len(), len(large)/5)
+	reader, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, large, string(body))
+
+	w = get("/large", "zstd, gzip")
+	require.Equal(t, "zstd", w.Header().Get("Content-Encoding"))
+	decoder, err := zstd.NewReader(w.Body)
+	require.NoError(t, err)
+	defer decoder.Close()
+	body, err = io.ReadAll(decoder)
+	require.NoError(t, err)
+	assert.Equal(t, large, string(body))
+
+	w = get("/small", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "[]", w.Body.String())
+
+	w = get("/large", "")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, large, w.Body.String())
+}
+
+// Test that bodyless responses keep their status and aren't encoded
+func TestCompressorNotModified(t *testing.T) {
+	handler := NewCompressor(config.CompressionConfig{Enabled: true}).Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotModified)
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/top", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Zero(t, w.Body.Len())
+}
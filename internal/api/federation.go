@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// localNode names this node in federated query results
+const localNode = "local"
+
+// Federation fans event queries out to the APIs of peer nodes and merges the results with
+// the local ones, so clients can query the network through any node while local
+// replication is incomplete. A nil Federation has no peers and answers from this node only.
+type Federation struct {
+	peers   []string
+	timeout time.Duration
+	apiKey  string
+	client  *http.Client
+}
+
+// FederatedNodeResult describes the answer of one node to a federated query
+type FederatedNodeResult struct {
+	Node       string `json:"node"`            // Peer API base URL, or "local" for this node
+	Events     int    `json:"events"`          // Events the node returned
+	DurationMs int64  `json:"duration_ms"`     // Time the node took to answer
+	Error      string `json:"error,omitempty"` // Why the node's results are missing
+}
+
+// FederatedQueryResponse is the body of federated query responses
+type FederatedQueryResponse struct {
+	Events  []*nostr.Event         `json:"events"`  // Merged events, newest first, without duplicates
+	Partial bool                   `json:"partial"` // Whether some node failed or timed out
+	Nodes   []*FederatedNodeResult `json:"nodes"`   // Per-node results, this node first
+}
+
+// NewFederation creates a federation of the configured peers. Returns nil, which queries
+// this node only, if no peers are configured.
+func NewFederation(cfg config.FederationConfig) *Federation {
+	if len(cfg.Peers) == 0 {
+		return nil
+	}
+
+	peers := make([]string, 0, len(cfg.Peers))
+	for _, peer := range cfg.Peers {
+		peers = append(peers, strings.TrimSuffix(peer, "/"))
+	}
+	return &Federation{
+		peers:   peers,
+		timeout: cfg.Timeout,
+		apiKey:  cfg.APIKey,
+		client:  &http.Client{},
+	}
+}
+
+// Query wraps the local event query handler into a federated query handler. The filter is
+// run locally and on every peer's /api/events/query endpoint, each peer bounded by the
+// federation timeout; results are merged by event ID and cut to the query limit.
+// Peers answer from their own store only, so queries don't fan out further.
+func (f *Federation) Query(local http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			handlers.Error(w, "Invalid filter format", http.StatusBadRequest)
+			return
+		}
+		var filter struct {
+			Limit int `json:"limit"`
+		}
+		if err := json.Unmarshal(body, &filter); err != nil {
+			handlers.Error(w, "Invalid filter format", http.StatusBadRequest)
+			return
+		}
+
+		// Same limit rules as the local query endpoint
+		limit := 100
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+			limit = l
+		}
+		if filter.Limit > 0 && filter.Limit < limit {
+			limit = filter.Limit
+		}
+		query := "?limit=" + strconv.Itoa(limit)
+
+		var peers []string
+		if f != nil {
+			peers = f.peers
+		}
+		results := make([]*FederatedNodeResult, len(peers)+1)
+		events := make([][]*nostr.Event, len(peers)+1)
+
+		var wg sync.WaitGroup
+		for i, peer := range peers {
+			wg.Add(1)
+			go func(i int, peer string) {
+				defer wg.Done()
+				results[i+1], events[i+1] = f.queryPeer(r.Context(), peer, query, body)
+			}(i, peer)
+		}
+		results[0], events[0] = queryLocal(local, r, query, body)
+		wg.Wait()
+
+		if results[0].Error != "" && len(peers) == 0 {
+			handlers.Error(w, "Failed to query events", http.StatusInternalServerError)
+			return
+		}
+
+		response := &FederatedQueryResponse{
+			Events: mergeEvents(events, limit),
+			Nodes:  results,
+		}
+		for _, result := range results {
+			if result.Error != "" {
+				response.Partial = true
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// queryLocal runs the filter through the local query handler
+func queryLocal(local http.HandlerFunc, r *http.Request, query string, body []byte) (*FederatedNodeResult, []*nostr.Event) {
+	start := time.Now()
+	result := &FederatedNodeResult{Node: localNode}
+
+	req := r.Clone(r.Context())
+	req.URL.RawQuery = strings.TrimPrefix(query, "?")
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.Header.Set("Accept", "application/json") // Results are merged from JSON arrays
+	recorder := &responseRecorder{header: make(http.Header)}
+	local(recorder, req)
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	events, err := decodeEvents(recorder.status, recorder.body.Bytes())
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Events = len(events)
+	return result, events
+}
+
+// queryPeer runs the filter on a peer node within the federation timeout
+func (f *Federation) queryPeer(ctx context.Context, peer, query string, body []byte) (*FederatedNodeResult, []*nostr.Event) {
+	start := time.Now()
+	result := &FederatedNodeResult{Node: peer}
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	events, err := f.fetchPeer(ctx, peer, query, body)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Events = len(events)
+	return result, events
+}
+
+// fetchPeer sends the query to a peer and decodes its events
+func (f *Federation) fetchPeer(ctx context.Context, peer, query string, body []byte) ([]*nostr.Event, error) {
+	// The unversioned path, which peers predating /api/v1 serve too
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+"/api/events/query"+query, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.apiKey != "" {
+		req.Header.Set(APIKeyHeader, f.apiKey)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("timed out after %s", f.timeout)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeEvents(resp.StatusCode, data)
+}
+
+// Helper function: decode the events of a query response
+func decodeEvents(status int, data []byte) ([]*nostr.Event, error) {
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", status, strings.TrimSpace(string(data)))
+	}
+	var events []*nostr.Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return events, nil
+}
+
+// mergeEvents merges the events of all nodes without duplicates, newest first, keeping at most limit
+func mergeEvents(results [][]*nostr.Event, limit int) []*nostr.Event {
+	seen := make(map[string]bool)
+	merged := []*nostr.Event{}
+	for _, events := range results {
+		for _, event := range events {
+			if event == nil || seen[event.ID] {
+				continue
+			}
+			seen[event.ID] = true
+			merged = append(merged, event)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].CreatedAt != merged[j].CreatedAt {
+			return merged[i].CreatedAt > merged[j].CreatedAt
+		}
+		return merged[i].ID < merged[j].ID
+	})
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// Test that federated queries merge peer results and flag peers that time out
+func TestFederatedQuery(t *testing.T) {
+	respond := func(events ...*nostr.Event) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(events)
+		}
+	}
+	event := func(id string, createdAt nostr.Timestamp) *nostr.Event {
+		return &nostr.Event{ID: id, CreatedAt: createdAt, Kind: 1}
+	}
+
+	peer := httptest.NewServer(respond(event("shared", 300), event("peer-only", 200)))
+	defer peer.Close()
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	cfg := config.Default().Federation
+	cfg.Peers = []string{peer.URL + "/", slow.URL}
+	cfg.Timeout = 100 * time.Millisecond
+	handler := NewFederation(cfg).Query(respond(event("local-only", 400), event("shared", 300), event("old", 100)))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/api/events/query/federated", strings.NewReader(`{"kinds":[1],"limit":3}`)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response FederatedQueryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	var ids []string
+	for _, event := range response.Events {
+		ids = append(ids, event.ID)
+	}
+	assert.Equal(t, []string{"local-only", "shared", "peer-only"}, ids)
+
+	assert.True(t, response.Partial)
+	require.Len(t, response.Nodes, 3)
+	assert.Equal(t, localNode, response.Nodes[0].Node)
+	assert.Equal(t, 3, response.Nodes[0].Events)
+	assert.Equal(t, peer.URL, response.Nodes[1].Node)
+	assert.Equal(t, 2, response.Nodes[1].Events)
+	assert.Empty(t, response.Nodes[1].Error)
+	assert.Contains(t, response.Nodes[2].Error, "timed out")
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// maxForwardedResponse bounds the upstream response body relayed to the client
+const maxForwardedResponse = 1 << 20
+
+// Upstream saves events on the authority node an edge node forwards them to
+type Upstream interface {
+	// Forward saves the JSON encoded event upstream and returns the upstream HTTP status and
+	// response body
+	Forward(ctx context.Context, event []byte) (int, []byte, error)
+}
+
+// HTTPUpstream forwards events to the event API of the authority node
+type HTTPUpstream struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewHTTPUpstream creates an upstream posting events to the configured authority node
+func NewHTTPUpstream(cfg config.ForwardConfig) *HTTPUpstream {
+	return &HTTPUpstream{
+		// The unversioned path, which authority nodes predating /api/v1 serve too
+		url:    strings.TrimSuffix(cfg.Upstream, "/") + "/api/events",
+		apiKey: cfg.APIKey,
+		client: &http.Client{},
+	}
+}
+
+// Forward posts the event to the authority node
+func (u *HTTPUpstream) Forward(ctx context.Context, event []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url, bytes.NewReader(event))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if u.apiKey != "" {
+		req.Header.Set(APIKeyHeader, u.apiKey)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxForwardedResponse))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read upstream response: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// Forwarder accepts events on an edge node without write permission: events are validated
+// against the replicated data and forwarded to the upstream, whose answer is returned.
+// A nil Forwarder is never used, the event API saves events locally instead.
+type Forwarder struct {
+	store    storage.Store
+	upstream Upstream
+	timeout  time.Duration
+}
+
+// NewForwarder creates a forwarder of events to upstream, which has timeout to answer
+func NewForwarder(store storage.Store, upstream Upstream, timeout time.Duration) *Forwarder {
+	return &Forwarder{store: store, upstream: upstream, timeout: timeout}
+}
+
+// SaveEvent handles event creation requests by forwarding valid events upstream
+func (f *Forwarder) SaveEvent(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		handlers.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var event nostr.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		handlers.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := f.store.ValidateEvent(r.Context(), &event); err != nil {
+		switch {
+		case errors.Is(err, orbitdb.ErrDuplicateVote):
+			handlers.WriteError(w, http.StatusConflict, handlers.CodeDuplicateVote, "User has already voted on this proposal")
+		case errors.Is(err, orbitdb.ErrEventRejected):
+			handlers.WriteError(w, http.StatusForbidden, handlers.CodeEventRejected, err.Error())
+		case errors.Is(err, orbitdb.ErrWriteForbidden):
+			handlers.WriteError(w, http.StatusForbidden, handlers.CodeWriteForbidden, "Author may not write to this subspace")
+		default:
+			handlers.Error(w, "Failed to validate event", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), f.timeout)
+	defer cancel()
+	status, body, err := f.upstream.Forward(ctx, data)
+	if err != nil {
+		zap.L().Warn("Failed to forward event", zap.String("event", event.ID), zap.Error(err))
+		handlers.Error(w, "Upstream node unavailable", http.StatusBadGateway)
+		return
+	}
+
+	// Upstream bodies are JSON, plain text from nodes predating JSON errors
+	if json.Valid(body) {
+		w.Header().Set("Content-Type", "application/json")
+	} else if len(body) > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// SetUpstream forwards the events posted to this node to upstream instead of saving them,
+// replacing the configured HTTP upstream. Must be called before Handler.
+func (r *Router) SetUpstream(upstream Upstream) {
+	r.forward = NewForwarder(r.store, upstream, r.cfg.Forward.Timeout)
+}
+
+// SaveForwarded saves an event forwarded by an edge node as if it was posted to the event
+// API, with the same policies and write limits, and returns the HTTP status and response body.
+// Forwarded events skip the request authentication, they must be signed by their author instead.
+func (r *Router) SaveForwarded(ctx context.Context, event []byte) (int, []byte) {
+	var signed nostr.Event
+	if err := json.Unmarshal(event, &signed); err != nil {
+		return forwardError(http.StatusBadRequest, handlers.CodeBadRequest, "Invalid request body")
+	}
+	if ok, err := signed.CheckSignature(); err != nil || !ok || signed.GetID() != signed.ID {
+		return forwardError(http.StatusForbidden, handlers.CodeInvalidEvent, "Invalid event id or signature")
+	}
+
+	save := r.live.Guard(r.writes.Limit(handlers.NewEventHandlers(r.store).SaveEvent))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/api/events", bytes.NewReader(event))
+	if err != nil {
+		return forwardError(http.StatusBadRequest, handlers.CodeBadRequest, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp := &bufferedResponse{header: http.Header{}}
+	save(resp, req)
+	return resp.status(), resp.body.Bytes()
+}
+
+// forwardError returns the status and error response body of a rejected forwarded event
+func forwardError(status int, code, message string) (int, []byte) {
+	body, _ := json.Marshal(handlers.ErrorResponse{Error: handlers.ErrorDetail{Code: code, Message: message}})
+	return status, body
+}
+
+// bufferedResponse keeps a response in memory
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(data []byte) (int, error) { return b.body.Write(data) }
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.code == 0 {
+		b.code = code
+	}
+}
+
+// status returns the response status, 200 if none was written
+func (b *bufferedResponse) status() int {
+	if b.code == 0 {
+		return http.StatusOK
+	}
+	return b.code
+}
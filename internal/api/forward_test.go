@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+func signedEvent(t *testing.T) []byte {
+	event := nostr.Event{Kind: 1, Content: "forwarded", CreatedAt: nostr.Now(), Tags: nostr.Tags{}}
+	require.NoError(t, event.Sign(nostr.GeneratePrivateKey()))
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	return data
+}
+
+func TestForwarderForwardsValidEvents(t *testing.T) {
+	var received []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/events", r.URL.Path)
+		assert.Equal(t, "edge-key", r.Header.Get(APIKeyHeader))
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer upstream.Close()
+
+	cfg := config.Default()
+	cfg.Forward.Upstream = upstream.URL
+	cfg.Forward.APIKey = "edge-key"
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("edge"))
+	handler := NewRouter(store, cfg).Handler()
+
+	event := signedEvent(t)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(string(event))))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, string(event), string(received))
+
+	// The event was forwarded, not saved locally
+	var saved nostr.Event
+	require.NoError(t, json.Unmarshal(event, &saved))
+	local, err := store.GetEventByID(context.Background(), saved.ID)
+	require.NoError(t, err)
+	assert.Nil(t, local)
+
+	// Unsigned events are refused without reaching the upstream
+	received = nil
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(`{"id":"abc","kind":1}`)))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Nil(t, received)
+}
+
+// fakeUpstream answers every event with the same response
+type fakeUpstream struct {
+	status int
+	body   string
+	err    error
+}
+
+func (u *fakeUpstream) Forward(ctx context.Context, event []byte) (int, []byte, error) {
+	return u.status, []byte(u.body), u.err
+}
+
+func TestForwarderReturnsUpstreamResult(t *testing.T) {
+	cfg := config.Default()
+	cfg.ReadOnly.Enabled = true
+	router := NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("edge")), cfg)
+	router.SetUpstream(&fakeUpstream{status: http.StatusConflict, body: `{"quarantined":false}`})
+	handler := router.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(string(signedEvent(t)))))
+	assert.Equal(t, http.StatusConflict, rec.Code, "read-only edge nodes still forward events")
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"quarantined":false}`, rec.Body.String())
+}
+
+func TestSaveForwarded(t *testing.T) {
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("authority"))
+	router := NewRouter(store, nil)
+
+	status, _ := router.SaveForwarded(context.Background(), signedEvent(t))
+	assert.Equal(t, http.StatusCreated, status)
+
+	status, _ = router.SaveForwarded(context.Background(), []byte("not json"))
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = router.SaveForwarded(context.Background(), []byte(`{"id":"abc","kind":1}`))
+	assert.Equal(t, http.StatusForbidden, status, "forwarded events must be signed")
+}
+
+func TestForwarderTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client going away once the body was read
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	cfg := config.Default()
+	cfg.Forward.Upstream = upstream.URL
+	cfg.Forward.Timeout = 50 * time.Millisecond
+	handler := NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("edge")), cfg).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(string(signedEvent(t)))))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
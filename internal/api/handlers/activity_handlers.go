@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// ActivityHandlers handles activity histogram requests
+type ActivityHandlers struct {
+	store storage.Store
+}
+
+// NewActivityHandlers creates a new ActivityHandlers
+func NewActivityHandlers(store storage.Store) *ActivityHandlers {
+	return &ActivityHandlers{store: store}
+}
+
+// GetUserActivity handles requests for the activity histogram of a user
+func (h *ActivityHandlers) GetUserActivity(w http.ResponseWriter, r *http.Request) {
+	h.serveHistogram(w, r, orbitdb.ActivityScopeUser, mux.Vars(r)["id"])
+}
+
+// GetSubspaceActivity handles requests for the activity histogram of a subspace
+func (h *ActivityHandlers) GetSubspaceActivity(w http.ResponseWriter, r *http.Request) {
+	h.serveHistogram(w, r, orbitdb.ActivityScopeSubspace, mux.Vars(r)["id"])
+}
+
+// serveHistogram serves event counts over time. granularity is hour or day (default day);
+// from and to are Unix timestamps bounding the range, to defaulting to now and from to 30
+// days (day) or 24 hours (hour) before it. Ranges are limited to 366 days of daily or 31
+// days of hourly buckets.
+func (h *ActivityHandlers) serveHistogram(w http.ResponseWriter, r *http.Request, scope, owner string) {
+	query := r.URL.Query()
+
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = orbitdb.GranularityDay
+	}
+	maxRange, defaultRange := orbitdb.MaxDailyActivityRange, 30*24*time.Hour
+	switch granularity {
+	case orbitdb.GranularityDay:
+	case orbitdb.GranularityHour:
+		maxRange, defaultRange = orbitdb.MaxHourlyActivityRange, 24*time.Hour
+	default:
+		Error(w, "Invalid granularity, expected hour or day", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now()
+	if toStr := query.Get("to"); toStr != "" {
+		t, err := strconv.ParseInt(toStr, 10, 64)
+		if err != nil {
+			Error(w, "Invalid to, expected a Unix timestamp", http.StatusBadRequest)
+			return
+		}
+		to = time.Unix(t, 0)
+	}
+	from := to.Add(-defaultRange)
+	if fromStr := query.Get("from"); fromStr != "" {
+		f, err := strconv.ParseInt(fromStr, 10, 64)
+		if err != nil {
+			Error(w, "Invalid from, expected a Unix timestamp", http.StatusBadRequest)
+			return
+		}
+		from = time.Unix(f, 0)
+	}
+	if to.Before(from) {
+		Error(w, "from must not be after to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > maxRange {
+		Error(w, fmt.Sprintf("Range too long, at most %d days of %s buckets", int(maxRange/(24*time.Hour)), granularity), http.StatusBadRequest)
+		return
+	}
+
+	points, err := h.store.GetActivityHistogram(r.Context(), scope, owner, granularity, from, to)
+	if err != nil {
+		StoreError(w, err, "Failed to get activity")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"scope":       scope,
+		"id":          owner,
+		"granularity": granularity,
+		"from":        from.Unix(),
+		"to":          to.Unix(),
+		"buckets":     points,
+	})
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// AdminHandlers handles administrative API requests
+type AdminHandlers struct {
+	store   storage.Store
+	dataDir string // OrbitDB data directory, used to measure disk usage
+}
+
+// NewAdminHandlers creates a new AdminHandlers
+func NewAdminHandlers(store storage.Store, dataDir string) *AdminHandlers {
+	return &AdminHandlers{
+		store:   store,
+		dataDir: dataDir,
+	}
+}
+
+// GetUsage handles per-API-key usage requests
+func (h *AdminHandlers) GetUsage(w http.ResponseWriter, r *http.Request) {
+	// Get query parameters, days are formatted as YYYY-MM-DD
+	query := r.URL.Query()
+	from := query.Get("from")
+	to := query.Get("to")
+	keyID := query.Get("key_id")
+
+	usage, err := h.store.QueryUsage(r.Context(), from, to, keyID)
+	if err != nil {
+		StoreError(w, err, "Failed to query usage")
+		return
+	}
+
+	// Return JSON data
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// GetMigrationStatus handles requests for the status of the running database migration
+func (h *AdminHandlers) GetMigrationStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.store.GetMigrationStatus(r.Context())
+	if err != nil {
+		writeMigrationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// StartMigrationBackfill handles requests to start copying history into the new database
+func (h *AdminHandlers) StartMigrationBackfill(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.StartMigrationBackfill(r.Context()); err != nil {
+		writeMigrationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// FlipMigration handles requests to switch reads to the new database
+func (h *AdminHandlers) FlipMigration(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.FlipMigration(r.Context()); err != nil {
+		writeMigrationError(w, err)
+		return
+	}
+
+	status, err := h.store.GetMigrationStatus(r.Context())
+	if err != nil {
+		writeMigrationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// Helper function: map migration errors to HTTP status codes
+func writeMigrationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, orbitdb.ErrNoMigration) {
+		WriteError(w, http.StatusNotFound, CodeNoMigration, "No migration in progress")
+		return
+	}
+	Error(w, fmt.Sprintf("Migration error: %v", err), http.StatusConflict)
+}
+
+// GetStorageForecast handles storage compaction report and forecasting requests
+func (h *AdminHandlers) GetStorageForecast(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := orbitdb.StorageForecastOptions{
+		WindowDays:   orbitdb.DefaultForecastWindowDays,
+		MaxSubspaces: 50,
+	}
+
+	if windowStr := query.Get("window_days"); windowStr != "" {
+		window, err := strconv.Atoi(windowStr)
+		if err != nil || window <= 0 {
+			Error(w, "Invalid window_days", http.StatusBadRequest)
+			return
+		}
+		opts.WindowDays = window
+	}
+
+	// Comma-separated list of horizons in days, e.g. horizons=30,90,365
+	if horizonsStr := query.Get("horizons"); horizonsStr != "" {
+		for _, item := range strings.Split(horizonsStr, ",") {
+			days, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil || days <= 0 {
+				Error(w, "Invalid horizons", http.StatusBadRequest)
+				return
+			}
+			opts.HorizonDays = append(opts.HorizonDays, days)
+		}
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit >= 0 {
+			opts.MaxSubspaces = limit
+		}
+	}
+
+	if h.dataDir != "" {
+		opts.DiskBytes = DirectorySize(h.dataDir)
+	}
+
+	forecast, err := h.store.ForecastStorage(r.Context(), opts)
+	if err != nil {
+		StoreError(w, err, "Failed to forecast storage")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(forecast)
+}
+
+// DirectorySize sums the size of all files below a directory, 0 if it cannot be read
+func DirectorySize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// Backup handles requests to export the full docstore as a JSONL archive
+func (h *AdminHandlers) Backup(w http.ResponseWriter, r *http.Request) {
+	filename := fmt.Sprintf("crelay-backup-%s.jsonl", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	count, err := h.store.Backup(r.Context(), w)
+	if err != nil {
+		// The response has already started, the archive header tells clients how many documents to expect
+		zap.L().Error("Backup failed", zap.Int("documents", count), zap.Error(err))
+		return
+	}
+	zap.L().Info("Backup exported", zap.Int("documents", count))
+}
+
+// Restore handles requests to import a JSONL archive into the docstore
+func (h *AdminHandlers) Restore(w http.ResponseWriter, r *http.Request) {
+	count, err := h.store.Restore(r.Context(), r.Body)
+	if err != nil {
+		Error(w, fmt.Sprintf("Failed to restore backup after %d documents: %v", count, err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"restored": count})
+}
+
+// MaxBackfillRelays is the maximum number of relays a backfill request may pull from
+const MaxBackfillRelays = 20
+
+// BackfillRequest is the body of relay backfill requests
+type BackfillRequest struct {
+	Relays  []string      `json:"relays"`  // ws:// or wss:// URLs of the relays to pull from
+	Filters nostr.Filters `json:"filters"` // Filters selecting the events, every event if empty
+}
+
+// BackfillFromRelays handles requests to pull historical events from external Nostr relays,
+// bootstrapping the node from the existing relay network. The report lists the outcome per
+// relay; relays failing don't fail the request.
+func (h *AdminHandlers) BackfillFromRelays(w http.ResponseWriter, r *http.Request) {
+	var request BackfillRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if len(request.Relays) == 0 {
+		Error(w, "At least one relay is required", http.StatusBadRequest)
+		return
+	}
+	if len(request.Relays) > MaxBackfillRelays {
+		Error(w, fmt.Sprintf("At most %d relays can be backfilled from at once", MaxBackfillRelays), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.store.BackfillFromRelays(r.Context(), request.Relays, request.Filters)
+	if errors.Is(err, orbitdb.ErrInvalidRelay) {
+		Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		StoreError(w, err, fmt.Sprintf("Failed to backfill from relays: %v", err))
+		return
+	}
+	zap.L().Info("Backfilled from relays", zap.Int("relays", len(report.Relays)), zap.Int("saved", report.Saved),
+		zap.Int("failed_relays", report.Failed()))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// RebuildDerivedData regenerates user statistics and causality documents from the stored events
+func (h *AdminHandlers) RebuildDerivedData(w http.ResponseWriter, r *http.Request) {
+	result, err := h.store.RebuildDerivedData(r.Context())
+	if err != nil {
+		StoreError(w, err, "Failed to rebuild derived data")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Compact handles requests to snapshot the stores, so they load on startup without replaying
+// their oplog
+func (h *AdminHandlers) Compact(w http.ResponseWriter, r *http.Request) {
+	result, err := h.store.Compact(r.Context())
+	if err != nil {
+		StoreError(w, err, fmt.Sprintf("Failed to snapshot stores: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetReplicationStatus handles requests for the replication progress of the stores
+func (h *AdminHandlers) GetReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.ReplicationStatus())
+}
+
+// GetDerivedDataStats handles requests for the state of the derived data update pipeline
+func (h *AdminHandlers) GetDerivedDataStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.DerivedDataStats())
+}
+
+// GetEventPolicies handles requests for the acceptance policies events are checked against
+func (h *AdminHandlers) GetEventPolicies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.EventPolicies())
+}
+
+// ListQuarantinedEvents handles requests for the causally stale events held in quarantine
+func (h *AdminHandlers) ListQuarantinedEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := h.store.ListQuarantinedEvents(r.Context())
+	if err != nil {
+		StoreError(w, err, "Failed to list quarantined events")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// DeleteQuarantinedEvent handles requests to discard a quarantined event
+func (h *AdminHandlers) DeleteQuarantinedEvent(w http.ResponseWriter, r *http.Request) {
+	eventID := mux.Vars(r)["id"]
+
+	deleted, err := h.store.DeleteQuarantinedEvent(r.Context(), eventID)
+	if err != nil {
+		StoreError(w, err, "Failed to delete quarantined event")
+		return
+	}
+	if !deleted {
+		Error(w, "Quarantined event not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
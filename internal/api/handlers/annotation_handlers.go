@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// IncludeAnnotations is the include query parameter value adding annotations to returned events
+const IncludeAnnotations = "annotations"
+
+// signerKey is the context key of the public key a request was signed by
+type signerKey struct{}
+
+// WithSigner returns a context carrying the public key a request was authenticated as
+func WithSigner(ctx context.Context, pubKey string) context.Context {
+	return context.WithValue(ctx, signerKey{}, pubKey)
+}
+
+// Signer returns the public key a request was signed by, empty if it wasn't checked
+func Signer(ctx context.Context) string {
+	pubKey, _ := ctx.Value(signerKey{}).(string)
+	return pubKey
+}
+
+// AnnotationHandlers handles event annotation requests
+type AnnotationHandlers struct {
+	store storage.Store
+}
+
+// NewAnnotationHandlers creates a new AnnotationHandlers
+func NewAnnotationHandlers(store storage.Store) *AnnotationHandlers {
+	return &AnnotationHandlers{store: store}
+}
+
+// GetEventAnnotations handles requests to list the annotations of an event
+func (h *AnnotationHandlers) GetEventAnnotations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID := vars["id"]
+
+	annotations, err := h.store.GetEventAnnotations(r.Context(), eventID)
+	if err != nil {
+		StoreError(w, err, "Failed to get event annotations")
+		return
+	}
+	if annotations == nil {
+		annotations = []*orbitdb.EventAnnotation{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"event_id":    eventID,
+		"annotations": annotations,
+	})
+}
+
+// AnnotationRequest is the body of a request to annotate an event
+type AnnotationRequest struct {
+	Type   string `json:"type"`   // Annotation type
+	Value  string `json:"value"`  // Label, badge name or error message
+	Source string `json:"source"` // Moderator or service adding the annotation
+}
+
+// AddEventAnnotation handles requests to annotate an event
+func (h *AnnotationHandlers) AddEventAnnotation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID := vars["id"]
+
+	var requestData AnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if !orbitdb.IsAnnotationType(requestData.Type) {
+		Error(w, fmt.Sprintf("Unsupported type %q, expected one of %v", requestData.Type, orbitdb.AnnotationTypes), http.StatusBadRequest)
+		return
+	}
+	if requestData.Value == "" {
+		Error(w, "value must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	event, err := h.store.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		StoreError(w, err, "Failed to query event")
+		return
+	}
+	if event == nil {
+		WriteError(w, http.StatusNotFound, CodeEventNotFound, "Event not found")
+		return
+	}
+
+	annotation := &orbitdb.EventAnnotation{
+		Type:   requestData.Type,
+		Value:  requestData.Value,
+		Source: requestData.Source,
+		Author: Signer(r.Context()),
+	}
+	if err := h.store.AddEventAnnotation(r.Context(), eventID, annotation); err != nil {
+		StoreError(w, err, "Failed to add event annotation")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(annotation)
+}
+
+// DeleteEventAnnotation handles requests to remove an annotation of an event. Only its
+// author may remove it, or an operator of the event's subspace, who also removes the
+// annotations added before their authors were recorded.
+func (h *AnnotationHandlers) DeleteEventAnnotation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID := vars["id"]
+	annotationID := vars["annotation"]
+
+	annotations, err := h.store.GetEventAnnotations(r.Context(), eventID)
+	if err != nil {
+		StoreError(w, err, "Failed to get event annotations")
+		return
+	}
+	var annotation *orbitdb.EventAnnotation
+	for _, candidate := range annotations {
+		if candidate.ID == annotationID {
+			annotation = candidate
+		}
+	}
+	if annotation == nil {
+		Error(w, "Annotation not found", http.StatusNotFound)
+		return
+	}
+
+	signer := Signer(r.Context())
+	if annotation.Author == "" || annotation.Author != signer {
+		operator, err := h.isEventOperator(r.Context(), eventID, signer)
+		if err != nil {
+			StoreError(w, err, "Failed to check the subspace operators")
+			return
+		}
+		if !operator {
+			Error(w, "Only the author of an annotation and the operators of the event's subspace may delete it", http.StatusForbidden)
+			return
+		}
+	}
+
+	deleted, err := h.store.DeleteEventAnnotation(r.Context(), eventID, annotationID)
+	if err != nil {
+		StoreError(w, err, "Failed to delete event annotation")
+		return
+	}
+	if !deleted {
+		Error(w, "Annotation not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isEventOperator reports whether pubKey is the creator or a moderator of the subspace of an event
+func (h *AnnotationHandlers) isEventOperator(ctx context.Context, eventID, pubKey string) (bool, error) {
+	event, err := h.store.GetEventByID(ctx, eventID)
+	if err != nil || event == nil {
+		return false, err
+	}
+	tag := event.Tags.GetFirst([]string{"sid", ""})
+	if tag == nil {
+		return false, nil
+	}
+
+	meta, err := h.store.GetSubspaceMeta(ctx, tag.Value())
+	if err != nil || meta == nil {
+		return false, err
+	}
+	if pubKey == meta.Creator {
+		return true, nil
+	}
+	for _, moderator := range meta.Moderators {
+		if pubKey == moderator {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AnnotatedEvent is an event with its annotations. The event fields are copied rather than
+// embedded because nostr.Event's own JSON marshaling would drop the annotations.
+type AnnotatedEvent struct {
+	ID          string                     `json:"id"`
+	PubKey      string                     `json:"pubkey"`
+	CreatedAt   nostr.Timestamp            `json:"created_at"`
+	Kind        int                        `json:"kind"`
+	Tags        nostr.Tags                 `json:"tags"`
+	Content     string                     `json:"content"`
+	Sig         string                     `json:"sig"`
+	Annotations []*orbitdb.EventAnnotation `json:"annotations"`
+}
+
+// Helper function: check whether the include query parameter lists a value
+func includes(r *http.Request, value string) bool {
+	for _, item := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if strings.TrimSpace(item) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function: attach the annotations of each event
+func annotateEvents(ctx context.Context, store storage.Store, events []*nostr.Event) ([]*AnnotatedEvent, error) {
+	annotated := make([]*AnnotatedEvent, 0, len(events))
+	for _, event := range events {
+		annotations, err := store.GetEventAnnotations(ctx, event.ID)
+		if err != nil {
+			return nil, err
+		}
+		if annotations == nil {
+			annotations = []*orbitdb.EventAnnotation{}
+		}
+
+		annotated = append(annotated, &AnnotatedEvent{
+			ID:          event.ID,
+			PubKey:      event.PubKey,
+			CreatedAt:   event.CreatedAt,
+			Kind:        event.Kind,
+			Tags:        event.Tags,
+			Content:     event.Content,
+			Sig:         event.Sig,
+			Annotations: annotations,
+		})
+	}
+	return annotated, nil
+}
+
+// Helper function: write events as JSON, with their annotations if the request includes them
+func writeEvents(w http.ResponseWriter, r *http.Request, store storage.Store, events []*nostr.Event) {
+	var response interface{} = events
+	if includes(r, IncludeAnnotations) {
+		annotated, err := annotateEvents(r.Context(), store, events)
+		if err != nil {
+			StoreError(w, err, "Failed to get event annotations")
+			return
+		}
+		response = annotated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
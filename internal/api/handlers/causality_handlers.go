@@ -3,12 +3,16 @@ package handlers
 import (
 	// "context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
 
 	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
 	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
@@ -26,7 +30,14 @@ func NewCausalityHandlers(store storage.Store) *CausalityHandlers {
 	}
 }
 
-// GetSubspaceCausality handles getting subspace causality requests
+// SubspaceResponse is the causality of a subspace with its metadata
+type SubspaceResponse struct {
+	*orbitdb.SubspaceCausality
+	Meta *orbitdb.SubspaceMeta `json:"meta,omitempty"` // Name, description, rules and ops from the create event
+}
+
+// GetSubspaceCausality handles getting subspace causality requests. The metadata parsed
+// from the subspace-create event is returned as meta.
 func (h *CausalityHandlers) GetSubspaceCausality(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	subspaceID := vars["id"]
@@ -34,18 +45,47 @@ func (h *CausalityHandlers) GetSubspaceCausality(w http.ResponseWriter, r *http.
 	// Get subspace causality
 	causality, err := h.store.GetSubspaceCausality(r.Context(), subspaceID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get subspace causality: %v", err), http.StatusInternalServerError)
+		StoreError(w, err, "Failed to get subspace causality")
 		return
 	}
 
 	if causality == nil {
-		http.Error(w, "Subspace does not exist", http.StatusNotFound)
+		Error(w, "Subspace does not exist", http.StatusNotFound)
+		return
+	}
+
+	meta, err := h.store.GetSubspaceMeta(r.Context(), subspaceID)
+	if err != nil {
+		StoreError(w, err, "Failed to get subspace metadata")
 		return
 	}
 
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(causality)
+	json.NewEncoder(w).Encode(SubspaceResponse{SubspaceCausality: causality, Meta: meta})
+}
+
+// GetSubspaceStats handles requests for the aggregate statistics of a subspace
+func (h *CausalityHandlers) GetSubspaceStats(w http.ResponseWriter, r *http.Request) {
+	subspaceID := mux.Vars(r)["id"]
+
+	stats, err := h.store.GetSubspaceStats(r.Context(), subspaceID)
+	if err != nil {
+		StoreError(w, err, "Failed to get subspace statistics")
+		return
+	}
+	if stats == nil {
+		Error(w, "Subspace statistics data does not exist", http.StatusNotFound)
+		return
+	}
+	if notModified(w, r, entityTag(stats.ID, stats.Updated, stats.TotalEvents)) {
+		return
+	}
+
+	// The distinct users are counted in unique_users; listing them is the users endpoint's job
+	stats.Users = nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
 }
 
 // GetCausalityKey handles getting specific causality key requests
@@ -54,17 +94,23 @@ func (h *CausalityHandlers) GetCausalityKey(w http.ResponseWriter, r *http.Reque
 	subspaceID := vars["id"]
 	keyIDStr := vars["key"]
 
+	// A wildcard key lists every key of the subspace
+	if keyIDStr == "*" {
+		h.ListCausalityKeys(w, r)
+		return
+	}
+
 	// Convert key ID to uint32
 	keyID, err := strconv.ParseUint(keyIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		Error(w, "Invalid key ID", http.StatusBadRequest)
 		return
 	}
 
 	// Get causality key counter value
 	counter, err := h.store.GetCausalityKey(r.Context(), subspaceID, uint32(keyID))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get causality key: %v", err), http.StatusInternalServerError)
+		StoreError(w, err, "Failed to get causality key")
 		return
 	}
 
@@ -77,65 +123,174 @@ func (h *CausalityHandlers) GetCausalityKey(w http.ResponseWriter, r *http.Reque
 	})
 }
 
-// GetSubspaceEvents handles getting subspace events requests
-func (h *CausalityHandlers) GetSubspaceEvents(w http.ResponseWriter, r *http.Request) {
+// ListCausalityKeys handles listing all causality keys of a subspace
+func (h *CausalityHandlers) ListCausalityKeys(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	subspaceID := vars["id"]
 
-	// Get subspace event ID list
-	eventIDs, err := h.store.GetCausalityEvents(r.Context(), subspaceID)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get subspace events: %v", err), http.StatusInternalServerError)
-		return
+	// Parse pagination parameters
+	query := r.URL.Query()
+	limit := 100 // Default limit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
 	}
 
-	if len(eventIDs) == 0 {
-		// Return empty array
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte("[]"))
+	offset := 0
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o > 0 {
+			offset = o
+		}
+	}
+
+	// Get all causality keys
+	keys, err := h.store.ListCausalityKeys(r.Context(), subspaceID)
+	if err != nil {
+		StoreError(w, err, "Failed to list causality keys")
 		return
 	}
 
-	// Create filter to query these events
-	filter := nostr.Filter{
-		IDs: eventIDs,
+	total := len(keys)
+	if offset > total {
+		offset = total
 	}
+	// Subtracting keeps huge limits from overflowing
+	end := offset + min(limit, total-offset)
+
+	// Return JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subspace_id": subspaceID,
+		"total":       total,
+		"offset":      offset,
+		"limit":       limit,
+		"keys":        keys[offset:end],
+	})
+}
+
+// GetSubspaceEvents handles getting subspace events requests. Events are returned in the order
+// they were recorded, a page at a time; the X-Next-Cursor header carries the cursor of the next page.
+// Requests accepting application/x-ndjson get the events streamed one per line.
+func (h *CausalityHandlers) GetSubspaceEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subspaceID := vars["id"]
+	query := r.URL.Query()
 
 	// Limit returned events
 	limit := 100 // Default limit
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+	if limitStr := query.Get("limit"); limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
 			limit = l
 		}
 	}
 
+	// Get a page of the subspace event ID list
+	eventIDs, nextCursor, err := h.store.GetCausalityEventsPage(r.Context(), subspaceID, query.Get("cursor"), limit)
+	if errors.Is(err, orbitdb.ErrInvalidCursor) {
+		WriteError(w, http.StatusBadRequest, CodeInvalidCursor, err.Error())
+		return
+	}
+	if err != nil {
+		StoreError(w, err, "Failed to get subspace events")
+		return
+	}
+	if nextCursor != "" {
+		w.Header().Set(NextCursorHeader, nextCursor)
+	}
+
+	if len(eventIDs) == 0 && !wantsNDJSON(r) {
+		// Return empty array
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+		return
+	}
+
+	// Stream events one at a time in the order they were recorded
+	if wantsNDJSON(r) {
+		stream := newEventStream(w, r, h.store)
+		defer stream.Flush()
+		for _, id := range eventIDs {
+			event, err := h.store.GetEventByID(r.Context(), id)
+			if err != nil {
+				zap.L().Warn("Failed to get streamed event", zap.String("event", id), zap.Error(err))
+				stream.Fail(err, "Failed to get subspace events")
+				return
+			}
+			if event == nil {
+				continue
+			}
+			if stream.Write(event) != nil {
+				return
+			}
+		}
+		return
+	}
+
 	// Query events
-	events := make([]*nostr.Event, 0)
-	eventChan, err := h.store.QueryEvents(r.Context(), filter)
+	eventChan, err := h.store.QueryEvents(r.Context(), nostr.Filter{IDs: eventIDs})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to query events: %v", err), http.StatusInternalServerError)
+		StoreError(w, err, "Failed to query events")
 		return
 	}
 
-	// Collect events
-	count := 0
+	// Collect events in the order they were recorded
+	found := make(map[string]*nostr.Event, len(eventIDs))
 	for event := range eventChan {
-		if count >= limit {
-			break
+		found[event.ID] = event
+	}
+	events := make([]*nostr.Event, 0, len(found))
+	for _, id := range eventIDs {
+		if event, ok := found[id]; ok {
+			events = append(events, event)
 		}
-		events = append(events, event)
-		count++
 	}
 
 	// Return JSON response
+	writeEvents(w, r, h.store, events)
+}
+
+// GetCausalityGraph handles requests for the event dependency graph of a subspace,
+// as JSON or, with format=dot, in Graphviz DOT format
+func (h *CausalityHandlers) GetCausalityGraph(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subspaceID := vars["id"]
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "dot" {
+		Error(w, "Invalid format, must be json or dot", http.StatusBadRequest)
+		return
+	}
+
+	graph, err := h.store.GetCausalityGraph(r.Context(), subspaceID)
+	if err != nil {
+		StoreError(w, err, "Failed to build causality graph")
+		return
+	}
+	if graph == nil {
+		Error(w, "Subspace not found", http.StatusNotFound)
+		return
+	}
+
+	if format == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		graph.WriteDOT(w)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(events)
+	json.NewEncoder(w).Encode(graph)
 }
 
-// ListSubspaces handles listing all subspaces requests
+// ListSubspaces handles listing all subspaces requests. With the name query parameter it
+// looks subspaces up by name instead and returns their metadata.
 func (h *CausalityHandlers) ListSubspaces(w http.ResponseWriter, r *http.Request) {
 	// Get query parameters
 	query := r.URL.Query()
+	if query.Has("name") {
+		h.findSubspacesByName(w, r, query.Get("name"))
+		return
+	}
 	sinceStr := query.Get("since")
 	untilStr := query.Get("until")
 
@@ -169,7 +324,19 @@ func (h *CausalityHandlers) ListSubspaces(w http.ResponseWriter, r *http.Request
 	// Query subspaces
 	subspaces, err := h.store.QuerySubspaces(r.Context(), filter)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to query subspaces: %v", err), http.StatusInternalServerError)
+		StoreError(w, err, "Failed to query subspaces")
+		return
+	}
+
+	// The store returns subspaces in no particular order, sort them so the entity tag is stable
+	sort.Slice(subspaces, func(i, j int) bool {
+		return subspaces[i].ID < subspaces[j].ID
+	})
+	parts := make([]interface{}, 0, 2*len(subspaces))
+	for _, subspace := range subspaces {
+		parts = append(parts, subspace.ID, subspace.Updated)
+	}
+	if notModified(w, r, entityTag(parts...)) {
 		return
 	}
 
@@ -178,6 +345,73 @@ func (h *CausalityHandlers) ListSubspaces(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(subspaces)
 }
 
+// ListTopSubspaces handles requests for the subspaces with the most recent activity. window
+// is the period counted, e.g. 24h (default 24h, at most 168h), sort_by ranks by events,
+// users or votes (default events) and limit caps the subspaces returned (default 10).
+func (h *CausalityHandlers) ListTopSubspaces(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	window := 24 * time.Hour
+	if windowStr := query.Get("window"); windowStr != "" {
+		d, err := time.ParseDuration(windowStr)
+		if err != nil || d <= 0 || d > orbitdb.SubspaceActivityRetention {
+			Error(w, fmt.Sprintf("Invalid window, expected a duration up to %s", orbitdb.SubspaceActivityRetention), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	sortBy := query.Get("sort_by")
+	if sortBy == "" {
+		sortBy = orbitdb.SubspaceActivityEvents
+	}
+	if !orbitdb.IsSubspaceActivityMetric(sortBy) {
+		Error(w, fmt.Sprintf("Invalid sort_by %q, must be events, users or votes", sortBy), http.StatusBadRequest)
+		return
+	}
+
+	limit := 10 // Default limit
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	rankings, err := h.store.TopSubspaces(r.Context(), window, sortBy, limit)
+	if err != nil {
+		StoreError(w, err, "Failed to rank subspaces")
+		return
+	}
+	if rankings == nil {
+		rankings = []*orbitdb.SubspaceRanking{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window":    window.String(),
+		"sort_by":   sortBy,
+		"subspaces": rankings,
+	})
+}
+
+// findSubspacesByName writes the metadata of the subspaces with a name
+func (h *CausalityHandlers) findSubspacesByName(w http.ResponseWriter, r *http.Request, name string) {
+	if name == "" {
+		Error(w, "Name must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	metas, err := h.store.FindSubspacesByName(r.Context(), name)
+	if err != nil {
+		StoreError(w, err, "Failed to find subspaces")
+		return
+	}
+	if metas == nil {
+		metas = []*orbitdb.SubspaceMeta{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metas)
+}
+
 // CreateSubspaceEvent handles creating a subspace event
 // func (h *CausalityHandlers) CreateSubspaceEvent(w http.ResponseWriter, r *http.Request) {
 // 	// Parse request body
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test paginating causality keys, including limits too large to add to the offset
+func TestListCausalityKeysPagination(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewCausalityHandlers(mockStore)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/subspaces/{id}/keys", handler.ListCausalityKeys)
+
+	keys := []*orbitdb.CausalityKey{{Key: 30300, Counter: 1}, {Key: 30301, Counter: 2}, {Key: 30302, Counter: 3}}
+	mockStore.On("ListCausalityKeys", mock.Anything, "0xabc").Return(keys, nil)
+	mockStore.On("ListCausalityKeys", mock.Anything, "0xdef").Return([]*orbitdb.CausalityKey(nil), fmt.Errorf("%w: 0xdef", orbitdb.ErrSubspaceNotFound))
+
+	for query, want := range map[string][]uint32{
+		"":                  {30300, 30301, 30302},
+		"?limit=1&offset=1": {30301},
+		"?offset=5":         {},
+		fmt.Sprintf("?limit=%d&offset=2", math.MaxInt): {30302},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/subspaces/0xabc/keys"+query, nil))
+		require.Equal(t, http.StatusOK, w.Code, query)
+
+		var response struct {
+			Keys []*orbitdb.CausalityKey `json:"keys"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), query)
+		got := []uint32{}
+		for _, key := range response.Keys {
+			got = append(got, key.Key)
+		}
+		assert.Equal(t, want, got, query)
+	}
+
+	// An unknown subspace is not found
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/subspaces/0xdef/keys", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// Test that store failures get the status of typed errors and don't leak other errors
+func TestGetCausalityKeyStoreError(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewCausalityHandlers(mockStore)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/subspaces/{id}/keys/{key}", handler.GetCausalityKey)
+
+	mockStore.On("GetCausalityKey", mock.Anything, "0xabc", uint32(30300)).Return(uint64(0), fmt.Errorf("%w: 0xabc", orbitdb.ErrSubspaceNotFound))
+	mockStore.On("GetCausalityKey", mock.Anything, "0xdef", uint32(30300)).Return(uint64(0), errors.New("disk full"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/subspaces/0xabc/keys/30300", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/subspaces/0xdef/keys/30300", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "disk full")
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Error codes of error responses. Codes are stable, clients branch on them; messages are
+// for humans and may change.
+const (
+	CodeBadRequest          = "bad_request"
+	CodeInvalidEvent        = "invalid_event"
+	CodeInvalidCursor       = "invalid_cursor"
+	CodeInvalidLiveConfig   = "invalid_live_config"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeEventRejected       = "event_rejected"
+	CodeWriteForbidden      = "write_forbidden"
+	CodeProofOfWork         = "proof_of_work_required"
+	CodeNotFound            = "not_found"
+	CodeEventNotFound       = "event_not_found"
+	CodeNoMigration         = "no_migration"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeUnsupportedVersion  = "unsupported_version"
+	CodeConflict            = "conflict"
+	CodeDuplicateVote       = "duplicate_vote"
+	CodeOutdatedLiveConfig  = "outdated_live_config"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeRateLimited         = "rate_limited"
+	CodeInternal            = "internal_error"
+	CodeNotImplemented      = "not_implemented"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeUnavailable         = "unavailable"
+	CodeWritesDisabled      = "writes_disabled"
+	CodeOverloaded          = "overloaded"
+	CodeTimeout             = "timeout"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an error
+type ErrorDetail struct {
+	Code    string `json:"code"`    // Machine-readable error code, one of the Code constants
+	Message string `json:"message"` // Human-readable description
+}
+
+// WriteError writes an error response with an explicit code
+func WriteError(w http.ResponseWriter, status int, code, message string) {
+	h := w.Header()
+	// Drop headers describing a body that is not sent, as http.Error does
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Del("ETag")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: ErrorDetail{Code: code, Message: message}})
+}
+
+// Error writes an error response with the generic code of the status, in place of http.Error
+func Error(w http.ResponseWriter, message string, status int) {
+	WriteError(w, status, StatusCode(status), message)
+}
+
+// StatusCode returns the generic error code of an HTTP status
+func StatusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusNotAcceptable:
+		return CodeUnsupportedVersion
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusNotImplemented:
+		return CodeNotImplemented
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return CodeUpstreamUnavailable
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// typedErrors maps the typed errors of the storage layer to their status and code
+var typedErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{storage.ErrEventNotFound, http.StatusNotFound, CodeEventNotFound},
+	{storage.ErrInvalidEventFormat, http.StatusBadRequest, CodeInvalidEvent},
+	{storage.ErrStorageNotStarted, http.StatusServiceUnavailable, CodeUnavailable},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, CodeTimeout},
+	{orbitdb.ErrDuplicateVote, http.StatusConflict, CodeDuplicateVote},
+	{orbitdb.ErrEventRejected, http.StatusForbidden, CodeEventRejected},
+	{orbitdb.ErrWriteForbidden, http.StatusForbidden, CodeWriteForbidden},
+	{orbitdb.ErrWriteNotAllowed, http.StatusForbidden, CodeWriteForbidden},
+	{orbitdb.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidCursor},
+	{orbitdb.ErrNoMigration, http.StatusNotFound, CodeNoMigration},
+	{orbitdb.ErrSubspaceNotFound, http.StatusNotFound, CodeNotFound},
+	{orbitdb.ErrSnapshotsUnsupported, http.StatusNotImplemented, CodeNotImplemented},
+	{orbitdb.ErrInvalidLiveConfig, http.StatusBadRequest, CodeInvalidLiveConfig},
+	{orbitdb.ErrOutdatedLiveConfig, http.StatusConflict, CodeOutdatedLiveConfig},
+}
+
+// ErrorStatus returns the status and code of a typed storage error, ok is false for other
+// errors
+func ErrorStatus(err error) (status int, code string, ok bool) {
+	for _, typed := range typedErrors {
+		if errors.Is(err, typed.err) {
+			return typed.status, typed.code, true
+		}
+	}
+	return 0, "", false
+}
+
+// StoreError writes the error response of a failed store call: typed errors get their own
+// status and code, other errors are internal errors described by message
+func StoreError(w http.ResponseWriter, err error, message string) {
+	if status, code, ok := ErrorStatus(err); ok {
+		WriteError(w, status, code, err.Error())
+		return
+	}
+	WriteError(w, http.StatusInternalServerError, CodeInternal, message)
+}
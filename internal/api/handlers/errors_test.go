@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Test that store errors are written as envelopes with the code of their typed error
+func TestStoreError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{storage.ErrEventNotFound, http.StatusNotFound, CodeEventNotFound},
+		{fmt.Errorf("saving: %w", orbitdb.ErrDuplicateVote), http.StatusConflict, CodeDuplicateVote},
+		{fmt.Errorf("%w: kind 1 not accepted", orbitdb.ErrEventRejected), http.StatusForbidden, CodeEventRejected},
+		{orbitdb.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidCursor},
+		{errors.New("disk full"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		StoreError(w, tc.err, "Failed to save event")
+		assert.Equal(t, tc.status, w.Code, tc.err.Error())
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, tc.code, resp.Error.Code, tc.err.Error())
+		assert.NotEmpty(t, resp.Error.Message)
+	}
+
+	// Untyped errors aren't exposed to clients
+	w := httptest.NewRecorder()
+	StoreError(w, errors.New("disk full"), "Failed to save event")
+	assert.JSONEq(t, `{"error":{"code":"internal_error","message":"Failed to save event"}}`, w.Body.String())
+}
+
+func TestErrorStatusCode(t *testing.T) {
+	w := httptest.NewRecorder()
+	Error(w, "Invalid request body", http.StatusBadRequest)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":{"code":"bad_request","message":"Invalid request body"}}`, w.Body.String())
+
+	assert.Equal(t, CodeNotFound, StatusCode(http.StatusNotFound))
+	assert.Equal(t, CodeUpstreamUnavailable, StatusCode(http.StatusBadGateway))
+	assert.Equal(t, CodeInternal, StatusCode(http.StatusInsufficientStorage))
+}
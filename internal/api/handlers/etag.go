@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETagMaxAge is how long, in seconds, clients may reuse a response with an entity tag
+// before revalidating it with If-None-Match
+const ETagMaxAge = 5
+
+// entityTag returns a weak entity tag of a response derived from the IDs and update times
+// of the documents it is built from, in response order. Weak, because two updates within
+// the same second share an update time.
+func entityTag(parts ...interface{}) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(hash, "%v\x00", part)
+	}
+	return `W/"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// MatchesETag reports whether an If-None-Match header value lists the entity tag, using
+// the weak comparison of RFC 9110
+func MatchesETag(ifNoneMatch, tag string) bool {
+	if ifNoneMatch == "" || tag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the entity tag and caching headers of a response and reports whether
+// the client's copy is current, in which case 304 Not Modified was written
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(ETagMaxAge))
+	if MatchesETag(r.Header.Get("If-None-Match"), tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
@@ -1,15 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	// "fmt"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/nbd-wtf/go-nostr"
 
 	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
 )
 
 // EventHandlers handles event-related API requests
@@ -22,60 +26,236 @@ func NewEventHandlers(store storage.Store) *EventHandlers {
 	return &EventHandlers{store: store}
 }
 
+// PartialResultsHeader is set to "true" on event queries and counts cut short by the query
+// timeout, whose results cover only the events scanned in time
+const PartialResultsHeader = "X-Partial-Results"
+
+// IncludeMutedParam is the query parameter that, set to true, keeps the events of authors
+// muted by the moderators in event queries and counts
+const IncludeMutedParam = "include_muted"
+
+// queryContext returns the context of an event query or count, which leaves out the events
+// moderated in their subspace, and those of muted authors unless the request sets
+// include_muted=true
+func queryContext(r *http.Request) context.Context {
+	ctx := orbitdb.WithSubspaceModeration(r.Context())
+	if r.URL.Query().Get(IncludeMutedParam) == "true" {
+		return ctx
+	}
+	return orbitdb.WithMuteFilter(ctx)
+}
+
 // SaveEvent handles event creation requests
 func (h *EventHandlers) SaveEvent(w http.ResponseWriter, r *http.Request) {
 	var event nostr.Event
 	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if err := h.store.SaveEvent(r.Context(), &event); err != nil {
-		http.Error(w, "Failed to save event", http.StatusInternalServerError)
+		// Causally stale events are refused with 409, or accepted into quarantine with 202
+		var stale *orbitdb.StaleEventError
+		if errors.As(err, &stale) {
+			status := http.StatusConflict
+			if stale.Quarantined {
+				status = http.StatusAccepted
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(stale)
+			return
+		}
+		if errors.Is(err, orbitdb.ErrDuplicateVote) {
+			WriteError(w, http.StatusConflict, CodeDuplicateVote, "User has already voted on this proposal")
+			return
+		}
+		if errors.Is(err, orbitdb.ErrEventRejected) {
+			WriteError(w, http.StatusForbidden, CodeEventRejected, err.Error())
+			return
+		}
+		if errors.Is(err, orbitdb.ErrWriteForbidden) {
+			WriteError(w, http.StatusForbidden, CodeWriteForbidden, "Author may not write to this subspace")
+			return
+		}
+		StoreError(w, err, "Failed to save event")
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
 }
 
-// GetEvent handles requests to get a single event
+// SimulateEvent handles requests to preview the derived data of an event without saving it
+func (h *EventHandlers) SimulateEvent(w http.ResponseWriter, r *http.Request) {
+	var event nostr.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.store.SimulateEvent(r.Context(), &event)
+	if err != nil {
+		StoreError(w, err, "Failed to simulate event")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetEvent handles requests to get a single event. Events left out of queries by the
+// moderation, such as hidden events, are not found.
 func (h *EventHandlers) GetEvent(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	eventID := vars["id"]
 
-	filter := nostr.Filter{
-		IDs: []string{eventID},
+	ctx := queryContext(r)
+	event, err := h.store.GetEventByID(ctx, eventID)
+	if err != nil {
+		StoreError(w, err, "Failed to query event")
+		return
+	}
+	if event != nil {
+		exclusion, err := h.store.QueryExclusion(ctx)
+		if err != nil {
+			StoreError(w, err, "Failed to query event")
+			return
+		}
+		if exclusion.Excludes(event) {
+			event = nil
+		}
+	}
+
+	if event == nil {
+		WriteError(w, http.StatusNotFound, CodeEventNotFound, "Event not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if includes(r, IncludeAnnotations) {
+		annotated, err := annotateEvents(ctx, h.store, []*nostr.Event{event})
+		if err != nil {
+			StoreError(w, err, "Failed to get event annotations")
+			return
+		}
+		json.NewEncoder(w).Encode(annotated[0])
+		return
+	}
+
+	json.NewEncoder(w).Encode(event)
+}
+
+// QueryEvents handles requests to query multiple events. Requests accepting
+// application/x-ndjson get the events streamed one per line instead of a JSON array.
+func (h *EventHandlers) QueryEvents(w http.ResponseWriter, r *http.Request) {
+	// Use generic map to parse request for more flexible filtering conditions
+	var queryParams map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&queryParams); err != nil {
+		Error(w, "Invalid filter format", http.StatusBadRequest)
+		return
+	}
+
+	// Build standard nostr filter
+	filter, err := ParseFilter(queryParams)
+	if err != nil {
+		Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := 100 // Default limit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+	if filter.Limit == 0 || filter.Limit > limit {
+		filter.Limit = limit
 	}
 
 	events := make([]*nostr.Event, 0)
-	eventChan, err := h.store.QueryEvents(r.Context(), filter)
+	ctx, scan := orbitdb.WithScanReport(queryContext(r))
+	eventChan, err := h.store.QueryEvents(ctx, filter)
 	if err != nil {
-		http.Error(w, "Failed to query event", http.StatusInternalServerError)
+		StoreError(w, err, "Failed to query events")
+		return
+	}
+
+	// Stream events off the channel instead of collecting them
+	if wantsNDJSON(r) {
+		if scan.Truncated() {
+			w.Header().Set(PartialResultsHeader, "true")
+		}
+		stream := newEventStream(w, r, h.store)
+		defer stream.Flush()
+		for count := 0; count < filter.Limit; count++ {
+			event, ok := <-eventChan
+			if !ok {
+				break
+			}
+			if stream.Write(event) != nil {
+				return
+			}
+		}
+		if err := scan.Err(); err != nil {
+			stream.Fail(err, "Failed to query events")
+		}
 		return
 	}
 
+	count := 0
 	for event := range eventChan {
+		if count >= filter.Limit {
+			break
+		}
 		events = append(events, event)
+		count++
 	}
-
-	if len(events) == 0 {
-		http.Error(w, "Event not found", http.StatusNotFound)
+	if err := scan.Err(); err != nil {
+		StoreError(w, err, "Failed to query events")
 		return
 	}
+	if scan.Truncated() {
+		w.Header().Set(PartialResultsHeader, "true")
+	}
 
-	json.NewEncoder(w).Encode(events[0])
+	writeEvents(w, r, h.store, events)
 }
 
-// QueryEvents handles requests to query multiple events
-func (h *EventHandlers) QueryEvents(w http.ResponseWriter, r *http.Request) {
-	// Use generic map to parse request for more flexible filtering conditions
+// CountEvents handles requests to count events matching a filter, in the style of NIP-45
+func (h *EventHandlers) CountEvents(w http.ResponseWriter, r *http.Request) {
+	// Accept the same filter format as QueryEvents
 	var queryParams map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&queryParams); err != nil {
-		http.Error(w, "Invalid filter format", http.StatusBadRequest)
+		Error(w, "Invalid filter format", http.StatusBadRequest)
 		return
 	}
 
-	// Build standard nostr filter
+	filter, err := ParseFilter(queryParams)
+	if err != nil {
+		Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Limit does not apply to counts
+	filter.Limit = 0
+
+	ctx, scan := orbitdb.WithScanReport(queryContext(r))
+	count, err := h.store.CountEvents(ctx, filter)
+	if err != nil {
+		StoreError(w, err, "Failed to count events")
+		return
+	}
+	if scan.Truncated() {
+		w.Header().Set(PartialResultsHeader, "true")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"count": count})
+}
+
+// ParseFilter builds a nostr filter from the JSON body of a query or count request. Tag
+// filters use the NIP-01 "#<tag>" keys, e.g. "#e" or "#t", each an array of strings; the
+// legacy "sid" and "parent" keys are accepted as well.
+func ParseFilter(queryParams map[string]interface{}) (nostr.Filter, error) {
 	filter := nostr.Filter{}
 
 	// Handle standard filter fields
@@ -142,34 +322,72 @@ func (h *EventHandlers) QueryEvents(w http.ResponseWriter, r *http.Request) {
 		filter.Tags["parent"] = parentValues
 	}
 
-	limit := 100 // Default limit
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
+	// Handle generic tag filters
+	for key, value := range queryParams {
+		if len(key) < 2 || key[0] != '#' {
+			continue
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			return filter, errors.New("Invalid tag filter " + key + ", expected an array of strings")
+		}
+		tagName := key[1:]
+		for _, v := range values {
+			valueStr, ok := v.(string)
+			if !ok {
+				return filter, errors.New("Invalid tag filter " + key + ", expected an array of strings")
+			}
+			if !slices.Contains(filter.Tags[tagName], valueStr) {
+				filter.Tags[tagName] = append(filter.Tags[tagName], valueStr)
+			}
 		}
-	}
-	if filter.Limit == 0 || filter.Limit > limit {
-		filter.Limit = limit
 	}
 
-	events := make([]*nostr.Event, 0)
-	eventChan, err := h.store.QueryEvents(r.Context(), filter)
+	return filter, nil
+}
+
+// GetEventXrefs handles requests for the cross-subspace references of an event
+func (h *EventHandlers) GetEventXrefs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID := vars["id"]
+
+	xrefs, err := h.store.GetEventXrefs(r.Context(), eventID)
 	if err != nil {
-		http.Error(w, "Failed to query events", http.StatusInternalServerError)
+		StoreError(w, err, "Failed to get event references")
 		return
 	}
 
-	count := 0
-	for event := range eventChan {
-		if count >= filter.Limit {
-			break
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(xrefs)
+}
+
+// GetEventThread handles requests for the reply tree containing an event. The depth query
+// parameter bounds the reply levels below the root.
+func (h *EventHandlers) GetEventThread(w http.ResponseWriter, r *http.Request) {
+	eventID := mux.Vars(r)["id"]
+
+	depth := 0
+	if depthStr := r.URL.Query().Get("depth"); depthStr != "" {
+		d, err := strconv.Atoi(depthStr)
+		if err != nil || d <= 0 || d > orbitdb.MaxThreadDepth {
+			Error(w, fmt.Sprintf("depth must be between 1 and %d", orbitdb.MaxThreadDepth), http.StatusBadRequest)
+			return
 		}
-		events = append(events, event)
-		count++
+		depth = d
+	}
+
+	thread, err := h.store.GetEventThread(r.Context(), eventID, depth)
+	if err != nil {
+		StoreError(w, err, "Failed to get event thread")
+		return
+	}
+	if thread == nil {
+		WriteError(w, http.StatusNotFound, CodeEventNotFound, "Event not found")
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(events)
+	json.NewEncoder(w).Encode(thread)
 }
 
 // DeleteEvent handles event deletion requests
@@ -177,28 +395,19 @@ func (h *EventHandlers) DeleteEvent(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	eventID := vars["id"]
 
-	filter := nostr.Filter{
-		IDs: []string{eventID},
-	}
-
-	events := make([]*nostr.Event, 0)
-	eventChan, err := h.store.QueryEvents(r.Context(), filter)
+	event, err := h.store.GetEventByID(r.Context(), eventID)
 	if err != nil {
-		http.Error(w, "Failed to query event", http.StatusInternalServerError)
+		StoreError(w, err, "Failed to query event")
 		return
 	}
 
-	for event := range eventChan {
-		events = append(events, event)
-	}
-
-	if len(events) == 0 {
-		http.Error(w, "Event not found", http.StatusNotFound)
+	if event == nil {
+		WriteError(w, http.StatusNotFound, CodeEventNotFound, "Event not found")
 		return
 	}
 
-	if err := h.store.DeleteEvent(r.Context(), events[0]); err != nil {
-		http.Error(w, "Failed to delete event", http.StatusInternalServerError)
+	if err := h.store.DeleteEvent(r.Context(), event); err != nil {
+		StoreError(w, err, "Failed to delete event")
 		return
 	}
 
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,6 +17,7 @@ import (
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockStore is a mock implementation of the storage interface
@@ -26,16 +30,31 @@ func (m *MockStore) SaveEvent(ctx context.Context, event *nostr.Event) error {
 	return args.Error(0)
 }
 
+func (m *MockStore) ValidateEvent(ctx context.Context, event *nostr.Event) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
 func (m *MockStore) QueryEvents(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
 	args := m.Called(ctx, filter)
 	return args.Get(0).(chan *nostr.Event), args.Error(1)
 }
 
+func (m *MockStore) GetEventByID(ctx context.Context, id string) (*nostr.Event, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*nostr.Event), args.Error(1)
+}
+
 func (m *MockStore) DeleteEvent(ctx context.Context, event *nostr.Event) error {
 	args := m.Called(ctx, event)
 	return args.Error(0)
 }
 
+func (m *MockStore) SimulateEvent(ctx context.Context, event *nostr.Event) (*orbitdb.SimulationResult, error) {
+	args := m.Called(ctx, event)
+	return args.Get(0).(*orbitdb.SimulationResult), args.Error(1)
+}
+
 func (m *MockStore) CountEvents(ctx context.Context, filter nostr.Filter) (int, error) {
 	args := m.Called(ctx, filter)
 	return args.Int(0), args.Error(1)
@@ -51,11 +70,29 @@ func (m *MockStore) GetAllCausalityKeys(ctx context.Context, key string) (map[ui
 	return args.Get(0).(map[uint32]uint64), args.Error(1)
 }
 
+func (m *MockStore) ListCausalityKeys(ctx context.Context, key string) ([]*orbitdb.CausalityKey, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).([]*orbitdb.CausalityKey), args.Error(1)
+}
+
 func (m *MockStore) GetCausalityEvents(ctx context.Context, key string) ([]string, error) {
 	args := m.Called(ctx, key)
 	return args.Get(0).([]string), args.Error(1)
 }
 
+func (m *MockStore) GetCausalityEventsPage(ctx context.Context, key, cursor string, limit int) ([]string, string, error) {
+	args := m.Called(ctx, key, cursor, limit)
+	return args.Get(0).([]string), args.String(1), args.Error(2)
+}
+
+func (m *MockStore) GetCausalityGraph(ctx context.Context, key string) (*orbitdb.CausalityGraph, error) {
+	args := m.Called(ctx, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.CausalityGraph), args.Error(1)
+}
+
 func (m *MockStore) GetCausalityKey(ctx context.Context, key string, userID uint32) (uint64, error) {
 	args := m.Called(ctx, key, userID)
 	return args.Get(0).(uint64), args.Error(1)
@@ -66,24 +103,396 @@ func (m *MockStore) GetSubspaceCausality(ctx context.Context, key string) (*orbi
 	return args.Get(0).(*orbitdb.SubspaceCausality), args.Error(1)
 }
 
+func (m *MockStore) GetEventXrefs(ctx context.Context, eventID string) (*orbitdb.EventXrefs, error) {
+	args := m.Called(ctx, eventID)
+	return args.Get(0).(*orbitdb.EventXrefs), args.Error(1)
+}
+
+func (m *MockStore) GetEventThread(ctx context.Context, eventID string, depth int) (*orbitdb.EventThread, error) {
+	args := m.Called(ctx, eventID, depth)
+	return args.Get(0).(*orbitdb.EventThread), args.Error(1)
+}
+
 func (m *MockStore) GetUserStats(ctx context.Context, userID string) (*orbitdb.UserStats, error) {
 	args := m.Called(ctx, userID)
 	return args.Get(0).(*orbitdb.UserStats), args.Error(1)
 }
 
+func (m *MockStore) GetSubspaceStats(ctx context.Context, subspaceID string) (*orbitdb.SubspaceStats, error) {
+	args := m.Called(ctx, subspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.SubspaceStats), args.Error(1)
+}
+
+func (m *MockStore) GetUserStatsBatch(ctx context.Context, userIDs []string) (map[string]*orbitdb.UserStats, error) {
+	args := m.Called(ctx, userIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]*orbitdb.UserStats), args.Error(1)
+}
+
+func (m *MockStore) GetUserProfile(ctx context.Context, pubKey string) (*orbitdb.UserProfile, error) {
+	args := m.Called(ctx, pubKey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.UserProfile), args.Error(1)
+}
+
+func (m *MockStore) GetUserProfiles(ctx context.Context, pubKeys []string) (map[string]*orbitdb.UserProfile, error) {
+	args := m.Called(ctx, pubKeys)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]*orbitdb.UserProfile), args.Error(1)
+}
+
+func (m *MockStore) ListFollows(ctx context.Context, pubKey, relation string) ([]string, error) {
+	args := m.Called(ctx, pubKey, relation)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStore) QueryExclusion(ctx context.Context) (*orbitdb.EventExclusion, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.EventExclusion), args.Error(1)
+}
+
+func (m *MockStore) GetSubspaceModeration(ctx context.Context, subspaceID string) (*orbitdb.SubspaceModeration, error) {
+	args := m.Called(ctx, subspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.SubspaceModeration), args.Error(1)
+}
+
+func (m *MockStore) BanFromSubspace(ctx context.Context, subspaceID, pubKey string, entry orbitdb.ModerationEntry) error {
+	return m.Called(ctx, subspaceID, pubKey, entry).Error(0)
+}
+
+func (m *MockStore) UnbanFromSubspace(ctx context.Context, subspaceID, pubKey string) (bool, error) {
+	args := m.Called(ctx, subspaceID, pubKey)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) HideSubspaceEvent(ctx context.Context, subspaceID, eventID string, entry orbitdb.ModerationEntry) error {
+	return m.Called(ctx, subspaceID, eventID, entry).Error(0)
+}
+
+func (m *MockStore) UnhideSubspaceEvent(ctx context.Context, subspaceID, eventID string) (bool, error) {
+	args := m.Called(ctx, subspaceID, eventID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) PurgeUser(ctx context.Context, pubKey string) (*orbitdb.UserPurgeReport, error) {
+	args := m.Called(ctx, pubKey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.UserPurgeReport), args.Error(1)
+}
+
 func (m *MockStore) QuerySubspaces(ctx context.Context, filter func(*orbitdb.SubspaceCausality) bool) ([]*orbitdb.SubspaceCausality, error) {
 	args := m.Called(ctx, filter)
 	return args.Get(0).([]*orbitdb.SubspaceCausality), args.Error(1)
 }
 
+func (m *MockStore) GetSubspaceMeta(ctx context.Context, subspaceID string) (*orbitdb.SubspaceMeta, error) {
+	args := m.Called(ctx, subspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.SubspaceMeta), args.Error(1)
+}
+
+func (m *MockStore) FindSubspacesByName(ctx context.Context, name string) ([]*orbitdb.SubspaceMeta, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).([]*orbitdb.SubspaceMeta), args.Error(1)
+}
+
+func (m *MockStore) TopSubspaces(ctx context.Context, window time.Duration, metric string, limit int) ([]*orbitdb.SubspaceRanking, error) {
+	args := m.Called(ctx, window, metric, limit)
+	return args.Get(0).([]*orbitdb.SubspaceRanking), args.Error(1)
+}
+
+func (m *MockStore) GetActivityHistogram(ctx context.Context, scope, owner, granularity string, from, to time.Time) ([]*orbitdb.ActivityPoint, error) {
+	args := m.Called(ctx, scope, owner, granularity, from, to)
+	return args.Get(0).([]*orbitdb.ActivityPoint), args.Error(1)
+}
+
+func (m *MockStore) GetUserPeriodStats(ctx context.Context, userID string, from, to time.Time) (*orbitdb.UserStats, error) {
+	args := m.Called(ctx, userID, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.UserStats), args.Error(1)
+}
+
+func (m *MockStore) QueryPeriodStats(ctx context.Context, from, to time.Time) ([]*orbitdb.UserStats, error) {
+	args := m.Called(ctx, from, to)
+	return args.Get(0).([]*orbitdb.UserStats), args.Error(1)
+}
+
 func (m *MockStore) QueryUserStats(ctx context.Context, filter func(*orbitdb.UserStats) bool) ([]*orbitdb.UserStats, error) {
 	args := m.Called(ctx, filter)
 	return args.Get(0).([]*orbitdb.UserStats), args.Error(1)
 }
 
-func (m *MockStore) QueryUsersBySubspace(ctx context.Context, subspace string) ([]*orbitdb.UserStats, error) {
-	args := m.Called(ctx, subspace)
-	return args.Get(0).([]*orbitdb.UserStats), args.Error(1)
+func (m *MockStore) GetLeaderboard(ctx context.Context, subspaceID string) (*orbitdb.Leaderboard, error) {
+	args := m.Called(ctx, subspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.Leaderboard), args.Error(1)
+}
+
+func (m *MockStore) QueryUsersBySubspace(ctx context.Context, subspace string, query orbitdb.SubspaceUserQuery) ([]*orbitdb.UserStats, string, error) {
+	args := m.Called(ctx, subspace, query)
+	return args.Get(0).([]*orbitdb.UserStats), args.String(1), args.Error(2)
+}
+
+func (m *MockStore) GetUsage(ctx context.Context, day, keyID string) (*orbitdb.APIUsage, error) {
+	args := m.Called(ctx, day, keyID)
+	return args.Get(0).(*orbitdb.APIUsage), args.Error(1)
+}
+
+func (m *MockStore) AddUsage(ctx context.Context, delta *orbitdb.APIUsage) error {
+	args := m.Called(ctx, delta)
+	return args.Error(0)
+}
+
+func (m *MockStore) QueryUsage(ctx context.Context, from, to, keyID string) ([]*orbitdb.APIUsage, error) {
+	args := m.Called(ctx, from, to, keyID)
+	return args.Get(0).([]*orbitdb.APIUsage), args.Error(1)
+}
+
+func (m *MockStore) GetEventAnnotations(ctx context.Context, eventID string) ([]*orbitdb.EventAnnotation, error) {
+	args := m.Called(ctx, eventID)
+	return args.Get(0).([]*orbitdb.EventAnnotation), args.Error(1)
+}
+
+func (m *MockStore) AddEventAnnotation(ctx context.Context, eventID string, annotation *orbitdb.EventAnnotation) error {
+	args := m.Called(ctx, eventID, annotation)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteEventAnnotation(ctx context.Context, eventID, annotationID string) (bool, error) {
+	args := m.Called(ctx, eventID, annotationID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) ListSubspaceWebhooks(ctx context.Context, subspaceID string) ([]*orbitdb.SubspaceWebhook, error) {
+	args := m.Called(ctx, subspaceID)
+	return args.Get(0).([]*orbitdb.SubspaceWebhook), args.Error(1)
+}
+
+func (m *MockStore) AddSubspaceWebhook(ctx context.Context, subspaceID string, webhook *orbitdb.SubspaceWebhook) error {
+	args := m.Called(ctx, subspaceID, webhook)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteSubspaceWebhook(ctx context.Context, subspaceID, webhookID string) (bool, error) {
+	args := m.Called(ctx, subspaceID, webhookID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) ListWebhookSubscriptions(ctx context.Context) ([]*orbitdb.WebhookSubscription, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*orbitdb.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockStore) AddWebhookSubscription(ctx context.Context, subscription *orbitdb.WebhookSubscription) error {
+	args := m.Called(ctx, subscription)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeleteWebhookSubscription(ctx context.Context, subscriptionID string) (bool, error) {
+	args := m.Called(ctx, subscriptionID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) ListQuarantinedEvents(ctx context.Context) ([]*orbitdb.QuarantinedEvent, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]*orbitdb.QuarantinedEvent), args.Error(1)
+}
+
+func (m *MockStore) DeleteQuarantinedEvent(ctx context.Context, eventID string) (bool, error) {
+	args := m.Called(ctx, eventID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStore) GetSubspaceInviteGraph(ctx context.Context, subspaceID string) (*orbitdb.InviteGraph, error) {
+	args := m.Called(ctx, subspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.InviteGraph), args.Error(1)
+}
+
+func (m *MockStore) GetInviteTree(ctx context.Context, userID string, depth int) (*orbitdb.InviteTreeNode, error) {
+	args := m.Called(ctx, userID, depth)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.InviteTreeNode), args.Error(1)
+}
+
+func (m *MockStore) GetProposal(ctx context.Context, proposalID string) (*orbitdb.Proposal, error) {
+	args := m.Called(ctx, proposalID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.Proposal), args.Error(1)
+}
+
+func (m *MockStore) ListSubspaceProposals(ctx context.Context, subspaceID, status string) ([]*orbitdb.Proposal, error) {
+	args := m.Called(ctx, subspaceID, status)
+	return args.Get(0).([]*orbitdb.Proposal), args.Error(1)
+}
+
+func (m *MockStore) CloseDueProposals(ctx context.Context) ([]*orbitdb.Proposal, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]*orbitdb.Proposal), args.Error(1)
+}
+
+func (m *MockStore) GetLiveConfig(ctx context.Context, signers []string) (*orbitdb.LiveConfig, error) {
+	args := m.Called(ctx, signers)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.LiveConfig), args.Error(1)
+}
+
+func (m *MockStore) PublishLiveConfig(ctx context.Context, event *nostr.Event, signers []string) (*orbitdb.LiveConfig, error) {
+	args := m.Called(ctx, event, signers)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.LiveConfig), args.Error(1)
+}
+
+func (m *MockStore) GetMigrationStatus(ctx context.Context) (*orbitdb.MigrationStatus, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*orbitdb.MigrationStatus), args.Error(1)
+}
+
+func (m *MockStore) StartMigrationBackfill(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) FlipMigration(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) ForecastStorage(ctx context.Context, opts orbitdb.StorageForecastOptions) (*orbitdb.StorageForecast, error) {
+	args := m.Called(ctx, opts)
+	return args.Get(0).(*orbitdb.StorageForecast), args.Error(1)
+}
+
+func (m *MockStore) Backup(ctx context.Context, w io.Writer) (int, error) {
+	args := m.Called(ctx, w)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStore) Restore(ctx context.Context, r io.Reader) (int, error) {
+	args := m.Called(ctx, r)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStore) RebuildDerivedData(ctx context.Context) (*orbitdb.RebuildResult, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.RebuildResult), args.Error(1)
+}
+
+func (m *MockStore) ReplicationBacklog() int {
+	args := m.Called()
+	return args.Int(0)
+}
+
+func (m *MockStore) FlushDerivedData(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockStore) DerivedDataStats() orbitdb.DerivedDataStats {
+	args := m.Called()
+	return args.Get(0).(orbitdb.DerivedDataStats)
+}
+
+func (m *MockStore) SweepRetention(ctx context.Context, policy orbitdb.RetentionPolicy, now time.Time) (*orbitdb.RetentionResult, error) {
+	args := m.Called(ctx, policy, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.RetentionResult), args.Error(1)
+}
+
+func (m *MockStore) Databases() orbitdb.DatabaseInfo {
+	args := m.Called()
+	return args.Get(0).(orbitdb.DatabaseInfo)
+}
+
+func (m *MockStore) StoreStatus(ctx context.Context) (*orbitdb.StoreStatus, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.StoreStatus), args.Error(1)
+}
+
+func (m *MockStore) ReplicationStatus() *orbitdb.ReplicationStatus {
+	args := m.Called()
+	return args.Get(0).(*orbitdb.ReplicationStatus)
+}
+
+func (m *MockStore) BackfillFromRelays(ctx context.Context, relays []string, filters nostr.Filters) (*orbitdb.BackfillReport, error) {
+	args := m.Called(ctx, relays, filters)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.BackfillReport), args.Error(1)
+}
+
+func (m *MockStore) Compact(ctx context.Context) (*orbitdb.SnapshotResult, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.SnapshotResult), args.Error(1)
+}
+
+func (m *MockStore) SnapshotIfGrown(ctx context.Context, entries int) (*orbitdb.SnapshotResult, error) {
+	args := m.Called(ctx, entries)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.SnapshotResult), args.Error(1)
+}
+
+func (m *MockStore) EventPolicies() []orbitdb.EventPolicyInfo {
+	args := m.Called()
+	return args.Get(0).([]orbitdb.EventPolicyInfo)
+}
+
+func (m *MockStore) WarmUp(ctx context.Context, subspaceIDs []string) (*orbitdb.WarmupResult, error) {
+	args := m.Called(ctx, subspaceIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*orbitdb.WarmupResult), args.Error(1)
 }
 
 func (m *MockStore) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
@@ -219,6 +628,22 @@ func TestSaveEvent(t *testing.T) {
 	mockStore.AssertExpectations(t)
 }
 
+// Test that events the author may not write to their subspace are refused with 403
+func TestSaveEventForbidden(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewEventHandlers(mockStore)
+
+	mockStore.On("SaveEvent", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: mallory", orbitdb.ErrWriteForbidden))
+
+	body, _ := json.Marshal(&nostr.Event{ID: "test-event", CreatedAt: nostr.Now()})
+	req := httptest.NewRequest("POST", "/events", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	handler.SaveEvent(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
 // Test getting a single event
 func TestGetEvent(t *testing.T) {
 	mockStore := new(MockStore)
@@ -232,12 +657,8 @@ func TestGetEvent(t *testing.T) {
 	}
 
 	// Set up mock behavior
-	eventChan := make(chan *nostr.Event, 1)
-	eventChan <- event
-	close(eventChan)
-	mockStore.On("QueryEvents", mock.Anything, mock.MatchedBy(func(filter nostr.Filter) bool {
-		return len(filter.IDs) == 1 && filter.IDs[0] == "test-event"
-	})).Return(eventChan, nil)
+	mockStore.On("GetEventByID", mock.Anything, "test-event").Return(event, nil)
+	mockStore.On("QueryExclusion", mock.Anything).Return(nil, nil)
 
 	// Create request
 	req := httptest.NewRequest("GET", "/events/test-event", nil)
@@ -250,9 +671,210 @@ func TestGetEvent(t *testing.T) {
 
 	// Verify response
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
 	var responseEvent nostr.Event
 	err := json.NewDecoder(w.Body).Decode(&responseEvent)
 	assert.NoError(t, err)
 	assert.Equal(t, event.ID, responseEvent.ID)
 	assert.Equal(t, event.Content, responseEvent.Content)
 }
+
+// Test that events left out of queries by the subspace moderation are not found by ID either
+func TestGetEventModerated(t *testing.T) {
+	ctx := context.Background()
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("get-moderated"))
+	handler := NewEventHandlers(store)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000e2"
+	alice, spammer := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	events := map[string]*nostr.Event{
+		"visible": {CreatedAt: 1700000000, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}},
+		"hidden":  {CreatedAt: 1700000100, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}},
+		"banned":  {CreatedAt: 1700000200, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}},
+	}
+	require.NoError(t, events["visible"].Sign(alice))
+	require.NoError(t, events["hidden"].Sign(alice))
+	require.NoError(t, events["banned"].Sign(spammer))
+	require.NoError(t, store.SaveEvents(ctx, []*nostr.Event{events["visible"], events["hidden"], events["banned"]}))
+	require.NoError(t, store.HideSubspaceEvent(ctx, sid, events["hidden"].ID, orbitdb.ModerationEntry{By: "mod", At: 1700000300}))
+	require.NoError(t, store.BanFromSubspace(ctx, sid, events["banned"].PubKey, orbitdb.ModerationEntry{By: "mod", At: 1700000300}))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}", handler.GetEvent).Methods("GET")
+	for name, status := range map[string]int{"visible": http.StatusOK, "hidden": http.StatusNotFound, "banned": http.StatusNotFound} {
+		id := events[name].ID
+		for _, path := range []string{"/events/" + id, "/events/" + id + "?include=annotations"} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			assert.Equal(t, status, w.Code, path)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"), path)
+		}
+	}
+}
+
+// Test counting events with the query filter format
+func TestCountEvents(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewEventHandlers(mockStore)
+
+	// Set up mock behavior
+	mockStore.On("CountEvents", mock.Anything, mock.MatchedBy(func(filter nostr.Filter) bool {
+		return len(filter.Kinds) == 1 && filter.Kinds[0] == 30300 &&
+			len(filter.Tags["sid"]) == 1 && filter.Since != nil && filter.Limit == 0
+	})).Return(42, nil)
+
+	// Create request
+	body := []byte(`{"kinds":[30300],"sid":["test-subspace"],"since":1700000000,"limit":10}`)
+	req := httptest.NewRequest("POST", "/events/count", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	// Execute request
+	handler.CountEvents(w, req)
+
+	// Verify response
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]int
+	err := json.NewDecoder(w.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, response["count"])
+	mockStore.AssertExpectations(t)
+}
+
+func TestQueryEventsIncludeAnnotations(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewEventHandlers(mockStore)
+
+	eventChan := make(chan *nostr.Event, 2)
+	eventChan <- &nostr.Event{ID: "event1", Kind: 30300, Content: "spam", Sig: "sig1"}
+	eventChan <- &nostr.Event{ID: "event2", Kind: 30300, Content: "hello", Sig: "sig2"}
+	close(eventChan)
+
+	mockStore.On("QueryEvents", mock.Anything, mock.Anything).Return(eventChan, nil)
+	mockStore.On("GetEventAnnotations", mock.Anything, "event1").Return([]*orbitdb.EventAnnotation{
+		{ID: "a1", Type: orbitdb.AnnotationModerationLabel, Value: "spam", Source: "moderator"},
+	}, nil)
+	mockStore.On("GetEventAnnotations", mock.Anything, "event2").Return([]*orbitdb.EventAnnotation(nil), nil)
+
+	req := httptest.NewRequest("POST", "/events/query?include=annotations", bytes.NewBufferString(`{}`))
+	w := httptest.NewRecorder()
+	handler.QueryEvents(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response []struct {
+		ID          string                     `json:"id"`
+		Sig         string                     `json:"sig"`
+		Annotations []*orbitdb.EventAnnotation `json:"annotations"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	if assert.Len(t, response, 2) {
+		// The signed event is returned unchanged next to its annotations
+		assert.Equal(t, "sig1", response[0].Sig)
+		assert.Len(t, response[0].Annotations, 1)
+		assert.Equal(t, "spam", response[0].Annotations[0].Value)
+		assert.NotNil(t, response[1].Annotations)
+		assert.Empty(t, response[1].Annotations)
+	}
+	mockStore.AssertExpectations(t)
+}
+
+func TestAddEventAnnotation(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewAnnotationHandlers(mockStore)
+
+	mockStore.On("GetEventByID", mock.Anything, "event1").Return(&nostr.Event{ID: "event1"}, nil)
+	mockStore.On("GetEventByID", mock.Anything, "missing").Return((*nostr.Event)(nil), nil)
+	mockStore.On("AddEventAnnotation", mock.Anything, "event1", mock.MatchedBy(func(annotation *orbitdb.EventAnnotation) bool {
+		return annotation.Type == orbitdb.AnnotationVerificationBadge && annotation.Value == "verified"
+	})).Return(nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}/annotations", handler.AddEventAnnotation)
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/events/event1/annotations", `{"type":"verification_badge","value":"verified"}`, http.StatusCreated},
+		{"/events/event1/annotations", `{"type":"rating","value":"5"}`, http.StatusBadRequest},
+		{"/events/event1/annotations", `{"type":"moderation_label"}`, http.StatusBadRequest},
+		{"/events/missing/annotations", `{"type":"moderation_label","value":"spam"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.status, w.Code, tt.body)
+	}
+	mockStore.AssertExpectations(t)
+}
+
+func TestQueryEventsTagFilters(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewEventHandlers(mockStore)
+
+	eventChan := make(chan *nostr.Event)
+	close(eventChan)
+	mockStore.On("QueryEvents", mock.Anything, mock.MatchedBy(func(filter nostr.Filter) bool {
+		return assert.ObjectsAreEqual([]string{"e1", "e2"}, filter.Tags["e"]) &&
+			assert.ObjectsAreEqual([]string{"nostr"}, filter.Tags["t"]) &&
+			assert.ObjectsAreEqual([]string{"s1"}, filter.Tags["sid"])
+	})).Return(eventChan, nil)
+
+	body := `{"#e":["e1","e2"],"#t":["nostr"],"sid":["s1"],"#sid":["s1"]}`
+	req := httptest.NewRequest("POST", "/events/query", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	handler.QueryEvents(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockStore.AssertExpectations(t)
+
+	// Tag filters must be arrays of strings
+	for _, body := range []string{`{"#e":"e1"}`, `{"#p":[1]}`} {
+		req := httptest.NewRequest("POST", "/events/query", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		handler.QueryEvents(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+	mockStore.AssertNumberOfCalls(t, "QueryEvents", 1)
+}
+
+func TestQueryEventsNDJSON(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewEventHandlers(mockStore)
+
+	eventChan := make(chan *nostr.Event, 3)
+	eventChan <- &nostr.Event{ID: "event3", Kind: 30300, CreatedAt: 1700000300}
+	eventChan <- &nostr.Event{ID: "event2", Kind: 30300, CreatedAt: 1700000200}
+	eventChan <- &nostr.Event{ID: "event1", Kind: 30300, CreatedAt: 1700000100}
+	close(eventChan)
+	mockStore.On("QueryEvents", mock.Anything, mock.Anything).Return(eventChan, nil)
+
+	req := httptest.NewRequest("POST", "/events/query?limit=2", bytes.NewBufferString(`{}`))
+	req.Header.Set("Accept", "application/x-ndjson, application/json;q=0.5")
+	w := httptest.NewRecorder()
+	handler.QueryEvents(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, NDJSONContentType, w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2, "the limit applies to streams")
+	var event nostr.Event
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+	assert.Equal(t, "event3", event.ID)
+	assert.True(t, w.Flushed)
+}
+
+// Test that a stream cut short by an error ends with an error line
+func TestEventStreamFail(t *testing.T) {
+	req := httptest.NewRequest("POST", "/events/query", nil)
+	w := httptest.NewRecorder()
+	stream := newEventStream(w, req, new(MockStore))
+	require.NoError(t, stream.Write(&nostr.Event{ID: "event1"}))
+	stream.Fail(context.DeadlineExceeded, "Failed to query events")
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	var response ErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &response))
+	assert.Equal(t, CodeTimeout, response.Error.Code)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// FollowPage is a page of the users in a follow relation with a user
+type FollowPage struct {
+	PubKey   string   `json:"pubkey"`   // User the relation is of
+	Relation string   `json:"relation"` // following, followers or mutual
+	Total    int      `json:"total"`    // Users in the relation, over all pages
+	Users    []string `json:"users"`    // Public keys of the page, sorted
+}
+
+// ListFollowing lists the users a user follows
+func (h *UserHandlers) ListFollowing(w http.ResponseWriter, r *http.Request) {
+	h.listFollows(w, r, orbitdb.FollowFollowing)
+}
+
+// ListFollowers lists the users following a user
+func (h *UserHandlers) ListFollowers(w http.ResponseWriter, r *http.Request) {
+	h.listFollows(w, r, orbitdb.FollowFollowers)
+}
+
+// ListMutualFollows lists the users a user follows that follow them back
+func (h *UserHandlers) ListMutualFollows(w http.ResponseWriter, r *http.Request) {
+	h.listFollows(w, r, orbitdb.FollowMutual)
+}
+
+// listFollows serves a follow relation of a user in pages of limit users (default 100),
+// sorted by public key; the X-Next-Cursor response header is passed as cursor to fetch the
+// next page
+func (h *UserHandlers) listFollows(w http.ResponseWriter, r *http.Request, relation string) {
+	pubKey := mux.Vars(r)["id"]
+
+	params := r.URL.Query()
+	limit := 100 // Default limit
+	if limitStr := params.Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			Error(w, "Invalid limit, expected a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	users, err := h.store.ListFollows(r.Context(), pubKey, relation)
+	if err != nil {
+		StoreError(w, err, "Failed to query follows")
+		return
+	}
+
+	page := users[sort.Search(len(users), func(i int) bool { return users[i] > params.Get("cursor") }):]
+	if len(page) > limit {
+		page = page[:limit]
+		w.Header().Set(NextCursorHeader, page[limit-1])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FollowPage{
+		PubKey:   pubKey,
+		Relation: relation,
+		Total:    len(users),
+		Users:    page,
+	})
+}
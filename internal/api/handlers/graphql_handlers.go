@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/graphql"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// GraphQL limits. Each level of a query may load a list of up to GraphQLMaxLimit documents
+// for every element of the level above, so depth and resolved fields are bounded as well.
+const (
+	GraphQLDefaultLimit = 20
+	GraphQLMaxLimit     = 100
+	GraphQLMaxDepth     = 6
+	GraphQLMaxResolves  = 10000
+)
+
+// GraphQLHandlers serves events, users, subspaces and proposals as a graph, so composite
+// views are fetched in one request
+type GraphQLHandlers struct {
+	schema *graphql.Schema
+}
+
+// NewGraphQLHandlers creates a new GraphQLHandlers
+func NewGraphQLHandlers(store storage.Store) *GraphQLHandlers {
+	return &GraphQLHandlers{schema: newGraphQLSchema(store)}
+}
+
+// Query handles GraphQL requests, posted as JSON or sent as GET query parameters. Field
+// errors are reported in the errors of a 200 response, as GraphQL over HTTP does.
+func (h *GraphQLHandlers) Query(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				Error(w, "Invalid variables, expected a JSON object", http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.Query == "" {
+		Error(w, "query must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	response := graphql.Execute(r.Context(), h.schema, req)
+	w.Header().Set("Content-Type", "application/json")
+	if response.Data == nil {
+		// The request failed before execution
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// newGraphQLSchema builds the schema of the store's documents. Object types expose the
+// fields of their documents as they encode to JSON, plus fields following references to
+// other documents.
+func newGraphQLSchema(store storage.Store) *graphql.Schema {
+	event := &graphql.Object{Name: "Event", Fields: graphql.StructFields(reflect.TypeFor[nostr.Event]())}
+	subspace := &graphql.Object{Name: "Subspace", Fields: graphql.StructFields(reflect.TypeFor[orbitdb.SubspaceCausality]())}
+	user := &graphql.Object{Name: "User", Fields: graphql.StructFields(reflect.TypeFor[orbitdb.UserStats]())}
+	proposal := &graphql.Object{Name: "Proposal", Fields: graphql.StructFields(reflect.TypeFor[orbitdb.Proposal]())}
+
+	getEvent := func(ctx context.Context, id string) (interface{}, error) {
+		e, err := store.GetEventByID(ctx, id)
+		if errors.Is(err, storage.ErrEventNotFound) {
+			return nil, nil
+		}
+		if e == nil {
+			return nil, err
+		}
+		return e, err
+	}
+	getSubspace := func(ctx context.Context, id string) (interface{}, error) {
+		causality, err := store.GetSubspaceCausality(ctx, id)
+		if causality == nil {
+			return nil, err
+		}
+		return causality, err
+	}
+	getSubspaces := func(ctx context.Context, ids []string) (interface{}, error) {
+		subspaces := make([]*orbitdb.SubspaceCausality, 0, len(ids))
+		for _, id := range ids {
+			causality, err := store.GetSubspaceCausality(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if causality != nil {
+				subspaces = append(subspaces, causality)
+			}
+		}
+		return subspaces, nil
+	}
+	getUser := func(ctx context.Context, id string) (interface{}, error) {
+		stats, err := store.GetUserStats(ctx, id)
+		if stats == nil {
+			return nil, err
+		}
+		return stats, err
+	}
+	getProposal := func(ctx context.Context, id string) (interface{}, error) {
+		p, err := store.GetProposal(ctx, id)
+		if p == nil {
+			return nil, err
+		}
+		return p, err
+	}
+
+	// Event references
+	event.Fields["author"] = &graphql.Field{Type: user, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		return getUser(ctx, source.(*nostr.Event).PubKey)
+	}}
+	event.Fields["subspace"] = &graphql.Field{Type: subspace, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		sid := eventTag(source.(*nostr.Event), "sid")
+		if sid == "" {
+			return nil, nil
+		}
+		return getSubspace(ctx, sid)
+	}}
+	event.Fields["annotations"] = &graphql.Field{Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		annotations, err := store.GetEventAnnotations(ctx, source.(*nostr.Event).ID)
+		if annotations == nil && err == nil {
+			annotations = []*orbitdb.EventAnnotation{}
+		}
+		return annotations, err
+	}}
+	event.Fields["xrefs"] = &graphql.Field{Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		return store.GetEventXrefs(ctx, source.(*nostr.Event).ID)
+	}}
+
+	// Subspace references
+	subspace.Fields["meta"] = &graphql.Field{Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		return store.GetSubspaceMeta(ctx, source.(*orbitdb.SubspaceCausality).ID)
+	}}
+	subspace.Fields["name"] = &graphql.Field{Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		meta, err := store.GetSubspaceMeta(ctx, source.(*orbitdb.SubspaceCausality).ID)
+		if meta == nil {
+			return nil, err
+		}
+		return meta.Name, err
+	}}
+	subspace.Fields["creator"] = &graphql.Field{Type: user, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		meta, err := store.GetSubspaceMeta(ctx, source.(*orbitdb.SubspaceCausality).ID)
+		if meta == nil || err != nil {
+			return nil, err
+		}
+		return getUser(ctx, meta.Creator)
+	}}
+	subspace.Fields["causality_keys"] = &graphql.Field{Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		return store.ListCausalityKeys(ctx, source.(*orbitdb.SubspaceCausality).ID)
+	}}
+	subspace.Fields["events"] = &graphql.Field{Type: event, Args: []string{"limit", "cursor"}, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		limit, err := graphQLLimit(args)
+		if err != nil {
+			return nil, err
+		}
+		cursor, err := args.String("cursor")
+		if err != nil {
+			return nil, err
+		}
+		ids, _, err := store.GetCausalityEventsPage(ctx, source.(*orbitdb.SubspaceCausality).ID, cursor, limit)
+		if err != nil {
+			return nil, err
+		}
+		events := make([]*nostr.Event, 0, len(ids))
+		for _, id := range ids {
+			e, err := getEvent(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if e != nil {
+				events = append(events, e.(*nostr.Event))
+			}
+		}
+		return events, nil
+	}}
+	subspace.Fields["users"] = &graphql.Field{Type: user, Args: []string{"limit", "cursor", "active_since"}, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		query := orbitdb.SubspaceUserQuery{}
+		var err error
+		if query.Limit, err = graphQLLimit(args); err != nil {
+			return nil, err
+		}
+		if query.Cursor, err = args.String("cursor"); err != nil {
+			return nil, err
+		}
+		activeSince, err := args.Int("active_since", 0)
+		if err != nil {
+			return nil, err
+		}
+		query.ActiveSince = int64(activeSince)
+		users, _, err := store.QueryUsersBySubspace(ctx, source.(*orbitdb.SubspaceCausality).ID, query)
+		return users, err
+	}}
+	subspace.Fields["proposals"] = &graphql.Field{Type: proposal, Args: []string{"status"}, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		status, err := args.String("status")
+		if err != nil {
+			return nil, err
+		}
+		return store.ListSubspaceProposals(ctx, source.(*orbitdb.SubspaceCausality).ID, status)
+	}}
+
+	// User references
+	user.Fields["created_subspaces"] = &graphql.Field{Type: subspace, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		return getSubspaces(ctx, source.(*orbitdb.UserStats).CreatedSubspaces)
+	}}
+	user.Fields["joined_subspaces"] = &graphql.Field{Type: subspace, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		return getSubspaces(ctx, source.(*orbitdb.UserStats).JoinedSubspaces)
+	}}
+	user.Fields["events"] = &graphql.Field{Type: event, Args: []string{"limit", "kinds", "subspace"}, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		filter := nostr.Filter{Authors: []string{source.(*orbitdb.UserStats).ID}}
+		var err error
+		if filter.Limit, err = graphQLLimit(args); err != nil {
+			return nil, err
+		}
+		if filter.Kinds, err = args.Ints("kinds"); err != nil {
+			return nil, err
+		}
+		sid, err := args.String("subspace")
+		if err != nil {
+			return nil, err
+		}
+		if sid != "" {
+			filter.Tags = nostr.TagMap{"sid": {sid}}
+		}
+		return queryEvents(ctx, store, filter)
+	}}
+
+	// Proposal references
+	proposal.Fields["subspace"] = &graphql.Field{Type: subspace, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		return getSubspace(ctx, source.(*orbitdb.Proposal).SubspaceID)
+	}}
+	proposal.Fields["proposer_stats"] = &graphql.Field{Type: user, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		proposer := source.(*orbitdb.Proposal).Proposer
+		if proposer == "" {
+			return nil, nil
+		}
+		return getUser(ctx, proposer)
+	}}
+
+	query := &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"event": {Type: event, Args: []string{"id"}, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			id, err := requiredString(args, "id")
+			if err != nil {
+				return nil, err
+			}
+			return getEvent(ctx, id)
+		}},
+		"events": {Type: event, Args: []string{"filter", "limit"}, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			params, err := args.Object("filter")
+			if err != nil {
+				return nil, err
+			}
+			// Round-trip through JSON so numbers are decoded as in a query request body
+			body, err := json.Marshal(params)
+			if err != nil {
+				return nil, err
+			}
+			var queryParams map[string]interface{}
+			if err := json.Unmarshal(body, &queryParams); err != nil {
+				return nil, err
+			}
+			filter, err := ParseFilter(queryParams)
+			if err != nil {
+				return nil, err
+			}
+			limit, err := graphQLLimit(args)
+			if err != nil {
+				return nil, err
+			}
+			if filter.Limit == 0 || filter.Limit > limit {
+				filter.Limit = limit
+			}
+			return queryEvents(ctx, store, filter)
+		}},
+		"subspace": {Type: subspace, Args: []string{"id"}, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			id, err := requiredString(args, "id")
+			if err != nil {
+				return nil, err
+			}
+			return getSubspace(ctx, id)
+		}},
+		"subspaces": {Type: subspace, Args: []string{"name", "limit"}, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			limit, err := graphQLLimit(args)
+			if err != nil {
+				return nil, err
+			}
+			name, err := args.String("name")
+			if err != nil {
+				return nil, err
+			}
+			if name != "" {
+				metas, err := store.FindSubspacesByName(ctx, name)
+				if err != nil {
+					return nil, err
+				}
+				ids := make([]string, 0, len(metas))
+				for _, meta := range metas {
+					if len(ids) < limit {
+						ids = append(ids, meta.SubspaceID)
+					}
+				}
+				return getSubspaces(ctx, ids)
+			}
+
+			subspaces, err := store.QuerySubspaces(ctx, func(*orbitdb.SubspaceCausality) bool { return true })
+			if err != nil {
+				return nil, err
+			}
+			sort.Slice(subspaces, func(i, j int) bool { return subspaces[i].ID < subspaces[j].ID })
+			if len(subspaces) > limit {
+				subspaces = subspaces[:limit]
+			}
+			return subspaces, nil
+		}},
+		"user": {Type: user, Args: []string{"id"}, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			id, err := requiredString(args, "id")
+			if err != nil {
+				return nil, err
+			}
+			return getUser(ctx, id)
+		}},
+		"proposal": {Type: proposal, Args: []string{"id"}, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			id, err := requiredString(args, "id")
+			if err != nil {
+				return nil, err
+			}
+			return getProposal(ctx, id)
+		}},
+	}}
+
+	return &graphql.Schema{Query: query, MaxDepth: GraphQLMaxDepth, MaxResolves: GraphQLMaxResolves}
+}
+
+// Helper function: collect the events matching a filter, at most filter.Limit
+func queryEvents(ctx context.Context, store storage.Store, filter nostr.Filter) ([]*nostr.Event, error) {
+	eventChan, err := store.QueryEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*nostr.Event, 0)
+	for event := range eventChan {
+		if len(events) >= filter.Limit {
+			break
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Helper function: the limit argument of a list field, GraphQLDefaultLimit by default and at
+// most GraphQLMaxLimit
+func graphQLLimit(args graphql.Args) (int, error) {
+	limit, err := args.Int("limit", GraphQLDefaultLimit)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 || limit > GraphQLMaxLimit {
+		return 0, fmt.Errorf("argument \"limit\" must be between 1 and %d", GraphQLMaxLimit)
+	}
+	return limit, nil
+}
+
+// Helper function: a string argument that must be set
+func requiredString(args graphql.Args, name string) (string, error) {
+	value, err := args.String(name)
+	if err == nil && value == "" {
+		err = fmt.Errorf("argument %q is required", name)
+	}
+	return value, err
+}
+
+// Helper function: the value of the first tag of an event with a name
+func eventTag(event *nostr.Event, name string) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == name {
+			return tag[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// operatorKey is the context key of the subspace operator a moderation request was made by
+type operatorKey struct{}
+
+// WithOperator returns a context carrying the public key of the subspace operator, the
+// creator or a moderator, a moderation request was authenticated as
+func WithOperator(ctx context.Context, pubKey string) context.Context {
+	return context.WithValue(ctx, operatorKey{}, pubKey)
+}
+
+// Operator returns the public key of the subspace operator a request was made by, empty if
+// it wasn't checked
+func Operator(ctx context.Context) string {
+	pubKey, _ := ctx.Value(operatorKey{}).(string)
+	return pubKey
+}
+
+// ModerationHandlers handles subspace moderation requests
+type ModerationHandlers struct {
+	store storage.Store
+}
+
+// NewModerationHandlers creates a new ModerationHandlers
+func NewModerationHandlers(store storage.Store) *ModerationHandlers {
+	return &ModerationHandlers{store: store}
+}
+
+// ModerationRequest is the optional body of a ban or hide request
+type ModerationRequest struct {
+	Reason string `json:"reason"` // Reason recorded with the action
+}
+
+// GetSubspaceModeration handles requests to list the users banned from a subspace and the
+// events hidden in it
+func (h *ModerationHandlers) GetSubspaceModeration(w http.ResponseWriter, r *http.Request) {
+	subspaceID := mux.Vars(r)["id"]
+
+	moderation, err := h.store.GetSubspaceModeration(r.Context(), subspaceID)
+	if err != nil {
+		StoreError(w, err, "Failed to get subspace moderation")
+		return
+	}
+	if moderation == nil {
+		moderation = &orbitdb.SubspaceModeration{
+			ID:         orbitdb.DocTypeSubspaceModeration + ":" + subspaceID,
+			DocType:    orbitdb.DocTypeSubspaceModeration,
+			SubspaceID: subspaceID,
+			Banned:     map[string]*orbitdb.ModerationEntry{},
+			Hidden:     map[string]*orbitdb.ModerationEntry{},
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(moderation)
+}
+
+// BanUser handles requests to ban a user from a subspace
+func (h *ModerationHandlers) BanUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	entry, ok := moderationEntry(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.BanFromSubspace(r.Context(), vars["id"], vars["pubkey"], entry); err != nil {
+		StoreError(w, err, "Failed to ban user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnbanUser handles requests to lift the ban of a user from a subspace
+func (h *ModerationHandlers) UnbanUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	unbanned, err := h.store.UnbanFromSubspace(r.Context(), vars["id"], vars["pubkey"])
+	if err != nil {
+		StoreError(w, err, "Failed to unban user")
+		return
+	}
+	if !unbanned {
+		Error(w, "User is not banned", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HideEvent handles requests to hide an event of a subspace from queries
+func (h *ModerationHandlers) HideEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subspaceID, eventID := vars["id"], vars["event_id"]
+	entry, ok := moderationEntry(w, r)
+	if !ok {
+		return
+	}
+
+	event, err := h.store.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		StoreError(w, err, "Failed to query event")
+		return
+	}
+	if event == nil || !inSubspace(event, subspaceID) {
+		WriteError(w, http.StatusNotFound, CodeEventNotFound, "Event not found in subspace")
+		return
+	}
+
+	if err := h.store.HideSubspaceEvent(r.Context(), subspaceID, eventID, entry); err != nil {
+		StoreError(w, err, "Failed to hide event")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnhideEvent handles requests to show a hidden event of a subspace again
+func (h *ModerationHandlers) UnhideEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	unhidden, err := h.store.UnhideSubspaceEvent(r.Context(), vars["id"], vars["event_id"])
+	if err != nil {
+		StoreError(w, err, "Failed to unhide event")
+		return
+	}
+	if !unhidden {
+		Error(w, "Event is not hidden", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Helper function: build the entry of a moderation action from the optional request body.
+// Writes a 400 response and returns false if the body is malformed.
+func moderationEntry(w http.ResponseWriter, r *http.Request) (orbitdb.ModerationEntry, bool) {
+	var requestData ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil && !errors.Is(err, io.EOF) {
+		Error(w, "Invalid request format", http.StatusBadRequest)
+		return orbitdb.ModerationEntry{}, false
+	}
+	return orbitdb.ModerationEntry{
+		By:     Operator(r.Context()),
+		Reason: requestData.Reason,
+		At:     int64(nostr.Now()),
+	}, true
+}
+
+// Helper function: check whether an event carries a subspace's sid tag
+func inSubspace(event *nostr.Event, subspaceID string) bool {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" && tag[1] == subspaceID {
+			return true
+		}
+	}
+	return false
+}
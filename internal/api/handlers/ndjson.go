@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+)
+
+// NDJSONContentType is the media type of streamed event responses, one event per line
+const NDJSONContentType = "application/x-ndjson"
+
+// ndjsonFlushEvery is the number of events written between flushes of a stream
+const ndjsonFlushEvery = 64
+
+// Helper function: check whether the request accepts streamed NDJSON responses
+func wantsNDJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && mediaType == NDJSONContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// eventStream writes events to a response as NDJSON while they are produced, so large
+// results are never held in memory. Errors after the first event can't change the status;
+// they end the stream with an error line, see Fail.
+type eventStream struct {
+	w        http.ResponseWriter
+	r        *http.Request
+	store    storage.Store
+	enc      *json.Encoder
+	annotate bool
+	pending  int
+}
+
+// newEventStream starts an NDJSON response
+func newEventStream(w http.ResponseWriter, r *http.Request, store storage.Store) *eventStream {
+	w.Header().Set("Content-Type", NDJSONContentType)
+	w.WriteHeader(http.StatusOK)
+	return &eventStream{
+		w:        w,
+		r:        r,
+		store:    store,
+		enc:      json.NewEncoder(w),
+		annotate: includes(r, IncludeAnnotations),
+	}
+}
+
+// Write writes an event line, with its annotations if the request includes them
+func (s *eventStream) Write(event *nostr.Event) error {
+	var line interface{} = event
+	if s.annotate {
+		annotated, err := annotateEvents(s.r.Context(), s.store, []*nostr.Event{event})
+		if err != nil {
+			zap.L().Warn("Failed to annotate streamed event", zap.String("event", event.ID), zap.Error(err))
+			return err
+		}
+		line = annotated[0]
+	}
+
+	if err := s.enc.Encode(line); err != nil {
+		return err
+	}
+	if s.pending++; s.pending >= ndjsonFlushEvery {
+		s.Flush()
+	}
+	return nil
+}
+
+// Flush sends the buffered lines to the client
+func (s *eventStream) Flush() {
+	s.pending = 0
+	// Middleware writers are unwrapped by the controller; writers that can't flush are
+	// flushed when the handler returns
+	http.NewResponseController(s.w).Flush()
+}
+
+// Fail ends the stream with an error line, an ErrorResponse like the body of error responses,
+// so clients can tell a stream cut short from a complete one. Typed errors get their own
+// code, other errors are internal errors described by message.
+func (s *eventStream) Fail(err error, message string) {
+	detail := ErrorDetail{Code: CodeInternal, Message: message}
+	if _, code, ok := ErrorStatus(err); ok {
+		detail = ErrorDetail{Code: code, Message: err.Error()}
+	}
+	if err := s.enc.Encode(ErrorResponse{Error: detail}); err != nil {
+		return
+	}
+	s.Flush()
+}
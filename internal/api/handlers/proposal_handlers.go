@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// ProposalHandlers handles proposal requests
+type ProposalHandlers struct {
+	store storage.Store
+}
+
+// NewProposalHandlers creates a new ProposalHandlers
+func NewProposalHandlers(store storage.Store) *ProposalHandlers {
+	return &ProposalHandlers{store: store}
+}
+
+// GetProposal handles requests for a proposal with its status and tallies
+func (h *ProposalHandlers) GetProposal(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	proposalID := vars["id"]
+
+	proposal, err := h.store.GetProposal(r.Context(), proposalID)
+	if err != nil {
+		StoreError(w, err, "Failed to get proposal")
+		return
+	}
+	if proposal == nil {
+		Error(w, "Proposal does not exist", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proposal)
+}
+
+// ListSubspaceProposals handles requests for the proposals of a subspace, newest first.
+// The status query parameter only returns proposals with that status.
+func (h *ProposalHandlers) ListSubspaceProposals(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subspaceID := vars["id"]
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", orbitdb.ProposalOpen, orbitdb.ProposalPassed, orbitdb.ProposalRejected, orbitdb.ProposalExpired:
+	default:
+		Error(w, "Invalid status, expected open, passed, rejected or expired", http.StatusBadRequest)
+		return
+	}
+
+	proposals, err := h.store.ListSubspaceProposals(r.Context(), subspaceID, status)
+	if err != nil {
+		StoreError(w, err, "Failed to list proposals")
+		return
+	}
+	if proposals == nil {
+		proposals = []*orbitdb.Proposal{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subspace_id": subspaceID,
+		"proposals":   proposals,
+	})
+}
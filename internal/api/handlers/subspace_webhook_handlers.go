@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/internal/webhook"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// SubspaceWebhookHandlers handles requests managing the webhooks of a subspace
+type SubspaceWebhookHandlers struct {
+	store storage.Store
+}
+
+// NewSubspaceWebhookHandlers creates a new SubspaceWebhookHandlers
+func NewSubspaceWebhookHandlers(store storage.Store) *SubspaceWebhookHandlers {
+	return &SubspaceWebhookHandlers{
+		store: store,
+	}
+}
+
+// ListSubspaceWebhooks handles requests to list the webhooks of a subspace. Secrets are not returned.
+func (h *SubspaceWebhookHandlers) ListSubspaceWebhooks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subspaceID := vars["id"]
+
+	if !orbitdb.IsValidSubspaceID(subspaceID) {
+		Error(w, "Invalid subspace ID", http.StatusBadRequest)
+		return
+	}
+
+	webhooks, err := h.store.ListSubspaceWebhooks(r.Context(), subspaceID)
+	if err != nil {
+		StoreError(w, err, "Failed to list subspace webhooks")
+		return
+	}
+
+	redacted := make([]*orbitdb.SubspaceWebhook, 0, len(webhooks))
+	for _, hook := range webhooks {
+		redacted = append(redacted, withoutSecret(hook))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subspace_id": subspaceID,
+		"webhooks":    redacted,
+	})
+}
+
+// SubspaceWebhookRequest is the body of a request to register a subspace webhook
+type SubspaceWebhookRequest struct {
+	URL           string   `json:"url"`            // Delivery URL
+	Secret        string   `json:"secret"`         // HMAC-SHA256 signing secret
+	Events        []string `json:"events"`         // Payload types to deliver, empty for all
+	VoteThreshold uint64   `json:"vote_threshold"` // Votes on a proposal that trigger vote.threshold_crossed
+}
+
+// CreateSubspaceWebhook handles requests to register a webhook for a subspace
+func (h *SubspaceWebhookHandlers) CreateSubspaceWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subspaceID := vars["id"]
+
+	if !orbitdb.IsValidSubspaceID(subspaceID) {
+		Error(w, "Invalid subspace ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData SubspaceWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if u, err := url.Parse(requestData.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		Error(w, "Invalid url, expected an http or https URL", http.StatusBadRequest)
+		return
+	}
+	if requestData.Secret == "" {
+		Error(w, "secret must not be empty", http.StatusBadRequest)
+		return
+	}
+	for _, payloadType := range requestData.Events {
+		if !webhook.IsSubspaceType(payloadType) {
+			Error(w, fmt.Sprintf("Unsupported event %q, expected one of %v", payloadType, webhook.SubspaceTypes), http.StatusBadRequest)
+			return
+		}
+		if payloadType == webhook.TypeVoteThresholdCrossed && requestData.VoteThreshold == 0 {
+			Error(w, "vote_threshold is required for vote.threshold_crossed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	hook := &orbitdb.SubspaceWebhook{
+		URL:           requestData.URL,
+		Secret:        requestData.Secret,
+		Events:        requestData.Events,
+		VoteThreshold: requestData.VoteThreshold,
+	}
+	if err := h.store.AddSubspaceWebhook(r.Context(), subspaceID, hook); err != nil {
+		StoreError(w, err, "Failed to register subspace webhook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(withoutSecret(hook))
+}
+
+// DeleteSubspaceWebhook handles requests to remove a webhook of a subspace
+func (h *SubspaceWebhookHandlers) DeleteSubspaceWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subspaceID := vars["id"]
+	webhookID := vars["webhook"]
+
+	if !orbitdb.IsValidSubspaceID(subspaceID) {
+		Error(w, "Invalid subspace ID", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.store.DeleteSubspaceWebhook(r.Context(), subspaceID, webhookID)
+	if err != nil {
+		StoreError(w, err, "Failed to delete subspace webhook")
+		return
+	}
+	if !deleted {
+		Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Helper function: copy a webhook without its secret
+func withoutSecret(hook *orbitdb.SubspaceWebhook) *orbitdb.SubspaceWebhook {
+	redacted := *hook
+	redacted.Secret = ""
+	return &redacted
+}
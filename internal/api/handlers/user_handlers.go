@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"container/heap"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -24,20 +27,47 @@ func NewUserHandlers(store storage.Store) *UserHandlers {
 	}
 }
 
-// GetUserStats handles user statistics requests
+// UserPeriodStats is the statistics of a user summed over the UTC days of a period
+type UserPeriodStats struct {
+	*orbitdb.UserStats
+	From int64 `json:"from"` // Unix timestamp of the start of the period
+	To   int64 `json:"to"`   // Unix timestamp of the end of the period
+}
+
+// GetUserStats handles user statistics requests. With from or to, the statistics are
+// summed over the UTC days of that period instead of the user's lifetime.
 func (h *UserHandlers) GetUserStats(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["id"]
 
+	from, to, windowed, msg := statsPeriod(r)
+	if msg != "" {
+		Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if windowed {
+		h.getUserPeriodStats(w, r, userID, from, to)
+		return
+	}
+
 	// Get user statistics
 	stats, err := h.store.GetUserStats(r.Context(), userID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get user statistics: %v", err), http.StatusInternalServerError)
+		StoreError(w, err, "Failed to get user statistics")
 		return
 	}
 
 	if stats == nil {
-		http.Error(w, "User statistics data does not exist", http.StatusNotFound)
+		Error(w, "User statistics data does not exist", http.StatusNotFound)
+		return
+	}
+
+	var invited uint64
+	if stats.InviteStats != nil {
+		invited = stats.InviteStats.TotalInvited
+	}
+	// Crediting an invite doesn't advance last_updated, so the invite count is part of the tag
+	if notModified(w, r, entityTag(stats.ID, stats.LastUpdated, invited)) {
 		return
 	}
 
@@ -46,6 +76,154 @@ func (h *UserHandlers) GetUserStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
+// MaxUserStatsBatch is the most users a batch statistics request may ask for
+const MaxUserStatsBatch = 500
+
+// UserStatsBatchRequest is the body of a batch user statistics request
+type UserStatsBatchRequest struct {
+	PubKeys []string `json:"pubkeys"` // Users to get the statistics of
+}
+
+// UserStatsBatch is the response of a batch user statistics request
+type UserStatsBatch struct {
+	Stats   map[string]*orbitdb.UserStats `json:"stats"`   // Statistics by public key
+	Missing []string                      `json:"missing"` // Requested users without statistics, in request order
+}
+
+// GetUserStatsBatch handles requests for the statistics of several users at once
+func (h *UserHandlers) GetUserStatsBatch(w http.ResponseWriter, r *http.Request) {
+	var requestData UserStatsBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if len(requestData.PubKeys) == 0 {
+		Error(w, "pubkeys must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(requestData.PubKeys) > MaxUserStatsBatch {
+		Error(w, fmt.Sprintf("Too many pubkeys, at most %d", MaxUserStatsBatch), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.store.GetUserStatsBatch(r.Context(), requestData.PubKeys)
+	if err != nil {
+		StoreError(w, err, "Failed to get user statistics")
+		return
+	}
+
+	batch := UserStatsBatch{Stats: stats, Missing: []string{}}
+	seen := make(map[string]bool, len(requestData.PubKeys))
+	for _, pubKey := range requestData.PubKeys {
+		if stats[pubKey] == nil && !seen[pubKey] {
+			batch.Missing = append(batch.Missing, pubKey)
+		}
+		seen[pubKey] = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch)
+}
+
+// getUserPeriodStats serves the statistics of a user over a period. Users without activity
+// in the period get zero counts.
+func (h *UserHandlers) getUserPeriodStats(w http.ResponseWriter, r *http.Request, userID string, from, to time.Time) {
+	stats, err := h.store.GetUserPeriodStats(r.Context(), userID, from, to)
+	if err != nil {
+		StoreError(w, err, "Failed to get user statistics")
+		return
+	}
+	if stats == nil {
+		stats = &orbitdb.UserStats{
+			ID:               userID,
+			DocType:          "user_stats",
+			TotalStats:       map[uint32]uint64{},
+			SubspaceStats:    map[string]map[uint32]uint64{},
+			CreatedSubspaces: []string{},
+			JoinedSubspaces:  []string{},
+		}
+	}
+	if notModified(w, r, entityTag(stats.ID, stats.LastUpdated, from.Unix(), to.Unix())) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UserPeriodStats{UserStats: stats, From: from.Unix(), To: to.Unix()})
+}
+
+// statsPeriod parses the from and to Unix timestamps bounding a statistics period. to
+// defaults to now and from to 30 days before it. windowed is false if neither is set; msg
+// describes an invalid period.
+func statsPeriod(r *http.Request) (from, to time.Time, windowed bool, msg string) {
+	query := r.URL.Query()
+	fromStr, toStr := query.Get("from"), query.Get("to")
+	if fromStr == "" && toStr == "" {
+		return time.Time{}, time.Time{}, false, ""
+	}
+
+	to = time.Now()
+	if toStr != "" {
+		t, err := strconv.ParseInt(toStr, 10, 64)
+		if err != nil {
+			return from, to, true, "Invalid to, expected a Unix timestamp"
+		}
+		to = time.Unix(t, 0)
+	}
+	from = to.Add(-30 * 24 * time.Hour)
+	if fromStr != "" {
+		f, err := strconv.ParseInt(fromStr, 10, 64)
+		if err != nil {
+			return from, to, true, "Invalid from, expected a Unix timestamp"
+		}
+		from = time.Unix(f, 0)
+	}
+	if to.Before(from) {
+		return from, to, true, "from must not be after to"
+	}
+	if to.Sub(from) > orbitdb.MaxUserStatsRange {
+		return from, to, true, fmt.Sprintf("Range too long, at most %d days", int(orbitdb.MaxUserStatsRange/(24*time.Hour)))
+	}
+	return from, to, true, ""
+}
+
+// GetUserProfile handles user profile requests
+func (h *UserHandlers) GetUserProfile(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	profile, err := h.store.GetUserProfile(r.Context(), userID)
+	if err != nil {
+		StoreError(w, err, "Failed to get user profile")
+		return
+	}
+	if profile == nil {
+		Error(w, "User profile does not exist", http.StatusNotFound)
+		return
+	}
+
+	if notModified(w, r, entityTag(profile.ID, profile.EventID)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// displayNames returns the profile names of users, by ID. Users without a profile name are
+// left out.
+func (h *UserHandlers) displayNames(ctx context.Context, userIDs []string) (map[string]string, error) {
+	profiles, err := h.store.GetUserProfiles(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(profiles))
+	for id, profile := range profiles {
+		if name := profile.Label(); name != "" {
+			names[id] = name
+		}
+	}
+	return names, nil
+}
+
 // GetUserSubspaces handles user subspace query requests
 func (h *UserHandlers) GetUserSubspaces(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -54,12 +232,12 @@ func (h *UserHandlers) GetUserSubspaces(w http.ResponseWriter, r *http.Request)
 	// Get user statistics
 	stats, err := h.store.GetUserStats(r.Context(), userID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get user statistics: %v", err), http.StatusInternalServerError)
+		StoreError(w, err, "Failed to get user statistics")
 		return
 	}
 
 	if stats == nil {
-		http.Error(w, "User statistics data does not exist", http.StatusNotFound)
+		Error(w, "User statistics data does not exist", http.StatusNotFound)
 		return
 	}
 
@@ -82,7 +260,7 @@ func (h *UserHandlers) GetUserInvites(w http.ResponseWriter, r *http.Request) {
 	// Get user statistics
 	stats, err := h.store.GetUserStats(r.Context(), userID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get user statistics: %v", err), http.StatusInternalServerError)
+		StoreError(w, err, "Failed to get user statistics")
 		return
 	}
 
@@ -102,34 +280,177 @@ func (h *UserHandlers) GetUserInvites(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats.InviteStats)
 }
 
-// GetSubspaceUsers handles user subspace query requests
+// PurgeUserData handles requests to remove all data of a user and reports what was removed
+func (h *UserHandlers) PurgeUserData(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	report, err := h.store.PurgeUser(r.Context(), userID)
+	if err != nil {
+		StoreError(w, err, "Failed to purge user data")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetSubspaceInviteGraph handles requests for the who-invited-whom edges of a subspace
+func (h *UserHandlers) GetSubspaceInviteGraph(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subspaceID := vars["id"]
+
+	graph, err := h.store.GetSubspaceInviteGraph(r.Context(), subspaceID)
+	if err != nil {
+		StoreError(w, err, "Failed to get invite graph")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(graph)
+}
+
+// GetUserInviteTree handles requests for the tree of users invited by a user. depth sets
+// how many levels below the user are expanded (default 3, at most 10).
+func (h *UserHandlers) GetUserInviteTree(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	depth := orbitdb.DefaultInviteTreeDepth
+	if depthStr := r.URL.Query().Get("depth"); depthStr != "" {
+		d, err := strconv.Atoi(depthStr)
+		if err != nil || d < 1 || d > orbitdb.MaxInviteTreeDepth {
+			Error(w, fmt.Sprintf("Invalid depth, expected 1 to %d", orbitdb.MaxInviteTreeDepth), http.StatusBadRequest)
+			return
+		}
+		depth = d
+	}
+
+	tree, err := h.store.GetInviteTree(r.Context(), userID, depth)
+	if err != nil {
+		StoreError(w, err, "Failed to get invite tree")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
+
+// NextCursorHeader carries the cursor of the next page of paginated listings, absent on the last page
+const NextCursorHeader = "X-Next-Cursor"
+
+// Payloads of the subspace user listing selected by the fields query parameter
+const (
+	SubspaceUserFieldsFull  = "full"
+	SubspaceUserFieldsLight = "light"
+)
+
+// SubspaceUser is a member of a subspace with their statistics in it
+type SubspaceUser struct {
+	ID             string                     `json:"id"`                     // User ID
+	DisplayName    string                     `json:"display_name,omitempty"` // Name from the user's profile, if they published one
+	JoinTime       *time.Time                 `json:"join_time,omitempty"`    // Time of the user's first create or join event, omitted if unknown
+	LastActiveTime time.Time                  `json:"last_active_time"`       // Last active time
+	TotalEvents    uint64                     `json:"total_events"`           // Total events in this subspace
+	EventBreakdown map[uint32]uint64          `json:"event_breakdown"`        // Event type distribution
+	VoteStats      *orbitdb.SubspaceVoteStats `json:"vote_stats,omitempty"`   // Voting statistics
+	HasInvited     bool                       `json:"has_invited"`            // Whether invited other users
+	InviteCount    uint64                     `json:"invite_count"`           // Invitation count
+}
+
+// SubspaceUserLight is a member of a subspace as listed with fields=light
+type SubspaceUserLight struct {
+	ID             string    `json:"id"`                     // User ID
+	DisplayName    string    `json:"display_name,omitempty"` // Name from the user's profile, if they published one
+	LastActiveTime time.Time `json:"last_active_time"`       // Last active time
+	TotalEvents    uint64    `json:"total_events"`           // Total events in this subspace
+}
+
+// GetSubspaceUsers handles user subspace query requests. Users are listed by ID in pages of
+// limit users (default 100); the X-Next-Cursor response header is passed as cursor to fetch
+// the next page. active_since keeps users active at or after a Unix timestamp and fields=light
+// returns only the ID, last activity and event count of each user.
 func (h *UserHandlers) GetSubspaceUsers(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	subspaceID := vars["id"]
 
+	// Parse pagination and filter parameters
+	params := r.URL.Query()
+	query := orbitdb.SubspaceUserQuery{
+		Limit:  100, // Default limit
+		Cursor: params.Get("cursor"),
+	}
+	if limitStr := params.Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			Error(w, "Invalid limit, expected a positive integer", http.StatusBadRequest)
+			return
+		}
+		query.Limit = l
+	}
+	if sinceStr := params.Get("active_since"); sinceStr != "" {
+		since, err := strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || since < 0 {
+			Error(w, "Invalid active_since, expected a Unix timestamp", http.StatusBadRequest)
+			return
+		}
+		query.ActiveSince = since
+	}
+	fields := params.Get("fields")
+	if fields == "" {
+		fields = SubspaceUserFieldsFull
+	}
+	if fields != SubspaceUserFieldsFull && fields != SubspaceUserFieldsLight {
+		Error(w, fmt.Sprintf("Invalid fields %q, expected %s or %s", fields, SubspaceUserFieldsFull, SubspaceUserFieldsLight), http.StatusBadRequest)
+		return
+	}
+
 	// Query subspace users
-	users, err := h.store.QueryUsersBySubspace(r.Context(), subspaceID)
+	users, nextCursor, err := h.store.QueryUsersBySubspace(r.Context(), subspaceID, query)
+	if err != nil {
+		StoreError(w, err, "Failed to query subspace users")
+		return
+	}
+	userIDs := make([]string, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.ID)
+	}
+	names, err := h.displayNames(r.Context(), userIDs)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to query subspace users: %v", err), http.StatusInternalServerError)
+		StoreError(w, err, "Failed to get user profiles")
 		return
 	}
+	if nextCursor != "" {
+		w.Header().Set(NextCursorHeader, nextCursor)
+	}
+
+	if fields == SubspaceUserFieldsLight {
+		lightUsers := make([]SubspaceUserLight, 0, len(users))
+		for _, user := range users {
+			var totalEvents uint64
+			for _, count := range user.SubspaceStats[subspaceID] {
+				totalEvents += count
+			}
+			lightUsers = append(lightUsers, SubspaceUserLight{
+				ID:             user.ID,
+				DisplayName:    names[user.ID],
+				LastActiveTime: time.Unix(user.LastUpdated, 0),
+				TotalEvents:    totalEvents,
+			})
+		}
 
-	// Construct simplified response data
-	type EnhancedUserInfo struct {
-		ID             string                     `json:"id"`                   // User ID
-		JoinTime       time.Time                  `json:"join_time"`            // Join time
-		LastActiveTime time.Time                  `json:"last_active_time"`     // Last active time
-		TotalEvents    uint64                     `json:"total_events"`         // Total events in this subspace
-		EventBreakdown map[uint32]uint64          `json:"event_breakdown"`      // Event type distribution
-		VoteStats      *orbitdb.SubspaceVoteStats `json:"vote_stats,omitempty"` // Voting statistics
-		HasInvited     bool                       `json:"has_invited"`          // Whether invited other users
-		InviteCount    uint64                     `json:"invite_count"`         // Invitation count
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(lightUsers)
+		return
 	}
 
-	enhancedUsers := make([]EnhancedUserInfo, 0, len(users))
+	enhancedUsers := make([]SubspaceUser, 0, len(users))
 	for _, user := range users {
-		// Find the earliest record of this user in this subspace to estimate join time
-		var earliestTimestamp int64
+		var joinTime *time.Time
+		if joined, exists := user.JoinTimestamps[subspaceID]; exists {
+			t := time.Unix(joined, 0)
+			joinTime = &t
+		}
 		var totalEvents uint64
 
 		// Get event type distribution for this subspace
@@ -139,19 +460,9 @@ func (h *UserHandlers) GetSubspaceUsers(w http.ResponseWriter, r *http.Request)
 			for eventType, count := range stats {
 				eventBreakdown[eventType] = count
 				totalEvents += count
-
-				// Find earliest timestamp
-				if earliestTimestamp == 0 || int64(count) < earliestTimestamp {
-					earliestTimestamp = int64(count)
-				}
 			}
 		}
 
-		// If no record found, use last update time
-		if earliestTimestamp == 0 {
-			earliestTimestamp = user.LastUpdated
-		}
-
 		// Get voting statistics
 		var voteStats *orbitdb.SubspaceVoteStats
 		if user.VoteStats != nil && user.VoteStats.SubspaceVotes != nil {
@@ -170,9 +481,10 @@ func (h *UserHandlers) GetSubspaceUsers(w http.ResponseWriter, r *http.Request)
 			}
 		}
 
-		enhancedUsers = append(enhancedUsers, EnhancedUserInfo{
+		enhancedUsers = append(enhancedUsers, SubspaceUser{
 			ID:             user.ID,
-			JoinTime:       time.Unix(earliestTimestamp, 0),
+			DisplayName:    names[user.ID],
+			JoinTime:       joinTime,
 			LastActiveTime: time.Unix(user.LastUpdated, 0),
 			TotalEvents:    totalEvents,
 			EventBreakdown: eventBreakdown,
@@ -306,12 +618,32 @@ func (h *UserHandlers) GetSubspaceUsers(w http.ResponseWriter, r *http.Request)
 // 	json.NewEncoder(w).Encode(userStats)
 // }
 
+// UserRanking is an entry of a user leaderboard
+type UserRanking struct {
+	ID             string            `json:"id"`
+	DisplayName    string            `json:"display_name,omitempty"`
+	TotalEvents    uint64            `json:"total_events"`
+	EventBreakdown map[uint32]uint64 `json:"event_breakdown"`
+	SubspaceCount  int               `json:"subspace_count"`
+	LastActive     time.Time         `json:"last_active"`
+}
+
 // ListTopUsers lists the most active users
 func (h *UserHandlers) ListTopUsers(w http.ResponseWriter, r *http.Request) {
+	h.listTopUsers(w, r, "")
+}
+
+// ListSubspaceTopUsers lists the most active users of a subspace, counting only their activity in it
+func (h *UserHandlers) ListSubspaceTopUsers(w http.ResponseWriter, r *http.Request) {
+	h.listTopUsers(w, r, mux.Vars(r)["id"])
+}
+
+// listTopUsers serves the global ranking, or the ranking of a subspace if subspaceID is set
+func (h *UserHandlers) listTopUsers(w http.ResponseWriter, r *http.Request, subspaceID string) {
 	// Get query parameters
 	query := r.URL.Query()
 	limitStr := query.Get("limit")
-	sortBy := query.Get("sort_by") // Can be "total_events", "votes", "invites", etc.
+	sortBy := query.Get("sort_by") // Can be "total_events", "votes" or "invites"
 
 	limit := 10 // Default limit
 	if limitStr != "" {
@@ -321,62 +653,59 @@ func (h *UserHandlers) ListTopUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if sortBy == "" {
-		sortBy = "total_events" // Default sort by total events
+		sortBy = orbitdb.LeaderboardTotalEvents // Default sort by total events
+	}
+	if !orbitdb.IsLeaderboardMetric(sortBy) {
+		Error(w, fmt.Sprintf("Invalid sort_by %q, must be total_events, votes or invites", sortBy), http.StatusBadRequest)
+		return
 	}
 
-	// Create filter function
-	filter := func(stats *orbitdb.UserStats) bool {
-		// More filter conditions can be added here
-		return true
+	from, to, windowed, msg := statsPeriod(r)
+	if msg != "" {
+		Error(w, msg, http.StatusBadRequest)
+		return
 	}
 
-	// Query all user statistics
-	users, err := h.store.QueryUserStats(r.Context(), filter)
+	var entries []*orbitdb.LeaderboardEntry
+	var err error
+	if windowed {
+		entries, err = h.periodTopUsers(r.Context(), subspaceID, sortBy, limit, from, to)
+	} else {
+		entries, err = h.topUsers(r.Context(), subspaceID, sortBy, limit)
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to query user statistics: %v", err), http.StatusInternalServerError)
+		StoreError(w, err, "Failed to query user statistics")
 		return
 	}
 
-	// Sort users based on sort field
-	switch sortBy {
-	case "total_events":
-		// Sort by total events
-		sortUsersByTotalEvents(users)
-	case "votes":
-		// Sort by votes
-		sortUsersByVotes(users)
-	case "invites":
-		// Sort by invites
-		sortUsersByInvites(users)
+	userIDs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		userIDs = append(userIDs, entry.UserID)
 	}
-
-	// Limit result count
-	if len(users) > limit {
-		users = users[:limit]
+	names, err := h.displayNames(r.Context(), userIDs)
+	if err != nil {
+		StoreError(w, err, "Failed to get user profiles")
+		return
 	}
 
-	// Construct response data
-	type UserRanking struct {
-		ID             string            `json:"id"`
-		TotalEvents    uint64            `json:"total_events"`
-		EventBreakdown map[uint32]uint64 `json:"event_breakdown"`
-		SubspaceCount  int               `json:"subspace_count"`
-		LastActive     time.Time         `json:"last_active"`
+	// Profile names change without user activity, so they are part of the tag
+	parts := make([]interface{}, 0, 3*len(entries))
+	for _, entry := range entries {
+		parts = append(parts, entry.UserID, entry.LastActive, names[entry.UserID])
+	}
+	if notModified(w, r, entityTag(parts...)) {
+		return
 	}
 
-	rankings := make([]UserRanking, 0, len(users))
-	for _, user := range users {
-		var totalEvents uint64
-		for _, count := range user.TotalStats {
-			totalEvents += count
-		}
-
+	rankings := make([]UserRanking, 0, len(entries))
+	for _, entry := range entries {
 		rankings = append(rankings, UserRanking{
-			ID:             user.ID,
-			TotalEvents:    totalEvents,
-			EventBreakdown: user.TotalStats,
-			SubspaceCount:  len(user.JoinedSubspaces),
-			LastActive:     time.Unix(user.LastUpdated, 0),
+			ID:             entry.UserID,
+			DisplayName:    names[entry.UserID],
+			TotalEvents:    entry.TotalEvents,
+			EventBreakdown: entry.EventBreakdown,
+			SubspaceCount:  entry.SubspaceCount,
+			LastActive:     time.Unix(entry.LastActive, 0),
 		})
 	}
 
@@ -385,63 +714,106 @@ func (h *UserHandlers) ListTopUsers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(rankings)
 }
 
-// Helper function: Sort by total events
-func sortUsersByTotalEvents(users []*orbitdb.UserStats) {
-	// Implement sorting logic
-	for i := 0; i < len(users)-1; i++ {
-		for j := i + 1; j < len(users); j++ {
-			var totalEventsI, totalEventsJ uint64
-			for _, count := range users[i].TotalStats {
-				totalEventsI += count
-			}
-			for _, count := range users[j].TotalStats {
-				totalEventsJ += count
+// topUsers reads a ranking from the materialized leaderboard. It falls back to ranking the
+// user statistics when the leaderboard has not been built yet or the limit exceeds its size.
+func (h *UserHandlers) topUsers(ctx context.Context, subspaceID, metric string, limit int) ([]*orbitdb.LeaderboardEntry, error) {
+	if limit <= orbitdb.LeaderboardSize {
+		leaderboard, err := h.store.GetLeaderboard(ctx, subspaceID)
+		if err != nil {
+			return nil, err
+		}
+		if leaderboard != nil {
+			ranking := leaderboard.Rankings[metric]
+			if len(ranking) > limit {
+				ranking = ranking[:limit]
 			}
+			return ranking, nil
+		}
+	}
 
-			// Sort in descending order
-			if totalEventsJ > totalEventsI {
-				users[i], users[j] = users[j], users[i]
-			}
+	// Keep only the top users while scanning instead of collecting and sorting all of them
+	top := newTopUsers(limit)
+	if subspaceID != "" {
+		users, _, err := h.store.QueryUsersBySubspace(ctx, subspaceID, orbitdb.SubspaceUserQuery{})
+		if err != nil {
+			return nil, err
 		}
+		for _, stats := range users {
+			top.offer(orbitdb.NewLeaderboardEntry(stats, metric, subspaceID))
+		}
+		return top.sorted(), nil
 	}
-}
 
-// Helper function: Sort by votes
-func sortUsersByVotes(users []*orbitdb.UserStats) {
-	for i := 0; i < len(users)-1; i++ {
-		for j := i + 1; j < len(users); j++ {
-			var votesI, votesJ uint64
-			if users[i].VoteStats != nil {
-				votesI = users[i].VoteStats.TotalVotes
-			}
-			if users[j].VoteStats != nil {
-				votesJ = users[j].VoteStats.TotalVotes
-			}
+	filter := func(stats *orbitdb.UserStats) bool {
+		top.offer(orbitdb.NewLeaderboardEntry(stats, metric, ""))
+		return false
+	}
+	if _, err := h.store.QueryUserStats(ctx, filter); err != nil {
+		return nil, err
+	}
+	return top.sorted(), nil
+}
 
-			// Sort in descending order
-			if votesJ > votesI {
-				users[i], users[j] = users[j], users[i]
-			}
-		}
+// periodTopUsers ranks the users by their activity over the UTC days of a period, from
+// their daily statistics
+func (h *UserHandlers) periodTopUsers(ctx context.Context, subspaceID, metric string, limit int, from, to time.Time) ([]*orbitdb.LeaderboardEntry, error) {
+	users, err := h.store.QueryPeriodStats(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	top := newTopUsers(limit)
+	for _, stats := range users {
+		top.offer(orbitdb.NewLeaderboardEntry(stats, metric, subspaceID))
 	}
+	return top.sorted(), nil
 }
 
-// Helper function: Sort by invites
-func sortUsersByInvites(users []*orbitdb.UserStats) {
-	for i := 0; i < len(users)-1; i++ {
-		for j := i + 1; j < len(users); j++ {
-			var invitesI, invitesJ uint64
-			if users[i].InviteStats != nil {
-				invitesI = users[i].InviteStats.TotalInvited
-			}
-			if users[j].InviteStats != nil {
-				invitesJ = users[j].InviteStats.TotalInvited
-			}
+// topUsers keeps the k highest ranked users in a bounded min-heap
+type topUsers struct {
+	k    int
+	heap entryHeap
+}
 
-			// Sort in descending order
-			if invitesJ > invitesI {
-				users[i], users[j] = users[j], users[i]
-			}
-		}
+// newTopUsers creates a top-k collector
+func newTopUsers(k int) *topUsers {
+	return &topUsers{k: k}
+}
+
+// offer adds an entry if it ranks among the top k seen so far. Users scoring zero are not ranked.
+func (t *topUsers) offer(entry *orbitdb.LeaderboardEntry) {
+	if entry.Score == 0 {
+		return
+	}
+	if len(t.heap) < t.k {
+		heap.Push(&t.heap, entry)
+		return
+	}
+	if t.heap[0].RanksBelow(entry) {
+		t.heap[0] = entry
+		heap.Fix(&t.heap, 0)
 	}
 }
+
+// sorted returns the collected entries, highest ranked first
+func (t *topUsers) sorted() []*orbitdb.LeaderboardEntry {
+	ranked := make([]*orbitdb.LeaderboardEntry, len(t.heap))
+	copy(ranked, t.heap)
+	sort.Slice(ranked, func(i, j int) bool {
+		return ranked[j].RanksBelow(ranked[i])
+	})
+	return ranked
+}
+
+// entryHeap is a min-heap of ranking entries, the lowest ranked entry is at the root
+type entryHeap []*orbitdb.LeaderboardEntry
+
+func (h entryHeap) Len() int            { return len(h) }
+func (h entryHeap) Less(i, j int) bool  { return h[i].RanksBelow(h[j]) }
+func (h entryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *entryHeap) Push(x interface{}) { *h = append(*h, x.(*orbitdb.LeaderboardEntry)) }
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListTopUsers(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewUserHandlers(mockStore)
+
+	// 50 users, user-N has N events; user-07 ties with user-48
+	var users []*orbitdb.UserStats
+	for i := 0; i < 50; i++ {
+		users = append(users, &orbitdb.UserStats{
+			ID:         fmt.Sprintf("user-%d", i),
+			TotalStats: map[uint32]uint64{1: uint64(i)},
+		})
+	}
+	users = append(users, &orbitdb.UserStats{ID: "user-07", TotalStats: map[uint32]uint64{1: 47, 7: 1}})
+
+	// Without a leaderboard the handler ranks users in the query filter, so feed every user through it
+	mockStore.On("GetLeaderboard", mock.Anything, "").Return(nil, nil)
+	mockStore.On("QueryUserStats", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		filter := args.Get(1).(func(*orbitdb.UserStats) bool)
+		for _, user := range users {
+			assert.False(t, filter(user))
+		}
+	}).Return([]*orbitdb.UserStats(nil), nil)
+	mockStore.On("GetUserProfiles", mock.Anything, mock.Anything).Return(map[string]*orbitdb.UserProfile{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/top?limit=4", nil)
+	w := httptest.NewRecorder()
+	handler.ListTopUsers(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var rankings []struct {
+		ID          string `json:"id"`
+		TotalEvents uint64 `json:"total_events"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rankings))
+	require.Len(t, rankings, 4)
+	assert.Equal(t, "user-49", rankings[0].ID)
+	assert.Equal(t, "user-07", rankings[1].ID) // Ties are ordered by ID
+	assert.Equal(t, "user-48", rankings[2].ID)
+	assert.Equal(t, "user-47", rankings[3].ID)
+	assert.Equal(t, uint64(48), rankings[1].TotalEvents)
+}
+
+func TestListSubspaceTopUsersFromLeaderboard(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewUserHandlers(mockStore)
+
+	leaderboard := &orbitdb.Leaderboard{
+		ID:         "leaderboard:subspace:0xabc",
+		SubspaceID: "0xabc",
+		Rankings: map[string][]*orbitdb.LeaderboardEntry{
+			orbitdb.LeaderboardVotes: {
+				{UserID: "alice", Score: 3, TotalEvents: 5},
+				{UserID: "bob", Score: 2, TotalEvents: 9},
+				{UserID: "carol", Score: 1, TotalEvents: 1},
+			},
+		},
+	}
+	mockStore.On("GetLeaderboard", mock.Anything, "0xabc").Return(leaderboard, nil)
+	mockStore.On("GetUserProfiles", mock.Anything, []string{"alice", "bob"}).Return(map[string]*orbitdb.UserProfile{
+		"alice": {PubKey: "alice", Name: "alice", DisplayName: "Alice"},
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/subspaces/0xabc/top?sort_by=votes&limit=2", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "0xabc"})
+	w := httptest.NewRecorder()
+	handler.ListSubspaceTopUsers(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var rankings []struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"display_name"`
+		TotalEvents uint64 `json:"total_events"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rankings))
+	require.Len(t, rankings, 2)
+	assert.Equal(t, "alice", rankings[0].ID)
+	assert.Equal(t, "Alice", rankings[0].DisplayName, "joined from the profile")
+	assert.Equal(t, "", rankings[1].DisplayName)
+	assert.Equal(t, uint64(9), rankings[1].TotalEvents)
+
+	// Served without scanning user statistics
+	mockStore.AssertNotCalled(t, "QueryUsersBySubspace", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestListTopUsersInvalidSort(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewUserHandlers(mockStore)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/top?sort_by=karma", nil)
+	w := httptest.NewRecorder()
+	handler.ListTopUsers(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockStore.AssertNotCalled(t, "QueryUserStats", mock.Anything, mock.Anything)
+}
+
+func TestGetSubspaceUsersPagination(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewUserHandlers(mockStore)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000a1"
+	users := []*orbitdb.UserStats{
+		{ID: "user-3", LastUpdated: 1700000300, SubspaceStats: map[string]map[uint32]uint64{sid: {30302: 2, 30303: 1}}},
+		{ID: "user-4", LastUpdated: 1700000400, SubspaceStats: map[string]map[uint32]uint64{sid: {30302: 1}}},
+	}
+	query := orbitdb.SubspaceUserQuery{Limit: 2, Cursor: "user-2", ActiveSince: 1700000000}
+	mockStore.On("QueryUsersBySubspace", mock.Anything, sid, query).Return(users, "user-4", nil)
+	mockStore.On("GetUserProfiles", mock.Anything, []string{"user-3", "user-4"}).Return(map[string]*orbitdb.UserProfile{
+		"user-4": {PubKey: "user-4", Name: "four"},
+	}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/subspaces/{id}/users", handler.GetSubspaceUsers)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/subspaces/"+sid+"/users?limit=2&cursor=user-2&active_since=1700000000&fields=light", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user-4", w.Header().Get(NextCursorHeader))
+
+	var page []map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page, 2)
+	assert.Equal(t, map[string]interface{}{
+		"id":               "user-3",
+		"last_active_time": page[0]["last_active_time"],
+		"total_events":     float64(3),
+	}, page[0])
+	assert.Equal(t, "four", page[1]["display_name"])
+	mockStore.AssertExpectations(t)
+
+	// Invalid parameters are rejected before querying
+	for _, params := range []string{"limit=0", "active_since=yesterday", "fields=partial"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/subspaces/"+sid+"/users?"+params, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, params)
+	}
+	mockStore.AssertNumberOfCalls(t, "QueryUsersBySubspace", 1)
+}
+
+func TestGetSubspaceUsersJoinTime(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewUserHandlers(mockStore)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000a2"
+	users := []*orbitdb.UserStats{
+		{ID: "joined", LastUpdated: 1700000900, JoinTimestamps: map[string]int64{sid: 1700000100}, SubspaceStats: map[string]map[uint32]uint64{sid: {30200: 1, 30300: 4}}},
+		{ID: "unknown", LastUpdated: 1700000900, SubspaceStats: map[string]map[uint32]uint64{sid: {30300: 1}}},
+	}
+	mockStore.On("QueryUsersBySubspace", mock.Anything, sid, orbitdb.SubspaceUserQuery{Limit: 100}).Return(users, "", nil)
+	mockStore.On("GetUserProfiles", mock.Anything, mock.Anything).Return(map[string]*orbitdb.UserProfile{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/subspaces/"+sid+"/users", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": sid})
+	w := httptest.NewRecorder()
+	handler.GetSubspaceUsers(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var page []struct {
+		ID       string     `json:"id"`
+		JoinTime *time.Time `json:"join_time"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page, 2)
+	require.NotNil(t, page[0].JoinTime)
+	assert.Equal(t, int64(1700000100), page[0].JoinTime.Unix(), "join time comes from the join event")
+	assert.Nil(t, page[1].JoinTime, "unknown join times are omitted")
+}
+
+// Test that user statistics carry an entity tag and unchanged statistics aren't sent again
+func TestGetUserStatsETag(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewUserHandlers(mockStore)
+	stats := &orbitdb.UserStats{ID: "user-a", LastUpdated: 1700000000}
+	mockStore.On("GetUserStats", mock.Anything, "user-a").Return(stats, nil)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/users/user-a/stats", nil), map[string]string{"id": "user-a"})
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.GetUserStats(w, req)
+		return w
+	}
+
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code)
+	tag := w.Header().Get("ETag")
+	require.NotEmpty(t, tag)
+	assert.Equal(t, "max-age=5", w.Header().Get("Cache-Control"))
+
+	w = get(tag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	stats.LastUpdated++
+	w = get(tag)
+	assert.Equal(t, http.StatusOK, w.Code, "updated statistics get a new tag")
+	assert.NotEqual(t, tag, w.Header().Get("ETag"))
+}
+
+func TestListFollowersPagination(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewUserHandlers(mockStore)
+	mockStore.On("ListFollows", mock.Anything, "alice", orbitdb.FollowFollowers).Return([]string{"bob", "carol", "dave"}, nil)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/users/{id}/followers", handler.ListFollowers)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/alice/followers?limit=2", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "carol", w.Header().Get(NextCursorHeader))
+
+	var page FollowPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, FollowPage{PubKey: "alice", Relation: orbitdb.FollowFollowers, Total: 3, Users: []string{"bob", "carol"}}, page)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/users/alice/followers?limit=2&cursor=carol", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(NextCursorHeader))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, []string{"dave"}, page.Users)
+}
+
+func TestGetUserStatsBatch(t *testing.T) {
+	mockStore := new(MockStore)
+	handler := NewUserHandlers(mockStore)
+	mockStore.On("GetUserStatsBatch", mock.Anything, []string{"user-a", "user-b", "user-a"}).Return(map[string]*orbitdb.UserStats{
+		"user-a": {ID: "user-a", TotalStats: map[uint32]uint64{1: 3}},
+	}, nil)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.GetUserStatsBatch(w, httptest.NewRequest(http.MethodPost, "/api/users/stats", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"pubkeys":["user-a","user-b","user-a"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var batch UserStatsBatch
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	require.Contains(t, batch.Stats, "user-a")
+	assert.Equal(t, uint64(3), batch.Stats["user-a"].TotalStats[1])
+	assert.Equal(t, []string{"user-b"}, batch.Missing)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"pubkeys":[]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"pubkeys":[`+strings.Repeat(`"x",`, MaxUserStatsBatch)+`"x"]}`).Code)
+	mockStore.AssertNumberOfCalls(t, "GetUserStatsBatch", 1)
+}
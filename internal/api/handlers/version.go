@@ -0,0 +1,23 @@
+package handlers
+
+import "context"
+
+// CurrentAPIVersion is the newest API version, served under /api/v1
+const CurrentAPIVersion = 1
+
+// apiVersionKey is the context key of the API version of a request
+type apiVersionKey struct{}
+
+// WithAPIVersion returns a context carrying the API version a request was made against
+func WithAPIVersion(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, apiVersionKey{}, version)
+}
+
+// APIVersion returns the API version a request was made against, so handlers can keep the
+// response shapes of older versions. Requests without one get CurrentAPIVersion.
+func APIVersion(ctx context.Context) int {
+	if version, ok := ctx.Value(apiVersionKey{}).(int); ok {
+		return version
+	}
+	return CurrentAPIVersion
+}
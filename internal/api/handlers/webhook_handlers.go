@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/webhook"
+)
+
+// WebhookHandlers handles webhook-related API requests
+type WebhookHandlers struct {
+	dispatcher *webhook.Dispatcher
+}
+
+// NewWebhookHandlers creates a new WebhookHandlers
+func NewWebhookHandlers(dispatcher *webhook.Dispatcher) *WebhookHandlers {
+	return &WebhookHandlers{
+		dispatcher: dispatcher,
+	}
+}
+
+// ListSchemas handles requests to list webhook payload types
+func (h *WebhookHandlers) ListSchemas(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"version": webhook.SchemaVersion,
+		"types":   webhook.Types,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSchema handles requests to get the JSON Schema of a webhook payload type
+func (h *WebhookHandlers) GetSchema(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	payloadType := vars["type"]
+
+	schema, err := webhook.Schema(payloadType)
+	if err != nil {
+		Error(w, fmt.Sprintf("Schema not found: %v", err), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(schema)
+}
+
+// TestDeliveryRequest is the body of a request to send a sample webhook payload
+type TestDeliveryRequest struct {
+	Type string `json:"type"` // Payload type, defaults to event.saved
+	URL  string `json:"url"`  // Restrict the delivery to one endpoint
+}
+
+// TestDelivery handles requests to send a sample payload to the configured endpoints
+func (h *WebhookHandlers) TestDelivery(w http.ResponseWriter, r *http.Request) {
+	var requestData TestDeliveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if requestData.Type == "" {
+		requestData.Type = webhook.TypeEventSaved
+	}
+
+	results, err := h.dispatcher.SendTest(r.Context(), requestData.Type, requestData.URL)
+	if err != nil {
+		Error(w, fmt.Sprintf("Failed to send test delivery: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":       requestData.Type,
+		"deliveries": results,
+	})
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// WebhookSubscriptionHandlers handles requests managing the webhook subscriptions to events
+// matching a filter
+type WebhookSubscriptionHandlers struct {
+	store storage.Store
+}
+
+// NewWebhookSubscriptionHandlers creates a new WebhookSubscriptionHandlers
+func NewWebhookSubscriptionHandlers(store storage.Store) *WebhookSubscriptionHandlers {
+	return &WebhookSubscriptionHandlers{
+		store: store,
+	}
+}
+
+// ListWebhookSubscriptions handles requests to list the webhook subscriptions. Secrets are not returned.
+func (h *WebhookSubscriptionHandlers) ListWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := h.store.ListWebhookSubscriptions(r.Context())
+	if err != nil {
+		StoreError(w, err, "Failed to list webhook subscriptions")
+		return
+	}
+
+	redacted := make([]*orbitdb.WebhookSubscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		redacted = append(redacted, subscriptionWithoutSecret(subscription))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subscriptions": redacted,
+	})
+}
+
+// WebhookSubscriptionRequest is the body of a request to register a webhook subscription
+type WebhookSubscriptionRequest struct {
+	URL    string       `json:"url"`    // Delivery URL
+	Secret string       `json:"secret"` // HMAC-SHA256 signing secret
+	Filter nostr.Filter `json:"filter"` // NIP-01 filter of the events delivered, empty for all
+}
+
+// CreateWebhookSubscription handles requests to register a webhook subscription
+func (h *WebhookSubscriptionHandlers) CreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	var requestData WebhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if u, err := url.Parse(requestData.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		Error(w, "Invalid url, expected an http or https URL", http.StatusBadRequest)
+		return
+	}
+	if requestData.Secret == "" {
+		Error(w, "secret must not be empty", http.StatusBadRequest)
+		return
+	}
+	// Deliveries are not paged, every matching event is sent
+	requestData.Filter.Limit = 0
+
+	subscription := &orbitdb.WebhookSubscription{
+		URL:    requestData.URL,
+		Secret: requestData.Secret,
+		Filter: requestData.Filter,
+	}
+	if err := h.store.AddWebhookSubscription(r.Context(), subscription); err != nil {
+		StoreError(w, err, "Failed to register webhook subscription")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscriptionWithoutSecret(subscription))
+}
+
+// DeleteWebhookSubscription handles requests to remove a webhook subscription
+func (h *WebhookSubscriptionHandlers) DeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.store.DeleteWebhookSubscription(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		StoreError(w, err, "Failed to delete webhook subscription")
+		return
+	}
+	if !deleted {
+		Error(w, "Webhook subscription not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Helper function: copy a webhook subscription without its secret
+func subscriptionWithoutSecret(subscription *orbitdb.WebhookSubscription) *orbitdb.WebhookSubscription {
+	redacted := *subscription
+	redacted.Secret = ""
+	return &redacted
+}
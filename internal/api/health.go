@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// HealthCheck is the outcome of one readiness check
+type HealthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"` // Why the check failed, or what it measured
+}
+
+// HealthReport is the outcome of every readiness check of the node
+type HealthReport struct {
+	Ready  bool                   `json:"ready"`  // Every check passed
+	Checks map[string]HealthCheck `json:"checks"` // Checks by name
+}
+
+// HealthChecker checks that the node can serve requests: its database answers a read, its
+// IPFS node has enough peers, replication isn't stalled and the warm-up is done
+type HealthChecker struct {
+	store storage.Store
+	cfg   config.HealthConfig
+	peers func(ctx context.Context) (int, error) // nil when there is no IPFS node
+	ready func() bool
+
+	mu          sync.Mutex
+	behindSince time.Time // When the node was first seen behind its peers, zero while caught up
+}
+
+// NewHealthChecker creates a health checker. ready reports whether the warm-up is done.
+func NewHealthChecker(store storage.Store, cfg config.HealthConfig, ready func() bool) *HealthChecker {
+	return &HealthChecker{store: store, cfg: cfg, ready: ready}
+}
+
+// Check runs every readiness check
+func (h *HealthChecker) Check(ctx context.Context, now time.Time) HealthReport {
+	if h.cfg.CheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.cfg.CheckTimeout)
+		defer cancel()
+	}
+
+	report := HealthReport{Ready: true, Checks: map[string]HealthCheck{
+		"database":    h.checkRead(ctx),
+		"replication": h.checkReplication(h.store.ReplicationStatus(), now),
+		"warmup":      {OK: h.ready()},
+	}}
+	if h.peers != nil {
+		report.Checks["peers"] = h.checkPeers(ctx)
+	}
+	for _, check := range report.Checks {
+		report.Ready = report.Ready && check.OK
+	}
+	return report
+}
+
+// checkRead reads one event, which fails if the database is closed or unreadable
+func (h *HealthChecker) checkRead(ctx context.Context) HealthCheck {
+	start := time.Now()
+	events, err := h.store.QueryEvents(ctx, nostr.Filter{Limit: 1})
+	if err != nil {
+		return HealthCheck{Detail: err.Error()}
+	}
+	for range events {
+	}
+	if err := ctx.Err(); err != nil {
+		return HealthCheck{Detail: fmt.Sprintf("read did not finish: %v", err)}
+	}
+	return HealthCheck{OK: true, Detail: fmt.Sprintf("read in %s", time.Since(start).Round(time.Millisecond))}
+}
+
+// checkPeers checks that the IPFS node is connected to at least the configured peers
+func (h *HealthChecker) checkPeers(ctx context.Context) HealthCheck {
+	n, err := h.peers(ctx)
+	if err != nil {
+		return HealthCheck{Detail: err.Error()}
+	}
+	return HealthCheck{OK: n >= h.cfg.MinPeers, Detail: fmt.Sprintf("%d peers, %d required", n, h.cfg.MinPeers)}
+}
+
+// checkReplication fails once the node has been behind its peers without replicating any
+// entry for longer than the configured stall
+func (h *HealthChecker) checkReplication(status *orbitdb.ReplicationStatus, now time.Time) HealthCheck {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if status.CaughtUp {
+		h.behindSince = time.Time{}
+		return HealthCheck{OK: true}
+	}
+	if h.behindSince.IsZero() {
+		h.behindSince = now
+	}
+
+	progress := h.behindSince
+	for _, store := range status.Stores {
+		if store.LastReplicated != nil && store.LastReplicated.After(progress) {
+			progress = *store.LastReplicated
+		}
+	}
+	stalled := now.Sub(progress)
+	if h.cfg.MaxReplicationStall > 0 && stalled > h.cfg.MaxReplicationStall {
+		return HealthCheck{Detail: fmt.Sprintf("no entries replicated for %s", stalled.Round(time.Second))}
+	}
+	return HealthCheck{OK: true, Detail: "catching up"}
+}
+
+// SetPeerCounter sets the function counting the peers of the IPFS node, checked against
+// health.min_peers. Peers aren't checked until it is called.
+func (r *Router) SetPeerCounter(peers func(ctx context.Context) (int, error)) {
+	r.health.peers = peers
+}
+
+// serveHealthReady handles deep readiness checks, answering 503 if any check fails
+func (r *Router) serveHealthReady(w http.ResponseWriter, req *http.Request) {
+	report := r.health.Check(req.Context(), time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
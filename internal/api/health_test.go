@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Test that the readiness probe fails while any check fails
+func TestHealthReady(t *testing.T) {
+	cfg := config.Default()
+	cfg.Health.MinPeers = 2
+	r := NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("health")), cfg)
+	handler := r.Handler()
+
+	// Without an IPFS node the peers aren't checked
+	w := serve(handler, http.MethodGet, "/api/health/ready", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var report HealthReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.True(t, report.Ready)
+	assert.True(t, report.Checks["database"].OK)
+	assert.NotContains(t, report.Checks, "peers")
+
+	peers := 1
+	r.SetPeerCounter(func(context.Context) (int, error) { return peers, nil })
+	w = serve(handler, http.MethodGet, "/api/health/ready", nil)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.False(t, report.Ready)
+	assert.Equal(t, HealthCheck{Detail: "1 peers, 2 required"}, report.Checks["peers"])
+
+	peers = 2
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/api/health/ready", nil).Code)
+}
+
+// Test that replication is stalled once the node is behind without progress for too long
+func TestHealthReplicationStall(t *testing.T) {
+	h := NewHealthChecker(nil, config.HealthConfig{MaxReplicationStall: time.Minute}, func() bool { return true })
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	behind := &orbitdb.ReplicationStatus{Stores: []orbitdb.StoreReplicationStatus{{Queued: 3}}}
+
+	assert.True(t, h.checkReplication(behind, start).OK)
+	assert.True(t, h.checkReplication(behind, start.Add(50*time.Second)).OK)
+	assert.False(t, h.checkReplication(behind, start.Add(2*time.Minute)).OK)
+
+	// Replicated entries count as progress
+	last := start.Add(110 * time.Second)
+	behind.Stores[0].LastReplicated = &last
+	assert.True(t, h.checkReplication(behind, start.Add(2*time.Minute)).OK)
+
+	// Catching up resets the stall
+	assert.True(t, h.checkReplication(&orbitdb.ReplicationStatus{CaughtUp: true}, start.Add(time.Hour)).OK)
+	behind.Stores[0].LastReplicated = nil
+	assert.True(t, h.checkReplication(behind, start.Add(time.Hour+time.Second)).OK)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// ListenUnix listens on a Unix domain socket at path with the given file permissions, so
+// co-located services can reach the API without a network port. A socket left behind by a
+// previous run is removed; any other file at path is an error. The socket file is removed
+// when the listener is closed.
+//
+// The socket is created in a private directory next to path and moved into place once its
+// permissions are set, so it is never reachable with looser permissions than mode.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	// MkdirTemp creates the directory with mode 0700
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket directory next to %s: %w", path, err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// The socket file moves, the listener removes it from its final path instead
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set permissions of socket %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to move socket to %s: %w", path, err)
+	}
+
+	return &unixListener{Listener: listener, path: path}, nil
+}
+
+// unixListener is a Unix socket listener removing its socket file from path when closed
+type unixListener struct {
+	net.Listener
+	path string
+}
+
+// Close closes the listener and removes the socket file
+func (l *unixListener) Close() error {
+	err := l.Listener.Close()
+	if rmErr := os.Remove(l.path); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = rmErr
+	}
+	return err
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// LiveConfigWatcher polls the replicated live configuration document and applies the latest
+// configuration signed by a trusted key, so fleet-wide policy changes reach every node
+// without a restart. A nil LiveConfigWatcher applies no live configuration.
+type LiveConfigWatcher struct {
+	store   storage.Store
+	cfg     config.LiveConfigConfig
+	current atomic.Pointer[orbitdb.LiveConfig]
+
+	stopPolling context.CancelFunc
+	done        chan struct{}
+}
+
+// NewLiveConfigWatcher creates a live configuration watcher. Returns nil, which applies no
+// live configuration, if no signers are configured.
+func NewLiveConfigWatcher(store storage.Store, cfg config.LiveConfigConfig) *LiveConfigWatcher {
+	if len(cfg.Signers) == 0 {
+		return nil
+	}
+	return &LiveConfigWatcher{store: store, cfg: cfg}
+}
+
+// Current returns the applied live configuration, nil if none is applied
+func (l *LiveConfigWatcher) Current() *orbitdb.LiveConfig {
+	if l == nil {
+		return nil
+	}
+	return l.current.Load()
+}
+
+// Refresh reads the live configuration document and applies it if it is newer than the
+// applied one. A document that isn't trusted leaves the applied configuration in place.
+func (l *LiveConfigWatcher) Refresh(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	latest, err := l.store.GetLiveConfig(ctx, l.cfg.Signers)
+	if err != nil || latest == nil {
+		return err
+	}
+	l.apply(latest)
+	return nil
+}
+
+// apply makes a configuration current unless the applied one is at least as new
+func (l *LiveConfigWatcher) apply(latest *orbitdb.LiveConfig) {
+	for {
+		current := l.current.Load()
+		if current != nil && current.Version >= latest.Version {
+			return
+		}
+		if l.current.CompareAndSwap(current, latest) {
+			zap.L().Info("Applied live configuration", zap.String("event", latest.EventID), zap.Int64("version", latest.Version),
+				zap.String("signer", latest.Signer))
+			return
+		}
+	}
+}
+
+// Start loads the live configuration, then polls for changes until Stop is called
+func (l *LiveConfigWatcher) Start(ctx context.Context) {
+	if l == nil {
+		return
+	}
+
+	if err := l.Refresh(ctx); err != nil {
+		zap.L().Warn("Failed to load live configuration", zap.Error(err))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	l.stopPolling = cancel
+	l.done = make(chan struct{})
+
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(l.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := l.Refresh(ctx); err != nil {
+					zap.L().Warn("Failed to refresh live configuration", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops polling for live configuration changes
+func (l *LiveConfigWatcher) Stop() {
+	if l == nil || l.stopPolling == nil {
+		return
+	}
+	l.stopPolling()
+	<-l.done
+}
+
+// Guard wraps an event write handler so it runs only if the live configuration allows it.
+// Writes are refused with 503 while the deployment is read-only, and saved events must
+// carry the required NIP-13 proof of work, otherwise they are refused with 403.
+func (l *LiveConfigWatcher) Guard(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := l.Current()
+		if current == nil {
+			next(w, r)
+			return
+		}
+		if current.ReadOnly {
+			handlers.WriteError(w, http.StatusServiceUnavailable, handlers.CodeWritesDisabled, "Writes are disabled by the live configuration")
+			return
+		}
+
+		if current.MinPoW > 0 && r.Method == http.MethodPost {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				handlers.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			var event struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(body, &event); err != nil {
+				handlers.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if nip13.Difficulty(event.ID) < current.MinPoW {
+				handlers.WriteError(w, http.StatusForbidden, handlers.CodeProofOfWork, fmt.Sprintf("Proof of work difficulty %d required", current.MinPoW))
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// ServeConfig handles requests for the applied live configuration
+func (l *LiveConfigWatcher) ServeConfig(w http.ResponseWriter, r *http.Request) {
+	if l == nil {
+		handlers.Error(w, "Live configuration is disabled", http.StatusNotFound)
+		return
+	}
+
+	current := l.Current()
+	if current == nil {
+		handlers.Error(w, "No live configuration published", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// ServePublish handles publishing a signed live configuration event. The configuration is
+// applied on this node at once and on the others when they next poll.
+func (l *LiveConfigWatcher) ServePublish(w http.ResponseWriter, r *http.Request) {
+	if l == nil {
+		handlers.Error(w, "Live configuration is disabled", http.StatusNotFound)
+		return
+	}
+
+	var event nostr.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		handlers.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	published, err := l.store.PublishLiveConfig(r.Context(), &event, l.cfg.Signers)
+	if err != nil {
+		// Invalid and outdated configurations get their own status and code
+		handlers.StoreError(w, err, "Failed to publish live configuration")
+		return
+	}
+	l.apply(published)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(published)
+}
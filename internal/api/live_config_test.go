@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Test that a signed live configuration is published, replicated through the store and enforced
+func TestLiveConfigPublishAndGuard(t *testing.T) {
+	ctx := context.Background()
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("live-config"))
+
+	signerKey := nostr.GeneratePrivateKey()
+	signer, err := nostr.GetPublicKey(signerKey)
+	require.NoError(t, err)
+	cfg := config.Default().LiveConfig
+	cfg.Signers = []string{signer}
+
+	configEvent := func(key string, createdAt nostr.Timestamp, content string) []byte {
+		event := &nostr.Event{
+			Kind:      orbitdb.LiveConfigKind,
+			CreatedAt: createdAt,
+			Tags:      nostr.Tags{{"d", orbitdb.LiveConfigTag}},
+			Content:   content,
+		}
+		require.NoError(t, event.Sign(key))
+		body, err := json.Marshal(event)
+		require.NoError(t, err)
+		return body
+	}
+	publish := func(watcher *LiveConfigWatcher, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		watcher.ServePublish(w, httptest.NewRequest(http.MethodPost, "/api/admin/config/live", strings.NewReader(string(body))))
+		return w
+	}
+
+	publisher := NewLiveConfigWatcher(store, cfg)
+	follower := NewLiveConfigWatcher(store, cfg)
+
+	// Only trusted signers may publish
+	assert.Equal(t, http.StatusBadRequest, publish(publisher, configEvent(nostr.GeneratePrivateKey(), 1700000000, `{"read_only":true}`)).Code)
+
+	w := publish(publisher, configEvent(signerKey, 1700000000, `{"flags":{"new-feed":true},"min_pow":8}`))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.True(t, publisher.Current().Flag("new-feed"))
+
+	// Other nodes pick the configuration up from the store
+	assert.Nil(t, follower.Current())
+	require.NoError(t, follower.Refresh(ctx))
+	require.NotNil(t, follower.Current())
+	assert.Equal(t, 8, follower.Current().MinPoW)
+
+	// Older configurations are refused
+	assert.Equal(t, http.StatusConflict, publish(publisher, configEvent(signerKey, 1699999999, `{}`)).Code)
+
+	handler := follower.Guard(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	save := func(id string) int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(`{"id":"`+id+`"}`)))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusForbidden, save(strings.Repeat("f", 64)))
+	assert.Equal(t, http.StatusCreated, save("00"+strings.Repeat("f", 62)))
+
+	// Writes stop everywhere once the deployment is made read-only
+	require.Equal(t, http.StatusCreated, publish(publisher, configEvent(signerKey, 1700000100, `{"read_only":true}`)).Code)
+	require.NoError(t, follower.Refresh(ctx))
+	assert.Equal(t, http.StatusServiceUnavailable, save("00"+strings.Repeat("f", 62)))
+}
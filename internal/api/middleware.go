@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+)
+
+// RequestIDHeader carries the ID of a request, taken from the client or generated, and is
+// echoed in the response
+const RequestIDHeader = "X-Request-ID"
+
+// clientRequestID matches the request IDs accepted from clients, other IDs are replaced
+var clientRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Context key of the request ID
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request a context belongs to, empty outside requests
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Helper function: generate a random request ID
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// requestIDs gives every request an ID, keeping a well-formed one sent by the client so
+// requests can be traced across nodes and proxies
+func requestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !clientRequestID.MatchString(id) {
+			id = newRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// recoveryResponseWriter records whether the response header was sent
+type recoveryResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoveryResponseWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoveryResponseWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap returns the wrapped writer, so handlers can flush streamed responses
+func (w *recoveryResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// recoverPanics turns a panicking handler into a 500 error response, instead of a dropped
+// connection, and logs the panic with its stack. A panic after the response started
+// aborts the response, as net/http does.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryResponseWriter{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			zap.L().Error("Panic serving request", zap.String("request_id", RequestID(r.Context())), zap.String("method", r.Method),
+				zap.String("path", r.URL.Path), zap.Any("panic", recovered), zap.Stack("stack"))
+			if rw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			handlers.WriteError(w, http.StatusInternalServerError, handlers.CodeInternal, "Internal server error")
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// accessLog logs every request once it is served, with its status, response size and
+// latency
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &usageResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			fields := []zap.Field{
+				zap.String("request_id", RequestID(r.Context())),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int("status", rw.status),
+				zap.Uint64("bytes", rw.bytes),
+				zap.Duration("latency", time.Since(start)),
+				zap.String("remote", r.RemoteAddr),
+			}
+			// Link slow requests in the log to their trace
+			if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+				fields = append(fields, zap.String("trace_id", span.TraceID().String()))
+			}
+			zap.L().Info("Request", fields...)
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// withDeadline bounds the request context by timeout, so the storage calls of a request,
+// which all take its context, give up instead of holding the request open
+func withDeadline(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// traceRoutes names the span of a request after its route, such as "GET /api/events/{id}",
+// so traces of the same endpoint group together whatever the path parameters
+func traceRoutes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + template)
+				span.SetAttributes(attribute.String("http.route", template))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
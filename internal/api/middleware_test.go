@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+)
+
+func TestRequestIDs(t *testing.T) {
+	var seen string
+	handler := requestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	assert.Len(t, seen, 16)
+	assert.Equal(t, seen, w.Header().Get(RequestIDHeader))
+
+	// Well-formed client IDs are kept, others replaced
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	req.Header.Set(RequestIDHeader, "trace-1234")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "trace-1234", seen)
+	assert.Equal(t, "trace-1234", w.Header().Get(RequestIDHeader))
+
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NotEqual(t, "bad id\n", seen)
+	assert.Len(t, seen, 16)
+}
+
+func TestRecoverPanics(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/events", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	var body handlers.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, handlers.CodeInternal, body.Error.Code)
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "boom", logs.All()[0].ContextMap()["panic"])
+
+	// A panic after the response started aborts it
+	handler = recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/events", nil))
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	handler := requestIDs(accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.Error(w, "missing", http.StatusNotFound)
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/api/events/abc", nil)
+	req.Header.Set(RequestIDHeader, "trace-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "trace-1", fields["request_id"])
+	assert.Equal(t, http.MethodGet, fields["method"])
+	assert.Equal(t, "/api/events/abc", fields["path"])
+	assert.Equal(t, int64(http.StatusNotFound), fields["status"])
+	assert.Positive(t, fields["bytes"])
+	assert.Contains(t, fields, "latency")
+}
+
+func TestWithDeadline(t *testing.T) {
+	assert.NotNil(t, withDeadline(0, http.NotFoundHandler()))
+
+	var deadline time.Time
+	var ok bool
+	handler := withDeadline(time.Minute, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/events", nil))
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	// Storage calls cut short by the deadline are reported as timeouts
+	w := httptest.NewRecorder()
+	handlers.StoreError(w, context.DeadlineExceeded, "Failed to query events")
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), handlers.CodeTimeout)
+}
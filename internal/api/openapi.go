@@ -0,0 +1,869 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/graphql"
+	"github.com/hetu-project/cRelay-crdt-db/internal/webhook"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Paths of the API description and its browsable documentation
+const (
+	OpenAPIPath = "/openapi.json"
+	DocsPath    = "/docs"
+)
+
+// queryParam documents a query parameter of a route
+type queryParam struct {
+	name        string
+	typ         string // JSON Schema type of the value: string, integer or boolean
+	description string
+}
+
+// routeDoc documents a route. Bodies are described by the Go types the handlers decode and
+// encode, so the description follows the handlers when their types change.
+type routeDoc struct {
+	summary    string
+	tag        string
+	query      []queryParam
+	request    reflect.Type // JSON request body, nil if the route takes none
+	status     int          // Success status, 200 if unset
+	response   reflect.Type // JSON response body, nil if the response has none
+	media      []string     // Other media types of the response, see alternateContent
+	nextCursor bool         // Whether the response may carry NextCursorHeader
+	admin      bool         // Whether the route needs the admin credentials
+	operator   bool         // Whether the route needs a NIP-98 signature of a subspace operator
+	signed     bool         // Whether the route needs a NIP-98 signature of any user
+}
+
+// Query parameters shared by several routes
+var (
+	limitParam   = queryParam{"limit", "integer", "Maximum number of results"}
+	cursorParam  = queryParam{"cursor", "string", "Cursor of the next page, from the " + handlers.NextCursorHeader + " response header"}
+	includeParam = queryParam{"include", "string", "Comma-separated extras to include: " + handlers.IncludeAnnotations}
+	mutedParam   = queryParam{handlers.IncludeMutedParam, "boolean", "true to keep the events of authors muted by the moderators"}
+	topParams    = append([]queryParam{limitParam, {"sort_by", "string", "Ranking metric: total_events, votes or invites (default total_events)"}}, periodParams...)
+	rangeParams  = []queryParam{
+		{"granularity", "string", "Bucket size: hour or day (default day)"},
+		{"from", "integer", "Unix timestamp of the start of the range"},
+		{"to", "integer", "Unix timestamp of the end of the range (default now)"},
+	}
+	periodParams = []queryParam{
+		{"from", "integer", "Unix timestamp of the start of the period, counted in whole UTC days (default 30 days before to)"},
+		{"to", "integer", "Unix timestamp of the end of the period (default now); without from or to, lifetime totals are used"},
+	}
+)
+
+// filterType stands for the event filter, which has its own schema, see filterSchema
+var filterType = reflect.TypeFor[nostr.Filter]()
+
+// routeDocs documents every route, keyed by method and path template. The router test
+// fails for routes missing here.
+var routeDocs = map[string]routeDoc{
+	// Events
+	"POST /api/events": {
+		summary: "Save a signed event. Causally stale events get 409, or 202 when quarantined, with the stale keys.",
+		tag:     "events", request: reflect.TypeFor[nostr.Event](), status: http.StatusCreated,
+	},
+	"POST /api/events/simulate": {
+		summary: "Dry-run an event, reporting the causality and statistics changes saving it would make",
+		tag:     "events", request: reflect.TypeFor[nostr.Event](), response: reflect.TypeFor[orbitdb.SimulationResult](),
+	},
+	"GET /api/events/{id}": {
+		summary: "Get an event", tag: "events", query: []queryParam{includeParam},
+		response: reflect.TypeFor[nostr.Event](),
+	},
+	"POST /api/events/query": {
+		summary: "Query events matching a filter",
+		tag:     "events", query: []queryParam{limitParam, includeParam, mutedParam}, request: filterType,
+		response: reflect.TypeFor[[]nostr.Event](), media: []string{handlers.NDJSONContentType},
+	},
+	"POST /api/events/query/federated": {
+		summary: "Query events matching a filter on this node and its peers, deduplicated",
+		tag:     "events", query: []queryParam{limitParam, includeParam, mutedParam}, request: filterType,
+		response: reflect.TypeFor[[]nostr.Event](), media: []string{handlers.NDJSONContentType},
+	},
+	"POST /api/events/count": {
+		summary: "Count events matching a filter, in the style of NIP-45",
+		tag:     "events", query: []queryParam{mutedParam}, request: filterType,
+		response: reflect.TypeFor[struct {
+			Count int `json:"count"`
+		}](),
+	},
+	"GET /api/events/{id}/xrefs": {
+		summary: "Get the cross-subspace references of an event", tag: "events",
+		response: reflect.TypeFor[orbitdb.EventXrefs](),
+	},
+	"GET /api/events/{id}/thread": {
+		summary: "Get the reply tree containing an event, from the root its e and parent tags lead to", tag: "events",
+		query:    []queryParam{{"depth", "integer", "Reply levels below the root (default 10, at most 50)"}},
+		response: reflect.TypeFor[orbitdb.EventThread](),
+	},
+	"GET /api/events/{id}/annotations": {
+		summary: "List the annotations of an event", tag: "events",
+		response: reflect.TypeFor[struct {
+			EventID     string                     `json:"event_id"`
+			Annotations []*orbitdb.EventAnnotation `json:"annotations"`
+		}](),
+	},
+	"POST /api/events/{id}/annotations": {
+		summary: "Annotate an event", tag: "events",
+		request: reflect.TypeFor[handlers.AnnotationRequest](), status: http.StatusCreated,
+		response: reflect.TypeFor[orbitdb.EventAnnotation](), signed: true,
+	},
+	"DELETE /api/events/{id}/annotations/{annotation}": {
+		summary: "Delete an annotation of an event, by its author or an operator of the event's subspace",
+		tag:     "events", status: http.StatusNoContent, signed: true,
+	},
+
+	// Subspaces
+	"GET /api/subspaces": {
+		summary: "List subspaces, or look them up by name",
+		tag:     "subspaces",
+		query: []queryParam{
+			{"name", "string", "Subspace name to look up; the response is then a list of subspace metadata"},
+			{"since", "integer", "Only subspaces updated at or after this Unix timestamp"},
+			{"until", "integer", "Only subspaces updated at or before this Unix timestamp"},
+		},
+		response: reflect.TypeFor[[]*orbitdb.SubspaceCausality](),
+	},
+	"GET /api/subspaces/top": {
+		summary: "Rank subspaces by recent activity",
+		tag:     "subspaces",
+		query: []queryParam{
+			{"window", "string", "Period counted, a duration such as 24h (default 24h)"},
+			{"sort_by", "string", "Ranking metric: events, users or votes (default events)"},
+			limitParam,
+		},
+		response: reflect.TypeFor[struct {
+			Window    string                     `json:"window"`
+			SortBy    string                     `json:"sort_by"`
+			Subspaces []*orbitdb.SubspaceRanking `json:"subspaces"`
+		}](),
+	},
+	"GET /api/subspaces/{id}": {
+		summary: "Get the causality and metadata of a subspace", tag: "subspaces",
+		response: reflect.TypeFor[handlers.SubspaceResponse](),
+	},
+	"GET /api/subspaces/{id}/events": {
+		summary: "List the events of a subspace in the order they were recorded, in pages", tag: "subspaces",
+		query:    []queryParam{limitParam, cursorParam, includeParam},
+		response: reflect.TypeFor[[]nostr.Event](), media: []string{handlers.NDJSONContentType}, nextCursor: true,
+	},
+	"GET /api/subspaces/{id}/stats": {
+		summary: "Get the all-time aggregate statistics of a subspace", tag: "subspaces",
+		response: reflect.TypeFor[orbitdb.SubspaceStats](),
+	},
+	"GET /api/subspaces/{id}/causality/graph": {
+		summary: "Get the event dependency graph of a subspace", tag: "subspaces",
+		query:    []queryParam{{"format", "string", "json (default) or dot for Graphviz"}},
+		response: reflect.TypeFor[orbitdb.CausalityGraph](), media: []string{"text/vnd.graphviz"},
+	},
+	"GET /api/subspaces/{id}/keys": {
+		summary: "List the causality keys of a subspace", tag: "subspaces",
+		query: []queryParam{limitParam, {"offset", "integer", "Number of keys to skip"}},
+		response: reflect.TypeFor[struct {
+			SubspaceID string                  `json:"subspace_id"`
+			Total      int                     `json:"total"`
+			Offset     int                     `json:"offset"`
+			Limit      int                     `json:"limit"`
+			Keys       []*orbitdb.CausalityKey `json:"keys"`
+		}](),
+	},
+	"GET /api/subspaces/{id}/keys/{key}": {
+		summary: "Get the counter of a causality key; key * lists every key like /keys", tag: "subspaces",
+		response: reflect.TypeFor[struct {
+			SubspaceID string `json:"subspace_id"`
+			Key        uint64 `json:"key"`
+			Counter    uint64 `json:"counter"`
+		}](),
+	},
+	"GET /api/subspaces/{id}/users": {
+		summary: "List the members of a subspace, in pages",
+		tag:     "subspaces",
+		query: []queryParam{
+			limitParam, cursorParam,
+			{"active_since", "integer", "Only users active at or after this Unix timestamp"},
+			{"fields", "string", "full (default) or light; light lists only ID, last activity and event count"},
+		},
+		response: reflect.TypeFor[[]handlers.SubspaceUser](), nextCursor: true,
+	},
+	"GET /api/subspaces/{id}/invite-graph": {
+		summary: "Get the invite graph of a subspace", tag: "subspaces",
+		response: reflect.TypeFor[orbitdb.InviteGraph](),
+	},
+	"GET /api/subspaces/{id}/activity": {
+		summary: "Get the activity histogram of a subspace", tag: "subspaces",
+		query: rangeParams, response: activityType,
+	},
+	"GET /api/subspaces/{id}/top": {
+		summary: "Rank the users of a subspace by their activity in it", tag: "subspaces",
+		query: topParams, response: reflect.TypeFor[[]handlers.UserRanking](),
+	},
+	"GET /api/subspaces/{id}/proposals": {
+		summary: "List the proposals of a subspace, newest first", tag: "proposals",
+		query: []queryParam{{"status", "string", "Only proposals with this status: open, passed, rejected or expired"}},
+		response: reflect.TypeFor[struct {
+			SubspaceID string              `json:"subspace_id"`
+			Proposals  []*orbitdb.Proposal `json:"proposals"`
+		}](),
+	},
+	"GET /api/subspaces/{id}/moderation": {
+		summary: "List the users banned from a subspace and the events hidden in it", tag: "subspaces",
+		response: reflect.TypeFor[orbitdb.SubspaceModeration](),
+	},
+	"PUT /api/subspaces/{id}/bans/{pubkey}": {
+		summary: "Ban a user from a subspace, refusing their events and hiding them from queries", tag: "subspaces",
+		request: reflect.TypeFor[handlers.ModerationRequest](), status: http.StatusNoContent, operator: true,
+	},
+	"DELETE /api/subspaces/{id}/bans/{pubkey}": {
+		summary: "Lift the ban of a user from a subspace", tag: "subspaces",
+		status: http.StatusNoContent, operator: true,
+	},
+	"PUT /api/subspaces/{id}/hidden/{event_id}": {
+		summary: "Hide an event of a subspace from queries", tag: "subspaces",
+		request: reflect.TypeFor[handlers.ModerationRequest](), status: http.StatusNoContent, operator: true,
+	},
+	"DELETE /api/subspaces/{id}/hidden/{event_id}": {
+		summary: "Show a hidden event of a subspace again", tag: "subspaces",
+		status: http.StatusNoContent, operator: true,
+	},
+	"GET /api/proposals/{id}": {
+		summary: "Get a proposal with its vote tally", tag: "proposals",
+		response: reflect.TypeFor[orbitdb.Proposal](),
+	},
+
+	// Users
+	"POST /api/users/stats": {
+		summary: "Get the statistics of several users at once", tag: "users",
+		request:  reflect.TypeFor[handlers.UserStatsBatchRequest](),
+		response: reflect.TypeFor[handlers.UserStatsBatch](),
+	},
+	"GET /api/users/{id}/stats": {
+		summary: "Get the statistics of a user, over their lifetime or a period", tag: "users",
+		query: periodParams, response: reflect.TypeFor[orbitdb.UserStats](),
+	},
+	"GET /api/users/{id}/profile": {
+		summary: "Get the profile a user published in kind 0 metadata", tag: "users",
+		response: reflect.TypeFor[orbitdb.UserProfile](),
+	},
+	"GET /api/users/{id}/following": {
+		summary: "List the users a user follows, from their kind 3 contact list, in pages", tag: "users",
+		query:    []queryParam{limitParam, cursorParam},
+		response: reflect.TypeFor[handlers.FollowPage](), nextCursor: true,
+	},
+	"GET /api/users/{id}/followers": {
+		summary: "List the users following a user, in pages", tag: "users",
+		query:    []queryParam{limitParam, cursorParam},
+		response: reflect.TypeFor[handlers.FollowPage](), nextCursor: true,
+	},
+	"GET /api/users/{id}/mutuals": {
+		summary: "List the users a user follows that follow them back, in pages", tag: "users",
+		query:    []queryParam{limitParam, cursorParam},
+		response: reflect.TypeFor[handlers.FollowPage](), nextCursor: true,
+	},
+	"GET /api/users/{id}/subspaces": {
+		summary: "List the subspaces a user created and joined", tag: "users",
+		response: reflect.TypeFor[struct {
+			CreatedSubspaces []string `json:"created_subspaces"`
+			JoinedSubspaces  []string `json:"joined_subspaces"`
+		}](),
+	},
+	"GET /api/users/{id}/invites": {
+		summary: "Get the invitation statistics of a user", tag: "users",
+		response: reflect.TypeFor[orbitdb.InviteStats](),
+	},
+	"GET /api/users/{id}/invite-tree": {
+		summary: "Get the tree of users invited by a user", tag: "users",
+		query:    []queryParam{{"depth", "integer", "Levels expanded below the user (default 3)"}},
+		response: reflect.TypeFor[orbitdb.InviteTreeNode](),
+	},
+	"GET /api/users/{id}/activity": {
+		summary: "Get the activity histogram of a user", tag: "users",
+		query: rangeParams, response: activityType,
+	},
+	"DELETE /api/users/{id}/data": {
+		summary: "Purge the events and statistics of a user", tag: "users",
+		response: reflect.TypeFor[orbitdb.UserPurgeReport](), admin: true,
+	},
+	"GET /api/users/top": {
+		summary: "Rank users by activity", tag: "users",
+		query: topParams, response: reflect.TypeFor[[]handlers.UserRanking](),
+	},
+
+	// GraphQL
+	"GET /api/graphql": {
+		summary: "Run a GraphQL query passed as the query, operationName and variables parameters", tag: "graphql",
+		query: []queryParam{
+			{"query", "string", "GraphQL query document"},
+			{"operationName", "string", "Operation to run, for documents with several"},
+			{"variables", "string", "Variable values, a JSON object"},
+		},
+		response: reflect.TypeFor[graphql.Response](),
+	},
+	"POST /api/graphql": {
+		summary: "Run a GraphQL query over events, users, subspaces and proposals", tag: "graphql",
+		request: reflect.TypeFor[graphql.Request](), response: reflect.TypeFor[graphql.Response](),
+	},
+
+	// Admin
+	"GET /api/admin/usage": {
+		summary: "Get the daily usage of API keys",
+		tag:     "admin",
+		query: []queryParam{
+			{"from", "string", "First day, YYYY-MM-DD"},
+			{"to", "string", "Last day, YYYY-MM-DD"},
+			{"key_id", "string", "Only this API key"},
+		},
+		response: reflect.TypeFor[[]*orbitdb.APIUsage](), admin: true,
+	},
+	"GET /api/admin/queries": {
+		summary: "Get the query limiter statistics", tag: "admin",
+		response: reflect.TypeFor[QueryLimiterStats](), admin: true,
+	},
+	"GET /api/admin/ratelimit": {
+		summary: "Get the write limiter statistics", tag: "admin",
+		response: reflect.TypeFor[WriteLimiterStats](), admin: true,
+	},
+	"GET /api/admin/cache": {
+		summary: "Get the response cache statistics", tag: "admin",
+		response: reflect.TypeFor[ResponseCacheStats](), admin: true,
+	},
+	"GET /api/admin/storage/forecast": {
+		summary: "Report storage use and forecast its growth",
+		tag:     "admin",
+		query: []queryParam{
+			{"window_days", "integer", "Days of history the growth rate is measured over"},
+			{"horizons", "string", "Comma-separated forecast horizons in days, e.g. 30,90,365"},
+			{"limit", "integer", "Maximum number of subspaces reported"},
+		},
+		response: reflect.TypeFor[orbitdb.StorageForecast](), admin: true,
+	},
+	"POST /api/admin/backup": {
+		summary: "Export the docstore as a JSONL archive", tag: "admin",
+		media: []string{handlers.NDJSONContentType}, admin: true,
+	},
+	"POST /api/admin/restore": {
+		summary: "Import a JSONL archive made by backup", tag: "admin",
+		response: reflect.TypeFor[struct {
+			Restored int `json:"restored"`
+		}](),
+		admin: true,
+	},
+	"DELETE /api/admin/events/{id}": {
+		summary: "Delete an event", tag: "admin", status: http.StatusNoContent, admin: true,
+	},
+	"POST /api/admin/rebuild": {
+		summary: "Rebuild the derived data from the stored events", tag: "admin",
+		response: reflect.TypeFor[orbitdb.RebuildResult](), admin: true,
+	},
+	"POST /api/admin/backfill": {
+		summary: "Pull historical events from external Nostr relays", tag: "admin",
+		request: reflect.TypeFor[handlers.BackfillRequest](), response: reflect.TypeFor[orbitdb.BackfillReport](), admin: true,
+	},
+	"GET /api/admin/derived": {
+		summary: "Get the derived data queue statistics", tag: "admin",
+		response: reflect.TypeFor[orbitdb.DerivedDataStats](), admin: true,
+	},
+	"GET /api/admin/policy": {
+		summary: "List the event policies in force", tag: "admin",
+		response: reflect.TypeFor[[]orbitdb.EventPolicyInfo](), admin: true,
+	},
+	"GET /api/admin/retention": {
+		summary: "Get the retention sweeper statistics", tag: "admin",
+		response: reflect.TypeFor[RetentionStats](), admin: true,
+	},
+	"POST /api/admin/compact": {
+		summary: "Snapshot and compact the event log", tag: "admin",
+		response: reflect.TypeFor[orbitdb.SnapshotResult](), admin: true,
+	},
+	"GET /api/admin/snapshots": {
+		summary: "Get the automatic snapshot statistics", tag: "admin",
+		response: reflect.TypeFor[SnapshotStats](), admin: true,
+	},
+	"GET /api/admin/quarantine": {
+		summary: "List the quarantined causally stale events", tag: "admin",
+		response: reflect.TypeFor[[]*orbitdb.QuarantinedEvent](), admin: true,
+	},
+	"DELETE /api/admin/quarantine/{id}": {
+		summary: "Drop a quarantined event", tag: "admin", status: http.StatusNoContent, admin: true,
+	},
+	"POST /api/admin/config/live": {
+		summary: "Publish a signed live configuration event", tag: "admin",
+		request: reflect.TypeFor[nostr.Event](), status: http.StatusCreated,
+		response: reflect.TypeFor[orbitdb.LiveConfig](), admin: true,
+	},
+	"GET /api/admin/migration": {
+		summary: "Get the status of the database migration", tag: "admin",
+		response: reflect.TypeFor[orbitdb.MigrationStatus](), admin: true,
+	},
+	"POST /api/admin/migration/backfill": {
+		summary: "Start copying the documents to the new database", tag: "admin",
+		status: http.StatusAccepted, admin: true,
+	},
+	"POST /api/admin/migration/flip": {
+		summary: "Switch reads to the new database", tag: "admin",
+		response: reflect.TypeFor[orbitdb.MigrationStatus](), admin: true,
+	},
+
+	// Webhooks
+	"GET /api/webhooks/schemas": {
+		summary: "List the webhook payload types", tag: "webhooks",
+		response: reflect.TypeFor[struct {
+			Version string   `json:"version"`
+			Types   []string `json:"types"`
+		}](),
+	},
+	"GET /api/webhooks/schemas/{type}": {
+		summary: "Get the JSON Schema of a webhook payload type", tag: "webhooks",
+		media: []string{"application/schema+json"},
+	},
+	"GET /api/webhooks": {
+		summary: "List the webhook subscriptions to events matching a filter", tag: "webhooks",
+		response: reflect.TypeFor[struct {
+			Subscriptions []*orbitdb.WebhookSubscription `json:"subscriptions"`
+		}](),
+	},
+	"POST /api/webhooks": {
+		summary: "Subscribe a URL to the saved and replicated events matching a filter, delivered by this node", tag: "webhooks",
+		request: reflect.TypeFor[handlers.WebhookSubscriptionRequest](), status: http.StatusCreated,
+		response: reflect.TypeFor[orbitdb.WebhookSubscription](), admin: true,
+	},
+	"DELETE /api/webhooks/{id}": {
+		summary: "Delete a webhook subscription", tag: "webhooks", status: http.StatusNoContent, admin: true,
+	},
+	"POST /api/webhooks/test": {
+		summary: "Send a sample payload to the configured endpoints", tag: "webhooks",
+		request: reflect.TypeFor[handlers.TestDeliveryRequest](),
+		response: reflect.TypeFor[struct {
+			Type       string                    `json:"type"`
+			Deliveries []*webhook.DeliveryResult `json:"deliveries"`
+		}](), admin: true,
+	},
+	"GET /api/subspaces/{id}/webhooks": {
+		summary: "List the webhooks of a subspace, without their secrets", tag: "webhooks",
+		response: reflect.TypeFor[struct {
+			SubspaceID string                     `json:"subspace_id"`
+			Webhooks   []*orbitdb.SubspaceWebhook `json:"webhooks"`
+		}](),
+	},
+	"POST /api/subspaces/{id}/webhooks": {
+		summary: "Register a webhook for a subspace, delivered by this node", tag: "webhooks",
+		request: reflect.TypeFor[handlers.SubspaceWebhookRequest](), status: http.StatusCreated,
+		response: reflect.TypeFor[orbitdb.SubspaceWebhook](), operator: true,
+	},
+	"DELETE /api/subspaces/{id}/webhooks/{webhook}": {
+		summary: "Delete a webhook of a subspace", tag: "webhooks", status: http.StatusNoContent, operator: true,
+	},
+
+	// Node
+	"GET /api/config/live": {
+		summary: "Get the live configuration applied by this node", tag: "node",
+		response: reflect.TypeFor[orbitdb.LiveConfig](),
+	},
+	"GET /api/status": {
+		summary: "Get the identity, databases, documents held and uptime of this node", tag: "node",
+		response: reflect.TypeFor[NodeStatus](),
+	},
+	"GET /api/status/replication": {
+		summary: "Get the replication progress of this node", tag: "node",
+		response: reflect.TypeFor[orbitdb.ReplicationStatus](),
+	},
+	"GET " + WellKnownPath: {
+		summary: "Describe the databases this node serves, for other nodes to open", tag: "node",
+		response: reflect.TypeFor[WellKnownDocument](),
+	},
+	"GET /api/health": {
+		summary: "Health check", tag: "node", media: []string{"text/plain"},
+	},
+	"GET /api/health/ready": {
+		summary: "Readiness probe, 503 unless the database, peers, replication and warm-up checks pass", tag: "node",
+		response: reflect.TypeFor[HealthReport](),
+	},
+	"GET /api/ready": {
+		summary: "Readiness check, 503 while the node warms up", tag: "node", media: []string{"text/plain"},
+	},
+}
+
+// activityType is the response of the activity histograms
+var activityType = reflect.TypeFor[struct {
+	Scope       string                   `json:"scope"`
+	ID          string                   `json:"id"`
+	Granularity string                   `json:"granularity"`
+	From        int64                    `json:"from"`
+	To          int64                    `json:"to"`
+	Buckets     []*orbitdb.ActivityPoint `json:"buckets"`
+}]()
+
+// openAPISchema is a JSON Schema as used by OpenAPI 3.1
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Minimum              *int                      `json:"minimum,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	PatternProperties    map[string]*openAPISchema `json:"patternProperties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+}
+
+// schemaBuilder derives schemas from Go types the way encoding/json encodes them. Named
+// struct types become components referenced by $ref.
+type schemaBuilder struct {
+	components map[string]*openAPISchema
+	names      map[reflect.Type]string
+}
+
+// Special cased types
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+	bytesType      = reflect.TypeFor[[]byte]()
+)
+
+// schema returns the schema of a type
+func (b *schemaBuilder) schema(t reflect.Type) *openAPISchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &openAPISchema{}
+	case bytesType:
+		return &openAPISchema{Type: "string", Format: "byte"}
+	case filterType:
+		return b.component(t, filterSchema)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &openAPISchema{Type: "integer", Format: integerFormat(t)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0
+		return &openAPISchema{Type: "integer", Format: integerFormat(t), Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &openAPISchema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		return b.component(t, func() *openAPISchema { return b.object(t) })
+	}
+	// Interfaces hold any JSON value
+	return &openAPISchema{}
+}
+
+// integerFormat returns the OpenAPI format of an integer type
+func integerFormat(t reflect.Type) string {
+	if t.Bits() > 32 {
+		return "int64"
+	}
+	return "int32"
+}
+
+// component registers a named type as a component and returns a reference to it. The
+// reference is registered before the schema is built, so recursive types terminate.
+func (b *schemaBuilder) component(t reflect.Type, build func() *openAPISchema) *openAPISchema {
+	name, ok := b.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := b.components[name]; taken {
+			// Types of different packages may share a name
+			name = path.Base(t.PkgPath()) + "." + name
+		}
+		b.names[t] = name
+		b.components[name] = nil
+		b.components[name] = build()
+	}
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+// object returns the schema of a struct type
+func (b *schemaBuilder) object(t reflect.Type) *openAPISchema {
+	s := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	b.addFields(s, t)
+	sort.Strings(s.Required)
+	return s
+}
+
+// addFields adds the fields of a struct type to an object schema, inlining embedded
+// structs as encoding/json does
+func (b *schemaBuilder) addFields(s *openAPISchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			b.addFields(s, fieldType)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if strings.Contains(options, "string") {
+			s.Properties[name] = &openAPISchema{Type: "string"}
+		} else {
+			s.Properties[name] = b.schema(field.Type)
+		}
+		if !strings.Contains(options, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// filterSchema is the schema of the event filter of the query and count endpoints, a
+// NIP-01 filter with the sid and parent tags and #<tag> filters on any other tag
+func filterSchema() *openAPISchema {
+	zero := 0
+	values := &openAPISchema{Type: "array", Items: &openAPISchema{Type: "string"}}
+	timestamp := &openAPISchema{Type: "integer", Format: "int64", Description: "Unix timestamp"}
+	return &openAPISchema{
+		Type:        "object",
+		Description: "Events matching every field given",
+		Properties: map[string]*openAPISchema{
+			"ids":     values,
+			"authors": values,
+			"kinds":   {Type: "array", Items: &openAPISchema{Type: "integer", Minimum: &zero}},
+			"since":   timestamp,
+			"until":   timestamp,
+			"limit":   {Type: "integer", Minimum: &zero, Description: "Maximum number of events, capped by the limit query parameter"},
+			"sid":     {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "Subspace IDs"},
+			"parent":  {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "Causal parent event IDs"},
+		},
+		PatternProperties: map[string]*openAPISchema{
+			"^#.+$": {Type: "array", Items: &openAPISchema{Type: "string"}, Description: "Values of the tag named after #"},
+		},
+	}
+}
+
+// routeParam matches the variables of a path template
+var routeParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// buildOpenAPI describes the routes of a router as an OpenAPI 3.1 document. API routes are
+// described under their versioned /api/v1 paths. It also returns the routes missing from
+// routeDocs, which are described without a summary or bodies.
+func buildOpenAPI(router *mux.Router) (map[string]interface{}, []string) {
+	b := &schemaBuilder{components: map[string]*openAPISchema{}, names: map[reflect.Type]string{}}
+	errorSchema := b.schema(reflect.TypeFor[handlers.ErrorResponse]())
+	paths := map[string]map[string]interface{}{}
+	tags := map[string]bool{}
+	var undocumented []string
+
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Path prefixes of subrouters
+			return nil
+		}
+
+		documented := template
+		if rest, ok := strings.CutPrefix(template, "/api/"); ok {
+			documented = fmt.Sprintf("/api/v%d/%s", handlers.CurrentAPIVersion, rest)
+		}
+		documented = routeParam.ReplaceAllString(documented, "{$1}")
+		if paths[documented] == nil {
+			paths[documented] = map[string]interface{}{}
+		}
+
+		for _, method := range methods {
+			key := method + " " + template
+			doc, ok := routeDocs[key]
+			if !ok {
+				undocumented = append(undocumented, key)
+			}
+			if doc.tag != "" {
+				tags[doc.tag] = true
+			}
+			paths[documented][strings.ToLower(method)] = b.operation(doc, template, errorSchema)
+		}
+		return nil
+	})
+
+	tagList := make([]map[string]string, 0, len(tags))
+	for tag := range tags {
+		tagList = append(tagList, map[string]string{"name": tag})
+	}
+	sort.Slice(tagList, func(i, j int) bool { return tagList[i]["name"] < tagList[j]["name"] })
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]string{
+			"title":   "cRelay CRDT DB API",
+			"version": strconv.Itoa(handlers.CurrentAPIVersion),
+			"description": fmt.Sprintf("Routes are also served without the /api/v%d prefix, under /api, for older "+
+				"clients; those responses are flagged with a Deprecation header.", handlers.CurrentAPIVersion),
+		},
+		"tags":  tagList,
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.components,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]string{"type": "apiKey", "in": "header", "name": APIKeyHeader},
+				"nip98": map[string]string{"type": "apiKey", "in": "header", "name": "Authorization",
+					"description": "NIP-98 signed event: Nostr <base64 event>"},
+			},
+		},
+	}, undocumented
+}
+
+// operation describes a route
+func (b *schemaBuilder) operation(doc routeDoc, template string, errorSchema *openAPISchema) map[string]interface{} {
+	var parameters []map[string]interface{}
+	for _, match := range routeParam.FindAllStringSubmatch(template, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": &openAPISchema{Type: "string"},
+		})
+	}
+	for _, param := range doc.query {
+		parameters = append(parameters, map[string]interface{}{
+			"name": param.name, "in": "query", "description": param.description, "schema": &openAPISchema{Type: param.typ},
+		})
+	}
+
+	status := doc.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	content := map[string]interface{}{}
+	if doc.response != nil {
+		content["application/json"] = map[string]interface{}{"schema": b.schema(doc.response)}
+	}
+	for _, media := range doc.media {
+		content[media] = map[string]interface{}{"schema": alternateContent(media)}
+	}
+	if len(content) > 0 {
+		success["content"] = content
+	}
+	if doc.nextCursor {
+		success["headers"] = map[string]interface{}{
+			handlers.NextCursorHeader: map[string]interface{}{
+				"description": "Cursor of the next page, absent on the last page",
+				"schema":      &openAPISchema{Type: "string"},
+			},
+		}
+	}
+
+	operation := map[string]interface{}{
+		"responses": map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": errorSchema}},
+			},
+		},
+	}
+	if doc.summary != "" {
+		operation["summary"] = doc.summary
+	}
+	if doc.tag != "" {
+		operation["tags"] = []string{doc.tag}
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	if doc.request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": b.schema(doc.request)}},
+		}
+	}
+	if doc.admin {
+		operation["security"] = []map[string][]string{{"apiKey": {}}, {"nip98": {}}}
+	}
+	if doc.operator || doc.signed {
+		operation["security"] = []map[string][]string{{"nip98": {}}}
+	}
+	return operation
+}
+
+// alternateContent returns the schema of a response in another media type than JSON.
+// NDJSON streams carry the elements of the JSON array one per line, other types are opaque.
+func alternateContent(media string) *openAPISchema {
+	if media == handlers.NDJSONContentType {
+		return &openAPISchema{Type: "string", Description: "One JSON value per line"}
+	}
+	return &openAPISchema{Type: "string"}
+}
+
+// serveOpenAPI returns a handler serving the OpenAPI description of a router's routes
+func serveOpenAPI(router *mux.Router) http.HandlerFunc {
+	document, _ := buildOpenAPI(router)
+	body, err := json.Marshal(document)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			handlers.Error(w, fmt.Sprintf("Failed to describe the API: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
+
+// docsPage renders the OpenAPI description with Swagger UI
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>cRelay CRDT DB API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "` + OpenAPIPath + `", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`
+
+// serveDocs handles requests for the API documentation
+func serveDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	cfg := config.Default()
+	cfg.OrbitDB.Directory = t.TempDir()
+	cfg.Publish.WellKnown = true
+	router := NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("openapi")), cfg).routes()
+
+	_, undocumented := buildOpenAPI(router)
+	assert.Empty(t, undocumented, "add the routes to routeDocs")
+
+	// Every documented route exists
+	routes := map[string]bool{}
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			routes[method+" "+template] = true
+		}
+		return nil
+	})
+	for key := range routeDocs {
+		assert.True(t, routes[key], "routeDocs documents missing route %s", key)
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	b := &schemaBuilder{components: map[string]*openAPISchema{}, names: map[reflect.Type]string{}}
+
+	type node struct {
+		Name     string  `json:"name"`
+		Children []*node `json:"children,omitempty"`
+		Skipped  string  `json:"-"`
+		hidden   string
+	}
+	ref := b.schema(reflect.TypeFor[*node]())
+	assert.Equal(t, "#/components/schemas/node", ref.Ref)
+	s := b.components["node"]
+	require.NotNil(t, s)
+	assert.Equal(t, []string{"name"}, s.Required)
+	assert.Equal(t, ref.Ref, s.Properties["children"].Items.Ref, "recursive types reference themselves")
+	assert.NotContains(t, s.Properties, "Skipped")
+	assert.NotContains(t, s.Properties, "hidden")
+
+	// Embedded structs are inlined
+	type wrapper struct {
+		*node
+		Extra uint32 `json:"extra"`
+	}
+	b.schema(reflect.TypeFor[wrapper]())
+	s = b.components["wrapper"]
+	require.NotNil(t, s)
+	assert.Contains(t, s.Properties, "name")
+	assert.Equal(t, "integer", s.Properties["extra"].Type)
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	cfg := config.Default()
+	cfg.OrbitDB.Directory = t.TempDir()
+	handler := NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("openapi")), cfg).Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var document struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+	assert.Equal(t, "3.1.0", document.OpenAPI)
+	assert.Contains(t, document.Paths["/api/v1/events/{id}"], "get")
+	assert.Contains(t, document.Paths["/api/v1/admin/usage"], "get")
+	assert.NotContains(t, document.Paths, OpenAPIPath)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, DocsPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), OpenAPIPath)
+}
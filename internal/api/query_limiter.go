@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+)
+
+// ErrQueryQueueTimeout is returned when a query waited longer than the queue timeout for a slot
+var ErrQueryQueueTimeout = errors.New("timed out waiting for a query slot")
+
+// QueryLimiter bounds the number of concurrent full-scan queries so bursts of heavy
+// queries can't starve event writes and replication of CPU. Queries beyond the limit
+// queue for a slot until the queue timeout expires. A nil QueryLimiter admits everything.
+type QueryLimiter struct {
+	slots   chan struct{}
+	timeout time.Duration
+
+	active    atomic.Int64
+	waiting   atomic.Int64
+	admitted  atomic.Uint64
+	queued    atomic.Uint64
+	rejected  atomic.Uint64
+	waitNanos atomic.Int64
+}
+
+// QueryLimiterStats describes the saturation of the query limiter
+type QueryLimiterStats struct {
+	MaxConcurrent int     `json:"max_concurrent"` // Maximum concurrent queries, 0 for unlimited
+	Active        int64   `json:"active"`         // Queries running now
+	Waiting       int64   `json:"waiting"`        // Queries queued now
+	Admitted      uint64  `json:"admitted"`       // Queries admitted since start
+	Queued        uint64  `json:"queued"`         // Admitted or rejected queries that had to wait for a slot
+	Rejected      uint64  `json:"rejected"`       // Queries rejected after the queue timeout
+	TotalWaitMsec int64   `json:"total_wait_ms"`  // Time spent waiting for slots
+	Saturation    float64 `json:"saturation"`     // Active queries as a fraction of the maximum
+}
+
+// NewQueryLimiter creates a limiter admitting maxConcurrent queries at a time.
+// Returns nil, which admits everything, if maxConcurrent is not positive.
+func NewQueryLimiter(maxConcurrent int, timeout time.Duration) *QueryLimiter {
+	if maxConcurrent <= 0 {
+		return nil
+	}
+	return &QueryLimiter{
+		slots:   make(chan struct{}, maxConcurrent),
+		timeout: timeout,
+	}
+}
+
+// Acquire waits for a query slot. The returned function releases the slot.
+func (l *QueryLimiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	// Fast path without queueing
+	select {
+	case l.slots <- struct{}{}:
+		return l.admit(), nil
+	default:
+	}
+
+	l.queued.Add(1)
+	l.waiting.Add(1)
+	start := time.Now()
+	defer func() {
+		l.waiting.Add(-1)
+		l.waitNanos.Add(int64(time.Since(start)))
+	}()
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.admit(), nil
+	case <-timer.C:
+		l.rejected.Add(1)
+		return nil, ErrQueryQueueTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// admit records an admitted query and returns its release function
+func (l *QueryLimiter) admit() func() {
+	l.admitted.Add(1)
+	l.active.Add(1)
+
+	var released atomic.Bool
+	return func() {
+		if released.CompareAndSwap(false, true) {
+			l.active.Add(-1)
+			<-l.slots
+		}
+	}
+}
+
+// Limit wraps a handler so it runs only while holding a query slot. Requests that time
+// out in the queue get 503 Service Unavailable.
+func (l *QueryLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, err := l.Acquire(r.Context())
+		if err != nil {
+			if errors.Is(err, ErrQueryQueueTimeout) {
+				w.Header().Set("Retry-After", "1")
+				handlers.WriteError(w, http.StatusServiceUnavailable, handlers.CodeOverloaded, "Too many concurrent queries, try again later")
+			}
+			// Otherwise the client has gone away
+			return
+		}
+		defer release()
+
+		next(w, r)
+	}
+}
+
+// Stats returns the current limiter statistics
+func (l *QueryLimiter) Stats() QueryLimiterStats {
+	if l == nil {
+		return QueryLimiterStats{}
+	}
+
+	stats := QueryLimiterStats{
+		MaxConcurrent: cap(l.slots),
+		Active:        l.active.Load(),
+		Waiting:       l.waiting.Load(),
+		Admitted:      l.admitted.Load(),
+		Queued:        l.queued.Load(),
+		Rejected:      l.rejected.Load(),
+		TotalWaitMsec: time.Duration(l.waitNanos.Load()).Milliseconds(),
+	}
+	stats.Saturation = float64(stats.Active) / float64(stats.MaxConcurrent)
+	return stats
+}
+
+// ServeStats handles requests for the limiter statistics
+func (l *QueryLimiter) ServeStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.Stats())
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that queries beyond the limit queue and time out
+func TestQueryLimiter(t *testing.T) {
+	limiter := NewQueryLimiter(1, 20*time.Millisecond)
+	ctx := context.Background()
+
+	release, err := limiter.Acquire(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), limiter.Stats().Active)
+	assert.Equal(t, 1.0, limiter.Stats().Saturation)
+
+	// The second query waits for the slot and gives up
+	_, err = limiter.Acquire(ctx)
+	assert.ErrorIs(t, err, ErrQueryQueueTimeout)
+
+	// A queued query gets the slot once it is released
+	done := make(chan error)
+	go func() {
+		second, err := limiter.Acquire(ctx)
+		if err == nil {
+			second()
+		}
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return limiter.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+	release()
+	release() // Releasing twice has no effect
+	assert.NoError(t, <-done)
+
+	stats := limiter.Stats()
+	assert.Equal(t, int64(0), stats.Active)
+	assert.Equal(t, uint64(2), stats.Admitted)
+	assert.Equal(t, uint64(2), stats.Queued)
+	assert.Equal(t, uint64(1), stats.Rejected)
+}
+
+// Test that a saturated limiter rejects requests with 503
+func TestQueryLimiterMiddleware(t *testing.T) {
+	limiter := NewQueryLimiter(1, 10*time.Millisecond)
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	called := false
+	handler := limiter.Limit(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/api/events/query", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.False(t, called)
+
+	// Without a limit everything is admitted
+	var unlimited *QueryLimiter
+	assert.Nil(t, NewQueryLimiter(0, time.Second))
+	w = httptest.NewRecorder()
+	unlimited.Limit(func(w http.ResponseWriter, r *http.Request) { called = true })(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, called)
+}
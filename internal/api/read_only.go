@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// readPosts are the POST routes that only read, served by read-only nodes like GET routes
+var readPosts = map[string]bool{
+	"/api/events/query":           true,
+	"/api/events/query/federated": true,
+	"/api/events/count":           true,
+	"/api/events/simulate":        true,
+	"/api/users/stats":            true,
+}
+
+// ReadOnlyGuard keeps a follower node from writing to the database it replicates: reads are
+// served locally, writes are rejected with 405 Method Not Allowed or forwarded to the primary
+// node. A nil ReadOnlyGuard lets every request through.
+type ReadOnlyGuard struct {
+	primary *httputil.ReverseProxy // nil when writes are rejected
+	timeout time.Duration
+	reads   map[string]bool // POST routes served locally
+}
+
+// NewReadOnlyGuard creates the guard of a read-only node. Returns nil, which allows writes,
+// unless read-only mode is enabled.
+func NewReadOnlyGuard(cfg config.ReadOnlyConfig) *ReadOnlyGuard {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	guard := &ReadOnlyGuard{timeout: cfg.Timeout, reads: map[string]bool{}}
+	for path := range readPosts {
+		guard.reads[path] = true
+	}
+	if cfg.Primary != "" {
+		// Validated by config.Validate
+		primary, _ := url.Parse(cfg.Primary)
+		guard.primary = &httputil.ReverseProxy{
+			Rewrite: func(req *httputil.ProxyRequest) {
+				req.SetURL(primary)
+				req.SetXForwarded()
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				zap.L().Warn("Failed to forward write to the primary", zap.String("request_id", RequestID(r.Context())),
+					zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Error(err))
+				handlers.Error(w, "Primary node unavailable", http.StatusBadGateway)
+			},
+		}
+	}
+	return guard
+}
+
+// Allow serves POST requests to path locally, for routes that don't write to the database
+// of this node. Must be called before Middleware.
+func (g *ReadOnlyGuard) Allow(path string) {
+	if g != nil {
+		g.reads[path] = true
+	}
+}
+
+// isWrite reports whether a request may change the database
+func (g *ReadOnlyGuard) isWrite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	case http.MethodPost:
+		return !g.reads[r.URL.Path]
+	}
+	return true
+}
+
+// Middleware serves reads and rejects or forwards writes. Forwarded requests keep their
+// headers, so API keys work on the primary if it accepts them; NIP-98 signatures cover the
+// URL of this node and are only accepted if the primary's auth.url matches it.
+func (g *ReadOnlyGuard) Middleware(next http.Handler) http.Handler {
+	if g == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !g.isWrite(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if g.primary == nil {
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+			handlers.Error(w, "Read-only node", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), g.timeout)
+		defer cancel()
+		g.primary.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
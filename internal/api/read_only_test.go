@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+func TestReadOnlyGuardRejectsWrites(t *testing.T) {
+	guard := NewReadOnlyGuard(config.ReadOnlyConfig{Enabled: true})
+	handler := guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/api/events/abc", http.StatusTeapot},
+		{http.MethodPost, "/api/events/query", http.StatusTeapot},
+		{http.MethodPost, "/api/events/count", http.StatusTeapot},
+		{http.MethodPost, "/api/events", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/api/admin/events/abc", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/admin/restore", http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		assert.Equal(t, tc.status, rec.Code, "%s %s", tc.method, tc.path)
+	}
+}
+
+func TestReadOnlyGuardForwardsWrites(t *testing.T) {
+	var forwarded string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Method + " " + r.URL.Path + " " + r.Header.Get(APIKeyHeader)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer primary.Close()
+
+	guard := NewReadOnlyGuard(config.ReadOnlyConfig{Enabled: true, Primary: primary.URL, Timeout: time.Second})
+	handler := guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("writes must not reach the local handler")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(`{}`))
+	req.Header.Set(APIKeyHeader, "secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "POST /api/events secret", forwarded)
+
+	// The primary being down is reported as a gateway error
+	primary.Close()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func TestNewReadOnlyGuardDisabled(t *testing.T) {
+	assert.Nil(t, NewReadOnlyGuard(config.Default().ReadOnly))
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// ResponseCacheHeader reports how a cached endpoint answered: HIT, STALE or MISS
+const ResponseCacheHeader = "X-Cache"
+
+// ResponseCache caches successful responses of heavy analytics endpoints with
+// stale-while-revalidate semantics. Fresh responses are served from memory, stale ones are
+// served immediately while a single background request recomputes them, and responses
+// older than the stale window are recomputed in the request. A nil ResponseCache caches
+// nothing.
+type ResponseCache struct {
+	cfg config.ResponseCacheConfig
+
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+
+	refreshes sync.WaitGroup
+	hits      atomic.Uint64
+	stale     atomic.Uint64
+	misses    atomic.Uint64
+}
+
+// cachedResponse is a recorded response of a cached endpoint
+type cachedResponse struct {
+	header     http.Header
+	body       []byte
+	stored     time.Time
+	refreshing bool
+}
+
+// responseRecorder records a response so it can be cached
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(data)
+}
+
+// ResponseCacheStats describes the use of the response cache
+type ResponseCacheStats struct {
+	Enabled bool   `json:"enabled"` // Whether responses are cached
+	Entries int    `json:"entries"` // Responses cached now
+	Hits    uint64 `json:"hits"`    // Requests served fresh from the cache
+	Stale   uint64 `json:"stale"`   // Requests served stale while refreshing
+	Misses  uint64 `json:"misses"`  // Requests computed in the request
+}
+
+// NewResponseCache creates a response cache. Returns nil, which caches nothing, if response
+// caching is disabled.
+func NewResponseCache(cfg config.ResponseCacheConfig) *ResponseCache {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &ResponseCache{
+		cfg:     cfg,
+		entries: make(map[string]*cachedResponse),
+	}
+}
+
+// Cache wraps a GET handler so its successful responses are cached by URL and carry
+// Cache-Control headers with the same freshness, so clients and proxies can cache too
+func (c *ResponseCache) Cache(next http.HandlerFunc) http.HandlerFunc {
+	if c == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Versions may shape responses differently
+		key := fmt.Sprintf("v%d %s", handlers.APIVersion(r.Context()), r.URL.RequestURI())
+		now := time.Now()
+
+		c.mu.Lock()
+		entry, exists := c.entries[key]
+		var age time.Duration
+		if exists {
+			age = now.Sub(entry.stored)
+		}
+		switch {
+		case exists && age < c.cfg.MaxAge:
+			c.mu.Unlock()
+			c.hits.Add(1)
+			c.serve(w, r, entry, age, "HIT")
+			return
+		case exists && age < c.cfg.MaxAge+c.cfg.StaleWhileRevalidate:
+			refresh := !entry.refreshing
+			entry.refreshing = true
+			c.mu.Unlock()
+			c.stale.Add(1)
+			if refresh {
+				c.refreshes.Add(1)
+				go c.refresh(key, next, r)
+			}
+			c.serve(w, r, entry, age, "STALE")
+			return
+		}
+		c.mu.Unlock()
+
+		c.misses.Add(1)
+		recorder := c.record(next, r)
+		if recorder.status == http.StatusOK {
+			entry = c.store(key, recorder)
+			c.serve(w, r, entry, 0, "MISS")
+			return
+		}
+
+		// Errors are passed through uncached
+		for name, values := range recorder.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(recorder.status)
+		w.Write(recorder.body.Bytes())
+	}
+}
+
+// record runs the handler against a recorder. Conditional requests are recorded
+// unconditionally, so the full response is cached and the condition checked when serving it.
+func (c *ResponseCache) record(next http.HandlerFunc, r *http.Request) *responseRecorder {
+	if r.Header.Get("If-None-Match") != "" {
+		r = r.Clone(r.Context())
+		r.Header.Del("If-None-Match")
+	}
+	recorder := &responseRecorder{header: make(http.Header)}
+	next(recorder, r)
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	return recorder
+}
+
+// refresh recomputes a stale response in the background, detached from the request that
+// found it stale
+func (c *ResponseCache) refresh(key string, next http.HandlerFunc, r *http.Request) {
+	defer c.refreshes.Done()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), c.cfg.RefreshTimeout)
+	defer cancel()
+
+	recorder := c.record(next, r.Clone(ctx))
+	if recorder.status == http.StatusOK {
+		c.store(key, recorder)
+		return
+	}
+
+	// Keep serving the stale response and let the next request retry
+	c.mu.Lock()
+	if entry, exists := c.entries[key]; exists {
+		entry.refreshing = false
+	}
+	c.mu.Unlock()
+}
+
+// store caches a recorded response, evicting the oldest entry when the cache is full
+func (c *ResponseCache) store(key string, recorder *responseRecorder) *cachedResponse {
+	entry := &cachedResponse{
+		header: recorder.header.Clone(),
+		body:   bytes.Clone(recorder.body.Bytes()),
+		stored: time.Now(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.cfg.MaxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range c.entries {
+			if oldestKey == "" || e.stored.Before(oldest) {
+				oldestKey, oldest = k, e.stored
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	c.entries[key] = entry
+	return entry
+}
+
+// serve writes a cached response with its age and cache headers, or 304 Not Modified if the
+// request's If-None-Match lists the response's entity tag
+func (c *ResponseCache) serve(w http.ResponseWriter, r *http.Request, entry *cachedResponse, age time.Duration, status string) {
+	for name, values := range entry.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, stale-while-revalidate=%d",
+		int(c.cfg.MaxAge.Seconds()), int(c.cfg.StaleWhileRevalidate.Seconds())))
+	w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+	w.Header().Set(ResponseCacheHeader, status)
+	if handlers.MatchesETag(r.Header.Get("If-None-Match"), entry.header.Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(entry.body)
+}
+
+// Wait waits for in-flight background refreshes
+func (c *ResponseCache) Wait() {
+	if c == nil {
+		return
+	}
+	c.refreshes.Wait()
+}
+
+// Stats returns the current cache state
+func (c *ResponseCache) Stats() ResponseCacheStats {
+	if c == nil {
+		return ResponseCacheStats{}
+	}
+
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+	return ResponseCacheStats{
+		Enabled: true,
+		Entries: entries,
+		Hits:    c.hits.Load(),
+		Stale:   c.stale.Load(),
+		Misses:  c.misses.Load(),
+	}
+}
+
+// ServeStats handles requests for the cache state
+func (c *ResponseCache) ServeStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Stats())
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// Test that stale responses are served at once while they are recomputed in the background
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	cfg := config.Default().ResponseCache
+	cfg.Enabled = true
+	cfg.MaxAge = time.Minute
+	cfg.StaleWhileRevalidate = time.Hour
+
+	var computed atomic.Int64
+	cache := NewResponseCache(cfg)
+	handler := cache.Cache(func(w http.ResponseWriter, r *http.Request) {
+		n := computed.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strconv.FormatInt(n, 10)))
+	})
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/api/users/top?limit=3", nil))
+		return w
+	}
+	age := func(d time.Duration) {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		for _, entry := range cache.entries {
+			entry.stored = entry.stored.Add(-d)
+		}
+	}
+
+	w := get()
+	assert.Equal(t, "MISS", w.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, "1", w.Body.String())
+	assert.Equal(t, "public, max-age=60, stale-while-revalidate=3600", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	w = get()
+	assert.Equal(t, "HIT", w.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, "1", w.Body.String())
+
+	// A stale response is returned as is while one refresh runs
+	age(2 * time.Minute)
+	w = get()
+	assert.Equal(t, "STALE", w.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, "1", w.Body.String())
+	cache.Wait()
+	assert.Equal(t, int64(2), computed.Load())
+
+	w = get()
+	assert.Equal(t, "HIT", w.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, "2", w.Body.String())
+
+	// Past the stale window the response is recomputed in the request
+	age(2 * time.Hour)
+	w = get()
+	assert.Equal(t, "MISS", w.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, "3", w.Body.String())
+
+	stats := cache.Stats()
+	require.True(t, stats.Enabled)
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Stale)
+	assert.Equal(t, uint64(2), stats.Misses)
+}
+
+// Test that conditional requests are answered from cached responses with the same entity tag
+func TestResponseCacheETag(t *testing.T) {
+	cfg := config.Default().ResponseCache
+	cfg.Enabled = true
+
+	cache := NewResponseCache(cfg)
+	handler := cache.Cache(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `W/"v1"`)
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("[]"))
+	})
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/top", nil)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	// The first conditional request still caches the full response
+	w := get(`W/"v1"`)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get(ResponseCacheHeader))
+
+	w = get(`W/"v0"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "HIT", w.Header().Get(ResponseCacheHeader))
+	assert.Equal(t, "[]", w.Body.String())
+
+	w = get(`"v1"`)
+	assert.Equal(t, http.StatusNotModified, w.Code, "entity tags are compared weakly")
+}
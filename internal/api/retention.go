@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// RetentionSweeper periodically removes expired and out-of-retention events from the store.
+// A nil RetentionSweeper never sweeps.
+type RetentionSweeper struct {
+	store  storage.Store
+	cfg    config.RetentionConfig
+	policy orbitdb.RetentionPolicy
+
+	mu   sync.Mutex
+	last *orbitdb.RetentionResult // Result of the last sweep, nil before the first
+
+	stopSweeping context.CancelFunc
+	done         chan struct{}
+}
+
+// RetentionStats describes the retention sweeper
+type RetentionStats struct {
+	Enabled  bool                     `json:"enabled"`        // Whether events are swept
+	Interval string                   `json:"interval"`       // Time between sweeps
+	Policy   orbitdb.RetentionPolicy  `json:"policy"`         // Applied retention policy
+	Last     *orbitdb.RetentionResult `json:"last,omitempty"` // Last sweep
+}
+
+// NewRetentionSweeper creates a retention sweeper. Returns nil, which never sweeps, if
+// retention is disabled.
+func NewRetentionSweeper(store storage.Store, cfg config.RetentionConfig) *RetentionSweeper {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	policy := orbitdb.RetentionPolicy{MaxAge: cfg.MaxAge, Kinds: make(map[int]orbitdb.RetentionRule)}
+	for kind, rule := range cfg.Kinds {
+		policy.Kinds[kind] = orbitdb.RetentionRule{MaxAge: rule.MaxAge, MaxCount: rule.MaxCount}
+	}
+	return &RetentionSweeper{store: store, cfg: cfg, policy: policy}
+}
+
+// Sweep runs one sweep and records its result
+func (s *RetentionSweeper) Sweep(ctx context.Context) (*orbitdb.RetentionResult, error) {
+	result, err := s.store.SweepRetention(ctx, s.policy, time.Now())
+	if result != nil {
+		s.mu.Lock()
+		s.last = result
+		s.mu.Unlock()
+	}
+	return result, err
+}
+
+// Start sweeps every interval until Stop is called
+func (s *RetentionSweeper) Start(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.stopSweeping = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				result, err := s.Sweep(ctx)
+				if err != nil {
+					zap.L().Warn("Retention sweep failed", zap.Error(err))
+				} else if result.Tombstoned() > 0 {
+					zap.L().Info("Retention sweep removed events", zap.Int("removed", result.Tombstoned()), zap.Int("scanned", result.Scanned))
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops sweeping, waiting for a running sweep to stop
+func (s *RetentionSweeper) Stop() {
+	if s == nil || s.stopSweeping == nil {
+		return
+	}
+	s.stopSweeping()
+	<-s.done
+}
+
+// Stats returns the sweeper state
+func (s *RetentionSweeper) Stats() RetentionStats {
+	if s == nil {
+		return RetentionStats{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return RetentionStats{
+		Enabled:  true,
+		Interval: s.cfg.Interval.String(),
+		Policy:   s.policy,
+		Last:     s.last,
+	}
+}
+
+// ServeStats handles requests for the sweeper state
+func (s *RetentionSweeper) ServeStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Stats())
+}
@@ -1,42 +1,235 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/rs/cors"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.uber.org/zap"
 
 	//"github.com/hetu-project/hetu-orbitdb/internal/api/handlers"
 	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
 	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/internal/webhook"
 )
 
 // Router handles HTTP routing
 type Router struct {
-	store storage.Store
+	store    storage.Store
+	cfg      *config.Config
+	usage    *UsageTracker      // nil when usage tracking is disabled or the node is read-only
+	queries  *QueryLimiter      // nil when queries are not limited
+	writes   *WriteLimiter      // nil when writes are not limited
+	live     *LiveConfigWatcher // nil when no live configuration signers are configured
+	cache    *ResponseCache     // nil when analytics responses are not cached
+	peers    *Federation        // nil when no peer nodes are configured
+	heat     *SubspaceHeat      // nil when warm-up is disabled
+	auth     *Authenticator     // nil when every route group is open
+	admin    *AdminGuard        // nil when no admin credentials are configured
+	sweeper  *RetentionSweeper  // nil when retention is disabled or the node is read-only
+	snapper  *Snapshotter       // nil when automatic snapshots are disabled
+	readOnly *ReadOnlyGuard     // nil unless the node is a read-only follower
+	forward  *Forwarder         // nil unless events are forwarded to an upstream node
+	compress *Compressor        // nil when responses are not compressed
+	webhooks *webhook.Dispatcher
+	operator *SubspaceOperatorGuard
+	health   *HealthChecker
+	node     func() NodeInfo // nil until SetNodeInfo is called
+
+	started    time.Time   // When the router was created, for the uptime
+	ready      atomic.Bool // Set once the warm-up is done
+	stopWarmup context.CancelFunc
+	warmupDone chan struct{}
 }
 
-// NewRouter creates a new router
-func NewRouter(store storage.Store) *Router {
-	return &Router{
-		store: store,
+// NewRouter creates a new router, a nil cfg uses the default configuration
+func NewRouter(store storage.Store, cfg *config.Config) *Router {
+	if cfg == nil {
+		cfg = config.Default()
+	}
+
+	dispatcher := webhook.NewDispatcher(cfg.Webhooks)
+	r := &Router{
+		// Saved events are published to the configured webhook endpoints
+		store:    webhook.NewNotifyingStore(store, dispatcher),
+		cfg:      cfg,
+		started:  time.Now(),
+		queries:  NewQueryLimiter(cfg.API.MaxConcurrentQueries, cfg.API.QueryQueueTimeout),
+		webhooks: dispatcher,
+	}
+	r.writes = NewWriteLimiter(cfg.RateLimit, r.loadSample)
+	r.live = NewLiveConfigWatcher(store, cfg.LiveConfig)
+	r.cache = NewResponseCache(cfg.ResponseCache)
+	r.compress = NewCompressor(cfg.Compression)
+	r.peers = NewFederation(cfg.Federation)
+	r.auth = NewAuthenticator(cfg.Auth)
+	r.admin = NewAdminGuard(cfg.Admin, cfg.Auth)
+	r.operator = NewSubspaceOperatorGuard(r.store, cfg.Auth)
+	r.snapper = NewSnapshotter(store, cfg.Snapshot)
+	r.readOnly = NewReadOnlyGuard(cfg.ReadOnly)
+	r.health = NewHealthChecker(store, cfg.Health, r.Ready)
+	if cfg.Forward.Upstream != "" {
+		r.forward = NewForwarder(r.store, NewHTTPUpstream(cfg.Forward), cfg.Forward.Timeout)
+	}
+	// Read-only nodes leave usage tracking and retention, which write to the database, to the primary
+	if !cfg.ReadOnly.Enabled {
+		r.sweeper = NewRetentionSweeper(store, cfg.Retention)
 	}
+	if cfg.Usage.Enabled && !cfg.ReadOnly.Enabled {
+		r.usage = NewUsageTracker(store, cfg.Usage)
+	}
+	if cfg.Warmup.Enabled {
+		heat, err := LoadSubspaceHeat(r.warmupStatsPath())
+		if err != nil {
+			zap.L().Warn("Failed to load warm-up statistics, warming up only the global leaderboard", zap.Error(err))
+		}
+		r.heat = heat
+	} else {
+		r.ready.Store(true)
+	}
+	return r
 }
 
-// Handler returns the configured HTTP handler
-func (r *Router) Handler() http.Handler {
+// NotifyReplicated delivers the events replicated into the database of bus to the webhook
+// subscriptions they match, until ctx is done
+func (r *Router) NotifyReplicated(ctx context.Context, bus event.Bus) error {
+	return webhook.NotifyReplicated(ctx, bus, r.store, r.webhooks)
+}
+
+// Start starts the router's background workers, including the warm-up when it is enabled
+func (r *Router) Start(ctx context.Context) {
+	if r.usage != nil {
+		r.usage.Start(ctx)
+	}
+	r.writes.Start(ctx)
+	r.live.Start(ctx)
+	r.sweeper.Start(ctx)
+	r.snapper.Start(ctx)
+	// Closing proposals writes to the database, read-only nodes leave it to the primary
+	if !r.cfg.ReadOnly.Enabled {
+		webhook.NotifyClosedProposals(ctx, r.store, r.webhooks, webhook.ProposalCloseInterval)
+	}
+	if r.heat != nil {
+		ctx, cancel := context.WithTimeout(ctx, r.cfg.Warmup.Timeout)
+		r.stopWarmup = cancel
+		r.warmupDone = make(chan struct{})
+		go r.warmUp(ctx)
+	}
+}
+
+// warmUp preloads the hottest subspaces of the previous run and marks the router ready.
+// The node becomes ready even if the warm-up fails or times out.
+func (r *Router) warmUp(ctx context.Context) {
+	defer close(r.warmupDone)
+	defer r.ready.Store(true)
+
+	if _, err := r.store.WarmUp(ctx, r.heat.Hottest(r.cfg.Warmup.Subspaces)); err != nil {
+		zap.L().Warn("Warm-up incomplete", zap.Error(err))
+	}
+}
+
+// Ready reports whether the warm-up is done and the node should receive traffic
+func (r *Router) Ready() bool {
+	return r.ready.Load()
+}
+
+// Stop stops the router's background workers, flushing pending usage and derived data,
+// saving warm-up statistics and waiting for in-flight webhook deliveries
+func (r *Router) Stop(ctx context.Context) {
+	if r.usage != nil {
+		r.usage.Stop(ctx)
+	}
+	r.writes.Stop()
+	r.live.Stop()
+	r.sweeper.Stop()
+	r.snapper.Stop()
+	if err := r.store.FlushDerivedData(ctx); err != nil {
+		zap.L().Warn("Failed to flush derived data", zap.Error(err))
+	}
+	if r.heat != nil {
+		if r.stopWarmup != nil {
+			r.stopWarmup()
+			<-r.warmupDone
+		}
+		if err := r.heat.Save(r.warmupStatsPath()); err != nil {
+			zap.L().Warn("Failed to save warm-up statistics", zap.Error(err))
+		}
+	}
+	r.cache.Wait()
+	r.webhooks.Wait(ctx)
+}
+
+// loadSample samples the node load for the adaptive write limits
+func (r *Router) loadSample() LoadSample {
+	return LoadSample{
+		ReplicationBacklog: r.store.ReplicationBacklog(),
+		QueueDepth:         int(r.queries.Stats().Waiting),
+	}
+}
+
+// warmupStatsPath returns the path of the file persisting subspace request counts
+func (r *Router) warmupStatsPath() string {
+	return warmupStatsPath(r.cfg.OrbitDB.Directory, r.cfg.Warmup.StatsFile)
+}
+
+// guardAdmin exempts a route restricted to the admin credentials from the public keys
+// allowed to authenticate, unless the admin routes are open
+func (r *Router) guardAdmin(route *mux.Route) {
+	if r.admin != nil {
+		r.auth.Guarded(route)
+	}
+}
+
+// routes registers the API routes, documented in routeDocs
+func (r *Router) routes() *mux.Router {
 	router := mux.NewRouter()
+	// Unknown routes and methods get JSON errors like the handlers
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.Error(w, "Not found", http.StatusNotFound)
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	})
 
 	// Create event handlers
 	eventHandlers := handlers.NewEventHandlers(r.store)
 	causalityHandlers := handlers.NewCausalityHandlers(r.store)
 	userHandlers := handlers.NewUserHandlers(r.store)
+	activityHandlers := handlers.NewActivityHandlers(r.store)
+	adminHandlers := handlers.NewAdminHandlers(r.store, r.cfg.OrbitDB.Directory)
+	webhookHandlers := handlers.NewWebhookHandlers(r.webhooks)
+	subspaceWebhookHandlers := handlers.NewSubspaceWebhookHandlers(r.store)
+	subscriptionHandlers := handlers.NewWebhookSubscriptionHandlers(r.store)
+	annotationHandlers := handlers.NewAnnotationHandlers(r.store)
+	proposalHandlers := handlers.NewProposalHandlers(r.store)
+	graphQLHandlers := handlers.NewGraphQLHandlers(r.store)
+	moderationHandlers := handlers.NewModerationHandlers(r.store)
 
-	// Event API endpoints
-	router.HandleFunc("/api/events", eventHandlers.SaveEvent).Methods(http.MethodPost)
+	// Event API endpoints; writes are subject to the live configuration and bounded by the write limiter,
+	// full-scan endpoints are bounded by the query limiter
+	if r.forward != nil {
+		// Edge nodes forward events to the upstream node, even when read-only
+		router.HandleFunc("/api/events", r.writes.Limit(r.forward.SaveEvent)).Methods(http.MethodPost)
+		r.readOnly.Allow("/api/events")
+	} else {
+		router.HandleFunc("/api/events", r.live.Guard(r.writes.Limit(eventHandlers.SaveEvent))).Methods(http.MethodPost)
+	}
+	router.HandleFunc("/api/events/simulate", eventHandlers.SimulateEvent).Methods(http.MethodPost)
 	router.HandleFunc("/api/events/{id}", eventHandlers.GetEvent).Methods(http.MethodGet)
-	router.HandleFunc("/api/events/query", eventHandlers.QueryEvents).Methods(http.MethodPost)
-	router.HandleFunc("/api/events/{id}", eventHandlers.DeleteEvent).Methods(http.MethodDelete)
+	router.HandleFunc("/api/events/query", r.queries.Limit(eventHandlers.QueryEvents)).Methods(http.MethodPost)
+	router.HandleFunc("/api/events/query/federated", r.queries.Limit(r.peers.Query(eventHandlers.QueryEvents))).Methods(http.MethodPost)
+	router.HandleFunc("/api/events/count", r.queries.Limit(eventHandlers.CountEvents)).Methods(http.MethodPost)
+	router.HandleFunc("/api/events/{id}/xrefs", eventHandlers.GetEventXrefs).Methods(http.MethodGet)
+	router.HandleFunc("/api/events/{id}/thread", r.queries.Limit(eventHandlers.GetEventThread)).Methods(http.MethodGet)
+	router.HandleFunc("/api/events/{id}/annotations", annotationHandlers.GetEventAnnotations).Methods(http.MethodGet)
+	router.Handle("/api/events/{id}/annotations", r.operator.SignerMiddleware(http.HandlerFunc(annotationHandlers.AddEventAnnotation))).Methods(http.MethodPost)
+	router.Handle("/api/events/{id}/annotations/{annotation}", r.operator.SignerMiddleware(http.HandlerFunc(annotationHandlers.DeleteEventAnnotation))).Methods(http.MethodDelete)
 
 	// 子空间信息端点
 	// router.HandleFunc("/subspace/{id}", eventHandlers.GetSubspace).Methods("GET")
@@ -48,18 +241,104 @@ func (r *Router) Handler() http.Handler {
 	// router.HandleFunc("/subspaces", eventHandlers.ListSubspaces).Methods("GET")
 
 	// Causality API endpoints
-	router.HandleFunc("/api/subspaces", causalityHandlers.ListSubspaces).Methods(http.MethodGet)
+	router.HandleFunc("/api/subspaces", r.queries.Limit(causalityHandlers.ListSubspaces)).Methods(http.MethodGet)
+	router.HandleFunc("/api/subspaces/top", r.cache.Cache(r.queries.Limit(causalityHandlers.ListTopSubspaces))).Methods(http.MethodGet)
 	router.HandleFunc("/api/subspaces/{id}", causalityHandlers.GetSubspaceCausality).Methods(http.MethodGet)
-	router.HandleFunc("/api/subspaces/{id}/events", causalityHandlers.GetSubspaceEvents).Methods(http.MethodGet)
+	router.HandleFunc("/api/subspaces/{id}/events", r.queries.Limit(causalityHandlers.GetSubspaceEvents)).Methods(http.MethodGet)
+	router.HandleFunc("/api/subspaces/{id}/stats", causalityHandlers.GetSubspaceStats).Methods(http.MethodGet)
+	router.HandleFunc("/api/subspaces/{id}/causality/graph", r.queries.Limit(causalityHandlers.GetCausalityGraph)).Methods(http.MethodGet)
+	router.HandleFunc("/api/subspaces/{id}/keys", causalityHandlers.ListCausalityKeys).Methods(http.MethodGet)
 	router.HandleFunc("/api/subspaces/{id}/keys/{key}", causalityHandlers.GetCausalityKey).Methods(http.MethodGet)
 	//router.HandleFunc("/subspaces/events", causalityHandlers.CreateSubspaceEvent).Methods(http.MethodPost)
 
 	// User Stats API endpoints
+	router.HandleFunc("/api/users/stats", r.queries.Limit(userHandlers.GetUserStatsBatch)).Methods(http.MethodPost)
 	router.HandleFunc("/api/users/{id}/stats", userHandlers.GetUserStats).Methods(http.MethodGet)
+	router.HandleFunc("/api/users/{id}/profile", userHandlers.GetUserProfile).Methods(http.MethodGet)
+	router.HandleFunc("/api/users/{id}/following", userHandlers.ListFollowing).Methods(http.MethodGet)
+	router.HandleFunc("/api/users/{id}/followers", userHandlers.ListFollowers).Methods(http.MethodGet)
+	router.HandleFunc("/api/users/{id}/mutuals", userHandlers.ListMutualFollows).Methods(http.MethodGet)
 	router.HandleFunc("/api/users/{id}/subspaces", userHandlers.GetUserSubspaces).Methods(http.MethodGet)
 	router.HandleFunc("/api/users/{id}/invites", userHandlers.GetUserInvites).Methods(http.MethodGet)
-	router.HandleFunc("/api/users/top", userHandlers.ListTopUsers).Methods(http.MethodGet)
-	router.HandleFunc("/api/subspaces/{id}/users", userHandlers.GetSubspaceUsers).Methods(http.MethodGet)
+	router.HandleFunc("/api/users/{id}/invite-tree", userHandlers.GetUserInviteTree).Methods(http.MethodGet)
+	router.HandleFunc("/api/users/{id}/activity", activityHandlers.GetUserActivity).Methods(http.MethodGet)
+	// Purging a user's data is destructive and needs the admin credentials
+	r.guardAdmin(router.Handle("/api/users/{id}/data", r.admin.Middleware(http.HandlerFunc(userHandlers.PurgeUserData))).Methods(http.MethodDelete))
+	router.HandleFunc("/api/users/top", r.cache.Cache(r.queries.Limit(userHandlers.ListTopUsers))).Methods(http.MethodGet)
+	router.HandleFunc("/api/subspaces/{id}/users", r.queries.Limit(userHandlers.GetSubspaceUsers)).Methods(http.MethodGet)
+	router.HandleFunc("/api/subspaces/{id}/invite-graph", r.queries.Limit(userHandlers.GetSubspaceInviteGraph)).Methods(http.MethodGet)
+	router.HandleFunc("/api/subspaces/{id}/activity", activityHandlers.GetSubspaceActivity).Methods(http.MethodGet)
+	router.HandleFunc("/api/subspaces/{id}/top", r.cache.Cache(r.queries.Limit(userHandlers.ListSubspaceTopUsers))).Methods(http.MethodGet)
+
+	// Subspace moderation endpoints; changes are restricted to the subspace's creator and moderators
+	router.HandleFunc("/api/subspaces/{id}/moderation", moderationHandlers.GetSubspaceModeration).Methods(http.MethodGet)
+	r.auth.Guarded(router.Handle("/api/subspaces/{id}/bans/{pubkey}", r.operator.Middleware(http.HandlerFunc(moderationHandlers.BanUser))).Methods(http.MethodPut))
+	r.auth.Guarded(router.Handle("/api/subspaces/{id}/bans/{pubkey}", r.operator.Middleware(http.HandlerFunc(moderationHandlers.UnbanUser))).Methods(http.MethodDelete))
+	r.auth.Guarded(router.Handle("/api/subspaces/{id}/hidden/{event_id}", r.operator.Middleware(http.HandlerFunc(moderationHandlers.HideEvent))).Methods(http.MethodPut))
+	r.auth.Guarded(router.Handle("/api/subspaces/{id}/hidden/{event_id}", r.operator.Middleware(http.HandlerFunc(moderationHandlers.UnhideEvent))).Methods(http.MethodDelete))
+
+	// Proposal API endpoints
+	router.HandleFunc("/api/subspaces/{id}/proposals", r.queries.Limit(proposalHandlers.ListSubspaceProposals)).Methods(http.MethodGet)
+	router.HandleFunc("/api/proposals/{id}", proposalHandlers.GetProposal).Methods(http.MethodGet)
+
+	// GraphQL endpoint for composite views across events, users, subspaces and proposals;
+	// queries only read, so read-only nodes serve them too
+	router.HandleFunc("/api/graphql", r.queries.Limit(graphQLHandlers.Query)).Methods(http.MethodGet, http.MethodPost)
+	r.readOnly.Allow("/api/graphql")
+
+	// Admin API endpoints, including destructive operations, restricted to the admin credentials
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Use(r.admin.Middleware)
+	admin.HandleFunc("/usage", adminHandlers.GetUsage).Methods(http.MethodGet)
+	admin.HandleFunc("/queries", r.queries.ServeStats).Methods(http.MethodGet)
+	admin.HandleFunc("/ratelimit", r.writes.ServeStats).Methods(http.MethodGet)
+	admin.HandleFunc("/cache", r.cache.ServeStats).Methods(http.MethodGet)
+	admin.HandleFunc("/storage/forecast", r.queries.Limit(adminHandlers.GetStorageForecast)).Methods(http.MethodGet)
+	admin.HandleFunc("/backup", adminHandlers.Backup).Methods(http.MethodPost)
+	admin.HandleFunc("/restore", adminHandlers.Restore).Methods(http.MethodPost)
+	admin.HandleFunc("/events/{id}", r.live.Guard(eventHandlers.DeleteEvent)).Methods(http.MethodDelete)
+	admin.HandleFunc("/rebuild", adminHandlers.RebuildDerivedData).Methods(http.MethodPost)
+	admin.HandleFunc("/backfill", adminHandlers.BackfillFromRelays).Methods(http.MethodPost)
+	admin.HandleFunc("/derived", adminHandlers.GetDerivedDataStats).Methods(http.MethodGet)
+	admin.HandleFunc("/policy", adminHandlers.GetEventPolicies).Methods(http.MethodGet)
+	admin.HandleFunc("/retention", r.sweeper.ServeStats).Methods(http.MethodGet)
+	admin.HandleFunc("/compact", adminHandlers.Compact).Methods(http.MethodPost)
+	admin.HandleFunc("/snapshots", r.snapper.ServeStats).Methods(http.MethodGet)
+	admin.HandleFunc("/quarantine", r.queries.Limit(adminHandlers.ListQuarantinedEvents)).Methods(http.MethodGet)
+	admin.HandleFunc("/quarantine/{id}", adminHandlers.DeleteQuarantinedEvent).Methods(http.MethodDelete)
+	admin.HandleFunc("/config/live", r.live.ServePublish).Methods(http.MethodPost)
+	admin.HandleFunc("/migration", adminHandlers.GetMigrationStatus).Methods(http.MethodGet)
+	admin.HandleFunc("/migration/backfill", adminHandlers.StartMigrationBackfill).Methods(http.MethodPost)
+	admin.HandleFunc("/migration/flip", adminHandlers.FlipMigration).Methods(http.MethodPost)
+	admin.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		r.guardAdmin(route)
+		return nil
+	})
+
+	// Webhook API endpoints
+	router.HandleFunc("/api/webhooks/schemas", webhookHandlers.ListSchemas).Methods(http.MethodGet)
+	router.HandleFunc("/api/webhooks/schemas/{type}", webhookHandlers.GetSchema).Methods(http.MethodGet)
+	r.guardAdmin(router.Handle("/api/webhooks/test", r.admin.Middleware(http.HandlerFunc(webhookHandlers.TestDelivery))).Methods(http.MethodPost))
+	router.HandleFunc("/api/webhooks", subscriptionHandlers.ListWebhookSubscriptions).Methods(http.MethodGet)
+	r.guardAdmin(router.Handle("/api/webhooks", r.admin.Middleware(http.HandlerFunc(subscriptionHandlers.CreateWebhookSubscription))).Methods(http.MethodPost))
+	r.guardAdmin(router.Handle("/api/webhooks/{id}", r.admin.Middleware(http.HandlerFunc(subscriptionHandlers.DeleteWebhookSubscription))).Methods(http.MethodDelete))
+	router.HandleFunc("/api/subspaces/{id}/webhooks", subspaceWebhookHandlers.ListSubspaceWebhooks).Methods(http.MethodGet)
+	r.auth.Guarded(router.Handle("/api/subspaces/{id}/webhooks", r.operator.Middleware(http.HandlerFunc(subspaceWebhookHandlers.CreateSubspaceWebhook))).Methods(http.MethodPost))
+	r.auth.Guarded(router.Handle("/api/subspaces/{id}/webhooks/{webhook}", r.operator.Middleware(http.HandlerFunc(subspaceWebhookHandlers.DeleteSubspaceWebhook))).Methods(http.MethodDelete))
+
+	// Live configuration applied by this node
+	router.HandleFunc("/api/config/live", r.live.ServeConfig).Methods(http.MethodGet)
+
+	// Node identity, databases, documents held and uptime; counting documents scans the store
+	router.HandleFunc("/api/status", r.queries.Limit(r.serveStatus)).Methods(http.MethodGet)
+
+	// Replication progress, to tell whether the node is caught up with its peers
+	router.HandleFunc("/api/status/replication", adminHandlers.GetReplicationStatus).Methods(http.MethodGet)
+
+	// Databases served by this node, for other nodes to open
+	if r.cfg.Publish.WellKnown {
+		router.HandleFunc(WellKnownPath, r.serveWellKnown).Methods(http.MethodGet)
+	}
 
 	// Health check endpoint
 	router.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
@@ -67,13 +346,71 @@ func (r *Router) Handler() http.Handler {
 		w.Write([]byte("OK"))
 	}).Methods(http.MethodGet)
 
+	// Deep readiness check of the database, peers and replication, for orchestrator probes
+	router.HandleFunc("/api/health/ready", r.serveHealthReady).Methods(http.MethodGet)
+
+	// Readiness endpoint, unavailable while the node warms up
+	router.HandleFunc("/api/ready", func(w http.ResponseWriter, req *http.Request) {
+		if !r.Ready() {
+			handlers.Error(w, "Warming up", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}).Methods(http.MethodGet)
+
+	return router
+}
+
+// Handler returns the configured HTTP handler
+func (r *Router) Handler() http.Handler {
+	router := r.routes()
+
+	// Description of the routes above and its browsable documentation
+	router.HandleFunc(OpenAPIPath, serveOpenAPI(router)).Methods(http.MethodGet)
+	router.HandleFunc(DocsPath, serveDocs).Methods(http.MethodGet)
+
+	// Name request spans after the matched route
+	router.Use(traceRoutes)
+
+	// Authenticate requests of route groups that need it with NIP-98 signed events
+	if r.auth != nil {
+		router.Use(r.auth.Middleware)
+	}
+
+	// Count subspace requests for the next run's warm-up
+	if r.heat != nil {
+		router.Use(r.heat.Middleware)
+	}
+
 	// CORS configuration
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-		AllowedHeaders:   []string{"Content-Type"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", APIKeyHeader, APIVersionHeader, RequestIDHeader},
+		ExposedHeaders:   []string{handlers.NextCursorHeader, "Retry-After", ResponseCacheHeader, APIVersionHeader, "Deprecation", "Link", RequestIDHeader},
 		AllowCredentials: true,
 	})
 
-	return c.Handler(router)
+	// Reject or forward the writes of read-only nodes, whichever route they target
+	var handler http.Handler = r.readOnly.Middleware(router)
+	// Compress inside the usage tracking, so it counts the bytes sent
+	handler = r.compress.Middleware(handler)
+	if r.usage != nil {
+		handler = r.usage.Middleware(handler)
+	}
+	// Route /api/v1 paths to the routes above, before any middleware looks at the path
+	handler = versioning(handler)
+	// Give up on storage calls of requests that run too long
+	handler = withDeadline(r.cfg.API.RequestTimeout, handler)
+	// Answer panics with a 500 error, inside the access log so it records the status
+	handler = recoverPanics(handler)
+	if r.cfg.API.AccessLog {
+		handler = accessLog(handler)
+	}
+	handler = requestIDs(handler)
+	// Trace requests through the storage pipeline, continuing the callers' traces
+	handler = otelhttp.NewHandler(handler, "http.server")
+
+	return c.Handler(handler)
 }
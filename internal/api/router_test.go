@@ -0,0 +1,352 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Run `go test ./internal/api -update` to rewrite the golden files after an intended response change.
+var updateGolden = flag.Bool("update", false, "rewrite golden response files")
+
+// Fields whose values depend on the wall clock or the local timezone
+var volatileFields = map[string]bool{
+	"created":          true,
+	"updated":          true,
+	"last_updated":     true,
+	"timestamp":        true,
+	"generated_at":     true,
+	"join_time":        true,
+	"last_active_time": true,
+	"last_active":      true,
+	"started":          true,
+	"duration_ms":      true,
+}
+
+const goldenSubspace = "0x1111111111111111111111111111111111111111111111111111111111111111"
+
+var (
+	goldenCreatorKey = goldenKey("creator")
+	goldenMemberKey  = goldenKey("member")
+	goldenInviteeKey = goldenKey("invitee")
+
+	goldenCreator, _ = nostr.GetPublicKey(goldenCreatorKey)
+	goldenMember, _  = nostr.GetPublicKey(goldenMemberKey)
+	goldenInvitee, _ = nostr.GetPublicKey(goldenInviteeKey)
+)
+
+// goldenKey derives a fixed private key from name, so the fixtures sign to the same IDs on
+// every run
+func goldenKey(name string) string {
+	sum := sha256.Sum256([]byte("golden " + name))
+	return hex.EncodeToString(sum[:])
+}
+
+// goldenEvent signs event with key
+func goldenEvent(key string, event *nostr.Event) *nostr.Event {
+	if err := event.Sign(key); err != nil {
+		panic(err)
+	}
+	return event
+}
+
+var (
+	goldenPost = goldenEvent(goldenMemberKey, &nostr.Event{
+		CreatedAt: 1700000200,
+		Kind:      30300,
+		Tags:      nostr.Tags{{"sid", goldenSubspace}, {"op", "post"}},
+		Content:   "hello",
+	})
+	goldenProposal = goldenEvent(goldenCreatorKey, &nostr.Event{
+		CreatedAt: 1700000350,
+		Kind:      30301,
+		Tags: nostr.Tags{
+			{"sid", goldenSubspace},
+			{"op", "propose"},
+			{"quorum", "1"},
+		},
+		Content: "raise the quorum",
+	})
+)
+
+// goldenFixtures are the events saved before the endpoints are exercised
+var goldenFixtures = []*nostr.Event{
+	goldenEvent(goldenCreatorKey, &nostr.Event{
+		CreatedAt: 1700000000,
+		Kind:      30100,
+		Tags: nostr.Tags{
+			{"sid", goldenSubspace},
+			{"subspace_name", "golden"},
+			{"description", "golden test subspace"},
+			{"rules", "be kind"},
+			{"ops", "post=30300,vote=30302,invite=30303"},
+		},
+		Content: "create subspace",
+	}),
+	goldenEvent(goldenMemberKey, &nostr.Event{
+		CreatedAt: 1700000100,
+		Kind:      30200,
+		Tags:      nostr.Tags{{"sid", goldenSubspace}},
+		Content:   "join subspace",
+	}),
+	goldenPost,
+	goldenEvent(goldenMemberKey, &nostr.Event{
+		CreatedAt: 1700000300,
+		Kind:      30302,
+		Tags: nostr.Tags{
+			{"sid", goldenSubspace},
+			{"op", "vote"},
+			{"vote", "yes"},
+			{"xref", goldenPost.ID, goldenSubspace},
+		},
+		Content: "vote",
+	}),
+	goldenProposal,
+	goldenEvent(goldenMemberKey, &nostr.Event{
+		CreatedAt: 1700000360,
+		Kind:      30302,
+		Tags: nostr.Tags{
+			{"sid", goldenSubspace},
+			{"op", "vote"},
+			{"proposal_id", goldenProposal.ID},
+			{"vote", "yes"},
+		},
+		Content: "vote on proposal",
+	}),
+	goldenEvent(goldenInviteeKey, &nostr.Event{
+		CreatedAt: 1700000400,
+		Kind:      30303,
+		Tags: nostr.Tags{
+			{"sid", goldenSubspace},
+			{"op", "invite"},
+			{"inviter_addr", goldenCreator},
+		},
+		Content: "accept invite",
+	}),
+}
+
+// Test every endpoint of the router against golden responses
+func TestRouterGoldenResponses(t *testing.T) {
+	cfg := config.Default()
+	cfg.OrbitDB.Directory = t.TempDir()
+	cfg.Admin.Open = true
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("golden"))
+	handler := NewRouter(store, cfg).Handler()
+
+	for _, event := range goldenFixtures {
+		body, err := json.Marshal(event)
+		require.NoError(t, err)
+		w := serve(handler, http.MethodPost, "/api/events", body)
+		require.Equal(t, http.StatusCreated, w.Code, "saving fixture %q: %s", event.Content, w.Body.String())
+	}
+
+	simulated, err := json.Marshal(goldenEvent(goldenMemberKey, &nostr.Event{
+		CreatedAt: 1700000500,
+		Kind:      30300,
+		Tags:      nostr.Tags{{"sid", goldenSubspace}, {"op", "post"}},
+	}))
+	require.NoError(t, err)
+
+	// Cases run in order; mutating requests come last
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"health", http.MethodGet, "/api/health", ""},
+		{"ready", http.MethodGet, "/api/ready", ""},
+		{"get_event", http.MethodGet, "/api/events/" + goldenPost.ID, ""},
+		{"get_event_missing", http.MethodGet, "/api/events/missing", ""},
+		{"get_event_v1", http.MethodGet, "/api/v1/events/" + goldenPost.ID, ""},
+		{"query_events", http.MethodPost, "/api/events/query", `{"sid":["` + goldenSubspace + `"]}`},
+		{"query_events_federated", http.MethodPost, "/api/events/query/federated", `{"sid":["` + goldenSubspace + `"],"limit":2}`},
+		{"count_events", http.MethodPost, "/api/events/count", `{"sid":["` + goldenSubspace + `"],"kinds":[30300,30302]}`},
+		{"query_events_tag_filter", http.MethodPost, "/api/events/query", `{"#op":["post"],"#sid":["` + goldenSubspace + `"]}`},
+		{"event_xrefs", http.MethodGet, "/api/events/" + goldenPost.ID + "/xrefs", ""},
+		{"event_annotations", http.MethodGet, "/api/events/" + goldenPost.ID + "/annotations", ""},
+		{"get_event_annotated", http.MethodGet, "/api/events/" + goldenPost.ID + "?include=annotations", ""},
+		{"simulate_event", http.MethodPost, "/api/events/simulate", string(simulated)},
+		{"list_subspaces", http.MethodGet, "/api/subspaces", ""},
+		{"find_subspaces_by_name", http.MethodGet, "/api/subspaces?name=Golden", ""},
+		{"top_subspaces", http.MethodGet, "/api/subspaces/top?window=168h&sort_by=users", ""},
+		{"subspace_causality", http.MethodGet, "/api/subspaces/" + goldenSubspace, ""},
+		{"subspace_events", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/events", ""},
+		{"causality_graph", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/causality/graph", ""},
+		{"causality_graph_dot", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/causality/graph?format=dot", ""},
+		{"causality_keys", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/keys", ""},
+		{"causality_key", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/keys/30300", ""},
+		{"subspace_users", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/users", ""},
+		{"user_stats", http.MethodGet, "/api/users/" + goldenMember + "/stats", ""},
+		{"user_subspaces", http.MethodGet, "/api/users/" + goldenMember + "/subspaces", ""},
+		{"user_invites", http.MethodGet, "/api/users/" + goldenCreator + "/invites", ""},
+		{"user_invite_tree", http.MethodGet, "/api/users/" + goldenCreator + "/invite-tree?depth=2", ""},
+		{"subspace_invite_graph", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/invite-graph", ""},
+		{"user_activity", http.MethodGet, "/api/users/" + goldenMember + "/activity?granularity=day&from=1699920000&to=1700092800", ""},
+		{"subspace_activity", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/activity?granularity=hour&from=1699999200&to=1700006400", ""},
+		{"subspace_activity_invalid", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/activity?granularity=week", ""},
+		{"top_users", http.MethodGet, "/api/users/top", ""},
+		{"subspace_top_users", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/top?sort_by=votes", ""},
+		{"subspace_proposals", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/proposals", ""},
+		{"get_proposal", http.MethodGet, "/api/proposals/" + goldenProposal.ID, ""},
+		{"get_proposal_missing", http.MethodGet, "/api/proposals/missing", ""},
+		{"graphql", http.MethodPost, "/api/graphql", `{"query":"{ subspace(id: \"` + goldenSubspace + `\") { id name creator { id } users(limit: 5) { id events(limit: 2) { id kind } } proposals { proposal_id status } } }"}`},
+		{"webhook_schemas", http.MethodGet, "/api/webhooks/schemas", ""},
+		{"webhook_schema", http.MethodGet, "/api/webhooks/schemas/event.saved", ""},
+		{"webhook_test", http.MethodPost, "/api/webhooks/test", `{"type":"event.saved"}`},
+		{"subspace_webhooks", http.MethodGet, "/api/subspaces/" + goldenSubspace + "/webhooks", ""},
+		{"admin_usage", http.MethodGet, "/api/admin/usage", ""},
+		{"admin_queries", http.MethodGet, "/api/admin/queries", ""},
+		{"admin_ratelimit", http.MethodGet, "/api/admin/ratelimit", ""},
+		{"admin_cache", http.MethodGet, "/api/admin/cache", ""},
+		{"storage_forecast", http.MethodGet, "/api/admin/storage/forecast", ""},
+		{"live_config", http.MethodGet, "/api/config/live", ""},
+		{"migration_status", http.MethodGet, "/api/admin/migration", ""},
+		{"backup", http.MethodPost, "/api/admin/backup", ""},
+		{"rebuild_derived_data", http.MethodPost, "/api/admin/rebuild", ""},
+		{"derived_data_stats", http.MethodGet, "/api/admin/derived", ""},
+		{"event_policies", http.MethodGet, "/api/admin/policy", ""},
+		{"retention", http.MethodGet, "/api/admin/retention", ""},
+		{"well_known", http.MethodGet, "/.well-known/crelay.json", ""},
+		{"replication_status", http.MethodGet, "/api/status/replication", ""},
+		{"compact", http.MethodPost, "/api/admin/compact", ""},
+		{"snapshots", http.MethodGet, "/api/admin/snapshots", ""},
+		{"delete_event", http.MethodDelete, "/api/admin/events/" + goldenPost.ID, ""},
+		{"get_deleted_event", http.MethodGet, "/api/events/" + goldenPost.ID, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(handler, tc.method, tc.path, []byte(tc.body))
+			actual := goldenResponse(t, w)
+
+			path := filepath.Join("testdata", "golden", tc.name+".json")
+			expected, err := os.ReadFile(path)
+			if *updateGolden {
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				require.NoError(t, os.WriteFile(path, actual, 0644))
+				t.Logf("recorded golden file %s", path)
+				return
+			}
+			if os.IsNotExist(err) {
+				t.Fatalf("golden file %s is missing; run with -update (make golden) to record it", path)
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, string(expected), string(actual),
+				"response of %s %s changed; run with -update if this is intended", tc.method, tc.path)
+		})
+	}
+}
+
+// Test that the node status counts the stored documents by doc_type
+func TestRouterStatus(t *testing.T) {
+	cfg := config.Default()
+	cfg.OrbitDB.Directory = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.OrbitDB.Directory, "data"), make([]byte, 100), 0644))
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("status"))
+	for _, event := range goldenFixtures {
+		require.NoError(t, store.SaveEvent(context.Background(), event))
+	}
+	r := NewRouter(store, cfg)
+	r.SetNodeInfo(func() NodeInfo { return NodeInfo{PeerID: "QmNode", Multiaddrs: []string{}} })
+
+	w := serve(r.Handler(), http.MethodGet, "/api/status", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var status NodeStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, "QmNode", status.Node.PeerID)
+	assert.Equal(t, "docstore", status.StoreType)
+	assert.Equal(t, int64(100), status.DiskBytes)
+	assert.Empty(t, status.Store.Stores, "in-memory stores have no oplog")
+
+	counts := make(map[string]int)
+	total := 0
+	for _, count := range status.Store.Documents {
+		counts[count.DocType] = count.Documents
+		total += count.Documents
+	}
+	assert.Equal(t, len(goldenFixtures), counts[orbitdb.DocTypeNostrEvent])
+	assert.Positive(t, counts[orbitdb.DocTypeCausality])
+	assert.Equal(t, status.Store.TotalDocuments, total)
+}
+
+// Helper function: serve one request
+func serve(handler http.Handler, method, path string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// goldenResponse renders the status, content type and normalized body of a response
+func goldenResponse(t *testing.T, w *httptest.ResponseRecorder) []byte {
+	response := map[string]interface{}{
+		"status":       w.Code,
+		"content_type": w.Header().Get("Content-Type"),
+	}
+
+	raw := w.Body.String()
+	var body interface{}
+	switch {
+	case json.Unmarshal([]byte(raw), &body) == nil:
+		response["body"] = normalize(body)
+	case strings.Contains(w.Header().Get("Content-Type"), "ndjson"):
+		// One JSON document per line
+		var lines []interface{}
+		for _, line := range strings.Split(strings.TrimSpace(raw), "\n") {
+			var doc interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &doc))
+			lines = append(lines, normalize(doc))
+		}
+		response["body"] = lines
+	default:
+		response["body"] = strings.TrimSpace(raw)
+	}
+
+	data, err := json.MarshalIndent(response, "", "  ")
+	require.NoError(t, err)
+	return append(data, '\n')
+}
+
+// normalize replaces volatile values so responses are comparable across runs
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			// Processed event markers record when they were written
+			if volatileFields[key] || key == "processed" && v["doc_type"] == "processed_event" {
+				v[key] = "<volatile>"
+				continue
+			}
+			v[key] = normalize(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalize(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
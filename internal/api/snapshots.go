@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Snapshotter periodically snapshots the stores whose oplog grew by the configured number of
+// entries, so cold starts load the snapshot instead of replaying the oplog. A nil Snapshotter
+// never snapshots.
+type Snapshotter struct {
+	store storage.Store
+	cfg   config.SnapshotConfig
+
+	mu      sync.Mutex
+	last    *orbitdb.SnapshotResult // Last run that snapshotted a store, nil before the first
+	lastErr string                  // Error of the last run, empty if it succeeded
+
+	stopSnapshotting context.CancelFunc
+	done             chan struct{}
+}
+
+// SnapshotStats describes the snapshotter
+type SnapshotStats struct {
+	Enabled       bool                    `json:"enabled"`              // Whether stores are snapshotted automatically
+	EveryEntries  int                     `json:"every_entries"`        // Oplog growth that triggers a snapshot
+	CheckInterval string                  `json:"check_interval"`       // Time between growth checks
+	Last          *orbitdb.SnapshotResult `json:"last,omitempty"`       // Last run that snapshotted a store
+	LastError     string                  `json:"last_error,omitempty"` // Error of the last run
+}
+
+// NewSnapshotter creates a snapshotter. Returns nil, which never snapshots, if automatic
+// snapshots are disabled.
+func NewSnapshotter(store storage.Store, cfg config.SnapshotConfig) *Snapshotter {
+	if cfg.EveryEntries <= 0 {
+		return nil
+	}
+	return &Snapshotter{store: store, cfg: cfg}
+}
+
+// Check snapshots the stores that grew enough and records the result
+func (s *Snapshotter) Check(ctx context.Context) (*orbitdb.SnapshotResult, error) {
+	result, err := s.store.SnapshotIfGrown(ctx, s.cfg.EveryEntries)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if result != nil && len(result.Snapshots) > 0 {
+		s.last = result
+	}
+	s.lastErr = ""
+	if err != nil {
+		s.lastErr = err.Error()
+	}
+	return result, err
+}
+
+// Start checks the stores every check interval until Stop is called
+func (s *Snapshotter) Start(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.stopSnapshotting = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.cfg.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.Check(ctx); errors.Is(err, orbitdb.ErrSnapshotsUnsupported) {
+					zap.L().Warn("Automatic snapshots disabled", zap.Error(err))
+					return
+				} else if err != nil {
+					zap.L().Warn("Automatic snapshot failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops snapshotting, waiting for a running snapshot to complete
+func (s *Snapshotter) Stop() {
+	if s == nil || s.stopSnapshotting == nil {
+		return
+	}
+	s.stopSnapshotting()
+	<-s.done
+}
+
+// Stats returns the snapshotter state
+func (s *Snapshotter) Stats() SnapshotStats {
+	if s == nil {
+		return SnapshotStats{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SnapshotStats{
+		Enabled:       true,
+		EveryEntries:  s.cfg.EveryEntries,
+		CheckInterval: s.cfg.CheckInterval.String(),
+		Last:          s.last,
+		LastError:     s.lastErr,
+	}
+}
+
+// ServeStats handles requests for the snapshotter state
+func (s *Snapshotter) ServeStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Stats())
+}
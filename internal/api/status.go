@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// NodeStatus describes the running node, its databases and what they hold
+type NodeStatus struct {
+	Node          *NodeInfo            `json:"node,omitempty"` // IPFS node, nil without one
+	StoreType     string               `json:"store_type"`     // Configured OrbitDB store type
+	Store         *orbitdb.StoreStatus `json:"store"`          // Databases, oplogs and documents by doc_type
+	Directory     string               `json:"directory"`      // OrbitDB data directory
+	DiskBytes     int64                `json:"disk_bytes"`     // Size of the files in the data directory
+	StartedAt     time.Time            `json:"started_at"`     // When the node started serving
+	UptimeSeconds int64                `json:"uptime_seconds"` // Time since the node started serving
+}
+
+// serveStatus handles requests for the status of the node
+func (r *Router) serveStatus(w http.ResponseWriter, req *http.Request) {
+	store, err := r.store.StoreStatus(req.Context())
+	if err != nil {
+		handlers.StoreError(w, err, "Failed to get store status")
+		return
+	}
+
+	status := NodeStatus{
+		StoreType: r.cfg.OrbitDB.StoreType,
+		Store:     store,
+		Directory: r.cfg.OrbitDB.Directory,
+		DiskBytes: handlers.DirectorySize(r.cfg.OrbitDB.Directory),
+		StartedAt: r.started,
+	}
+	status.UptimeSeconds = int64(time.Since(r.started).Seconds())
+	if r.node != nil {
+		node := r.node()
+		status.Node = &node
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
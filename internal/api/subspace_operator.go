@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+)
+
+// SubspaceOperatorGuard restricts the moderation and webhook routes of a subspace to its
+// operators: the creator and the moderators named in its create event. Requests are authenticated with
+// NIP-98, whatever the mode of their route group.
+type SubspaceOperatorGuard struct {
+	store    storage.Store
+	verifier *Authenticator // Verifies signed requests from any public key
+}
+
+// NewSubspaceOperatorGuard creates the operator guard. auth supplies the URL and maximum age
+// of signed requests.
+func NewSubspaceOperatorGuard(store storage.Store, auth config.AuthConfig) *SubspaceOperatorGuard {
+	auth.PubKeys = nil
+	return &SubspaceOperatorGuard{store: store, verifier: &Authenticator{cfg: auth, now: time.Now}}
+}
+
+// Middleware rejects operator requests without a valid signature with 401 Unauthorized
+// and those signed by someone other than an operator of the subspace with 403 Forbidden.
+// Requests for unknown subspaces get 404 Not Found.
+func (g *SubspaceOperatorGuard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pubKey, err := g.verifier.VerifyRequest(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", authScheme)
+			handlers.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		meta, err := g.store.GetSubspaceMeta(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			handlers.StoreError(w, err, "Failed to get subspace metadata")
+			return
+		}
+		if meta == nil {
+			handlers.Error(w, "Subspace not found", http.StatusNotFound)
+			return
+		}
+
+		operator := pubKey == meta.Creator
+		for _, moderator := range meta.Moderators {
+			operator = operator || pubKey == moderator
+		}
+		if !operator {
+			handlers.Error(w, "Only the subspace creator and moderators may operate it", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(handlers.WithOperator(r.Context(), pubKey)))
+	})
+}
+
+// SignerMiddleware rejects requests without a valid NIP-98 signature, from any public key,
+// with 401 Unauthorized. The signer is passed on to the handler, which decides what it may do.
+func (g *SubspaceOperatorGuard) SignerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pubKey, err := g.verifier.VerifyRequest(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", authScheme)
+			handlers.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(handlers.WithSigner(r.Context(), pubKey)))
+	})
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Test that only the creator and moderators of a subspace may moderate it
+func TestSubspaceOperatorGuard(t *testing.T) {
+	ctx := context.Background()
+	creatorKey, moderatorKey := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	moderator, _ := nostr.GetPublicKey(moderatorKey)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000f1"
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("operator"))
+	// The post is saved before the create event restricts the subspace
+	post := &nostr.Event{CreatedAt: 1700000100, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}
+	create := &nostr.Event{CreatedAt: 1700000000, Kind: 30100, Tags: nostr.Tags{{"sid", sid}, {"subspace_name", "Guarded"}, {"moderator", moderator}}}
+	require.NoError(t, post.Sign(nostr.GeneratePrivateKey()))
+	require.NoError(t, create.Sign(creatorKey))
+	require.NoError(t, store.SaveEvents(ctx, []*nostr.Event{post, create}))
+	spammer := post.PubKey
+
+	cfg := config.Default()
+	cfg.OrbitDB.Directory = t.TempDir()
+	handler := NewRouter(store, cfg).Handler()
+
+	// Auth events are accepted once, the nonce tells repeated requests apart
+	signed := 0
+	request := func(method, path, key string) int {
+		req, err := http.NewRequest(method, "http://example.com"+path, http.NoBody)
+		require.NoError(t, err)
+		if key != "" {
+			signed++
+			event := &nostr.Event{
+				Kind:      HTTPAuthKind,
+				CreatedAt: nostr.Now(),
+				Tags:      nostr.Tags{{"u", req.URL.String()}, {"method", req.Method}, {"nonce", strconv.Itoa(signed)}},
+			}
+			require.NoError(t, event.Sign(key))
+			data, _ := json.Marshal(event)
+			req.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString(data))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	ban := "/api/subspaces/" + sid + "/bans/" + spammer
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPut, ban, ""))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPut, ban, nostr.GeneratePrivateKey()))
+	assert.Equal(t, http.StatusNotFound, request(http.MethodPut, "/api/subspaces/0xunknown/bans/spammer", creatorKey))
+	assert.Equal(t, http.StatusNoContent, request(http.MethodPut, ban, moderatorKey))
+
+	moderation, err := store.GetSubspaceModeration(ctx, sid)
+	require.NoError(t, err)
+	require.NotNil(t, moderation.Banned[spammer])
+	assert.Equal(t, moderator, moderation.Banned[spammer].By)
+
+	hide := "/api/subspaces/" + sid + "/hidden/" + post.ID
+	assert.Equal(t, http.StatusNotFound, request(http.MethodPut, "/api/subspaces/"+sid+"/hidden/unknown", creatorKey))
+	assert.Equal(t, http.StatusNoContent, request(http.MethodPut, hide, creatorKey))
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, hide, creatorKey))
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, hide, creatorKey), "the event is no longer hidden")
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, ban, creatorKey))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/subspaces/"+sid+"/moderation", ""))
+
+	// Registering and deleting webhooks is also left to the operators
+	webhooks := "/api/subspaces/" + sid + "/webhooks"
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, webhooks, ""))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodDelete, webhooks+"/abc", nostr.GeneratePrivateKey()))
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, webhooks+"/abc", creatorKey))
+
+	// Operators may moderate even if the public keys allowed to authenticate don't name them
+	cfg.Auth.Groups = map[string]string{"subspaces": config.AuthModeReadOnly}
+	cfg.Auth.PubKeys = []string{"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"}
+	handler = NewRouter(store, cfg).Handler()
+	assert.Equal(t, http.StatusNoContent, request(http.MethodPut, ban, moderatorKey))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPut, ban, nostr.GeneratePrivateKey()))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/api/subspaces/"+sid+"/moderation", moderatorKey),
+		"routes without their own guard still need an allowed public key")
+}
+
+// Test that annotations need a signed request, record their author and are only deleted by
+// it or an operator of the event's subspace
+func TestEventAnnotationAuthors(t *testing.T) {
+	ctx := context.Background()
+	creatorKey, authorKey := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	author, _ := nostr.GetPublicKey(authorKey)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000f2"
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("annotations"))
+	create := &nostr.Event{CreatedAt: 1700000000, Kind: 30100, Tags: nostr.Tags{{"sid", sid}, {"subspace_name", "Annotated"}}}
+	post := &nostr.Event{CreatedAt: 1700000100, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}
+	require.NoError(t, create.Sign(creatorKey))
+	require.NoError(t, post.Sign(nostr.GeneratePrivateKey()))
+	require.NoError(t, store.SaveEvents(ctx, []*nostr.Event{create, post}))
+
+	cfg := config.Default()
+	cfg.OrbitDB.Directory = t.TempDir()
+	handler := NewRouter(store, cfg).Handler()
+
+	signed := 0
+	request := func(method, path, body, key string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "http://example.com"+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if key != "" {
+			signed++
+			event := &nostr.Event{
+				Kind:      HTTPAuthKind,
+				CreatedAt: nostr.Now(),
+				Tags:      nostr.Tags{{"u", req.URL.String()}, {"method", req.Method}, {"nonce", strconv.Itoa(signed)}},
+			}
+			require.NoError(t, event.Sign(key))
+			data, _ := json.Marshal(event)
+			req.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString(data))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	annotations := "/api/events/" + post.ID + "/annotations"
+	label := `{"type":"moderation_label","value":"spam"}`
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, annotations, label, "").Code)
+
+	w := request(http.MethodPost, annotations, label, authorKey)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var first orbitdb.EventAnnotation
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&first))
+	assert.Equal(t, author, first.Author)
+
+	w = request(http.MethodPost, annotations, label, authorKey)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var second orbitdb.EventAnnotation
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&second))
+
+	assert.Equal(t, http.StatusForbidden, request(http.MethodDelete, annotations+"/"+first.ID, "", nostr.GeneratePrivateKey()).Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, annotations+"/unknown", "", authorKey).Code)
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, annotations+"/"+first.ID, "", authorKey).Code)
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, annotations+"/"+second.ID, "", creatorKey).Code, "operators remove any annotation of their subspace")
+}
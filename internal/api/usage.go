@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// APIKeyHeader is the request header carrying the client API key
+const APIKeyHeader = "X-API-Key"
+
+// anonymousKeyID identifies requests without an API key
+const anonymousKeyID = "anonymous"
+
+// UsageTracker aggregates per-API-key usage in memory and persists it to the store periodically
+type UsageTracker struct {
+	store        storage.Store
+	cfg          config.UsageConfig
+	mu           sync.Mutex
+	pending      map[string]*orbitdb.APIUsage // Unflushed usage by day and key ID
+	todayCounts  map[string]uint64            // Requests seen today by key ID, for quota checks
+	day          string
+	stopFlushing context.CancelFunc
+	done         chan struct{}
+}
+
+// NewUsageTracker creates a new UsageTracker
+func NewUsageTracker(store storage.Store, cfg config.UsageConfig) *UsageTracker {
+	return &UsageTracker{
+		store:       store,
+		cfg:         cfg,
+		pending:     make(map[string]*orbitdb.APIUsage),
+		todayCounts: make(map[string]uint64),
+		day:         usageDay(time.Now()),
+	}
+}
+
+// KeyID returns the identifier under which an API key's usage is recorded.
+// Keys are hashed so raw credentials never end up in the replicated store.
+func KeyID(apiKey string) string {
+	if apiKey == "" {
+		return anonymousKeyID
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Helper function: format the UTC day of a time
+func usageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// usageResponseWriter records the status code and body size of a response
+type usageResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  uint64
+}
+
+func (w *usageResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *usageResponseWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += uint64(n)
+	return n, err
+}
+
+// Unwrap returns the wrapped writer, so handlers can flush streamed responses
+func (w *usageResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware records usage for every request and enforces daily request quotas
+func (t *UsageTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey := r.Header.Get(APIKeyHeader)
+		keyID := KeyID(apiKey)
+
+		if quota := t.quotaFor(apiKey); quota > 0 && t.requestsToday(r.Context(), keyID) >= quota {
+			handlers.WriteError(w, http.StatusTooManyRequests, handlers.CodeQuotaExceeded, "Daily request quota exceeded")
+			return
+		}
+
+		rw := &usageResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		var eventsWritten uint64
+		if r.Method == http.MethodPost && r.URL.Path == "/api/events" && rw.status == http.StatusCreated {
+			eventsWritten = 1
+		}
+		t.record(keyID, eventsWritten, rw.bytes)
+	})
+}
+
+// quotaFor returns the daily request quota of an API key, 0 for unlimited
+func (t *UsageTracker) quotaFor(apiKey string) uint64 {
+	if quota, exists := t.cfg.Quotas[apiKey]; exists {
+		return quota
+	}
+	return t.cfg.DailyRequestQuota
+}
+
+// requestsToday returns the number of requests made today by a key, loading
+// the persisted count the first time the key is seen on a day
+func (t *UsageTracker) requestsToday(ctx context.Context, keyID string) uint64 {
+	t.mu.Lock()
+	t.rollDay()
+	count, seen := t.todayCounts[keyID]
+	day := t.day
+	t.mu.Unlock()
+
+	if seen {
+		return count
+	}
+
+	var persisted uint64
+	usage, err := t.store.GetUsage(ctx, day, keyID)
+	if err != nil {
+		zap.L().Warn("Failed to load usage for quota check", zap.String("key", keyID), zap.Error(err))
+	} else if usage != nil {
+		persisted = usage.Requests
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if current, exists := t.todayCounts[keyID]; exists {
+		return current
+	}
+	t.todayCounts[keyID] = persisted
+	return persisted
+}
+
+// record adds one request to the pending usage of a key
+func (t *UsageTracker) record(keyID string, eventsWritten, bytesServed uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rollDay()
+	pendingKey := t.day + "|" + keyID
+	usage, exists := t.pending[pendingKey]
+	if !exists {
+		usage = &orbitdb.APIUsage{Day: t.day, KeyID: keyID}
+		t.pending[pendingKey] = usage
+	}
+	usage.Requests++
+	usage.EventsWritten += eventsWritten
+	usage.BytesServed += bytesServed
+	t.todayCounts[keyID]++
+}
+
+// rollDay resets the quota counters when the UTC day changes. Pending usage is
+// keyed by day so nothing is attributed to the wrong day. Must be called with mu held.
+func (t *UsageTracker) rollDay() {
+	today := usageDay(time.Now())
+	if today == t.day {
+		return
+	}
+	t.day = today
+	t.todayCounts = make(map[string]uint64)
+}
+
+// Flush persists all pending usage to the store
+func (t *UsageTracker) Flush(ctx context.Context) {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[string]*orbitdb.APIUsage)
+	t.mu.Unlock()
+
+	for _, usage := range pending {
+		if err := t.store.AddUsage(ctx, usage); err != nil {
+			zap.L().Warn("Failed to persist API usage", zap.String("key", usage.KeyID), zap.Error(err))
+		}
+	}
+}
+
+// Start periodically flushes usage until Stop is called
+func (t *UsageTracker) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	t.stopFlushing = cancel
+	t.done = make(chan struct{})
+
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(t.cfg.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.Flush(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the flush loop and persists the remaining usage
+func (t *UsageTracker) Stop(ctx context.Context) {
+	if t.stopFlushing != nil {
+		t.stopFlushing()
+		<-t.done
+	}
+	t.Flush(ctx)
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+)
+
+// APIVersionHeader carries the API version of a response. Clients of the unversioned paths
+// may send it to ask for a version.
+const APIVersionHeader = "API-Version"
+
+// supportedAPIVersions are the API versions this node serves
+var supportedAPIVersions = map[int]bool{1: true}
+
+// splitAPIVersion splits a versioned path such as /api/v1/events into its version and the
+// unversioned route /api/events. ok is false for unversioned paths.
+func splitAPIVersion(path string) (version int, route string, ok bool) {
+	rest, found := strings.CutPrefix(path, "/api/v")
+	if !found {
+		return 0, path, false
+	}
+	number, tail, _ := strings.Cut(rest, "/")
+	version, err := strconv.Atoi(number)
+	if err != nil || version < 1 {
+		return 0, path, false
+	}
+	if tail == "" {
+		return version, "/api", true
+	}
+	return version, "/api/" + tail, true
+}
+
+// parseAPIVersion parses the API-Version header, accepting 1 and v1
+func parseAPIVersion(value string) (int, error) {
+	version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "v"))
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid %s %q", APIVersionHeader, value)
+	}
+	return version, nil
+}
+
+// versioning serves the routes under /api/v{n}/ as well as under their deprecated
+// unversioned /api/ paths. Versioned requests are routed to the unversioned route, so every
+// middleware sees one path per route, and the version is passed to the handlers in the
+// request context. Responses to unversioned paths are flagged deprecated and link to
+// their versioned successor.
+func versioning(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") && r.URL.Path != "/api" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		version, route, versioned := splitAPIVersion(r.URL.Path)
+		if header := r.Header.Get(APIVersionHeader); header != "" {
+			requested, err := parseAPIVersion(header)
+			if err != nil {
+				handlers.WriteError(w, http.StatusBadRequest, handlers.CodeBadRequest, err.Error())
+				return
+			}
+			if versioned && requested != version {
+				handlers.WriteError(w, http.StatusBadRequest, handlers.CodeBadRequest,
+					fmt.Sprintf("%s %d does not match the path version %d", APIVersionHeader, requested, version))
+				return
+			}
+			version = requested
+		}
+		if version == 0 {
+			version = handlers.CurrentAPIVersion
+		}
+		if !supportedAPIVersions[version] {
+			handlers.WriteError(w, http.StatusNotAcceptable, handlers.CodeUnsupportedVersion,
+				fmt.Sprintf("API version %d is not supported, the current version is %d", version, handlers.CurrentAPIVersion))
+			return
+		}
+
+		w.Header().Set(APIVersionHeader, strconv.Itoa(version))
+		if !versioned {
+			successor := fmt.Sprintf("/api/v%d%s", version, strings.TrimPrefix(r.URL.Path, "/api"))
+			w.Header().Set("Deprecation", "true")
+			w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		}
+
+		routed := r.WithContext(handlers.WithAPIVersion(r.Context(), version))
+		if versioned {
+			u := *r.URL
+			u.Path = route
+			if u.RawPath != "" {
+				_, u.RawPath, _ = splitAPIVersion(u.RawPath)
+			}
+			routed.URL = &u
+		}
+		next.ServeHTTP(w, routed)
+	})
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/api/handlers"
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+func TestSplitAPIVersion(t *testing.T) {
+	version, route, ok := splitAPIVersion("/api/v1/events/abc")
+	assert.True(t, ok)
+	assert.Equal(t, 1, version)
+	assert.Equal(t, "/api/events/abc", route)
+
+	_, _, ok = splitAPIVersion("/api/events")
+	assert.False(t, ok)
+	_, _, ok = splitAPIVersion("/api/validate")
+	assert.False(t, ok, "routes starting with v aren't versions")
+}
+
+// Test that routes are served under /api/v1 and their deprecated unversioned paths
+func TestVersionedRoutes(t *testing.T) {
+	cfg := config.Default()
+	cfg.OrbitDB.Directory = t.TempDir()
+	handler := NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("versions")), cfg).Handler()
+	get := func(path, version string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if version != "" {
+			req.Header.Set(APIVersionHeader, version)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/v1/health", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(APIVersionHeader))
+	assert.Empty(t, w.Header().Get("Deprecation"))
+
+	w = get("/api/health", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(APIVersionHeader))
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/v1/health>; rel="successor-version"`, w.Header().Get("Link"))
+
+	w = get("/api/health", "v1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = get("/api/v2/health", "")
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Contains(t, w.Body.String(), handlers.CodeUnsupportedVersion)
+
+	w = get("/api/health", "2")
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+
+	w = get("/api/v1/health", "2")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the header must match the path version")
+
+	// Middleware matching route prefixes sees versioned paths too
+	w = get("/api/v1/admin/usage", "")
+	assert.Equal(t, get("/api/admin/usage", "").Code, w.Code)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SubspaceHeat counts requests per subspace so the next run can warm up the hottest ones
+type SubspaceHeat struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// subspaceHeatFile is the persisted form of SubspaceHeat
+type subspaceHeatFile struct {
+	Saved     int64             `json:"saved"`     // Save timestamp
+	Subspaces map[string]uint64 `json:"subspaces"` // Request counts by subspace ID
+}
+
+// NewSubspaceHeat creates an empty SubspaceHeat
+func NewSubspaceHeat() *SubspaceHeat {
+	return &SubspaceHeat{counts: make(map[string]uint64)}
+}
+
+// LoadSubspaceHeat loads the counts saved by the previous run. The counts are halved so
+// subspaces that are no longer requested fade out over a few runs. A missing file yields
+// empty counts.
+func LoadSubspaceHeat(path string) (*SubspaceHeat, error) {
+	heat := NewSubspaceHeat()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return heat, nil
+	}
+	if err != nil {
+		return heat, err
+	}
+
+	var saved subspaceHeatFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return heat, err
+	}
+	for subspaceID, count := range saved.Subspaces {
+		if count /= 2; count > 0 {
+			heat.counts[subspaceID] = count
+		}
+	}
+	return heat, nil
+}
+
+// Middleware counts requests to subspace endpoints. It must be installed on the mux
+// router so the route variables are set.
+func (h *SubspaceHeat) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/subspaces/") {
+			if subspaceID := mux.Vars(r)["id"]; subspaceID != "" {
+				h.mu.Lock()
+				h.counts[subspaceID]++
+				h.mu.Unlock()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Hottest returns the IDs of the n most requested subspaces, most requested first
+func (h *SubspaceHeat) Hottest(n int) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ids := make([]string, 0, len(h.counts))
+	for subspaceID := range h.counts {
+		ids = append(ids, subspaceID)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if h.counts[ids[i]] != h.counts[ids[j]] {
+			return h.counts[ids[i]] > h.counts[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+	return ids
+}
+
+// Save writes the counts to path, replacing the previous file atomically
+func (h *SubspaceHeat) Save(path string) error {
+	h.mu.Lock()
+	saved := subspaceHeatFile{
+		Saved:     time.Now().Unix(),
+		Subspaces: make(map[string]uint64, len(h.counts)),
+	}
+	for subspaceID, count := range h.counts {
+		saved.Subspaces[subspaceID] = count
+	}
+	h.mu.Unlock()
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Helper function: get the path of the warm-up statistics file
+func warmupStatsPath(directory, statsFile string) string {
+	if filepath.IsAbs(statsFile) {
+		return statsFile
+	}
+	return filepath.Join(directory, statsFile)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Test that subspace requests are counted, saved on stop and preloaded by the next run
+func TestRouterWarmup(t *testing.T) {
+	cfg := config.Default()
+	cfg.OrbitDB.Directory = t.TempDir()
+	cfg.Warmup.Enabled = true
+	cfg.Warmup.Subspaces = 1
+
+	store := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("warmup"))
+	store.EnableReadCache(time.Minute)
+	ctx := context.Background()
+	for _, event := range goldenFixtures {
+		require.NoError(t, store.SaveEvent(ctx, event))
+	}
+
+	// The first run has no statistics and only loads the global leaderboard
+	first := NewRouter(store, cfg)
+	handler := first.Handler()
+	assert.False(t, first.Ready())
+	assert.Equal(t, http.StatusServiceUnavailable, serve(handler, http.MethodGet, "/api/ready", nil).Code)
+	first.Start(ctx)
+	<-first.warmupDone
+	assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "/api/ready", nil).Code)
+
+	other := "0x2222222222222222222222222222222222222222222222222222222222222222"
+	serve(handler, http.MethodGet, "/api/subspaces/"+goldenSubspace+"/keys", nil)
+	serve(handler, http.MethodGet, "/api/subspaces/"+goldenSubspace+"/users", nil)
+	serve(handler, http.MethodGet, "/api/subspaces/"+other, nil)
+	serve(handler, http.MethodGet, "/api/users/"+goldenMember+"/stats", nil)
+	first.Stop(ctx)
+
+	heat, err := LoadSubspaceHeat(filepath.Join(cfg.OrbitDB.Directory, cfg.Warmup.StatsFile))
+	require.NoError(t, err)
+	assert.Equal(t, []string{goldenSubspace}, heat.Hottest(1))
+	assert.Empty(t, heat.Hottest(2)[1:], "counts of 1 fade out after a restart")
+
+	// The next run preloads the hottest subspace
+	second := NewRouter(store, cfg)
+	assert.Equal(t, []string{goldenSubspace}, second.heat.Hottest(cfg.Warmup.Subspaces))
+	second.Start(ctx)
+	<-second.warmupDone
+	assert.True(t, second.Ready())
+	second.Stop(ctx)
+}
+
+// Test that the router is ready immediately without warm-up
+func TestRouterReadyWithoutWarmup(t *testing.T) {
+	cfg := config.Default()
+	cfg.OrbitDB.Directory = t.TempDir()
+	router := NewRouter(orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("ready")), cfg)
+
+	assert.True(t, router.Ready())
+	assert.Equal(t, http.StatusOK, serve(router.Handler(), http.MethodGet, "/api/ready", nil).Code)
+}
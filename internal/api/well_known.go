@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// WellKnownPath is where the node describes the databases it serves
+const WellKnownPath = "/.well-known/crelay.json"
+
+// NodeInfo describes the IPFS node serving the databases
+type NodeInfo struct {
+	PeerID     string   `json:"peer_id"`        // Peer ID of the IPFS node
+	Multiaddrs []string `json:"multiaddrs"`     // Addresses to connect to the node, including the peer ID
+	IPNS       string   `json:"ipns,omitempty"` // IPNS name the document is published under, empty if it isn't
+}
+
+// WellKnownDocument tells other nodes which databases to open and where to replicate them from
+type WellKnownDocument struct {
+	orbitdb.DatabaseInfo
+	Node *NodeInfo `json:"node,omitempty"` // Serving node, nil if unknown
+}
+
+// SetNodeInfo sets the function describing the IPFS node in the well-known document. Must be
+// called before Handler.
+func (r *Router) SetNodeInfo(node func() NodeInfo) {
+	r.node = node
+}
+
+// WellKnown returns the document describing the databases the node serves
+func (r *Router) WellKnown() WellKnownDocument {
+	doc := WellKnownDocument{DatabaseInfo: r.store.Databases()}
+	if r.node != nil {
+		node := r.node()
+		doc.Node = &node
+	}
+	return doc
+}
+
+// serveWellKnown handles requests for the well-known document
+func (r *Router) serveWellKnown(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.WellKnown())
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// Reasons the write limits are tightened
+const (
+	LoadReasonReplicationBacklog = "replication_backlog"
+	LoadReasonQueryQueue         = "query_queue"
+)
+
+// idleBucketTimeout is how long an unused full bucket is kept
+const idleBucketTimeout = 10 * time.Minute
+
+// LoadSample describes the load of the node at one point in time
+type LoadSample struct {
+	ReplicationBacklog int `json:"replication_backlog"` // Entries queued for replication from peers
+	QueueDepth         int `json:"queue_depth"`         // Full-scan queries waiting for a slot
+}
+
+// WriteLimiter limits event writes per API key with token buckets. In adaptive mode the
+// node load is sampled periodically and the limits shrink while replication or the query
+// queue falls behind, so the node can converge, and recover once the load is gone.
+// A nil WriteLimiter admits everything.
+type WriteLimiter struct {
+	cfg  config.RateLimitConfig
+	load func() LoadSample
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	factor  float64 // Fraction of the configured limits currently applied
+	reason  string  // Why the limits are tightened, empty at full rate
+	sample  LoadSample
+
+	admitted atomic.Uint64
+	limited  atomic.Uint64
+
+	stopSampling context.CancelFunc
+	done         chan struct{}
+}
+
+// tokenBucket holds the write allowance of one API key
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// WriteLimiterStats describes the state of the write limiter
+type WriteLimiterStats struct {
+	Enabled         bool       `json:"enabled"`           // Whether writes are limited
+	Adaptive        bool       `json:"adaptive"`          // Whether limits follow the node load
+	WritesPerSecond float64    `json:"writes_per_second"` // Configured writes per second per key
+	EffectiveRate   float64    `json:"effective_rate"`    // Writes per second per key currently allowed
+	Factor          float64    `json:"factor"`            // Fraction of the configured limits applied
+	Reason          string     `json:"reason,omitempty"`  // Why the limits are tightened
+	Load            LoadSample `json:"load"`              // Last load sample
+	Admitted        uint64     `json:"admitted"`          // Writes admitted since start
+	Limited         uint64     `json:"limited"`           // Writes rejected since start
+}
+
+// RateLimitedResponse is the body of 429 responses, telling clients how long to back off
+type RateLimitedResponse struct {
+	Error        string  `json:"error"`            // Always "rate_limited"
+	RetryAfterMs int64   `json:"retry_after_ms"`   // Time until the next write is allowed
+	Factor       float64 `json:"factor"`           // Fraction of the configured limits applied
+	Reason       string  `json:"reason,omitempty"` // Why the limits are tightened
+}
+
+// NewWriteLimiter creates a write limiter. load samples the node load in adaptive mode.
+// Returns nil, which admits everything, if rate limiting is disabled.
+func NewWriteLimiter(cfg config.RateLimitConfig, load func() LoadSample) *WriteLimiter {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &WriteLimiter{
+		cfg:     cfg,
+		load:    load,
+		buckets: make(map[string]*tokenBucket),
+		factor:  1,
+	}
+}
+
+// Allow takes one write from the bucket of a key. If the bucket is empty it returns false
+// and how long until the next write is allowed.
+func (l *WriteLimiter) Allow(keyID string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	rate := l.cfg.WritesPerSecond * l.factor
+	burst := math.Max(1, float64(l.cfg.Burst)*l.factor)
+
+	bucket, exists := l.buckets[keyID]
+	if !exists {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		l.buckets[keyID] = bucket
+	}
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		l.admitted.Add(1)
+		return true, 0
+	}
+
+	l.limited.Add(1)
+	wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	return false, wait
+}
+
+// Adjust updates the applied fraction of the limits from a load sample. The limits halve
+// on every overloaded sample down to the minimum factor and double back once it passes.
+func (l *WriteLimiter) Adjust(sample LoadSample) {
+	if l == nil {
+		return
+	}
+
+	var reason string
+	switch {
+	case l.cfg.BacklogThreshold > 0 && sample.ReplicationBacklog >= l.cfg.BacklogThreshold:
+		reason = LoadReasonReplicationBacklog
+	case l.cfg.QueueThreshold > 0 && sample.QueueDepth >= l.cfg.QueueThreshold:
+		reason = LoadReasonQueryQueue
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sample = sample
+	if reason != "" {
+		l.factor = math.Max(l.cfg.MinFactor, l.factor/2)
+		l.reason = reason
+	} else {
+		l.factor = math.Min(1, l.factor*2)
+		if l.factor == 1 {
+			l.reason = ""
+		}
+	}
+
+	// Forget keys that have been idle long enough for their bucket to be full
+	now := time.Now()
+	for keyID, bucket := range l.buckets {
+		if now.Sub(bucket.last) > idleBucketTimeout {
+			delete(l.buckets, keyID)
+		}
+	}
+}
+
+// Start samples the node load until Stop is called, in adaptive mode only
+func (l *WriteLimiter) Start(ctx context.Context) {
+	if l == nil || !l.cfg.Adaptive {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	l.stopSampling = cancel
+	l.done = make(chan struct{})
+
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(l.cfg.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.Adjust(l.load())
+			}
+		}
+	}()
+}
+
+// Stop stops sampling the node load
+func (l *WriteLimiter) Stop() {
+	if l == nil || l.stopSampling == nil {
+		return
+	}
+	l.stopSampling()
+	<-l.done
+}
+
+// Limit wraps a write handler so it runs only if the API key has writes left. Rejected
+// requests get 429 Too Many Requests with a Retry-After header and a RateLimitedResponse.
+func (l *WriteLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.Allow(KeyID(r.Header.Get(APIKeyHeader)))
+		if ok {
+			next(w, r)
+			return
+		}
+
+		stats := l.Stats()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(&RateLimitedResponse{
+			Error:        "rate_limited",
+			RetryAfterMs: wait.Milliseconds(),
+			Factor:       stats.Factor,
+			Reason:       stats.Reason,
+		})
+	}
+}
+
+// Stats returns the current limiter state
+func (l *WriteLimiter) Stats() WriteLimiterStats {
+	if l == nil {
+		return WriteLimiterStats{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return WriteLimiterStats{
+		Enabled:         true,
+		Adaptive:        l.cfg.Adaptive,
+		WritesPerSecond: l.cfg.WritesPerSecond,
+		EffectiveRate:   l.cfg.WritesPerSecond * l.factor,
+		Factor:          l.factor,
+		Reason:          l.reason,
+		Load:            l.sample,
+		Admitted:        l.admitted.Load(),
+		Limited:         l.limited.Load(),
+	}
+}
+
+// ServeStats handles requests for the limiter state
+func (l *WriteLimiter) ServeStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.Stats())
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// Test that the write limits shrink under load and recover once it passes
+func TestWriteLimiterAdaptive(t *testing.T) {
+	cfg := config.Default().RateLimit
+	cfg.Enabled = true
+	cfg.Adaptive = true
+	cfg.WritesPerSecond = 0.001 // No refill during the test
+	cfg.Burst = 8
+	cfg.MinFactor = 0.25
+
+	limiter := NewWriteLimiter(cfg, nil)
+	handler := limiter.Limit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	write := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/events", nil)
+		req.Header.Set(APIKeyHeader, apiKey)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	// A replication backlog halves the limits down to the minimum factor
+	overloaded := LoadSample{ReplicationBacklog: cfg.BacklogThreshold}
+	limiter.Adjust(overloaded)
+	limiter.Adjust(overloaded)
+	limiter.Adjust(overloaded)
+	stats := limiter.Stats()
+	assert.Equal(t, 0.25, stats.Factor)
+	assert.Equal(t, LoadReasonReplicationBacklog, stats.Reason)
+
+	// New keys get the reduced burst of 2 writes
+	assert.Equal(t, http.StatusCreated, write("key-a").Code)
+	assert.Equal(t, http.StatusCreated, write("key-a").Code)
+	w := write("key-a")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	var response RateLimitedResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "rate_limited", response.Error)
+	assert.Positive(t, response.RetryAfterMs)
+	assert.Equal(t, LoadReasonReplicationBacklog, response.Reason)
+
+	// Other keys have their own buckets
+	assert.Equal(t, http.StatusCreated, write("key-b").Code)
+
+	// The limits recover once the load is gone
+	limiter.Adjust(LoadSample{})
+	limiter.Adjust(LoadSample{})
+	stats = limiter.Stats()
+	assert.Equal(t, 1.0, stats.Factor)
+	assert.Empty(t, stats.Reason)
+	assert.Equal(t, uint64(3), stats.Admitted)
+	assert.Equal(t, uint64(1), stats.Limited)
+}
+
+// Test that a disabled write limiter admits everything
+func TestWriteLimiterDisabled(t *testing.T) {
+	limiter := NewWriteLimiter(config.Default().RateLimit, nil)
+	assert.Nil(t, limiter)
+
+	ok, _ := limiter.Allow("key")
+	assert.True(t, ok)
+	assert.False(t, limiter.Stats().Enabled)
+}
@@ -0,0 +1,1062 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the service configuration
+type Config struct {
+	API              APIConfig              `yaml:"api"`
+	OrbitDB          OrbitDBConfig          `yaml:"orbitdb"`
+	Relay            RelayConfig            `yaml:"relay"`
+	P2P              P2PConfig              `yaml:"p2p"`
+	Publish          PublishConfig          `yaml:"publish"`
+	AccessController AccessControllerConfig `yaml:"access_controller"`
+	Log              LogConfig              `yaml:"log"`
+	Usage            UsageConfig            `yaml:"usage"`
+	Webhooks         WebhooksConfig         `yaml:"webhooks"`
+	Warmup           WarmupConfig           `yaml:"warmup"`
+	Health           HealthConfig           `yaml:"health"`
+	RateLimit        RateLimitConfig        `yaml:"rate_limit"`
+	SubspaceIDs      SubspaceIDConfig       `yaml:"subspace_ids"`
+	Causality        CausalityConfig        `yaml:"causality"`
+	LiveConfig       LiveConfigConfig       `yaml:"live_config"`
+	ResponseCache    ResponseCacheConfig    `yaml:"response_cache"`
+	Compression      CompressionConfig      `yaml:"compression"`
+	Federation       FederationConfig       `yaml:"federation"`
+	DerivedData      DerivedDataConfig      `yaml:"derived_data"`
+	Auth             AuthConfig             `yaml:"auth"`
+	Admin            AdminConfig            `yaml:"admin"`
+	Policy           PolicyConfig           `yaml:"policy"`
+	Moderation       ModerationConfig       `yaml:"moderation"`
+	Retention        RetentionConfig        `yaml:"retention"`
+	Snapshot         SnapshotConfig         `yaml:"snapshot"`
+	ReadOnly         ReadOnlyConfig         `yaml:"read_only"`
+	Forward          ForwardConfig          `yaml:"forward"`
+	ReadIndex        ReadIndexConfig        `yaml:"read_index"`
+	UserStatsCache   UserStatsCacheConfig   `yaml:"user_stats_cache"`
+	Tracing          TracingConfig          `yaml:"tracing"`
+	Schema           SchemaConfig           `yaml:"schema"`
+}
+
+// APIConfig holds HTTP API settings
+type APIConfig struct {
+	Port                 string        `yaml:"port"`                   // API service port
+	ShutdownTimeout      time.Duration `yaml:"shutdown_timeout"`       // Time allowed for in-flight requests on shutdown
+	MaxConcurrentQueries int           `yaml:"max_concurrent_queries"` // Maximum concurrent full-scan queries, 0 for unlimited
+	QueryQueueTimeout    time.Duration `yaml:"query_queue_timeout"`    // How long a query waits for a slot before it is rejected
+	UnixSocket           string        `yaml:"unix_socket"`            // Unix domain socket to serve on in addition to the port, empty to disable
+	UnixSocketMode       string        `yaml:"unix_socket_mode"`       // Octal permissions of the socket file, e.g. "0660"
+	RequestTimeout       time.Duration `yaml:"request_timeout"`        // Deadline of the storage calls of a request, 0 for none
+	QueryTimeout         time.Duration `yaml:"query_timeout"`          // Deadline of a single event or subspace user scan, 0 for none
+	PartialResults       bool          `yaml:"partial_results"`        // Return the events scanned before query_timeout instead of failing with 504
+	AccessLog            bool          `yaml:"access_log"`             // Log every request with its status, size and latency
+}
+
+// OrbitDBConfig holds OrbitDB settings
+type OrbitDBConfig struct {
+	Directory  string              `yaml:"directory"`  // OrbitDB data storage directory
+	Address    string              `yaml:"address"`    // OrbitDB address to connect to
+	StoreType  string              `yaml:"store_type"` // eventlog|keyvalue|docstore
+	Create     bool                `yaml:"create"`     // Create the database if it does not exist locally
+	Standalone bool                `yaml:"standalone"` // Create a new database named Name in this process instead of opening Address
+	Name       string              `yaml:"name"`       // Database name used in standalone mode
+	MigrateTo  string              `yaml:"migrate_to"` // Address of a new database to migrate Address into, empty to disable
+	Stores     OrbitDBStoresConfig `yaml:"stores"`     // Separate databases by document type, empty to keep every document in Address
+}
+
+// OrbitDBStoresConfig holds the addresses of the databases documents are split into
+type OrbitDBStoresConfig struct {
+	Events    string `yaml:"events"`    // Database holding nostr events
+	Causality string `yaml:"causality"` // Database holding causality counters
+	Stats     string `yaml:"stats"`     // Database holding user statistics and the remaining documents
+}
+
+// Enabled reports whether any store address is set
+func (s OrbitDBStoresConfig) Enabled() bool {
+	return s.Events != "" || s.Causality != "" || s.Stats != ""
+}
+
+// RelayConfig holds relay peer settings
+type RelayConfig struct {
+	Multiaddrs     []string      `yaml:"multiaddrs"`      // Relay node multiaddrs to connect to
+	BootstrapPeers []string      `yaml:"bootstrap_peers"` // Other peer multiaddrs, e.g. nodes replicating the same databases
+	CheckInterval  time.Duration `yaml:"check_interval"`  // Time between connection liveness checks
+	MinBackoff     time.Duration `yaml:"min_backoff"`     // Wait after the first failed reconnection, doubled on each further failure
+	MaxBackoff     time.Duration `yaml:"max_backoff"`     // Maximum wait between reconnection attempts
+	SwarmKey       string        `yaml:"swarm_key"`       // Path of a libp2p private network swarm key file, empty for the public IPFS network
+}
+
+// AutoNAT service modes
+const (
+	AutoNATEnabled  = "enabled"  // Answer other peers' reachability checks
+	AutoNATDisabled = "disabled" // Don't answer reachability checks
+)
+
+// P2PConfig holds the libp2p listen addresses, transports and NAT traversal of the IPFS node
+type P2PConfig struct {
+	ListenAddrs  []string `yaml:"listen_addrs"`  // Multiaddrs to listen on
+	QUIC         bool     `yaml:"quic"`          // Enable the QUIC transport
+	WebSocket    bool     `yaml:"websocket"`     // Enable the WebSocket transport
+	AutoNAT      string   `yaml:"autonat"`       // AutoNAT service mode: enabled|disabled, empty for the kubo default
+	HolePunching bool     `yaml:"hole_punching"` // Open direct connections through NATs with DCUtR
+	RelayClient  bool     `yaml:"relay_client"`  // Reserve circuit-relay-v2 slots when not publicly reachable
+	StaticRelays []string `yaml:"static_relays"` // Relay multiaddrs to reserve slots on, empty to discover relays
+	RelayService bool     `yaml:"relay_service"` // Act as a circuit-relay-v2 relay for other peers
+	PortMapping  bool     `yaml:"port_mapping"`  // Map the listen ports on the router with UPnP or NAT-PMP
+
+	MDNS              bool          `yaml:"mdns"`               // Discover and connect to peers on the local network
+	DHTDiscovery      bool          `yaml:"dht_discovery"`      // Advertise the opened databases on the DHT and connect to their other providers
+	DiscoveryInterval time.Duration `yaml:"discovery_interval"` // Time between DHT advertisements and lookups
+}
+
+// PublishConfig holds how the node tells other nodes which databases to open
+type PublishConfig struct {
+	WellKnown bool          `yaml:"well_known"` // Serve the database addresses at /.well-known/crelay.json
+	IPNS      bool          `yaml:"ipns"`       // Publish the same document under the node's IPNS name
+	Interval  time.Duration `yaml:"interval"`   // Time between IPNS publications, which also refresh the record
+}
+
+// AccessControllerConfig holds access controller settings used when creating a database
+type AccessControllerConfig struct {
+	Type      string              `yaml:"type"`      // Access controller type, e.g. "ipfs", or "nostr" to require signed events
+	Write     []string            `yaml:"write"`     // Identities allowed to write, "*" for everyone; with type nostr, to write anything but events, "*" not allowed
+	PubKeys   []string            `yaml:"pubkeys"`   // With type nostr: public keys allowed to write events, empty for any signed event
+	Subspaces map[string][]string `yaml:"subspaces"` // With type nostr: public keys allowed to write the events of a subspace, replacing pubkeys
+}
+
+// Log output formats
+const (
+	LogFormatConsole = "console" // Human-readable lines
+	LogFormatJSON    = "json"    // One JSON object per line
+)
+
+// LogConfig holds logging settings
+type LogConfig struct {
+	Level  string `yaml:"level"`  // Log level: debug|info|warn|error
+	Format string `yaml:"format"` // Log format: console|json
+	File   string `yaml:"file"`   // Log file path, empty for stderr
+}
+
+// UsageConfig holds per-API-key usage tracking settings
+type UsageConfig struct {
+	Enabled           bool              `yaml:"enabled"`             // Track requests, events written and bytes served per API key
+	FlushInterval     time.Duration     `yaml:"flush_interval"`      // How often usage is persisted to the store
+	DailyRequestQuota uint64            `yaml:"daily_request_quota"` // Default daily request quota per key, 0 for unlimited
+	Quotas            map[string]uint64 `yaml:"quotas"`              // Daily request quota by API key, overriding the default
+}
+
+// WarmupConfig holds startup warm-up settings
+type WarmupConfig struct {
+	Enabled   bool          `yaml:"enabled"`    // Preload hot data before reporting ready, and cache reads
+	Subspaces int           `yaml:"subspaces"`  // Number of the hottest subspaces of the previous run to preload
+	Timeout   time.Duration `yaml:"timeout"`    // Time allowed for the warm-up before the node reports ready anyway
+	CacheTTL  time.Duration `yaml:"cache_ttl"`  // How long preloaded and read data stays cached
+	StatsFile string        `yaml:"stats_file"` // File persisting subspace request counts between runs, relative to orbitdb.directory
+}
+
+// HealthConfig holds the thresholds of the deep readiness check, GET /api/health/ready
+type HealthConfig struct {
+	MinPeers            int           `yaml:"min_peers"`             // IPFS peers the node must be connected to, 0 to not check
+	MaxReplicationStall time.Duration `yaml:"max_replication_stall"` // How long the node may be behind its peers without replicating an entry, 0 to not check
+	CheckTimeout        time.Duration `yaml:"check_timeout"`         // Time allowed for the checks, including the test read
+}
+
+// RateLimitConfig holds per-API-key write rate limit settings
+type RateLimitConfig struct {
+	Enabled          bool          `yaml:"enabled"`           // Limit event writes per API key
+	WritesPerSecond  float64       `yaml:"writes_per_second"` // Sustained writes per second per key
+	Burst            int           `yaml:"burst"`             // Writes a key may make at once
+	Adaptive         bool          `yaml:"adaptive"`          // Tighten the limits while the node is overloaded
+	BacklogThreshold int           `yaml:"backlog_threshold"` // Replication queue length that counts as overloaded, 0 to ignore
+	QueueThreshold   int           `yaml:"queue_threshold"`   // Queued full-scan queries that count as overloaded, 0 to ignore
+	MinFactor        float64       `yaml:"min_factor"`        // Lowest fraction of the limits applied under load
+	CheckInterval    time.Duration `yaml:"check_interval"`    // How often the node load is sampled
+}
+
+// WebhooksConfig holds global webhook settings
+type WebhooksConfig struct {
+	Timeout      time.Duration     `yaml:"timeout"`       // Timeout of a single delivery
+	Retries      int               `yaml:"retries"`       // Retries of a failed delivery, 0 to not retry
+	RetryBackoff time.Duration     `yaml:"retry_backoff"` // Wait before the first retry, doubled on each further retry
+	Endpoints    []WebhookEndpoint `yaml:"endpoints"`     // Endpoints receiving deliveries
+}
+
+// WebhookEndpoint describes one webhook receiver
+type WebhookEndpoint struct {
+	URL    string   `yaml:"url"`    // Delivery URL
+	Secret string   `yaml:"secret"` // HMAC-SHA256 signing secret
+	Events []string `yaml:"events"` // Payload types to deliver, empty for all
+}
+
+// SubspaceIDConfig holds the format subspace IDs must have
+type SubspaceIDConfig struct {
+	Format  string `yaml:"format"`  // hex|uuid|cid|regex
+	Pattern string `yaml:"pattern"` // Regular expression whole IDs must match, for the regex format
+}
+
+// CausalityConfig holds causality validation settings
+type CausalityConfig struct {
+	StaleEvents     string `yaml:"stale_events"`     // Handling of events carrying counters behind the subspace: accept|reject|quarantine
+	CounterStore    string `yaml:"counter_store"`    // Storage of the key counters: document|keyvalue
+	CountersAddress string `yaml:"counters_address"` // Keyvalue store address of the counters with counter_store keyvalue
+}
+
+// DerivedDataConfig holds settings of the derived data (causality, statistics, leaderboards) updates
+type DerivedDataConfig struct {
+	Async        bool          `yaml:"async"`         // Update derived data on a background worker instead of in the write request
+	QueueSize    int           `yaml:"queue_size"`    // Events waiting for their update, beyond which writes wait for room
+	MaxRetries   int           `yaml:"max_retries"`   // Retries of a failed background update
+	RetryBackoff time.Duration `yaml:"retry_backoff"` // Wait before the first retry, doubled on each further retry
+}
+
+// LiveConfigConfig holds settings of the replicated live configuration document
+type LiveConfigConfig struct {
+	Signers      []string      `yaml:"signers"`       // Hex public keys trusted to sign live configurations, empty to disable
+	PollInterval time.Duration `yaml:"poll_interval"` // How often the live configuration document is checked for changes
+}
+
+// ResponseCacheConfig holds stale-while-revalidate caching settings of analytics endpoints
+type ResponseCacheConfig struct {
+	Enabled              bool          `yaml:"enabled"`                // Cache responses of heavy analytics endpoints
+	MaxAge               time.Duration `yaml:"max_age"`                // How long a response is served as fresh
+	StaleWhileRevalidate time.Duration `yaml:"stale_while_revalidate"` // How long after max_age a stale response is served while it is recomputed
+	RefreshTimeout       time.Duration `yaml:"refresh_timeout"`        // Time allowed for a background recomputation
+	MaxEntries           int           `yaml:"max_entries"`            // Maximum cached responses, the oldest is evicted first
+}
+
+// CompressionConfig holds the negotiated gzip and zstd compression of HTTP responses
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`  // Compress responses of clients sending a matching Accept-Encoding
+	MinSize int  `yaml:"min_size"` // Bytes a response must reach to be compressed; streamed responses are always compressed
+}
+
+// FederationConfig holds the peer nodes federated queries are fanned out to
+type FederationConfig struct {
+	Peers   []string      `yaml:"peers"`   // API base URLs of peer nodes, e.g. http://node-b:8080
+	Timeout time.Duration `yaml:"timeout"` // Time each peer has to answer before its results are left out
+	APIKey  string        `yaml:"api_key"` // API key sent to peers, empty for none
+}
+
+// Authentication modes of API route groups
+const (
+	AuthModeOpen          = "open"          // No authentication
+	AuthModeReadOnly      = "read-only"     // Reads are open, writes need authentication
+	AuthModeAuthenticated = "authenticated" // Every request needs authentication
+)
+
+// AuthRouteGroups are the API route groups, named after the first path segment under /api
+var AuthRouteGroups = []string{"events", "subspaces", "users", "proposals", "webhooks", "admin", "config", "status"}
+
+// AuthConfig holds NIP-98 authentication settings of the HTTP API
+type AuthConfig struct {
+	DefaultMode string            `yaml:"default_mode"` // Mode of route groups not listed in groups: open|read-only|authenticated
+	Groups      map[string]string `yaml:"groups"`       // Mode by route group, e.g. {"events": "read-only", "admin": "authenticated"}
+	PubKeys     []string          `yaml:"pubkeys"`      // Hex public keys allowed to authenticate, empty for any valid signature; not applied to the admin and subspace operator routes, which have their own guards
+	MaxAge      time.Duration     `yaml:"max_age"`      // Maximum difference between an auth event's created_at and now
+	URL         string            `yaml:"url"`          // Public base URL signed u tags refer to, empty to derive it from the request
+}
+
+// PolicyConfig holds the acceptance policies events must pass to be saved
+type PolicyConfig struct {
+	MaxEventSize   int      `yaml:"max_event_size"`  // Maximum JSON size of an event in bytes, 0 for unlimited
+	MaxTags        int      `yaml:"max_tags"`        // Maximum number of tags of an event, 0 for unlimited
+	AllowedKinds   []int    `yaml:"allowed_kinds"`   // Kinds that may be saved, empty for any
+	AllowedPubKeys []string `yaml:"allowed_pubkeys"` // Hex public keys that may save events, empty for any
+	DeniedPubKeys  []string `yaml:"denied_pubkeys"`  // Hex public keys whose events are refused
+	MinPoW         int      `yaml:"min_pow"`         // NIP-13 difficulty event IDs must have, 0 to disable
+}
+
+// ModerationConfig holds the moderators whose NIP-51 mute lists hide authors from API queries
+type ModerationConfig struct {
+	PubKeys []string `yaml:"pubkeys"` // Hex public keys of the moderators, empty to mute no one
+}
+
+// RetentionConfig holds the retention settings of the background sweeper
+type RetentionConfig struct {
+	Enabled  bool                        `yaml:"enabled"`  // Periodically remove expired (NIP-40) and out-of-retention events
+	Interval time.Duration               `yaml:"interval"` // Time between sweeps
+	MaxAge   time.Duration               `yaml:"max_age"`  // Maximum age of events of kinds without a rule, 0 for unlimited
+	Kinds    map[int]RetentionKindConfig `yaml:"kinds"`    // Rules by kind
+}
+
+// RetentionKindConfig holds the retention of one kind
+type RetentionKindConfig struct {
+	MaxAge   time.Duration `yaml:"max_age"`   // Maximum age of events of the kind, 0 for unlimited
+	MaxCount int           `yaml:"max_count"` // Number of newest events of the kind kept, 0 for unlimited
+}
+
+// SnapshotConfig holds the OrbitDB snapshot settings
+type SnapshotConfig struct {
+	EveryEntries  int           `yaml:"every_entries"`  // Snapshot a store when its oplog grew by this many entries, 0 to disable
+	CheckInterval time.Duration `yaml:"check_interval"` // Time between oplog growth checks
+	LoadOnStart   bool          `yaml:"load_on_start"`  // Load stores from their last snapshot on startup
+}
+
+// ReadOnlyConfig holds the read-only follower mode, in which the node replicates the database
+// and serves queries but doesn't write to it
+type ReadOnlyConfig struct {
+	Enabled bool          `yaml:"enabled"` // Reject writes with 405 Method Not Allowed, or forward them to Primary
+	Primary string        `yaml:"primary"` // API base URL of the node writes are forwarded to, e.g. http://node-a:8080, empty to reject them
+	Timeout time.Duration `yaml:"timeout"` // Time the primary has to answer a forwarded write
+}
+
+// ForwardConfig holds the write forwarding of edge nodes, which validate events and forward
+// them to an authority node that may write to the database, and of the authority nodes
+// accepting events forwarded over pubsub
+type ForwardConfig struct {
+	Upstream   string        `yaml:"upstream"`    // API base URL of the authority node events are forwarded to, e.g. http://node-a:8080
+	Topic      string        `yaml:"topic"`       // Pubsub topic events are forwarded over instead of HTTP
+	APIKey     string        `yaml:"api_key"`     // API key sent to the upstream over HTTP, empty for none
+	Timeout    time.Duration `yaml:"timeout"`     // Time the upstream has to answer a forwarded event
+	ServeTopic string        `yaml:"serve_topic"` // Pubsub topic this node saves forwarded events from, empty to ignore them
+}
+
+// Enabled reports whether events are forwarded instead of saved locally
+func (c ForwardConfig) Enabled() bool {
+	return c.Upstream != "" || c.Topic != ""
+}
+
+// ReadIndexConfig holds the local event index serving event reads instead of docstore scans
+type ReadIndexConfig struct {
+	Enabled   bool   `yaml:"enabled"`   // Mirror events into a local Badger index and read them from it
+	Directory string `yaml:"directory"` // Index directory, empty for read-index in the OrbitDB directory
+}
+
+// UserStatsCacheConfig holds the in-process cache of decoded user statistics
+type UserStatsCacheConfig struct {
+	Size int `yaml:"size"` // Maximum users cached, 0 to read the statistics from the store every time
+}
+
+// OTLP trace export protocols
+const (
+	TracingProtocolGRPC = "grpc" // OTLP over gRPC, usually port 4317
+	TracingProtocolHTTP = "http" // OTLP over HTTP/protobuf, usually port 4318
+)
+
+// SchemaConfig holds the document schema migration settings
+type SchemaConfig struct {
+	MigrateOnStart bool `yaml:"migrate_on_start"` // Upgrade documents older than their type's schema version on startup
+}
+
+// TracingConfig holds the OpenTelemetry tracing of requests through the storage pipeline
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`      // Export traces of HTTP requests, event writes, queries and derived data updates
+	Endpoint    string  `yaml:"endpoint"`     // host:port of the OTLP collector
+	Protocol    string  `yaml:"protocol"`     // OTLP protocol: grpc|http
+	Insecure    bool    `yaml:"insecure"`     // Export without TLS
+	SampleRatio float64 `yaml:"sample_ratio"` // Fraction of traces started by this node that are sampled, 0 to 1
+	ServiceName string  `yaml:"service_name"` // service.name of the exported spans
+}
+
+// AdminConfig holds the credentials allowed to use the admin routes (/api/admin/*)
+type AdminConfig struct {
+	APIKeys []string `yaml:"api_keys"` // API keys sent in the X-API-Key header
+	PubKeys []string `yaml:"pubkeys"`  // Hex public keys allowed to use admin routes with NIP-98 signed requests
+	Open    bool     `yaml:"open"`     // Leave admin routes open when no credentials are configured, for local-only nodes
+}
+
+// Enabled reports whether the admin routes are restricted
+func (c AdminConfig) Enabled() bool {
+	return len(c.APIKeys) > 0 || len(c.PubKeys) > 0
+}
+
+// Mode returns the authentication mode of a route group
+func (c AuthConfig) Mode(group string) string {
+	if mode, exists := c.Groups[group]; exists {
+		return mode
+	}
+	return c.DefaultMode
+}
+
+// hexPubKeyPattern matches hex-encoded Nostr public keys
+var hexPubKeyPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Default returns the default configuration
+func Default() *Config {
+	home, _ := os.UserHomeDir()
+	return &Config{
+		API: APIConfig{
+			Port:                 "8080",
+			ShutdownTimeout:      10 * time.Second,
+			MaxConcurrentQueries: 8,
+			QueryQueueTimeout:    5 * time.Second,
+			UnixSocketMode:       "0660",
+			RequestTimeout:       30 * time.Second,
+			QueryTimeout:         10 * time.Second,
+			AccessLog:            true,
+		},
+		OrbitDB: OrbitDBConfig{
+			Directory: filepath.Join(home, "api-data", "orbitdb"),
+			StoreType: "docstore",
+			Create:    true,
+		},
+		Relay: RelayConfig{
+			CheckInterval: 30 * time.Second,
+			MinBackoff:    time.Second,
+			MaxBackoff:    5 * time.Minute,
+		},
+		P2P: P2PConfig{
+			ListenAddrs: []string{
+				"/ip4/0.0.0.0/tcp/4001",
+				"/ip6/::/tcp/4001",
+				"/ip4/0.0.0.0/udp/4001/quic-v1",
+				"/ip6/::/udp/4001/quic-v1",
+			},
+			QUIC:         true,
+			HolePunching: true,
+			RelayClient:  true,
+			PortMapping:  true,
+
+			MDNS:              true,
+			DHTDiscovery:      true,
+			DiscoveryInterval: 5 * time.Minute,
+		},
+		Publish: PublishConfig{
+			WellKnown: true,
+			Interval:  4 * time.Hour,
+		},
+		AccessController: AccessControllerConfig{
+			Type:  "ipfs",
+			Write: []string{"*"},
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: LogFormatConsole,
+		},
+		Usage: UsageConfig{
+			FlushInterval: time.Minute,
+		},
+		Webhooks: WebhooksConfig{
+			Timeout:      5 * time.Second,
+			Retries:      3,
+			RetryBackoff: time.Second,
+		},
+		UserStatsCache: UserStatsCacheConfig{
+			Size: 10000,
+		},
+		Tracing: TracingConfig{
+			Protocol:    TracingProtocolGRPC,
+			SampleRatio: 1,
+			ServiceName: "crelay-crdt-db",
+		},
+		Schema: SchemaConfig{
+			MigrateOnStart: true,
+		},
+		Warmup: WarmupConfig{
+			Subspaces: 20,
+			Timeout:   30 * time.Second,
+			CacheTTL:  time.Minute,
+			StatsFile: "warmup-stats.json",
+		},
+		Health: HealthConfig{
+			MaxReplicationStall: 5 * time.Minute,
+			CheckTimeout:        5 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			WritesPerSecond:  20,
+			Burst:            40,
+			BacklogThreshold: 100,
+			QueueThreshold:   4,
+			MinFactor:        0.1,
+			CheckInterval:    5 * time.Second,
+		},
+		SubspaceIDs: SubspaceIDConfig{
+			Format: "hex",
+		},
+		Causality: CausalityConfig{
+			StaleEvents:  "accept",
+			CounterStore: "document",
+		},
+		LiveConfig: LiveConfigConfig{
+			PollInterval: 30 * time.Second,
+		},
+		ResponseCache: ResponseCacheConfig{
+			MaxAge:               30 * time.Second,
+			StaleWhileRevalidate: 5 * time.Minute,
+			RefreshTimeout:       30 * time.Second,
+			MaxEntries:           1000,
+		},
+		Compression: CompressionConfig{
+			MinSize: 1024,
+		},
+		Federation: FederationConfig{
+			Timeout: 5 * time.Second,
+		},
+		DerivedData: DerivedDataConfig{
+			QueueSize:    10000,
+			MaxRetries:   3,
+			RetryBackoff: 100 * time.Millisecond,
+		},
+		Retention: RetentionConfig{
+			Interval: time.Hour,
+		},
+		Snapshot: SnapshotConfig{
+			CheckInterval: time.Minute,
+			LoadOnStart:   true,
+		},
+		ReadOnly: ReadOnlyConfig{
+			Timeout: 10 * time.Second,
+		},
+		Forward: ForwardConfig{
+			Timeout: 10 * time.Second,
+		},
+		Auth: AuthConfig{
+			DefaultMode: AuthModeOpen,
+			MaxAge:      time.Minute,
+		},
+	}
+}
+
+// SocketMode returns the permissions of the Unix domain socket file
+func (c APIConfig) SocketMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(c.UnixSocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("api.unix_socket_mode must be an octal permission like \"0660\": %q", c.UnixSocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// Load reads the configuration file at path on top of the defaults and applies
+// environment variable overrides. An empty path only applies defaults and environment.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	cfg.applyEnv()
+	cfg.OrbitDB.Directory = expandHome(cfg.OrbitDB.Directory)
+	cfg.Log.File = expandHome(cfg.Log.File)
+	cfg.API.UnixSocket = expandHome(cfg.API.UnixSocket)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnv overrides configuration values from CRELAY_* environment variables
+func (c *Config) applyEnv() {
+	if v := os.Getenv("CRELAY_API_PORT"); v != "" {
+		c.API.Port = v
+	}
+	if v := os.Getenv("CRELAY_API_SOCKET"); v != "" {
+		c.API.UnixSocket = v
+	}
+	if v := os.Getenv("CRELAY_ORBITDB_DIR"); v != "" {
+		c.OrbitDB.Directory = v
+	}
+	if v := os.Getenv("CRELAY_DB_ADDRESS"); v != "" {
+		c.OrbitDB.Address = v
+	}
+	if v := os.Getenv("CRELAY_STORE_TYPE"); v != "" {
+		c.OrbitDB.StoreType = v
+	}
+	if v := os.Getenv("CRELAY_RELAY_MULTIADDRS"); v != "" {
+		c.Relay.Multiaddrs = splitList(v)
+	}
+	if v := os.Getenv("CRELAY_BOOTSTRAP_PEERS"); v != "" {
+		c.Relay.BootstrapPeers = splitList(v)
+	}
+	if v := os.Getenv("CRELAY_SWARM_KEY"); v != "" {
+		c.Relay.SwarmKey = v
+	}
+	if v := os.Getenv("CRELAY_AC_WRITE"); v != "" {
+		c.AccessController.Write = splitList(v)
+	}
+	if v := os.Getenv("CRELAY_LOG_LEVEL"); v != "" {
+		c.Log.Level = v
+	}
+	if v := os.Getenv("CRELAY_LOG_FORMAT"); v != "" {
+		c.Log.Format = v
+	}
+	if v := os.Getenv("CRELAY_LOG_FILE"); v != "" {
+		c.Log.File = v
+	}
+	if v := os.Getenv("CRELAY_LIVE_CONFIG_SIGNERS"); v != "" {
+		c.LiveConfig.Signers = splitList(v)
+	}
+	if v := os.Getenv("CRELAY_FEDERATION_PEERS"); v != "" {
+		c.Federation.Peers = splitList(v)
+	}
+	if v := os.Getenv("CRELAY_ADMIN_API_KEYS"); v != "" {
+		c.Admin.APIKeys = splitList(v)
+	}
+	if v, err := strconv.ParseBool(os.Getenv("CRELAY_ADMIN_OPEN")); err == nil {
+		c.Admin.Open = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("CRELAY_READ_ONLY")); err == nil {
+		c.ReadOnly.Enabled = v
+	}
+	if v := os.Getenv("CRELAY_READ_ONLY_PRIMARY"); v != "" {
+		c.ReadOnly.Primary = v
+	}
+	if v := os.Getenv("CRELAY_FORWARD_UPSTREAM"); v != "" {
+		c.Forward.Upstream = v
+	}
+	if v := os.Getenv("CRELAY_FORWARD_API_KEY"); v != "" {
+		c.Forward.APIKey = v
+	}
+}
+
+// Validate checks the configuration for invalid values
+func (c *Config) Validate() error {
+	if c.API.Port == "" {
+		return fmt.Errorf("api.port must not be empty")
+	}
+	if c.API.ShutdownTimeout <= 0 {
+		return fmt.Errorf("api.shutdown_timeout must be positive")
+	}
+	if c.API.MaxConcurrentQueries < 0 {
+		return fmt.Errorf("api.max_concurrent_queries must not be negative")
+	}
+	if c.API.MaxConcurrentQueries > 0 && c.API.QueryQueueTimeout <= 0 {
+		return fmt.Errorf("api.query_queue_timeout must be positive when queries are limited")
+	}
+	if c.API.RequestTimeout < 0 {
+		return fmt.Errorf("api.request_timeout must not be negative")
+	}
+	if c.API.QueryTimeout < 0 {
+		return fmt.Errorf("api.query_timeout must not be negative")
+	}
+	if c.API.UnixSocket != "" {
+		if _, err := c.API.SocketMode(); err != nil {
+			return err
+		}
+	}
+	if c.OrbitDB.Directory == "" {
+		return fmt.Errorf("orbitdb.directory must not be empty")
+	}
+
+	if c.OrbitDB.Standalone && c.OrbitDB.Name == "" {
+		return fmt.Errorf("orbitdb.name is required in standalone mode")
+	}
+	if c.OrbitDB.MigrateTo != "" && c.OrbitDB.Standalone {
+		return fmt.Errorf("orbitdb.migrate_to is not supported in standalone mode")
+	}
+	if c.OrbitDB.MigrateTo != "" && c.OrbitDB.MigrateTo == c.OrbitDB.Address {
+		return fmt.Errorf("orbitdb.migrate_to must differ from orbitdb.address")
+	}
+	if stores := c.OrbitDB.Stores; stores.Enabled() {
+		if stores.Events == "" || stores.Causality == "" || stores.Stats == "" {
+			return fmt.Errorf("orbitdb.stores requires the events, causality and stats addresses")
+		}
+		if stores.Events == stores.Causality || stores.Events == stores.Stats || stores.Causality == stores.Stats {
+			return fmt.Errorf("orbitdb.stores addresses must differ")
+		}
+		if c.OrbitDB.Standalone {
+			return fmt.Errorf("orbitdb.stores is not supported in standalone mode")
+		}
+		if c.OrbitDB.MigrateTo != "" {
+			return fmt.Errorf("orbitdb.stores can't be combined with orbitdb.migrate_to")
+		}
+		for _, address := range []string{stores.Events, stores.Causality, stores.Stats} {
+			if address == c.OrbitDB.Address {
+				return fmt.Errorf("orbitdb.stores addresses must differ from orbitdb.address")
+			}
+		}
+	}
+
+	switch c.OrbitDB.StoreType {
+	case "eventlog", "keyvalue", "docstore":
+	default:
+		return fmt.Errorf("unsupported orbitdb.store_type: %s", c.OrbitDB.StoreType)
+	}
+
+	if len(c.P2P.ListenAddrs) == 0 {
+		return fmt.Errorf("p2p.listen_addrs must not be empty")
+	}
+	switch c.P2P.AutoNAT {
+	case "", AutoNATEnabled, AutoNATDisabled:
+	default:
+		return fmt.Errorf("unsupported p2p.autonat: %s", c.P2P.AutoNAT)
+	}
+	if c.P2P.HolePunching && !c.P2P.RelayClient {
+		return fmt.Errorf("p2p.hole_punching needs p2p.relay_client")
+	}
+	if c.P2P.DHTDiscovery && c.P2P.DiscoveryInterval <= 0 {
+		return fmt.Errorf("p2p.discovery_interval must be positive")
+	}
+
+	if c.Publish.IPNS && c.Publish.Interval <= 0 {
+		return fmt.Errorf("publish.interval must be positive")
+	}
+
+	if c.Relay.CheckInterval <= 0 {
+		return fmt.Errorf("relay.check_interval must be positive")
+	}
+	if c.Relay.MinBackoff <= 0 || c.Relay.MaxBackoff < c.Relay.MinBackoff {
+		return fmt.Errorf("relay.min_backoff must be positive and at most relay.max_backoff")
+	}
+
+	switch c.SubspaceIDs.Format {
+	case "hex", "uuid", "cid":
+	case "regex":
+		if c.SubspaceIDs.Pattern == "" {
+			return fmt.Errorf("subspace_ids.pattern is required for the regex format")
+		}
+		if _, err := regexp.Compile(c.SubspaceIDs.Pattern); err != nil {
+			return fmt.Errorf("invalid subspace_ids.pattern: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported subspace_ids.format: %s", c.SubspaceIDs.Format)
+	}
+
+	switch c.Causality.StaleEvents {
+	case "accept", "reject", "quarantine":
+	default:
+		return fmt.Errorf("unsupported causality.stale_events: %s", c.Causality.StaleEvents)
+	}
+	switch c.Causality.CounterStore {
+	case "document":
+	case "keyvalue":
+		if c.Causality.CountersAddress == "" {
+			return fmt.Errorf("causality.counters_address is required with causality.counter_store keyvalue")
+		}
+		if c.OrbitDB.Standalone {
+			return fmt.Errorf("causality.counter_store keyvalue is not supported in standalone mode")
+		}
+	default:
+		return fmt.Errorf("unsupported causality.counter_store: %s", c.Causality.CounterStore)
+	}
+
+	if c.AccessController.Type == "nostr" {
+		if c.OrbitDB.Standalone {
+			return fmt.Errorf("access_controller.type nostr is not supported in standalone mode")
+		}
+		// Deletes and derived data are only checked against the writer identities, so a
+		// wildcard would let anyone delete signed events
+		if len(c.AccessController.Write) == 0 {
+			return fmt.Errorf("access_controller.write must list the node identities with access_controller.type nostr")
+		}
+		for _, writer := range c.AccessController.Write {
+			if writer == "*" {
+				return fmt.Errorf("access_controller.write must not contain \"*\" with access_controller.type nostr")
+			}
+		}
+		for i, pubKey := range c.AccessController.PubKeys {
+			if !hexPubKeyPattern.MatchString(pubKey) {
+				return fmt.Errorf("access_controller.pubkeys[%d] must be a 64-character hex public key", i)
+			}
+		}
+		for subspaceID, pubKeys := range c.AccessController.Subspaces {
+			for i, pubKey := range pubKeys {
+				if !hexPubKeyPattern.MatchString(pubKey) {
+					return fmt.Errorf("access_controller.subspaces[%s][%d] must be a 64-character hex public key", subspaceID, i)
+				}
+			}
+		}
+	}
+
+	if len(c.LiveConfig.Signers) > 0 {
+		for i, signer := range c.LiveConfig.Signers {
+			if !hexPubKeyPattern.MatchString(signer) {
+				return fmt.Errorf("live_config.signers[%d] must be a 64-character hex public key", i)
+			}
+		}
+		if c.LiveConfig.PollInterval <= 0 {
+			return fmt.Errorf("live_config.poll_interval must be positive")
+		}
+	}
+
+	if c.Compression.Enabled && c.Compression.MinSize < 0 {
+		return fmt.Errorf("compression.min_size must not be negative")
+	}
+
+	if c.ResponseCache.Enabled {
+		if c.ResponseCache.MaxAge <= 0 {
+			return fmt.Errorf("response_cache.max_age must be positive")
+		}
+		if c.ResponseCache.StaleWhileRevalidate < 0 {
+			return fmt.Errorf("response_cache.stale_while_revalidate must not be negative")
+		}
+		if c.ResponseCache.RefreshTimeout <= 0 {
+			return fmt.Errorf("response_cache.refresh_timeout must be positive")
+		}
+		if c.ResponseCache.MaxEntries < 1 {
+			return fmt.Errorf("response_cache.max_entries must be at least 1")
+		}
+	}
+
+	for i, peer := range c.Federation.Peers {
+		if u, err := url.Parse(peer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("federation.peers[%d] must be an http or https URL: %q", i, peer)
+		}
+	}
+	if len(c.Federation.Peers) > 0 && c.Federation.Timeout <= 0 {
+		return fmt.Errorf("federation.timeout must be positive")
+	}
+
+	if c.DerivedData.Async {
+		if c.DerivedData.QueueSize < 1 {
+			return fmt.Errorf("derived_data.queue_size must be at least 1")
+		}
+		if c.DerivedData.MaxRetries < 0 {
+			return fmt.Errorf("derived_data.max_retries must not be negative")
+		}
+		if c.DerivedData.RetryBackoff < 0 {
+			return fmt.Errorf("derived_data.retry_backoff must not be negative")
+		}
+	}
+
+	if !validAuthMode(c.Auth.DefaultMode) {
+		return fmt.Errorf("unsupported auth.default_mode: %s", c.Auth.DefaultMode)
+	}
+	for group, mode := range c.Auth.Groups {
+		if !containsGroup(group) {
+			return fmt.Errorf("unknown auth.groups route group: %s", group)
+		}
+		if !validAuthMode(mode) {
+			return fmt.Errorf("unsupported auth.groups[%s] mode: %s", group, mode)
+		}
+	}
+	for i, pubKey := range c.Auth.PubKeys {
+		if !hexPubKeyPattern.MatchString(pubKey) {
+			return fmt.Errorf("auth.pubkeys[%d] must be a 64-character hex public key", i)
+		}
+	}
+	if c.Auth.MaxAge <= 0 {
+		return fmt.Errorf("auth.max_age must be positive")
+	}
+	if c.Auth.URL != "" {
+		if u, err := url.Parse(c.Auth.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("auth.url must be an http or https URL: %q", c.Auth.URL)
+		}
+	}
+
+	if c.Retention.Enabled {
+		if c.Retention.Interval <= 0 {
+			return fmt.Errorf("retention.interval must be positive")
+		}
+		if c.Retention.MaxAge < 0 {
+			return fmt.Errorf("retention.max_age must not be negative")
+		}
+		for kind, rule := range c.Retention.Kinds {
+			if rule.MaxAge < 0 || rule.MaxCount < 0 {
+				return fmt.Errorf("retention.kinds[%d] limits must not be negative", kind)
+			}
+		}
+	}
+
+	if c.Snapshot.EveryEntries < 0 {
+		return fmt.Errorf("snapshot.every_entries must not be negative")
+	}
+	if c.Snapshot.EveryEntries > 0 && c.Snapshot.CheckInterval <= 0 {
+		return fmt.Errorf("snapshot.check_interval must be positive")
+	}
+
+	if c.ReadOnly.Primary != "" {
+		if u, err := url.Parse(c.ReadOnly.Primary); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("read_only.primary must be an http or https URL: %q", c.ReadOnly.Primary)
+		}
+		if c.ReadOnly.Timeout <= 0 {
+			return fmt.Errorf("read_only.timeout must be positive")
+		}
+	}
+
+	if c.Forward.Upstream != "" {
+		if u, err := url.Parse(c.Forward.Upstream); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("forward.upstream must be an http or https URL: %q", c.Forward.Upstream)
+		}
+		if c.Forward.Topic != "" {
+			return fmt.Errorf("forward.upstream and forward.topic are exclusive")
+		}
+	}
+	if c.Forward.Enabled() && c.Forward.Timeout <= 0 {
+		return fmt.Errorf("forward.timeout must be positive")
+	}
+	if c.Forward.Topic != "" && c.Forward.Topic == c.Forward.ServeTopic {
+		return fmt.Errorf("forward.serve_topic must differ from forward.topic, a node can't forward events to itself")
+	}
+
+	if c.Policy.MaxEventSize < 0 {
+		return fmt.Errorf("policy.max_event_size must not be negative")
+	}
+	if c.Policy.MaxTags < 0 {
+		return fmt.Errorf("policy.max_tags must not be negative")
+	}
+	if c.Policy.MinPoW < 0 || c.Policy.MinPoW > 256 {
+		return fmt.Errorf("policy.min_pow must be between 0 and 256")
+	}
+	for i, pubKey := range c.Policy.AllowedPubKeys {
+		if !hexPubKeyPattern.MatchString(pubKey) {
+			return fmt.Errorf("policy.allowed_pubkeys[%d] must be a 64-character hex public key", i)
+		}
+	}
+	for i, pubKey := range c.Policy.DeniedPubKeys {
+		if !hexPubKeyPattern.MatchString(pubKey) {
+			return fmt.Errorf("policy.denied_pubkeys[%d] must be a 64-character hex public key", i)
+		}
+	}
+	for i, pubKey := range c.Moderation.PubKeys {
+		if !hexPubKeyPattern.MatchString(pubKey) {
+			return fmt.Errorf("moderation.pubkeys[%d] must be a 64-character hex public key", i)
+		}
+	}
+
+	for i, apiKey := range c.Admin.APIKeys {
+		if apiKey == "" {
+			return fmt.Errorf("admin.api_keys[%d] must not be empty", i)
+		}
+	}
+	for i, pubKey := range c.Admin.PubKeys {
+		if !hexPubKeyPattern.MatchString(pubKey) {
+			return fmt.Errorf("admin.pubkeys[%d] must be a 64-character hex public key", i)
+		}
+	}
+
+	if c.Usage.Enabled && c.Usage.FlushInterval <= 0 {
+		return fmt.Errorf("usage.flush_interval must be positive")
+	}
+
+	if c.UserStatsCache.Size < 0 {
+		return fmt.Errorf("user_stats_cache.size must not be negative")
+	}
+
+	if c.Tracing.Enabled {
+		if c.Tracing.Endpoint == "" {
+			return fmt.Errorf("tracing.endpoint must not be empty when tracing is enabled")
+		}
+		switch c.Tracing.Protocol {
+		case TracingProtocolGRPC, TracingProtocolHTTP:
+		default:
+			return fmt.Errorf("unsupported tracing.protocol: %s", c.Tracing.Protocol)
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+		}
+	}
+
+	if c.Warmup.Enabled {
+		if c.Warmup.Subspaces < 0 {
+			return fmt.Errorf("warmup.subspaces must not be negative")
+		}
+		if c.Warmup.Timeout <= 0 {
+			return fmt.Errorf("warmup.timeout must be positive")
+		}
+		if c.Warmup.CacheTTL <= 0 {
+			return fmt.Errorf("warmup.cache_ttl must be positive")
+		}
+		if c.Warmup.StatsFile == "" {
+			return fmt.Errorf("warmup.stats_file must not be empty")
+		}
+	}
+
+	if c.Health.MinPeers < 0 {
+		return fmt.Errorf("health.min_peers must not be negative")
+	}
+	if c.Health.MaxReplicationStall < 0 {
+		return fmt.Errorf("health.max_replication_stall must not be negative")
+	}
+	if c.Health.CheckTimeout <= 0 {
+		return fmt.Errorf("health.check_timeout must be positive")
+	}
+
+	if c.RateLimit.Enabled {
+		if c.RateLimit.WritesPerSecond <= 0 {
+			return fmt.Errorf("rate_limit.writes_per_second must be positive")
+		}
+		if c.RateLimit.Burst < 1 {
+			return fmt.Errorf("rate_limit.burst must be at least 1")
+		}
+		if c.RateLimit.Adaptive {
+			if c.RateLimit.BacklogThreshold < 0 || c.RateLimit.QueueThreshold < 0 {
+				return fmt.Errorf("rate_limit thresholds must not be negative")
+			}
+			if c.RateLimit.MinFactor <= 0 || c.RateLimit.MinFactor > 1 {
+				return fmt.Errorf("rate_limit.min_factor must be in (0, 1]")
+			}
+			if c.RateLimit.CheckInterval <= 0 {
+				return fmt.Errorf("rate_limit.check_interval must be positive")
+			}
+		}
+	}
+
+	for i, endpoint := range c.Webhooks.Endpoints {
+		if endpoint.URL == "" {
+			return fmt.Errorf("webhooks.endpoints[%d].url must not be empty", i)
+		}
+		if endpoint.Secret == "" {
+			return fmt.Errorf("webhooks.endpoints[%d].secret must not be empty", i)
+		}
+	}
+	// Subscriptions registered through the API are delivered even without configured endpoints
+	if c.Webhooks.Timeout <= 0 {
+		return fmt.Errorf("webhooks.timeout must be positive")
+	}
+	if c.Webhooks.Retries < 0 {
+		return fmt.Errorf("webhooks.retries must not be negative")
+	}
+	if c.Webhooks.Retries > 0 && c.Webhooks.RetryBackoff <= 0 {
+		return fmt.Errorf("webhooks.retry_backoff must be positive")
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("unsupported log.level: %s", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case LogFormatConsole, LogFormatJSON:
+	default:
+		return fmt.Errorf("unsupported log.format: %s", c.Log.Format)
+	}
+
+	return nil
+}
+
+// Helper function: split a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Helper function: expand a leading ~ to the user's home directory
+func expandHome(path string) string {
+	if path == "" || path[0] != '~' {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// validAuthMode reports whether mode is a supported authentication mode
+func validAuthMode(mode string) bool {
+	return mode == AuthModeOpen || mode == AuthModeReadOnly || mode == AuthModeAuthenticated
+}
+
+// containsGroup reports whether group is an API route group
+func containsGroup(group string) bool {
+	for _, known := range AuthRouteGroups {
+		if known == group {
+			return true
+		}
+	}
+	return false
+}
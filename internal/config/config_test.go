@@ -0,0 +1,368 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test loading defaults without a config file
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load("")
+	assert.NoError(t, err)
+	assert.Equal(t, "8080", cfg.API.Port)
+	assert.Equal(t, "docstore", cfg.OrbitDB.StoreType)
+	assert.Equal(t, []string{"*"}, cfg.AccessController.Write)
+}
+
+// Test loading a config file with environment overrides
+func TestLoadFileWithEnvOverrides(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := `
+api:
+  port: "9090"
+orbitdb:
+  directory: /tmp/orbitdb
+  address: /orbitdb/zdpuTest/events
+relay:
+  multiaddrs:
+    - /ip4/127.0.0.1/tcp/4001/p2p/QmTest
+log:
+  level: debug
+`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	t.Setenv("CRELAY_API_PORT", "7070")
+	t.Setenv("CRELAY_RELAY_MULTIADDRS", "/ip4/10.0.0.1/tcp/4001/p2p/QmA, /ip4/10.0.0.2/tcp/4001/p2p/QmB")
+
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "7070", cfg.API.Port)
+	assert.Equal(t, "/tmp/orbitdb", cfg.OrbitDB.Directory)
+	assert.Equal(t, "/orbitdb/zdpuTest/events", cfg.OrbitDB.Address)
+	assert.Equal(t, "docstore", cfg.OrbitDB.StoreType)
+	assert.Equal(t, []string{"/ip4/10.0.0.1/tcp/4001/p2p/QmA", "/ip4/10.0.0.2/tcp/4001/p2p/QmB"}, cfg.Relay.Multiaddrs)
+	assert.Equal(t, "debug", cfg.Log.Level)
+}
+
+// Test rejecting invalid values
+func TestLoadInvalidStoreType(t *testing.T) {
+	t.Setenv("CRELAY_STORE_TYPE", "graph")
+
+	_, err := Load("")
+	assert.Error(t, err)
+}
+
+// Test validating the Unix socket permissions
+func TestLoadUnixSocketMode(t *testing.T) {
+	t.Setenv("CRELAY_API_SOCKET", "/run/crelay/store.sock")
+
+	cfg, err := Load("")
+	assert.NoError(t, err)
+	mode, err := cfg.API.SocketMode()
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), mode)
+
+	cfg.API.UnixSocketMode = "rw-rw----"
+	assert.Error(t, cfg.Validate())
+}
+
+// Test validating the subspace ID format
+func TestValidateSubspaceIDFormat(t *testing.T) {
+	cfg := Default()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.SubspaceIDs.Format = "regex"
+	assert.Error(t, cfg.Validate(), "the regex format needs a pattern")
+	cfg.SubspaceIDs.Pattern = "[a-z]+"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.SubspaceIDs.Format = "ulid"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateNostrAccessControllerWriters(t *testing.T) {
+	cfg := Default()
+	cfg.AccessController.Type = "nostr"
+	assert.Error(t, cfg.Validate(), "the default wildcard writer would let anyone delete events")
+
+	cfg.AccessController.Write = nil
+	assert.Error(t, cfg.Validate())
+
+	cfg.AccessController.Write = []string{"node-a", "node-b"}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateLiveConfigSigners(t *testing.T) {
+	cfg := Default()
+	cfg.LiveConfig.Signers = []string{"npub1notahexkey"}
+	assert.Error(t, cfg.Validate())
+
+	cfg.LiveConfig.Signers = []string{"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.LiveConfig.PollInterval = 0
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateSplitStores(t *testing.T) {
+	cfg := Default()
+	cfg.OrbitDB.Stores.Events = "/orbitdb/zdpuA/events"
+	assert.Error(t, cfg.Validate(), "all three stores are required")
+
+	cfg.OrbitDB.Stores.Causality = "/orbitdb/zdpuA/causality"
+	cfg.OrbitDB.Stores.Stats = "/orbitdb/zdpuA/causality"
+	assert.Error(t, cfg.Validate(), "stores must differ")
+
+	cfg.OrbitDB.Stores.Stats = "/orbitdb/zdpuA/stats"
+	assert.NoError(t, cfg.Validate())
+
+	// Migrating from a single store into the split stores
+	cfg.OrbitDB.Address = "/orbitdb/zdpuA/single"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.OrbitDB.MigrateTo = "/orbitdb/zdpuA/other"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateCounterStore(t *testing.T) {
+	cfg := Default()
+	cfg.Causality.CounterStore = "keyvalue"
+	assert.Error(t, cfg.Validate(), "the keyvalue store needs an address")
+
+	cfg.Causality.CountersAddress = "/orbitdb/zdpuA/counters"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Causality.CounterStore = "redis"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateAuth(t *testing.T) {
+	cfg := Default()
+	assert.Equal(t, AuthModeOpen, cfg.Auth.Mode("events"))
+
+	cfg.Auth.Groups = map[string]string{"events": AuthModeReadOnly, "admin": AuthModeAuthenticated}
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, AuthModeAuthenticated, cfg.Auth.Mode("admin"))
+	assert.Equal(t, AuthModeOpen, cfg.Auth.Mode("users"))
+
+	cfg.Auth.Groups["events"] = "signed"
+	assert.Error(t, cfg.Validate(), "unknown mode")
+
+	cfg.Auth.Groups = map[string]string{"metrics": AuthModeOpen}
+	assert.Error(t, cfg.Validate(), "unknown route group")
+
+	cfg.Auth.Groups = nil
+	cfg.Auth.URL = "api.example.com"
+	assert.Error(t, cfg.Validate(), "the URL needs a scheme")
+}
+
+func TestValidateAdmin(t *testing.T) {
+	cfg := Default()
+	assert.False(t, cfg.Admin.Enabled(), "no admin credentials are configured by default")
+	assert.False(t, cfg.Admin.Open, "admin routes are closed by default")
+
+	cfg.Admin.APIKeys = []string{"secret"}
+	assert.NoError(t, cfg.Validate())
+	assert.True(t, cfg.Admin.Enabled())
+
+	cfg.Admin.PubKeys = []string{"npub1admin"}
+	assert.Error(t, cfg.Validate(), "public keys must be hex")
+}
+
+func TestValidateModeration(t *testing.T) {
+	cfg := Default()
+	cfg.Moderation.PubKeys = []string{"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Moderation.PubKeys = []string{"npub1moderator"}
+	assert.Error(t, cfg.Validate(), "public keys must be hex")
+}
+
+func TestValidateSnapshot(t *testing.T) {
+	cfg := Default()
+	assert.True(t, cfg.Snapshot.LoadOnStart)
+
+	cfg.Snapshot.EveryEntries = 10000
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Snapshot.CheckInterval = 0
+	assert.Error(t, cfg.Validate(), "automatic snapshots need a check interval")
+
+	cfg.Snapshot.EveryEntries = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateRequestTimeout(t *testing.T) {
+	cfg := Default()
+	cfg.API.RequestTimeout = 0
+	assert.NoError(t, cfg.Validate(), "0 disables the deadline")
+
+	cfg.API.RequestTimeout = -time.Second
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateQueryTimeout(t *testing.T) {
+	cfg := Default()
+	cfg.API.QueryTimeout = 0
+	assert.NoError(t, cfg.Validate(), "0 leaves scans to the request deadline")
+
+	cfg.API.QueryTimeout = -time.Second
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateLog(t *testing.T) {
+	cfg := Default()
+	cfg.Log.Format = LogFormatJSON
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Log.Format = "logfmt"
+	assert.Error(t, cfg.Validate())
+
+	cfg = Default()
+	cfg.Log.Level = "trace"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	cfg := Default()
+	cfg.Webhooks.Retries = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg = Default()
+	cfg.Webhooks.RetryBackoff = 0
+	assert.Error(t, cfg.Validate())
+	cfg.Webhooks.Retries = 0
+	assert.NoError(t, cfg.Validate(), "no backoff is needed without retries")
+
+	cfg.Webhooks.Timeout = 0
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateHealth(t *testing.T) {
+	cfg := Default()
+	cfg.Health.MinPeers = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg = Default()
+	cfg.Health.CheckTimeout = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg = Default()
+	cfg.Health.MaxReplicationStall = 0
+	cfg.Health.MinPeers = 3
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateTracing(t *testing.T) {
+	cfg := Default()
+	cfg.Tracing.Enabled = true
+	assert.Error(t, cfg.Validate(), "tracing needs a collector endpoint")
+
+	cfg.Tracing.Endpoint = "localhost:4318"
+	cfg.Tracing.Protocol = TracingProtocolHTTP
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tracing.Protocol = "zipkin"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Tracing.Protocol = TracingProtocolGRPC
+	cfg.Tracing.SampleRatio = 1.5
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateRelay(t *testing.T) {
+	cfg := Default()
+	cfg.Relay.MaxBackoff = cfg.Relay.MinBackoff / 2
+	assert.Error(t, cfg.Validate(), "the maximum backoff must not be below the minimum")
+
+	cfg = Default()
+	cfg.Relay.CheckInterval = 0
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateP2P(t *testing.T) {
+	cfg := Default()
+	cfg.P2P.AutoNAT = AutoNATEnabled
+	assert.NoError(t, cfg.Validate())
+
+	cfg.P2P.AutoNAT = "on"
+	assert.Error(t, cfg.Validate())
+
+	cfg = Default()
+	cfg.P2P.RelayClient = false
+	assert.Error(t, cfg.Validate(), "hole punching needs the relay client")
+}
+
+func TestValidatePublish(t *testing.T) {
+	cfg := Default()
+	assert.True(t, cfg.Publish.WellKnown)
+
+	cfg.Publish.IPNS = true
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Publish.Interval = 0
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateReadOnly(t *testing.T) {
+	cfg := Default()
+	cfg.ReadOnly.Enabled = true
+	assert.NoError(t, cfg.Validate(), "writes are rejected without a primary")
+
+	cfg.ReadOnly.Primary = "node-a:8080"
+	assert.Error(t, cfg.Validate())
+
+	cfg.ReadOnly.Primary = "http://node-a:8080"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.ReadOnly.Timeout = 0
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateCompression(t *testing.T) {
+	cfg := Default()
+	cfg.Compression.Enabled = true
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Compression.MinSize = 0
+	assert.NoError(t, cfg.Validate(), "a zero threshold compresses every response")
+
+	cfg.Compression.MinSize = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateUserStatsCache(t *testing.T) {
+	cfg := Default()
+	cfg.UserStatsCache.Size = 0
+	assert.NoError(t, cfg.Validate(), "a zero size disables the cache")
+
+	cfg.UserStatsCache.Size = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateForward(t *testing.T) {
+	cfg := Default()
+	assert.False(t, cfg.Forward.Enabled())
+
+	cfg.Forward.Upstream = "http://node-a:8080"
+	assert.True(t, cfg.Forward.Enabled())
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Forward.Topic = "crelay-events"
+	assert.Error(t, cfg.Validate(), "events are forwarded over one transport")
+
+	cfg.Forward.Upstream = ""
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Forward.ServeTopic = "crelay-events"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Forward.ServeTopic = ""
+	cfg.Forward.Timeout = 0
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,524 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Schema is the entry point of queries
+type Schema struct {
+	Query       *Object
+	MaxDepth    int // Maximum nesting of selections, 0 for no limit
+	MaxResolves int // Maximum number of fields resolved by a request, 0 for no limit
+}
+
+// Object is an object type, its fields resolve values from the object's source value
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+// Field is a field of an object type
+type Field struct {
+	Type    *Object  // Type of the value or of the list elements, nil for leaf values returned as JSON
+	Args    []string // Names of the accepted arguments
+	Resolve func(ctx context.Context, source interface{}, args Args) (interface{}, error)
+}
+
+// Request is a GraphQL request as posted over HTTP
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response is the result of a request. Data is nil when the request failed before execution.
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error is an error of a request. Path locates the field that failed, nil for errors
+// before execution.
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Execute runs the query of a request
+func Execute(ctx context.Context, schema *Schema, req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return failed("Syntax error: %v", err)
+	}
+
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return failed("%v", err)
+	}
+	if op.kind != "query" {
+		return failed("%s operations are not supported", op.kind)
+	}
+
+	vars, err := coerceVariables(op.variables, req.Variables)
+	if err != nil {
+		return failed("%v", err)
+	}
+
+	e := &executor{ctx: ctx, schema: schema, fragments: doc.fragments, vars: vars}
+	if schema.MaxDepth > 0 {
+		depth, err := e.depth(op.selections, map[string]bool{})
+		if err != nil {
+			return failed("%v", err)
+		}
+		if depth > schema.MaxDepth {
+			return failed("query depth %d exceeds the maximum of %d", depth, schema.MaxDepth)
+		}
+	}
+
+	data := e.selectionSet(schema.Query, nil, op.selections, nil)
+	return &Response{Data: data, Errors: e.errors}
+}
+
+// failed returns the response of a request that failed before execution
+func failed(format string, args ...interface{}) *Response {
+	return &Response{Errors: []*Error{{Message: fmt.Sprintf(format, args...)}}}
+}
+
+// operation selects the operation to run, by name if the document has several
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, fmt.Errorf("operationName is required for documents with several operations")
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// coerceVariables returns the variable values of an operation, from the request or their
+// defaults
+func coerceVariables(defs []*variableDefinition, values map[string]interface{}) (map[string]interface{}, error) {
+	vars := make(map[string]interface{}, len(defs))
+	for _, def := range defs {
+		value, ok := values[def.name]
+		if !ok && def.hasDefault {
+			value, ok = def.defaultValue, true
+		}
+		if value == nil && strings.HasSuffix(def.typ, "!") {
+			return nil, fmt.Errorf("variable $%s of required type %s was not provided", def.name, def.typ)
+		}
+		if ok {
+			vars[def.name] = value
+		}
+	}
+	return vars, nil
+}
+
+// executor runs an operation, collecting field errors
+type executor struct {
+	ctx       context.Context
+	schema    *Schema
+	fragments map[string]*fragment
+	vars      map[string]interface{}
+	errors    []*Error
+	resolves  int // Fields resolved so far
+}
+
+// fail records a field error
+func (e *executor) fail(path []interface{}, format string, args ...interface{}) {
+	e.errors = append(e.errors, &Error{Message: fmt.Sprintf(format, args...), Path: append([]interface{}(nil), path...)})
+}
+
+// depth returns the nesting depth of selections, with fragments expanded
+func (e *executor) depth(selections []*selection, visiting map[string]bool) (int, error) {
+	deepest := 0
+	for _, sel := range selections {
+		var depth int
+		var err error
+		switch {
+		case sel.spread != "":
+			frag, ok := e.fragments[sel.spread]
+			if !ok {
+				return 0, fmt.Errorf("unknown fragment %q", sel.spread)
+			}
+			if visiting[sel.spread] {
+				return 0, fmt.Errorf("fragment %q spreads itself", sel.spread)
+			}
+			visiting[sel.spread] = true
+			depth, err = e.depth(frag.selections, visiting)
+			delete(visiting, sel.spread)
+		case sel.inline:
+			depth, err = e.depth(sel.selections, visiting)
+		default:
+			depth, err = e.depth(sel.selections, visiting)
+			depth++
+		}
+		if err != nil {
+			return 0, err
+		}
+		if depth > deepest {
+			deepest = depth
+		}
+	}
+	return deepest, nil
+}
+
+// fieldGroup is the selections of a field under one response key
+type fieldGroup struct {
+	key        string
+	selections []*selection
+}
+
+// collectFields groups the fields selected on an object type by response key, in
+// selection order, expanding fragments whose type condition matches
+func (e *executor) collectFields(obj *Object, selections []*selection, groups []*fieldGroup, visited map[string]bool) ([]*fieldGroup, error) {
+	for _, sel := range selections {
+		include, err := e.included(sel)
+		if err != nil {
+			return nil, err
+		}
+		if !include {
+			continue
+		}
+
+		switch {
+		case sel.spread != "":
+			frag, ok := e.fragments[sel.spread]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %q", sel.spread)
+			}
+			if visited[sel.spread] || frag.on != obj.Name {
+				continue
+			}
+			visited[sel.spread] = true
+			if groups, err = e.collectFields(obj, frag.selections, groups, visited); err != nil {
+				return nil, err
+			}
+		case sel.inline:
+			if sel.on != "" && sel.on != obj.Name {
+				continue
+			}
+			if groups, err = e.collectFields(obj, sel.selections, groups, visited); err != nil {
+				return nil, err
+			}
+		default:
+			found := false
+			for _, group := range groups {
+				if group.key == sel.alias {
+					group.selections = append(group.selections, sel)
+					found = true
+					break
+				}
+			}
+			if !found {
+				groups = append(groups, &fieldGroup{key: sel.alias, selections: []*selection{sel}})
+			}
+		}
+	}
+	return groups, nil
+}
+
+// included applies the @skip and @include directives of a selection
+func (e *executor) included(sel *selection) (bool, error) {
+	for _, d := range sel.directives {
+		if d.name != "skip" && d.name != "include" {
+			continue
+		}
+		value, err := e.value(d.arguments["if"])
+		if err != nil {
+			return false, err
+		}
+		condition, ok := value.(bool)
+		if !ok {
+			return false, fmt.Errorf("@%s requires a Boolean if argument", d.name)
+		}
+		if condition == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// selectionSet resolves the fields selected on a value of an object type
+func (e *executor) selectionSet(obj *Object, source interface{}, selections []*selection, path []interface{}) *orderedObject {
+	groups, err := e.collectFields(obj, selections, nil, map[string]bool{})
+	if err != nil {
+		e.fail(path, "%v", err)
+		return nil
+	}
+
+	result := &orderedObject{}
+	for _, group := range groups {
+		result.keys = append(result.keys, group.key)
+		result.values = append(result.values, e.field(obj, source, group, append(path, group.key)))
+	}
+	return result
+}
+
+// field resolves a field of a value of an object type
+func (e *executor) field(obj *Object, source interface{}, group *fieldGroup, path []interface{}) interface{} {
+	sel := group.selections[0]
+	if sel.name == "__typename" {
+		return obj.Name
+	}
+	field, ok := obj.Fields[sel.name]
+	if !ok {
+		e.fail(path, "cannot query field %q on type %q", sel.name, obj.Name)
+		return nil
+	}
+
+	args := make(Args, len(sel.arguments))
+	for name, arg := range sel.arguments {
+		if !slices.Contains(field.Args, name) {
+			e.fail(path, "unknown argument %q on field %q of type %q", name, sel.name, obj.Name)
+			return nil
+		}
+		value, err := e.value(arg)
+		if err != nil {
+			e.fail(path, "%v", err)
+			return nil
+		}
+		args[name] = value
+	}
+
+	e.resolves++
+	if e.schema.MaxResolves > 0 && e.resolves > e.schema.MaxResolves {
+		if e.resolves == e.schema.MaxResolves+1 {
+			e.fail(path, "query resolves more than %d fields", e.schema.MaxResolves)
+		}
+		return nil
+	}
+	value, err := field.Resolve(e.ctx, source, args)
+	if err != nil {
+		e.fail(path, "%v", err)
+		return nil
+	}
+
+	var selections []*selection
+	for _, s := range group.selections {
+		selections = append(selections, s.selections...)
+	}
+	return e.complete(field.Type, sel.name, value, selections, path)
+}
+
+// complete turns a resolved value into its response value, resolving the selected fields of
+// objects
+func (e *executor) complete(typ *Object, name string, value interface{}, selections []*selection, path []interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+	}
+
+	if typ == nil {
+		if len(selections) > 0 {
+			e.fail(path, "field %q is a leaf and must not have a selection", name)
+			return nil
+		}
+		return value
+	}
+	if len(selections) == 0 {
+		e.fail(path, "field %q of type %q must have a selection of subfields", name, typ.Name)
+		return nil
+	}
+
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = e.complete(typ, name, v.Index(i).Interface(), selections, append(path, i))
+		}
+		return list
+	}
+	return e.selectionSet(typ, value, selections, path)
+}
+
+// value resolves the variables of an argument value
+func (e *executor) value(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case variable:
+		return e.vars[string(v)], nil
+	case enum:
+		return string(v), nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if list[i], err = e.value(item); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			var err error
+			if object[key], err = e.value(item); err != nil {
+				return nil, err
+			}
+		}
+		return object, nil
+	}
+	return value, nil
+}
+
+// orderedObject is a response object, which keeps its fields in selection order
+type orderedObject struct {
+	keys   []string
+	values []interface{}
+}
+
+// MarshalJSON encodes the fields in selection order
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	if o == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Args are the argument values of a field, with variables resolved
+type Args map[string]interface{}
+
+// String returns a string argument, empty if it is absent
+func (a Args) String(name string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("argument %q must be a string", name)
+}
+
+// Int returns an integer argument, def if it is absent. Variables decoded from JSON are
+// accepted when they are whole numbers.
+func (a Args) Int(name string, def int) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32 {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %q must be an integer", name)
+}
+
+// Ints returns a list of integers argument, a single integer is a list of one
+func (a Args) Ints(name string) ([]int, error) {
+	items, ok := a[name].([]interface{})
+	if !ok {
+		items = []interface{}{a[name]}
+		if a[name] == nil {
+			return nil, nil
+		}
+	}
+	values := make([]int, 0, len(items))
+	for _, item := range items {
+		n, err := Args{name: item}.Int(name, 0)
+		if err != nil || item == nil {
+			return nil, fmt.Errorf("argument %q must be a list of integers", name)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+// Strings returns a list of strings argument, a single string is a list of one
+func (a Args) Strings(name string) ([]string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %q must be a list of strings", name)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("argument %q must be a list of strings", name)
+}
+
+// Object returns an input object argument, nil if it is absent
+func (a Args) Object(name string) (map[string]interface{}, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return v, nil
+	}
+	return nil, fmt.Errorf("argument %q must be an object", name)
+}
+
+// StructFields returns leaf fields resolving the JSON fields of a struct type from a source
+// value of that type or a pointer to it, named as they encode to JSON
+func StructFields(t reflect.Type) map[string]*Field {
+	fields := map[string]*Field{}
+	for _, f := range reflect.VisibleFields(t) {
+		tag := f.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if tag == "-" || !f.IsExported() || (f.Anonymous && name == "") {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		index := f.Index
+		fields[name] = &Field{Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			v := reflect.Indirect(reflect.ValueOf(source))
+			if !v.IsValid() {
+				return nil, nil
+			}
+			field, err := v.FieldByIndexErr(index)
+			if err != nil {
+				// Field of a nil embedded struct
+				return nil, nil
+			}
+			return field.Interface(), nil
+		}}
+	}
+	return fields
+}
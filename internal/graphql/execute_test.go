@@ -0,0 +1,134 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAuthor struct {
+	Name  string   `json:"name"`
+	Books []string `json:"books,omitempty"`
+}
+
+// testSchema serves authors and their books
+func testSchema() *Schema {
+	authors := map[string]*testAuthor{
+		"ann": {Name: "Ann", Books: []string{"one", "two"}},
+		"bob": {Name: "Bob"},
+	}
+
+	book := &Object{Name: "Book", Fields: map[string]*Field{
+		"title": {Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			return source, nil
+		}},
+		"broken": {Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			return nil, errors.New("out of ink")
+		}},
+	}}
+	author := &Object{Name: "Author", Fields: StructFields(reflect.TypeFor[testAuthor]())}
+	author.Fields["books"] = &Field{Type: book, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+		return source.(*testAuthor).Books, nil
+	}}
+	query := &Object{Name: "Query", Fields: map[string]*Field{
+		"author": {Type: author, Args: []string{"id"}, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			id, err := args.String("id")
+			if a, ok := authors[id]; ok {
+				return a, err
+			}
+			return nil, err
+		}},
+	}}
+	return &Schema{Query: query, MaxDepth: 3}
+}
+
+// execute runs a query and returns the response as JSON
+func execute(t *testing.T, req Request) string {
+	response, err := json.Marshal(Execute(context.Background(), testSchema(), req))
+	require.NoError(t, err)
+	return string(response)
+}
+
+func TestExecute(t *testing.T) {
+	// Fields keep their selection order, aliases rename them
+	assert.JSONEq(t, `{"data":{"author":{"name":"Ann","__typename":"Author","titles":[{"title":"one"},{"title":"two"}]}}}`,
+		execute(t, Request{Query: `{ author(id: "ann") { name __typename titles: books { title } } }`}))
+	assert.Equal(t, `{"data":{"a":{"name":"Ann"},"b":{"name":"Bob"},"c":null}}`,
+		execute(t, Request{Query: `{ a: author(id: "ann") { name } b: author(id: "bob") { name } c: author(id: "eve") { name } }`}))
+
+	// Variables, fragments and directives
+	assert.JSONEq(t, `{"data":{"author":{"name":"Bob"}}}`, execute(t, Request{
+		Query: `query Get($id: String!, $books: Boolean = false) {
+			author(id: $id) { ...fields books @include(if: $books) { title } }
+		}
+		fragment fields on Author { name }`,
+		Variables: map[string]interface{}{"id": "bob"},
+	}))
+	assert.JSONEq(t, `{"data":{"author":{"name":"Ann"}}}`, execute(t, Request{
+		Query: `{ author(id: "ann") { ... on Author { name } ... on Book { title } } }`,
+	}))
+}
+
+func TestExecuteErrors(t *testing.T) {
+	// Field errors null the field and are reported with its path
+	assert.JSONEq(t, `{"data":{"author":{"books":[{"broken":null},{"broken":null}]}},"errors":[
+		{"message":"out of ink","path":["author","books",0,"broken"]},
+		{"message":"out of ink","path":["author","books",1,"broken"]}]}`,
+		execute(t, Request{Query: `{ author(id: "ann") { books { broken } } }`}))
+	assert.JSONEq(t, `{"data":{"author":{"age":null}},"errors":[{"message":"cannot query field \"age\" on type \"Author\"","path":["author","age"]}]}`,
+		execute(t, Request{Query: `{ author(id: "ann") { age } }`}))
+	assert.JSONEq(t, `{"data":{"author":null},"errors":[{"message":"field \"author\" of type \"Author\" must have a selection of subfields","path":["author"]}]}`,
+		execute(t, Request{Query: `{ author(id: "ann") }`}))
+
+	// Requests that fail before execution have no data
+	for _, query := range []string{
+		`{ author(id: "ann") { name }`,
+		`mutation { author(id: "ann") { name } }`,
+		`query($id: String!) { author(id: $id) { name } }`,
+		`{ author(id: "ann") { books { title } books { ...loop } } } fragment loop on Book { ...loop }`,
+		`{ author(id: "ann") { books { title { deeper } } } }`,
+	} {
+		var response Response
+		require.NoError(t, json.Unmarshal([]byte(execute(t, Request{Query: query})), &response))
+		assert.Nil(t, response.Data, query)
+		assert.NotEmpty(t, response.Errors, query)
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc, err := parse(`
+		# Comments and commas are ignored
+		query Named($ids: [ID!]! = ["a", "b"]) {
+			field(int: -12, float: 1.5e3, string: "tab\tquote\"é", block: """ raw "text" """,
+				bool: true, null: null, enum: RED, list: [1, 2], object: {key: $ids})
+		}`)
+	require.NoError(t, err)
+	require.Len(t, doc.operations, 1)
+
+	op := doc.operations[0]
+	assert.Equal(t, "Named", op.name)
+	require.Len(t, op.variables, 1)
+	assert.Equal(t, "[ID!]!", op.variables[0].typ)
+	assert.Equal(t, []interface{}{"a", "b"}, op.variables[0].defaultValue)
+
+	args := op.selections[0].arguments
+	assert.Equal(t, int64(-12), args["int"])
+	assert.Equal(t, 1500.0, args["float"])
+	assert.Equal(t, "tab\tquote\"é", args["string"])
+	assert.Equal(t, `raw "text"`, args["block"])
+	assert.Equal(t, true, args["bool"])
+	assert.Nil(t, args["null"])
+	assert.Equal(t, enum("RED"), args["enum"])
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, args["list"])
+	assert.Equal(t, map[string]interface{}{"key": variable("ids")}, args["object"])
+
+	for _, src := range []string{``, `{}`, `{ a(b: ) }`, `{ a(b: "unterminated) }`, `query { a(b: 1, b: 2) }`} {
+		_, err := parse(src)
+		assert.Error(t, err, src)
+	}
+}
@@ -0,0 +1,674 @@
+// Package graphql executes GraphQL queries against a schema of resolvers. It implements the
+// query language, with variables, fragments and the @skip and @include directives, but not
+// the type system: fields are resolved by name and leaf values are returned as they encode
+// to JSON. Mutations, subscriptions and introspection are not supported.
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// document is a parsed query document
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+// operation is an operation of a document
+type operation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	variables  []*variableDefinition
+	selections []*selection
+}
+
+// variableDefinition declares a variable of an operation
+type variableDefinition struct {
+	name         string
+	typ          string
+	defaultValue interface{} // nil if there is none
+	hasDefault   bool
+}
+
+// fragment is a named fragment
+type fragment struct {
+	name       string
+	on         string // Type condition
+	selections []*selection
+}
+
+// selection is a field, a fragment spread or an inline fragment
+type selection struct {
+	alias      string // Response key, the field name unless aliased
+	name       string // Field name, empty for fragments
+	arguments  map[string]interface{}
+	directives []*directive
+	selections []*selection
+	spread     string // Name of the spread fragment
+	inline     bool   // Whether the selection is an inline fragment
+	on         string // Type condition of an inline fragment, empty for none
+}
+
+// directive is a directive applied to a selection
+type directive struct {
+	name      string
+	arguments map[string]interface{}
+}
+
+// variable is a value referencing a variable
+type variable string
+
+// enum is an enum value
+type enum string
+
+// tokenKind is the kind of a lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+// token is a lexical token of a document
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// parser is a recursive descent parser of query documents
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+// parse parses a query document
+func parse(src string) (*document, error) {
+	p := &parser{src: src}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &document{fragments: map[string]*fragment{}}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunctuator, "{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: selections})
+		case p.peek(tokenName, "query"), p.peek(tokenName, "mutation"), p.peek(tokenName, "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peek(tokenName, "fragment"):
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[frag.name]; ok {
+				return nil, fmt.Errorf("there can be only one fragment named %q", frag.name)
+			}
+			doc.fragments[frag.name] = frag
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("document has no operation")
+	}
+	return doc, nil
+}
+
+// operation parses an operation definition
+func (p *parser) operation() (*operation, error) {
+	op := &operation{kind: p.tok.value}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenName {
+		op.name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek(tokenPunctuator, "(") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for !p.peek(tokenPunctuator, ")") {
+			def, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, def)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	// Directives of operations have no effect here
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = selections
+	return op, nil
+}
+
+// variableDefinition parses $name: Type = default
+func (p *parser) variableDefinition() (*variableDefinition, error) {
+	if err := p.expect(tokenPunctuator, "$"); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenPunctuator, ":"); err != nil {
+		return nil, err
+	}
+	typ, err := p.typeReference()
+	if err != nil {
+		return nil, err
+	}
+
+	def := &variableDefinition{name: name, typ: typ}
+	if p.peek(tokenPunctuator, "=") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if def.defaultValue, err = p.value(true); err != nil {
+			return nil, err
+		}
+		def.hasDefault = true
+	}
+	return def, nil
+}
+
+// typeReference parses a type such as [String!]!
+func (p *parser) typeReference() (string, error) {
+	var typ string
+	if p.peek(tokenPunctuator, "[") {
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		inner, err := p.typeReference()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect(tokenPunctuator, "]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.peek(tokenPunctuator, "!") {
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		typ += "!"
+	}
+	return typ, nil
+}
+
+// fragment parses a fragment definition
+func (p *parser) fragment() (*fragment, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, fmt.Errorf("fragment may not be named on")
+	}
+	if err := p.expect(tokenName, "on"); err != nil {
+		return nil, err
+	}
+	on, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &fragment{name: name, on: on, selections: selections}, nil
+}
+
+// selectionSet parses { selection... }
+func (p *parser) selectionSet() ([]*selection, error) {
+	if err := p.expect(tokenPunctuator, "{"); err != nil {
+		return nil, err
+	}
+	var selections []*selection
+	for !p.peek(tokenPunctuator, "}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("empty selection set at %d", p.tok.pos)
+	}
+	return selections, p.advance()
+}
+
+// selection parses a field, fragment spread or inline fragment
+func (p *parser) selection() (*selection, error) {
+	sel := &selection{}
+	var err error
+
+	if p.peek(tokenPunctuator, "...") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokenName && p.tok.value != "on" {
+			sel.spread = p.tok.value
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			sel.directives, err = p.directives()
+			return sel, err
+		}
+
+		sel.inline = true
+		if p.peek(tokenName, "on") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if sel.on, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if sel.directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		sel.selections, err = p.selectionSet()
+		return sel, err
+	}
+
+	if sel.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	sel.alias = sel.name
+	if p.peek(tokenPunctuator, ":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if sel.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if sel.arguments, err = p.arguments(); err != nil {
+		return nil, err
+	}
+	if sel.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek(tokenPunctuator, "{") {
+		if sel.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+// arguments parses an optional (name: value...) list
+func (p *parser) arguments() (map[string]interface{}, error) {
+	if !p.peek(tokenPunctuator, "(") {
+		return nil, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	arguments := map[string]interface{}{}
+	for !p.peek(tokenPunctuator, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := arguments[name]; ok {
+			return nil, fmt.Errorf("there can be only one argument named %q", name)
+		}
+		if err := p.expect(tokenPunctuator, ":"); err != nil {
+			return nil, err
+		}
+		if arguments[name], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	return arguments, p.advance()
+}
+
+// directives parses an optional list of @name(arguments)
+func (p *parser) directives() ([]*directive, error) {
+	var directives []*directive
+	for p.peek(tokenPunctuator, "@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		arguments, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, &directive{name: name, arguments: arguments})
+	}
+	return directives, nil
+}
+
+// value parses a value, constant values may not reference variables
+func (p *parser) value(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenPunctuator:
+		switch tok.value {
+		case "$":
+			if constant {
+				return nil, fmt.Errorf("unexpected variable at %d", tok.pos)
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			return variable(name), err
+		case "[":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			list := []interface{}{}
+			for !p.peek(tokenPunctuator, "]") {
+				item, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			}
+			return list, p.advance()
+		case "{":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			object := map[string]interface{}{}
+			for !p.peek(tokenPunctuator, "}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(tokenPunctuator, ":"); err != nil {
+					return nil, err
+				}
+				if object[name], err = p.value(constant); err != nil {
+					return nil, err
+				}
+			}
+			return object, p.advance()
+		}
+	case tokenInt:
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s at %d", tok.value, tok.pos)
+		}
+		return n, p.advance()
+	case tokenFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %s at %d", tok.value, tok.pos)
+		}
+		return f, p.advance()
+	case tokenString:
+		return tok.value, p.advance()
+	case tokenName:
+		var value interface{}
+		switch tok.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = enum(tok.value)
+		}
+		return value, p.advance()
+	}
+	return nil, p.unexpected()
+}
+
+// name consumes a name token
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+// expect consumes a token of a kind and value
+func (p *parser) expect(kind tokenKind, value string) error {
+	if !p.peek(kind, value) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+// peek reports whether the current token is of a kind and value
+func (p *parser) peek(kind tokenKind, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+// unexpected returns the error of an unexpected token
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of document")
+	}
+	return fmt.Errorf("unexpected %q at %d", p.tok.value, p.tok.pos)
+}
+
+// advance reads the next token
+func (p *parser) advance() error {
+	p.skipIgnored()
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokenEOF, pos: start}
+		return nil
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = token{kind: tokenPunctuator, value: "...", pos: start}
+	case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokenPunctuator, value: string(c), pos: start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokenName, value: p.src[start:p.pos], pos: start}
+	case c == '-' || isDigit(c):
+		return p.number()
+	case c == '"':
+		return p.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		return fmt.Errorf("unexpected character %q at %d", r, start)
+	}
+	return nil
+}
+
+// skipIgnored skips whitespace, commas and comments
+func (p *parser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "\uFEFF"):
+			p.pos += len("\uFEFF")
+		default:
+			return
+		}
+	}
+}
+
+// number reads an integer or float token
+func (p *parser) number() error {
+	start := p.pos
+	kind := tokenInt
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() int {
+		n := 0
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+			n++
+		}
+		return n
+	}
+	if digits() == 0 {
+		return fmt.Errorf("invalid number at %d", start)
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		kind = tokenFloat
+		p.pos++
+		if digits() == 0 {
+			return fmt.Errorf("invalid number at %d", start)
+		}
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		kind = tokenFloat
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			return fmt.Errorf("invalid number at %d", start)
+		}
+	}
+	p.tok = token{kind: kind, value: p.src[start:p.pos], pos: start}
+	return nil
+}
+
+// string reads a string or block string token
+func (p *parser) string() error {
+	start := p.pos
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		p.pos += 3
+		var b strings.Builder
+		for {
+			if p.pos >= len(p.src) {
+				return fmt.Errorf("unterminated string at %d", start)
+			}
+			if strings.HasPrefix(p.src[p.pos:], `\"""`) {
+				b.WriteString(`"""`)
+				p.pos += 4
+				continue
+			}
+			if strings.HasPrefix(p.src[p.pos:], `"""`) {
+				p.pos += 3
+				break
+			}
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+		}
+		p.tok = token{kind: tokenString, value: strings.TrimSpace(b.String()), pos: start}
+		return nil
+	}
+
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			return fmt.Errorf("unterminated string at %d", start)
+		}
+		c := p.src[p.pos]
+		if c == '"' {
+			p.pos++
+			break
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+
+		if p.pos+1 >= len(p.src) {
+			return fmt.Errorf("unterminated string at %d", start)
+		}
+		escape := p.src[p.pos+1]
+		p.pos += 2
+		switch escape {
+		case '"', '\\', '/':
+			b.WriteByte(escape)
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			if p.pos+4 > len(p.src) {
+				return fmt.Errorf("invalid unicode escape at %d", p.pos-2)
+			}
+			code, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+			if err != nil {
+				return fmt.Errorf("invalid unicode escape at %d", p.pos-2)
+			}
+			b.WriteRune(rune(code))
+			p.pos += 4
+		default:
+			return fmt.Errorf("invalid escape \\%c at %d", escape, p.pos-2)
+		}
+	}
+	p.tok = token{kind: tokenString, value: b.String(), pos: start}
+	return nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,342 @@
+// Package index keeps a local Badger index of the events of the OrbitDB database, so event
+// reads are key lookups instead of docstore scans. OrbitDB stays the source of truth: the
+// index is rebuilt from it and follows its writes and replication.
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// Key prefixes. Events are stored under their ID; the other keys are empty and end with the
+// inverted creation time and the event ID, so iterating a prefix returns events newest
+// first, ties by ID, like QueryEvents.
+var (
+	eventPrefix  = []byte("e\x00") // e, ID: event JSON
+	timePrefix   = []byte("c\x00") // c, time, ID: every event
+	kindPrefix   = []byte("k\x00") // k, kind, time, ID
+	authorPrefix = []byte("a\x00") // a, pubkey, 0, time, ID
+	tagPrefix    = []byte("t\x00") // t, name, 0, value, 0, time, ID
+)
+
+// Index is a Badger index of nostr events
+type Index struct {
+	db *badger.DB
+}
+
+// Open opens or creates the index in dir
+func Open(dir string) (*Index, error) {
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event index: %w", err)
+	}
+	return &Index{db: db}, nil
+}
+
+// Close closes the index
+func (x *Index) Close() error {
+	return x.db.Close()
+}
+
+// Clear removes every indexed event
+func (x *Index) Clear() error {
+	return x.db.DropAll()
+}
+
+// invertedTime encodes a creation time so later events sort first
+func invertedTime(createdAt nostr.Timestamp) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, ^uint64(createdAt))
+	return key
+}
+
+// kindKey encodes a kind so its keys are contiguous
+func kindKey(kind int) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, uint32(kind))
+	return key
+}
+
+// tagName normalizes a tag name: single-letter tags are case-sensitive as in NIP-01,
+// longer ones are matched case-insensitively
+func tagName(name string) string {
+	if len(name) == 1 {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+// join concatenates key parts
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// ranges returns the key prefixes of an event, each followed by its time and ID
+func ranges(event *nostr.Event) [][]byte {
+	prefixes := [][]byte{
+		timePrefix,
+		join(kindPrefix, kindKey(event.Kind)),
+		join(authorPrefix, []byte(event.PubKey), []byte{0}),
+	}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 {
+			prefixes = append(prefixes, join(tagPrefix, []byte(tagName(tag[0])), []byte{0}, []byte(tag[1]), []byte{0}))
+		}
+	}
+	return prefixes
+}
+
+// keys returns the index keys of an event
+func keys(event *nostr.Event) [][]byte {
+	suffix := join(invertedTime(event.CreatedAt), []byte(event.ID))
+	var keys [][]byte
+	for _, prefix := range ranges(event) {
+		keys = append(keys, join(prefix, suffix))
+	}
+	return keys
+}
+
+// Put indexes events, replacing the indexed events with the same IDs
+func (x *Index) Put(events ...*nostr.Event) error {
+	txn := x.db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	for _, event := range events {
+		err := putEvent(txn, event)
+		if errors.Is(err, badger.ErrTxnTooBig) {
+			// Commit the events so far and index the event again in a new transaction
+			if err := txn.Commit(); err != nil {
+				return err
+			}
+			txn = x.db.NewTransaction(true)
+			err = putEvent(txn, event)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return txn.Commit()
+}
+
+// putEvent indexes an event in txn
+func putEvent(txn *badger.Txn, event *nostr.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := deleteEvent(txn, event.ID); err != nil {
+		return err
+	}
+	if err := txn.Set(join(eventPrefix, []byte(event.ID)), data); err != nil {
+		return err
+	}
+	for _, key := range keys(event) {
+		if err := txn.Set(key, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes events from the index, unknown IDs are ignored
+func (x *Index) Delete(ids ...string) error {
+	return x.db.Update(func(txn *badger.Txn) error {
+		for _, id := range ids {
+			if err := deleteEvent(txn, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteEvent removes an event and its index keys, if it is indexed
+func deleteEvent(txn *badger.Txn, id string) error {
+	event, err := getEvent(txn, id)
+	if err != nil || event == nil {
+		return err
+	}
+	for _, key := range keys(event) {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return txn.Delete(join(eventPrefix, []byte(id)))
+}
+
+// getEvent reads an indexed event, nil if it isn't indexed
+func getEvent(txn *badger.Txn, id string) (*nostr.Event, error) {
+	item, err := txn.Get(join(eventPrefix, []byte(id)))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	var event nostr.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("invalid indexed event %s: %w", id, err)
+	}
+	return &event, nil
+}
+
+// Get returns an indexed event, nil if it isn't indexed
+func (x *Index) Get(id string) (*nostr.Event, error) {
+	var event *nostr.Event
+	err := x.db.View(func(txn *badger.Txn) error {
+		var err error
+		event, err = getEvent(txn, id)
+		return err
+	})
+	return event, err
+}
+
+// plan returns the key prefixes whose events include every event matching the filter, from
+// the most selective filter field, or nil if the filter has IDs, which are looked up directly
+func plan(filter nostr.Filter) [][]byte {
+	if len(filter.IDs) > 0 {
+		return nil
+	}
+	for name, values := range filter.Tags {
+		if len(values) == 0 {
+			continue
+		}
+		prefixes := make([][]byte, len(values))
+		for i, value := range values {
+			prefixes[i] = join(tagPrefix, []byte(tagName(name)), []byte{0}, []byte(value), []byte{0})
+		}
+		return prefixes
+	}
+	if len(filter.Authors) > 0 {
+		prefixes := make([][]byte, len(filter.Authors))
+		for i, author := range filter.Authors {
+			prefixes[i] = join(authorPrefix, []byte(author), []byte{0})
+		}
+		return prefixes
+	}
+	if len(filter.Kinds) > 0 {
+		prefixes := make([][]byte, len(filter.Kinds))
+		for i, kind := range filter.Kinds {
+			prefixes[i] = join(kindPrefix, kindKey(kind))
+		}
+		return prefixes
+	}
+	return [][]byte{timePrefix}
+}
+
+// scan calls fn with the events matching the filter and not excluded, newest first
+// within each prefix of the plan, stopping each prefix after limit events if limit is positive. Prefixes are sorted,
+// so the first limit events of each contain the overall newest limit events. Different
+// prefixes may return the same event.
+func scan(txn *badger.Txn, filter nostr.Filter, exclusion *orbitdb.EventExclusion, limit int, fn func(event *nostr.Event)) error {
+	prefixes := plan(filter)
+	if prefixes == nil {
+		for _, id := range filter.IDs {
+			event, err := getEvent(txn, id)
+			if err != nil {
+				return err
+			}
+			if event != nil && orbitdb.MatchesEvent(event, filter) && !exclusion.Excludes(event) {
+				fn(event)
+			}
+		}
+		return nil
+	}
+
+	for _, prefix := range prefixes {
+		if err := scanPrefix(txn, prefix, filter, exclusion, limit, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanPrefix calls fn with up to limit events of a prefix matching the filter, between its
+// Until and Since, leaving out excluded events
+func scanPrefix(txn *badger.Txn, prefix []byte, filter nostr.Filter, exclusion *orbitdb.EventExclusion, limit int, fn func(event *nostr.Event)) error {
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+	defer it.Close()
+
+	start := prefix
+	if filter.Until != nil {
+		start = join(prefix, invertedTime(*filter.Until))
+	}
+	matched := 0
+	for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+		key := it.Item().Key()
+		if len(key) < len(prefix)+8 {
+			continue
+		}
+		createdAt := nostr.Timestamp(^binary.BigEndian.Uint64(key[len(prefix):]))
+		if filter.Since != nil && createdAt < *filter.Since {
+			break
+		}
+
+		event, err := getEvent(txn, string(key[len(prefix)+8:]))
+		if err != nil {
+			return err
+		}
+		if event == nil || !orbitdb.MatchesEvent(event, filter) || exclusion.Excludes(event) {
+			continue
+		}
+		fn(event)
+		if matched++; limit > 0 && matched >= limit {
+			break
+		}
+	}
+	return nil
+}
+
+// Query returns the events matching the filter newest first, ties by ID, cut to the filter
+// Limit if it is positive. Excluded events are left out.
+func (x *Index) Query(filter nostr.Filter, exclusion *orbitdb.EventExclusion) ([]*nostr.Event, error) {
+	seen := map[string]bool{}
+	var events []*nostr.Event
+	err := x.db.View(func(txn *badger.Txn) error {
+		return scan(txn, filter, exclusion, filter.Limit, func(event *nostr.Event) {
+			if !seen[event.ID] {
+				seen[event.ID] = true
+				events = append(events, event)
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].CreatedAt != events[j].CreatedAt {
+			return events[i].CreatedAt > events[j].CreatedAt
+		}
+		return events[i].ID < events[j].ID
+	})
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+// Count returns the number of events matching the filter, leaving out excluded events
+func (x *Index) Count(filter nostr.Filter, exclusion *orbitdb.EventExclusion) (int, error) {
+	seen := map[string]bool{}
+	err := x.db.View(func(txn *badger.Txn) error {
+		return scan(txn, filter, exclusion, 0, func(event *nostr.Event) {
+			seen[event.ID] = true
+		})
+	})
+	return len(seen), err
+}
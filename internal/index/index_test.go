@@ -0,0 +1,142 @@
+package index
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+func openIndex(t *testing.T) *Index {
+	idx, err := Open(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { idx.Close() })
+	return idx
+}
+
+func ids(events []*nostr.Event) []string {
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+// signed signs event with a fresh key, as the adapter only saves signed events
+func signed(t *testing.T, event *nostr.Event) *nostr.Event {
+	require.NoError(t, event.Sign(nostr.GeneratePrivateKey()))
+	return event
+}
+
+func testEvents() []*nostr.Event {
+	return []*nostr.Event{
+		{ID: "a", PubKey: "alice", Kind: 1, CreatedAt: 100, Tags: nostr.Tags{{"sid", "0xabc"}}},
+		{ID: "b", PubKey: "bob", Kind: 1, CreatedAt: 200, Tags: nostr.Tags{{"e", "a"}}},
+		{ID: "c", PubKey: "alice", Kind: 7, CreatedAt: 300, Tags: nostr.Tags{{"e", "a"}, {"SID", "0xabc"}}},
+		{ID: "d", PubKey: "carol", Kind: 1, CreatedAt: 300, Tags: nostr.Tags{}},
+	}
+}
+
+func TestIndexQuery(t *testing.T) {
+	idx := openIndex(t)
+	require.NoError(t, idx.Put(testEvents()...))
+
+	since, until := nostr.Timestamp(150), nostr.Timestamp(300)
+	for _, tc := range []struct {
+		name   string
+		filter nostr.Filter
+		want   []string
+	}{
+		{"all newest first, ties by ID", nostr.Filter{}, []string{"c", "d", "b", "a"}},
+		{"ids", nostr.Filter{IDs: []string{"a", "x", "d"}}, []string{"d", "a"}},
+		{"authors", nostr.Filter{Authors: []string{"alice"}}, []string{"c", "a"}},
+		{"kinds", nostr.Filter{Kinds: []int{1}}, []string{"d", "b", "a"}},
+		{"kinds and authors", nostr.Filter{Kinds: []int{1}, Authors: []string{"alice"}}, []string{"a"}},
+		{"single-letter tag", nostr.Filter{Tags: nostr.TagMap{"e": {"a"}}}, []string{"c", "b"}},
+		{"tags named case-insensitively", nostr.Filter{Tags: nostr.TagMap{"sid": {"0xabc"}}}, []string{"c", "a"}},
+		{"time range", nostr.Filter{Since: &since, Until: &until}, []string{"c", "d", "b"}},
+		{"limit", nostr.Filter{Limit: 2}, []string{"c", "d"}},
+		{"limit across prefixes", nostr.Filter{Authors: []string{"alice", "bob"}, Limit: 2}, []string{"c", "b"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := idx.Query(tc.filter, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, ids(events))
+
+			if tc.filter.Limit == 0 {
+				count, err := idx.Count(tc.filter, nil)
+				require.NoError(t, err)
+				assert.Equal(t, len(tc.want), count)
+			}
+		})
+	}
+}
+
+func TestIndexReplaceAndDelete(t *testing.T) {
+	idx := openIndex(t)
+	require.NoError(t, idx.Put(testEvents()...))
+
+	// A replaced event is only found under its new keys
+	require.NoError(t, idx.Put(&nostr.Event{ID: "a", PubKey: "dave", Kind: 1, CreatedAt: 100}))
+	events, err := idx.Query(nostr.Filter{Authors: []string{"alice"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, ids(events))
+
+	require.NoError(t, idx.Delete("a", "unknown"))
+	event, err := idx.Get("a")
+	require.NoError(t, err)
+	assert.Nil(t, event)
+	count, err := idx.Count(nostr.Filter{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	// Excluded events are left out before the limit
+	ctx := context.Background()
+	adapter := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("exclusion"))
+	mutes := signed(t, &nostr.Event{Kind: orbitdb.MuteListKind, CreatedAt: 100, Tags: nostr.Tags{{"p", "alice"}}})
+	adapter.SetModerators([]string{mutes.PubKey})
+	require.NoError(t, adapter.SaveEvent(ctx, mutes))
+	exclusion, err := adapter.QueryExclusion(orbitdb.WithMuteFilter(ctx))
+	require.NoError(t, err)
+	events, err = idx.Query(nostr.Filter{Limit: 1}, exclusion)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d"}, ids(events))
+}
+
+func TestIndexedStore(t *testing.T) {
+	ctx := context.Background()
+	adapter := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("indexed"))
+	a := signed(t, &nostr.Event{Kind: 1, CreatedAt: 100, Tags: nostr.Tags{}})
+	require.NoError(t, adapter.SaveEvent(ctx, a))
+
+	store := NewIndexedStore(adapter, openIndex(t))
+	assert.False(t, store.Ready())
+	indexed, err := store.Build(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, indexed)
+	assert.True(t, store.Ready())
+
+	// Saved events can be read back from the index right away
+	b := signed(t, &nostr.Event{Kind: 1, CreatedAt: 200, Tags: nostr.Tags{}})
+	require.NoError(t, store.SaveEvent(ctx, b))
+	event, err := store.index.Get(b.ID)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+
+	eventChan, err := store.QueryEvents(ctx, nostr.Filter{Kinds: []int{1}})
+	require.NoError(t, err)
+	var got []*nostr.Event
+	for event := range eventChan {
+		got = append(got, event)
+	}
+	assert.Equal(t, []string{b.ID, a.ID}, ids(got))
+
+	require.NoError(t, store.DeleteEvent(ctx, event))
+	count, err := store.CountEvents(ctx, nostr.Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
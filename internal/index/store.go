@@ -0,0 +1,217 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-orbit-db/stores"
+	"berty.tech/go-orbit-db/stores/operation"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// IndexedStore is a Store serving event reads from the index once it is built. Events saved
+// and deleted through the store are mirrored synchronously; the writes of other code paths,
+// such as retention sweeps and restores, and replicated entries are mirrored from the
+// database's event bus.
+type IndexedStore struct {
+	storage.Store
+	index *Index
+	ready atomic.Bool // Set once the index holds every event of the store
+}
+
+// NewIndexedStore wraps a store so its event reads use the index. Reads use the store until
+// Build is done.
+func NewIndexedStore(store storage.Store, index *Index) *IndexedStore {
+	return &IndexedStore{Store: store, index: index}
+}
+
+// Build indexes every event of the store, replacing the index content, and then serves event
+// reads from the index. Writes during the build are mirrored too.
+func (s *IndexedStore) Build(ctx context.Context) (int, error) {
+	s.ready.Store(false)
+	if err := s.index.Clear(); err != nil {
+		return 0, fmt.Errorf("failed to clear event index: %w", err)
+	}
+
+	eventChan, err := s.Store.QueryEvents(ctx, nostr.Filter{})
+	if err != nil {
+		return 0, err
+	}
+	var batch []*nostr.Event
+	indexed := 0
+	for event := range eventChan {
+		batch = append(batch, event)
+		if len(batch) == 1000 {
+			if err := s.index.Put(batch...); err != nil {
+				return indexed, err
+			}
+			indexed += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return indexed, err
+	}
+	if err := s.index.Put(batch...); err != nil {
+		return indexed, err
+	}
+	indexed += len(batch)
+
+	s.ready.Store(true)
+	return indexed, nil
+}
+
+// Ready reports whether event reads are served from the index
+func (s *IndexedStore) Ready() bool {
+	return s.ready.Load()
+}
+
+// Watch mirrors the writes and replicated entries of a store's event bus until ctx is done
+func (s *IndexedStore) Watch(ctx context.Context, bus event.Bus) error {
+	sub, err := bus.Subscribe([]interface{}{new(stores.EventWrite), new(stores.EventReplicated)})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to store writes: %w", err)
+	}
+
+	go func() {
+		defer sub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+				if err := s.mirror(evt); err != nil {
+					zap.L().Warn("Event index update failed, rebuild it", zap.Error(err))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// mirror applies the entries of a write or replication event to the index
+func (s *IndexedStore) mirror(evt interface{}) error {
+	var entries []ipfslog.Entry
+	switch evt := evt.(type) {
+	case stores.EventWrite:
+		entries = []ipfslog.Entry{evt.Entry}
+	case *stores.EventWrite:
+		entries = []ipfslog.Entry{evt.Entry}
+	case stores.EventReplicated:
+		entries = evt.Entries
+	case *stores.EventReplicated:
+		entries = evt.Entries
+	}
+
+	for _, entry := range entries {
+		op, err := operation.ParseOperation(entry)
+		if err != nil {
+			continue
+		}
+		switch op.GetOperation() {
+		case "PUT":
+			err = s.mirrorDocument(op.GetKey(), op.GetValue())
+		case "PUTALL":
+			for _, doc := range op.GetDocs() {
+				key := doc.GetKey()
+				if err = s.mirrorDocument(&key, doc.GetValue()); err != nil {
+					break
+				}
+			}
+		case "DEL":
+			if key := op.GetKey(); key != nil {
+				err = s.index.Delete(*key)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mirrorDocument indexes a written document if it is an event, and otherwise removes the
+// event it may replace, e.g. the tombstone of a purged event
+func (s *IndexedStore) mirrorDocument(key *string, value []byte) error {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(value, &doc); err != nil {
+		return nil
+	}
+	if event, ok := orbitdb.EventFromDocument(doc); ok {
+		return s.index.Put(event)
+	}
+	if key == nil {
+		return nil
+	}
+	return s.index.Delete(*key)
+}
+
+// SaveEvent saves the event and indexes it, so it can be read back right away
+func (s *IndexedStore) SaveEvent(ctx context.Context, event *nostr.Event) error {
+	if err := s.Store.SaveEvent(ctx, event); err != nil {
+		return err
+	}
+	if err := s.index.Put(event); err != nil {
+		zap.L().Warn("Failed to index event", zap.String("event", event.ID), zap.Error(err))
+	}
+	return nil
+}
+
+// DeleteEvent deletes the event and removes it from the index
+func (s *IndexedStore) DeleteEvent(ctx context.Context, event *nostr.Event) error {
+	if err := s.Store.DeleteEvent(ctx, event); err != nil {
+		return err
+	}
+	if err := s.index.Delete(event.ID); err != nil {
+		zap.L().Warn("Failed to remove event from the index", zap.String("event", event.ID), zap.Error(err))
+	}
+	return nil
+}
+
+// GetEventByID reads the event from the index
+func (s *IndexedStore) GetEventByID(ctx context.Context, id string) (*nostr.Event, error) {
+	if !s.Ready() {
+		return s.Store.GetEventByID(ctx, id)
+	}
+	return s.index.Get(id)
+}
+
+// QueryEvents reads the events matching the filter from the index
+func (s *IndexedStore) QueryEvents(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+	if !s.Ready() {
+		return s.Store.QueryEvents(ctx, filter)
+	}
+
+	exclusion, err := s.Store.QueryExclusion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.index.Query(filter, exclusion)
+	if err != nil {
+		return nil, err
+	}
+	return orbitdb.StreamEvents(ctx, events, 0), nil
+}
+
+// CountEvents counts the events matching the filter in the index
+func (s *IndexedStore) CountEvents(ctx context.Context, filter nostr.Filter) (int, error) {
+	if !s.Ready() {
+		return s.Store.CountEvents(ctx, filter)
+	}
+	exclusion, err := s.Store.QueryExclusion(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.index.Count(filter, exclusion)
+}
@@ -0,0 +1,76 @@
+// Package logging sets up the structured logger of the service. Packages log through the
+// global zap logger, zap.L(), which Setup replaces with one writing at the configured level
+// and format.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// New creates a logger writing entries at cfg.Level and above to out, in cfg.Format
+func New(cfg config.LogConfig, out io.Writer) (*zap.Logger, error) {
+	level, err := zapcore.ParseLevel(strings.ToLower(cfg.Level))
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := zap.NewProductionEncoderConfig()
+	encoding.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoding.EncodeDuration = zapcore.StringDurationEncoder
+	var encoder zapcore.Encoder
+	switch cfg.Format {
+	case config.LogFormatJSON:
+		encoder = zapcore.NewJSONEncoder(encoding)
+	case config.LogFormatConsole, "":
+		encoding.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoding)
+	default:
+		return nil, fmt.Errorf("unsupported log format %q", cfg.Format)
+	}
+
+	ws := zapcore.Lock(zapcore.AddSync(out))
+	return zap.New(zapcore.NewCore(encoder, ws, level), zap.AddCaller(), zap.ErrorOutput(ws)), nil
+}
+
+// Setup makes a logger configured by cfg the global logger, writing to cfg.File or stderr.
+// Output of the standard library logger, still used by dependencies, goes through it too.
+// The returned function flushes the logger and restores the previous one.
+func Setup(cfg config.LogConfig) (func(), error) {
+	var out io.Writer = os.Stderr
+	var file *os.File
+	if cfg.File != "" {
+		var err error
+		file, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file %s: %w", cfg.File, err)
+		}
+		out = file
+	}
+
+	logger, err := New(cfg, out)
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, err
+	}
+
+	restoreGlobals := zap.ReplaceGlobals(logger)
+	restoreStdLog := zap.RedirectStdLog(logger)
+	return func() {
+		logger.Sync()
+		restoreStdLog()
+		restoreGlobals()
+		if file != nil {
+			file.Close()
+		}
+	}, nil
+}
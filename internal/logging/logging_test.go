@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(config.LogConfig{Level: "warn", Format: config.LogFormatJSON}, &buf)
+	require.NoError(t, err)
+
+	logger.Info("dropped")
+	logger.Warn("Failed to update causality", zap.String("event", "abc"), zap.Error(errors.New("boom")))
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry), "one entry below the level is dropped")
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "Failed to update causality", entry["msg"])
+	assert.Equal(t, "abc", entry["event"])
+	assert.Equal(t, "boom", entry["error"])
+
+	buf.Reset()
+	logger, err = New(config.LogConfig{Level: "DEBUG", Format: config.LogFormatConsole}, &buf)
+	require.NoError(t, err)
+	logger.Debug("Connected to peer", zap.String("peer", "QmA"))
+	assert.Contains(t, buf.String(), "DEBUG")
+	assert.Contains(t, buf.String(), `Connected to peer	{"peer": "QmA"}`)
+
+	_, err = New(config.LogConfig{Level: "trace"}, &buf)
+	assert.Error(t, err)
+	_, err = New(config.LogConfig{Level: "info", Format: "logfmt"}, &buf)
+	assert.Error(t, err)
+}
+
+// Test that the global and standard library loggers write to the log file until restored
+func TestSetup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	restore, err := Setup(config.LogConfig{Level: "info", Format: config.LogFormatJSON, File: path})
+	require.NoError(t, err)
+
+	zap.L().Info("from zap")
+	log.Printf("from the standard library")
+	restore()
+	zap.L().Info("after restore")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"msg":"from zap"`)
+	assert.Contains(t, string(data), `"msg":"from the standard library"`)
+	assert.NotContains(t, string(data), "after restore")
+}
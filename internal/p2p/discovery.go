@@ -0,0 +1,158 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multihash"
+	"go.uber.org/zap"
+)
+
+// maxProviders is the number of providers looked up per database and round
+const maxProviders = 20
+
+// ProviderKey returns the DHT key nodes serving a database address provide. Nodes opening the
+// same database find each other through it.
+func ProviderKey(address string) (cid.Cid, error) {
+	hash, err := multihash.Sum([]byte("crelay-crdt-db/"+address), multihash.SHA2_256, -1)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to hash database address: %w", err)
+	}
+	return cid.NewCidV1(cid.Raw, hash), nil
+}
+
+// DiscoveryStats describes the peers found for the databases
+type DiscoveryStats struct {
+	Rounds     int       `json:"rounds"`               // Discovery rounds run
+	Found      int       `json:"found"`                // Providers found, counting each once per round
+	Connected  int       `json:"connected"`            // Connections established to found providers
+	LastRound  time.Time `json:"last_round,omitempty"` // Start of the last round
+	LastError  string    `json:"last_error,omitempty"` // Last provide or lookup error
+	Databases  []string  `json:"databases"`            // Database addresses advertised
+	ProvidedAs []string  `json:"provided_as"`          // DHT keys of the databases
+}
+
+// Discovery advertises the databases a node serves on the DHT and connects to the other
+// nodes advertising them, so nodes find each other without configured multiaddrs. A nil
+// Discovery does nothing.
+type Discovery struct {
+	routing  routing.ContentRouting
+	dialer   Dialer
+	self     peer.ID
+	interval time.Duration
+	keys     []cid.Cid
+
+	mu    sync.Mutex
+	stats DiscoveryStats
+
+	stopDiscovering context.CancelFunc
+	done            chan struct{}
+}
+
+// NewDiscovery creates a DHT discovery of the nodes serving addresses, checked every
+// interval. self is the ID of this node, which also provides the databases.
+func NewDiscovery(r routing.ContentRouting, dialer Dialer, self peer.ID, addresses []string, interval time.Duration) (*Discovery, error) {
+	d := &Discovery{
+		routing:  r,
+		dialer:   dialer,
+		self:     self,
+		interval: interval,
+		stats:    DiscoveryStats{Databases: addresses, ProvidedAs: []string{}},
+	}
+	for _, address := range addresses {
+		key, err := ProviderKey(address)
+		if err != nil {
+			return nil, err
+		}
+		d.keys = append(d.keys, key)
+		d.stats.ProvidedAs = append(d.stats.ProvidedAs, key.String())
+	}
+	return d, nil
+}
+
+// Discover runs one round: provides every database and connects to the providers that
+// aren't connected yet
+func (d *Discovery) Discover(ctx context.Context) {
+	round := DiscoveryStats{LastRound: time.Now()}
+	for _, key := range d.keys {
+		if err := d.routing.Provide(ctx, key, true); err != nil {
+			round.LastError = fmt.Sprintf("failed to provide %s: %v", key, err)
+		}
+
+		for info := range d.routing.FindProvidersAsync(ctx, key, maxProviders) {
+			if info.ID == d.self || len(info.Addrs) == 0 {
+				continue
+			}
+			round.Found++
+			if d.dialer.Connected(info.ID) {
+				continue
+			}
+			if err := d.dialer.Connect(ctx, info); err != nil {
+				round.LastError = fmt.Sprintf("failed to connect to provider %s: %v", info.ID, err)
+				continue
+			}
+			round.Connected++
+			zap.L().Info("Connected to discovered peer", zap.Stringer("peer", info.ID))
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats.Rounds++
+	d.stats.Found += round.Found
+	d.stats.Connected += round.Connected
+	d.stats.LastRound = round.LastRound
+	d.stats.LastError = round.LastError
+}
+
+// Start discovers peers every interval, starting now, until Stop is called
+func (d *Discovery) Start(ctx context.Context) {
+	if d == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	d.stopDiscovering = cancel
+	d.done = make(chan struct{})
+
+	go func() {
+		defer close(d.done)
+		d.Discover(ctx)
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.Discover(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops discovering, waiting for a running round to stop
+func (d *Discovery) Stop() {
+	if d == nil || d.stopDiscovering == nil {
+		return
+	}
+	d.stopDiscovering()
+	<-d.done
+}
+
+// Stats returns the discovery state
+func (d *Discovery) Stats() DiscoveryStats {
+	if d == nil {
+		return DiscoveryStats{}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
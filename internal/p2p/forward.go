@@ -0,0 +1,229 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.uber.org/zap"
+)
+
+// PubSub publishes and subscribes to pubsub topics, like the IPFS node's PubSub API
+type PubSub interface {
+	Publish(ctx context.Context, topic string, data []byte) error
+	Subscribe(ctx context.Context, topic string, opts ...options.PubSubSubscribeOption) (coreiface.PubSubSubscription, error)
+}
+
+// ForwardRequest is an event forwarded by an edge node over pubsub
+type ForwardRequest struct {
+	ID    string          `json:"id"`    // Request ID, echoed in the reply
+	Event json.RawMessage `json:"event"` // Forwarded event
+	Reply string          `json:"reply"` // Topic the reply is published on, below the forwarding topic
+}
+
+// ForwardReply is the answer of the authority node to a forwarded event
+type ForwardReply struct {
+	ID     string `json:"id"`     // ID of the request answered
+	Status int    `json:"status"` // HTTP status of saving the event
+	Body   string `json:"body"`   // HTTP response body of saving the event
+}
+
+// replyTopic returns the topic the replies to a node's forwarded events are published on
+func replyTopic(topic string, self peer.ID) string {
+	return topic + "/reply/" + self.String()
+}
+
+// PubSubForwarder forwards events to the authority nodes subscribed to a pubsub topic and
+// waits for their reply, so edge nodes need no HTTP route to the authority node
+type PubSubForwarder struct {
+	pubsub PubSub
+	topic  string
+	reply  string
+
+	mu      sync.Mutex
+	pending map[string]chan ForwardReply // Reply channels by request ID
+
+	stopListening context.CancelFunc
+	done          chan struct{}
+}
+
+// NewPubSubForwarder creates a forwarder of events on topic. self is the ID of this node,
+// which names its reply topic.
+func NewPubSubForwarder(pubsub PubSub, topic string, self peer.ID) *PubSubForwarder {
+	return &PubSubForwarder{
+		pubsub:  pubsub,
+		topic:   topic,
+		reply:   replyTopic(topic, self),
+		pending: map[string]chan ForwardReply{},
+	}
+}
+
+// Start subscribes to the replies of the authority nodes until Stop is called
+func (f *PubSubForwarder) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	sub, err := f.pubsub.Subscribe(ctx, f.reply)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to subscribe to %s: %w", f.reply, err)
+	}
+	f.stopListening = cancel
+	f.done = make(chan struct{})
+
+	go func() {
+		defer close(f.done)
+		defer sub.Close()
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					zap.L().Warn("Stopped receiving forwarding replies", zap.Error(err))
+				}
+				return
+			}
+			var reply ForwardReply
+			if err := json.Unmarshal(msg.Data(), &reply); err != nil {
+				continue
+			}
+			f.deliver(reply)
+		}
+	}()
+	return nil
+}
+
+// deliver hands a reply to the request waiting for it, ignoring unknown and repeated replies
+func (f *PubSubForwarder) deliver(reply ForwardReply) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if waiting, ok := f.pending[reply.ID]; ok {
+		delete(f.pending, reply.ID)
+		waiting <- reply
+	}
+}
+
+// Stop stops receiving replies
+func (f *PubSubForwarder) Stop() {
+	if f == nil || f.stopListening == nil {
+		return
+	}
+	f.stopListening()
+	<-f.done
+}
+
+// Forward publishes the event and returns the reply of the first authority node answering
+func (f *PubSubForwarder) Forward(ctx context.Context, event []byte) (int, []byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return 0, nil, err
+	}
+	req := ForwardRequest{ID: hex.EncodeToString(id), Event: event, Reply: f.reply}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	waiting := make(chan ForwardReply, 1)
+	f.mu.Lock()
+	f.pending[req.ID] = waiting
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.pending, req.ID)
+		f.mu.Unlock()
+	}()
+
+	if err := f.pubsub.Publish(ctx, f.topic, data); err != nil {
+		return 0, nil, fmt.Errorf("failed to publish to %s: %w", f.topic, err)
+	}
+	select {
+	case reply := <-waiting:
+		return reply.Status, []byte(reply.Body), nil
+	case <-ctx.Done():
+		return 0, nil, fmt.Errorf("no reply from an authority node: %w", ctx.Err())
+	}
+}
+
+// ForwardServer saves the events edge nodes forward over a pubsub topic and publishes the
+// result on their reply topic. A nil ForwardServer ignores forwarded events.
+type ForwardServer struct {
+	pubsub PubSub
+	topic  string
+	save   func(ctx context.Context, event []byte) (int, []byte)
+
+	stopServing context.CancelFunc
+	done        chan struct{}
+}
+
+// NewForwardServer creates a server of the events forwarded on topic, saved by save
+func NewForwardServer(pubsub PubSub, topic string, save func(ctx context.Context, event []byte) (int, []byte)) *ForwardServer {
+	return &ForwardServer{pubsub: pubsub, topic: topic, save: save}
+}
+
+// Start subscribes to the forwarded events until Stop is called
+func (s *ForwardServer) Start(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub, err := s.pubsub.Subscribe(ctx, s.topic)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to subscribe to %s: %w", s.topic, err)
+	}
+	s.stopServing = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		defer sub.Close()
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					zap.L().Warn("Stopped receiving forwarded events", zap.Error(err))
+				}
+				return
+			}
+			if err := s.serve(ctx, msg.Data()); err != nil {
+				zap.L().Warn("Failed to serve forwarded event", zap.Stringer("peer", msg.From()), zap.Error(err))
+			}
+		}
+	}()
+	return nil
+}
+
+// serve saves a forwarded event and publishes the reply
+func (s *ForwardServer) serve(ctx context.Context, data []byte) error {
+	var req ForwardRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	// Replies only go to reply topics, so the server can't be made to publish elsewhere
+	if req.ID == "" || !strings.HasPrefix(req.Reply, s.topic+"/reply/") {
+		return errors.New("invalid request: missing ID or reply topic")
+	}
+
+	status, body := s.save(ctx, req.Event)
+	reply, err := json.Marshal(ForwardReply{ID: req.ID, Status: status, Body: string(body)})
+	if err != nil {
+		return err
+	}
+	return s.pubsub.Publish(ctx, req.Reply, reply)
+}
+
+// Stop stops saving forwarded events, waiting for the event being saved
+func (s *ForwardServer) Stop() {
+	if s == nil || s.stopServing == nil {
+		return
+	}
+	s.stopServing()
+	<-s.done
+}
@@ -0,0 +1,109 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePubSub delivers messages to the subscriptions of this process
+type fakePubSub struct {
+	mu   sync.Mutex
+	subs map[string][]chan []byte
+}
+
+func (p *fakePubSub) Publish(ctx context.Context, topic string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, sub := range p.subs[topic] {
+		sub <- data
+	}
+	return nil
+}
+
+func (p *fakePubSub) Subscribe(ctx context.Context, topic string, opts ...options.PubSubSubscribeOption) (coreiface.PubSubSubscription, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	messages := make(chan []byte, 10)
+	p.subs[topic] = append(p.subs[topic], messages)
+	return &fakeSubscription{messages: messages}, nil
+}
+
+type fakeSubscription struct {
+	messages chan []byte
+}
+
+func (s *fakeSubscription) Close() error { return nil }
+
+func (s *fakeSubscription) Next(ctx context.Context) (coreiface.PubSubMessage, error) {
+	select {
+	case data := <-s.messages:
+		return fakeMessage(data), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type fakeMessage []byte
+
+func (m fakeMessage) From() peer.ID    { return "" }
+func (m fakeMessage) Data() []byte     { return m }
+func (m fakeMessage) Seq() []byte      { return nil }
+func (m fakeMessage) Topics() []string { return nil }
+
+func TestPubSubForwarding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pubsub := &fakePubSub{subs: map[string][]chan []byte{}}
+
+	var saved []string
+	server := NewForwardServer(pubsub, "crelay-events", func(ctx context.Context, event []byte) (int, []byte) {
+		saved = append(saved, string(event))
+		return http.StatusCreated, nil
+	})
+	require.NoError(t, server.Start(ctx))
+	defer server.Stop()
+
+	peers, err := ParsePeers([]string{relayAddr})
+	require.NoError(t, err)
+	forwarder := NewPubSubForwarder(pubsub, "crelay-events", peers[0].ID)
+	require.NoError(t, forwarder.Start(ctx))
+	defer forwarder.Stop()
+
+	status, _, err := forwarder.Forward(ctx, []byte(`{"id":"abc"}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, []string{`{"id":"abc"}`}, saved)
+}
+
+func TestPubSubForwardingWithoutAuthority(t *testing.T) {
+	pubsub := &fakePubSub{subs: map[string][]chan []byte{}}
+	peers, err := ParsePeers([]string{relayAddr})
+	require.NoError(t, err)
+	forwarder := NewPubSubForwarder(pubsub, "crelay-events", peers[0].ID)
+	require.NoError(t, forwarder.Start(context.Background()))
+	defer forwarder.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = forwarder.Forward(ctx, []byte(`{"id":"abc"}`))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestForwardServerIgnoresForeignReplyTopics(t *testing.T) {
+	server := NewForwardServer(&fakePubSub{subs: map[string][]chan []byte{}}, "crelay-events", func(ctx context.Context, event []byte) (int, []byte) {
+		t.Error("the event must not be saved")
+		return 0, nil
+	})
+	err := server.serve(context.Background(), []byte(`{"id":"1","event":{},"reply":"other-topic"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,192 @@
+// Package p2p connects the IPFS node to its relay and bootstrap peers and private network
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.uber.org/zap"
+)
+
+// Dialer connects to peers and reports whether a connection is alive
+type Dialer interface {
+	// Connect connects to a peer
+	Connect(ctx context.Context, info peer.AddrInfo) error
+	// Connected reports whether there is a live connection to a peer
+	Connected(id peer.ID) bool
+}
+
+// PeerState describes the connection to one configured peer
+type PeerState struct {
+	Peer          string    `json:"peer"`                     // Peer ID
+	Address       string    `json:"address"`                  // Configured multiaddr
+	Connected     bool      `json:"connected"`                // Whether the last check found a live connection
+	Failures      int       `json:"failures"`                 // Connection attempts failed since the last connection
+	LastConnected time.Time `json:"last_connected,omitempty"` // Last time a connection was established or found alive
+	LastError     string    `json:"last_error,omitempty"`     // Error of the last failed attempt
+	NextAttempt   time.Time `json:"next_attempt,omitempty"`   // Earliest time of the next attempt while disconnected
+}
+
+// PeerKeeper connects to the configured peers and reconnects, with exponential backoff,
+// those whose connection dropped. A nil PeerKeeper connects to nothing.
+type PeerKeeper struct {
+	dialer Dialer
+	cfg    config.RelayConfig
+	peers  []peer.AddrInfo
+
+	mu     sync.Mutex
+	states []PeerState
+
+	stopChecking context.CancelFunc
+	done         chan struct{}
+}
+
+// ParsePeers parses the multiaddrs of peers, which must include the peer ID
+func ParsePeers(multiaddrs []string) ([]peer.AddrInfo, error) {
+	var peers []peer.AddrInfo
+	for _, s := range multiaddrs {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer multiaddr %s: %w", s, err)
+		}
+		info, err := peer.AddrInfoFromP2pAddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer address %s: %w", s, err)
+		}
+		peers = append(peers, *info)
+	}
+	return peers, nil
+}
+
+// NewPeerKeeper creates a keeper of the relay and bootstrap peers of cfg. Invalid addresses
+// are logged and skipped. Returns nil if no peers are configured.
+func NewPeerKeeper(dialer Dialer, cfg config.RelayConfig) *PeerKeeper {
+	k := &PeerKeeper{dialer: dialer, cfg: cfg}
+	for _, s := range append(append([]string{}, cfg.Multiaddrs...), cfg.BootstrapPeers...) {
+		peers, err := ParsePeers([]string{s})
+		if err != nil {
+			zap.L().Warn("Skipping peer", zap.String("address", s), zap.Error(err))
+			continue
+		}
+		k.peers = append(k.peers, peers[0])
+		k.states = append(k.states, PeerState{Peer: peers[0].ID.String(), Address: s})
+	}
+	if len(k.peers) == 0 {
+		return nil
+	}
+	return k
+}
+
+// Check connects to the peers without a live connection whose backoff has passed, at now
+func (k *PeerKeeper) Check(ctx context.Context, now time.Time) {
+	for i, info := range k.peers {
+		if k.dialer.Connected(info.ID) {
+			k.update(i, func(state *PeerState) {
+				state.Connected = true
+				state.Failures = 0
+				state.LastConnected = now
+				state.NextAttempt = time.Time{}
+			})
+			continue
+		}
+
+		k.mu.Lock()
+		state := k.states[i]
+		k.mu.Unlock()
+		if now.Before(state.NextAttempt) {
+			continue
+		}
+
+		if state.Connected {
+			zap.L().Info("Lost connection to peer, reconnecting", zap.String("address", state.Address))
+		}
+		if err := k.dialer.Connect(ctx, info); err != nil {
+			k.update(i, func(state *PeerState) {
+				state.Connected = false
+				state.Failures++
+				state.LastError = err.Error()
+				state.NextAttempt = now.Add(k.backoff(state.Failures))
+			})
+			zap.L().Warn("Failed to connect to peer", zap.String("address", state.Address), zap.Int("attempt", state.Failures+1), zap.Error(err))
+			continue
+		}
+
+		k.update(i, func(state *PeerState) {
+			state.Connected = true
+			state.Failures = 0
+			state.LastConnected = now
+			state.LastError = ""
+			state.NextAttempt = time.Time{}
+		})
+		zap.L().Info("Connected to peer", zap.String("address", state.Address))
+	}
+}
+
+// backoff returns the wait after the given number of consecutive failures
+func (k *PeerKeeper) backoff(failures int) time.Duration {
+	backoff := k.cfg.MinBackoff
+	for i := 1; i < failures && backoff < k.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, k.cfg.MaxBackoff)
+}
+
+// update changes the state of the i-th peer
+func (k *PeerKeeper) update(i int, change func(state *PeerState)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	change(&k.states[i])
+}
+
+// Start connects to the peers, then checks the connections every check interval until Stop
+// is called
+func (k *PeerKeeper) Start(ctx context.Context) {
+	if k == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	k.stopChecking = cancel
+	k.done = make(chan struct{})
+
+	go func() {
+		defer close(k.done)
+		k.Check(ctx, time.Now())
+
+		ticker := time.NewTicker(k.cfg.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				k.Check(ctx, time.Now())
+			}
+		}
+	}()
+}
+
+// Stop stops checking the connections, waiting for a running check to complete
+func (k *PeerKeeper) Stop() {
+	if k == nil || k.stopChecking == nil {
+		return
+	}
+	k.stopChecking()
+	<-k.done
+}
+
+// States returns the connection state of every configured peer
+func (k *PeerKeeper) States() []PeerState {
+	if k == nil {
+		return []PeerState{}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return append([]PeerState{}, k.states...)
+}
@@ -0,0 +1,136 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	relayAddr     = "/ip4/127.0.0.1/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ"
+	bootstrapAddr = "/ip4/127.0.0.1/tcp/4002/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+)
+
+// fakeDialer connects to the peers that are up
+type fakeDialer struct {
+	up        map[peer.ID]bool
+	connected map[peer.ID]bool
+	attempts  int
+}
+
+func (d *fakeDialer) Connect(ctx context.Context, info peer.AddrInfo) error {
+	d.attempts++
+	if !d.up[info.ID] {
+		return errors.New("connection refused")
+	}
+	d.connected[info.ID] = true
+	return nil
+}
+
+func (d *fakeDialer) Connected(id peer.ID) bool {
+	return d.connected[id]
+}
+
+func TestPeerKeeperReconnects(t *testing.T) {
+	cfg := config.Default().Relay
+	cfg.Multiaddrs = []string{relayAddr, "not a multiaddr"}
+	cfg.BootstrapPeers = []string{bootstrapAddr}
+
+	peers, err := ParsePeers([]string{relayAddr, bootstrapAddr})
+	require.NoError(t, err)
+	relay, bootstrap := peers[0].ID, peers[1].ID
+
+	dialer := &fakeDialer{up: map[peer.ID]bool{relay: true}, connected: map[peer.ID]bool{}}
+	keeper := NewPeerKeeper(dialer, cfg)
+	require.NotNil(t, keeper)
+	require.Len(t, keeper.States(), 2, "the invalid address is skipped")
+
+	now := time.Unix(1700000000, 0)
+	keeper.Check(context.Background(), now)
+	states := keeper.States()
+	assert.True(t, states[0].Connected)
+	assert.False(t, states[1].Connected)
+	assert.Equal(t, 1, states[1].Failures)
+	assert.Equal(t, now.Add(cfg.MinBackoff), states[1].NextAttempt)
+
+	// The relay connection is alive and the bootstrap peer waits for its backoff
+	keeper.Check(context.Background(), now.Add(cfg.MinBackoff/2))
+	assert.Equal(t, 2, dialer.attempts)
+
+	// The backoff doubles on each failure
+	keeper.Check(context.Background(), now.Add(cfg.MinBackoff))
+	assert.Equal(t, now.Add(3*cfg.MinBackoff), keeper.States()[1].NextAttempt)
+
+	// A dropped connection is reestablished once the peer is back
+	delete(dialer.connected, relay)
+	dialer.up[bootstrap] = true
+	keeper.Check(context.Background(), now.Add(time.Hour))
+	states = keeper.States()
+	assert.True(t, states[0].Connected)
+	assert.True(t, states[1].Connected)
+	assert.Zero(t, states[1].Failures)
+	assert.Empty(t, states[1].LastError)
+}
+
+func TestPeerKeeperBackoffLimit(t *testing.T) {
+	keeper := &PeerKeeper{cfg: config.RelayConfig{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}}
+	assert.Equal(t, time.Second, keeper.backoff(1))
+	assert.Equal(t, 8*time.Second, keeper.backoff(4))
+	assert.Equal(t, 10*time.Second, keeper.backoff(5))
+	assert.Equal(t, 10*time.Second, keeper.backoff(100))
+}
+
+func TestNewPeerKeeperWithoutPeers(t *testing.T) {
+	assert.Nil(t, NewPeerKeeper(&fakeDialer{}, config.Default().Relay))
+}
+
+// fakeRouting returns the same providers for every key
+type fakeRouting struct {
+	provided  []cid.Cid
+	providers []peer.AddrInfo
+}
+
+func (r *fakeRouting) Provide(ctx context.Context, key cid.Cid, announce bool) error {
+	r.provided = append(r.provided, key)
+	return nil
+}
+
+func (r *fakeRouting) FindProvidersAsync(ctx context.Context, key cid.Cid, count int) <-chan peer.AddrInfo {
+	out := make(chan peer.AddrInfo, len(r.providers))
+	for _, info := range r.providers {
+		out <- info
+	}
+	close(out)
+	return out
+}
+
+func TestDiscoveryConnectsToProviders(t *testing.T) {
+	peers, err := ParsePeers([]string{relayAddr, bootstrapAddr})
+	require.NoError(t, err)
+	self, other := peers[0], peers[1]
+
+	routing := &fakeRouting{providers: []peer.AddrInfo{self, other}}
+	dialer := &fakeDialer{up: map[peer.ID]bool{other.ID: true}, connected: map[peer.ID]bool{}}
+	discovery, err := NewDiscovery(routing, dialer, self.ID, []string{"/orbitdb/zdpuA/events"}, time.Minute)
+	require.NoError(t, err)
+
+	discovery.Discover(context.Background())
+	discovery.Discover(context.Background())
+
+	key, err := ProviderKey("/orbitdb/zdpuA/events")
+	require.NoError(t, err)
+	assert.Equal(t, []cid.Cid{key, key}, routing.provided)
+	assert.Equal(t, 1, dialer.attempts, "this node is skipped and connected providers aren't dialed again")
+
+	stats := discovery.Stats()
+	assert.Equal(t, 2, stats.Rounds)
+	assert.Equal(t, 2, stats.Found)
+	assert.Equal(t, 1, stats.Connected)
+}
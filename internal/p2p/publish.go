@@ -0,0 +1,114 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+	"go.uber.org/zap"
+)
+
+// NamePublisher periodically adds a document to IPFS and publishes it under the node's IPNS
+// name, so other nodes can resolve it from the peer ID alone. Publishing again also keeps the
+// IPNS record from expiring. A nil NamePublisher publishes nothing.
+type NamePublisher struct {
+	api      coreiface.CoreAPI
+	document func() ([]byte, error)
+	interval time.Duration
+
+	mu   sync.Mutex
+	name string // IPNS path, empty before the first publication
+
+	stopPublishing context.CancelFunc
+	done           chan struct{}
+}
+
+// NewNamePublisher creates a publisher of the documents returned by document
+func NewNamePublisher(api coreiface.CoreAPI, document func() ([]byte, error), interval time.Duration) *NamePublisher {
+	return &NamePublisher{api: api, document: document, interval: interval}
+}
+
+// Publish publishes the current document and returns its IPNS path, /ipns/<name>
+func (p *NamePublisher) Publish(ctx context.Context) (string, error) {
+	name, err := p.publish(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.name = name
+	return name, nil
+}
+
+// publish adds the document to IPFS and points the IPNS name to it
+func (p *NamePublisher) publish(ctx context.Context) (string, error) {
+	data, err := p.document()
+	if err != nil {
+		return "", fmt.Errorf("failed to build document: %w", err)
+	}
+	added, err := p.api.Unixfs().Add(ctx, files.NewBytesFile(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to add document: %w", err)
+	}
+	name, err := p.api.Name().Publish(ctx, added)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish %s: %w", added, err)
+	}
+	return name.AsPath().String(), nil
+}
+
+// Start publishes now and then every interval until Stop is called
+func (p *NamePublisher) Start(ctx context.Context) {
+	if p == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	p.stopPublishing = cancel
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			if name, err := p.Publish(ctx); err != nil {
+				zap.L().Warn("IPNS publication failed", zap.Error(err))
+			} else {
+				zap.L().Info("Published database addresses", zap.String("name", name))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops publishing, waiting for a running publication to stop
+func (p *NamePublisher) Stop() {
+	if p == nil || p.stopPublishing == nil {
+		return
+	}
+	p.stopPublishing()
+	<-p.done
+}
+
+// Name returns the IPNS path the document is published under, empty before the first
+// successful publication
+func (p *NamePublisher) Name() string {
+	if p == nil {
+		return ""
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.name
+}
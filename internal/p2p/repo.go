@@ -0,0 +1,114 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	kuboconfig "github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/repo"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"go.uber.org/zap"
+)
+
+// LoadSwarmKey reads a libp2p private network key file, in the go-ipfs swarm.key format:
+//
+//	/key/swarm/psk/1.0.0/
+//	/base16/
+//	<64 hex characters>
+func LoadSwarmKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read swarm key: %w", err)
+	}
+	if _, err := pnet.DecodeV1PSK(bytes.NewReader(key)); err != nil {
+		return nil, fmt.Errorf("invalid swarm key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// nodeRepo is an in-memory IPFS repository, optionally holding a swarm key, which makes the
+// node join the private network of that key only
+type nodeRepo struct {
+	repo.Repo
+	swarmKey []byte
+}
+
+// SwarmKey returns the private network key, nil for the public network
+func (r *nodeRepo) SwarmKey() ([]byte, error) {
+	return r.swarmKey, nil
+}
+
+// NewRepo creates an in-memory IPFS repository, like the one IPFS nodes get without a
+// repository, with the peer identity of priv and the listen addresses, transports, NAT traversal and mDNS of cfg. With a swarm
+// key the node joins that private network: the public bootstrap peers are left out, they
+// can't be reached from it, and QUIC, which private networks don't support, is disabled.
+// QUIC listen addresses are left out while QUIC is disabled.
+func NewRepo(cfg config.P2PConfig, swarmKey []byte, priv crypto.PrivKey) (repo.Repo, error) {
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get peer ID: %w", err)
+	}
+	privBytes, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal node key: %w", err)
+	}
+
+	var nodeCfg kuboconfig.Config
+	nodeCfg.Identity.PeerID = pid.String()
+	nodeCfg.Identity.PrivKey = base64.StdEncoding.EncodeToString(privBytes)
+	nodeCfg.Bootstrap = kuboconfig.DefaultBootstrapAddresses
+	nodeCfg.Addresses.Swarm = cfg.ListenAddrs
+
+	quic := cfg.QUIC
+	if swarmKey != nil {
+		nodeCfg.Bootstrap = []string{}
+		if quic {
+			zap.L().Info("QUIC is disabled, private networks don't support it")
+			quic = false
+		}
+	}
+	if !quic {
+		nodeCfg.Addresses.Swarm = nil
+		for _, addr := range cfg.ListenAddrs {
+			if !strings.Contains(addr, "/quic") {
+				nodeCfg.Addresses.Swarm = append(nodeCfg.Addresses.Swarm, addr)
+			}
+		}
+	}
+
+	nodeCfg.Swarm.Transports.Network.QUIC = flag(quic)
+	nodeCfg.Swarm.Transports.Network.Websocket = flag(cfg.WebSocket)
+	nodeCfg.Swarm.EnableHolePunching = flag(cfg.HolePunching)
+	nodeCfg.Swarm.RelayClient.Enabled = flag(cfg.RelayClient)
+	nodeCfg.Swarm.RelayClient.StaticRelays = cfg.StaticRelays
+	nodeCfg.Swarm.RelayService.Enabled = flag(cfg.RelayService)
+	nodeCfg.Swarm.DisableNatPortMap = !cfg.PortMapping
+	nodeCfg.Discovery.MDNS.Enabled = cfg.MDNS
+	switch cfg.AutoNAT {
+	case config.AutoNATEnabled:
+		nodeCfg.AutoNAT.ServiceMode = kuboconfig.AutoNATServiceEnabled
+	case config.AutoNATDisabled:
+		nodeCfg.AutoNAT.ServiceMode = kuboconfig.AutoNATServiceDisabled
+	}
+
+	return &nodeRepo{
+		Repo:     &repo.Mock{C: nodeCfg, D: syncds.MutexWrap(datastore.NewMapDatastore())},
+		swarmKey: swarmKey,
+	}, nil
+}
+
+// flag converts a setting to a kubo flag
+func flag(enabled bool) kuboconfig.Flag {
+	if enabled {
+		return kuboconfig.True
+	}
+	return kuboconfig.False
+}
@@ -0,0 +1,60 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	kuboconfig "github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSwarmKey(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "swarm.key")
+	require.NoError(t, os.WriteFile(valid, []byte("/key/swarm/psk/1.0.0/\n/base16/\n"+strings.Repeat("ab", 32)+"\n"), 0600))
+
+	key, err := LoadSwarmKey(valid)
+	require.NoError(t, err)
+	assert.Contains(t, string(key), "/key/swarm/psk/1.0.0/")
+
+	invalid := filepath.Join(dir, "invalid.key")
+	require.NoError(t, os.WriteFile(invalid, []byte("not a swarm key\n"), 0600))
+	_, err = LoadSwarmKey(invalid)
+	assert.Error(t, err)
+
+	_, err = LoadSwarmKey(filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+}
+
+func TestNewRepo(t *testing.T) {
+	cfg := config.Default().P2P
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	require.NoError(t, err)
+	pid, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+
+	public, err := NewRepo(cfg, nil, priv)
+	require.NoError(t, err)
+	publicCfg, err := public.Config()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.ListenAddrs, publicCfg.Addresses.Swarm)
+	assert.NotEmpty(t, publicCfg.Bootstrap)
+	assert.Equal(t, pid.String(), publicCfg.Identity.PeerID, "the node keeps the given identity")
+	key, err := public.SwarmKey()
+	require.NoError(t, err)
+	assert.Nil(t, key)
+
+	private, err := NewRepo(cfg, []byte("swarm key"), priv)
+	require.NoError(t, err)
+	privateCfg, err := private.Config()
+	require.NoError(t, err)
+	assert.Empty(t, privateCfg.Bootstrap, "public bootstrap peers are unreachable from a private network")
+	assert.Equal(t, []string{"/ip4/0.0.0.0/tcp/4001", "/ip6/::/tcp/4001"}, privateCfg.Addresses.Swarm)
+	assert.Equal(t, kuboconfig.False, privateCfg.Swarm.Transports.Network.QUIC)
+}
@@ -21,6 +21,8 @@ package storage
 import (
 	"context"
 	"errors"
+	"io"
+	"time"
 
 	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
 	"github.com/nbd-wtf/go-nostr"
@@ -38,15 +40,24 @@ type Store interface {
 	// SaveEvent 保存一个 nostr 事件
 	SaveEvent(ctx context.Context, event *nostr.Event) error
 
-	// GetEvent 通过 ID 获取一个事件
-	// GetEvent(id string) (*nostr.Event, error)
+	// ValidateEvent 检查事件的签名、接收策略以及子空间和投票规则，但不保存事件
+	ValidateEvent(ctx context.Context, event *nostr.Event) error
+
+	// GetEventByID 通过 ID 直接获取一个事件，不存在时返回 nil
+	GetEventByID(ctx context.Context, id string) (*nostr.Event, error)
 
 	// QueryEvents 查询匹配过滤器的事件
 	QueryEvents(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error)
 
+	// CountEvents 统计匹配过滤器的事件数量
+	CountEvents(ctx context.Context, filter nostr.Filter) (int, error)
+
 	// DeleteEvent 删除一个事件
 	DeleteEvent(ctx context.Context, event *nostr.Event) error
 
+	// SimulateEvent 在不持久化的情况下计算事件会产生的因果关系和统计变化
+	SimulateEvent(ctx context.Context, event *nostr.Event) (*orbitdb.SimulationResult, error)
+
 	// Close 关闭存储连接
 	// Close() error
 
@@ -56,28 +67,224 @@ type Store interface {
 	// 新增方法：查询子空间
 	QuerySubspaces(ctx context.Context, filter func(*orbitdb.SubspaceCausality) bool) ([]*orbitdb.SubspaceCausality, error)
 
+	// GetSubspaceMeta 获取子空间的名称、描述、规则等元数据，不存在时返回 nil
+	GetSubspaceMeta(ctx context.Context, subspaceID string) (*orbitdb.SubspaceMeta, error)
+
+	// FindSubspacesByName 按名称（不区分大小写）查找子空间元数据
+	FindSubspacesByName(ctx context.Context, name string) ([]*orbitdb.SubspaceMeta, error)
+
+	// TopSubspaces 按最近 window 时间内的活跃度（events、users 或 votes）对子空间排序，最多返回 limit 个
+	TopSubspaces(ctx context.Context, window time.Duration, metric string, limit int) ([]*orbitdb.SubspaceRanking, error)
+
+	// GetActivityHistogram 获取用户或子空间在 [from, to] 内按小时或按天统计的事件数
+	GetActivityHistogram(ctx context.Context, scope, owner, granularity string, from, to time.Time) ([]*orbitdb.ActivityPoint, error)
+
 	// UpdateFromEvent 从事件更新因果关系
 	UpdateFromEvent(ctx context.Context, event *nostr.Event) error
 
 	//GetCausalityEvents 获取与特定子空间相关的所有事件
 	GetCausalityEvents(ctx context.Context, subspaceID string) ([]string, error)
 
+	// GetCausalityEventsPage 分页获取子空间的事件ID，按记录顺序排列，返回下一页游标，最后一页为空
+	GetCausalityEventsPage(ctx context.Context, subspaceID, cursor string, limit int) ([]string, string, error)
+
+	// GetCausalityGraph 获取子空间的事件依赖图，包括父事件引用和Lamport计数器，子空间不存在时返回nil
+	GetCausalityGraph(ctx context.Context, subspaceID string) (*orbitdb.CausalityGraph, error)
+
 	// GetCausalityKey 获取特定子空间的特定因果关系键
 	GetCausalityKey(ctx context.Context, subspaceID string, keyID uint32) (uint64, error)
 
 	// GetAllCausalityKeys 获取特定子空间的所有因果关系键
 	GetAllCausalityKeys(ctx context.Context, subspaceID string) (map[uint32]uint64, error)
 
+	// ListCausalityKeys 获取特定子空间的所有因果关系键及其标签、计数器和最后更新信息
+	ListCausalityKeys(ctx context.Context, subspaceID string) ([]*orbitdb.CausalityKey, error)
+
+	// GetEventXrefs 获取事件的跨子空间引用（引用的事件与被引用的事件）
+	GetEventXrefs(ctx context.Context, eventID string) (*orbitdb.EventXrefs, error)
+
+	// GetEventThread 沿 e/parent 标签引用找到事件所在的讨论串根事件，并返回带层级与排序的回复树；事件不存在时返回 nil
+	GetEventThread(ctx context.Context, eventID string, depth int) (*orbitdb.EventThread, error)
+
+	// GetEventAnnotations 获取事件的服务端注解（审核标签、认证徽章、处理错误）
+	GetEventAnnotations(ctx context.Context, eventID string) ([]*orbitdb.EventAnnotation, error)
+
+	// AddEventAnnotation 为事件添加注解，注解单独存储，不修改已签名的事件
+	AddEventAnnotation(ctx context.Context, eventID string, annotation *orbitdb.EventAnnotation) error
+
+	// DeleteEventAnnotation 删除事件的注解，不存在时返回 false
+	DeleteEventAnnotation(ctx context.Context, eventID, annotationID string) (bool, error)
+
 	// 新增用户统计相关方法
 
+	// GetSubspaceStats 获取子空间的汇总统计（按类型的事件数、活跃用户数、投票、邀请、首次与最近活动），没有事件时返回 nil
+	GetSubspaceStats(ctx context.Context, subspaceID string) (*orbitdb.SubspaceStats, error)
+
 	// GetUserStats 获取用户统计数据
 	GetUserStats(ctx context.Context, userID string) (*orbitdb.UserStats, error)
 
-	// QueryUsersBySubspace 查询特定子空间的所有用户
-	QueryUsersBySubspace(ctx context.Context, subspaceID string) ([]*orbitdb.UserStats, error)
+	// GetUserStatsBatch 按用户 ID 批量获取用户统计数据，没有统计数据的用户不在结果中
+	GetUserStatsBatch(ctx context.Context, userIDs []string) (map[string]*orbitdb.UserStats, error)
+
+	// GetUserProfile 获取用户在最新 kind 0 事件中发布的资料（名称、头像、NIP-05），不存在时返回 nil
+	GetUserProfile(ctx context.Context, pubKey string) (*orbitdb.UserProfile, error)
+
+	// GetUserProfiles 按公钥批量获取用户资料，没有资料的用户不在结果中
+	GetUserProfiles(ctx context.Context, pubKeys []string) (map[string]*orbitdb.UserProfile, error)
+
+	// ListFollows 根据 kind 3 联系人列表获取用户关注的用户、关注该用户的用户或互相关注的用户，按公钥排序
+	ListFollows(ctx context.Context, pubKey, relation string) ([]string, error)
+
+	// QueryExclusion 根据上下文请求的审核（版主的 NIP-51 屏蔽列表、子空间封禁与隐藏）返回查询应排除的事件，不排除时返回 nil
+	QueryExclusion(ctx context.Context) (*orbitdb.EventExclusion, error)
+
+	// GetSubspaceModeration 获取子空间被封禁的用户和被隐藏的事件，没有审核记录时返回 nil
+	GetSubspaceModeration(ctx context.Context, subspaceID string) (*orbitdb.SubspaceModeration, error)
+
+	// BanFromSubspace 封禁子空间内的用户，其事件将被拒绝写入并在查询中排除
+	BanFromSubspace(ctx context.Context, subspaceID, pubKey string, entry orbitdb.ModerationEntry) error
+
+	// UnbanFromSubspace 解除子空间内用户的封禁，用户未被封禁时返回 false
+	UnbanFromSubspace(ctx context.Context, subspaceID, pubKey string) (bool, error)
+
+	// HideSubspaceEvent 在查询中隐藏子空间的事件
+	HideSubspaceEvent(ctx context.Context, subspaceID, eventID string, entry orbitdb.ModerationEntry) error
+
+	// UnhideSubspaceEvent 取消隐藏子空间的事件，事件未被隐藏时返回 false
+	UnhideSubspaceEvent(ctx context.Context, subspaceID, eventID string) (bool, error)
+
+	// QueryUsersBySubspace 按用户 ID 顺序分页查询特定子空间的用户，返回下一页的游标，没有更多用户时为空
+	QueryUsersBySubspace(ctx context.Context, subspaceID string, query orbitdb.SubspaceUserQuery) ([]*orbitdb.UserStats, string, error)
+
+	// GetUserPeriodStats 获取用户在覆盖 [from, to] 的各天（UTC）内的统计数据之和，期间没有活动时返回 nil
+	GetUserPeriodStats(ctx context.Context, userID string, from, to time.Time) (*orbitdb.UserStats, error)
+
+	// QueryPeriodStats 获取在覆盖 [from, to] 的各天（UTC）内有活动的用户的统计数据之和，用于按时间窗口排名
+	QueryPeriodStats(ctx context.Context, from, to time.Time) ([]*orbitdb.UserStats, error)
 
 	// QueryUserStats 根据条件查询用户统计
 	QueryUserStats(ctx context.Context, filter func(*orbitdb.UserStats) bool) ([]*orbitdb.UserStats, error)
+
+	// GetSubspaceInviteGraph 获取子空间内的邀请关系（谁邀请了谁）
+	GetSubspaceInviteGraph(ctx context.Context, subspaceID string) (*orbitdb.InviteGraph, error)
+
+	// PurgeUser 删除用户的数据：其事件替换为墓碑，删除用户统计和活跃度直方图，并从邀请列表、排行榜和子空间统计中移除该用户
+	PurgeUser(ctx context.Context, pubKey string) (*orbitdb.UserPurgeReport, error)
+
+	// GetInviteTree 获取用户的邀请树，depth 为向下展开的层数
+	GetInviteTree(ctx context.Context, userID string, depth int) (*orbitdb.InviteTreeNode, error)
+
+	// GetLeaderboard 获取全局排行榜（subspaceID 为空时）或子空间排行榜，尚未生成时返回 nil
+	GetLeaderboard(ctx context.Context, subspaceID string) (*orbitdb.Leaderboard, error)
+
+	// API 使用量统计相关方法
+
+	// GetUsage 获取某个 API key 在某一天的使用量
+	GetUsage(ctx context.Context, day, keyID string) (*orbitdb.APIUsage, error)
+
+	// AddUsage 将使用量增量累加到对应日期和 API key 的记录中
+	AddUsage(ctx context.Context, delta *orbitdb.APIUsage) error
+
+	// QueryUsage 查询日期范围内的使用量记录
+	QueryUsage(ctx context.Context, from, to, keyID string) ([]*orbitdb.APIUsage, error)
+
+	// 子空间 webhook 相关方法
+
+	// ListSubspaceWebhooks 获取子空间注册的 webhook
+	ListSubspaceWebhooks(ctx context.Context, subspaceID string) ([]*orbitdb.SubspaceWebhook, error)
+
+	// AddSubspaceWebhook 为子空间注册 webhook，并分配 ID
+	AddSubspaceWebhook(ctx context.Context, subspaceID string, webhook *orbitdb.SubspaceWebhook) error
+
+	// DeleteSubspaceWebhook 删除子空间的 webhook，不存在时返回 false
+	DeleteSubspaceWebhook(ctx context.Context, subspaceID, webhookID string) (bool, error)
+
+	// ListWebhookSubscriptions 获取所有按过滤器订阅事件的 webhook
+	ListWebhookSubscriptions(ctx context.Context) ([]*orbitdb.WebhookSubscription, error)
+
+	// AddWebhookSubscription 注册按过滤器订阅事件的 webhook，并分配 ID
+	AddWebhookSubscription(ctx context.Context, subscription *orbitdb.WebhookSubscription) error
+
+	// DeleteWebhookSubscription 删除 webhook 订阅，不存在时返回 false
+	DeleteWebhookSubscription(ctx context.Context, subscriptionID string) (bool, error)
+
+	// ListQuarantinedEvents 获取所有因因果过期而被隔离的事件，按隔离时间排序
+	ListQuarantinedEvents(ctx context.Context) ([]*orbitdb.QuarantinedEvent, error)
+
+	// DeleteQuarantinedEvent 丢弃被隔离的事件，不存在时返回 false
+	DeleteQuarantinedEvent(ctx context.Context, eventID string) (bool, error)
+
+	// GetProposal 获取提案及其投票统计，不存在时返回 nil
+	GetProposal(ctx context.Context, proposalID string) (*orbitdb.Proposal, error)
+
+	// ListSubspaceProposals 获取子空间的提案，按创建时间倒序，status 非空时只返回该状态的提案
+	ListSubspaceProposals(ctx context.Context, subspaceID, status string) ([]*orbitdb.Proposal, error)
+
+	// CloseDueProposals 关闭截止时间已过的开放提案并返回它们，每个提案只由关闭它的调用返回一次
+	CloseDueProposals(ctx context.Context) ([]*orbitdb.Proposal, error)
+
+	// GetLiveConfig 获取由可信签名者签名的实时配置，未发布时返回 nil
+	GetLiveConfig(ctx context.Context, signers []string) (*orbitdb.LiveConfig, error)
+
+	// PublishLiveConfig 验证并保存签名的实时配置事件，复制到所有节点
+	PublishLiveConfig(ctx context.Context, event *nostr.Event, signers []string) (*orbitdb.LiveConfig, error)
+
+	// GetMigrationStatus 获取数据库迁移状态，未迁移时返回 orbitdb.ErrNoMigration
+	GetMigrationStatus(ctx context.Context) (*orbitdb.MigrationStatus, error)
+
+	// StartMigrationBackfill 开始将旧数据库的历史数据回填到新数据库
+	StartMigrationBackfill(ctx context.Context) error
+
+	// FlipMigration 将读取切换到新数据库
+	FlipMigration(ctx context.Context) error
+
+	// ForecastStorage 分析各文档类型和子空间的增长并预测存储用量
+	ForecastStorage(ctx context.Context, opts orbitdb.StorageForecastOptions) (*orbitdb.StorageForecast, error)
+
+	// BackfillFromRelays 作为客户端连接外部 Nostr 中继，拉取匹配过滤器的历史事件，验证后批量保存
+	BackfillFromRelays(ctx context.Context, relays []string, filters nostr.Filters) (*orbitdb.BackfillReport, error)
+
+	// Backup 将全部文档（包括因果关系和用户统计）导出为 JSONL 归档
+	Backup(ctx context.Context, w io.Writer) (int, error)
+
+	// Restore 从 JSONL 归档恢复文档
+	Restore(ctx context.Context, r io.Reader) (int, error)
+
+	// RebuildDerivedData 按时间顺序重放所有事件，从头重新生成用户统计、因果关系和排行榜文档
+	RebuildDerivedData(ctx context.Context) (*orbitdb.RebuildResult, error)
+
+	// ReplicationBacklog 返回等待从其他节点复制的条目数量
+	ReplicationBacklog() int
+
+	// Databases 返回底层数据库地址，供其他节点打开相同的数据库
+	Databases() orbitdb.DatabaseInfo
+
+	// StoreStatus 返回底层存储的地址、oplog 长度以及按 doc_type 统计的文档数量
+	StoreStatus(ctx context.Context) (*orbitdb.StoreStatus, error)
+
+	// ReplicationStatus 返回各底层存储的复制进度、oplog 头数量、最近复制时间以及与各节点的头交换统计
+	ReplicationStatus() *orbitdb.ReplicationStatus
+
+	// FlushDerivedData 等待所有已保存事件的派生数据（因果关系、用户统计等）后台更新完成
+	FlushDerivedData(ctx context.Context) error
+
+	// DerivedDataStats 返回派生数据更新队列的状态
+	DerivedDataStats() orbitdb.DerivedDataStats
+
+	// SweepRetention 将已过期（NIP-40 expiration 标签）或超出保留策略的事件替换为墓碑，并压缩派生数据
+	SweepRetention(ctx context.Context, policy orbitdb.RetentionPolicy, now time.Time) (*orbitdb.RetentionResult, error)
+
+	// Compact 为底层各 OrbitDB 存储保存快照，使启动时无需重放完整的 oplog
+	Compact(ctx context.Context) (*orbitdb.SnapshotResult, error)
+
+	// SnapshotIfGrown 为自上次快照以来 oplog 增长至少 entries 条的存储保存快照
+	SnapshotIfGrown(ctx context.Context, entries int) (*orbitdb.SnapshotResult, error)
+
+	// EventPolicies 返回保存事件前依次检查的接受策略
+	EventPolicies() []orbitdb.EventPolicyInfo
+
+	// WarmUp 将全局排行榜以及给定子空间的因果关系和排行榜预加载到内存
+	WarmUp(ctx context.Context, subspaceIDs []string) (*orbitdb.WarmupResult, error)
 }
 
 // StoreFactory 用于创建存储实例的工厂接口
@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+)
+
+// DeliveryResult describes the outcome of one delivery attempt
+type DeliveryResult struct {
+	URL        string `json:"url"`                   // Endpoint URL
+	DeliveryID string `json:"delivery_id"`           // Delivery ID
+	StatusCode int    `json:"status_code,omitempty"` // HTTP status returned by the endpoint
+	Error      string `json:"error,omitempty"`       // Delivery error, empty on success
+}
+
+// Dispatcher delivers payloads to the configured webhook endpoints
+type Dispatcher struct {
+	endpoints    []config.WebhookEndpoint
+	client       *http.Client
+	retries      int
+	retryBackoff time.Duration
+	wg           sync.WaitGroup
+}
+
+// NewDispatcher creates a new Dispatcher
+func NewDispatcher(cfg config.WebhooksConfig) *Dispatcher {
+	return &Dispatcher{
+		endpoints:    cfg.Endpoints,
+		client:       &http.Client{Timeout: cfg.Timeout},
+		retries:      cfg.Retries,
+		retryBackoff: cfg.RetryBackoff,
+	}
+}
+
+// Publish delivers a payload asynchronously to every configured endpoint subscribed to its type
+func (d *Dispatcher) Publish(payloadType string, data interface{}) {
+	d.PublishTo(d.endpoints, payloadType, data)
+}
+
+// PublishTo delivers a payload asynchronously to the given endpoints subscribed to its type
+func (d *Dispatcher) PublishTo(endpoints []config.WebhookEndpoint, payloadType string, data interface{}) {
+	if len(endpoints) == 0 {
+		return
+	}
+
+	payload, err := NewPayload(payloadType, data)
+	if err != nil {
+		zap.L().Warn("Failed to build webhook payload", zap.String("type", payloadType), zap.Error(err))
+		return
+	}
+
+	for _, endpoint := range endpoints {
+		if !subscribed(endpoint, payloadType) {
+			continue
+		}
+
+		d.wg.Add(1)
+		go func(endpoint config.WebhookEndpoint) {
+			defer d.wg.Done()
+			result := d.deliverWithRetries(endpoint, payload)
+			if result.Error != "" {
+				zap.L().Warn("Webhook delivery failed", zap.String("delivery", result.DeliveryID), zap.String("url", result.URL),
+					zap.String("error", result.Error))
+			}
+		}(endpoint)
+	}
+}
+
+// SendTest synchronously delivers a sample payload of a type. If url is empty it is
+// sent to every configured endpoint, otherwise only to the endpoint with that URL.
+func (d *Dispatcher) SendTest(ctx context.Context, payloadType, url string) ([]*DeliveryResult, error) {
+	data, err := SampleData(payloadType)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := NewPayload(payloadType, data)
+	if err != nil {
+		return nil, err
+	}
+	payload.Test = true
+
+	results := []*DeliveryResult{}
+	for _, endpoint := range d.endpoints {
+		if url != "" && endpoint.URL != url {
+			continue
+		}
+		results = append(results, d.Deliver(ctx, endpoint, payload))
+	}
+
+	if url != "" && len(results) == 0 {
+		return nil, fmt.Errorf("webhook endpoint not configured: %s", url)
+	}
+
+	return results, nil
+}
+
+// Deliver signs and sends a payload to an endpoint
+func (d *Dispatcher) Deliver(ctx context.Context, endpoint config.WebhookEndpoint, payload *Payload) *DeliveryResult {
+	result := &DeliveryResult{
+		URL:        endpoint.URL,
+		DeliveryID: payload.ID,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// Sign at send time so the timestamp reflects the actual delivery
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, payload.Type)
+	req.Header.Set(HeaderDelivery, payload.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Error = fmt.Sprintf("unexpected status: %s", resp.Status)
+	}
+
+	return result
+}
+
+// deliverWithRetries delivers a payload, retrying failures the endpoint may recover from
+// with backoff. Retries keep the delivery ID, so receivers can drop duplicates.
+func (d *Dispatcher) deliverWithRetries(endpoint config.WebhookEndpoint, payload *Payload) *DeliveryResult {
+	backoff := d.retryBackoff
+	result := d.Deliver(context.Background(), endpoint, payload)
+	for attempt := 0; attempt < d.retries && retryable(result); attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		result = d.Deliver(context.Background(), endpoint, payload)
+	}
+	return result
+}
+
+// Wait waits for asynchronous deliveries to finish or ctx to be done
+func (d *Dispatcher) Wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// Helper function: check whether a failed delivery may succeed when retried, i.e. it failed
+// to connect, was throttled or hit a server error
+func retryable(result *DeliveryResult) bool {
+	if result.Error == "" {
+		return false
+	}
+	return result.StatusCode == 0 || result.StatusCode == http.StatusTooManyRequests || result.StatusCode >= 500
+}
+
+// Helper function: check whether an endpoint receives a payload type
+func subscribed(endpoint config.WebhookEndpoint, payloadType string) bool {
+	if len(endpoint.Events) == 0 {
+		return true
+	}
+	for _, t := range endpoint.Events {
+		if t == payloadType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+// Package webhook delivers signed notifications about stored data to external HTTP endpoints.
+//
+// Every delivery is a JSON envelope described by a versioned JSON Schema (see the
+// schemas directory), sent as a POST with these headers:
+//
+//	X-CRelay-Event:     payload type, e.g. "event.saved"
+//	X-CRelay-Delivery:  unique delivery ID, also the envelope "id"
+//	X-CRelay-Timestamp: unix seconds at signing time
+//	X-CRelay-Signature: "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+//
+// Receivers recompute the signature over the raw body and reject deliveries whose
+// timestamp is outside their tolerance window to prevent replays.
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// SchemaVersion is the version of the payload schemas
+const SchemaVersion = "1"
+
+// Payload types
+const (
+	TypeEventSaved      = "event.saved"
+	TypeSubspaceCreated = "subspace.created"
+	TypeProposalClosed  = "proposal.closed"
+
+	// Delivered only to webhooks registered for a subspace
+	TypeProposalCreated      = "proposal.created"
+	TypeVoteThresholdCrossed = "vote.threshold_crossed"
+	TypeMemberJoined         = "member.joined"
+
+	// Delivered only to webhook subscriptions whose filter the event matches
+	TypeEventMatched = "event.matched"
+)
+
+// Types lists all payload types
+var Types = []string{TypeEventSaved, TypeSubspaceCreated, TypeProposalClosed,
+	TypeProposalCreated, TypeVoteThresholdCrossed, TypeMemberJoined, TypeEventMatched}
+
+// SubspaceTypes lists the payload types subspace webhooks can subscribe to
+var SubspaceTypes = []string{TypeProposalCreated, TypeVoteThresholdCrossed, TypeMemberJoined}
+
+// Payload is the envelope of every webhook delivery
+type Payload struct {
+	ID        string          `json:"id"`             // Unique delivery ID
+	Type      string          `json:"type"`           // Payload type, e.g. "event.saved"
+	Version   string          `json:"version"`        // Schema version
+	Timestamp int64           `json:"timestamp"`      // Creation time, unix seconds
+	Test      bool            `json:"test,omitempty"` // Set on deliveries from the test endpoint
+	Data      json.RawMessage `json:"data"`           // Type-specific data
+}
+
+// EventSavedData is the data of an event.saved payload
+type EventSavedData struct {
+	Event *nostr.Event `json:"event"` // The saved event
+}
+
+// Sources of matched events
+const (
+	SourceSaved      = "saved"      // Saved through this node
+	SourceReplicated = "replicated" // Replicated from a peer
+)
+
+// EventMatchedData is the data of an event.matched payload
+type EventMatchedData struct {
+	SubscriptionID string       `json:"subscription_id"` // ID of the subscription whose filter matched
+	Source         string       `json:"source"`          // How the event reached this node: saved|replicated
+	Event          *nostr.Event `json:"event"`           // The matching event
+}
+
+// SubspaceCreatedData is the data of a subspace.created payload
+type SubspaceCreatedData struct {
+	SubspaceID string            `json:"subspace_id"` // Subspace ID
+	Name       string            `json:"name"`        // Subspace name, may be empty
+	Creator    string            `json:"creator"`     // Public key of the creator
+	Ops        map[string]uint32 `json:"ops"`         // Operation name to causality key
+	EventID    string            `json:"event_id"`    // ID of the creation event
+	CreatedAt  int64             `json:"created_at"`  // Creation event timestamp
+}
+
+// ProposalClosedData is the data of a proposal.closed payload
+type ProposalClosedData struct {
+	SubspaceID string `json:"subspace_id"` // Subspace ID
+	ProposalID string `json:"proposal_id"` // ID of the proposal event
+	Result     string `json:"result"`      // Outcome: passed|rejected|expired
+	YesVotes   uint64 `json:"yes_votes"`   // Number of yes votes
+	NoVotes    uint64 `json:"no_votes"`    // Number of no votes
+	ClosedAt   int64  `json:"closed_at"`   // Closing time, unix seconds
+}
+
+// ProposalCreatedData is the data of a proposal.created payload
+type ProposalCreatedData struct {
+	SubspaceID string `json:"subspace_id"` // Subspace ID
+	ProposalID string `json:"proposal_id"` // ID of the proposal event
+	Proposer   string `json:"proposer"`    // Public key of the proposer
+	Content    string `json:"content"`     // Proposal content
+	CreatedAt  int64  `json:"created_at"`  // Proposal event timestamp
+}
+
+// VoteThresholdCrossedData is the data of a vote.threshold_crossed payload
+type VoteThresholdCrossedData struct {
+	SubspaceID string `json:"subspace_id"` // Subspace ID
+	ProposalID string `json:"proposal_id"` // ID of the proposal event
+	Threshold  uint64 `json:"threshold"`   // Threshold of the webhook that was reached
+	TotalVotes uint64 `json:"total_votes"` // Number of votes on the proposal
+	YesVotes   uint64 `json:"yes_votes"`   // Number of yes votes
+	NoVotes    uint64 `json:"no_votes"`    // Number of no votes
+	EventID    string `json:"event_id"`    // ID of the vote that reached the threshold
+}
+
+// MemberJoinedData is the data of a member.joined payload
+type MemberJoinedData struct {
+	SubspaceID string `json:"subspace_id"` // Subspace ID
+	Member     string `json:"member"`      // Public key of the new member
+	EventID    string `json:"event_id"`    // ID of the join event
+	JoinedAt   int64  `json:"joined_at"`   // Join event timestamp
+}
+
+// NewPayload creates a payload envelope of the given type
+func NewPayload(payloadType string, data interface{}) (*Payload, error) {
+	if !isKnownType(payloadType) {
+		return nil, fmt.Errorf("unknown payload type: %s", payloadType)
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &Payload{
+		ID:        hex.EncodeToString(id),
+		Type:      payloadType,
+		Version:   SchemaVersion,
+		Timestamp: time.Now().Unix(),
+		Data:      raw,
+	}, nil
+}
+
+// SampleData returns example data of a payload type, used for test deliveries
+func SampleData(payloadType string) (interface{}, error) {
+	now := time.Now().Unix()
+	subspaceID := "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+	switch payloadType {
+	case TypeEventSaved:
+		return &EventSavedData{Event: &nostr.Event{
+			ID:        "test-event",
+			PubKey:    "test-pubkey",
+			CreatedAt: nostr.Timestamp(now),
+			Kind:      30300,
+			Tags:      nostr.Tags{{"sid", subspaceID}, {"op", "post"}},
+			Content:   "test delivery",
+		}}, nil
+	case TypeSubspaceCreated:
+		return &SubspaceCreatedData{
+			SubspaceID: subspaceID,
+			Name:       "test-subspace",
+			Creator:    "test-pubkey",
+			Ops:        map[string]uint32{"post": 30300, "vote": 30302},
+			EventID:    "test-event",
+			CreatedAt:  now,
+		}, nil
+	case TypeProposalClosed:
+		return &ProposalClosedData{
+			SubspaceID: subspaceID,
+			ProposalID: "test-proposal",
+			Result:     "passed",
+			YesVotes:   3,
+			NoVotes:    1,
+			ClosedAt:   now,
+		}, nil
+	case TypeProposalCreated:
+		return &ProposalCreatedData{
+			SubspaceID: subspaceID,
+			ProposalID: "test-proposal",
+			Proposer:   "test-pubkey",
+			Content:    "test proposal",
+			CreatedAt:  now,
+		}, nil
+	case TypeVoteThresholdCrossed:
+		return &VoteThresholdCrossedData{
+			SubspaceID: subspaceID,
+			ProposalID: "test-proposal",
+			Threshold:  3,
+			TotalVotes: 3,
+			YesVotes:   2,
+			NoVotes:    1,
+			EventID:    "test-event",
+		}, nil
+	case TypeMemberJoined:
+		return &MemberJoinedData{
+			SubspaceID: subspaceID,
+			Member:     "test-pubkey",
+			EventID:    "test-event",
+			JoinedAt:   now,
+		}, nil
+	case TypeEventMatched:
+		return &EventMatchedData{
+			SubscriptionID: "test-subscription",
+			Source:         SourceSaved,
+			Event: &nostr.Event{
+				ID:        "test-event",
+				PubKey:    "test-pubkey",
+				CreatedAt: nostr.Timestamp(now),
+				Kind:      30300,
+				Tags:      nostr.Tags{{"sid", subspaceID}, {"op", "post"}},
+				Content:   "test delivery",
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown payload type: %s", payloadType)
+	}
+}
+
+// Helper function: check whether a payload type is known
+func isKnownType(payloadType string) bool {
+	for _, t := range Types {
+		if t == payloadType {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSubspaceType reports whether subspace webhooks can subscribe to a payload type
+func IsSubspaceType(payloadType string) bool {
+	for _, t := range SubspaceTypes {
+		if t == payloadType {
+			return true
+		}
+	}
+	return false
+}
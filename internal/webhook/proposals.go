@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+)
+
+// ProposalCloseInterval is the time between checks for proposals whose deadline passed
+const ProposalCloseInterval = time.Minute
+
+// NotifyClosedProposals closes the proposals whose deadline passed every interval and
+// publishes proposal.closed for each, until ctx is done
+func NotifyClosedProposals(ctx context.Context, store storage.Store, dispatcher *Dispatcher, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				publishClosedProposals(ctx, store, dispatcher)
+			}
+		}
+	}()
+}
+
+// publishClosedProposals closes the due proposals and publishes proposal.closed for each
+func publishClosedProposals(ctx context.Context, store storage.Store, dispatcher *Dispatcher) {
+	closed, err := store.CloseDueProposals(ctx)
+	if err != nil {
+		zap.L().Warn("Failed to close due proposals", zap.Error(err))
+	}
+	for _, proposal := range closed {
+		dispatcher.Publish(TypeProposalClosed, &ProposalClosedData{
+			SubspaceID: proposal.SubspaceID,
+			ProposalID: proposal.ProposalID,
+			Result:     proposal.Status,
+			YesVotes:   proposal.YesVotes,
+			NoVotes:    proposal.NoVotes,
+			ClosedAt:   proposal.ClosedAt,
+		})
+	}
+}
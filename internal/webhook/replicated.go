@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"berty.tech/go-orbit-db/stores"
+	"github.com/libp2p/go-libp2p/core/event"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// NotifyReplicated delivers the events replicated into the database of bus from peers to
+// the webhook subscriptions whose filter they match, until ctx is done. Events saved through
+// this node are delivered by the store returned by NewNotifyingStore.
+func NotifyReplicated(ctx context.Context, bus event.Bus, store storage.Store, dispatcher *Dispatcher) error {
+	sub, err := bus.Subscribe(new(stores.EventReplicated))
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to replicated entries: %w", err)
+	}
+
+	go func() {
+		defer sub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+				for _, replicated := range orbitdb.ReplicatedEvents(evt) {
+					publishMatching(ctx, store, dispatcher, replicated, SourceReplicated)
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,17 @@
+package webhook
+
+import (
+	"embed"
+	"fmt"
+)
+
+//go:embed schemas
+var schemaFS embed.FS
+
+// Schema returns the JSON Schema of a payload type for the current schema version
+func Schema(payloadType string) ([]byte, error) {
+	if !isKnownType(payloadType) {
+		return nil, fmt.Errorf("unknown payload type: %s", payloadType)
+	}
+	return schemaFS.ReadFile(fmt.Sprintf("schemas/v%s/%s.json", SchemaVersion, payloadType))
+}
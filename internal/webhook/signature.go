@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delivery headers
+const (
+	HeaderEvent     = "X-CRelay-Event"
+	HeaderDelivery  = "X-CRelay-Delivery"
+	HeaderTimestamp = "X-CRelay-Timestamp"
+	HeaderSignature = "X-CRelay-Signature"
+)
+
+// signaturePrefix identifies the signature algorithm in the signature header
+const signaturePrefix = "sha256="
+
+// DefaultTolerance is the recommended maximum age of a delivery accepted by receivers
+const DefaultTolerance = 5 * time.Minute
+
+// Sign computes the signature header value of a body signed at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a delivery. Deliveries signed
+// more than tolerance before or after now are rejected as possible replays.
+func Verify(secret, signature, timestamp string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %s", timestamp)
+	}
+
+	age := now.Sub(time.Unix(ts, 0))
+	if age > tolerance || age < -tolerance {
+		return fmt.Errorf("timestamp outside tolerance: %s", age)
+	}
+
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return fmt.Errorf("unsupported signature format")
+	}
+
+	expected := Sign(secret, ts, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/internal/storage"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// notifyingStore is a Store that publishes webhooks for successfully saved events
+type notifyingStore struct {
+	storage.Store
+	dispatcher *Dispatcher
+}
+
+// NewNotifyingStore wraps a store so that saved events are published to the dispatcher
+func NewNotifyingStore(store storage.Store, dispatcher *Dispatcher) storage.Store {
+	return &notifyingStore{
+		Store:      store,
+		dispatcher: dispatcher,
+	}
+}
+
+// SaveEvent saves the event and publishes event.saved, plus subspace.created for kind 30100
+// and event.matched to the subscriptions whose filter it matches
+func (s *notifyingStore) SaveEvent(ctx context.Context, event *nostr.Event) error {
+	if err := s.Store.SaveEvent(ctx, event); err != nil {
+		return err
+	}
+
+	s.dispatcher.Publish(TypeEventSaved, &EventSavedData{Event: event})
+	publishMatching(ctx, s.Store, s.dispatcher, event, SourceSaved)
+
+	if event.Kind == 30100 {
+		s.publishSubspaceCreated(ctx, event)
+	}
+	s.publishSubspaceEvents(ctx, event)
+
+	return nil
+}
+
+// publishSubspaceCreated publishes subspace.created using the causality derived from the event
+func (s *notifyingStore) publishSubspaceCreated(ctx context.Context, event *nostr.Event) {
+	data := &SubspaceCreatedData{
+		Creator:   event.PubKey,
+		Ops:       make(map[string]uint32),
+		EventID:   event.ID,
+		CreatedAt: int64(event.CreatedAt),
+	}
+
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "sid":
+			data.SubspaceID = tag[1]
+		case "subspace_name":
+			data.Name = tag[1]
+		}
+	}
+
+	if data.SubspaceID == "" {
+		return
+	}
+
+	causality, err := s.Store.GetSubspaceCausality(ctx, data.SubspaceID)
+	if err != nil {
+		zap.L().Warn("Failed to load causality for subspace.created webhook", zap.String("subspace", data.SubspaceID), zap.Error(err))
+	} else if causality != nil {
+		for keyID, meta := range causality.KeyMeta {
+			if meta != nil && meta.Label != "" {
+				data.Ops[meta.Label] = keyID
+			}
+		}
+	}
+
+	s.dispatcher.Publish(TypeSubspaceCreated, data)
+}
+
+// publishSubspaceEvents notifies the webhooks registered for the event's subspace of new
+// members, new proposals and votes reaching their thresholds
+func (s *notifyingStore) publishSubspaceEvents(ctx context.Context, event *nostr.Event) {
+	subspaceID := tagValue(event, "sid")
+	if subspaceID == "" {
+		return
+	}
+
+	proposalID := tagValue(event, "proposal_id")
+	isJoin := event.Kind == 30200
+	isProposal := tagValue(event, "op") == "propose"
+	isVote := event.Kind == 30302 && proposalID != ""
+	if !isJoin && !isProposal && !isVote {
+		return
+	}
+
+	webhooks, err := s.Store.ListSubspaceWebhooks(ctx, subspaceID)
+	if err != nil {
+		zap.L().Warn("Failed to load subspace webhooks", zap.String("subspace", subspaceID), zap.Error(err))
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	switch {
+	case isJoin:
+		s.dispatcher.PublishTo(subspaceEndpoints(webhooks), TypeMemberJoined, &MemberJoinedData{
+			SubspaceID: subspaceID,
+			Member:     event.PubKey,
+			EventID:    event.ID,
+			JoinedAt:   int64(event.CreatedAt),
+		})
+	case isProposal:
+		s.dispatcher.PublishTo(subspaceEndpoints(webhooks), TypeProposalCreated, &ProposalCreatedData{
+			SubspaceID: subspaceID,
+			ProposalID: event.ID,
+			Proposer:   event.PubKey,
+			Content:    event.Content,
+			CreatedAt:  int64(event.CreatedAt),
+		})
+	case isVote:
+		s.publishVoteThreshold(ctx, event, subspaceID, proposalID, webhooks)
+	}
+}
+
+// publishVoteThreshold notifies the webhooks whose vote threshold the saved vote reached.
+// Votes are only counted when a webhook has a threshold, since it takes a scan.
+func (s *notifyingStore) publishVoteThreshold(ctx context.Context, vote *nostr.Event, subspaceID, proposalID string, webhooks []*orbitdb.SubspaceWebhook) {
+	var watching []*orbitdb.SubspaceWebhook
+	for _, webhook := range webhooks {
+		if webhook.VoteThreshold > 0 {
+			watching = append(watching, webhook)
+		}
+	}
+	if len(watching) == 0 {
+		return
+	}
+
+	votes, err := s.Store.QueryEvents(ctx, nostr.Filter{
+		Kinds: []int{vote.Kind},
+		Tags:  nostr.TagMap{"sid": {subspaceID}, "proposal_id": {proposalID}},
+	})
+	if err != nil {
+		zap.L().Warn("Failed to count proposal votes", zap.String("proposal", proposalID), zap.Error(err))
+		return
+	}
+
+	data := VoteThresholdCrossedData{
+		SubspaceID: subspaceID,
+		ProposalID: proposalID,
+		EventID:    vote.ID,
+	}
+	for event := range votes {
+		data.TotalVotes++
+		switch tagValue(event, "vote") {
+		case "yes":
+			data.YesVotes++
+		case "no":
+			data.NoVotes++
+		}
+	}
+
+	// Only the vote that makes the count equal to the threshold crosses it
+	for _, webhook := range watching {
+		if webhook.VoteThreshold != data.TotalVotes {
+			continue
+		}
+		crossed := data
+		crossed.Threshold = webhook.VoteThreshold
+		s.dispatcher.PublishTo(subspaceEndpoints([]*orbitdb.SubspaceWebhook{webhook}), TypeVoteThresholdCrossed, &crossed)
+	}
+}
+
+// publishMatching delivers an event to the webhook subscriptions whose filter it matches.
+// Subscriptions registered on other nodes have no secret here and are delivered by their own
+// node, so each matching event is delivered once whichever node saw it first.
+func publishMatching(ctx context.Context, store storage.Store, dispatcher *Dispatcher, event *nostr.Event, source string) {
+	subscriptions, err := store.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		zap.L().Warn("Failed to load webhook subscriptions", zap.String("event", event.ID), zap.Error(err))
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		if subscription.Secret == "" || !subscription.Matches(event) {
+			continue
+		}
+		endpoint := config.WebhookEndpoint{URL: subscription.URL, Secret: subscription.Secret}
+		dispatcher.PublishTo([]config.WebhookEndpoint{endpoint}, TypeEventMatched, &EventMatchedData{
+			SubscriptionID: subscription.ID,
+			Source:         source,
+			Event:          event,
+		})
+	}
+}
+
+// Helper function: get the delivery endpoints of subspace webhooks. Webhooks registered on
+// other nodes have no secret here and are delivered by their own node.
+func subspaceEndpoints(webhooks []*orbitdb.SubspaceWebhook) []config.WebhookEndpoint {
+	endpoints := make([]config.WebhookEndpoint, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		if webhook.Secret == "" {
+			continue
+		}
+		endpoints = append(endpoints, config.WebhookEndpoint{
+			URL:    webhook.URL,
+			Secret: webhook.Secret,
+			Events: webhook.Events,
+		})
+	}
+	return endpoints
+}
+
+// Helper function: get the first value of a tag
+func tagValue(event *nostr.Event, name string) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == name {
+			return tag[1]
+		}
+	}
+	return ""
+}
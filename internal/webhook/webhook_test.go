@@ -0,0 +1,243 @@
+package webhook
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/hetu-project/cRelay-crdt-db/internal/config"
+	"github.com/hetu-project/cRelay-crdt-db/orbitdb"
+)
+
+// signAs signs event with a key derived from name, as the store only saves signed events
+func signAs(t *testing.T, name string, event *nostr.Event) *nostr.Event {
+	key := sha256.Sum256([]byte(name))
+	require.NoError(t, event.Sign(hex.EncodeToString(key[:])))
+	return event
+}
+
+// Test signature verification and replay protection
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"test"}`)
+	now := time.Now()
+	timestamp := now.Unix()
+	signature := Sign("secret", timestamp, body)
+	ts := strconv.FormatInt(timestamp, 10)
+
+	assert.NoError(t, Verify("secret", signature, ts, body, DefaultTolerance, now))
+	assert.Error(t, Verify("other-secret", signature, ts, body, DefaultTolerance, now))
+	assert.Error(t, Verify("secret", signature, ts, []byte(`{"id":"changed"}`), DefaultTolerance, now))
+	assert.Error(t, Verify("secret", signature, ts, body, DefaultTolerance, now.Add(10*time.Minute)))
+	assert.Error(t, Verify("secret", signature, "not-a-number", body, DefaultTolerance, now))
+}
+
+// Test that every payload type has a schema matching its sample data
+func TestSchemas(t *testing.T) {
+	for _, payloadType := range Types {
+		schemaData, err := Schema(payloadType)
+		require.NoError(t, err, payloadType)
+
+		var schema struct {
+			Properties struct {
+				Data struct {
+					Required []string `json:"required"`
+				} `json:"data"`
+			} `json:"properties"`
+		}
+		require.NoError(t, json.Unmarshal(schemaData, &schema), payloadType)
+
+		sample, err := SampleData(payloadType)
+		require.NoError(t, err)
+		sampleData, err := json.Marshal(sample)
+		require.NoError(t, err)
+
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal(sampleData, &fields))
+		for _, field := range schema.Properties.Data.Required {
+			assert.Contains(t, fields, field, payloadType)
+		}
+	}
+
+	_, err := Schema("unknown.type")
+	assert.Error(t, err)
+}
+
+// Test a signed test delivery
+func TestSendTest(t *testing.T) {
+	var received *http.Request
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dispatcher := NewDispatcher(config.WebhooksConfig{
+		Timeout:   time.Second,
+		Endpoints: []config.WebhookEndpoint{{URL: server.URL, Secret: "secret"}},
+	})
+
+	results, err := dispatcher.SendTest(context.Background(), TypeSubspaceCreated, "")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Empty(t, results[0].Error)
+	assert.Equal(t, http.StatusNoContent, results[0].StatusCode)
+
+	// Verify headers and signature
+	assert.Equal(t, TypeSubspaceCreated, received.Header.Get(HeaderEvent))
+	assert.Equal(t, results[0].DeliveryID, received.Header.Get(HeaderDelivery))
+	assert.NoError(t, Verify("secret", received.Header.Get(HeaderSignature), received.Header.Get(HeaderTimestamp), receivedBody, DefaultTolerance, time.Now()))
+
+	var payload Payload
+	require.NoError(t, json.Unmarshal(receivedBody, &payload))
+	assert.Equal(t, SchemaVersion, payload.Version)
+	assert.True(t, payload.Test)
+
+	// Unknown endpoint
+	_, err = dispatcher.SendTest(context.Background(), TypeEventSaved, "http://unknown.example")
+	assert.Error(t, err)
+}
+
+// Test that subspace webhooks receive member, proposal and vote threshold notifications
+func TestSubspaceWebhooks(t *testing.T) {
+	received := make(chan Payload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Payload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	adapter := orbitdb.NewOrbitDBAdapter(orbitdb.NewMemoryDocumentStore("subspace-webhooks"))
+	dispatcher := NewDispatcher(config.WebhooksConfig{Timeout: time.Second})
+	store := NewNotifyingStore(adapter, dispatcher)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000e5"
+	require.NoError(t, adapter.AddSubspaceWebhook(ctx, sid, &orbitdb.SubspaceWebhook{
+		URL: server.URL, Secret: "secret", VoteThreshold: 2,
+	}))
+	// Other subspaces are not notified
+	require.NoError(t, store.SaveEvent(ctx, signAs(t, "member", &nostr.Event{Kind: 30200,
+		Tags: nostr.Tags{{"sid", "0x00000000000000000000000000000000000000000000000000000000000000e6"}}})))
+
+	proposal := signAs(t, "member", &nostr.Event{Kind: 30301, Tags: nostr.Tags{{"sid", sid}, {"op", "propose"}}, Content: "raise the quorum"})
+	vote := func(voter, value string) *nostr.Event {
+		return signAs(t, voter, &nostr.Event{Kind: 30302, Tags: nostr.Tags{{"sid", sid}, {"op", "vote"}, {"proposal_id", proposal.ID}, {"vote", value}}})
+	}
+	events := []*nostr.Event{
+		signAs(t, "member", &nostr.Event{Kind: 30200, Tags: nostr.Tags{{"sid", sid}}}),
+		proposal,
+		vote("member", "yes"),
+		vote("other", "no"),
+		vote("third", "yes"),
+	}
+	for _, event := range events {
+		require.NoError(t, store.SaveEvent(ctx, event))
+		dispatcher.Wait(ctx) // Keep deliveries in order
+	}
+	close(received)
+
+	var types []string
+	var crossed VoteThresholdCrossedData
+	for payload := range received {
+		types = append(types, payload.Type)
+		if payload.Type == TypeVoteThresholdCrossed {
+			require.NoError(t, json.Unmarshal(payload.Data, &crossed))
+		}
+	}
+	assert.Equal(t, []string{TypeMemberJoined, TypeProposalCreated, TypeVoteThresholdCrossed}, types)
+	assert.Equal(t, VoteThresholdCrossedData{
+		SubspaceID: sid,
+		ProposalID: proposal.ID,
+		Threshold:  2,
+		TotalVotes: 2,
+		YesVotes:   1,
+		NoVotes:    1,
+		EventID:    events[3].ID,
+	}, crossed)
+}
+
+// Test that subscriptions receive the saved events matching their filter, retried after
+// server errors
+func TestWebhookSubscriptions(t *testing.T) {
+	var attempts []string
+	received := make(chan Payload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		attempts = append(attempts, r.Header.Get(HeaderDelivery))
+		if len(attempts) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		assert.NoError(t, Verify("secret", r.Header.Get(HeaderSignature), r.Header.Get(HeaderTimestamp), body, DefaultTolerance, time.Now()))
+		var payload Payload
+		json.Unmarshal(body, &payload)
+		received <- payload
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	db := orbitdb.NewMemoryDocumentStore("webhook-subscriptions")
+	adapter := orbitdb.NewOrbitDBAdapter(db)
+	dispatcher := NewDispatcher(config.WebhooksConfig{Timeout: time.Second, Retries: 2, RetryBackoff: time.Millisecond})
+	store := NewNotifyingStore(adapter, dispatcher)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000e7"
+	subscription := &orbitdb.WebhookSubscription{URL: server.URL, Secret: "secret",
+		Filter: nostr.Filter{Kinds: []int{30300}, Tags: nostr.TagMap{"sid": {sid}}}}
+	require.NoError(t, adapter.AddWebhookSubscription(ctx, subscription))
+
+	post := signAs(t, "member", &nostr.Event{Kind: 30300, Tags: nostr.Tags{{"sid", sid}, {"op", "post"}}})
+	for _, event := range []*nostr.Event{
+		signAs(t, "member", &nostr.Event{Kind: 30200, Tags: nostr.Tags{{"sid", sid}}}),
+		post,
+	} {
+		require.NoError(t, store.SaveEvent(ctx, event))
+	}
+	dispatcher.Wait(ctx)
+	close(received)
+
+	require.Len(t, attempts, 2)
+	assert.Equal(t, attempts[0], attempts[1], "retries keep the delivery ID")
+	payload := <-received
+	assert.Equal(t, TypeEventMatched, payload.Type)
+	var data EventMatchedData
+	require.NoError(t, json.Unmarshal(payload.Data, &data))
+	assert.Equal(t, subscription.ID, data.SubscriptionID)
+	assert.Equal(t, SourceSaved, data.Source)
+	assert.Equal(t, post.ID, data.Event.ID)
+
+	// A peer sharing the documents has no secret, so it leaves the delivery to this node
+	peer := orbitdb.NewOrbitDBAdapter(db)
+	peerSubscriptions, err := peer.ListWebhookSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Len(t, peerSubscriptions, 1)
+	assert.Equal(t, subscription.ID, peerSubscriptions[0].ID)
+	assert.Empty(t, peerSubscriptions[0].Secret)
+	peerStore := NewNotifyingStore(peer, dispatcher)
+	require.NoError(t, peerStore.SaveEvent(ctx, signAs(t, "member", &nostr.Event{Kind: 30300, Tags: nostr.Tags{{"sid", sid}}})))
+	dispatcher.Wait(ctx)
+	assert.Len(t, attempts, 2, "only the registering node delivers")
+
+	// Deleted subscriptions are not notified
+	deleted, err := adapter.DeleteWebhookSubscription(ctx, subscription.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	subscriptions, err := adapter.ListWebhookSubscriptions(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, subscriptions)
+}
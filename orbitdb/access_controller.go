@@ -0,0 +1,175 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"berty.tech/go-orbit-db/accesscontroller"
+	"berty.tech/go-orbit-db/accesscontroller/simple"
+	"berty.tech/go-orbit-db/identityprovider"
+	"berty.tech/go-orbit-db/iface"
+)
+
+// NostrAccessControllerType is the access controller type of databases whose events must be
+// signed by allowed nostr public keys
+const NostrAccessControllerType = "nostr"
+
+// ErrWriteNotAllowed is returned for oplog entries rejected by the nostr access controller
+var ErrWriteNotAllowed = errors.New("write not allowed")
+
+// NostrWritePolicy decides which oplog entries a database accepts. Entries writing nostr
+// events are accepted if every event has a valid signature from an allowed public key;
+// all other entries, e.g. derived data, deletes and keyvalue counters, are accepted from
+// the writer identities of the database manifest. Deletes may remove events, so they need a
+// writer identity listed by name: a "*" writer doesn't allow them.
+type NostrWritePolicy struct {
+	PubKeys   []string            // Public keys allowed to write events, empty for any signed event
+	Subspaces map[string][]string // Public keys allowed to write events of a subspace, replacing PubKeys
+}
+
+// allowed reports whether the public key may write an event of the subspace
+func (p *NostrWritePolicy) allowed(pubKey, subspaceID string) bool {
+	if keys, exists := p.Subspaces[subspaceID]; exists && subspaceID != "" {
+		return containsString(keys, pubKey)
+	}
+	return len(p.PubKeys) == 0 || containsString(p.PubKeys, pubKey)
+}
+
+// oplogPayload is the operation stored in an oplog entry. Values are JSON documents for
+// docstores and arbitrary bytes for keyvalue stores, encoded as base64 strings.
+type oplogPayload struct {
+	Op    string          `json:"op"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+	Docs  []struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	} `json:"docs"`
+}
+
+// CheckEntry checks the payload of an oplog entry written by the identity against the policy
+func (p *NostrWritePolicy) CheckEntry(payload []byte, identityID string, writers []string) error {
+	var op oplogPayload
+	if err := json.Unmarshal(payload, &op); err != nil {
+		return fmt.Errorf("%w: invalid oplog payload: %v", ErrWriteNotAllowed, err)
+	}
+
+	keys, values := []string{op.Key}, []json.RawMessage{op.Value}
+	for _, doc := range op.Docs {
+		keys = append(keys, doc.Key)
+		values = append(values, doc.Value)
+	}
+
+	// Anything but events, including deletes, is written by nodes rather than users
+	byNode := len(op.Docs) == 0 && len(op.Value) == 0
+	for i, value := range values {
+		if len(value) == 0 {
+			continue
+		}
+		docMap := decodePayloadDocument(value)
+		if docMap == nil || docMap["doc_type"] != DocTypeNostrEvent {
+			byNode = true
+			continue
+		}
+		if err := p.checkEvent(keys[i], docMap); err != nil {
+			return err
+		}
+	}
+
+	if op.Op == "DEL" && !containsString(writers, identityID) {
+		return fmt.Errorf("%w: identity %s may not delete %s", ErrWriteNotAllowed, identityID, op.Key)
+	}
+	if byNode && !containsString(writers, "*") && !containsString(writers, identityID) {
+		return fmt.Errorf("%w: identity %s may not write %s entries", ErrWriteNotAllowed, identityID, op.Op)
+	}
+	return nil
+}
+
+// checkEvent verifies the signature and author of an event document written under key. The
+// key must be the event's ID, or a signed event could overwrite any other document.
+func (p *NostrWritePolicy) checkEvent(key string, docMap map[string]interface{}) error {
+	event := docToEvent(docMap)
+	if ok, err := event.CheckSignature(); err != nil || !ok || event.GetID() != event.ID {
+		return fmt.Errorf("%w: event %s has a bad signature", ErrWriteNotAllowed, event.ID)
+	}
+	if key != event.ID {
+		return fmt.Errorf("%w: event %s written under key %s", ErrWriteNotAllowed, event.ID, key)
+	}
+
+	var subspaceID string
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" {
+			subspaceID = tag[1]
+			break
+		}
+	}
+	if !p.allowed(event.PubKey, subspaceID) {
+		return fmt.Errorf("%w: event %s signed by %s", ErrWriteNotAllowed, event.ID, event.PubKey)
+	}
+	return nil
+}
+
+// decodePayloadDocument decodes an operation value into a document. Returns nil for values
+// that aren't JSON objects, e.g. keyvalue counters.
+func decodePayloadDocument(value json.RawMessage) map[string]interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+
+	// Byte values are serialized as base64 strings
+	var encoded string
+	if err := json.Unmarshal(value, &encoded); err == nil {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil
+		}
+		value = decoded
+	}
+
+	var docMap map[string]interface{}
+	if err := decodeJSON(value, &docMap); err != nil {
+		return nil
+	}
+	return docMap
+}
+
+// NostrAccessController enforces a NostrWritePolicy on the entries appended to a database.
+// Manifests, grants and revocations are handled like the simple access controller.
+type NostrAccessController struct {
+	accesscontroller.Interface
+	policy *NostrWritePolicy
+}
+
+// NewNostrAccessControllerConstructor returns the constructor to register with
+// RegisterAccessControllerType before opening databases with the "nostr" controller type
+func NewNostrAccessControllerConstructor(policy *NostrWritePolicy) iface.AccessControllerConstructor {
+	return func(ctx context.Context, db iface.BaseOrbitDB, params accesscontroller.ManifestParams, options ...accesscontroller.Option) (accesscontroller.Interface, error) {
+		inner, err := simple.NewSimpleAccessController(ctx, db, params, options...)
+		if err != nil {
+			return nil, err
+		}
+		return &NostrAccessController{Interface: inner, policy: policy}, nil
+	}
+}
+
+// Type returns the access controller type
+func (c *NostrAccessController) Type() string {
+	return NostrAccessControllerType
+}
+
+// CanAppend checks an entry against the write policy
+func (c *NostrAccessController) CanAppend(entry accesscontroller.LogEntry, p identityprovider.Interface, additionalContext accesscontroller.CanAppendAdditionalContext) error {
+	writers, err := c.Interface.GetAuthorizedByRole("write")
+	if err != nil {
+		return err
+	}
+
+	var identityID string
+	if identity := entry.GetIdentity(); identity != nil {
+		identityID = identity.ID
+	}
+	return c.policy.CheckEntry(entry.GetPayload(), identityID, writers)
+}
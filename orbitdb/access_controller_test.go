@@ -0,0 +1,96 @@
+package orbitdb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: build an oplog payload like the docstore does, with base64 document values
+func oplogEntry(t *testing.T, op string, docs ...map[string]interface{}) []byte {
+	type opDoc struct {
+		Key   string `json:"key"`
+		Value []byte `json:"value"`
+	}
+	entry := struct {
+		Op    string  `json:"op"`
+		Key   string  `json:"key,omitempty"`
+		Value []byte  `json:"value,omitempty"`
+		Docs  []opDoc `json:"docs,omitempty"`
+	}{Op: op}
+
+	for _, doc := range docs {
+		value, err := json.Marshal(doc)
+		require.NoError(t, err)
+		key, _ := doc["_id"].(string)
+		if op == "PUTALL" {
+			entry.Docs = append(entry.Docs, opDoc{Key: key, Value: value})
+		} else {
+			entry.Key, entry.Value = key, value
+		}
+	}
+
+	payload, err := json.Marshal(entry)
+	require.NoError(t, err)
+	return payload
+}
+
+// Test that events need a valid signature from an allowed key and other entries an allowed writer
+func TestNostrWritePolicy(t *testing.T) {
+	member, outsider := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	memberKey, _ := nostr.GetPublicKey(member)
+	outsiderKey, _ := nostr.GetPublicKey(outsider)
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000a7"
+
+	signed := func(key string, tags nostr.Tags) map[string]interface{} {
+		event := &nostr.Event{Kind: 30300, CreatedAt: 1700000000, Tags: tags, Content: "hello"}
+		require.NoError(t, event.Sign(key))
+		return eventToDoc(event)
+	}
+
+	policy := &NostrWritePolicy{
+		PubKeys:   []string{memberKey, outsiderKey},
+		Subspaces: map[string][]string{sid: {memberKey}},
+	}
+	writers := []string{"node-a"}
+
+	assert.NoError(t, policy.CheckEntry(oplogEntry(t, "PUT", signed(member, nil)), "anyone", writers))
+	assert.NoError(t, policy.CheckEntry(oplogEntry(t, "PUT", signed(outsider, nil)), "anyone", writers))
+	assert.NoError(t, policy.CheckEntry(oplogEntry(t, "PUT", signed(member, nostr.Tags{{"sid", sid}})), "anyone", writers))
+
+	// The subspace list replaces the global one
+	err := policy.CheckEntry(oplogEntry(t, "PUT", signed(outsider, nostr.Tags{{"sid", sid}})), "anyone", writers)
+	assert.ErrorIs(t, err, ErrWriteNotAllowed)
+
+	tampered := signed(member, nil)
+	tampered["content"] = "goodbye"
+	assert.ErrorIs(t, policy.CheckEntry(oplogEntry(t, "PUT", tampered), "anyone", writers), ErrWriteNotAllowed)
+
+	// Signed events must be written under their own ID, not over another document
+	value, err := json.Marshal(signed(member, nil))
+	require.NoError(t, err)
+	misplaced, err := json.Marshal(map[string]interface{}{"op": "PUT", "key": memberKey, "value": value})
+	require.NoError(t, err)
+	assert.ErrorIs(t, policy.CheckEntry(misplaced, "anyone", writers), ErrWriteNotAllowed)
+	misplaced, err = json.Marshal(map[string]interface{}{"op": "PUTALL", "docs": []interface{}{map[string]interface{}{"key": memberKey, "value": value}}})
+	require.NoError(t, err)
+	assert.ErrorIs(t, policy.CheckEntry(misplaced, "node-a", writers), ErrWriteNotAllowed)
+
+	// Derived data and deletes are written by nodes
+	stats := map[string]interface{}{"_id": memberKey, "doc_type": "user_stats"}
+	assert.NoError(t, policy.CheckEntry(oplogEntry(t, "PUT", stats), "node-a", writers))
+	assert.ErrorIs(t, policy.CheckEntry(oplogEntry(t, "PUT", stats), "anyone", writers), ErrWriteNotAllowed)
+	assert.ErrorIs(t, policy.CheckEntry([]byte(`{"op":"DEL","key":"event"}`), "anyone", writers), ErrWriteNotAllowed)
+	assert.NoError(t, policy.CheckEntry([]byte(`{"op":"DEL","key":"event"}`), "node-a", writers))
+
+	// A wildcard writer doesn't allow deleting events
+	assert.ErrorIs(t, policy.CheckEntry([]byte(`{"op":"DEL","key":"event"}`), "anyone", []string{"*"}), ErrWriteNotAllowed)
+
+	// Batches are checked document by document
+	batch := oplogEntry(t, "PUTALL", signed(member, nil), stats)
+	assert.ErrorIs(t, policy.CheckEntry(batch, "anyone", writers), ErrWriteNotAllowed)
+	assert.NoError(t, policy.CheckEntry(batch, "node-a", writers))
+}
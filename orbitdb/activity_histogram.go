@@ -0,0 +1,206 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeActivityHistogram identifies activity histogram documents
+const DocTypeActivityHistogram = "activity_histogram"
+
+// Scopes of activity histograms
+const (
+	ActivityScopeUser     = "user"
+	ActivityScopeSubspace = "subspace"
+)
+
+// Granularities of activity histograms
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+)
+
+// Longest ranges of activity histograms by granularity
+const (
+	MaxHourlyActivityRange = 31 * 24 * time.Hour
+	MaxDailyActivityRange  = 366 * 24 * time.Hour
+)
+
+// ActivityHistogramDay counts the events of a user or subspace on one UTC day, by hour
+type ActivityHistogramDay struct {
+	ID      string   `json:"id"`       // Document ID, format: activity_histogram:<scope>:<id>:<day>
+	DocType string   `json:"doc_type"` // Document type, fixed as "activity_histogram"
+	Scope   string   `json:"scope"`    // user|subspace
+	Owner   string   `json:"owner"`    // User public key or subspace ID
+	Day     string   `json:"day"`      // UTC day, format: 2006-01-02
+	Hours   []uint64 `json:"hours"`    // Events per hour of the day, 24 entries
+	Total   uint64   `json:"total"`    // Events on the day
+	Updated int64    `json:"updated"`  // Update timestamp
+}
+
+// ActivityPoint is one bucket of an activity histogram
+type ActivityPoint struct {
+	Start int64  `json:"start"` // Start of the bucket, unix seconds
+	Count uint64 `json:"count"` // Events created in the bucket
+}
+
+// ActivityHistogramManager maintains hourly event counts per user and per subspace as
+// events are saved, sharded into one document per day
+type ActivityHistogramManager struct {
+	db iface.DocumentStore
+}
+
+// NewActivityHistogramManager creates a new ActivityHistogramManager
+func NewActivityHistogramManager(db iface.DocumentStore) *ActivityHistogramManager {
+	return &ActivityHistogramManager{db: db}
+}
+
+// activityHistogramDocID returns the document key of the histogram of an owner on a day
+func activityHistogramDocID(scope, owner, day string) string {
+	return DocTypeActivityHistogram + ":" + scope + ":" + owner + ":" + day
+}
+
+// UpdateFromEvent counts an event in the hour it was created, for its author and its subspace
+func (hm *ActivityHistogramManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	created := event.CreatedAt.Time().UTC()
+
+	if event.PubKey != "" {
+		if err := hm.increment(ctx, ActivityScopeUser, event.PubKey, created); err != nil {
+			return err
+		}
+	}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" {
+			return hm.increment(ctx, ActivityScopeSubspace, tag[1], created)
+		}
+	}
+	return nil
+}
+
+// increment adds an event to the histogram of an owner
+func (hm *ActivityHistogramManager) increment(ctx context.Context, scope, owner string, created time.Time) error {
+	day := created.Format(time.DateOnly)
+	histogram, err := hm.getDay(ctx, scope, owner, day)
+	if err != nil {
+		return err
+	}
+	if histogram == nil {
+		histogram = &ActivityHistogramDay{
+			ID:      activityHistogramDocID(scope, owner, day),
+			DocType: DocTypeActivityHistogram,
+			Scope:   scope,
+			Owner:   owner,
+			Day:     day,
+			Hours:   make([]uint64, 24),
+		}
+	}
+
+	histogram.Hours[created.Hour()]++
+	histogram.Total++
+	return hm.saveDay(ctx, histogram)
+}
+
+// GetActivityHistogram returns the event counts of a user or subspace in buckets of the
+// granularity covering [from, to], oldest first. Buckets without events are included so
+// the histogram can be plotted directly.
+func (hm *ActivityHistogramManager) GetActivityHistogram(ctx context.Context, scope, owner, granularity string, from, to time.Time) ([]*ActivityPoint, error) {
+	from, to = from.UTC(), to.UTC()
+	points := []*ActivityPoint{}
+
+	for day := from.Truncate(24 * time.Hour); !day.After(to); day = day.AddDate(0, 0, 1) {
+		histogram, err := hm.getDay(ctx, scope, owner, day.Format(time.DateOnly))
+		if err != nil {
+			return nil, err
+		}
+
+		if granularity == GranularityDay {
+			point := &ActivityPoint{Start: day.Unix()}
+			if histogram != nil {
+				point.Count = histogram.Total
+			}
+			points = append(points, point)
+			continue
+		}
+
+		for hour := 0; hour < 24; hour++ {
+			start := day.Add(time.Duration(hour) * time.Hour)
+			if start.Add(time.Hour).Before(from) || start.After(to) {
+				continue
+			}
+			point := &ActivityPoint{Start: start.Unix()}
+			if histogram != nil {
+				point.Count = histogram.Hours[hour]
+			}
+			points = append(points, point)
+		}
+	}
+	return points, nil
+}
+
+// getDay retrieves the histogram of an owner on a day, nil if there were no events
+func (hm *ActivityHistogramManager) getDay(ctx context.Context, scope, owner, day string) (*ActivityHistogramDay, error) {
+	docs, err := hm.db.Get(ctx, activityHistogramDocID(scope, owner, day), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeActivityHistogram {
+			continue
+		}
+
+		// Convert document to JSON and parse into struct
+		jsonData, err := json.Marshal(docMap)
+		if err != nil {
+			return nil, err
+		}
+		var histogram ActivityHistogramDay
+		if err := json.Unmarshal(jsonData, &histogram); err != nil {
+			return nil, err
+		}
+		if len(histogram.Hours) != 24 {
+			hours := make([]uint64, 24)
+			copy(hours, histogram.Hours)
+			histogram.Hours = hours
+		}
+		return &histogram, nil
+	}
+
+	return nil, nil
+}
+
+// saveDay saves an activity histogram document
+func (hm *ActivityHistogramManager) saveDay(ctx context.Context, histogram *ActivityHistogramDay) error {
+	histogram.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            histogram.ID,
+		"id":             histogram.ID,
+		"doc_type":       DocTypeActivityHistogram,
+		"schema_version": schemaVersion(DocTypeActivityHistogram),
+		"scope":          histogram.Scope,
+		"owner":          histogram.Owner,
+		"day":            histogram.Day,
+		"hours":          histogram.Hours,
+		"total":          histogram.Total,
+		"updated":        histogram.Updated,
+	}
+
+	_, err := hm.db.Put(ctx, doc)
+	return err
+}
+
+// GetActivityHistogram retrieves the event counts of a user or subspace over time
+func (a *OrbitDBAdapter) GetActivityHistogram(ctx context.Context, scope, owner, granularity string, from, to time.Time) ([]*ActivityPoint, error) {
+	return a.activityHistogramMgr.GetActivityHistogram(ctx, scope, owner, granularity, from, to)
+}
@@ -2,227 +2,440 @@ package orbitdb
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"berty.tech/go-orbit-db/iface"
 	"github.com/nbd-wtf/go-nostr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
 )
 
 // OrbitDBAdapter implements the eventstore.Store interface
 type OrbitDBAdapter struct {
-	db           iface.DocumentStore
-	causalityMgr *CausalityManager
-	userStatsMgr *UserStatsManager
+	db                    iface.DocumentStore
+	events                iface.DocumentStore // Store holding the nostr events, db unless it is a SplitStore
+	causalityMgr          *CausalityManager
+	userStatsMgr          *UserStatsManager
+	leaderboardMgr        *LeaderboardManager
+	xrefMgr               *XrefManager
+	usageMgr              *UsageManager
+	webhookMgr            *SubspaceWebhookManager
+	subscriptionMgr       *WebhookSubscriptionManager
+	annotationMgr         *AnnotationManager
+	quarantineMgr         *QuarantineManager
+	voteMgr               *VoteManager
+	proposalMgr           *ProposalManager
+	subspaceMetaMgr       *SubspaceMetaManager
+	userProfileMgr        *UserProfileManager
+	followGraphMgr        *FollowGraphManager
+	muteListMgr           *MuteListManager
+	subspaceModerationMgr *SubspaceModerationManager
+	subspaceActivityMgr   *SubspaceActivityManager
+	subspaceStatsMgr      *SubspaceStatsManager
+	activityHistogramMgr  *ActivityHistogramManager
+	cache                 *readCache          // nil unless EnableReadCache was called
+	derived               *derivedQueue       // nil unless EnableAsyncDerivedData was called
+	staleEvents           string              // Handling of causally stale events, empty to accept them
+	policies              *PolicyChain        // nil unless SetEventPolicies was called
+	replication           *ReplicationMonitor // nil unless EnableReplicationMonitor was called
+	webhookSecrets        *WebhookSecrets     // Signing secrets of the webhooks registered on this node
+	processors            []*registeredProcessor
+	queryTimeout          time.Duration // Bound of event and subspace user scans, 0 for none
+	partialResults        bool          // Whether scans over queryTimeout return partial results
+	moderators            []string      // Users whose mute lists hide authors from queries with WithMuteFilter
+
+	snapshotMu  sync.Mutex
+	snapshotted map[string]int // Oplog length of each store at its last snapshot, by address
 }
 
 // NewOrbitDBAdapter creates a new OrbitDB adapter
 func NewOrbitDBAdapter(db iface.DocumentStore) *OrbitDBAdapter {
+	// Split stores let event, causality and statistics scans skip the other documents
+	events, causality, stats := db, db, db
+	if split, ok := db.(*SplitStore); ok {
+		events, causality, stats = split.Events(), split.Causality(), split.Stats()
+	}
+
+	secrets := NewWebhookSecrets()
 	return &OrbitDBAdapter{
-		db:           db,
-		causalityMgr: NewCausalityManager(db), // Use the same database instance
-		userStatsMgr: NewUserStatsManager(db), // Use the same database instance
+		db:                    db,
+		events:                events,
+		causalityMgr:          NewCausalityManager(causality),
+		userStatsMgr:          NewUserStatsManager(stats),
+		leaderboardMgr:        NewLeaderboardManager(stats),
+		xrefMgr:               NewXrefManager(db),  // Use the same database instance
+		usageMgr:              NewUsageManager(db), // Use the same database instance
+		webhookMgr:            NewSubspaceWebhookManager(db, secrets),
+		subscriptionMgr:       NewWebhookSubscriptionManager(db, secrets),
+		annotationMgr:         NewAnnotationManager(db),
+		quarantineMgr:         NewQuarantineManager(db),
+		voteMgr:               NewVoteManager(db),
+		proposalMgr:           NewProposalManager(db),
+		subspaceMetaMgr:       NewSubspaceMetaManager(db),
+		userProfileMgr:        NewUserProfileManager(stats),
+		followGraphMgr:        NewFollowGraphManager(stats),
+		muteListMgr:           NewMuteListManager(stats),
+		subspaceModerationMgr: NewSubspaceModerationManager(db),
+		subspaceActivityMgr:   NewSubspaceActivityManager(db),
+		subspaceStatsMgr:      NewSubspaceStatsManager(db),
+		activityHistogramMgr:  NewActivityHistogramManager(db),
+		webhookSecrets:        secrets,
 	}
 }
 
 // SaveEvent saves an event to OrbitDB
 // Updated signature to match func(ctx context.Context, event *nostr.Event) error
-func (a *OrbitDBAdapter) SaveEvent(ctx context.Context, event *nostr.Event) error {
+func (a *OrbitDBAdapter) SaveEvent(ctx context.Context, event *nostr.Event) (err error) {
 	if event == nil {
 		return fmt.Errorf("event cannot be nil")
 	}
+	ctx, span := startSpan(ctx, "orbitdb.SaveEvent", eventAttributes(event)...)
+	defer func() { endSpan(span, err) }()
 
-	// Convert event to document
-	doc := map[string]interface{}{
-		"_id":        event.ID,
-		"pubkey":     event.PubKey,
-		"created_at": event.CreatedAt,
-		"kind":       event.Kind,
-		"content":    event.Content,
-		"tags":       event.Tags,
-		"sig":        event.Sig,
-		"doc_type":   DocTypeNostrEvent, // Add document type identifier
+	// Events must be signed by their author and pass the acceptance policies before anything
+	// else is looked up
+	if err := checkSignature(event); err != nil {
+		return err
+	}
+	if err := a.policies.Check(event); err != nil {
+		return err
+	}
+	if err := checkExpiration(event); err != nil {
+		return err
 	}
 
-	// Save to database
-	_, err := a.db.Put(ctx, doc)
+	// Resubmitted and replayed events are accepted without another write, their derived data
+	// is up to date already
+	stored, err := a.eventStored(ctx, event.ID)
 	if err != nil {
 		return err
 	}
+	if stored {
+		span.SetAttributes(attribute.Bool("nostr.duplicate", true))
+		return nil
+	}
 
-	// Update causality
-	if updateErr := a.causalityMgr.UpdateFromEvent(ctx, event); updateErr != nil {
-		// Try to update causality, but don't affect event storage
-		log.Printf("Warning: Failed to update causality: %v", updateErr)
+	if err := a.checkAccess(ctx, event); err != nil {
+		return err
+	}
+	if err := a.checkStaleness(ctx, event); err != nil {
+		return err
 	}
 
-	// Update user statistics
-	if updateErr := a.userStatsMgr.UpdateUserStatsFromEvent(ctx, event); updateErr != nil {
-		// Try to update user statistics, but don't affect event storage
-		log.Printf("Warning: Failed to update user statistics: %v", updateErr)
+	// A full derived data queue holds the write back until it has room
+	if err := a.reserveDerivedRoom(ctx); err != nil {
+		return err
 	}
 
+	// Save to database
+	if _, err := a.db.Put(ctx, eventToDoc(event)); err != nil {
+		a.releaseDerivedRoom()
+		return err
+	}
+
+	a.updateDerivedData(ctx, event, true)
 	return nil
 }
 
-func (a *OrbitDBAdapter) QueryEvents(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
-	// Create event channel
-	eventChan := make(chan *nostr.Event)
+// ValidateEvent checks an event's signature, the acceptance policies and the subspace and
+// vote rules against the replicated data, without saving it. Nodes forwarding events to
+// another node use it to refuse invalid events before they are forwarded.
+func (a *OrbitDBAdapter) ValidateEvent(ctx context.Context, event *nostr.Event) error {
+	if event == nil {
+		return fmt.Errorf("event cannot be nil")
+	}
+	if err := checkSignature(event); err != nil {
+		return err
+	}
+	if err := a.policies.Check(event); err != nil {
+		return err
+	}
+	if err := checkExpiration(event); err != nil {
+		return err
+	}
+	return a.checkAccess(ctx, event)
+}
 
-	go func() {
-		defer close(eventChan)
+// checkSignature returns an error wrapping ErrEventRejected unless the event's ID is the
+// hash of its content and its signature was made by its public key. The subspace, vote and
+// moderation rules trust the ID and public key, so they only run on checked events.
+func checkSignature(event *nostr.Event) error {
+	if ok, err := event.CheckSignature(); err != nil || !ok || event.GetID() != event.ID {
+		return fmt.Errorf("%w: invalid id or signature", ErrEventRejected)
+	}
+	return nil
+}
 
-		// Define query function
-		queryFn := func(doc interface{}) (bool, error) {
-			event, ok := doc.(map[string]interface{})
-			if !ok {
-				return false, nil
-			}
+// checkAccess applies the subspace and vote rules to an event against the replicated data
+func (a *OrbitDBAdapter) checkAccess(ctx context.Context, event *nostr.Event) error {
+	// Restricted subspaces only accept events from the users their create event allows
+	if err := a.subspaceMetaMgr.CheckWrite(ctx, event); err != nil {
+		return err
+	}
 
-			// Only process documents of type nostr event
-			docType, ok := event["doc_type"].(string)
-			if !ok || docType != DocTypeNostrEvent {
-				return false, nil
-			}
+	// Users banned by the subspace operators may not write to it
+	if err := a.subspaceModerationMgr.CheckWrite(ctx, event); err != nil {
+		return err
+	}
 
-			// Implement filtering logic
-			// Note: here it's _id instead of id
-			if len(filter.IDs) > 0 {
-				id, ok := event["_id"].(string)
-				if !ok || !contains(filter.IDs, id) {
-					return false, nil
-				}
-			}
+	// A user may vote once per proposal
+	return a.voteMgr.CheckVote(ctx, event)
+}
 
-			if len(filter.Authors) > 0 {
-				pubkey, ok := event["pubkey"].(string)
-				if !ok || !contains(filter.Authors, pubkey) {
-					return false, nil
-				}
-			}
+// SaveEvents saves several events with batch writes, then updates the derived data of each
+// event in order. Events already stored, or repeated in events, are skipped. Events go
+// through the same checks as with SaveEvent; the first refused event stops the batch and
+// its error is returned, after the events before it are saved.
+func (a *OrbitDBAdapter) SaveEvents(ctx context.Context, events []*nostr.Event) error {
+	_, err := a.saveEvents(ctx, events, func(event *nostr.Event, err error) error {
+		return fmt.Errorf("event %s refused: %w", event.ID, err)
+	})
+	return err
+}
 
-			if len(filter.Kinds) > 0 {
-				kind, ok := event["kind"].(float64)
-				if !ok || !containsInt(filter.Kinds, int(kind)) {
-					return false, nil
-				}
-			}
+// saveEvents saves events like SaveEvents, calling refused for each event failing the
+// checks: returning nil skips the event, an error stops the batch. The events of a batch
+// are checked against the data derived from the events before them: pending events are
+// written first whenever an event's subspace has a pending create or invite event, or its
+// proposal a pending vote. Returns the number of events saved.
+func (a *OrbitDBAdapter) saveEvents(ctx context.Context, events []*nostr.Event, refused func(event *nostr.Event, err error) error) (saved int, err error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
+	ctx, span := startSpan(ctx, "orbitdb.SaveEvents", attribute.Int("nostr.events", len(events)))
+	defer func() { endSpan(span, err) }()
+
+	docs := make([]interface{}, 0, len(events))
+	pending := make([]*nostr.Event, 0, len(events))
+	changed := make(map[string]bool) // Subspaces and proposals whose access data pending events change
+	flush := func() error {
+		if len(docs) == 0 {
+			return nil
+		}
+		if err := a.reserveDerivedRoom(ctx); err != nil {
+			return err
+		}
+		if _, err := a.db.PutBatch(ctx, docs); err != nil {
+			a.releaseDerivedRoom()
+			return err
+		}
+		for i, event := range pending {
+			a.updateDerivedData(ctx, event, i == 0)
+		}
+		saved += len(pending)
+		docs, pending = nil, nil
+		clear(changed)
+		return nil
+	}
 
-			// Filter #sid tag
-			// Check tag filtering conditions
-			if len(filter.Tags) > 0 {
-				tags, ok := event["tags"].([]interface{})
-				if !ok {
-					return false, nil
-				}
+	duplicates := 0
+	seen := make(map[string]bool, len(events))
+	for _, event := range events {
+		if event == nil {
+			return saved, fmt.Errorf("event cannot be nil")
+		}
+		if seen[event.ID] {
+			duplicates++
+			continue
+		}
+		seen[event.ID] = true
 
-				// Check each tag filtering condition
-				for tagName, tagValues := range filter.Tags {
-					if len(tagValues) == 0 {
-						continue
-					}
+		// Events must be signed by their author and pass the acceptance policies before
+		// anything else is looked up
+		err := checkSignature(event)
+		if err == nil {
+			err = a.policies.Check(event)
+		}
+		if err == nil {
+			err = checkExpiration(event)
+		}
+		if err != nil {
+			if err := refused(event, err); err != nil {
+				return saved, errors.Join(err, flush())
+			}
+			continue
+		}
 
-					// Find matching tag in the event
-					found := false
-					for _, tag := range tags {
-						tagArray, ok := tag.([]interface{})
-						if !ok || len(tagArray) < 2 {
-							continue
-						}
-
-						name, ok := tagArray[0].(string)
-						if !ok || !strings.EqualFold(name, tagName) {
-							continue
-						}
-
-						value, ok := tagArray[1].(string)
-						if !ok {
-							continue
-						}
-
-						// Check if tag value is in the filtering conditions
-						if contains(tagValues, value) {
-							found = true
-							break
-						}
-					}
+		stored, err := a.eventStored(ctx, event.ID)
+		if err != nil {
+			return saved, err
+		}
+		if stored {
+			duplicates++
+			continue
+		}
 
-					// If no matching tag is found, skip this event
-					if !found {
-						return false, nil
-					}
-				}
+		subspaceKey, proposalKey := "sid:"+eventSubspaceID(event), "proposal:"+voteProposal(event)
+		if changed[subspaceKey] || changed[proposalKey] {
+			if err := flush(); err != nil {
+				return saved, err
+			}
+		}
+		err = a.checkAccess(ctx, event)
+		if err == nil {
+			err = a.checkStaleness(ctx, event)
+		}
+		if err != nil {
+			if err := refused(event, err); err != nil {
+				return saved, errors.Join(err, flush())
 			}
+			continue
+		}
+
+		docs = append(docs, eventToDoc(event))
+		pending = append(pending, event)
+		if event.Kind == 30100 || event.Kind == 30303 {
+			changed[subspaceKey] = true
+		}
+		if voteProposal(event) != "" {
+			changed[proposalKey] = true
+		}
+	}
+	span.SetAttributes(attribute.Int("nostr.duplicates", duplicates))
+
+	return saved, flush()
+}
+
+// eventStored reports whether an event is stored or was replaced by a tombstone. An event ID
+// is the hash of the event, so a stored event with the ID is the same event, and a tombstoned
+// one must not come back.
+func (a *OrbitDBAdapter) eventStored(ctx context.Context, id string) (bool, error) {
+	docs, err := a.events.Get(ctx, id, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for a stored event: %w", err)
+	}
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if docType, _ := docMap["doc_type"].(string); docType == DocTypeNostrEvent || docType == DocTypeEventTombstone {
 			return true, nil
 		}
+	}
+	return false, nil
+}
 
-		// Execute query
-		docs, _ := a.db.Query(ctx, queryFn)
-		for _, doc := range docs {
-			// Check if context is cancelled
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				// Continue processing
-			}
+// Helper function: convert an event to a document
+func eventToDoc(event *nostr.Event) map[string]interface{} {
+	return map[string]interface{}{
+		"_id":            event.ID,
+		"pubkey":         event.PubKey,
+		"created_at":     event.CreatedAt,
+		"kind":           event.Kind,
+		"content":        event.Content,
+		"tags":           event.Tags,
+		"sig":            event.Sig,
+		"doc_type":       DocTypeNostrEvent, // Add document type identifier
+		"schema_version": schemaVersion(DocTypeNostrEvent),
+	}
+}
 
-			// Directly build event object, not via JSON serialization/deserialization
-			docMap, ok := doc.(map[string]interface{})
-			if !ok {
-				log.Printf("无效的文档格式")
-				continue
-			}
+// updateDerivedData updates causality, user statistics and references for a saved event.
+// The access steps are applied right away, the other steps in the background if
+// asynchronous updates are enabled. Writers reserve room in the queue with
+// reserveDerivedRoom before storing their events, and set reserved for the event using it.
+// Failures are logged and don't affect event storage.
+func (a *OrbitDBAdapter) updateDerivedData(ctx context.Context, event *nostr.Event, reserved bool) {
+	a.applyDerivedData(ctx, event, a.accessSteps(), nil)
+	if a.derived != nil {
+		a.derived.enqueue(ctx, event, reserved)
+		return
+	}
+	a.applyDerivedData(ctx, event, a.derivedSteps(), nil)
+}
+
+// QueryEvents returns the events matching filter on an unbuffered channel: the latest
+// filter.Limit newest first if it is set, all of them in store order otherwise. See
+// QueryEventsBuffered for buffering, cancellation and failures of a started scan, and
+// OpenEventCursor for pull-based iteration.
+func (a *OrbitDBAdapter) QueryEvents(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+	return a.QueryEventsBuffered(ctx, filter, 0)
+}
 
-			event := &nostr.Event{}
+// GetEventByID retrieves an event by its ID using the document index instead of a full scan.
+// Returns nil if no event with the ID exists.
+func (a *OrbitDBAdapter) GetEventByID(ctx context.Context, id string) (*nostr.Event, error) {
+	docs, err := a.events.Get(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
 
-			// Set basic fields
-			if id, ok := docMap["_id"].(string); ok {
-				event.ID = id
-			}
-			if pubkey, ok := docMap["pubkey"].(string); ok {
-				event.PubKey = pubkey
-			}
-			if createdAt, ok := docMap["created_at"].(float64); ok {
-				event.CreatedAt = nostr.Timestamp(createdAt)
-			}
-			if kind, ok := docMap["kind"].(float64); ok {
-				event.Kind = int(kind)
-			}
-			if content, ok := docMap["content"].(string); ok {
-				event.Content = content
-			}
-			if sig, ok := docMap["sig"].(string); ok {
-				event.Sig = sig
-			}
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// Only documents of type nostr event, other documents may share the key space
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeNostrEvent {
+			continue
+		}
+		// Expired events are kept until the retention sweep, but no longer served
+		if docExpired(docMap, int64(nostr.Now())) {
+			return nil, nil
+		}
+
+		return docToEvent(docMap), nil
+	}
+
+	return nil, nil
+}
+
+// EventFromDocument builds the event stored in a document, e.g. one decoded from a replicated
+// oplog entry. Returns false for documents that aren't nostr events.
+func EventFromDocument(doc map[string]interface{}) (*nostr.Event, bool) {
+	if docType, _ := doc["doc_type"].(string); docType != DocTypeNostrEvent {
+		return nil, false
+	}
+	return docToEvent(doc), true
+}
+
+// Helper function: build an event from a stored event document
+func docToEvent(docMap map[string]interface{}) *nostr.Event {
+	event := &nostr.Event{}
+
+	// Set basic fields
+	if id, ok := docMap["_id"].(string); ok {
+		event.ID = id
+	}
+	if pubkey, ok := docMap["pubkey"].(string); ok {
+		event.PubKey = pubkey
+	}
+	if createdAt, ok := docInt64(docMap["created_at"]); ok {
+		event.CreatedAt = nostr.Timestamp(createdAt)
+	}
+	if kind, ok := docInt64(docMap["kind"]); ok {
+		event.Kind = int(kind)
+	}
+	if content, ok := docMap["content"].(string); ok {
+		event.Content = content
+	}
+	if sig, ok := docMap["sig"].(string); ok {
+		event.Sig = sig
+	}
 
-			// Process tags
-			if tagsData, ok := docMap["tags"].([]interface{}); ok {
-				for _, tagData := range tagsData {
-					if tagArray, ok := tagData.([]interface{}); ok {
-						var tag nostr.Tag
-						for _, item := range tagArray {
-							if str, ok := item.(string); ok {
-								tag = append(tag, str)
-							}
-						}
-						event.Tags = append(event.Tags, tag)
+	// Process tags
+	if tagsData, ok := docMap["tags"].([]interface{}); ok {
+		for _, tagData := range tagsData {
+			if tagArray, ok := tagData.([]interface{}); ok {
+				var tag nostr.Tag
+				for _, item := range tagArray {
+					if str, ok := item.(string); ok {
+						tag = append(tag, str)
 					}
 				}
-			}
-
-			// Send event to channel
-			select {
-			case <-ctx.Done():
-				return
-			case eventChan <- event:
-				// Event has been sent
+				event.Tags = append(event.Tags, tag)
 			}
 		}
-	}()
+	}
 
-	return eventChan, nil
+	return event
 }
 
 // DeleteEvent deletes an event from the database
@@ -232,94 +445,264 @@ func (a *OrbitDBAdapter) DeleteEvent(ctx context.Context, event *nostr.Event) er
 		return fmt.Errorf("event cannot be nil")
 	}
 
-	_, err := a.db.Delete(ctx, event.ID)
-	return err
+	if _, err := a.db.Delete(ctx, event.ID); err != nil {
+		return err
+	}
+
+	a.removeEventData(ctx, event)
+	return nil
+}
+
+// removeEventData removes the data that belongs to a deleted event. Failures are logged.
+func (a *OrbitDBAdapter) removeEventData(ctx context.Context, event *nostr.Event) {
+	// Annotations are meaningless without their event
+	if err := a.annotationMgr.DeleteAllEventAnnotations(ctx, event.ID); err != nil {
+		zap.L().Warn("Failed to delete event annotations", zap.String("event", event.ID), zap.Error(err))
+	}
+
+	// A subspace loses its metadata with its create event
+	if err := a.subspaceMetaMgr.RemoveEvent(ctx, event); err != nil {
+		zap.L().Warn("Failed to remove subspace metadata", zap.String("event", event.ID), zap.Error(err))
+	}
+
+	// A user loses their profile with its kind 0 event
+	if err := a.userProfileMgr.RemoveEvent(ctx, event); err != nil {
+		zap.L().Warn("Failed to remove user profile", zap.String("event", event.ID), zap.Error(err))
+	}
+
+	// A user stops following with their contact list
+	if err := a.followGraphMgr.RemoveEvent(ctx, event); err != nil {
+		zap.L().Warn("Failed to remove follow list", zap.String("event", event.ID), zap.Error(err))
+	}
+
+	// A deleted mute list unmutes its users
+	if err := a.muteListMgr.RemoveEvent(ctx, event); err != nil {
+		zap.L().Warn("Failed to remove mute list", zap.String("event", event.ID), zap.Error(err))
+	}
+
+	// Deleting a vote lets its author vote again and takes it out of their vote statistics
+	if err := a.userStatsMgr.RemoveVote(ctx, event); err != nil {
+		zap.L().Warn("Failed to remove vote", zap.String("event", event.ID), zap.Error(err))
+	} else if proposalID := voteProposal(event); proposalID != "" {
+		if err := a.proposalMgr.Recount(ctx, proposalID); err != nil {
+			zap.L().Warn("Failed to recount proposal", zap.String("proposal", proposalID), zap.Error(err))
+		}
+	}
 }
 
-// CountEvents implements counting method to match Counter interface
+// CountEvents implements counting method to match Counter interface.
+// It applies the same filtering as QueryEvents, including tags and time bounds.
 func (a *OrbitDBAdapter) CountEvents(ctx context.Context, filter nostr.Filter) (int, error) {
+	exclusion, err := a.QueryExclusion(ctx)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := a.scanContext(ctx, true)
+	defer cancel()
 	count := 0
 
 	queryFn := func(doc interface{}) (bool, error) {
 		event, ok := doc.(map[string]interface{})
-		if !ok {
+		if !ok || !matchesFilter(event, filter) || exclusion.excludesDoc(event) {
 			return false, nil
 		}
 
-		// Implement the same filtering logic as QueryEvents
-		if len(filter.IDs) > 0 {
-			id, ok := event["_id"].(string)
-			if !ok || !contains(filter.IDs, id) {
-				return false, nil
-			}
+		// Count without collecting matched documents
+		count++
+		return false, nil
+	}
+
+	// Execute query count
+	if _, err := queryDocuments(ctx, a.events, queryFn); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// matchesFilter reports whether a stored document is a nostr event matching the filter
+// whose NIP-40 expiration hasn't passed. Expired events stay stored until a retention
+// sweep tombstones them, but aren't served. Limit is not applied here.
+func matchesFilter(event map[string]interface{}, filter nostr.Filter) bool {
+	return matchesEventFilter(event, filter) && !docExpired(event, int64(nostr.Now()))
+}
+
+// matchesEventFilter reports whether a stored document is a nostr event matching the filter,
+// expired or not
+func matchesEventFilter(event map[string]interface{}, filter nostr.Filter) bool {
+	// Only process documents of type nostr event
+	docType, ok := event["doc_type"].(string)
+	if !ok || docType != DocTypeNostrEvent {
+		return false
+	}
+
+	// Implement filtering logic
+	// Note: here it's _id instead of id
+	if len(filter.IDs) > 0 {
+		id, ok := event["_id"].(string)
+		if !ok || !contains(filter.IDs, id) {
+			return false
 		}
+	}
 
-		if len(filter.Authors) > 0 {
-			pubkey, ok := event["pubkey"].(string)
-			if !ok || !contains(filter.Authors, pubkey) {
-				return false, nil
-			}
+	if len(filter.Authors) > 0 {
+		pubkey, ok := event["pubkey"].(string)
+		if !ok || !contains(filter.Authors, pubkey) {
+			return false
 		}
+	}
 
-		if len(filter.Kinds) > 0 {
-			kind, ok := event["kind"].(float64)
-			if !ok || !containsInt(filter.Kinds, int(kind)) {
-				return false, nil
-			}
+	if len(filter.Kinds) > 0 {
+		kind, ok := docInt64(event["kind"])
+		if !ok || !containsInt(filter.Kinds, int(kind)) {
+			return false
 		}
+	}
 
-		count++
-		return true, nil
+	if filter.Since != nil || filter.Until != nil {
+		createdAt, ok := docInt64(event["created_at"])
+		if !ok {
+			return false
+		}
+		if filter.Since != nil && nostr.Timestamp(createdAt) < *filter.Since {
+			return false
+		}
+		if filter.Until != nil && nostr.Timestamp(createdAt) > *filter.Until {
+			return false
+		}
 	}
 
-	// Execute query count
-	a.db.Query(ctx, queryFn)
+	// Check tag filtering conditions
+	if len(filter.Tags) > 0 {
+		tags, ok := event["tags"].([]interface{})
+		if !ok {
+			return false
+		}
 
-	return count, nil
+		// Check each tag filtering condition
+		for tagName, tagValues := range filter.Tags {
+			if len(tagValues) == 0 {
+				continue
+			}
+
+			// Find matching tag in the event
+			found := false
+			for _, tag := range tags {
+				tagArray, ok := tag.([]interface{})
+				if !ok || len(tagArray) < 2 {
+					continue
+				}
+
+				// Single-letter tags are case-sensitive as in NIP-01, so #e doesn't match E tags
+				name, ok := tagArray[0].(string)
+				if !ok || !matchesTagName(name, tagName) {
+					continue
+				}
+
+				value, ok := tagArray[1].(string)
+				if !ok {
+					continue
+				}
+
+				// Check if tag value is in the filtering conditions
+				if contains(tagValues, value) {
+					found = true
+					break
+				}
+			}
+
+			// If no matching tag is found, skip this event
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// MatchesEvent reports whether an event matches the filter like the stored events returned by
+// QueryEvents. Limit is not applied here.
+func MatchesEvent(event *nostr.Event, filter nostr.Filter) bool {
+	if len(filter.IDs) > 0 && !contains(filter.IDs, event.ID) {
+		return false
+	}
+	if len(filter.Authors) > 0 && !contains(filter.Authors, event.PubKey) {
+		return false
+	}
+	if len(filter.Kinds) > 0 && !containsInt(filter.Kinds, event.Kind) {
+		return false
+	}
+	if filter.Since != nil && event.CreatedAt < *filter.Since {
+		return false
+	}
+	if filter.Until != nil && event.CreatedAt > *filter.Until {
+		return false
+	}
+
+	for tagName, tagValues := range filter.Tags {
+		if len(tagValues) == 0 {
+			continue
+		}
+		found := false
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && matchesTagName(tag[0], tagName) && contains(tagValues, tag[1]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
 }
 
-// ReplaceEvent replaces an event in the database
+// ReplaceEvent replaces an event in the database. The event goes through the signature
+// check, the acceptance policies, the causal staleness check and the subspace and vote rules
+// as with SaveEvent, and its derived data is updated the same way, so a replaced event can't
+// bypass bans, write restrictions or the rejection and quarantine of stale events.
 func (a *OrbitDBAdapter) ReplaceEvent(ctx context.Context, event *nostr.Event) error {
 	if event == nil {
 		return fmt.Errorf("event cannot be nil")
 	}
 
-	doc := map[string]interface{}{
-		"_id":        event.ID,
-		"pubkey":     event.PubKey,
-		"created_at": event.CreatedAt,
-		"kind":       event.Kind,
-		"content":    event.Content,
-		"sig":        event.Sig,
-		"tags":       event.Tags,
-		"doc_type":   DocTypeNostrEvent, // Add document type identifier
+	if err := checkSignature(event); err != nil {
+		return err
 	}
-
-	_, err := a.db.Put(ctx, doc)
-
-	if err != nil {
+	if err := a.policies.Check(event); err != nil {
 		return err
 	}
-
-	// Update causality
-	if a.causalityMgr != nil {
-		// Try to update causality, but don't affect event storage
-		if updateErr := a.causalityMgr.UpdateFromEvent(ctx, event); updateErr != nil {
-			log.Printf("Warning: Failed to update causality: %v", updateErr)
-		}
+	if err := checkExpiration(event); err != nil {
+		return err
+	}
+	if err := a.checkAccess(ctx, event); err != nil {
+		return err
+	}
+	if err := a.checkStaleness(ctx, event); err != nil {
+		return err
+	}
+	if err := a.reserveDerivedRoom(ctx); err != nil {
+		return err
 	}
 
-	// Update user statistics
-	if a.userStatsMgr != nil {
-		// Try to update user statistics, but don't affect event storage
-		if updateErr := a.userStatsMgr.UpdateUserStatsFromEvent(ctx, event); updateErr != nil {
-			log.Printf("Warning: Failed to update user statistics: %v", updateErr)
-		}
+	if _, err := a.db.Put(ctx, eventToDoc(event)); err != nil {
+		a.releaseDerivedRoom()
+		return err
 	}
 
+	a.updateDerivedData(ctx, event, true)
 	return nil
 }
 
+// Helper function: check if an event tag name matches a filter tag name. Single-letter
+// names are compared exactly, longer names like sid case-insensitively.
+func matchesTagName(name, tagName string) bool {
+	if len(tagName) == 1 {
+		return name == tagName
+	}
+	return strings.EqualFold(name, tagName)
+}
+
 // Helper function: check if a slice contains a string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -332,12 +715,33 @@ func contains(slice []string, item string) bool {
 
 // GetSubspaceCausality retrieves causality data for a subspace
 func (a *OrbitDBAdapter) GetSubspaceCausality(ctx context.Context, subspaceID string) (*SubspaceCausality, error) {
-	return a.causalityMgr.GetSubspaceCausality(ctx, subspaceID)
+	if causality, ok := a.cache.getCausality(subspaceID); ok {
+		return causality, nil
+	}
+
+	causality, err := a.causalityMgr.GetSubspaceCausality(ctx, subspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.causalityMgr.listRecentEvents(ctx, causality); err != nil {
+		return nil, err
+	}
+	a.cache.putCausality(subspaceID, causality)
+	return causality, nil
 }
 
 // QuerySubspaces queries subspaces based on conditions
 func (a *OrbitDBAdapter) QuerySubspaces(ctx context.Context, filter func(*SubspaceCausality) bool) ([]*SubspaceCausality, error) {
-	return a.causalityMgr.QuerySubspaces(ctx, filter)
+	subspaces, err := a.causalityMgr.QuerySubspaces(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, causality := range subspaces {
+		if err := a.causalityMgr.listRecentEvents(ctx, causality); err != nil {
+			return nil, err
+		}
+	}
+	return subspaces, nil
 }
 
 // UpdateFromEvent updates causality relationships from an event
@@ -350,6 +754,11 @@ func (a *OrbitDBAdapter) GetCausalityEvents(ctx context.Context, subspaceID stri
 	return a.causalityMgr.GetCausalityEvents(ctx, subspaceID)
 }
 
+// GetCausalityEventsPage retrieves a page of the event IDs of a subspace and the cursor of the next page
+func (a *OrbitDBAdapter) GetCausalityEventsPage(ctx context.Context, subspaceID, cursor string, limit int) ([]string, string, error) {
+	return a.causalityMgr.GetCausalityEventsPage(ctx, subspaceID, cursor, limit)
+}
+
 // GetCausalityKey retrieves a specific causality key for a specific subspace
 func (a *OrbitDBAdapter) GetCausalityKey(ctx context.Context, subspaceID string, keyID uint32) (uint64, error) {
 	return a.causalityMgr.GetCausalityKey(ctx, subspaceID, keyID)
@@ -360,14 +769,53 @@ func (a *OrbitDBAdapter) GetAllCausalityKeys(ctx context.Context, subspaceID str
 	return a.causalityMgr.GetAllCausalityKeys(ctx, subspaceID)
 }
 
+// ListCausalityKeys retrieves all causality keys of a subspace with their metadata
+func (a *OrbitDBAdapter) ListCausalityKeys(ctx context.Context, subspaceID string) ([]*CausalityKey, error) {
+	return a.causalityMgr.ListCausalityKeys(ctx, subspaceID)
+}
+
+// GetEventXrefs retrieves the cross-subspace references of an event
+func (a *OrbitDBAdapter) GetEventXrefs(ctx context.Context, eventID string) (*EventXrefs, error) {
+	return a.xrefMgr.GetEventXrefs(ctx, eventID)
+}
+
+// GetEventThread reconstructs the reply tree containing an event, its scans bounded by the query timeout
+func (a *OrbitDBAdapter) GetEventThread(ctx context.Context, eventID string, depth int) (*EventThread, error) {
+	ctx, cancel := a.scanContext(ctx, false)
+	defer cancel()
+	return a.getEventThread(ctx, eventID, depth)
+}
+
+// GetLeaderboard retrieves the global leaderboard, or the leaderboard of a subspace
+func (a *OrbitDBAdapter) GetLeaderboard(ctx context.Context, subspaceID string) (*Leaderboard, error) {
+	if leaderboard, ok := a.cache.getLeaderboard(subspaceID); ok {
+		return leaderboard, nil
+	}
+
+	leaderboard, err := a.leaderboardMgr.GetLeaderboard(ctx, subspaceID)
+	if err != nil {
+		return nil, err
+	}
+	a.cache.putLeaderboard(subspaceID, leaderboard)
+	return leaderboard, nil
+}
+
 // GetUserStats retrieves user statistics
 func (a *OrbitDBAdapter) GetUserStats(ctx context.Context, userID string) (*UserStats, error) {
 	return a.userStatsMgr.GetUserStats(ctx, userID)
 }
 
-// QueryUsersBySubspace queries all users in a specific subspace
-func (a *OrbitDBAdapter) QueryUsersBySubspace(ctx context.Context, subspaceID string) ([]*UserStats, error) {
-	return a.userStatsMgr.QueryUsersBySubspace(ctx, subspaceID)
+// GetUserStatsBatch retrieves the statistics of several users, by user ID
+func (a *OrbitDBAdapter) GetUserStatsBatch(ctx context.Context, userIDs []string) (map[string]*UserStats, error) {
+	return a.userStatsMgr.GetUserStatsBatch(ctx, userIDs)
+}
+
+// QueryUsersBySubspace queries a page of the users in a specific subspace
+func (a *OrbitDBAdapter) QueryUsersBySubspace(ctx context.Context, subspaceID string, query SubspaceUserQuery) ([]*UserStats, string, error) {
+	// A partial page would make the next cursor skip users
+	ctx, cancel := a.scanContext(ctx, false)
+	defer cancel()
+	return a.userStatsMgr.QueryUsersBySubspace(ctx, subspaceID, query)
 }
 
 // QueryUserStats queries user statistics based on conditions
@@ -384,3 +832,109 @@ func containsInt(slice []int, item int) bool {
 	}
 	return false
 }
+
+// GetUsage retrieves the API usage of a key on a day
+func (a *OrbitDBAdapter) GetUsage(ctx context.Context, day, keyID string) (*APIUsage, error) {
+	return a.usageMgr.GetUsage(ctx, day, keyID)
+}
+
+// AddUsage adds usage counters to the stored daily usage of a key
+func (a *OrbitDBAdapter) AddUsage(ctx context.Context, delta *APIUsage) error {
+	return a.usageMgr.AddUsage(ctx, delta)
+}
+
+// QueryUsage queries API usage within a day range
+func (a *OrbitDBAdapter) QueryUsage(ctx context.Context, from, to, keyID string) ([]*APIUsage, error) {
+	return a.usageMgr.QueryUsage(ctx, from, to, keyID)
+}
+
+// GetEventAnnotations retrieves the annotations of an event
+func (a *OrbitDBAdapter) GetEventAnnotations(ctx context.Context, eventID string) ([]*EventAnnotation, error) {
+	return a.annotationMgr.GetEventAnnotations(ctx, eventID)
+}
+
+// AddEventAnnotation adds an annotation to an event
+func (a *OrbitDBAdapter) AddEventAnnotation(ctx context.Context, eventID string, annotation *EventAnnotation) error {
+	return a.annotationMgr.AddEventAnnotation(ctx, eventID, annotation)
+}
+
+// DeleteEventAnnotation removes an annotation of an event
+func (a *OrbitDBAdapter) DeleteEventAnnotation(ctx context.Context, eventID, annotationID string) (bool, error) {
+	return a.annotationMgr.DeleteEventAnnotation(ctx, eventID, annotationID)
+}
+
+// ListSubspaceWebhooks retrieves the webhooks registered for a subspace
+func (a *OrbitDBAdapter) ListSubspaceWebhooks(ctx context.Context, subspaceID string) ([]*SubspaceWebhook, error) {
+	return a.webhookMgr.ListSubspaceWebhooks(ctx, subspaceID)
+}
+
+// AddSubspaceWebhook registers a webhook for a subspace
+func (a *OrbitDBAdapter) AddSubspaceWebhook(ctx context.Context, subspaceID string, webhook *SubspaceWebhook) error {
+	return a.webhookMgr.AddSubspaceWebhook(ctx, subspaceID, webhook)
+}
+
+// DeleteSubspaceWebhook removes a webhook of a subspace
+func (a *OrbitDBAdapter) DeleteSubspaceWebhook(ctx context.Context, subspaceID, webhookID string) (bool, error) {
+	return a.webhookMgr.DeleteSubspaceWebhook(ctx, subspaceID, webhookID)
+}
+
+// ListWebhookSubscriptions retrieves every webhook subscription
+func (a *OrbitDBAdapter) ListWebhookSubscriptions(ctx context.Context) ([]*WebhookSubscription, error) {
+	return a.subscriptionMgr.ListWebhookSubscriptions(ctx)
+}
+
+// AddWebhookSubscription registers a webhook subscription
+func (a *OrbitDBAdapter) AddWebhookSubscription(ctx context.Context, subscription *WebhookSubscription) error {
+	return a.subscriptionMgr.AddWebhookSubscription(ctx, subscription)
+}
+
+// DeleteWebhookSubscription removes a webhook subscription
+func (a *OrbitDBAdapter) DeleteWebhookSubscription(ctx context.Context, subscriptionID string) (bool, error) {
+	return a.subscriptionMgr.DeleteWebhookSubscription(ctx, subscriptionID)
+}
+
+// migration returns the migration store if the adapter is running a migration
+func (a *OrbitDBAdapter) migration() (*MigrationStore, error) {
+	m, ok := a.db.(*MigrationStore)
+	if !ok {
+		return nil, ErrNoMigration
+	}
+	return m, nil
+}
+
+// GetMigrationStatus returns the status of the running migration
+func (a *OrbitDBAdapter) GetMigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	m, err := a.migration()
+	if err != nil {
+		return nil, err
+	}
+	status := m.Status()
+	return &status, nil
+}
+
+// StartMigrationBackfill starts copying history into the new store of the running migration
+func (a *OrbitDBAdapter) StartMigrationBackfill(ctx context.Context) error {
+	m, err := a.migration()
+	if err != nil {
+		return err
+	}
+	return m.StartBackfill()
+}
+
+// FlipMigration switches reads of the running migration to the new store
+func (a *OrbitDBAdapter) FlipMigration(ctx context.Context) error {
+	m, err := a.migration()
+	if err != nil {
+		return err
+	}
+	return m.Flip()
+}
+
+// ReplicationBacklog returns the number of entries queued for replication from peers
+func (a *OrbitDBAdapter) ReplicationBacklog() int {
+	r := a.db.Replicator()
+	if r == nil {
+		return 0
+	}
+	return len(r.GetQueue())
+}
@@ -2,6 +2,8 @@ package orbitdb
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"testing"
 	"time"
 
@@ -20,6 +22,7 @@ import (
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
@@ -31,7 +34,8 @@ type MockDocumentStore struct {
 
 func (m *MockDocumentStore) Put(ctx context.Context, doc interface{}) (operation.Operation, error) {
 	args := m.Called(ctx, doc)
-	return args.Get(0).(operation.Operation), args.Error(1)
+	op, _ := args.Get(0).(operation.Operation)
+	return op, args.Error(1)
 }
 
 func (m *MockDocumentStore) Get(ctx context.Context, key string, opts *iface.DocumentStoreGetOptions) ([]interface{}, error) {
@@ -41,7 +45,8 @@ func (m *MockDocumentStore) Get(ctx context.Context, key string, opts *iface.Doc
 
 func (m *MockDocumentStore) Delete(ctx context.Context, key string) (operation.Operation, error) {
 	args := m.Called(ctx, key)
-	return args.Get(0).(operation.Operation), args.Error(1)
+	op, _ := args.Get(0).(operation.Operation)
+	return op, args.Error(1)
 }
 
 func (m *MockDocumentStore) Query(ctx context.Context, queryFn func(doc interface{}) (bool, error)) ([]interface{}, error) {
@@ -143,12 +148,14 @@ func (m *MockDocumentStore) OpLog() ipfslog.Log {
 
 func (m *MockDocumentStore) PutAll(ctx context.Context, docs []interface{}) (operation.Operation, error) {
 	args := m.Called(ctx, docs)
-	return args.Get(0).(operation.Operation), args.Error(1)
+	op, _ := args.Get(0).(operation.Operation)
+	return op, args.Error(1)
 }
 
 func (m *MockDocumentStore) PutBatch(ctx context.Context, docs []interface{}) (operation.Operation, error) {
 	args := m.Called(ctx, docs)
-	return args.Get(0).(operation.Operation), args.Error(1)
+	op, _ := args.Get(0).(operation.Operation)
+	return op, args.Error(1)
 }
 
 func (m *MockDocumentStore) ReplicationStatus() replicator.ReplicationInfo {
@@ -185,6 +192,26 @@ func (m *MockDocumentStore) UnsubscribeAll() {
 	m.Called()
 }
 
+// Helper function: the private key of a named test user. Keys are derived from the name, so
+// a user has the same public key in every test.
+func testKey(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+// Helper function: the public key of a named test user
+func testPubKey(name string) string {
+	pubKey, _ := nostr.GetPublicKey(testKey(name))
+	return pubKey
+}
+
+// Helper function: sign an event as a named test user, setting its public key and ID
+func signAs(t testing.TB, name string, event *nostr.Event) *nostr.Event {
+	t.Helper()
+	require.NoError(t, event.Sign(testKey(name)))
+	return event
+}
+
 // Test timestamp filtering functionality
 func TestQueryEventsWithTimestampFilter(t *testing.T) {
 	// Create mock store
@@ -206,8 +233,13 @@ func TestQueryEventsWithTimestampFilter(t *testing.T) {
 		"doc_type":   DocTypeNostrEvent,
 	}
 
-	// Set up mock behavior
-	mockDB.On("Query", mock.Anything, mock.Anything).Return([]interface{}{event1, event2}, nil)
+	// Set up mock behavior; the scan passes every document to the query function
+	mockDB.On("Query", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		queryFn := args.Get(1).(func(doc interface{}) (bool, error))
+		for _, doc := range []interface{}{event1, event2} {
+			queryFn(doc)
+		}
+	}).Return([]interface{}{}, nil)
 
 	// Test cases
 	tests := []struct {
@@ -297,14 +329,16 @@ func TestSaveEvent(t *testing.T) {
 	adapter := NewOrbitDBAdapter(mockDB)
 
 	// Create test event
-	event := &nostr.Event{
-		ID:        "test-event",
+	event := signAs(t, "author", &nostr.Event{
 		CreatedAt: nostr.Now(),
 		Content:   "test content",
-	}
+	})
 
-	// Set up mock behavior
+	// Set up mock behavior; derived data lookups find nothing
 	mockDB.On("Put", mock.Anything, mock.Anything).Return("test-event", nil)
+	mockDB.On("PutAll", mock.Anything, mock.Anything).Return(nil, nil)
+	mockDB.On("Get", mock.Anything, mock.Anything, mock.Anything).Return([]interface{}{}, nil)
+	mockDB.On("Query", mock.Anything, mock.Anything).Return([]interface{}{}, nil)
 
 	// Execute saving
 	err := adapter.SaveEvent(context.Background(), event)
@@ -312,6 +346,63 @@ func TestSaveEvent(t *testing.T) {
 	mockDB.AssertExpectations(t)
 }
 
+// Test that events already stored or tombstoned are accepted without another write
+func TestSaveEventDuplicate(t *testing.T) {
+	mockDB := new(MockDocumentStore)
+	adapter := NewOrbitDBAdapter(mockDB)
+
+	stored := signAs(t, "author", &nostr.Event{CreatedAt: nostr.Now(), Content: "stored"})
+	purged := signAs(t, "author", &nostr.Event{CreatedAt: nostr.Now(), Content: "purged"})
+	mockDB.On("Get", mock.Anything, stored.ID, mock.Anything).Return([]interface{}{
+		map[string]interface{}{"_id": stored.ID, "doc_type": DocTypeNostrEvent},
+	}, nil)
+	mockDB.On("Get", mock.Anything, purged.ID, mock.Anything).Return([]interface{}{
+		map[string]interface{}{"_id": purged.ID, "doc_type": DocTypeEventTombstone},
+	}, nil)
+
+	for _, event := range []*nostr.Event{stored, purged} {
+		assert.NoError(t, adapter.SaveEvent(context.Background(), event), event.Content)
+	}
+	mockDB.AssertNotCalled(t, "Put", mock.Anything, mock.Anything)
+
+	// A batch writes its new events once
+	fresh := signAs(t, "author", &nostr.Event{CreatedAt: nostr.Now(), Content: "new"})
+	mockDB.On("Get", mock.Anything, mock.Anything, mock.Anything).Return([]interface{}{}, nil)
+	mockDB.On("Query", mock.Anything, mock.Anything).Return([]interface{}{}, nil)
+	mockDB.On("Put", mock.Anything, mock.Anything).Return("", nil)
+	mockDB.On("PutAll", mock.Anything, mock.Anything).Return(nil, nil)
+	mockDB.On("PutBatch", mock.Anything, mock.MatchedBy(func(batch []interface{}) bool {
+		return len(batch) == 1 && batch[0].(map[string]interface{})["_id"] == fresh.ID
+	})).Return(nil, nil).Once()
+
+	err := adapter.SaveEvents(context.Background(), []*nostr.Event{stored, fresh, fresh})
+	assert.NoError(t, err)
+	mockDB.AssertExpectations(t)
+}
+
+// Test that events whose ID or signature doesn't check out are refused before any lookup
+func TestSaveEventSignature(t *testing.T) {
+	mockDB := new(MockDocumentStore)
+	adapter := NewOrbitDBAdapter(mockDB)
+	ctx := context.Background()
+
+	unsigned := &nostr.Event{ID: "unsigned", PubKey: testPubKey("author"), CreatedAt: nostr.Now(), Kind: 1}
+	forged := signAs(t, "author", &nostr.Event{CreatedAt: nostr.Now(), Kind: 1, Content: "hello"})
+	forged.PubKey = testPubKey("victim")
+	altered := signAs(t, "author", &nostr.Event{CreatedAt: nostr.Now(), Kind: 1, Content: "hello"})
+	altered.Content = "goodbye"
+	renamed := signAs(t, "author", &nostr.Event{CreatedAt: nostr.Now(), Kind: 1, Content: "hello"})
+	renamed.ID = "renamed"
+
+	for name, event := range map[string]*nostr.Event{"unsigned": unsigned, "forged": forged, "altered": altered, "renamed": renamed} {
+		assert.ErrorIs(t, adapter.SaveEvent(ctx, event), ErrEventRejected, name)
+		assert.ErrorIs(t, adapter.SaveEvents(ctx, []*nostr.Event{event}), ErrEventRejected, name)
+		assert.ErrorIs(t, adapter.ReplaceEvent(ctx, event), ErrEventRejected, name)
+	}
+	// The mock has no expectations, nothing was read or written
+	mockDB.AssertExpectations(t)
+}
+
 // Test deleting event
 func TestDeleteEvent(t *testing.T) {
 	mockDB := new(MockDocumentStore)
@@ -326,9 +417,128 @@ func TestDeleteEvent(t *testing.T) {
 
 	// Set up mock behavior
 	mockDB.On("Delete", mock.Anything, "test-event").Return("test-event", nil)
+	// The event has no annotations to delete
+	mockDB.On("Get", mock.Anything, "event_annotations:test-event", mock.Anything).Return([]interface{}{}, nil)
+	// The event has kind 0, its author has no stored profile
+	mockDB.On("Get", mock.Anything, userProfileDocID(""), mock.Anything).Return([]interface{}{}, nil)
 
 	// Execute deleting
 	err := adapter.DeleteEvent(context.Background(), event)
 	assert.NoError(t, err)
 	mockDB.AssertExpectations(t)
 }
+
+// Test getting an event by ID through the document index
+func TestGetEventByID(t *testing.T) {
+	mockDB := new(MockDocumentStore)
+	adapter := NewOrbitDBAdapter(mockDB)
+
+	// Set up mock behavior
+	mockDB.On("Get", mock.Anything, "test-event", mock.Anything).Return([]interface{}{
+		map[string]interface{}{
+			"_id":        "test-event",
+			"pubkey":     "test-pubkey",
+			"created_at": float64(1700000000),
+			"kind":       float64(1),
+			"content":    "test content",
+			"tags":       []interface{}{[]interface{}{"sid", "test-subspace"}},
+			"doc_type":   DocTypeNostrEvent,
+		},
+	}, nil)
+	mockDB.On("Get", mock.Anything, "missing-event", mock.Anything).Return([]interface{}{}, nil)
+
+	// Execute query
+	event, err := adapter.GetEventByID(context.Background(), "test-event")
+	assert.NoError(t, err)
+	assert.Equal(t, "test-event", event.ID)
+	assert.Equal(t, "test-pubkey", event.PubKey)
+	assert.Equal(t, nostr.Timestamp(1700000000), event.CreatedAt)
+	assert.Equal(t, "test content", event.Content)
+	assert.Equal(t, nostr.Tags{{"sid", "test-subspace"}}, event.Tags)
+
+	event, err = adapter.GetEventByID(context.Background(), "missing-event")
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+}
+
+// Test counting events with tag and time bounds
+func TestCountEvents(t *testing.T) {
+	mockDB := new(MockDocumentStore)
+	adapter := NewOrbitDBAdapter(mockDB)
+
+	now := time.Now().Unix()
+	docs := []interface{}{
+		map[string]interface{}{
+			"_id":        "event1",
+			"created_at": float64(now - 3600),
+			"kind":       float64(30300),
+			"tags":       []interface{}{[]interface{}{"sid", "subspace-a"}},
+			"doc_type":   DocTypeNostrEvent,
+		},
+		map[string]interface{}{
+			"_id":        "event2",
+			"created_at": float64(now),
+			"kind":       float64(30300),
+			"tags":       []interface{}{[]interface{}{"sid", "subspace-a"}},
+			"doc_type":   DocTypeNostrEvent,
+		},
+		map[string]interface{}{
+			"_id":        "event3",
+			"created_at": float64(now),
+			"kind":       float64(30300),
+			"tags":       []interface{}{[]interface{}{"sid", "subspace-b"}},
+			"doc_type":   DocTypeNostrEvent,
+		},
+		map[string]interface{}{
+			"_id":      "subspace-a",
+			"doc_type": DocTypeCausality,
+		},
+	}
+
+	// Run the query function against every document like the docstore does
+	mockDB.On("Query", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		queryFn := args.Get(1).(func(doc interface{}) (bool, error))
+		for _, doc := range docs {
+			queryFn(doc)
+		}
+	}).Return([]interface{}{}, nil)
+
+	since := nostr.Timestamp(now - 60)
+	tests := []struct {
+		name     string
+		filter   nostr.Filter
+		expected int
+	}{
+		{"all events", nostr.Filter{}, 3},
+		{"sid tag", nostr.Filter{Tags: nostr.TagMap{"sid": []string{"subspace-a"}}}, 2},
+		{"sid tag and since", nostr.Filter{Tags: nostr.TagMap{"sid": []string{"subspace-a"}}, Since: &since}, 1},
+		{"until", nostr.Filter{Until: &since}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := adapter.CountEvents(context.Background(), tt.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, count)
+		})
+	}
+}
+
+// Test that single-letter tag filters are case-sensitive and longer ones aren't
+func TestMatchesFilterTagNames(t *testing.T) {
+	event := map[string]interface{}{
+		"_id":  "event1",
+		"kind": float64(1),
+		"tags": []interface{}{
+			[]interface{}{"E", "root"},
+			[]interface{}{"t", "nostr"},
+			[]interface{}{"SID", "subspace-a"},
+		},
+		"doc_type": DocTypeNostrEvent,
+	}
+
+	assert.True(t, matchesFilter(event, nostr.Filter{Tags: nostr.TagMap{"t": {"nostr", "other"}}}))
+	assert.False(t, matchesFilter(event, nostr.Filter{Tags: nostr.TagMap{"e": {"root"}}}))
+	assert.True(t, matchesFilter(event, nostr.Filter{Tags: nostr.TagMap{"E": {"root"}}}))
+	assert.True(t, matchesFilter(event, nostr.Filter{Tags: nostr.TagMap{"sid": {"subspace-a"}}}))
+}
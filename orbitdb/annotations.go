@@ -0,0 +1,192 @@
+package orbitdb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeEventAnnotations identifies the annotation documents of events
+const DocTypeEventAnnotations = "event_annotations"
+
+// Annotation types
+const (
+	AnnotationModerationLabel   = "moderation_label"
+	AnnotationVerificationBadge = "verification_badge"
+	AnnotationProcessingError   = "processing_error"
+)
+
+// AnnotationTypes lists all annotation types
+var AnnotationTypes = []string{AnnotationModerationLabel, AnnotationVerificationBadge, AnnotationProcessingError}
+
+// EventAnnotation is a server-side note about an event, kept apart from the signed event
+type EventAnnotation struct {
+	ID      string `json:"id"`               // Annotation ID
+	Type    string `json:"type"`             // Annotation type, see AnnotationTypes
+	Value   string `json:"value"`            // Label, badge name or error message
+	Source  string `json:"source,omitempty"` // Moderator or service that added the annotation
+	Author  string `json:"author,omitempty"` // Public key that signed the request adding the annotation
+	Created int64  `json:"created"`          // Creation timestamp
+}
+
+// EventAnnotations holds all annotations of an event in one document
+type EventAnnotations struct {
+	ID          string             `json:"id"`          // Document ID, format: event_annotations:<event id>
+	DocType     string             `json:"doc_type"`    // Document type, fixed as "event_annotations"
+	EventID     string             `json:"event_id"`    // Annotated event ID
+	Annotations []*EventAnnotation `json:"annotations"` // Annotations, oldest first
+	Updated     int64              `json:"updated"`     // Update timestamp
+}
+
+// AnnotationManager manages event annotation documents
+type AnnotationManager struct {
+	db iface.DocumentStore
+}
+
+// NewAnnotationManager creates a new AnnotationManager
+func NewAnnotationManager(db iface.DocumentStore) *AnnotationManager {
+	return &AnnotationManager{db: db}
+}
+
+// annotationsDocID returns the document key of an event's annotations, keeping it apart from the event itself
+func annotationsDocID(eventID string) string {
+	return DocTypeEventAnnotations + ":" + eventID
+}
+
+// IsAnnotationType reports whether annotationType is a known annotation type
+func IsAnnotationType(annotationType string) bool {
+	for _, known := range AnnotationTypes {
+		if annotationType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// GetEventAnnotations retrieves the annotations of an event, empty if it has none
+func (am *AnnotationManager) GetEventAnnotations(ctx context.Context, eventID string) ([]*EventAnnotation, error) {
+	annotations, err := am.getEventAnnotations(ctx, eventID)
+	if err != nil || annotations == nil {
+		return nil, err
+	}
+	return annotations.Annotations, nil
+}
+
+// AddEventAnnotation adds an annotation to an event, assigning its ID and creation time
+func (am *AnnotationManager) AddEventAnnotation(ctx context.Context, eventID string, annotation *EventAnnotation) error {
+	if annotation == nil {
+		return fmt.Errorf("annotation cannot be nil")
+	}
+	if !IsAnnotationType(annotation.Type) {
+		return fmt.Errorf("unknown annotation type: %s", annotation.Type)
+	}
+	if annotation.Value == "" {
+		return fmt.Errorf("annotation value cannot be empty")
+	}
+
+	annotations, err := am.getEventAnnotations(ctx, eventID)
+	if err != nil {
+		return err
+	}
+	if annotations == nil {
+		annotations = &EventAnnotations{
+			ID:      annotationsDocID(eventID),
+			DocType: DocTypeEventAnnotations,
+			EventID: eventID,
+		}
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	annotation.ID = hex.EncodeToString(id)
+	annotation.Created = int64(nostr.Now())
+
+	annotations.Annotations = append(annotations.Annotations, annotation)
+	return am.saveEventAnnotations(ctx, annotations)
+}
+
+// DeleteEventAnnotation removes an annotation of an event. Returns false if it doesn't exist.
+func (am *AnnotationManager) DeleteEventAnnotation(ctx context.Context, eventID, annotationID string) (bool, error) {
+	annotations, err := am.getEventAnnotations(ctx, eventID)
+	if err != nil || annotations == nil {
+		return false, err
+	}
+
+	for i, annotation := range annotations.Annotations {
+		if annotation.ID == annotationID {
+			annotations.Annotations = append(annotations.Annotations[:i], annotations.Annotations[i+1:]...)
+			return true, am.saveEventAnnotations(ctx, annotations)
+		}
+	}
+	return false, nil
+}
+
+// DeleteAllEventAnnotations removes the annotation document of an event, if any
+func (am *AnnotationManager) DeleteAllEventAnnotations(ctx context.Context, eventID string) error {
+	annotations, err := am.getEventAnnotations(ctx, eventID)
+	if err != nil || annotations == nil {
+		return err
+	}
+
+	_, err = am.db.Delete(ctx, annotations.ID)
+	return err
+}
+
+// getEventAnnotations retrieves the annotation document of an event, nil if none exists
+func (am *AnnotationManager) getEventAnnotations(ctx context.Context, eventID string) (*EventAnnotations, error) {
+	docs, err := am.db.Get(ctx, annotationsDocID(eventID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeEventAnnotations {
+			continue
+		}
+
+		// Convert document to JSON and parse into struct
+		jsonData, err := json.Marshal(docMap)
+		if err != nil {
+			return nil, err
+		}
+
+		var annotations EventAnnotations
+		if err := json.Unmarshal(jsonData, &annotations); err != nil {
+			return nil, err
+		}
+		return &annotations, nil
+	}
+
+	return nil, nil
+}
+
+// saveEventAnnotations saves the annotation document of an event
+func (am *AnnotationManager) saveEventAnnotations(ctx context.Context, annotations *EventAnnotations) error {
+	annotations.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            annotations.ID,
+		"id":             annotations.ID,
+		"doc_type":       DocTypeEventAnnotations,
+		"schema_version": schemaVersion(DocTypeEventAnnotations),
+		"event_id":       annotations.EventID,
+		"annotations":    annotations.Annotations,
+		"updated":        annotations.Updated,
+	}
+
+	_, err := am.db.Put(ctx, doc)
+	return err
+}
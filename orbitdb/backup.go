@@ -0,0 +1,168 @@
+package orbitdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Backup archive format. An archive is JSONL: a header line followed by one
+// document per line, including derived causality and user statistics documents.
+const (
+	BackupFormat  = "crelay-docstore-backup"
+	BackupVersion = 1
+)
+
+// restoreBatchSize is the number of documents written per PutBatch during restore
+const restoreBatchSize = 100
+
+// maxBackupLineSize is the maximum size of one archive line
+const maxBackupLineSize = 64 * 1024 * 1024
+
+// BackupHeader is the first line of a backup archive
+type BackupHeader struct {
+	Format    string `json:"format"`    // Always BackupFormat
+	Version   int    `json:"version"`   // Archive format version
+	Created   int64  `json:"created"`   // Creation timestamp
+	Address   string `json:"address"`   // Address of the source database
+	Documents int    `json:"documents"` // Number of documents in the archive
+}
+
+// Backup writes every document of the store to w as a JSONL archive, ordered by key
+func (a *OrbitDBAdapter) Backup(ctx context.Context, w io.Writer) (int, error) {
+	docs, err := queryDocuments(ctx, a.db, func(doc interface{}) (bool, error) {
+		_, ok := doc.(map[string]interface{})
+		return ok, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sort.Slice(docs, func(i, j int) bool {
+		return backupKey(docs[i]) < backupKey(docs[j])
+	})
+
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+
+	header := BackupHeader{
+		Format:    BackupFormat,
+		Version:   BackupVersion,
+		Created:   time.Now().Unix(),
+		Address:   a.db.Address().String(),
+		Documents: len(docs),
+	}
+	if err := encoder.Encode(header); err != nil {
+		return 0, err
+	}
+
+	for i, doc := range docs {
+		select {
+		case <-ctx.Done():
+			return i, ctx.Err()
+		default:
+		}
+
+		if err := encoder.Encode(doc); err != nil {
+			return i, err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return len(docs), err
+	}
+
+	return len(docs), nil
+}
+
+// Restore writes the documents of a JSONL archive into the store. Existing
+// documents with the same key are overwritten.
+func (a *OrbitDBAdapter) Restore(ctx context.Context, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBackupLineSize)
+
+	// Validate header
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("empty backup archive")
+	}
+	var header BackupHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return 0, fmt.Errorf("invalid backup header: %w", err)
+	}
+	if header.Format != BackupFormat {
+		return 0, fmt.Errorf("unsupported backup format: %s", header.Format)
+	}
+	if header.Version > BackupVersion {
+		return 0, fmt.Errorf("unsupported backup version: %d", header.Version)
+	}
+
+	// Restored documents replace cached ones
+	defer a.cache.clear()
+
+	restored := 0
+	batch := make([]interface{}, 0, restoreBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := a.db.PutBatch(ctx, batch); err != nil {
+			return err
+		}
+		restored += len(batch)
+		batch = make([]interface{}, 0, restoreBatchSize)
+		return nil
+	}
+
+	line := 1
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		// Keep numbers as written so large counters are restored exactly
+		var doc map[string]interface{}
+		if err := decodeJSON(scanner.Bytes(), &doc); err != nil {
+			return restored, fmt.Errorf("invalid document on line %d: %w", line, err)
+		}
+		if key, ok := doc["_id"].(string); !ok || key == "" {
+			return restored, fmt.Errorf("document on line %d has no _id", line)
+		}
+
+		batch = append(batch, doc)
+		if len(batch) >= restoreBatchSize {
+			if err := flush(); err != nil {
+				return restored, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return restored, err
+	}
+
+	if err := flush(); err != nil {
+		return restored, err
+	}
+
+	if header.Documents > 0 && restored != header.Documents {
+		return restored, fmt.Errorf("archive is incomplete: restored %d of %d documents", restored, header.Documents)
+	}
+
+	return restored, nil
+}
+
+// Helper function: get the key of a document for ordering
+func backupKey(doc interface{}) string {
+	if docMap, ok := doc.(map[string]interface{}); ok {
+		key, _ := docMap["_id"].(string)
+		return key
+	}
+	return ""
+}
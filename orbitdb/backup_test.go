@@ -0,0 +1,51 @@
+package orbitdb
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that a backup archive restores every document into a fresh store
+func TestBackupAndRestore(t *testing.T) {
+	sourceDB := newMockStoreWithAddress(t, "source")
+	source := NewOrbitDBAdapter(sourceDB)
+
+	docs := []interface{}{
+		map[string]interface{}{"_id": "event-b", "doc_type": DocTypeNostrEvent, "kind": float64(1)},
+		map[string]interface{}{"_id": "event-a", "doc_type": DocTypeNostrEvent, "kind": float64(1)},
+		map[string]interface{}{"_id": "user_stats:pubkey", "doc_type": "user_stats"},
+	}
+	sourceDB.On("Query", mock.Anything, mock.Anything).Return(docs, nil)
+
+	var archive bytes.Buffer
+	count, err := source.Backup(context.Background(), &archive)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	lines := strings.Split(strings.TrimSpace(archive.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], BackupFormat)
+	assert.Contains(t, lines[1], "event-a")
+
+	// Restore into a fresh store
+	targetDB := new(MockDocumentStore)
+	target := NewOrbitDBAdapter(targetDB)
+	targetDB.On("PutBatch", mock.Anything, mock.MatchedBy(func(batch []interface{}) bool {
+		return len(batch) == 3
+	})).Return(nil, nil).Once()
+
+	restored, err := target.Restore(context.Background(), &archive)
+	require.NoError(t, err)
+	assert.Equal(t, 3, restored)
+	targetDB.AssertExpectations(t)
+
+	// Archives from other tools are rejected
+	_, err = target.Restore(context.Background(), strings.NewReader(`{"format":"other"}`+"\n"))
+	assert.Error(t, err)
+}
@@ -3,13 +3,15 @@ package orbitdb
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"sort"
 	"strconv"
 	"strings"
 
 	"berty.tech/go-orbit-db/iface"
 	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
 )
 
 // DocumentType is used to distinguish between different types of documents
@@ -18,32 +20,51 @@ const (
 	DocTypeCausality  = "causality"
 )
 
+// ErrSubspaceNotFound is returned for subspaces without a causality record
+var ErrSubspaceNotFound = errors.New("subspace not found")
+
 // CausalityKey represents a causality key
 type CausalityKey struct {
-	Key     uint32 `json:"key"`     // Causality key identifier
-	Counter uint64 `json:"counter"` // Lamport clock counter
+	Key       uint32 `json:"key"`                  // Causality key identifier
+	Label     string `json:"label,omitempty"`      // Operation name declared in the ops tag
+	Counter   uint64 `json:"counter"`              // Lamport clock counter
+	Updated   int64  `json:"updated,omitempty"`    // Last time the counter was advanced
+	LastEvent string `json:"last_event,omitempty"` // ID of the event that last advanced the counter
+}
+
+// CausalityKeyMeta holds bookkeeping data for a causality key
+type CausalityKeyMeta struct {
+	Label     string `json:"label,omitempty"`      // Operation name declared in the ops tag
+	Updated   int64  `json:"updated,omitempty"`    // Last time the counter was advanced
+	LastEvent string `json:"last_event,omitempty"` // ID of the event that last advanced the counter
 }
 
 // SubspaceCausality represents causality data for a subspace
 type SubspaceCausality struct {
-	ID         string            `json:"id"`          // Subspace ID, format: 0x-prefixed 64-bit hex string
-	DocType    string            `json:"doc_type"`    // Document type, here it's "causality"
-	SubspaceID string            `json:"subspace_id"` // Alternative representation of subspace ID (if needed)
-	Keys       map[uint32]uint64 `json:"keys"`        // Keys are causality key IDs, values are counters
-	Events     []string          `json:"events"`      // List of associated event IDs
-	Created    int64             `json:"created"`     // Creation timestamp
-	Updated    int64             `json:"updated"`     // Update timestamp
+	ID         string                       `json:"id"`                 // Subspace ID, format: 0x-prefixed 64-bit hex string
+	DocType    string                       `json:"doc_type"`           // Document type, here it's "causality"
+	SubspaceID string                       `json:"subspace_id"`        // Alternative representation of subspace ID (if needed)
+	Keys       map[uint32]uint64            `json:"keys"`               // Keys are causality key IDs, values are counters
+	KeyMeta    map[uint32]*CausalityKeyMeta `json:"key_meta,omitempty"` // Labels and last-update info for each key
+	Ops        map[string]uint32            `json:"ops,omitempty"`      // Registry mapping op names declared in the ops tag to key IDs
+	Events     []string                     `json:"events"`             // Event IDs of the latest epoch, every event ID in documents written before epochs; see GetCausalityEventsPage
+	EventCount int                          `json:"event_count"`        // Number of event IDs stored in epoch documents
+	Created    int64                        `json:"created"`            // Creation timestamp
+	Updated    int64                        `json:"updated"`            // Update timestamp
 }
 
 // CausalityManager manages causality relationships
 type CausalityManager struct {
-	db iface.DocumentStore
+	db        iface.DocumentStore
+	processed *ProcessedEvents  // Counts each event once
+	counters  CausalityCounters // Store of the key counters, nil to keep them in the documents
 }
 
 // NewCausalityManager creates a new causality manager
 func NewCausalityManager(db iface.DocumentStore) *CausalityManager {
 	return &CausalityManager{
-		db: db,
+		db:        db,
+		processed: NewProcessedEvents(db, DocTypeCausality),
 	}
 }
 
@@ -95,6 +116,9 @@ func (cm *CausalityManager) GetSubspaceCausality(ctx context.Context, subspaceID
 	if err := json.Unmarshal(jsonData, &causality); err != nil {
 		return nil, err
 	}
+	if err := cm.loadCounters(ctx, &causality); err != nil {
+		return nil, err
+	}
 
 	return &causality, nil
 }
@@ -115,7 +139,7 @@ func parseOpsTag(opsValue string) map[string]uint32 {
 
 		value, err := strconv.ParseUint(valueStr, 10, 32)
 		if err != nil {
-			log.Printf("Cannot parse causality key value: %s", valueStr)
+			zap.L().Warn("Cannot parse causality key value", zap.String("value", valueStr))
 			continue
 		}
 
@@ -125,7 +149,8 @@ func parseOpsTag(opsValue string) map[string]uint32 {
 	return result
 }
 
-// UpdateFromEvent updates causality relationships from an event
+// UpdateFromEvent updates causality relationships from an event. Events already counted
+// are skipped.
 func (cm *CausalityManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
 	if event == nil {
 		return fmt.Errorf("event cannot be nil")
@@ -147,7 +172,15 @@ func (cm *CausalityManager) UpdateFromEvent(ctx context.Context, event *nostr.Ev
 
 	// Verify subspace ID format
 	if !IsValidSubspaceID(subspaceID) {
-		log.Printf("Warning: Event %s contains invalid subspace ID format: %s", event.ID, subspaceID)
+		zap.L().Warn("Event contains invalid subspace ID format", zap.String("event", event.ID), zap.String("subspace", subspaceID))
+		return nil
+	}
+
+	seen, err := cm.processed.Seen(ctx, event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check processed event: %w", err)
+	}
+	if seen {
 		return nil
 	}
 
@@ -161,32 +194,15 @@ func (cm *CausalityManager) UpdateFromEvent(ctx context.Context, event *nostr.Ev
 
 	// If it doesn't exist, create new
 	if causality == nil {
-		causality = &SubspaceCausality{
-			ID:         subspaceID,
-			DocType:    DocTypeCausality,
-			SubspaceID: subspaceID,
-			Keys:       make(map[uint32]uint64),
-			Events:     []string{event.ID},
-			Created:    int64(now),
-			Updated:    int64(now),
-		}
+		causality = newSubspaceCausality(subspaceID, int64(now))
 	} else {
-		// Update event list to avoid duplicates
-		eventExists := false
-		for _, id := range causality.Events {
-			if id == event.ID {
-				eventExists = true
-				break
-			}
-		}
-
-		if !eventExists {
-			causality.Events = append(causality.Events, event.ID)
-		}
-
 		causality.Updated = int64(now)
 	}
 
+	if causality.KeyMeta == nil {
+		causality.KeyMeta = make(map[uint32]*CausalityKeyMeta)
+	}
+
 	// Handle special event types
 	if event.Kind == 30100 {
 		// This is subspace creation event, need to initialize all causality key counters
@@ -201,12 +217,21 @@ func (cm *CausalityManager) UpdateFromEvent(ctx context.Context, event *nostr.Ev
 		if opsValue != "" {
 			// Parse ops tag
 			ops := parseOpsTag(opsValue)
-			for _, keyID := range ops {
+			if causality.Ops == nil {
+				causality.Ops = make(map[string]uint32)
+			}
+			for opName, keyID := range ops {
+				causality.Ops[opName] = keyID
 				// Initialize each causality key counter to 0
 				causality.Keys[keyID] = 0
+				causality.KeyMeta[keyID] = &CausalityKeyMeta{
+					Label:     opName,
+					Updated:   int64(now),
+					LastEvent: event.ID,
+				}
 			}
 
-			log.Printf("Initialized causality keys for subspace %s: %v", subspaceID, causality.Keys)
+			zap.L().Debug("Initialized causality keys", zap.String("subspace", subspaceID), zap.Any("keys", causality.Keys))
 		}
 	} else {
 		// For other types of events, find corresponding causality key and update counter
@@ -220,85 +245,111 @@ func (cm *CausalityManager) UpdateFromEvent(ctx context.Context, event *nostr.Ev
 
 		// Find operation corresponding causality key and update counter
 		if opName != "" {
-			// For specific kind values, directly use its value as causality key
-			// For example: kind 30302 corresponds to vote operation
-			var keyID uint32
-			foundKey := false
-
-			// Try to use kind value as causality key first
-			keyID = uint32(event.Kind)
-			if _, exists := causality.Keys[keyID]; exists {
-				foundKey = true
+			keyID, foundKey := causality.resolveOp(opName, event.Kind)
+			if foundKey {
 				causality.Keys[keyID]++
-				log.Printf("Updated causality key %d counter for subspace %s to %d", keyID, subspaceID, causality.Keys[keyID])
-			} else {
-				// If no direct match, try to match through tag
-				for key, counter := range causality.Keys {
-					// Here we need a mapping table to map operation names to corresponding causality keys
-					// But since we don't have this mapping, this is just example code
-					keyIDStr := fmt.Sprintf("%d", key)
-					if strings.HasSuffix(keyIDStr, opName) {
-						causality.Keys[key] = counter + 1
-						log.Printf("Updated causality key %d counter for subspace %s to %d", key, subspaceID, causality.Keys[key])
-						foundKey = true
-						break
-					}
-				}
+				causality.touchKey(keyID, event.ID, int64(now))
+				zap.L().Debug("Updated causality key counter", zap.String("subspace", subspaceID), zap.Uint32("key", keyID), zap.Uint64("counter", causality.Keys[keyID]))
 			}
 
 			if !foundKey {
-				log.Printf("Warning: Cannot find corresponding causality key for operation %s", opName)
+				zap.L().Warn("Cannot find corresponding causality key for operation", zap.String("event", event.ID), zap.String("op", opName))
 			}
 		}
 	}
 
-	// Save updated causality
-	doc := map[string]interface{}{
-		"_id":         causality.ID,
-		"id":          causality.ID,
-		"doc_type":    DocTypeCausality,
-		"subspace_id": causality.SubspaceID,
-		"keys":        causality.Keys,
-		"events":      causality.Events,
-		"created":     causality.Created,
-		"updated":     causality.Updated,
+	// Record the event in the epoch documents
+	if err := cm.appendEvent(ctx, causality, event.ID); err != nil {
+		return err
+	}
+
+	doc, err := cm.causalityDoc(ctx, causality)
+	if err != nil {
+		return err
+	}
+	return cm.processed.Mark(ctx, event.ID, doc)
+}
+
+// newSubspaceCausality returns the empty causality of a subspace
+func newSubspaceCausality(subspaceID string, now int64) *SubspaceCausality {
+	return &SubspaceCausality{
+		ID:         subspaceID,
+		DocType:    DocTypeCausality,
+		SubspaceID: subspaceID,
+		Keys:       make(map[uint32]uint64),
+		KeyMeta:    make(map[uint32]*CausalityKeyMeta),
+		Created:    now,
+		Updated:    now,
 	}
+}
 
+// saveCausality saves the counters of a subspace's causality, then its document
+func (cm *CausalityManager) saveCausality(ctx context.Context, causality *SubspaceCausality) error {
+	doc, err := cm.causalityDoc(ctx, causality)
+	if err != nil {
+		return err
+	}
 	_, err = cm.db.Put(ctx, doc)
 	return err
 }
 
-// IsValidSubspaceID checks if subspace ID is valid
-func IsValidSubspaceID(sid string) bool {
-	if len(sid) != 66 { // 0x + 64 hex chars
-		return false
+// causalityDoc stores the counters of a subspace causality and returns its document
+func (cm *CausalityManager) causalityDoc(ctx context.Context, causality *SubspaceCausality) (map[string]interface{}, error) {
+	keys, err := cm.storeCounters(ctx, causality)
+	if err != nil {
+		return nil, err
 	}
+	return map[string]interface{}{
+		"_id":            causality.ID,
+		"id":             causality.ID,
+		"doc_type":       DocTypeCausality,
+		"schema_version": schemaVersion(DocTypeCausality),
+		"subspace_id":    causality.SubspaceID,
+		"keys":           keys,
+		"key_meta":       causality.KeyMeta,
+		"ops":            causality.Ops,
+		"event_count":    causality.EventCount,
+		"created":        causality.Created,
+		"updated":        causality.Updated,
+	}, nil
+}
 
-	if !strings.HasPrefix(sid, "0x") {
-		return false
+// resolveOp finds the causality key of an operation. The op registry built from the ops tag
+// is authoritative; documents written before the registry existed are resolved through the
+// key labels. Events whose operation isn't declared fall back to using their kind as the key,
+// e.g. kind 30302 for votes.
+func (c *SubspaceCausality) resolveOp(opName string, kind int) (uint32, bool) {
+	if c.Ops == nil {
+		c.Ops = make(map[string]uint32)
+		for keyID, meta := range c.KeyMeta {
+			if meta != nil && meta.Label != "" {
+				c.Ops[meta.Label] = keyID
+			}
+		}
 	}
 
-	for _, c := range sid[2:] {
-		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
-			return false
+	if keyID, exists := c.Ops[opName]; exists {
+		if _, exists := c.Keys[keyID]; exists {
+			return keyID, true
 		}
 	}
 
-	return true
-}
-
-// GetCausalityEvents retrieves all events related to a specific subspace
-func (cm *CausalityManager) GetCausalityEvents(ctx context.Context, subspaceID string) ([]string, error) {
-	causality, err := cm.GetSubspaceCausality(ctx, subspaceID)
-	if err != nil {
-		return nil, err
+	keyID := uint32(kind)
+	if _, exists := c.Keys[keyID]; exists {
+		return keyID, true
 	}
+	return 0, false
+}
 
-	if causality == nil {
-		return []string{}, nil
+// touchKey records which event last advanced a causality key
+func (c *SubspaceCausality) touchKey(keyID uint32, eventID string, timestamp int64) {
+	meta, exists := c.KeyMeta[keyID]
+	if !exists {
+		meta = &CausalityKeyMeta{}
+		c.KeyMeta[keyID] = meta
 	}
-
-	return causality.Events, nil
+	meta.Updated = timestamp
+	meta.LastEvent = eventID
 }
 
 // GetCausalityKey retrieves a specific causality key for a specific subspace
@@ -309,7 +360,7 @@ func (cm *CausalityManager) GetCausalityKey(ctx context.Context, subspaceID stri
 	}
 
 	if causality == nil {
-		return 0, fmt.Errorf("subspace %s does not exist", subspaceID)
+		return 0, fmt.Errorf("%w: %s", ErrSubspaceNotFound, subspaceID)
 	}
 
 	counter, exists := causality.Keys[keyID]
@@ -334,6 +385,39 @@ func (cm *CausalityManager) GetAllCausalityKeys(ctx context.Context, subspaceID
 	return causality.Keys, nil
 }
 
+// ListCausalityKeys retrieves all causality keys of a subspace with their labels and
+// last-update information, ordered by key ID
+func (cm *CausalityManager) ListCausalityKeys(ctx context.Context, subspaceID string) ([]*CausalityKey, error) {
+	causality, err := cm.GetSubspaceCausality(ctx, subspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if causality == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSubspaceNotFound, subspaceID)
+	}
+
+	keys := make([]*CausalityKey, 0, len(causality.Keys))
+	for keyID, counter := range causality.Keys {
+		key := &CausalityKey{
+			Key:     keyID,
+			Counter: counter,
+		}
+		if meta, exists := causality.KeyMeta[keyID]; exists && meta != nil {
+			key.Label = meta.Label
+			key.Updated = meta.Updated
+			key.LastEvent = meta.LastEvent
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Key < keys[j].Key
+	})
+
+	return keys, nil
+}
+
 // QuerySubspaces queries subspaces based on conditions
 func (cm *CausalityManager) QuerySubspaces(ctx context.Context, filter func(*SubspaceCausality) bool) ([]*SubspaceCausality, error) {
 	var results []*SubspaceCausality
@@ -360,6 +444,9 @@ func (cm *CausalityManager) QuerySubspaces(ctx context.Context, filter func(*Sub
 		if err := json.Unmarshal(jsonData, &causality); err != nil {
 			return false, nil
 		}
+		if err := cm.loadCounters(ctx, &causality); err != nil {
+			return false, err
+		}
 
 		// Apply filter
 		if filter == nil || filter(&causality) {
@@ -370,7 +457,9 @@ func (cm *CausalityManager) QuerySubspaces(ctx context.Context, filter func(*Sub
 	}
 
 	// Execute query
-	cm.db.Query(ctx, queryFn)
+	if _, err := queryDocuments(ctx, cm.db, queryFn); err != nil {
+		return nil, err
+	}
 
 	return results, nil
 }
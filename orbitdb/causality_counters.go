@@ -0,0 +1,155 @@
+package orbitdb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"berty.tech/go-orbit-db/iface"
+)
+
+// Causality counter storage backends
+const (
+	CounterStoreDocument = "document" // Counters are kept in the causality documents
+	CounterStoreKeyValue = "keyvalue" // Counters are kept in a keyvalue store, one key per counter
+)
+
+// CausalityCounters holds the causality key counters of subspaces outside their causality
+// documents, so an increment writes one counter instead of the whole document
+type CausalityCounters interface {
+	// Get returns the stored counters of keys of a subspace by key ID, leaving out keys
+	// without a counter
+	Get(ctx context.Context, subspaceID string, keyIDs []uint32) (map[uint32]uint64, error)
+	// Set stores a counter
+	Set(ctx context.Context, subspaceID string, keyID uint32, value uint64) error
+	// Clear removes every counter
+	Clear(ctx context.Context) error
+}
+
+// KeyValueCounters keeps causality counters in an OrbitDB keyvalue store under the keys
+// <subspace id>/<key id>, with the counter as a decimal string value
+type KeyValueCounters struct {
+	kv iface.KeyValueStore
+}
+
+// NewKeyValueCounters creates causality counters backed by a keyvalue store
+func NewKeyValueCounters(kv iface.KeyValueStore) *KeyValueCounters {
+	return &KeyValueCounters{kv: kv}
+}
+
+// counterKey returns the keyvalue key of a counter
+func counterKey(subspaceID string, keyID uint32) string {
+	return subspaceID + "/" + strconv.FormatUint(uint64(keyID), 10)
+}
+
+// Get reads the counters of keys of a subspace, one key each
+func (c *KeyValueCounters) Get(ctx context.Context, subspaceID string, keyIDs []uint32) (map[uint32]uint64, error) {
+	counters := make(map[uint32]uint64, len(keyIDs))
+	for _, keyID := range keyIDs {
+		key := counterKey(subspaceID, keyID)
+		value, err := c.kv.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read counter %s: %w", key, err)
+		}
+		if value == nil {
+			continue
+		}
+		counter, err := strconv.ParseUint(string(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid counter %s: %w", key, err)
+		}
+		counters[keyID] = counter
+	}
+	return counters, nil
+}
+
+// Set stores a counter
+func (c *KeyValueCounters) Set(ctx context.Context, subspaceID string, keyID uint32, value uint64) error {
+	_, err := c.kv.Put(ctx, counterKey(subspaceID, keyID), []byte(strconv.FormatUint(value, 10)))
+	return err
+}
+
+// Clear removes every counter
+func (c *KeyValueCounters) Clear(ctx context.Context) error {
+	for key := range c.kv.All() {
+		if _, err := c.kv.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete counter %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// EnableKeyValueCounters moves causality counters into a keyvalue store. Counters still held
+// by causality documents are read from them and move to the store on the subspace's next
+// update. Must be called before the adapter is used.
+func (a *OrbitDBAdapter) EnableKeyValueCounters(kv iface.KeyValueStore) {
+	a.causalityMgr.counters = NewKeyValueCounters(kv)
+}
+
+// counterKeyIDs returns the IDs of the keys of a causality document: those whose counters it
+// still holds and those of its key metadata, which lists every key once counters are stored
+// apart
+func (c *SubspaceCausality) counterKeyIDs() []uint32 {
+	keyIDs := make([]uint32, 0, len(c.KeyMeta))
+	for keyID := range c.KeyMeta {
+		keyIDs = append(keyIDs, keyID)
+	}
+	for keyID := range c.Keys {
+		if _, listed := c.KeyMeta[keyID]; !listed {
+			keyIDs = append(keyIDs, keyID)
+		}
+	}
+	return keyIDs
+}
+
+// loadCounters reads the counters of a causality document from the counter store, if any.
+// Stored counters take precedence over those left in the document.
+func (cm *CausalityManager) loadCounters(ctx context.Context, causality *SubspaceCausality) error {
+	if cm.counters == nil {
+		return nil
+	}
+
+	counters, err := cm.counters.Get(ctx, causality.ID, causality.counterKeyIDs())
+	if err != nil {
+		return fmt.Errorf("failed to read causality counters: %w", err)
+	}
+	if causality.Keys == nil {
+		causality.Keys = make(map[uint32]uint64)
+	}
+	for keyID, counter := range counters {
+		causality.Keys[keyID] = counter
+	}
+	return nil
+}
+
+// storeCounters writes the counters of a causality document that differ from the counter
+// store and returns the counters the document keeps: none if a counter store is used, in
+// which case every key gets metadata so the document still lists it.
+func (cm *CausalityManager) storeCounters(ctx context.Context, causality *SubspaceCausality) (map[uint32]uint64, error) {
+	if cm.counters == nil {
+		return causality.Keys, nil
+	}
+
+	if causality.KeyMeta == nil {
+		causality.KeyMeta = make(map[uint32]*CausalityKeyMeta)
+	}
+	for keyID := range causality.Keys {
+		if _, listed := causality.KeyMeta[keyID]; !listed {
+			causality.KeyMeta[keyID] = &CausalityKeyMeta{}
+		}
+	}
+
+	stored, err := cm.counters.Get(ctx, causality.ID, causality.counterKeyIDs())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read causality counters: %w", err)
+	}
+	for keyID, counter := range causality.Keys {
+		if current, exists := stored[keyID]; exists && current == counter {
+			continue
+		}
+		if err := cm.counters.Set(ctx, causality.ID, keyID, counter); err != nil {
+			return nil, fmt.Errorf("failed to store causality counter %d: %w", keyID, err)
+		}
+	}
+	return map[uint32]uint64{}, nil
+}
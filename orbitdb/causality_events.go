@@ -0,0 +1,269 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeCausalityEvents identifies the epoch documents holding the event IDs of a subspace
+const DocTypeCausalityEvents = "causality_events"
+
+// CausalityEventsPerEpoch is the number of event IDs stored in one epoch document
+const CausalityEventsPerEpoch = 500
+
+// ErrInvalidCursor is returned for page cursors that weren't produced by a previous page
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CausalityEventEpoch holds a fixed-size slice of a subspace's event IDs, so saving an event
+// rewrites one bounded document instead of the whole history
+type CausalityEventEpoch struct {
+	ID         string   `json:"id"`          // Document ID, format: causality_events:<subspace id>:<epoch>
+	DocType    string   `json:"doc_type"`    // Document type, fixed as "causality_events"
+	SubspaceID string   `json:"subspace_id"` // Subspace ID
+	Epoch      int      `json:"epoch"`       // Epoch number, starting at 0
+	Events     []string `json:"events"`      // Event IDs in the order they were recorded
+	Updated    int64    `json:"updated"`     // Update timestamp
+}
+
+// causalityEpochDocID returns the document ID of an epoch of a subspace's event IDs
+func causalityEpochDocID(subspaceID string, epoch int) string {
+	return fmt.Sprintf("%s:%s:%d", DocTypeCausalityEvents, subspaceID, epoch)
+}
+
+// appendEvent records an event ID in the current epoch of a subspace, starting a new epoch
+// once the current one is full. Event IDs listed inline by documents written before epochs
+// existed are moved into epochs first. Duplicates are detected within the current epoch only,
+// which covers events re-applied shortly after they were saved.
+func (cm *CausalityManager) appendEvent(ctx context.Context, causality *SubspaceCausality, eventID string) error {
+	if len(causality.Events) > 0 {
+		if err := cm.compactEvents(ctx, causality); err != nil {
+			return err
+		}
+	}
+
+	epochNum := causality.EventCount / CausalityEventsPerEpoch
+	var epoch *CausalityEventEpoch
+	if causality.EventCount%CausalityEventsPerEpoch != 0 {
+		var err error
+		if epoch, err = cm.getEventEpoch(ctx, causality.SubspaceID, epochNum); err != nil {
+			return err
+		}
+	}
+	if epoch == nil {
+		epoch = &CausalityEventEpoch{
+			ID:         causalityEpochDocID(causality.SubspaceID, epochNum),
+			DocType:    DocTypeCausalityEvents,
+			SubspaceID: causality.SubspaceID,
+			Epoch:      epochNum,
+		}
+	}
+
+	for _, id := range epoch.Events {
+		if id == eventID {
+			return nil
+		}
+	}
+
+	epoch.Events = append(epoch.Events, eventID)
+	if _, err := cm.db.Put(ctx, epochToDoc(epoch)); err != nil {
+		return err
+	}
+	causality.EventCount++
+	return nil
+}
+
+// compactEvents moves the inline event IDs of a subspace into epoch documents
+func (cm *CausalityManager) compactEvents(ctx context.Context, causality *SubspaceCausality) error {
+	// Drop duplicates the inline list may contain
+	seen := make(map[string]bool, len(causality.Events))
+	events := make([]string, 0, len(causality.Events))
+	for _, id := range causality.Events {
+		if !seen[id] {
+			seen[id] = true
+			events = append(events, id)
+		}
+	}
+
+	var docs []interface{}
+	for start := 0; start < len(events); start += CausalityEventsPerEpoch {
+		end := start + CausalityEventsPerEpoch
+		if end > len(events) {
+			end = len(events)
+		}
+		epochNum := start / CausalityEventsPerEpoch
+		docs = append(docs, epochToDoc(&CausalityEventEpoch{
+			ID:         causalityEpochDocID(causality.SubspaceID, epochNum),
+			DocType:    DocTypeCausalityEvents,
+			SubspaceID: causality.SubspaceID,
+			Epoch:      epochNum,
+			Events:     events[start:end],
+		}))
+	}
+
+	if _, err := cm.db.PutBatch(ctx, docs); err != nil {
+		return fmt.Errorf("failed to compact events of subspace %s: %w", causality.SubspaceID, err)
+	}
+
+	causality.EventCount = len(events)
+	causality.Events = nil
+	return nil
+}
+
+// GetCausalityEvents retrieves all events related to a specific subspace
+func (cm *CausalityManager) GetCausalityEvents(ctx context.Context, subspaceID string) ([]string, error) {
+	var (
+		all    = []string{}
+		cursor string
+	)
+	for {
+		events, next, err := cm.GetCausalityEventsPage(ctx, subspaceID, cursor, CausalityEventsPerEpoch)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, events...)
+		if next == "" {
+			return all, nil
+		}
+		cursor = next
+	}
+}
+
+// GetCausalityEventsPage retrieves up to limit event IDs of a subspace in the order they were
+// recorded, starting at cursor (empty for the first page). The returned cursor points to the
+// next page and is empty on the last page.
+func (cm *CausalityManager) GetCausalityEventsPage(ctx context.Context, subspaceID, cursor string, limit int) ([]string, string, error) {
+	pos := 0
+	if cursor != "" {
+		p, err := strconv.Atoi(cursor)
+		if err != nil || p < 0 {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidCursor, cursor)
+		}
+		pos = p
+	}
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("limit must be positive")
+	}
+
+	causality, err := cm.GetSubspaceCausality(ctx, subspaceID)
+	if err != nil {
+		return nil, "", err
+	}
+	if causality == nil {
+		return []string{}, "", nil
+	}
+
+	// Documents not updated since epochs were introduced still list their events inline
+	if len(causality.Events) > 0 {
+		return pageOf(causality.Events, pos, limit)
+	}
+
+	events := []string{}
+	for pos+len(events) < causality.EventCount && len(events) < limit {
+		at := pos + len(events)
+		epoch, err := cm.getEventEpoch(ctx, subspaceID, at/CausalityEventsPerEpoch)
+		if err != nil {
+			return nil, "", err
+		}
+		if epoch == nil || at%CausalityEventsPerEpoch >= len(epoch.Events) {
+			break
+		}
+
+		remaining := epoch.Events[at%CausalityEventsPerEpoch:]
+		if len(remaining) > limit-len(events) {
+			remaining = remaining[:limit-len(events)]
+		}
+		events = append(events, remaining...)
+	}
+
+	next := ""
+	if end := pos + len(events); len(events) > 0 && end < causality.EventCount {
+		next = strconv.Itoa(end)
+	}
+	return events, next, nil
+}
+
+// listRecentEvents sets the Events of causality data read from its document to the event IDs
+// of the latest epoch, so responses keep listing the subspace's recent events. Documents
+// written before epochs already list every event ID and are left as they are.
+func (cm *CausalityManager) listRecentEvents(ctx context.Context, causality *SubspaceCausality) error {
+	if causality == nil || len(causality.Events) > 0 {
+		return nil
+	}
+	causality.Events = []string{}
+	if causality.EventCount == 0 {
+		return nil
+	}
+
+	epoch, err := cm.getEventEpoch(ctx, causality.SubspaceID, (causality.EventCount-1)/CausalityEventsPerEpoch)
+	if err != nil || epoch == nil {
+		return err
+	}
+	causality.Events = epoch.Events
+	return nil
+}
+
+// pageOf returns a page of an in-memory event ID list and the cursor of the next page
+func pageOf(events []string, pos, limit int) ([]string, string, error) {
+	if pos >= len(events) {
+		return []string{}, "", nil
+	}
+	end := pos + limit
+	if end >= len(events) {
+		return events[pos:], "", nil
+	}
+	return events[pos:end], strconv.Itoa(end), nil
+}
+
+// getEventEpoch retrieves an epoch document of a subspace, nil if it doesn't exist
+func (cm *CausalityManager) getEventEpoch(ctx context.Context, subspaceID string, epoch int) (*CausalityEventEpoch, error) {
+	docs, err := cm.db.Get(ctx, causalityEpochDocID(subspaceID, epoch), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeCausalityEvents {
+			continue
+		}
+
+		// Convert document to JSON and parse into struct
+		jsonData, err := json.Marshal(docMap)
+		if err != nil {
+			return nil, err
+		}
+
+		var result CausalityEventEpoch
+		if err := json.Unmarshal(jsonData, &result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	return nil, nil
+}
+
+// epochToDoc converts an epoch to a document, stamping its update time
+func epochToDoc(epoch *CausalityEventEpoch) map[string]interface{} {
+	epoch.Updated = int64(nostr.Now())
+	return map[string]interface{}{
+		"_id":            epoch.ID,
+		"id":             epoch.ID,
+		"doc_type":       DocTypeCausalityEvents,
+		"schema_version": schemaVersion(DocTypeCausalityEvents),
+		"subspace_id":    epoch.SubspaceID,
+		"epoch":          epoch.Epoch,
+		"events":         epoch.Events,
+		"updated":        epoch.Updated,
+	}
+}
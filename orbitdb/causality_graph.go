@@ -0,0 +1,234 @@
+package orbitdb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// CausalityGraphNode is an event in the dependency graph of a subspace. Events outside the
+// subspace, referenced by or referencing its events, are external nodes carrying only their
+// ID and, if known, their subspace.
+type CausalityGraphNode struct {
+	ID         string   `json:"id"`                    // Event ID
+	PubKey     string   `json:"pubkey"`                // Event author, empty for external events
+	Kind       int      `json:"kind"`                  // Event kind, 0 for external events
+	CreatedAt  int64    `json:"created_at"`            // Event creation timestamp, 0 for external events
+	Op         string   `json:"op,omitempty"`          // Operation name from the op tag
+	Key        uint32   `json:"key,omitempty"`         // Causality key the operation advanced, 0 if none
+	Counter    uint64   `json:"counter,omitempty"`     // Lamport counter of the key after this event
+	Parents    []string `json:"parents,omitempty"`     // Event IDs from the parent tags
+	External   bool     `json:"external,omitempty"`    // Whether the event isn't an event of the subspace
+	SubspaceID string   `json:"subspace_id,omitempty"` // Subspace of an external event, if known
+}
+
+// CausalityGraphEdge points from an event to one of its causal parents, or to an event it
+// references with an xref tag
+type CausalityGraphEdge struct {
+	From     string `json:"from"`               // Child or referencing event ID
+	To       string `json:"to"`                 // Parent or referenced event ID
+	External bool   `json:"external,omitempty"` // Whether one end isn't an event of the subspace
+	Xref     bool   `json:"xref,omitempty"`     // Whether the edge is a cross-subspace reference
+}
+
+// CausalityGraph is the event dependency graph of a subspace
+type CausalityGraph struct {
+	SubspaceID string                `json:"subspace_id"` // Subspace ID
+	Nodes      []*CausalityGraphNode `json:"nodes"`       // Events in the order they were recorded, then external events
+	Edges      []*CausalityGraphEdge `json:"edges"`       // Parent references and cross-subspace references
+}
+
+// parseParentTags extracts the causal parents of an event
+// Tag format: ["parent", "<event id>", ...], several parents may share one tag
+func parseParentTags(event *nostr.Event) []string {
+	var parents []string
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "parent" {
+			continue
+		}
+		for _, id := range tag[1:] {
+			if id != "" {
+				parents = append(parents, id)
+			}
+		}
+	}
+	return parents
+}
+
+// GetCausalityGraph builds the event dependency graph of a subspace. Lamport counters are
+// recomputed by replaying the events in the order they were recorded, so every node carries
+// the counter value its event produced. Cross-subspace references of the events, in both
+// directions, are added as xref edges. Returns nil if the subspace doesn't exist.
+func (a *OrbitDBAdapter) GetCausalityGraph(ctx context.Context, subspaceID string) (*CausalityGraph, error) {
+	causality, err := a.causalityMgr.GetSubspaceCausality(ctx, subspaceID)
+	if err != nil || causality == nil {
+		return nil, err
+	}
+
+	eventIDs, err := a.causalityMgr.GetCausalityEvents(ctx, subspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &CausalityGraph{
+		SubspaceID: subspaceID,
+		Nodes:      []*CausalityGraphNode{},
+		Edges:      []*CausalityGraphEdge{},
+	}
+	if len(eventIDs) == 0 {
+		return graph, nil
+	}
+
+	cursor, err := a.OpenEventCursor(ctx, nostr.Filter{IDs: eventIDs})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+	events := make(map[string]*nostr.Event, len(eventIDs))
+	for {
+		event, err := cursor.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		events[event.ID] = event
+	}
+
+	var externals []*CausalityGraphNode
+	external := make(map[string]*CausalityGraphNode)
+	addExternal := func(id, subspaceID string) {
+		if node, ok := external[id]; ok {
+			if node.SubspaceID == "" {
+				node.SubspaceID = subspaceID
+			}
+			return
+		}
+		node := &CausalityGraphNode{ID: id, External: true, SubspaceID: subspaceID}
+		external[id] = node
+		externals = append(externals, node)
+	}
+
+	counters := make(map[uint32]uint64)
+	for _, id := range eventIDs {
+		event, ok := events[id]
+		if !ok {
+			continue // Deleted since it was recorded
+		}
+
+		node := &CausalityGraphNode{
+			ID:        event.ID,
+			PubKey:    event.PubKey,
+			Kind:      event.Kind,
+			CreatedAt: int64(event.CreatedAt),
+			Parents:   parseParentTags(event),
+		}
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "op" {
+				node.Op = tag[1]
+				break
+			}
+		}
+		if node.Op != "" && event.Kind != 30100 {
+			if keyID, ok := causality.resolveOp(node.Op, event.Kind); ok {
+				counters[keyID]++
+				node.Key = keyID
+				node.Counter = counters[keyID]
+			}
+		}
+		graph.Nodes = append(graph.Nodes, node)
+
+		for _, parent := range node.Parents {
+			_, internal := events[parent]
+			graph.Edges = append(graph.Edges, &CausalityGraphEdge{From: event.ID, To: parent, External: !internal})
+			if !internal {
+				addExternal(parent, "")
+			}
+		}
+
+		for _, link := range parseXrefTags(event) {
+			_, internal := events[link.EventID]
+			graph.Edges = append(graph.Edges, &CausalityGraphEdge{From: event.ID, To: link.EventID, External: !internal, Xref: true})
+			if !internal {
+				addExternal(link.EventID, link.SubspaceID)
+			}
+		}
+
+		// References from the subspace's own events are added from their tags above
+		xrefs, err := a.xrefMgr.GetEventXrefs(ctx, event.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range xrefs.Incoming {
+			if _, internal := events[link.EventID]; internal {
+				continue
+			}
+			graph.Edges = append(graph.Edges, &CausalityGraphEdge{From: link.EventID, To: event.ID, External: true, Xref: true})
+			addExternal(link.EventID, link.SubspaceID)
+		}
+	}
+
+	graph.Nodes = append(graph.Nodes, externals...)
+	return graph, nil
+}
+
+// WriteDOT writes the graph in Graphviz DOT format. Edges point from events to their parents
+// and referenced events; events outside the subspace and the edges reaching them are drawn
+// dashed, and cross-subspace references are labeled xref.
+func (g *CausalityGraph) WriteDOT(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "digraph %s {\n", strconv.Quote(g.SubspaceID))
+	fmt.Fprintln(out, "  rankdir=BT;")
+	fmt.Fprintln(out, "  node [shape=box];")
+
+	for _, node := range g.Nodes {
+		if node.External {
+			label := shortID(node.ID)
+			if node.SubspaceID != "" {
+				label += "\n" + shortID(node.SubspaceID)
+			}
+			fmt.Fprintf(out, "  %s [label=%s, style=dashed];\n", strconv.Quote(node.ID), strconv.Quote(label))
+			continue
+		}
+		label := fmt.Sprintf("%s\nkind %d", shortID(node.ID), node.Kind)
+		if node.Op != "" {
+			label += "\n" + node.Op
+			if node.Key != 0 {
+				label += fmt.Sprintf(" %d@%d", node.Key, node.Counter)
+			}
+		}
+		fmt.Fprintf(out, "  %s [label=%s];\n", strconv.Quote(node.ID), strconv.Quote(label))
+	}
+
+	for _, edge := range g.Edges {
+		var attrs []string
+		if edge.External {
+			attrs = append(attrs, "style=dashed")
+		}
+		if edge.Xref {
+			attrs = append(attrs, `label="xref"`)
+		}
+		if len(attrs) == 0 {
+			fmt.Fprintf(out, "  %s -> %s;\n", strconv.Quote(edge.From), strconv.Quote(edge.To))
+			continue
+		}
+		fmt.Fprintf(out, "  %s -> %s [%s];\n", strconv.Quote(edge.From), strconv.Quote(edge.To), strings.Join(attrs, ", "))
+	}
+
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// shortID abbreviates long event IDs for graph labels
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12] + "…"
+	}
+	return id
+}
@@ -2,12 +2,17 @@ package orbitdb
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"berty.tech/go-orbit-db/iface"
+	"berty.tech/go-orbit-db/stores/operation"
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // Test subspace ID validation
@@ -47,6 +52,57 @@ func TestIsValidSubspaceID(t *testing.T) {
 	}
 }
 
+// Test the configurable subspace ID formats
+func TestSubspaceIDValidators(t *testing.T) {
+	tests := []struct {
+		format  string
+		pattern string
+		valid   []string
+		invalid []string
+	}{
+		{
+			format:  SubspaceIDFormatUUID,
+			valid:   []string{"123e4567-e89b-12d3-a456-426614174000"},
+			invalid: []string{"123e4567e89b12d3a456426614174000", "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"},
+		},
+		{
+			format:  SubspaceIDFormatCID,
+			valid:   []string{"QmPZ9gcCEpqKTo6aq61g2nXGUhM4iCL3ewB6LDXZCtioEB", "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"},
+			invalid: []string{"not-a-cid"},
+		},
+		{
+			format:  SubspaceIDFormatRegex,
+			pattern: "space-[0-9]+",
+			valid:   []string{"space-42"},
+			invalid: []string{"space-42x", "my-space-42"},
+		},
+	}
+
+	defer SetSubspaceIDValidator(nil)
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			validator, err := NewSubspaceIDValidator(tt.format, tt.pattern)
+			assert.NoError(t, err)
+			SetSubspaceIDValidator(validator)
+
+			for _, id := range tt.valid {
+				assert.True(t, IsValidSubspaceID(id), id)
+			}
+			for _, id := range tt.invalid {
+				assert.False(t, IsValidSubspaceID(id), id)
+			}
+		})
+	}
+
+	SetSubspaceIDValidator(nil)
+	assert.True(t, IsValidSubspaceID("0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"))
+
+	_, err := NewSubspaceIDValidator("ulid", "")
+	assert.Error(t, err)
+	_, err = NewSubspaceIDValidator(SubspaceIDFormatRegex, "[")
+	assert.Error(t, err)
+}
+
 // Test getting subspace causality
 func TestGetSubspaceCausality(t *testing.T) {
 	mockDB := new(MockDocumentStore)
@@ -101,9 +157,11 @@ func TestUpdateFromEvent(t *testing.T) {
 		},
 	}
 
-	// Set mock behavior
+	// Set mock behavior; no event was processed before
+	mockDB.On("Query", mock.Anything, mock.Anything).Return([]interface{}{}, nil)
 	mockDB.On("Get", mock.Anything, subspaceID, nil).Return([]interface{}{}, nil)
 	mockDB.On("Put", mock.Anything, mock.Anything).Return(subspaceID, nil)
+	mockDB.On("PutAll", mock.Anything, mock.Anything).Return(nil, nil)
 
 	// Execute test
 	err := manager.UpdateFromEvent(context.Background(), event)
@@ -111,6 +169,59 @@ func TestUpdateFromEvent(t *testing.T) {
 	mockDB.AssertExpectations(t)
 }
 
+// Test that the op tag is resolved through the registry declared by the ops tag
+func TestUpdateFromEventOpRegistry(t *testing.T) {
+	manager := NewCausalityManager(NewMemoryDocumentStore("op-registry"))
+	ctx := context.Background()
+	subspaceID := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+
+	create := &nostr.Event{
+		ID:   "create",
+		Kind: 30100,
+		Tags: nostr.Tags{{"sid", subspaceID}, {"ops", "post=1,propose=2,vote=3"}},
+	}
+	assert.NoError(t, manager.UpdateFromEvent(ctx, create))
+
+	causality, err := manager.GetSubspaceCausality(ctx, subspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint32{"post": 1, "propose": 2, "vote": 3}, causality.Ops)
+
+	events := []*nostr.Event{
+		{ID: "vote", Kind: 30302, Tags: nostr.Tags{{"sid", subspaceID}, {"op", "vote"}}},
+		{ID: "post", Kind: 30300, Tags: nostr.Tags{{"sid", subspaceID}, {"op", "post"}}},
+		{ID: "unknown", Kind: 30301, Tags: nostr.Tags{{"sid", subspaceID}, {"op", "unknown"}}},
+	}
+	for _, event := range events {
+		assert.NoError(t, manager.UpdateFromEvent(ctx, event))
+	}
+
+	causality, err = manager.GetSubspaceCausality(ctx, subspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint32]uint64{1: 1, 2: 0, 3: 1}, causality.Keys)
+	assert.Equal(t, "vote", causality.KeyMeta[3].LastEvent)
+}
+
+// Test that documents saved before the registry existed resolve ops through key labels
+func TestResolveOpFromLabels(t *testing.T) {
+	causality := &SubspaceCausality{
+		Keys: map[uint32]uint64{1: 0, 30302: 0},
+		KeyMeta: map[uint32]*CausalityKeyMeta{
+			1: {Label: "post"},
+		},
+	}
+
+	keyID, ok := causality.resolveOp("post", 30300)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1), keyID)
+
+	keyID, ok = causality.resolveOp("vote", 30302)
+	assert.True(t, ok, "undeclared ops fall back to the event kind")
+	assert.Equal(t, uint32(30302), keyID)
+
+	_, ok = causality.resolveOp("comment", 30303)
+	assert.False(t, ok)
+}
+
 // Test getting causality events
 func TestGetCausalityEvents(t *testing.T) {
 	mockDB := new(MockDocumentStore)
@@ -136,6 +247,155 @@ func TestGetCausalityEvents(t *testing.T) {
 	assert.Equal(t, events, result)
 }
 
+// Test that event IDs are split into epochs and read back a page at a time
+func TestCausalityEventEpochs(t *testing.T) {
+	db := NewMemoryDocumentStore("epochs")
+	manager := NewCausalityManager(db)
+	ctx := context.Background()
+	subspaceID := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+
+	total := CausalityEventsPerEpoch + 10
+	var want []string
+	for i := 0; i < total; i++ {
+		event := &nostr.Event{ID: fmt.Sprintf("event-%04d", i), Kind: 1, Tags: nostr.Tags{{"sid", subspaceID}}}
+		assert.NoError(t, manager.UpdateFromEvent(ctx, event))
+		want = append(want, event.ID)
+	}
+	// Re-applying a recent event doesn't list it twice
+	assert.NoError(t, manager.UpdateFromEvent(ctx, &nostr.Event{ID: want[total-1], Kind: 1, Tags: nostr.Tags{{"sid", subspaceID}}}))
+
+	epochs, err := db.Get(ctx, causalityEpochDocID(subspaceID, 1), nil)
+	assert.NoError(t, err)
+	assert.Len(t, epochs, 1)
+
+	var (
+		got    []string
+		cursor string
+		pages  int
+	)
+	for {
+		events, next, err := manager.GetCausalityEventsPage(ctx, subspaceID, cursor, 200)
+		assert.NoError(t, err)
+		got = append(got, events...)
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, 3, pages)
+
+	_, _, err = manager.GetCausalityEventsPage(ctx, subspaceID, "not-a-cursor", 10)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+// Test that event IDs listed inline by older documents are moved into epochs on the next update
+func TestCausalityEventsCompaction(t *testing.T) {
+	db := NewMemoryDocumentStore("compaction")
+	manager := NewCausalityManager(db)
+	ctx := context.Background()
+	subspaceID := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+
+	_, err := db.Put(ctx, map[string]interface{}{
+		"_id":         subspaceID,
+		"id":          subspaceID,
+		"doc_type":    DocTypeCausality,
+		"subspace_id": subspaceID,
+		"keys":        map[string]interface{}{},
+		"events":      []string{"event1", "event2", "event1"},
+	})
+	assert.NoError(t, err)
+
+	events, err := manager.GetCausalityEvents(ctx, subspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"event1", "event2", "event1"}, events)
+
+	assert.NoError(t, manager.UpdateFromEvent(ctx, &nostr.Event{ID: "event3", Kind: 1, Tags: nostr.Tags{{"sid", subspaceID}}}))
+
+	causality, err := manager.GetSubspaceCausality(ctx, subspaceID)
+	assert.NoError(t, err)
+	assert.Empty(t, causality.Events)
+	assert.Equal(t, 3, causality.EventCount)
+
+	events, err = manager.GetCausalityEvents(ctx, subspaceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"event1", "event2", "event3"}, events)
+}
+
+// Test that the adapter lists the event IDs of the latest epoch with the causality data
+func TestSubspaceCausalityRecentEvents(t *testing.T) {
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("recent"))
+	ctx := context.Background()
+	subspaceID := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+
+	var want []string
+	for i := 0; i < CausalityEventsPerEpoch+2; i++ {
+		id := fmt.Sprintf("event%d", i)
+		require.NoError(t, adapter.causalityMgr.UpdateFromEvent(ctx, &nostr.Event{ID: id, Kind: 1, Tags: nostr.Tags{{"sid", subspaceID}}}))
+		if i >= CausalityEventsPerEpoch {
+			want = append(want, id)
+		}
+	}
+
+	causality, err := adapter.GetSubspaceCausality(ctx, subspaceID)
+	require.NoError(t, err)
+	assert.Equal(t, want, causality.Events)
+	assert.Equal(t, CausalityEventsPerEpoch+2, causality.EventCount)
+
+	subspaces, err := adapter.QuerySubspaces(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, subspaces, 1)
+	assert.Equal(t, want, subspaces[0].Events)
+}
+
+// Test building the dependency graph of a subspace with replayed counters, parent edges and
+// cross-subspace references
+func TestGetCausalityGraph(t *testing.T) {
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("graph"))
+	ctx := context.Background()
+	subspaceID := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+
+	create := signAs(t, "alice", &nostr.Event{Kind: 30100, CreatedAt: 1, Tags: nostr.Tags{{"sid", subspaceID}, {"ops", "post=1,vote=2"}}})
+	post := signAs(t, "alice", &nostr.Event{Kind: 30300, CreatedAt: 2, Tags: nostr.Tags{{"sid", subspaceID}, {"op", "post"}, {"parent", create.ID}}})
+	vote := signAs(t, "alice", &nostr.Event{Kind: 30302, CreatedAt: 3, Tags: nostr.Tags{{"sid", subspaceID}, {"op", "vote"}, {"parent", post.ID, "elsewhere"}}})
+	reply := signAs(t, "alice", &nostr.Event{Kind: 30300, CreatedAt: 4, Tags: nostr.Tags{{"sid", subspaceID}, {"op", "post"}, {"parent", post.ID}, {"xref", "quoted", "0xother"}}})
+	quote := signAs(t, "alice", &nostr.Event{Kind: 30300, CreatedAt: 5, Tags: nostr.Tags{{"sid", "0xthird"}, {"xref", post.ID, subspaceID}}})
+	for _, event := range []*nostr.Event{create, post, vote, reply, quote} {
+		assert.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+
+	graph, err := adapter.GetCausalityGraph(ctx, subspaceID)
+	assert.NoError(t, err)
+	require.Len(t, graph.Nodes, 7)
+	assert.Equal(t, reply.ID, graph.Nodes[3].ID)
+	assert.Equal(t, uint32(1), graph.Nodes[3].Key)
+	assert.Equal(t, uint64(2), graph.Nodes[3].Counter)
+	assert.Equal(t, []*CausalityGraphNode{
+		{ID: quote.ID, External: true, SubspaceID: "0xthird"},
+		{ID: "elsewhere", External: true},
+		{ID: "quoted", External: true, SubspaceID: "0xother"},
+	}, graph.Nodes[4:], "events outside the subspace follow its own")
+	assert.Equal(t, []*CausalityGraphEdge{
+		{From: post.ID, To: create.ID},
+		{From: quote.ID, To: post.ID, External: true, Xref: true},
+		{From: vote.ID, To: post.ID},
+		{From: vote.ID, To: "elsewhere", External: true},
+		{From: reply.ID, To: post.ID},
+		{From: reply.ID, To: "quoted", External: true, Xref: true},
+	}, graph.Edges)
+
+	var dot strings.Builder
+	assert.NoError(t, graph.WriteDOT(&dot))
+	assert.Contains(t, dot.String(), `"`+vote.ID+`" -> "elsewhere" [style=dashed];`)
+	assert.Contains(t, dot.String(), `"`+reply.ID+`" -> "quoted" [style=dashed, label="xref"];`)
+	assert.Contains(t, dot.String(), `"quoted" [label="quoted\n0xother", style=dashed];`)
+
+	missing, err := adapter.GetCausalityGraph(ctx, "0x0000000000000000000000000000000000000000000000000000000000000000")
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
 // Test getting causality key
 func TestGetCausalityKey(t *testing.T) {
 	mockDB := new(MockDocumentStore)
@@ -225,3 +485,133 @@ func TestQuerySubspaces(t *testing.T) {
 	assert.Len(t, results, 1)
 	assert.Equal(t, subspaceID, results[0].ID)
 }
+
+// Test listing causality keys with metadata
+func TestListCausalityKeys(t *testing.T) {
+	mockDB := new(MockDocumentStore)
+	manager := NewCausalityManager(mockDB)
+
+	// Create test data
+	subspaceID := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+	now := time.Now().Unix()
+	causalityDoc := map[string]interface{}{
+		"_id":         subspaceID,
+		"id":          subspaceID,
+		"doc_type":    DocTypeCausality,
+		"subspace_id": subspaceID,
+		"keys": map[string]interface{}{
+			"30302": float64(2),
+			"30301": float64(0),
+		},
+		"key_meta": map[string]interface{}{
+			"30302": map[string]interface{}{
+				"label":      "vote",
+				"updated":    float64(now),
+				"last_event": "event2",
+			},
+		},
+	}
+
+	// Set mock behavior
+	mockDB.On("Get", mock.Anything, subspaceID, (*iface.DocumentStoreGetOptions)(nil)).Return([]interface{}{causalityDoc}, nil)
+
+	// Execute test
+	keys, err := manager.ListCausalityKeys(context.Background(), subspaceID)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, uint32(30301), keys[0].Key)
+	assert.Equal(t, uint64(0), keys[0].Counter)
+	assert.Equal(t, "", keys[0].Label)
+	assert.Equal(t, uint32(30302), keys[1].Key)
+	assert.Equal(t, uint64(2), keys[1].Counter)
+	assert.Equal(t, "vote", keys[1].Label)
+	assert.Equal(t, now, keys[1].Updated)
+	assert.Equal(t, "event2", keys[1].LastEvent)
+
+	// An unknown subspace is a typed error
+	unknownID := "0x00000000000000000000000000000000000000000000000000000000000000ff"
+	mockDB.On("Get", mock.Anything, unknownID, (*iface.DocumentStoreGetOptions)(nil)).Return([]interface{}{}, nil)
+	_, err = manager.ListCausalityKeys(context.Background(), unknownID)
+	assert.ErrorIs(t, err, ErrSubspaceNotFound)
+}
+
+// memoryKeyValueStore is an in-memory KeyValueStore supporting Put, Get, Delete and All
+type memoryKeyValueStore struct {
+	iface.KeyValueStore
+	values map[string][]byte
+	scans  int // Number of All calls
+}
+
+func (s *memoryKeyValueStore) All() map[string][]byte {
+	s.scans++
+	return s.values
+}
+
+func (s *memoryKeyValueStore) Put(ctx context.Context, key string, value []byte) (operation.Operation, error) {
+	s.values[key] = value
+	return nil, nil
+}
+
+func (s *memoryKeyValueStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.values[key], nil
+}
+
+func (s *memoryKeyValueStore) Delete(ctx context.Context, key string) (operation.Operation, error) {
+	delete(s.values, key)
+	return nil, nil
+}
+
+// Test that counters move from the causality documents into a keyvalue store
+func TestKeyValueCounters(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDocumentStore("kv-counters")
+	subspaceID := "0x00000000000000000000000000000000000000000000000000000000000000e5"
+
+	// Counters written before the keyvalue store was enabled
+	create := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30100,
+		Tags: nostr.Tags{{"sid", subspaceID}, {"ops", "post=30300,vote=30302"}}})
+	post := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000100, Kind: 30300,
+		Tags: nostr.Tags{{"sid", subspaceID}, {"op", "post"}}})
+	require.NoError(t, NewOrbitDBAdapter(db).SaveEvents(ctx, []*nostr.Event{create, post}))
+
+	kv := &memoryKeyValueStore{values: make(map[string][]byte)}
+	adapter := NewOrbitDBAdapter(db)
+	adapter.EnableKeyValueCounters(kv)
+
+	counter, err := adapter.GetCausalityKey(ctx, subspaceID, 30300)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), counter, "counters left in the document are read")
+
+	vote := signAs(t, "bob", &nostr.Event{CreatedAt: 1700000200, Kind: 30302,
+		Tags: nostr.Tags{{"sid", subspaceID}, {"op", "vote"}}})
+	simulation, err := adapter.SimulateEvent(ctx, vote)
+	require.NoError(t, err)
+	assert.Contains(t, simulation.Changes, &FieldChange{DocID: subspaceID, DocType: DocTypeCausality, Field: "keys.30302", Before: 0, After: 1})
+	assert.Empty(t, kv.values, "simulations don't write counters")
+
+	require.NoError(t, adapter.SaveEvent(ctx, vote))
+	assert.Equal(t, map[string][]byte{
+		subspaceID + "/30300": []byte("1"),
+		subspaceID + "/30302": []byte("1"),
+	}, kv.values)
+
+	docs, err := db.Get(ctx, subspaceID, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Empty(t, docs[0].(map[string]interface{})["keys"], "the document no longer holds counters")
+
+	subspaces, err := adapter.QuerySubspaces(ctx, func(causality *SubspaceCausality) bool {
+		return causality.Keys[30302] == 1
+	})
+	require.NoError(t, err)
+	assert.Len(t, subspaces, 1)
+	assert.Zero(t, kv.scans, "counters are read by key, without scanning the store")
+
+	// A rebuild recounts into the keyvalue store
+	kv.values[subspaceID+"/30300"] = []byte("42")
+	_, err = adapter.RebuildDerivedData(ctx)
+	require.NoError(t, err)
+	keys, err := adapter.GetAllCausalityKeys(ctx, subspaceID)
+	require.NoError(t, err)
+	assert.Equal(t, map[uint32]uint64{30300: 1, 30302: 1}, keys)
+}
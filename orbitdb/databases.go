@@ -0,0 +1,47 @@
+package orbitdb
+
+import "berty.tech/go-orbit-db/iface"
+
+// SplitAddresses are the addresses of the databases split by document type
+type SplitAddresses struct {
+	Events    string `json:"events"`    // Store of the nostr events
+	Causality string `json:"causality"` // Store of the causality documents
+	Stats     string `json:"stats"`     // Store of user statistics and the remaining documents
+}
+
+// DatabaseInfo lists the databases other nodes open to serve the same data, in the terms of
+// the orbitdb configuration section
+type DatabaseInfo struct {
+	Address   string          `json:"address,omitempty"`    // Single-store database address, orbitdb.address
+	Stores    *SplitAddresses `json:"stores,omitempty"`     // Split databases, orbitdb.stores
+	MigrateTo *DatabaseInfo   `json:"migrate_to,omitempty"` // Databases a running migration copies into
+	Counters  string          `json:"counters,omitempty"`   // Keyvalue store of the causality counters, causality.counters_address
+}
+
+// databaseInfo describes the databases behind a document store
+func databaseInfo(db iface.DocumentStore) DatabaseInfo {
+	switch db := db.(type) {
+	case *SplitStore:
+		return DatabaseInfo{Stores: &SplitAddresses{
+			Events:    db.Events().Address().String(),
+			Causality: db.Causality().Address().String(),
+			Stats:     db.Stats().Address().String(),
+		}}
+	case *MigrationStore:
+		info := databaseInfo(db.DocumentStore)
+		target := databaseInfo(db.newDB)
+		info.MigrateTo = &target
+		return info
+	default:
+		return DatabaseInfo{Address: db.Address().String()}
+	}
+}
+
+// Databases lists the databases backing the adapter
+func (a *OrbitDBAdapter) Databases() DatabaseInfo {
+	info := databaseInfo(a.db)
+	if counters, ok := a.causalityMgr.counters.(*KeyValueCounters); ok {
+		info.Counters = counters.kv.Address().String()
+	}
+	return info
+}
@@ -0,0 +1,28 @@
+package orbitdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that the listed databases match the orbitdb configuration needed to open them
+func TestDatabases(t *testing.T) {
+	single := NewMemoryDocumentStore("single")
+	info := NewOrbitDBAdapter(single).Databases()
+	assert.Equal(t, single.Address().String(), info.Address)
+	assert.Nil(t, info.Stores)
+
+	events, causality, stats := NewMemoryDocumentStore("events"), NewMemoryDocumentStore("causality"), NewMemoryDocumentStore("stats")
+	split := NewSplitStore(events, causality, stats)
+	info = NewOrbitDBAdapter(NewMigrationStore(single, split)).Databases()
+	assert.Equal(t, single.Address().String(), info.Address)
+	require.NotNil(t, info.MigrateTo)
+	assert.Empty(t, info.MigrateTo.Address)
+	assert.Equal(t, &SplitAddresses{
+		Events:    events.Address().String(),
+		Causality: causality.Address().String(),
+		Stats:     stats.Address().String(),
+	}, info.MigrateTo.Stores)
+}
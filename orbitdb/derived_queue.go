@@ -0,0 +1,288 @@
+package orbitdb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// DerivedDataOptions configures asynchronous derived data updates
+type DerivedDataOptions struct {
+	QueueSize    int           // Events waiting for their derived data, beyond which writes wait for room
+	MaxRetries   int           // Retries of a failed update before it is given up
+	RetryBackoff time.Duration // Wait before the first retry, doubled on each further retry
+}
+
+// DerivedDataStats describes the derived data update pipeline
+type DerivedDataStats struct {
+	Async     bool   `json:"async"`     // Whether derived data is updated in the background
+	Pending   int64  `json:"pending"`   // Events whose derived data is not updated yet
+	Processed uint64 `json:"processed"` // Events whose derived data was updated in the background
+	Retries   uint64 `json:"retries"`   // Retried updates
+	Failed    uint64 `json:"failed"`    // Updates given up after all retries
+	Waited    uint64 `json:"waited"`    // Writes that waited for room in the full queue
+}
+
+// derivedStep updates one kind of derived data from an event
+type derivedStep struct {
+	name   string
+	update func(ctx context.Context, event *nostr.Event) error
+}
+
+// derivedSteps lists the derived data updates of an event run after its access steps, in
+// the order they must run: leaderboards read the user statistics and proposals the votes
+// recorded with them. Registered processors run last.
+func (a *OrbitDBAdapter) derivedSteps() []derivedStep {
+	steps := []derivedStep{
+		{"causality", a.causalityMgr.UpdateFromEvent},
+		{"user statistics", a.userStatsMgr.UpdateUserStatsFromEvent},
+		{"leaderboards", a.leaderboardMgr.UpdateFromEvent},
+		{"proposals", a.proposalMgr.UpdateFromEvent},
+		{"user profiles", a.userProfileMgr.UpdateFromEvent},
+		{"follow graph", a.followGraphMgr.UpdateFromEvent},
+		{"mute lists", a.muteListMgr.UpdateFromEvent},
+		{"subspace activity", a.subspaceActivityMgr.UpdateFromEvent},
+		{"subspace statistics", a.subspaceStatsMgr.UpdateFromEvent},
+		{"activity histograms", a.activityHistogramMgr.UpdateFromEvent},
+		{"cross-subspace references", a.xrefMgr.UpdateFromEvent},
+	}
+	return append(steps, a.processorSteps()...)
+}
+
+// accessSteps lists the derived data read by checkAccess: the subspace metadata and the
+// votes. They run as the event is saved, even with asynchronous derived data, so every
+// write is checked against the writes before it.
+func (a *OrbitDBAdapter) accessSteps() []derivedStep {
+	return []derivedStep{
+		{"votes", a.voteMgr.UpdateFromEvent},
+		{"subspace metadata", a.subspaceMetaMgr.UpdateFromEvent},
+	}
+}
+
+// derivedQueue applies derived data updates on a background worker, so writes return once
+// the event is stored. A single worker applies updates in arrival order, as the
+// read-modify-write updates of shared documents must not interleave. A full queue slows
+// writes down to the pace of the worker; updates never run beside it.
+type derivedQueue struct {
+	opts   DerivedDataOptions
+	events chan queuedEvent
+	slots  chan struct{} // One per queued or reserved event, bounding the queue
+
+	ctx     context.Context // Stops the worker once cancelled
+	cancel  context.CancelFunc
+	stopped chan struct{} // Closed when the worker exits
+
+	pending   atomic.Int64
+	processed atomic.Uint64
+	retries   atomic.Uint64
+	failed    atomic.Uint64
+	waited    atomic.Uint64
+}
+
+// queuedEvent is an event waiting for its derived data update, with the span that saved it
+type queuedEvent struct {
+	event *nostr.Event
+	saved trace.SpanContext
+}
+
+// newDerivedQueue creates a queue of size events, whose worker stops once cancelled
+func newDerivedQueue(opts DerivedDataOptions) *derivedQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &derivedQueue{
+		opts:    opts,
+		events:  make(chan queuedEvent, opts.QueueSize),
+		slots:   make(chan struct{}, opts.QueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+}
+
+// EnableAsyncDerivedData moves derived data updates of saved events to a background worker
+// with a queue of opts.QueueSize events. Reads may lag writes until the queue drains; see
+// FlushDerivedData. The access steps checked by later writes are still updated as events
+// are saved. Must be called before the adapter is used; CloseDerivedData stops the worker.
+func (a *OrbitDBAdapter) EnableAsyncDerivedData(opts DerivedDataOptions) {
+	q := newDerivedQueue(opts)
+	a.derived = q
+	go a.runDerivedQueue(q)
+}
+
+// runDerivedQueue applies queued updates until the queue is closed
+func (a *OrbitDBAdapter) runDerivedQueue(q *derivedQueue) {
+	defer close(q.stopped)
+
+	for {
+		var queued queuedEvent
+		select {
+		case <-q.ctx.Done():
+			return
+		case queued = <-q.events:
+		}
+
+		// The update is traced on its own, linked to the write that queued it
+		ctx, span := startSpan(q.ctx, "orbitdb.DerivedQueue", attribute.Int64("crelay.queue.pending", q.pending.Load()))
+		span.AddLink(trace.Link{SpanContext: queued.saved})
+		failed := a.applyDerivedData(ctx, queued.event, a.derivedSteps(), q)
+		span.End()
+		q.processed.Add(1)
+		q.failed.Add(uint64(failed))
+		q.pending.Add(-1)
+		<-q.slots
+	}
+}
+
+// reserve waits until the queue has room for another event and holds it for the next
+// enqueue, or returns the ctx error. Writers call it before storing their events, so a full
+// queue refuses writes whose context ends first instead of storing events it can't take.
+func (q *derivedQueue) reserve(ctx context.Context) error {
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	q.waited.Add(1)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-q.ctx.Done():
+		return fmt.Errorf("derived data queue closed: %w", q.ctx.Err())
+	case q.slots <- struct{}{}:
+		return nil
+	}
+}
+
+// release gives back the room reserved for an event that wasn't stored
+func (q *derivedQueue) release() {
+	<-q.slots
+}
+
+// enqueue queues the derived data update of a stored event, in the room reserved for it if
+// reserved is set. Otherwise it waits for room, ignoring ctx: the event is stored already,
+// and its update must be neither dropped nor applied out of order. Updates of events stored
+// after the queue is closed are dropped.
+func (q *derivedQueue) enqueue(ctx context.Context, event *nostr.Event, reserved bool) {
+	if !reserved {
+		select {
+		case <-q.ctx.Done():
+			return
+		case q.slots <- struct{}{}:
+		}
+	}
+	q.pending.Add(1)
+	// Never blocks: every queued event holds one of the slots, as many as the queue has room
+	q.events <- queuedEvent{event: event, saved: trace.SpanContextFromContext(ctx)}
+}
+
+// applyDerivedData runs the derived data updates of an event. Failed updates are retried
+// with backoff if q is set, until ctx is done, then logged. Returns the number of updates
+// given up.
+func (a *OrbitDBAdapter) applyDerivedData(ctx context.Context, event *nostr.Event, steps []derivedStep, q *derivedQueue) int {
+	defer a.cache.invalidateEvent(event)
+
+	failed := 0
+	for _, step := range steps {
+		stepCtx, span := startSpan(ctx, "orbitdb.derived "+step.name, eventAttributes(event)...)
+		err := step.update(stepCtx, event)
+		if q != nil {
+			backoff := q.opts.RetryBackoff
+			for attempt := 0; err != nil && attempt < q.opts.MaxRetries && sleepContext(ctx, backoff); attempt++ {
+				q.retries.Add(1)
+				span.AddEvent("retry", trace.WithAttributes(attribute.String("error", err.Error())))
+				backoff *= 2
+				err = step.update(stepCtx, event)
+			}
+		}
+		endSpan(span, err)
+		if err != nil {
+			// Derived data doesn't affect event storage
+			zap.L().Warn("Failed to update derived data", zap.String("step", step.name), zap.String("event", event.ID), zap.Error(err))
+			failed++
+		}
+	}
+	return failed
+}
+
+// sleepContext waits for d, returning false if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// reserveDerivedRoom waits until the derived data queue has room for another event and
+// reserves it, or returns the ctx error. Returns immediately if derived data is updated
+// synchronously. Writers that reserved room pass reserved to updateDerivedData for their
+// first stored event, or call releaseDerivedRoom if they store none.
+func (a *OrbitDBAdapter) reserveDerivedRoom(ctx context.Context) error {
+	if a.derived == nil {
+		return nil
+	}
+	return a.derived.reserve(ctx)
+}
+
+// releaseDerivedRoom gives back the room reserved by reserveDerivedRoom for a write that
+// stored nothing
+func (a *OrbitDBAdapter) releaseDerivedRoom() {
+	if a.derived != nil {
+		a.derived.release()
+	}
+}
+
+// FlushDerivedData waits until the derived data of every saved event is updated, or ctx is
+// done. Returns immediately if derived data is updated synchronously.
+func (a *OrbitDBAdapter) FlushDerivedData(ctx context.Context) error {
+	if a.derived == nil {
+		return nil
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for a.derived.pending.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// CloseDerivedData stops the derived data worker, waiting for the update it is applying to
+// end; its retries are abandoned. Updates still queued are dropped, so callers flush the
+// queue with FlushDerivedData first. Does nothing if derived data is updated synchronously.
+func (a *OrbitDBAdapter) CloseDerivedData() {
+	if a.derived == nil {
+		return
+	}
+	a.derived.cancel()
+	<-a.derived.stopped
+}
+
+// DerivedDataStats returns the state of the derived data update pipeline
+func (a *OrbitDBAdapter) DerivedDataStats() DerivedDataStats {
+	q := a.derived
+	if q == nil {
+		return DerivedDataStats{}
+	}
+	return DerivedDataStats{
+		Async:     true,
+		Pending:   q.pending.Load(),
+		Processed: q.processed.Load(),
+		Retries:   q.retries.Load(),
+		Failed:    q.failed.Load(),
+		Waited:    q.waited.Load(),
+	}
+}
@@ -0,0 +1,297 @@
+package orbitdb
+
+import (
+	"container/heap"
+	"context"
+	"io"
+	"sort"
+
+	"berty.tech/go-orbit-db/iface"
+
+	"github.com/nbd-wtf/go-nostr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// eventCursorBuffer is the number of matched documents the scan of an unlimited cursor may
+// read ahead of Next before it waits for the caller
+var eventCursorBuffer = MaxQueryBuffer
+
+// EventCursor iterates over the events matching a filter with a single scan of the store. A
+// limited query keeps the latest Limit matches while scanning and returns them newest first.
+// An unlimited query streams its matches in store order from a scan running in the
+// background, at most eventCursorBuffer documents ahead of the caller, so the cursor holds a
+// bounded number of documents whatever the size of the result.
+type EventCursor struct {
+	docs   []interface{}               // Matched documents of a limited query, newest first
+	pos    int                         // Next document of docs to return
+	stream chan map[string]interface{} // Matched documents of an unlimited query
+	stop   context.CancelFunc          // Stops the scan feeding stream
+	err    error                       // Failure of the scan, set before stream is closed
+}
+
+// OpenEventCursor runs the query and returns a cursor over the matching events. A positive
+// filter Limit keeps only the latest Limit events, ordered by created_at descending, ties by
+// ID; they are scanned here, and a failed scan is returned. Without a limit, events come in
+// store order from a scan started here and read as Next asks for them; a failed scan is
+// returned by Next. The scan runs under ctx and the query timeout, and the caller must read
+// the cursor to the end or Close it to stop the scan.
+func (a *OrbitDBAdapter) OpenEventCursor(ctx context.Context, filter nostr.Filter) (_ *EventCursor, err error) {
+	ctx, span := startSpan(ctx, "orbitdb.QueryEvents", attribute.String("nostr.filter", filter.String()))
+	defer func() { endSpan(span, err) }()
+
+	exclusion, err := a.QueryExclusion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches := func(doc interface{}) (map[string]interface{}, bool) {
+		event, ok := doc.(map[string]interface{})
+		return event, ok && matchesFilter(event, filter) && !exclusion.excludesDoc(event)
+	}
+
+	if filter.Limit <= 0 {
+		scanCtx, stop := a.scanContext(ctx, true)
+		c := &EventCursor{stream: make(chan map[string]interface{}, eventCursorBuffer), stop: stop}
+		go c.scan(scanCtx, a.events, matches)
+		return c, nil
+	}
+
+	scanCtx, cancel := a.scanContext(ctx, true)
+	defer cancel()
+
+	latest := newLatestEventDocs(filter.Limit)
+	queryFn := func(doc interface{}) (bool, error) {
+		if event, ok := matches(doc); ok {
+			latest.offer(event)
+		}
+		// Matches are kept by latest, not collected by the store
+		return false, nil
+	}
+	if _, err := queryDocuments(scanCtx, a.events, queryFn); err != nil {
+		return nil, err
+	}
+
+	c := &EventCursor{docs: latest.sorted()}
+	span.SetAttributes(attribute.Int("crelay.documents", len(c.docs)))
+	return c, nil
+}
+
+// scan sends the documents of db accepted by matches on the cursor stream, waiting while the
+// stream is full, and closes it at the end of the scan or once ctx is done
+func (c *EventCursor) scan(ctx context.Context, db iface.DocumentStore, matches func(doc interface{}) (map[string]interface{}, bool)) {
+	defer close(c.stream)
+	defer c.stop()
+
+	_, c.err = queryDocuments(ctx, db, func(doc interface{}) (bool, error) {
+		event, ok := matches(doc)
+		if !ok {
+			return false, nil
+		}
+		select {
+		case c.stream <- event:
+			// Matches are sent on the stream, not collected by the store
+			return false, nil
+		case <-ctx.Done():
+			return false, scanStopped(ctx)
+		}
+	})
+}
+
+// latestEventDocs collects the limit latest event documents of a scan in a bounded heap
+type latestEventDocs struct {
+	limit int
+	heap  eventDocHeap
+}
+
+// newLatestEventDocs creates a collector keeping the limit latest documents
+func newLatestEventDocs(limit int) *latestEventDocs {
+	return &latestEventDocs{limit: limit}
+}
+
+// offer adds a document if it is among the limit latest seen so far
+func (l *latestEventDocs) offer(doc map[string]interface{}) {
+	if len(l.heap) < l.limit {
+		heap.Push(&l.heap, doc)
+		return
+	}
+	if newerEventDoc(doc, l.heap[0]) {
+		l.heap[0] = doc
+		heap.Fix(&l.heap, 0)
+	}
+}
+
+// sorted returns the collected documents, newest first
+func (l *latestEventDocs) sorted() []interface{} {
+	docs := make([]interface{}, len(l.heap))
+	for i, doc := range l.heap {
+		docs[i] = doc
+	}
+	l.heap = nil
+	sortEventDocs(docs)
+	return docs
+}
+
+// eventDocHeap is a min-heap of event documents, the oldest document is at the root
+type eventDocHeap []map[string]interface{}
+
+func (h eventDocHeap) Len() int            { return len(h) }
+func (h eventDocHeap) Less(i, j int) bool  { return newerEventDoc(h[j], h[i]) }
+func (h eventDocHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *eventDocHeap) Push(x interface{}) { *h = append(*h, x.(map[string]interface{})) }
+func (h *eventDocHeap) Pop() interface{} {
+	old := *h
+	doc := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return doc
+}
+
+// newerEventDoc reports whether event document a comes before b newest first, ties by ID
+func newerEventDoc(a, b map[string]interface{}) bool {
+	ca, _ := docInt64(a["created_at"])
+	cb, _ := docInt64(b["created_at"])
+	if ca != cb {
+		return ca > cb
+	}
+	ida, _ := a["_id"].(string)
+	idb, _ := b["_id"].(string)
+	return ida < idb
+}
+
+// Helper function: sort event documents newest first, ties by ID
+func sortEventDocs(docs []interface{}) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		a, _ := docs[i].(map[string]interface{})
+		b, _ := docs[j].(map[string]interface{})
+		return newerEventDoc(a, b)
+	})
+}
+
+// Next returns the next event. It returns io.EOF once all events have been returned, the
+// error of a failed scan, or the context error if ctx is done.
+func (c *EventCursor) Next(ctx context.Context) (*nostr.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if c.stream != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case doc, ok := <-c.stream:
+			if !ok {
+				if c.err != nil {
+					return nil, c.err
+				}
+				return nil, io.EOF
+			}
+			return docToEvent(doc), nil
+		}
+	}
+
+	for c.pos < len(c.docs) {
+		doc := c.docs[c.pos]
+		c.docs[c.pos] = nil // Release the document once it has been consumed
+		c.pos++
+
+		// Directly build event object, not via JSON serialization/deserialization
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			zap.L().Warn("Skipping event document with invalid format")
+			continue
+		}
+		return docToEvent(docMap), nil
+	}
+	return nil, io.EOF
+}
+
+// Remaining returns the number of events read ahead of Next: all the events a limited query
+// has left, the buffered ones of an unlimited query whose scan may match more.
+func (c *EventCursor) Remaining() int {
+	if c.stream != nil {
+		return len(c.stream)
+	}
+	return len(c.docs) - c.pos
+}
+
+// Close stops the scan of an unlimited query, waiting for it to end, and releases the
+// remaining documents. Next returns io.EOF afterwards.
+func (c *EventCursor) Close() error {
+	if c.stream != nil {
+		c.stop()
+		for range c.stream {
+		}
+		c.stream = nil
+	}
+	c.docs = nil
+	c.pos = 0
+	return nil
+}
+
+// MaxQueryBuffer is the largest result channel buffer of QueryEventsBuffered
+const MaxQueryBuffer = 1024
+
+// QueryEventsBuffered is QueryEvents with a result channel holding up to buffer events,
+// at most MaxQueryBuffer, so the producer can run ahead of a slow consumer. The producing
+// goroutine exits when all events are sent or ctx is done, so consumers that stop reading
+// early must cancel ctx. An unlimited query whose scan fails once started closes the channel
+// early; the failure is recorded on the ScanReport of ctx, if any, to tell it apart from the end of
+// the results.
+func (a *OrbitDBAdapter) QueryEventsBuffered(ctx context.Context, filter nostr.Filter, buffer int) (chan *nostr.Event, error) {
+	buffer = max(0, min(buffer, MaxQueryBuffer))
+
+	cursor, err := a.OpenEventCursor(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	eventChan := make(chan *nostr.Event, buffer)
+	go func() {
+		defer close(eventChan)
+		defer cursor.Close()
+
+		for {
+			event, err := cursor.Next(ctx)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					zap.L().Warn("Event query failed after it started", zap.Error(err))
+				}
+				reportScanError(ctx, err)
+				return
+			}
+			if !sendEvent(ctx, eventChan, event) {
+				return
+			}
+		}
+	}()
+
+	return eventChan, nil
+}
+
+// StreamEvents sends events on a channel buffered and closed like the QueryEventsBuffered
+// channel, for stores answering queries from elsewhere, such as an index
+func StreamEvents(ctx context.Context, events []*nostr.Event, buffer int) chan *nostr.Event {
+	eventChan := make(chan *nostr.Event, max(0, min(buffer, MaxQueryBuffer)))
+	go func() {
+		defer close(eventChan)
+
+		for _, event := range events {
+			if !sendEvent(ctx, eventChan, event) {
+				return
+			}
+		}
+	}()
+	return eventChan
+}
+
+// sendEvent sends an event on a query channel. It returns false if ctx is done first.
+func sendEvent(ctx context.Context, eventChan chan<- *nostr.Event, event *nostr.Event) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case eventChan <- event:
+		return true
+	}
+}
@@ -0,0 +1,219 @@
+package orbitdb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test iterating events with a cursor
+func TestEventCursor(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("cursor"))
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{Content: "event-1", CreatedAt: 1700000000, Kind: 1}),
+		signAs(t, "alice", &nostr.Event{Content: "event-2", CreatedAt: 1700000100, Kind: 1}),
+		signAs(t, "alice", &nostr.Event{Content: "event-3", CreatedAt: 1700000200, Kind: 7}),
+	}))
+
+	cursor, err := adapter.OpenEventCursor(ctx, nostr.Filter{Kinds: []int{1}})
+	require.NoError(t, err)
+
+	var ids []string
+	for {
+		event, err := cursor.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		ids = append(ids, event.Content)
+	}
+	assert.ElementsMatch(t, []string{"event-2", "event-1"}, ids)
+
+	// A limit keeps the latest events
+	cursor, err = adapter.OpenEventCursor(ctx, nostr.Filter{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 2, cursor.Remaining())
+	event, err := cursor.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "event-3", event.Content, "newest first")
+
+	// A cancelled context stops the iteration
+	cursor, err = adapter.OpenEventCursor(ctx, nostr.Filter{})
+	require.NoError(t, err)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = cursor.Next(cancelled)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	require.NoError(t, cursor.Close())
+	_, err = cursor.Next(ctx)
+	assert.Equal(t, io.EOF, err)
+}
+
+// Test that a buffered query produces events without a reader and stops on cancellation
+func TestQueryEventsBuffered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("buffered"))
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{Content: "event-1", CreatedAt: 1700000000, Kind: 1}),
+		signAs(t, "alice", &nostr.Event{Content: "event-2", CreatedAt: 1700000100, Kind: 1}),
+		signAs(t, "alice", &nostr.Event{Content: "event-3", CreatedAt: 1700000200, Kind: 1}),
+	}))
+
+	eventChan, err := adapter.QueryEventsBuffered(ctx, nostr.Filter{Limit: 3}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, cap(eventChan))
+
+	event := <-eventChan
+	assert.Equal(t, "event-3", event.Content)
+
+	// Stop reading early; the producer exits and closes the channel
+	cancel()
+	for range eventChan {
+	}
+}
+
+// Test that a limited query keeps the latest events whatever the scan order
+func TestLatestEventDocs(t *testing.T) {
+	latest := newLatestEventDocs(3)
+	for i, created := range []int64{5, 1, 9, 3, 7, 9, 2} {
+		latest.offer(map[string]interface{}{"_id": string(rune('a' + i)), "created_at": created})
+	}
+	var ids []string
+	for _, doc := range latest.sorted() {
+		ids = append(ids, doc.(map[string]interface{})["_id"].(string))
+	}
+	assert.Equal(t, []string{"c", "f", "e"}, ids)
+}
+
+// Test that an unlimited query streams its matches from a single scan, no further ahead of
+// the reader than the cursor buffer
+func TestEventCursorStream(t *testing.T) {
+	defer func(size int) { eventCursorBuffer = size }(eventCursorBuffer)
+	eventCursorBuffer = 2
+
+	ctx := context.Background()
+	store := &countingQueryStore{MemoryDocumentStore: NewMemoryDocumentStore("stream")}
+	adapter := NewOrbitDBAdapter(store)
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{Content: "event-1", CreatedAt: 1700000000, Kind: 1}),
+		signAs(t, "alice", &nostr.Event{Content: "event-2", CreatedAt: 1700000100, Kind: 1}),
+		signAs(t, "alice", &nostr.Event{Content: "event-3", CreatedAt: 1700000100, Kind: 1}),
+		signAs(t, "alice", &nostr.Event{Content: "event-4", CreatedAt: 1700000200, Kind: 1}),
+		signAs(t, "alice", &nostr.Event{Content: "event-5", CreatedAt: 1700000300, Kind: 7}),
+	}))
+	store.queries.Store(0)
+
+	cursor, err := adapter.OpenEventCursor(ctx, nostr.Filter{})
+	require.NoError(t, err)
+	var ids []string
+	for {
+		assert.LessOrEqual(t, cursor.Remaining(), 2, "the scan waits for the reader")
+		event, err := cursor.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		ids = append(ids, event.Content)
+	}
+	assert.ElementsMatch(t, []string{"event-1", "event-2", "event-3", "event-4", "event-5"}, ids)
+	assert.EqualValues(t, 1, store.queries.Load(), "one scan for the whole result")
+
+	// Closing a cursor early stops its scan
+	cursor, err = adapter.OpenEventCursor(ctx, nostr.Filter{Kinds: []int{1}})
+	require.NoError(t, err)
+	_, err = cursor.Next(ctx)
+	require.NoError(t, err)
+	require.NoError(t, cursor.Close())
+	_, err = cursor.Next(ctx)
+	assert.Equal(t, io.EOF, err)
+}
+
+// countingQueryStore is a memory store counting its queries
+type countingQueryStore struct {
+	*MemoryDocumentStore
+	queries atomic.Int32
+}
+
+func (s *countingQueryStore) Query(ctx context.Context, filter func(doc interface{}) (bool, error)) ([]interface{}, error) {
+	s.queries.Add(1)
+	return s.MemoryDocumentStore.Query(ctx, filter)
+}
+
+// failingQueryStore is a memory store whose queries fail after reading a number of documents
+// once it is armed
+type failingQueryStore struct {
+	*MemoryDocumentStore
+	armed bool
+	after int
+}
+
+func (s *failingQueryStore) Query(ctx context.Context, filter func(doc interface{}) (bool, error)) ([]interface{}, error) {
+	if !s.armed {
+		return s.MemoryDocumentStore.Query(ctx, filter)
+	}
+	read := 0
+	return s.MemoryDocumentStore.Query(ctx, func(doc interface{}) (bool, error) {
+		if read++; read > s.after {
+			return false, errors.New("store unavailable")
+		}
+		return filter(doc)
+	})
+}
+
+// Test that a query failing after its scan started reports the failure instead of ending quietly
+func TestQueryEventsScanFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &failingQueryStore{MemoryDocumentStore: NewMemoryDocumentStore("failing"), after: 2}
+	adapter := NewOrbitDBAdapter(store)
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{Content: "event-1", CreatedAt: 1700000000, Kind: 1}),
+		signAs(t, "alice", &nostr.Event{Content: "event-2", CreatedAt: 1700000100, Kind: 1}),
+		signAs(t, "alice", &nostr.Event{Content: "event-3", CreatedAt: 1700000200, Kind: 1}),
+	}))
+	store.armed = true
+
+	ctx, scan := WithScanReport(ctx)
+	eventChan, err := adapter.QueryEvents(ctx, nostr.Filter{})
+	require.NoError(t, err)
+	var ids []string
+	for event := range eventChan {
+		ids = append(ids, event.Content)
+	}
+	assert.Less(t, len(ids), 3)
+	assert.EqualError(t, scan.Err(), "store unavailable")
+
+	// A limited query fails before returning anything
+	_, err = adapter.QueryEvents(ctx, nostr.Filter{Limit: 2})
+	assert.EqualError(t, err, "store unavailable")
+}
+
+// Test that events with the same timestamp are ordered by ID
+func TestQueryEventsOrderTies(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("order"))
+	first := signAs(t, "alice", &nostr.Event{Content: "first", CreatedAt: 1700000000, Kind: 1})
+	second := signAs(t, "alice", &nostr.Event{Content: "second", CreatedAt: 1700000000, Kind: 1})
+	older := signAs(t, "alice", &nostr.Event{Content: "older", CreatedAt: 1699999999, Kind: 1})
+	if second.ID < first.ID {
+		first, second = second, first
+	}
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{second, first, older}))
+
+	eventChan, err := adapter.QueryEvents(ctx, nostr.Filter{Limit: 3})
+	require.NoError(t, err)
+	var ids []string
+	for event := range eventChan {
+		ids = append(ids, event.ID)
+	}
+	assert.Equal(t, []string{first.ID, second.ID, older.ID}, ids)
+}
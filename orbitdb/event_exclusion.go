@@ -0,0 +1,103 @@
+package orbitdb
+
+import (
+	"context"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Context keys of the moderation applied to event queries and counts
+type (
+	muteFilterKey         struct{}
+	subspaceModerationKey struct{}
+)
+
+// WithMuteFilter returns a context whose event queries and counts leave out the events of
+// the users muted by the moderators
+func WithMuteFilter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, muteFilterKey{}, true)
+}
+
+// WithSubspaceModeration returns a context whose event queries and counts leave out the
+// events hidden by subspace operators and those of users banned from their subspace
+func WithSubspaceModeration(ctx context.Context) context.Context {
+	return context.WithValue(ctx, subspaceModerationKey{}, true)
+}
+
+// EventExclusion decides which events a moderated query leaves out. A nil EventExclusion
+// leaves out nothing.
+type EventExclusion struct {
+	muted     map[string]bool                // Authors muted by the moderators
+	subspaces map[string]*SubspaceModeration // Moderation of the moderated subspaces, by ID
+}
+
+// Excludes reports whether a query leaves out an event
+func (x *EventExclusion) Excludes(event *nostr.Event) bool {
+	if x == nil {
+		return false
+	}
+	if x.muted[event.PubKey] {
+		return true
+	}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" {
+			if m := x.subspaces[tag[1]]; m != nil && m.excludes(event.ID, event.PubKey) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// excludesDoc reports whether a query leaves out a stored event document
+func (x *EventExclusion) excludesDoc(doc map[string]interface{}) bool {
+	if x == nil {
+		return false
+	}
+	pubKey, _ := doc["pubkey"].(string)
+	if x.muted[pubKey] {
+		return true
+	}
+	if len(x.subspaces) == 0 {
+		return false
+	}
+	id, _ := doc["_id"].(string)
+	tags, _ := doc["tags"].([]interface{})
+	for _, tag := range tags {
+		tagArray, ok := tag.([]interface{})
+		if !ok || len(tagArray) < 2 || tagArray[0] != "sid" {
+			continue
+		}
+		if subspaceID, ok := tagArray[1].(string); ok {
+			if m := x.subspaces[subspaceID]; m != nil && m.excludes(id, pubKey) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// QueryExclusion returns the events queries and counts with ctx leave out, following the
+// moderation requested with WithMuteFilter and WithSubspaceModeration. Returns nil if they
+// leave out nothing.
+func (a *OrbitDBAdapter) QueryExclusion(ctx context.Context) (*EventExclusion, error) {
+	x := &EventExclusion{}
+	if mute, _ := ctx.Value(muteFilterKey{}).(bool); mute && len(a.moderators) > 0 {
+		muted, err := a.MutedAuthors(ctx)
+		if err != nil {
+			return nil, err
+		}
+		x.muted = muted
+	}
+	if moderate, _ := ctx.Value(subspaceModerationKey{}).(bool); moderate {
+		subspaces, err := a.subspaceModerationMgr.allSubspaceModeration(ctx)
+		if err != nil {
+			return nil, err
+		}
+		x.subspaces = subspaces
+	}
+	if len(x.muted) == 0 && len(x.subspaces) == 0 {
+		return nil, nil
+	}
+	return x, nil
+}
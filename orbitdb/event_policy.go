@@ -0,0 +1,169 @@
+package orbitdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
+)
+
+// ErrEventRejected is returned when an event fails the acceptance policy
+var ErrEventRejected = errors.New("event rejected by policy")
+
+// EventPolicy decides whether an event may be saved
+type EventPolicy interface {
+	// Name identifies the policy, e.g. "max_tags"
+	Name() string
+	// Check returns a reason if the event is not acceptable, empty to accept it
+	Check(event *nostr.Event) string
+}
+
+// EventPolicyInfo describes a configured policy
+type EventPolicyInfo struct {
+	Name   string      `json:"name"`   // Policy name
+	Config EventPolicy `json:"config"` // Policy settings
+}
+
+// PolicyChain evaluates policies in order; the first that refuses an event rejects it.
+// A nil PolicyChain accepts every event.
+type PolicyChain struct {
+	policies []EventPolicy
+}
+
+// NewPolicyChain creates a policy chain
+func NewPolicyChain(policies ...EventPolicy) *PolicyChain {
+	return &PolicyChain{policies: policies}
+}
+
+// Check returns an error wrapping ErrEventRejected if a policy refuses the event
+func (c *PolicyChain) Check(event *nostr.Event) error {
+	if c == nil {
+		return nil
+	}
+	for _, policy := range c.policies {
+		if reason := policy.Check(event); reason != "" {
+			return fmt.Errorf("%w: %s: %s", ErrEventRejected, policy.Name(), reason)
+		}
+	}
+	return nil
+}
+
+// Describe lists the policies of the chain in evaluation order
+func (c *PolicyChain) Describe() []EventPolicyInfo {
+	infos := []EventPolicyInfo{}
+	if c == nil {
+		return infos
+	}
+	for _, policy := range c.policies {
+		infos = append(infos, EventPolicyInfo{Name: policy.Name(), Config: policy})
+	}
+	return infos
+}
+
+// MaxSizePolicy refuses events whose JSON encoding is larger than MaxBytes
+type MaxSizePolicy struct {
+	MaxBytes int `json:"max_bytes"`
+}
+
+// Name returns the policy name
+func (p *MaxSizePolicy) Name() string { return "max_event_size" }
+
+// Check checks the event size
+func (p *MaxSizePolicy) Check(event *nostr.Event) string {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err.Error()
+	}
+	if len(data) > p.MaxBytes {
+		return fmt.Sprintf("event is %d bytes, at most %d allowed", len(data), p.MaxBytes)
+	}
+	return ""
+}
+
+// MaxTagsPolicy refuses events with more than MaxTags tags
+type MaxTagsPolicy struct {
+	MaxTags int `json:"max_tags"`
+}
+
+// Name returns the policy name
+func (p *MaxTagsPolicy) Name() string { return "max_tags" }
+
+// Check checks the tag count
+func (p *MaxTagsPolicy) Check(event *nostr.Event) string {
+	if len(event.Tags) > p.MaxTags {
+		return fmt.Sprintf("event has %d tags, at most %d allowed", len(event.Tags), p.MaxTags)
+	}
+	return ""
+}
+
+// KindsPolicy refuses events of kinds other than Allowed
+type KindsPolicy struct {
+	Allowed []int `json:"allowed"`
+}
+
+// Name returns the policy name
+func (p *KindsPolicy) Name() string { return "allowed_kinds" }
+
+// Check checks the event kind
+func (p *KindsPolicy) Check(event *nostr.Event) string {
+	for _, kind := range p.Allowed {
+		if kind == event.Kind {
+			return ""
+		}
+	}
+	return fmt.Sprintf("kind %d is not allowed", event.Kind)
+}
+
+// PubKeyPolicy refuses events of denied public keys and, if Allow is set, of public keys not
+// in it
+type PubKeyPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Name returns the policy name
+func (p *PubKeyPolicy) Name() string { return "pubkeys" }
+
+// Check checks the event author
+func (p *PubKeyPolicy) Check(event *nostr.Event) string {
+	if containsString(p.Deny, event.PubKey) {
+		return fmt.Sprintf("public key %s is denied", event.PubKey)
+	}
+	if len(p.Allow) > 0 && !containsString(p.Allow, event.PubKey) {
+		return fmt.Sprintf("public key %s is not allowed", event.PubKey)
+	}
+	return ""
+}
+
+// ProofOfWorkPolicy refuses events whose ID has less than MinDifficulty leading zero bits
+// (NIP-13). The ID must be the event's actual hash, so the work can't be skipped.
+type ProofOfWorkPolicy struct {
+	MinDifficulty int `json:"min_difficulty"`
+}
+
+// Name returns the policy name
+func (p *ProofOfWorkPolicy) Name() string { return "proof_of_work" }
+
+// Check checks the difficulty of the event ID
+func (p *ProofOfWorkPolicy) Check(event *nostr.Event) string {
+	if event.GetID() != event.ID {
+		return "event ID doesn't match its content"
+	}
+	if difficulty := nip13.Difficulty(event.ID); difficulty < p.MinDifficulty {
+		return fmt.Sprintf("difficulty %d, at least %d required", difficulty, p.MinDifficulty)
+	}
+	return ""
+}
+
+// SetEventPolicies sets the policies events must pass to be saved, nil to accept every
+// event. Must be called before the adapter is used.
+func (a *OrbitDBAdapter) SetEventPolicies(chain *PolicyChain) {
+	a.policies = chain
+}
+
+// EventPolicies describes the policies events must pass to be saved
+func (a *OrbitDBAdapter) EventPolicies() []EventPolicyInfo {
+	return a.policies.Describe()
+}
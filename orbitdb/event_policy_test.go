@@ -0,0 +1,72 @@
+package orbitdb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that SaveEvent refuses events failing a policy and names the policy
+func TestEventPolicies(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("policies"))
+	adapter.SetEventPolicies(NewPolicyChain(
+		&MaxSizePolicy{MaxBytes: 512},
+		&MaxTagsPolicy{MaxTags: 2},
+		&KindsPolicy{Allowed: []int{30300}},
+		&PubKeyPolicy{Deny: []string{testPubKey("mallory")}},
+	))
+
+	post := func(author string, kind int, tags nostr.Tags, content string) *nostr.Event {
+		return signAs(t, author, &nostr.Event{CreatedAt: 1700000000, Kind: kind, Tags: tags, Content: content})
+	}
+
+	assert.NoError(t, adapter.SaveEvent(ctx, post("alice", 30300, nostr.Tags{{"sid", "s"}}, "hi")))
+
+	rejected := []struct {
+		event  *nostr.Event
+		policy string
+	}{
+		{post("alice", 30300, nil, strings.Repeat("x", 600)), "max_event_size"},
+		{post("alice", 30300, nostr.Tags{{"a"}, {"b"}, {"c"}}, ""), "max_tags"},
+		{post("alice", 1, nil, ""), "allowed_kinds"},
+		{post("mallory", 30300, nil, ""), "pubkeys"},
+	}
+	for _, tc := range rejected {
+		err := adapter.SaveEvent(ctx, tc.event)
+		require.ErrorIs(t, err, ErrEventRejected, tc.policy)
+		assert.Contains(t, err.Error(), tc.policy)
+
+		saved, err := adapter.GetEventByID(ctx, tc.event.ID)
+		require.NoError(t, err)
+		assert.Nil(t, saved, "event rejected by %s is not stored", tc.policy)
+	}
+
+	infos := adapter.EventPolicies()
+	require.Len(t, infos, 4)
+	assert.Equal(t, "max_event_size", infos[0].Name)
+}
+
+// Test that proof of work is checked on the actual event hash
+func TestProofOfWorkPolicy(t *testing.T) {
+	policy := &ProofOfWorkPolicy{MinDifficulty: 4}
+
+	event := &nostr.Event{PubKey: strings.Repeat("a", 64), CreatedAt: 1700000000, Kind: 30300}
+	for nonce := 0; ; nonce++ {
+		event.Tags = nostr.Tags{{"nonce", strings.Repeat("1", nonce%50), "4"}}
+		event.CreatedAt++
+		event.ID = event.GetID()
+		if strings.HasPrefix(event.ID, "0") {
+			break
+		}
+	}
+	assert.Empty(t, policy.Check(event))
+
+	forged := *event
+	forged.ID = strings.Repeat("0", 64)
+	assert.NotEmpty(t, policy.Check(&forged))
+}
@@ -0,0 +1,103 @@
+package orbitdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// importBatchSize is the number of events saved per batch during import
+const importBatchSize = 100
+
+// ExportEvents writes the events matching filter to w as line-delimited JSON, one raw
+// Nostr event per line. The output is compatible with strfry and nostr-tools dumps.
+func (a *OrbitDBAdapter) ExportEvents(ctx context.Context, filter nostr.Filter, w io.Writer) (int, error) {
+	events, err := a.QueryEvents(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	exported := 0
+	for event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return exported, fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+		if _, err := bw.Write(append(data, '\n')); err != nil {
+			return exported, err
+		}
+		exported++
+	}
+	if err := ctx.Err(); err != nil {
+		return exported, err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return exported, err
+	}
+	return exported, nil
+}
+
+// ImportEvents reads line-delimited Nostr events from r and saves them in batches, checked
+// like SaveEvents. Blank lines are skipped; an invalid line or a refused event stops the
+// import.
+func (a *OrbitDBAdapter) ImportEvents(ctx context.Context, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBackupLineSize)
+
+	imported := 0
+	batch := make([]*nostr.Event, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		saved, err := a.saveEvents(ctx, batch, func(event *nostr.Event, err error) error {
+			return fmt.Errorf("event %s refused: %w", event.ID, err)
+		})
+		imported += saved
+		batch = make([]*nostr.Event, 0, importBatchSize)
+		return err
+	}
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return imported, ctx.Err()
+		default:
+		}
+
+		event := &nostr.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			return imported, fmt.Errorf("invalid event on line %d: %w", line, err)
+		}
+		if event.ID == "" {
+			return imported, fmt.Errorf("event on line %d has no id", line)
+		}
+
+		batch = append(batch, event)
+		if len(batch) >= importBatchSize {
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return imported, err
+	}
+
+	if err := flush(); err != nil {
+		return imported, err
+	}
+	return imported, nil
+}
@@ -0,0 +1,50 @@
+package orbitdb
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that events exported as JSONL import into another store
+func TestExportAndImportEvents(t *testing.T) {
+	ctx := context.Background()
+	source := NewOrbitDBAdapter(NewMemoryDocumentStore("source"))
+
+	events := []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 1, Tags: nostr.Tags{}, Content: "one"}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000100, Kind: 1, Tags: nostr.Tags{{"t", "x"}}, Content: "two"}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000200, Kind: 7, Tags: nostr.Tags{}, Content: "+"}),
+	}
+	require.NoError(t, source.SaveEvents(ctx, events))
+
+	var dump bytes.Buffer
+	count, err := source.ExportEvents(ctx, nostr.Filter{Kinds: []int{1}}, &dump)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// One raw event per line, without store fields
+	lines := strings.Split(strings.TrimSpace(dump.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.NotContains(t, dump.String(), "doc_type")
+
+	target := NewOrbitDBAdapter(NewMemoryDocumentStore("target"))
+	imported, err := target.ImportEvents(ctx, strings.NewReader(dump.String()+"\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, imported)
+
+	event, err := target.GetEventByID(ctx, events[1].ID)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, "two", event.Content)
+	assert.Equal(t, nostr.Tags{{"t", "x"}}, event.Tags)
+
+	// Invalid lines stop the import
+	_, err = target.ImportEvents(ctx, strings.NewReader("not json\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,331 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Follow graph document types: the follow list of a user, from their latest kind 3 event,
+// and its reverse, the users following a user
+const (
+	DocTypeFollowList = "follow_list"
+	DocTypeFollowers  = "followers"
+)
+
+// Follow relations, also the relations listed by ListFollows
+const (
+	FollowFollowing = "following" // Users the user follows
+	FollowFollowers = "followers" // Users following the user
+	FollowMutual    = "mutual"    // Users the user follows that follow them back
+)
+
+// FollowList is the contact list a user published in their latest kind 3 event
+type FollowList struct {
+	ID        string   `json:"id"`         // Document ID, format: follow_list:<pubkey>
+	DocType   string   `json:"doc_type"`   // Document type, fixed as "follow_list"
+	PubKey    string   `json:"pubkey"`     // Public key of the user
+	Following []string `json:"following"`  // Public keys from the p tags, sorted
+	EventID   string   `json:"event_id"`   // ID of the kind 3 event the list comes from
+	CreatedAt int64    `json:"created_at"` // Kind 3 event timestamp
+	Updated   int64    `json:"updated"`    // Update timestamp
+}
+
+// Followers lists the users whose follow lists name a user
+type Followers struct {
+	ID        string   `json:"id"`        // Document ID, format: followers:<pubkey>
+	DocType   string   `json:"doc_type"`  // Document type, fixed as "followers"
+	PubKey    string   `json:"pubkey"`    // Public key of the followed user
+	Followers []string `json:"followers"` // Public keys of the followers, sorted
+	Updated   int64    `json:"updated"`   // Update timestamp
+}
+
+// FollowGraphManager maintains the follow graph from kind 3 events. A replaced contact list
+// only updates the followers of the users added to or dropped from it.
+type FollowGraphManager struct {
+	db iface.DocumentStore
+}
+
+// NewFollowGraphManager creates a new FollowGraphManager
+func NewFollowGraphManager(db iface.DocumentStore) *FollowGraphManager {
+	return &FollowGraphManager{db: db}
+}
+
+// followListDocID returns the document key of the follow list of a user
+func followListDocID(pubKey string) string {
+	return DocTypeFollowList + ":" + pubKey
+}
+
+// followersDocID returns the document key of the followers of a user
+func followersDocID(pubKey string) string {
+	return DocTypeFollowers + ":" + pubKey
+}
+
+// UpdateFromEvent replaces the follow list of the author of a kind 3 event. Kind 3 is
+// replaceable, so the newest event wins, ties broken by the lowest ID as in NIP-01.
+func (fm *FollowGraphManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	if event.Kind != nostr.KindContactList {
+		return nil
+	}
+
+	existing, err := fm.GetFollowList(ctx, event.PubKey)
+	if err != nil {
+		return err
+	}
+	created := int64(event.CreatedAt)
+	if existing != nil && (existing.EventID == event.ID || existing.CreatedAt > created ||
+		existing.CreatedAt == created && existing.EventID < event.ID) {
+		return nil
+	}
+
+	list := &FollowList{
+		ID:        followListDocID(event.PubKey),
+		DocType:   DocTypeFollowList,
+		PubKey:    event.PubKey,
+		Following: contactListFollows(event),
+		EventID:   event.ID,
+		CreatedAt: created,
+	}
+	var previous []string
+	if existing != nil {
+		previous = existing.Following
+	}
+	if err := fm.updateFollowers(ctx, event.PubKey, previous, list.Following); err != nil {
+		return err
+	}
+	return fm.saveFollowList(ctx, list)
+}
+
+// contactListFollows returns the distinct public keys of the p tags of a contact list, sorted
+func contactListFollows(event *nostr.Event) []string {
+	follows := []string{}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "p" && tag[1] != "" && tag[1] != event.PubKey {
+			follows = append(follows, tag[1])
+		}
+	}
+	sort.Strings(follows)
+	return compactStrings(follows)
+}
+
+// compactStrings removes consecutive duplicates from a sorted slice
+func compactStrings(sorted []string) []string {
+	kept := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// updateFollowers records the follower in the followers of the users it started following
+// and removes it from those it stopped following. Both lists are sorted.
+func (fm *FollowGraphManager) updateFollowers(ctx context.Context, follower string, previous, current []string) error {
+	i, j := 0, 0
+	for i < len(previous) || j < len(current) {
+		switch {
+		case j == len(current) || i < len(previous) && previous[i] < current[j]:
+			if err := fm.setFollower(ctx, previous[i], follower, false); err != nil {
+				return err
+			}
+			i++
+		case i == len(previous) || current[j] < previous[i]:
+			if err := fm.setFollower(ctx, current[j], follower, true); err != nil {
+				return err
+			}
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return nil
+}
+
+// setFollower adds a follower to the followers of a user, or removes it. A user left without
+// followers loses the document.
+func (fm *FollowGraphManager) setFollower(ctx context.Context, pubKey, follower string, follows bool) error {
+	followers, err := fm.GetFollowers(ctx, pubKey)
+	if err != nil {
+		return err
+	}
+	if followers == nil {
+		followers = &Followers{ID: followersDocID(pubKey), DocType: DocTypeFollowers, PubKey: pubKey, Followers: []string{}}
+	}
+
+	pos := sort.SearchStrings(followers.Followers, follower)
+	listed := pos < len(followers.Followers) && followers.Followers[pos] == follower
+	switch {
+	case follows && !listed:
+		followers.Followers = append(followers.Followers, "")
+		copy(followers.Followers[pos+1:], followers.Followers[pos:])
+		followers.Followers[pos] = follower
+	case !follows && listed:
+		followers.Followers = append(followers.Followers[:pos], followers.Followers[pos+1:]...)
+	default:
+		return nil
+	}
+
+	if len(followers.Followers) == 0 {
+		_, err := fm.db.Delete(ctx, followers.ID)
+		return err
+	}
+	return fm.saveFollowers(ctx, followers)
+}
+
+// RemoveEvent removes the follow list of a user whose kind 3 event was deleted, with them
+// from the followers of the users it named
+func (fm *FollowGraphManager) RemoveEvent(ctx context.Context, event *nostr.Event) error {
+	if event.Kind != nostr.KindContactList {
+		return nil
+	}
+	list, err := fm.GetFollowList(ctx, event.PubKey)
+	if err != nil || list == nil || list.EventID != event.ID {
+		return err
+	}
+	if err := fm.updateFollowers(ctx, event.PubKey, list.Following, nil); err != nil {
+		return err
+	}
+	_, err = fm.db.Delete(ctx, list.ID)
+	return err
+}
+
+// GetFollowList retrieves the follow list of a user, nil if they published none
+func (fm *FollowGraphManager) GetFollowList(ctx context.Context, pubKey string) (*FollowList, error) {
+	docMap, err := fm.getDocument(ctx, followListDocID(pubKey), DocTypeFollowList)
+	if err != nil || docMap == nil {
+		return nil, err
+	}
+	var list FollowList
+	if err := decodeFollowDocument(docMap, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetFollowers retrieves the followers of a user, nil if they have none
+func (fm *FollowGraphManager) GetFollowers(ctx context.Context, pubKey string) (*Followers, error) {
+	docMap, err := fm.getDocument(ctx, followersDocID(pubKey), DocTypeFollowers)
+	if err != nil || docMap == nil {
+		return nil, err
+	}
+	var followers Followers
+	if err := decodeFollowDocument(docMap, &followers); err != nil {
+		return nil, err
+	}
+	return &followers, nil
+}
+
+// ListFollows returns the users in a follow relation with a user, sorted
+func (fm *FollowGraphManager) ListFollows(ctx context.Context, pubKey, relation string) ([]string, error) {
+	var following, followers []string
+	if relation != FollowFollowers {
+		list, err := fm.GetFollowList(ctx, pubKey)
+		if err != nil {
+			return nil, err
+		}
+		if list != nil {
+			following = list.Following
+		}
+	}
+	if relation != FollowFollowing {
+		doc, err := fm.GetFollowers(ctx, pubKey)
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			followers = doc.Followers
+		}
+	}
+
+	switch relation {
+	case FollowFollowing:
+		return append([]string{}, following...), nil
+	case FollowFollowers:
+		return append([]string{}, followers...), nil
+	}
+	mutual := []string{}
+	for _, pk := range following {
+		if pos := sort.SearchStrings(followers, pk); pos < len(followers) && followers[pos] == pk {
+			mutual = append(mutual, pk)
+		}
+	}
+	return mutual, nil
+}
+
+// getDocument retrieves a follow graph document of a type, nil if it doesn't exist
+func (fm *FollowGraphManager) getDocument(ctx context.Context, key, docType string) (map[string]interface{}, error) {
+	docs, err := fm.db.Get(ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if t, _ := docMap["doc_type"].(string); t == docType {
+			return docMap, nil
+		}
+	}
+	return nil, nil
+}
+
+// Helper function: parse a follow graph document
+func decodeFollowDocument(docMap map[string]interface{}, v interface{}) error {
+	// Convert document to JSON and parse into struct
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, v)
+}
+
+// saveFollowList saves a follow list document
+func (fm *FollowGraphManager) saveFollowList(ctx context.Context, list *FollowList) error {
+	list.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            list.ID,
+		"id":             list.ID,
+		"doc_type":       DocTypeFollowList,
+		"schema_version": schemaVersion(DocTypeFollowList),
+		"pubkey":         list.PubKey,
+		"following":      list.Following,
+		"event_id":       list.EventID,
+		"created_at":     list.CreatedAt,
+		"updated":        list.Updated,
+	}
+
+	_, err := fm.db.Put(ctx, doc)
+	return err
+}
+
+// saveFollowers saves a followers document
+func (fm *FollowGraphManager) saveFollowers(ctx context.Context, followers *Followers) error {
+	followers.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            followers.ID,
+		"id":             followers.ID,
+		"doc_type":       DocTypeFollowers,
+		"schema_version": schemaVersion(DocTypeFollowers),
+		"pubkey":         followers.PubKey,
+		"followers":      followers.Followers,
+		"updated":        followers.Updated,
+	}
+
+	_, err := fm.db.Put(ctx, doc)
+	return err
+}
+
+// ListFollows returns the users a user follows, the users following them or the mutual
+// follows, sorted
+func (a *OrbitDBAdapter) ListFollows(ctx context.Context, pubKey, relation string) ([]string, error) {
+	return a.followGraphMgr.ListFollows(ctx, pubKey, relation)
+}
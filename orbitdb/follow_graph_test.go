@@ -0,0 +1,71 @@
+package orbitdb
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contactList returns a kind 3 event of the named author following the named users
+func contactList(t *testing.T, author string, created nostr.Timestamp, follows ...string) *nostr.Event {
+	event := &nostr.Event{CreatedAt: created, Kind: nostr.KindContactList}
+	for _, follow := range follows {
+		event.Tags = append(event.Tags, nostr.Tag{"p", testPubKey(follow)})
+	}
+	return signAs(t, author, event)
+}
+
+// Helper function: the sorted public keys of named test users
+func testPubKeys(names ...string) []string {
+	pubKeys := make([]string, 0, len(names))
+	for _, name := range names {
+		pubKeys = append(pubKeys, testPubKey(name))
+	}
+	sort.Strings(pubKeys)
+	return pubKeys
+}
+
+// Test that replaced contact lists keep following and followers consistent
+func TestFollowGraph(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("follows"))
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		contactList(t, "alice", 1700000000, "bob", "carol", "bob"),
+		contactList(t, "bob", 1700000000, "alice"),
+		contactList(t, "carol", 1700000000, "alice", "bob"),
+	}))
+
+	list := func(name, relation string) []string {
+		users, err := adapter.ListFollows(ctx, testPubKey(name), relation)
+		require.NoError(t, err)
+		return users
+	}
+	assert.Equal(t, testPubKeys("bob", "carol"), list("alice", FollowFollowing))
+	assert.Equal(t, testPubKeys("alice", "carol"), list("bob", FollowFollowers))
+	assert.Equal(t, testPubKeys("bob", "carol"), list("alice", FollowMutual))
+	assert.Equal(t, testPubKeys("alice"), list("bob", FollowMutual))
+
+	// A newer list drops carol and adds dave; an older one changes nothing
+	current := contactList(t, "alice", 1700000100, "bob", "dave")
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		current,
+		contactList(t, "alice", 1699999999, "erin"),
+	}))
+	assert.Equal(t, testPubKeys("bob", "dave"), list("alice", FollowFollowing))
+	assert.Empty(t, list("carol", FollowFollowers))
+	assert.Equal(t, testPubKeys("alice"), list("dave", FollowFollowers))
+	assert.Empty(t, list("erin", FollowFollowers))
+	assert.Equal(t, testPubKeys("bob"), list("alice", FollowMutual))
+
+	// Deleting the current list removes alice from the followers it named
+	event, err := adapter.GetEventByID(ctx, current.ID)
+	require.NoError(t, err)
+	require.NoError(t, adapter.DeleteEvent(ctx, event))
+	assert.Empty(t, list("alice", FollowFollowing))
+	assert.Equal(t, testPubKeys("carol"), list("bob", FollowFollowers))
+	assert.Empty(t, list("dave", FollowFollowers))
+}
@@ -0,0 +1,422 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// Kinds of the discrepancies found by Fsck
+const (
+	FsckStatsUndercount   = "stats_undercount"   // A user's statistics count fewer events of a kind than are stored
+	FsckUnlistedEvent     = "unlisted_event"     // A stored subspace event missing from the subspace's event list
+	FsckDanglingEvent     = "dangling_event"     // A subspace event list names an event that is neither stored nor tombstoned
+	FsckEventCount        = "event_count"        // A causality event_count differs from the event IDs in its epochs
+	FsckOrphanedTombstone = "orphaned_tombstone" // A tombstone whose event still has processed-event markers or annotations
+)
+
+// FsckIssue is a discrepancy between the derived documents and the stored events
+type FsckIssue struct {
+	Kind     string `json:"kind"`     // One of the Fsck* kinds
+	Subject  string `json:"subject"`  // User, subspace or event the issue is about
+	Detail   string `json:"detail"`   // Description of the discrepancy
+	Repaired bool   `json:"repaired"` // Whether the discrepancy was repaired
+}
+
+// FsckReport describes a consistency check
+type FsckReport struct {
+	Events       int          `json:"events"`      // Stored events checked
+	Tombstones   int          `json:"tombstones"`  // Tombstones checked
+	Users        int          `json:"users"`       // User statistics documents checked
+	Subspaces    int          `json:"subspaces"`   // Causality documents checked
+	Issues       []*FsckIssue `json:"issues"`      // Discrepancies found
+	DurationMsec int64        `json:"duration_ms"` // Duration of the check
+}
+
+// fsckScan holds the documents read by Fsck
+type fsckScan struct {
+	events     []*nostr.Event
+	stored     map[string]bool                   // IDs of the stored events
+	tombstones map[string]bool                   // IDs of the tombstoned events
+	stats      map[string]*UserStats             // User statistics, by user
+	causality  map[string]*SubspaceCausality     // Causality, by subspace
+	epochs     map[string][]*CausalityEventEpoch // Event epochs, by subspace
+	markers    map[string]bool                   // IDs of the events with processed-event markers
+	annotated  map[string]bool                   // IDs of the events with annotations
+}
+
+// Fsck cross-checks the derived documents against the stored events: the event counts of user
+// statistics, the event lists of subspace causality and the data left behind by tombstoned
+// events. With repair set, undercounted statistics are raised to the stored counts, unlisted
+// events are appended to their subspace, event counts are corrected and the markers and
+// annotations of tombstoned events are deleted. Counts above the stored events are expected,
+// deletions and retention keep aggregate counters, and are not reported. Dangling event IDs are
+// only reported, the event may still replicate.
+func (a *OrbitDBAdapter) Fsck(ctx context.Context, repair bool) (*FsckReport, error) {
+	start := time.Now()
+	scan, err := a.scanForFsck(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if repair {
+		defer a.cache.clear()
+	}
+
+	report := &FsckReport{
+		Events:     len(scan.events),
+		Tombstones: len(scan.tombstones),
+		Users:      len(scan.stats),
+		Subspaces:  len(scan.causality),
+		Issues:     []*FsckIssue{},
+	}
+	for _, check := range []func(context.Context, *fsckScan, bool) ([]*FsckIssue, error){
+		a.checkStatsCounts,
+		a.checkCausalityEvents,
+		a.checkTombstones,
+	} {
+		issues, err := check(ctx, scan, repair)
+		report.Issues = append(report.Issues, issues...)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	report.DurationMsec = time.Since(start).Milliseconds()
+	return report, nil
+}
+
+// scanForFsck reads the events and the derived documents checked by Fsck in one scan
+func (a *OrbitDBAdapter) scanForFsck(ctx context.Context) (*fsckScan, error) {
+	scan := &fsckScan{
+		stored:     make(map[string]bool),
+		tombstones: make(map[string]bool),
+		stats:      make(map[string]*UserStats),
+		causality:  make(map[string]*SubspaceCausality),
+		epochs:     make(map[string][]*CausalityEventEpoch),
+		markers:    make(map[string]bool),
+		annotated:  make(map[string]bool),
+	}
+
+	var decodeErr error
+	decode := func(docMap map[string]interface{}, v interface{}) bool {
+		jsonData, err := json.Marshal(docMap)
+		if err == nil {
+			err = json.Unmarshal(jsonData, v)
+		}
+		if err != nil {
+			decodeErr = fmt.Errorf("failed to decode %v document %v: %w", docMap["doc_type"], docMap["_id"], err)
+			return false
+		}
+		return true
+	}
+
+	queryFn := func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+
+		switch docMap["doc_type"] {
+		case DocTypeNostrEvent:
+			event := docToEvent(docMap)
+			scan.events = append(scan.events, event)
+			scan.stored[event.ID] = true
+		case DocTypeEventTombstone:
+			if id, ok := docMap["_id"].(string); ok {
+				scan.tombstones[id] = true
+			}
+		case "user_stats":
+			var stats UserStats
+			if decode(docMap, &stats) {
+				scan.stats[stats.ID] = &stats
+			}
+		case DocTypeCausality:
+			var causality SubspaceCausality
+			if decode(docMap, &causality) {
+				scan.causality[causality.SubspaceID] = &causality
+			}
+		case DocTypeCausalityEvents:
+			var epoch CausalityEventEpoch
+			if decode(docMap, &epoch) {
+				scan.epochs[epoch.SubspaceID] = append(scan.epochs[epoch.SubspaceID], &epoch)
+			}
+		case DocTypeProcessedEvent:
+			if id, ok := docMap["event_id"].(string); ok {
+				scan.markers[id] = true
+			}
+		case DocTypeEventAnnotations:
+			if id, ok := docMap["event_id"].(string); ok {
+				scan.annotated[id] = true
+			}
+		}
+		return false, nil
+	}
+
+	// Scan without collecting documents
+	if _, err := queryDocuments(ctx, a.db, queryFn); err != nil {
+		return nil, err
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	sort.Slice(scan.events, func(i, j int) bool { return scan.events[i].ID < scan.events[j].ID })
+	for _, epochs := range scan.epochs {
+		sort.Slice(epochs, func(i, j int) bool { return epochs[i].Epoch < epochs[j].Epoch })
+	}
+	return scan, nil
+}
+
+// eventSubspace returns the subspace ID of an event, empty if it has none
+func eventSubspace(event *nostr.Event) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// checkStatsCounts compares the event counts of user statistics with the stored events
+func (a *OrbitDBAdapter) checkStatsCounts(ctx context.Context, scan *fsckScan, repair bool) ([]*FsckIssue, error) {
+	// Stored events of each user by kind, overall and by subspace
+	total := make(map[string]map[uint32]uint64)
+	bySubspace := make(map[string]map[string]map[uint32]uint64)
+	for _, event := range scan.events {
+		kind := uint32(event.Kind)
+		if total[event.PubKey] == nil {
+			total[event.PubKey] = make(map[uint32]uint64)
+			bySubspace[event.PubKey] = make(map[string]map[uint32]uint64)
+		}
+		total[event.PubKey][kind]++
+		if sid := eventSubspace(event); sid != "" {
+			if bySubspace[event.PubKey][sid] == nil {
+				bySubspace[event.PubKey][sid] = make(map[uint32]uint64)
+			}
+			bySubspace[event.PubKey][sid][kind]++
+		}
+	}
+
+	users := make([]string, 0, len(total))
+	for user := range total {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	var issues []*FsckIssue
+	for _, user := range users {
+		stats := scan.stats[user]
+		if stats == nil {
+			stats = &UserStats{ID: user, DocType: "user_stats", CreatedSubspaces: []string{}, JoinedSubspaces: []string{}}
+		}
+		if stats.TotalStats == nil {
+			stats.TotalStats = make(map[uint32]uint64)
+		}
+		if stats.SubspaceStats == nil {
+			stats.SubspaceStats = make(map[string]map[uint32]uint64)
+		}
+
+		var found []*FsckIssue
+		for _, kind := range sortedKinds(total[user]) {
+			if stored := total[user][kind]; stats.TotalStats[kind] < stored {
+				found = append(found, &FsckIssue{Kind: FsckStatsUndercount, Subject: user,
+					Detail: fmt.Sprintf("kind %d counted %d times, %d events stored", kind, stats.TotalStats[kind], stored)})
+				stats.TotalStats[kind] = stored
+			}
+		}
+		sids := make([]string, 0, len(bySubspace[user]))
+		for sid := range bySubspace[user] {
+			sids = append(sids, sid)
+		}
+		sort.Strings(sids)
+		for _, sid := range sids {
+			if stats.SubspaceStats[sid] == nil {
+				stats.SubspaceStats[sid] = make(map[uint32]uint64)
+			}
+			for _, kind := range sortedKinds(bySubspace[user][sid]) {
+				if stored := bySubspace[user][sid][kind]; stats.SubspaceStats[sid][kind] < stored {
+					found = append(found, &FsckIssue{Kind: FsckStatsUndercount, Subject: user,
+						Detail: fmt.Sprintf("kind %d in subspace %s counted %d times, %d events stored", kind, sid, stats.SubspaceStats[sid][kind], stored)})
+					stats.SubspaceStats[sid][kind] = stored
+				}
+			}
+		}
+
+		if len(found) > 0 && repair {
+			stats.LastUpdated = time.Now().Unix()
+			if err := a.userStatsMgr.saveUserStats(ctx, stats); err != nil {
+				return append(issues, found...), fmt.Errorf("failed to repair statistics of %s: %w", user, err)
+			}
+			for _, issue := range found {
+				issue.Repaired = true
+			}
+		}
+		issues = append(issues, found...)
+	}
+	return issues, nil
+}
+
+// sortedKinds returns the kinds of per-kind counts in ascending order
+func sortedKinds(counts map[uint32]uint64) []uint32 {
+	kinds := make([]uint32, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	return kinds
+}
+
+// checkCausalityEvents compares the event lists of subspace causality with the stored events
+func (a *OrbitDBAdapter) checkCausalityEvents(ctx context.Context, scan *fsckScan, repair bool) ([]*FsckIssue, error) {
+	var issues []*FsckIssue
+
+	// Event IDs listed by each subspace, inline and in epochs
+	listed := make(map[string]map[string]bool)
+	subspaces := make([]string, 0, len(scan.causality))
+	for sid, causality := range scan.causality {
+		subspaces = append(subspaces, sid)
+		listed[sid] = make(map[string]bool)
+		for _, id := range causality.Events {
+			listed[sid][id] = true
+		}
+		for _, epoch := range scan.epochs[sid] {
+			for _, id := range epoch.Events {
+				listed[sid][id] = true
+			}
+		}
+	}
+	sort.Strings(subspaces)
+
+	for _, sid := range subspaces {
+		causality := scan.causality[sid]
+		inEpochs := 0
+		var dangling []string
+		for _, epoch := range scan.epochs[sid] {
+			inEpochs += len(epoch.Events)
+			for _, id := range epoch.Events {
+				if !scan.stored[id] && !scan.tombstones[id] {
+					dangling = append(dangling, id)
+				}
+			}
+		}
+		for _, id := range causality.Events {
+			if !scan.stored[id] && !scan.tombstones[id] {
+				dangling = append(dangling, id)
+			}
+		}
+		for _, id := range dangling {
+			issues = append(issues, &FsckIssue{Kind: FsckDanglingEvent, Subject: sid,
+				Detail: fmt.Sprintf("event %s is listed but neither stored nor tombstoned", id)})
+		}
+
+		// Documents written before epochs keep their IDs inline until the next update
+		if len(causality.Events) == 0 && causality.EventCount != inEpochs {
+			issue := &FsckIssue{Kind: FsckEventCount, Subject: sid,
+				Detail: fmt.Sprintf("event_count is %d, epochs list %d events", causality.EventCount, inEpochs)}
+			if repair {
+				if err := a.repairEventCount(ctx, sid, inEpochs); err != nil {
+					return append(issues, issue), fmt.Errorf("failed to repair event count of subspace %s: %w", sid, err)
+				}
+				issue.Repaired = true
+			}
+			issues = append(issues, issue)
+		}
+	}
+
+	for _, event := range scan.events {
+		sid := eventSubspace(event)
+		if sid == "" || !IsValidSubspaceID(sid) || listed[sid][event.ID] {
+			continue
+		}
+		issue := &FsckIssue{Kind: FsckUnlistedEvent, Subject: sid,
+			Detail: fmt.Sprintf("event %s is stored but not listed", event.ID)}
+		if repair {
+			if err := a.repairUnlistedEvent(ctx, sid, event.ID); err != nil {
+				return append(issues, issue), fmt.Errorf("failed to list event %s in subspace %s: %w", event.ID, sid, err)
+			}
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// repairEventCount sets the event count of a subspace's causality
+func (a *OrbitDBAdapter) repairEventCount(ctx context.Context, subspaceID string, count int) error {
+	causality, err := a.causalityMgr.GetSubspaceCausality(ctx, subspaceID)
+	if err != nil || causality == nil {
+		return err
+	}
+	causality.EventCount = count
+	causality.Updated = int64(nostr.Now())
+	return a.causalityMgr.saveCausality(ctx, causality)
+}
+
+// repairUnlistedEvent appends an event to its subspace's event list, creating the subspace's
+// causality if it has none
+func (a *OrbitDBAdapter) repairUnlistedEvent(ctx context.Context, subspaceID, eventID string) error {
+	causality, err := a.causalityMgr.GetSubspaceCausality(ctx, subspaceID)
+	if err != nil {
+		return err
+	}
+	now := int64(nostr.Now())
+	if causality == nil {
+		causality = newSubspaceCausality(subspaceID, now)
+	}
+	causality.Updated = now
+	if err := a.causalityMgr.appendEvent(ctx, causality, eventID); err != nil {
+		return err
+	}
+	return a.causalityMgr.saveCausality(ctx, causality)
+}
+
+// checkTombstones finds tombstoned events whose markers or annotations were left behind
+func (a *OrbitDBAdapter) checkTombstones(ctx context.Context, scan *fsckScan, repair bool) ([]*FsckIssue, error) {
+	ids := make([]string, 0, len(scan.tombstones))
+	for id := range scan.tombstones {
+		if scan.markers[id] || scan.annotated[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var issues []*FsckIssue
+	for _, id := range ids {
+		var left []string
+		if scan.markers[id] {
+			left = append(left, "processed-event markers")
+		}
+		if scan.annotated[id] {
+			left = append(left, "annotations")
+		}
+		issue := &FsckIssue{Kind: FsckOrphanedTombstone, Subject: id,
+			Detail: fmt.Sprintf("tombstoned event still has %v", left)}
+		if repair {
+			if err := a.repairTombstone(ctx, id); err != nil {
+				return append(issues, issue), fmt.Errorf("failed to clean up tombstoned event %s: %w", id, err)
+			}
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// repairTombstone deletes the processed-event markers and annotations of a tombstoned event
+func (a *OrbitDBAdapter) repairTombstone(ctx context.Context, eventID string) error {
+	for _, processed := range []*ProcessedEvents{a.userStatsMgr.processed, a.causalityMgr.processed} {
+		if _, err := processed.Forget(ctx, eventID); err != nil {
+			return err
+		}
+	}
+	if err := a.annotationMgr.DeleteAllEventAnnotations(ctx, eventID); err != nil {
+		return err
+	}
+	zap.L().Info("Cleaned up tombstoned event", zap.String("event", eventID))
+	return nil
+}
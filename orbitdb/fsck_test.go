@@ -0,0 +1,95 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that fsck reports discrepancies between derived documents and events, and repairs them
+func TestFsck(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDocumentStore("fsck")
+	adapter := NewOrbitDBAdapter(db)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000f5"
+	create := signAs(t, "creator", &nostr.Event{CreatedAt: 1700000000, Kind: 30100, Tags: nostr.Tags{{"sid", sid}}})
+	purged := signAs(t, "member", &nostr.Event{CreatedAt: 1700000200, Kind: 1})
+	events := []*nostr.Event{
+		create,
+		signAs(t, "member", &nostr.Event{CreatedAt: 1700000100, Kind: 30302, Tags: nostr.Tags{{"sid", sid}, {"op", "vote"}}}),
+		purged,
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+
+	report, err := adapter.Fsck(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Events)
+	assert.Empty(t, report.Issues, "derived data written by SaveEvent is consistent")
+
+	// Lose the member's vote count, drop the vote from the subspace's events and list an
+	// unknown event instead, and tombstone an event without cleaning up its markers
+	member := testPubKey("member")
+	_, err = db.Put(ctx, map[string]interface{}{
+		"_id":         member,
+		"id":          member,
+		"doc_type":    "user_stats",
+		"total_stats": map[string]interface{}{"1": 1},
+	})
+	require.NoError(t, err)
+	_, err = db.Put(ctx, epochToDoc(&CausalityEventEpoch{
+		ID:         causalityEpochDocID(sid, 0),
+		DocType:    DocTypeCausalityEvents,
+		SubspaceID: sid,
+		Events:     []string{create.ID, "ghost", "missing"},
+	}))
+	require.NoError(t, err)
+	_, err = db.Put(ctx, map[string]interface{}{"_id": purged.ID, "id": purged.ID, "doc_type": DocTypeEventTombstone})
+	require.NoError(t, err)
+
+	report, err = adapter.Fsck(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Events)
+	assert.Equal(t, 1, report.Tombstones)
+	kinds := map[string]int{}
+	for _, issue := range report.Issues {
+		kinds[issue.Kind]++
+		assert.False(t, issue.Repaired)
+	}
+	assert.Equal(t, map[string]int{
+		FsckStatsUndercount:   2, // Overall and in the subspace
+		FsckDanglingEvent:     2,
+		FsckEventCount:        1,
+		FsckUnlistedEvent:     1,
+		FsckOrphanedTombstone: 1,
+	}, kinds)
+
+	report, err = adapter.Fsck(ctx, true)
+	require.NoError(t, err)
+	for _, issue := range report.Issues {
+		assert.Equal(t, issue.Kind != FsckDanglingEvent, issue.Repaired, issue.Detail)
+	}
+
+	stats, err := adapter.GetUserStats(ctx, member)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), stats.TotalStats[30302])
+	assert.Equal(t, uint64(1), stats.SubspaceStats[sid][30302])
+	assert.Equal(t, uint64(1), stats.TotalStats[1], "counts of deleted events are kept")
+
+	causality, err := adapter.GetSubspaceCausality(ctx, sid)
+	require.NoError(t, err)
+	assert.Equal(t, 4, causality.EventCount)
+
+	// Only the dangling event IDs are left
+	report, err = adapter.Fsck(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 2)
+	for _, issue := range report.Issues {
+		assert.Equal(t, FsckDanglingEvent, issue.Kind)
+	}
+}
@@ -3,7 +3,6 @@ package orbitdb
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
 	"sync"
 
@@ -14,18 +13,30 @@ import (
 	// "github.com/ipfs/go-cid"
 	ipfsCore "github.com/ipfs/kubo/core"
 	"github.com/ipfs/kubo/core/coreapi"
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/repo"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
 )
 
 var (
 	ipfsNode    *ipfsCore.IpfsNode
+	ipfsAPI     coreiface.CoreAPI
 	orbitDB     iface.OrbitDB
 	documentDB  iface.DocumentStore
 	initOnce    sync.Once
 	initialized bool
 	dbName      string
 	orbitDBDir  string
+	nodeRepo    repo.Repo // Repository of the IPFS node, nil for the kubo default
 )
 
+// SetRepo sets the repository of the IPFS node, e.g. one with configured transports or a
+// private network swarm key. Must be called before Init.
+func SetRepo(r repo.Repo) {
+	nodeRepo = r
+}
+
 // Init initializes the database connection
 func Init(name string, orbitdir string) error {
 	dbName = name
@@ -41,8 +52,10 @@ func Init(name string, orbitdir string) error {
 
 		// Initialize IPFS node
 		ctx := context.Background()
-		ipfsNode, err := ipfsCore.NewNode(ctx, &ipfsCore.BuildCfg{
+		var err error
+		ipfsNode, err = ipfsCore.NewNode(ctx, &ipfsCore.BuildCfg{
 			Online: true,
+			Repo:   nodeRepo,
 			// NilRepo: false,
 			ExtraOpts: map[string]bool{
 				"pubsub": true,
@@ -61,11 +74,11 @@ func Init(name string, orbitdir string) error {
 		// Relay service code
 		peerID := ipfsNode.Identity.String()
 		addrs := ipfsNode.PeerHost.Addrs()
-		log.Printf("Relay IPFS node information:")
-		log.Printf("Peer ID: %s", peerID)
-		for _, addr := range addrs {
-			log.Printf("Multiaddr: %s/p2p/%s", addr.String(), peerID)
+		multiaddrs := make([]string, len(addrs))
+		for i, addr := range addrs {
+			multiaddrs[i] = addr.String() + "/p2p/" + peerID
 		}
+		zap.L().Info("Relay IPFS node", zap.String("peer", peerID), zap.Strings("multiaddrs", multiaddrs))
 
 		// Get IPFS API
 		api, err := coreapi.NewCoreAPI(ipfsNode)
@@ -73,10 +86,13 @@ func Init(name string, orbitdir string) error {
 			initErr = fmt.Errorf("failed to create IPFS API: %w", err)
 			return
 		}
+		ipfsAPI = api
 
 		// Create OrbitDB instance
 		orbitDB, err = orbitdb.NewOrbitDB(ctx, api, &orbitdb.NewOrbitDBOptions{
 			Directory: &orbitDBDir,
+			Logger:    zap.L(),
+			Tracer:    otel.Tracer("berty.tech/go-orbit-db"),
 		})
 		if err != nil {
 			initErr = fmt.Errorf("failed to create OrbitDB instance: %w", err)
@@ -93,8 +109,9 @@ func Init(name string, orbitdir string) error {
 					"read":  {"*"},
 				},
 			},
-			Directory: &orbitDBDir,
-			Create:    &create,
+			Directory:         &orbitDBDir,
+			Create:            &create,
+			StoreSpecificOpts: DocumentStoreOptions(),
 		}
 
 		db, err := orbitDB.Docs(ctx, dbName, dbOptions)
@@ -105,9 +122,7 @@ func Init(name string, orbitdir string) error {
 		documentDB = db
 
 		initialized = true
-		addr := documentDB.Address().String()
-		log.Printf("Document database address: %s", addr)
-		log.Println("Database initialization successful")
+		zap.L().Info("Database initialization successful", zap.Stringer("address", documentDB.Address()))
 	})
 
 	return initErr
@@ -121,6 +136,14 @@ func GetStore() (iface.DocumentStore, error) {
 	return documentDB, nil
 }
 
+// GetCoreAPI gets the API of the initialized IPFS node
+func GetCoreAPI() (coreiface.CoreAPI, error) {
+	if !initialized || ipfsAPI == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	return ipfsAPI, nil
+}
+
 // Close closes the database connection
 func Close() error {
 	if documentDB != nil {
@@ -0,0 +1,158 @@
+package orbitdb
+
+import (
+	"context"
+	"sort"
+)
+
+// Bounds of the depth of invite trees
+const (
+	DefaultInviteTreeDepth = 3
+	MaxInviteTreeDepth     = 10
+)
+
+// InviteEdge is an accepted invitation: the inviter brought the invitee into a subspace
+type InviteEdge struct {
+	Inviter    string `json:"inviter"`     // Inviting user
+	Invitee    string `json:"invitee"`     // Invited user
+	SubspaceID string `json:"subspace_id"` // Subspace the invitee joined
+	Timestamp  int64  `json:"timestamp"`   // Time the invitation was accepted
+}
+
+// InviteGraph holds the who-invited-whom edges of a subspace
+type InviteGraph struct {
+	SubspaceID string        `json:"subspace_id"` // Subspace of the graph
+	Users      []string      `json:"users"`       // Users appearing in any edge, sorted
+	Edges      []*InviteEdge `json:"edges"`       // Invitations, oldest first
+}
+
+// InviteTreeNode is a user in an invite tree with the users they invited
+type InviteTreeNode struct {
+	UserID     string            `json:"user_id"`               // User at this node
+	SubspaceID string            `json:"subspace_id,omitempty"` // Subspace the user was invited to, empty for the root
+	Timestamp  int64             `json:"timestamp,omitempty"`   // Time the invitation was accepted, 0 for the root
+	Invited    []*InviteTreeNode `json:"invited"`               // Users this user invited, oldest first
+}
+
+// GetSubspaceInviteGraph builds the invite graph of a subspace from the invitations
+// recorded on the inviters' statistics
+func (um *UserStatsManager) GetSubspaceInviteGraph(ctx context.Context, subspaceID string) (*InviteGraph, error) {
+	inviters, err := um.QueryUserStats(ctx, func(stats *UserStats) bool {
+		return stats.InviteStats != nil && len(stats.InviteStats.InvitedUsers[subspaceID]) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &InviteGraph{
+		SubspaceID: subspaceID,
+		Users:      []string{},
+		Edges:      []*InviteEdge{},
+	}
+	users := make(map[string]bool)
+	for _, inviter := range inviters {
+		for _, invited := range inviter.InviteStats.InvitedUsers[subspaceID] {
+			graph.Edges = append(graph.Edges, &InviteEdge{
+				Inviter:    inviter.ID,
+				Invitee:    invited.UserID,
+				SubspaceID: subspaceID,
+				Timestamp:  invited.Timestamp,
+			})
+			users[inviter.ID] = true
+			users[invited.UserID] = true
+		}
+	}
+
+	for user := range users {
+		graph.Users = append(graph.Users, user)
+	}
+	sort.Strings(graph.Users)
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].Timestamp != graph.Edges[j].Timestamp {
+			return graph.Edges[i].Timestamp < graph.Edges[j].Timestamp
+		}
+		if graph.Edges[i].Inviter != graph.Edges[j].Inviter {
+			return graph.Edges[i].Inviter < graph.Edges[j].Inviter
+		}
+		return graph.Edges[i].Invitee < graph.Edges[j].Invitee
+	})
+	return graph, nil
+}
+
+// GetInviteTree builds the tree of users invited by a user across all subspaces, down to
+// depth levels below the user. Each user appears once, at the first place they are
+// reached breadth-first, so invitation cycles end the branch.
+func (um *UserStatsManager) GetInviteTree(ctx context.Context, userID string, depth int) (*InviteTreeNode, error) {
+	if depth <= 0 {
+		depth = DefaultInviteTreeDepth
+	}
+	if depth > MaxInviteTreeDepth {
+		depth = MaxInviteTreeDepth
+	}
+
+	root := &InviteTreeNode{UserID: userID, Invited: []*InviteTreeNode{}}
+	seen := map[string]bool{userID: true}
+	level := []*InviteTreeNode{root}
+	for d := 0; d < depth && len(level) > 0; d++ {
+		var next []*InviteTreeNode
+		for _, node := range level {
+			stats, err := um.GetUserStats(ctx, node.UserID)
+			if err != nil {
+				return nil, err
+			}
+			if stats == nil || stats.InviteStats == nil {
+				continue
+			}
+
+			for _, invited := range sortedInvitations(stats.InviteStats) {
+				if seen[invited.UserID] {
+					continue
+				}
+				seen[invited.UserID] = true
+				child := &InviteTreeNode{
+					UserID:     invited.UserID,
+					SubspaceID: invited.SubspaceID,
+					Timestamp:  invited.Timestamp,
+					Invited:    []*InviteTreeNode{},
+				}
+				node.Invited = append(node.Invited, child)
+				next = append(next, child)
+			}
+		}
+		level = next
+	}
+	return root, nil
+}
+
+// Helper function: list the invitations of a user across subspaces, oldest first
+func sortedInvitations(stats *InviteStats) []*InvitedUserInfo {
+	var invitations []*InvitedUserInfo
+	for sid, users := range stats.InvitedUsers {
+		for _, user := range users {
+			if user.SubspaceID == "" {
+				user.SubspaceID = sid
+			}
+			invitations = append(invitations, user)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool {
+		if invitations[i].Timestamp != invitations[j].Timestamp {
+			return invitations[i].Timestamp < invitations[j].Timestamp
+		}
+		if invitations[i].SubspaceID != invitations[j].SubspaceID {
+			return invitations[i].SubspaceID < invitations[j].SubspaceID
+		}
+		return invitations[i].UserID < invitations[j].UserID
+	})
+	return invitations
+}
+
+// GetSubspaceInviteGraph retrieves the who-invited-whom edges of a subspace
+func (a *OrbitDBAdapter) GetSubspaceInviteGraph(ctx context.Context, subspaceID string) (*InviteGraph, error) {
+	return a.userStatsMgr.GetSubspaceInviteGraph(ctx, subspaceID)
+}
+
+// GetInviteTree retrieves the tree of users invited by a user, depth levels deep
+func (a *OrbitDBAdapter) GetInviteTree(ctx context.Context, userID string, depth int) (*InviteTreeNode, error) {
+	return a.userStatsMgr.GetInviteTree(ctx, userID, depth)
+}
@@ -0,0 +1,74 @@
+package orbitdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"berty.tech/go-orbit-db/iface"
+	"berty.tech/go-orbit-db/stores/documentstore"
+)
+
+// DocumentStoreOptions returns the docstore options for cRelay databases. Documents are
+// keyed by _id like the docstore default, but numbers are decoded as json.Number instead
+// of float64 so uint64 counters and timestamps keep their precision past 2^53.
+func DocumentStoreOptions() *iface.CreateDocumentDBOptions {
+	opts := documentstore.DefaultStoreOptsForMap("_id")
+	opts.Unmarshal = decodeJSON
+	return opts
+}
+
+// decodeJSON behaves like json.Unmarshal but decodes numbers into interface{} values as json.Number
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+
+	// Reject trailing data like json.Unmarshal does
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("invalid character after top-level value")
+	}
+	return nil
+}
+
+// Helper function: read an integer field of a document. Accepts json.Number as well as
+// float64 for documents decoded without UseNumber.
+func docInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return 0, false
+		}
+		return int64(f), true
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// Helper function: read a numeric field of a document as float64
+func docFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
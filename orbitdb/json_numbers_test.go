@@ -0,0 +1,55 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that counters above 2^53 survive a round trip through the document store
+func TestLargeNumbersKeepPrecision(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDocumentStore("numbers")
+	adapter := NewOrbitDBAdapter(db)
+
+	const large = uint64(1<<53 + 1)
+	_, err := db.Put(ctx, map[string]interface{}{
+		"_id":         "pubkey",
+		"id":          "pubkey",
+		"doc_type":    "user_stats",
+		"total_stats": map[uint32]uint64{30300: large},
+	})
+	require.NoError(t, err)
+
+	stats, err := adapter.GetUserStats(ctx, "pubkey")
+	require.NoError(t, err)
+	require.NotNil(t, stats)
+	assert.Equal(t, large, stats.TotalStats[30300])
+
+	// Raw documents hold json.Number rather than float64
+	docs, err := db.Get(ctx, "pubkey", nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	totals := docs[0].(map[string]interface{})["total_stats"].(map[string]interface{})
+	assert.Equal(t, json.Number("9007199254740993"), totals["30300"])
+}
+
+// Test decoding of numeric document fields
+func TestDocInt64(t *testing.T) {
+	value, ok := docInt64(json.Number("9007199254740993"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(9007199254740993), value)
+
+	value, ok = docInt64(float64(1700000000))
+	assert.True(t, ok)
+	assert.Equal(t, int64(1700000000), value)
+
+	_, ok = docInt64("1700000000")
+	assert.False(t, ok)
+
+	var doc map[string]interface{}
+	assert.Error(t, decodeJSON([]byte(`{"a":1} {}`), &doc))
+}
@@ -0,0 +1,340 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeLeaderboard identifies materialized leaderboard documents
+const DocTypeLeaderboard = "leaderboard"
+
+// LeaderboardSize is the number of users kept per leaderboard metric
+const LeaderboardSize = 100
+
+// Leaderboard metrics, also the sort_by values of the top users endpoints
+const (
+	LeaderboardTotalEvents = "total_events"
+	LeaderboardVotes       = "votes"
+	LeaderboardInvites     = "invites"
+)
+
+// LeaderboardMetrics lists all leaderboard metrics
+var LeaderboardMetrics = []string{LeaderboardTotalEvents, LeaderboardVotes, LeaderboardInvites}
+
+// LeaderboardEntry is one ranked user. For subspace leaderboards the counts cover only that subspace.
+type LeaderboardEntry struct {
+	UserID         string            `json:"id"`              // User ID
+	Score          uint64            `json:"score"`           // Value of the ranked metric
+	TotalEvents    uint64            `json:"total_events"`    // Number of events
+	EventBreakdown map[uint32]uint64 `json:"event_breakdown"` // Number of events by kind
+	SubspaceCount  int               `json:"subspace_count"`  // Number of joined subspaces
+	LastActive     int64             `json:"last_active"`     // Last statistics update
+}
+
+// Leaderboard holds the top users per metric, globally or for one subspace
+type Leaderboard struct {
+	ID         string                         `json:"id"`                    // Document ID, see leaderboardID
+	DocType    string                         `json:"doc_type"`              // Document type, fixed as "leaderboard"
+	SubspaceID string                         `json:"subspace_id,omitempty"` // Subspace ID, empty for the global leaderboard
+	Rankings   map[string][]*LeaderboardEntry `json:"rankings"`              // Ranked users per metric, highest first
+	Updated    int64                          `json:"updated"`               // Update timestamp
+}
+
+// LeaderboardManager maintains leaderboards incrementally as user statistics change
+type LeaderboardManager struct {
+	db           iface.DocumentStore
+	userStatsMgr *UserStatsManager
+}
+
+// NewLeaderboardManager creates a new LeaderboardManager
+func NewLeaderboardManager(db iface.DocumentStore) *LeaderboardManager {
+	return &LeaderboardManager{
+		db:           db,
+		userStatsMgr: NewUserStatsManager(db),
+	}
+}
+
+// IsLeaderboardMetric reports whether metric is a known leaderboard metric
+func IsLeaderboardMetric(metric string) bool {
+	for _, known := range LeaderboardMetrics {
+		if metric == known {
+			return true
+		}
+	}
+	return false
+}
+
+// UserScore returns the value of a metric for a user, within a subspace if subspaceID is set
+func UserScore(stats *UserStats, metric, subspaceID string) uint64 {
+	switch metric {
+	case LeaderboardTotalEvents:
+		var total uint64
+		for _, count := range eventBreakdown(stats, subspaceID) {
+			total += count
+		}
+		return total
+	case LeaderboardVotes:
+		if stats.VoteStats == nil {
+			return 0
+		}
+		if subspaceID == "" {
+			return stats.VoteStats.TotalVotes
+		}
+		if votes, ok := stats.VoteStats.SubspaceVotes[subspaceID]; ok {
+			return votes.TotalVotes
+		}
+	case LeaderboardInvites:
+		if stats.InviteStats == nil {
+			return 0
+		}
+		if subspaceID == "" {
+			return stats.InviteStats.TotalInvited
+		}
+		return stats.InviteStats.SubspaceInvited[subspaceID]
+	}
+	return 0
+}
+
+// NewLeaderboardEntry builds the ranking row of a user for a metric
+func NewLeaderboardEntry(stats *UserStats, metric, subspaceID string) *LeaderboardEntry {
+	breakdown := eventBreakdown(stats, subspaceID)
+	entry := &LeaderboardEntry{
+		UserID:         stats.ID,
+		Score:          UserScore(stats, metric, subspaceID),
+		EventBreakdown: breakdown,
+		SubspaceCount:  len(stats.JoinedSubspaces),
+		LastActive:     stats.LastUpdated,
+	}
+	for _, count := range breakdown {
+		entry.TotalEvents += count
+	}
+	return entry
+}
+
+// RanksBelow reports whether a ranks below b. Ties are broken by user ID so rankings are stable.
+func (a *LeaderboardEntry) RanksBelow(b *LeaderboardEntry) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	return a.UserID > b.UserID
+}
+
+// Helper function: get the event counts of a user, within a subspace if subspaceID is set
+func eventBreakdown(stats *UserStats, subspaceID string) map[uint32]uint64 {
+	if subspaceID == "" {
+		return stats.TotalStats
+	}
+	return stats.SubspaceStats[subspaceID]
+}
+
+// Helper function: get the document ID of a leaderboard. Subspace leaderboards are namespaced,
+// so a subspace named "global" can't overwrite the global leaderboard. Leaderboards stored under
+// the former leaderboard:<subspace id> keys are dropped by a rebuild.
+func leaderboardID(subspaceID string) string {
+	if subspaceID == "" {
+		return DocTypeLeaderboard + ":global"
+	}
+	return DocTypeLeaderboard + ":subspace:" + subspaceID
+}
+
+// GetLeaderboard retrieves the global leaderboard, or the leaderboard of a subspace if
+// subspaceID is set. Returns nil if it has not been built yet.
+func (lm *LeaderboardManager) GetLeaderboard(ctx context.Context, subspaceID string) (*Leaderboard, error) {
+	docs, err := lm.db.Get(ctx, leaderboardID(subspaceID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if docType, _ := docMap["doc_type"].(string); docType != DocTypeLeaderboard {
+			continue
+		}
+
+		// Convert document to JSON and parse into struct
+		jsonData, err := json.Marshal(docMap)
+		if err != nil {
+			return nil, err
+		}
+
+		var leaderboard Leaderboard
+		if err := json.Unmarshal(jsonData, &leaderboard); err != nil {
+			return nil, err
+		}
+		return &leaderboard, nil
+	}
+
+	return nil, nil
+}
+
+// UpdateFromEvent refreshes the rankings of the users whose statistics the event changed,
+// the author and for accepted invitations the inviter, in the global leaderboard and the
+// leaderboard of the event's subspace. User statistics must already be updated.
+func (lm *LeaderboardManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	var subspaceID, inviter string
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "sid":
+			if subspaceID == "" {
+				subspaceID = tag[1]
+			}
+		case "inviter_addr":
+			if inviter == "" {
+				inviter = tag[1]
+			}
+		}
+	}
+
+	userIDs := []string{event.PubKey}
+	if event.Kind == 30303 && subspaceID != "" && inviter != "" {
+		userIDs = append(userIDs, inviter)
+	}
+
+	var users []*UserStats
+	for _, userID := range userIDs {
+		stats, err := lm.userStatsMgr.GetUserStats(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if stats != nil {
+			users = append(users, stats)
+		}
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	if err := lm.updateLeaderboard(ctx, "", users); err != nil {
+		return err
+	}
+	if subspaceID != "" {
+		return lm.updateLeaderboard(ctx, subspaceID, users)
+	}
+	return nil
+}
+
+// updateLeaderboard offers users to every metric of one leaderboard and saves it
+func (lm *LeaderboardManager) updateLeaderboard(ctx context.Context, subspaceID string, users []*UserStats) error {
+	leaderboard, err := lm.GetLeaderboard(ctx, subspaceID)
+	if err != nil {
+		return err
+	}
+	if leaderboard == nil {
+		leaderboard = &Leaderboard{
+			ID:         leaderboardID(subspaceID),
+			DocType:    DocTypeLeaderboard,
+			SubspaceID: subspaceID,
+		}
+	}
+	if leaderboard.Rankings == nil {
+		leaderboard.Rankings = make(map[string][]*LeaderboardEntry)
+	}
+
+	for _, metric := range LeaderboardMetrics {
+		for _, stats := range users {
+			leaderboard.Rankings[metric] = offerEntry(leaderboard.Rankings[metric], NewLeaderboardEntry(stats, metric, subspaceID))
+		}
+	}
+	return lm.saveLeaderboard(ctx, leaderboard)
+}
+
+// saveLeaderboard saves a leaderboard document
+func (lm *LeaderboardManager) saveLeaderboard(ctx context.Context, leaderboard *Leaderboard) error {
+	leaderboard.Updated = time.Now().Unix()
+
+	doc := map[string]interface{}{
+		"_id":            leaderboard.ID,
+		"id":             leaderboard.ID,
+		"doc_type":       DocTypeLeaderboard,
+		"schema_version": schemaVersion(DocTypeLeaderboard),
+		"subspace_id":    leaderboard.SubspaceID,
+		"rankings":       leaderboard.Rankings,
+		"updated":        leaderboard.Updated,
+	}
+	_, err := lm.db.Put(ctx, doc)
+	return err
+}
+
+// RemoveUser removes a user from the rankings of every leaderboard and returns the IDs of
+// the leaderboards changed. Rankings are refilled as other users' statistics change.
+func (lm *LeaderboardManager) RemoveUser(ctx context.Context, userID string) ([]string, error) {
+	docs, err := queryDocuments(ctx, lm.db, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		return ok && docMap["doc_type"] == DocTypeLeaderboard, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []string{}
+	for _, doc := range docs {
+		jsonData, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var leaderboard Leaderboard
+		if err := json.Unmarshal(jsonData, &leaderboard); err != nil {
+			return nil, err
+		}
+
+		removed := false
+		for metric, ranking := range leaderboard.Rankings {
+			kept := ranking[:0]
+			for _, entry := range ranking {
+				if entry.UserID == userID {
+					removed = true
+					continue
+				}
+				kept = append(kept, entry)
+			}
+			leaderboard.Rankings[metric] = kept
+		}
+		if !removed {
+			continue
+		}
+		if err := lm.saveLeaderboard(ctx, &leaderboard); err != nil {
+			return nil, err
+		}
+		changed = append(changed, leaderboard.ID)
+	}
+	return changed, nil
+}
+
+// offerEntry replaces the user's row in a ranking and keeps the top LeaderboardSize rows.
+// Statistics only grow, so a user that dropped out of the ranking can't belong in it again
+// until it is offered with a higher score.
+func offerEntry(ranking []*LeaderboardEntry, entry *LeaderboardEntry) []*LeaderboardEntry {
+	for i, existing := range ranking {
+		if existing.UserID == entry.UserID {
+			ranking = append(ranking[:i], ranking[i+1:]...)
+			break
+		}
+	}
+
+	if entry.Score == 0 {
+		return ranking
+	}
+	if len(ranking) >= LeaderboardSize && !ranking[len(ranking)-1].RanksBelow(entry) {
+		return ranking
+	}
+
+	ranking = append(ranking, entry)
+	sort.SliceStable(ranking, func(i, j int) bool {
+		return ranking[j].RanksBelow(ranking[i])
+	})
+	if len(ranking) > LeaderboardSize {
+		ranking = ranking[:LeaderboardSize]
+	}
+	return ranking
+}
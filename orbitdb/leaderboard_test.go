@@ -0,0 +1,124 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that leaderboards follow user statistics as events are saved
+func TestLeaderboardUpdates(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("leaderboard"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000d4"
+	alice, bob, carol := testPubKey("alice"), testPubKey("bob"), testPubKey("carol")
+	events := []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30100,
+			Tags: nostr.Tags{{"sid", sid}, {"ops", "post=30300,vote=30302,invite=30303"}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000100, Kind: 30300, Tags: nostr.Tags{{"sid", sid}, {"op", "post"}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000200, Kind: 30300, Tags: nostr.Tags{{"sid", sid}, {"op", "post"}}}),
+		signAs(t, "carol", &nostr.Event{CreatedAt: 1700000300, Kind: 30302,
+			Tags: nostr.Tags{{"sid", sid}, {"op", "vote"}, {"vote", "yes"}}}),
+		signAs(t, "dave", &nostr.Event{CreatedAt: 1700000400, Kind: 30303,
+			Tags: nostr.Tags{{"sid", sid}, {"op", "invite"}, {"inviter_addr", alice}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000500, Kind: 1}),
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+
+	global, err := adapter.GetLeaderboard(ctx, "")
+	require.NoError(t, err)
+	require.NotNil(t, global)
+
+	totals := global.Rankings[LeaderboardTotalEvents]
+	require.Len(t, totals, 4)
+	assert.Equal(t, bob, totals[0].UserID)
+	assert.Equal(t, uint64(3), totals[0].Score)
+	// Ties are ordered by user ID
+	assert.Equal(t, testPubKeys("alice", "carol", "dave"), []string{totals[1].UserID, totals[2].UserID, totals[3].UserID})
+
+	// The inviter is ranked although the invite event was authored by the invitee
+	invites := global.Rankings[LeaderboardInvites]
+	require.Len(t, invites, 1)
+	assert.Equal(t, alice, invites[0].UserID)
+
+	// The subspace leaderboard ignores activity outside the subspace
+	subspace, err := adapter.GetLeaderboard(ctx, sid)
+	require.NoError(t, err)
+	require.NotNil(t, subspace)
+	assert.Equal(t, bob, subspace.Rankings[LeaderboardTotalEvents][0].UserID)
+	assert.Equal(t, uint64(2), subspace.Rankings[LeaderboardTotalEvents][0].Score)
+	require.Len(t, subspace.Rankings[LeaderboardVotes], 1)
+	assert.Equal(t, carol, subspace.Rankings[LeaderboardVotes][0].UserID)
+
+	// Subspace leaderboards can't take the place of the global leaderboard
+	assert.NotEqual(t, leaderboardID(""), leaderboardID("global"))
+
+	// Leaderboards of subspaces without events don't exist
+	missing, err := adapter.GetLeaderboard(ctx, "0x00000000000000000000000000000000000000000000000000000000000000e5")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+// Test that rankings are capped at LeaderboardSize
+func TestOfferEntryKeepsTopRows(t *testing.T) {
+	var ranking []*LeaderboardEntry
+	for i := 1; i <= LeaderboardSize+5; i++ {
+		ranking = offerEntry(ranking, &LeaderboardEntry{UserID: string(rune('a'+i%26)) + string(rune('0'+i/26)), Score: uint64(i)})
+	}
+	require.Len(t, ranking, LeaderboardSize)
+	assert.Equal(t, uint64(LeaderboardSize+5), ranking[0].Score)
+	assert.Equal(t, uint64(6), ranking[LeaderboardSize-1].Score)
+
+	// Updating a user replaces its row
+	ranking = offerEntry(ranking, &LeaderboardEntry{UserID: ranking[LeaderboardSize-1].UserID, Score: 1000})
+	require.Len(t, ranking, LeaderboardSize)
+	assert.Equal(t, uint64(1000), ranking[0].Score)
+	assert.Equal(t, uint64(7), ranking[LeaderboardSize-1].Score)
+}
+
+func TestTopSubspacesByRecentActivity(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("top-subspaces"))
+
+	busy := "0x00000000000000000000000000000000000000000000000000000000000000e1"
+	crowded := "0x00000000000000000000000000000000000000000000000000000000000000e2"
+	old := "0x00000000000000000000000000000000000000000000000000000000000000e3"
+	now := nostr.Now()
+	events := []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: now, Kind: 30100, Tags: nostr.Tags{{"sid", busy}, {"subspace_name", "Busy"}}}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: now, Kind: 30300, Tags: nostr.Tags{{"sid", busy}}, Content: "first"}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: now, Kind: 30300, Tags: nostr.Tags{{"sid", busy}}, Content: "second"}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: now, Kind: 30302, Tags: nostr.Tags{{"sid", busy}, {"proposal_id", "p"}, {"vote", "yes"}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: now - 3*3600, Kind: 30300, Tags: nostr.Tags{{"sid", crowded}}}),
+		signAs(t, "carol", &nostr.Event{CreatedAt: now - 3*3600, Kind: 30300, Tags: nostr.Tags{{"sid", crowded}}}),
+		signAs(t, "dave", &nostr.Event{CreatedAt: now - 30*24*3600, Kind: 30300, Tags: nostr.Tags{{"sid", old}}}),
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+
+	top, err := adapter.TopSubspaces(ctx, 24*time.Hour, SubspaceActivityEvents, 10)
+	require.NoError(t, err)
+	require.Len(t, top, 2, "activity older than the retention is not counted")
+	assert.Equal(t, busy, top[0].SubspaceID)
+	assert.Equal(t, "Busy", top[0].Name)
+	assert.Equal(t, uint64(4), top[0].Events)
+	assert.Equal(t, uint64(1), top[0].Votes)
+
+	top, err = adapter.TopSubspaces(ctx, 24*time.Hour, SubspaceActivityUsers, 10)
+	require.NoError(t, err)
+	assert.Equal(t, crowded, top[0].SubspaceID)
+	assert.Equal(t, 2, top[0].Users)
+
+	top, err = adapter.TopSubspaces(ctx, time.Hour, SubspaceActivityEvents, 10)
+	require.NoError(t, err)
+	require.Len(t, top, 1, "the window excludes older hours")
+	assert.Equal(t, busy, top[0].SubspaceID)
+}
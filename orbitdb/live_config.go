@@ -0,0 +1,157 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeLiveConfig identifies the replicated live configuration document
+const DocTypeLiveConfig = "live_config"
+
+// liveConfigDocID is the key of the single live configuration document
+const liveConfigDocID = "live_config"
+
+// Live configuration events are NIP-78 application data events with a fixed d tag,
+// signed by one of the signers every node trusts
+const (
+	LiveConfigKind = 30078
+	LiveConfigTag  = "crelay-config"
+)
+
+// ErrInvalidLiveConfig is returned for live configuration events that aren't validly signed
+// by a trusted key or don't hold a valid configuration
+var ErrInvalidLiveConfig = errors.New("invalid live configuration")
+
+// ErrOutdatedLiveConfig is returned when publishing a live configuration that isn't newer
+// than the current one
+var ErrOutdatedLiveConfig = errors.New("live configuration is not newer than the current one")
+
+// LiveConfig holds the feature flags and policy toggles applied by every node
+type LiveConfig struct {
+	EventID  string          `json:"event_id"`          // ID of the signed configuration event
+	Signer   string          `json:"signer"`            // Public key that signed the configuration
+	Version  int64           `json:"version"`           // Creation timestamp of the event, later versions win
+	Flags    map[string]bool `json:"flags,omitempty"`   // Feature flags by name
+	ReadOnly bool            `json:"read_only"`         // Refuse event writes on every node
+	MinPoW   int             `json:"min_pow,omitempty"` // NIP-13 difficulty events must have to be saved, 0 to disable
+}
+
+// Flag reports whether a feature flag is enabled, false if it isn't set
+func (c *LiveConfig) Flag(name string) bool {
+	return c != nil && c.Flags[name]
+}
+
+// ParseLiveConfig verifies a live configuration event and parses its content. The event
+// must be signed by one of signers.
+func ParseLiveConfig(event *nostr.Event, signers []string) (*LiveConfig, error) {
+	var d string
+	if tag := event.Tags.GetFirst([]string{"d", ""}); tag != nil {
+		d = tag.Value()
+	}
+	if event.Kind != LiveConfigKind || d != LiveConfigTag {
+		return nil, fmt.Errorf("%w: not a live configuration event: kind %d, d tag %q", ErrInvalidLiveConfig, event.Kind, d)
+	}
+	if !containsString(signers, event.PubKey) {
+		return nil, fmt.Errorf("%w: signed by untrusted key %s", ErrInvalidLiveConfig, event.PubKey)
+	}
+	if ok, err := event.CheckSignature(); err != nil || !ok || event.GetID() != event.ID {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidLiveConfig)
+	}
+
+	var config LiveConfig
+	if err := json.Unmarshal([]byte(event.Content), &config); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLiveConfig, err)
+	}
+	if config.MinPoW < 0 || config.MinPoW > 256 {
+		return nil, fmt.Errorf("%w: min_pow must be between 0 and 256", ErrInvalidLiveConfig)
+	}
+
+	config.EventID = event.ID
+	config.Signer = event.PubKey
+	config.Version = int64(event.CreatedAt)
+	return &config, nil
+}
+
+// GetLiveConfig retrieves the current live configuration. Returns nil if none was published
+// or the replicated document isn't signed by one of signers.
+func (a *OrbitDBAdapter) GetLiveConfig(ctx context.Context, signers []string) (*LiveConfig, error) {
+	event, err := a.getLiveConfigEvent(ctx)
+	if err != nil || event == nil {
+		return nil, err
+	}
+
+	config, err := ParseLiveConfig(event, signers)
+	if err != nil {
+		// Any writer can replace the document, only trusted configurations are applied
+		return nil, nil
+	}
+	return config, nil
+}
+
+// PublishLiveConfig verifies a signed live configuration event and stores it, from where it
+// replicates to every node. Returns ErrOutdatedLiveConfig unless it is newer than the
+// current configuration.
+func (a *OrbitDBAdapter) PublishLiveConfig(ctx context.Context, event *nostr.Event, signers []string) (*LiveConfig, error) {
+	config, err := ParseLiveConfig(event, signers)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := a.GetLiveConfig(ctx, signers)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Version >= config.Version {
+		return nil, ErrOutdatedLiveConfig
+	}
+
+	doc := map[string]interface{}{
+		"_id":            liveConfigDocID,
+		"id":             liveConfigDocID,
+		"doc_type":       DocTypeLiveConfig,
+		"schema_version": schemaVersion(DocTypeLiveConfig),
+		"event":          event,
+	}
+	if _, err := a.db.Put(ctx, doc); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// getLiveConfigEvent retrieves the event of the live configuration document, nil if there is none
+func (a *OrbitDBAdapter) getLiveConfigEvent(ctx context.Context) (*nostr.Event, error) {
+	docs, err := a.db.Get(ctx, liveConfigDocID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeLiveConfig {
+			continue
+		}
+
+		// Convert the stored event to JSON and parse it back
+		jsonData, err := json.Marshal(docMap["event"])
+		if err != nil {
+			return nil, err
+		}
+
+		var event nostr.Event
+		if err := json.Unmarshal(jsonData, &event); err != nil {
+			return nil, err
+		}
+		return &event, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,228 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"berty.tech/go-orbit-db/address"
+	"berty.tech/go-orbit-db/iface"
+	"berty.tech/go-orbit-db/stores/operation"
+	"berty.tech/go-orbit-db/stores/replicator"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+)
+
+// memoryStoreRoot is the CID used in the addresses of in-memory stores
+const memoryStoreRoot = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+
+// MemoryDocumentStore is an in-memory DocumentStore for tests and local tooling.
+// It supports the document operations used by the adapter (Put, PutBatch, PutAll,
+// Delete, Get and Query); it has no Replicator, its event bus never emits, and the oplog is
+// not available and calling it panics. Documents are stored as JSON and decoded like a docstore opened
+// with DocumentStoreOptions, and Query returns documents ordered by key so results are
+// deterministic.
+type MemoryDocumentStore struct {
+	iface.DocumentStore
+	name string
+	bus  event.Bus
+	mu   sync.RWMutex
+	docs map[string][]byte
+}
+
+// NewMemoryDocumentStore creates an empty in-memory document store
+func NewMemoryDocumentStore(name string) *MemoryDocumentStore {
+	return &MemoryDocumentStore{
+		name: name,
+		bus:  eventbus.NewBus(),
+		docs: make(map[string][]byte),
+	}
+}
+
+// Put stores a document under its _id
+func (s *MemoryDocumentStore) Put(ctx context.Context, document interface{}) (operation.Operation, error) {
+	return nil, s.put(document)
+}
+
+// PutBatch stores several documents
+func (s *MemoryDocumentStore) PutBatch(ctx context.Context, values []interface{}) (operation.Operation, error) {
+	for _, value := range values {
+		if err := s.put(value); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// PutAll stores several documents
+func (s *MemoryDocumentStore) PutAll(ctx context.Context, values []interface{}) (operation.Operation, error) {
+	return s.PutBatch(ctx, values)
+}
+
+// Delete removes the document with the given key
+func (s *MemoryDocumentStore) Delete(ctx context.Context, key string) (operation.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.docs[key]; !exists {
+		return nil, fmt.Errorf("no entry with key '%s' in database", key)
+	}
+	delete(s.docs, key)
+	return nil, nil
+}
+
+// Get returns the documents whose key matches, honoring partial and case-insensitive matching
+func (s *MemoryDocumentStore) Get(ctx context.Context, key string, opts *iface.DocumentStoreGetOptions) ([]interface{}, error) {
+	if opts == nil {
+		opts = &iface.DocumentStoreGetOptions{}
+	}
+	if opts.CaseInsensitive {
+		key = strings.ToLower(key)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var documents []interface{}
+	for _, docKey := range s.sortedKeys() {
+		searchKey := docKey
+		if opts.CaseInsensitive {
+			searchKey = strings.ToLower(searchKey)
+		}
+
+		if opts.PartialMatches {
+			if !strings.Contains(searchKey, key) {
+				continue
+			}
+		} else if searchKey != key {
+			continue
+		}
+
+		doc, err := s.decode(docKey)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+
+	return documents, nil
+}
+
+// Query returns the documents accepted by filter, ordered by key. Like the docstore, it
+// iterates over a snapshot of the keys and calls filter without holding the store lock, so
+// filter may write to the store; documents deleted during the scan are skipped.
+func (s *MemoryDocumentStore) Query(ctx context.Context, filter func(doc interface{}) (bool, error)) ([]interface{}, error) {
+	s.mu.RLock()
+	keys := s.sortedKeys()
+	s.mu.RUnlock()
+
+	var documents []interface{}
+	for _, docKey := range keys {
+		doc, ok, err := s.lookup(docKey)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		ok, err = filter(doc)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			documents = append(documents, doc)
+		}
+	}
+
+	return documents, nil
+}
+
+// Address returns a fixed address derived from the store name
+func (s *MemoryDocumentStore) Address() address.Address {
+	addr, _ := address.Parse("/orbitdb/" + memoryStoreRoot + "/" + s.name)
+	return addr
+}
+
+// DBName returns the store name
+func (s *MemoryDocumentStore) DBName() string {
+	return s.name
+}
+
+// Type returns the store type
+func (s *MemoryDocumentStore) Type() string {
+	return "docstore"
+}
+
+// Replicator returns nil, in-memory stores don't replicate
+func (s *MemoryDocumentStore) Replicator() replicator.Replicator {
+	return nil
+}
+
+// EventBus returns the store's event bus, nothing is emitted on it as in-memory stores
+// don't replicate
+func (s *MemoryDocumentStore) EventBus() event.Bus {
+	return s.bus
+}
+
+// Close does nothing, the documents stay in memory
+func (s *MemoryDocumentStore) Close() error {
+	return nil
+}
+
+// put stores one document after a JSON round trip
+func (s *MemoryDocumentStore) put(document interface{}) error {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]interface{}
+	if err := decodeJSON(data, &doc); err != nil {
+		return fmt.Errorf("document must be a JSON object: %w", err)
+	}
+
+	key, ok := doc["_id"].(string)
+	if !ok || key == "" {
+		return fmt.Errorf("missing value for field `_id` in document")
+	}
+
+	s.mu.Lock()
+	s.docs[key] = data
+	s.mu.Unlock()
+	return nil
+}
+
+// decode returns a fresh copy of a stored document. Must be called with mu held.
+func (s *MemoryDocumentStore) decode(key string) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := decodeJSON(s.docs[key], &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// lookup decodes the document stored under key, reporting whether there is one
+func (s *MemoryDocumentStore) lookup(key string) (map[string]interface{}, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.docs[key]; !exists {
+		return nil, false, nil
+	}
+	doc, err := s.decode(key)
+	return doc, err == nil, err
+}
+
+// sortedKeys returns the document keys in order. Must be called with mu held.
+func (s *MemoryDocumentStore) sortedKeys() []string {
+	keys := make([]string, 0, len(s.docs))
+	for key := range s.docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
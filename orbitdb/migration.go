@@ -0,0 +1,271 @@
+package orbitdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"berty.tech/go-orbit-db/stores/operation"
+	"go.uber.org/zap"
+)
+
+// ErrNoMigration is returned by migration operations when no migration is configured
+var ErrNoMigration = errors.New("no migration in progress")
+
+// Migration phases
+const (
+	MigrationPhaseDualWrite   = "dual_write"  // Writes go to both stores, reads from the old store
+	MigrationPhaseBackfilling = "backfilling" // History is being copied into the new store
+	MigrationPhaseBackfilled  = "backfilled"  // History copied, ready to flip reads
+	MigrationPhaseFlipped     = "flipped"     // Reads served by the new store, writes still go to both
+)
+
+// migrationBatchSize is the number of documents copied per PutBatch during backfill
+const migrationBatchSize = 100
+
+// MigrationStatus describes the progress of a migration
+type MigrationStatus struct {
+	OldAddress    string `json:"old_address"`                 // Address of the store being migrated from
+	NewAddress    string `json:"new_address"`                 // Address of the store being migrated to
+	Phase         string `json:"phase"`                       // Current phase
+	Copied        int    `json:"copied"`                      // Documents copied by the backfill
+	Skipped       int    `json:"skipped"`                     // Documents skipped because they were written during the migration
+	WriteFailures int    `json:"write_failures"`              // Failed writes to the secondary store
+	LastError     string `json:"last_error,omitempty"`        // Last backfill or secondary write error
+	Started       int64  `json:"started"`                     // Migration start timestamp
+	BackfillStart int64  `json:"backfill_started,omitempty"`  // Last backfill start timestamp
+	BackfillEnd   int64  `json:"backfill_finished,omitempty"` // Last backfill end timestamp
+	Flipped       int64  `json:"flipped,omitempty"`           // Timestamp reads were flipped to the new store
+}
+
+// MigrationStore is a DocumentStore that migrates data from an old to a new store
+// without downtime. Writes go to both stores, history is backfilled on demand and
+// reads are flipped to the new store atomically once the backfill has completed.
+// Methods that are not overridden, such as Address and EventBus, use the old store.
+type MigrationStore struct {
+	iface.DocumentStore
+	newDB iface.DocumentStore
+
+	flipped atomic.Bool
+
+	mu      sync.Mutex
+	written map[string]bool // Keys written or deleted since the migration started
+	status  MigrationStatus
+}
+
+// NewMigrationStore starts a migration from oldDB to newDB in dual-write mode
+func NewMigrationStore(oldDB, newDB iface.DocumentStore) *MigrationStore {
+	return &MigrationStore{
+		DocumentStore: oldDB,
+		newDB:         newDB,
+		written:       make(map[string]bool),
+		status: MigrationStatus{
+			OldAddress: oldDB.Address().String(),
+			NewAddress: newDB.Address().String(),
+			Phase:      MigrationPhaseDualWrite,
+			Started:    time.Now().Unix(),
+		},
+	}
+}
+
+// stores returns the store serving reads and the other store
+func (m *MigrationStore) stores() (primary, secondary iface.DocumentStore) {
+	if m.flipped.Load() {
+		return m.newDB, m.DocumentStore
+	}
+	return m.DocumentStore, m.newDB
+}
+
+// Put writes the document to both stores
+func (m *MigrationStore) Put(ctx context.Context, document interface{}) (operation.Operation, error) {
+	return m.dualWrite(ctx, documentKeys(document), func(db iface.DocumentStore) (operation.Operation, error) {
+		return db.Put(ctx, document)
+	})
+}
+
+// Delete deletes the document from both stores
+func (m *MigrationStore) Delete(ctx context.Context, key string) (operation.Operation, error) {
+	return m.dualWrite(ctx, []string{key}, func(db iface.DocumentStore) (operation.Operation, error) {
+		return db.Delete(ctx, key)
+	})
+}
+
+// PutBatch writes the documents to both stores
+func (m *MigrationStore) PutBatch(ctx context.Context, values []interface{}) (operation.Operation, error) {
+	return m.dualWrite(ctx, documentKeys(values...), func(db iface.DocumentStore) (operation.Operation, error) {
+		return db.PutBatch(ctx, values)
+	})
+}
+
+// PutAll writes the documents to both stores
+func (m *MigrationStore) PutAll(ctx context.Context, values []interface{}) (operation.Operation, error) {
+	return m.dualWrite(ctx, documentKeys(values...), func(db iface.DocumentStore) (operation.Operation, error) {
+		return db.PutAll(ctx, values)
+	})
+}
+
+// Get reads from the store currently serving reads
+func (m *MigrationStore) Get(ctx context.Context, key string, opts *iface.DocumentStoreGetOptions) ([]interface{}, error) {
+	primary, _ := m.stores()
+	return primary.Get(ctx, key, opts)
+}
+
+// Query reads from the store currently serving reads
+func (m *MigrationStore) Query(ctx context.Context, filter func(doc interface{}) (bool, error)) ([]interface{}, error) {
+	primary, _ := m.stores()
+	return primary.Query(ctx, filter)
+}
+
+// dualWrite applies a write to the primary store, then to the secondary store.
+// Failures on the secondary store are logged and do not fail the write.
+func (m *MigrationStore) dualWrite(ctx context.Context, keys []string, write func(iface.DocumentStore) (operation.Operation, error)) (operation.Operation, error) {
+	primary, secondary := m.stores()
+
+	op, err := write(primary)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mark the keys before writing so a concurrent backfill batch cannot
+	// overwrite them with older copies afterwards
+	m.mu.Lock()
+	for _, key := range keys {
+		m.written[key] = true
+	}
+	m.mu.Unlock()
+
+	if _, err := write(secondary); err != nil {
+		zap.L().Warn("Failed to write to migration secondary store", zap.Error(err))
+		m.mu.Lock()
+		// Let the backfill copy these keys instead
+		for _, key := range keys {
+			delete(m.written, key)
+		}
+		m.status.WriteFailures++
+		m.status.LastError = err.Error()
+		m.mu.Unlock()
+	}
+
+	return op, nil
+}
+
+// Status returns the current migration status
+func (m *MigrationStore) Status() MigrationStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// StartBackfill copies all documents of the old store into the new store in the background
+func (m *MigrationStore) StartBackfill() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch m.status.Phase {
+	case MigrationPhaseBackfilling:
+		return fmt.Errorf("backfill already running")
+	case MigrationPhaseFlipped:
+		return fmt.Errorf("reads have already been flipped to the new store")
+	}
+
+	m.status.Phase = MigrationPhaseBackfilling
+	m.status.Copied = 0
+	m.status.Skipped = 0
+	m.status.LastError = ""
+	m.status.BackfillStart = time.Now().Unix()
+	m.status.BackfillEnd = 0
+
+	go m.backfill(context.Background())
+	return nil
+}
+
+// backfill copies the documents of the old store that were not written during the migration
+func (m *MigrationStore) backfill(ctx context.Context) {
+	docs, err := queryDocuments(ctx, m.DocumentStore, func(doc interface{}) (bool, error) {
+		return true, nil
+	})
+	if err != nil {
+		m.finishBackfill(MigrationPhaseDualWrite, err)
+		return
+	}
+
+	for start := 0; start < len(docs); start += migrationBatchSize {
+		end := start + migrationBatchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+
+		// Skip keys written since the migration started, the new store already has their latest version.
+		// The lock is held while writing the batch so dual writes cannot interleave.
+		m.mu.Lock()
+		batch := make([]interface{}, 0, end-start)
+		for _, doc := range docs[start:end] {
+			keys := documentKeys(doc)
+			if len(keys) == 1 && m.written[keys[0]] {
+				m.status.Skipped++
+				continue
+			}
+			batch = append(batch, doc)
+		}
+
+		if len(batch) > 0 {
+			if _, err := m.newDB.PutBatch(ctx, batch); err != nil {
+				m.mu.Unlock()
+				m.finishBackfill(MigrationPhaseDualWrite, err)
+				return
+			}
+			m.status.Copied += len(batch)
+		}
+		m.mu.Unlock()
+	}
+
+	m.finishBackfill(MigrationPhaseBackfilled, nil)
+}
+
+// finishBackfill records the end of a backfill run
+func (m *MigrationStore) finishBackfill(phase string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.status.Phase = phase
+	m.status.BackfillEnd = time.Now().Unix()
+	if err != nil {
+		m.status.LastError = err.Error()
+		zap.L().Error("Migration backfill failed", zap.Error(err))
+		return
+	}
+	zap.L().Info("Migration backfill finished", zap.Int("copied", m.status.Copied), zap.Int("skipped", m.status.Skipped))
+}
+
+// Flip switches reads to the new store. It requires a completed backfill.
+func (m *MigrationStore) Flip() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.status.Phase != MigrationPhaseBackfilled {
+		return fmt.Errorf("cannot flip reads in phase %s, backfill must complete first", m.status.Phase)
+	}
+
+	m.flipped.Store(true)
+	m.status.Phase = MigrationPhaseFlipped
+	m.status.Flipped = time.Now().Unix()
+	zap.L().Info("Migration flipped reads", zap.String("address", m.status.NewAddress))
+	return nil
+}
+
+// Helper function: extract the _id keys of documents
+func documentKeys(documents ...interface{}) []string {
+	var keys []string
+	for _, document := range documents {
+		if docMap, ok := document.(map[string]interface{}); ok {
+			if key, ok := docMap["_id"].(string); ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,134 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"berty.tech/go-orbit-db/address"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: create a mock store with a parsed address
+func newMockStoreWithAddress(t *testing.T, name string) *MockDocumentStore {
+	addr, err := address.Parse("/orbitdb/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn/" + name)
+	require.NoError(t, err)
+
+	db := new(MockDocumentStore)
+	db.On("Address").Return(addr)
+	return db
+}
+
+// Test dual writes, backfill and flipping reads
+func TestMigrationStore(t *testing.T) {
+	oldDB := newMockStoreWithAddress(t, "old")
+	newDB := newMockStoreWithAddress(t, "new")
+	migration := NewMigrationStore(oldDB, newDB)
+	ctx := context.Background()
+
+	// Writes go to both stores
+	updated := map[string]interface{}{"_id": "doc-updated", "value": float64(2)}
+	oldDB.On("Put", mock.Anything, updated).Return(nil, nil).Once()
+	newDB.On("Put", mock.Anything, updated).Return(nil, nil).Once()
+	_, err := migration.Put(ctx, updated)
+	assert.NoError(t, err)
+
+	// Reads are served by the old store before the flip
+	oldDB.On("Get", mock.Anything, "doc-updated", mock.Anything).Return([]interface{}{updated}, nil).Once()
+	_, err = migration.Get(ctx, "doc-updated", nil)
+	assert.NoError(t, err)
+
+	// Flipping requires a backfill
+	assert.Error(t, migration.Flip())
+
+	// Backfill copies history but skips keys written during the migration
+	history := map[string]interface{}{"_id": "doc-history", "value": float64(1)}
+	stale := map[string]interface{}{"_id": "doc-updated", "value": float64(1)}
+	oldDB.On("Query", mock.Anything, mock.Anything).Return([]interface{}{history, stale}, nil).Once()
+	newDB.On("PutBatch", mock.Anything, []interface{}{history}).Return(nil, nil).Once()
+	require.NoError(t, migration.StartBackfill())
+
+	require.Eventually(t, func() bool {
+		return migration.Status().Phase == MigrationPhaseBackfilled
+	}, time.Second, 10*time.Millisecond)
+	status := migration.Status()
+	assert.Equal(t, 1, status.Copied)
+	assert.Equal(t, 1, status.Skipped)
+
+	// After the flip, reads are served by the new store
+	require.NoError(t, migration.Flip())
+	newDB.On("Get", mock.Anything, "doc-history", mock.Anything).Return([]interface{}{history}, nil).Once()
+	docs, err := migration.Get(ctx, "doc-history", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{history}, docs)
+	assert.Equal(t, MigrationPhaseFlipped, migration.Status().Phase)
+
+	oldDB.AssertExpectations(t)
+	newDB.AssertExpectations(t)
+}
+
+// Test that a split store keeps each document type in its store and that a single store
+// migrates into it
+func TestSplitStoreMigration(t *testing.T) {
+	ctx := context.Background()
+	single := NewMemoryDocumentStore("single")
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000d4"
+	create := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30100,
+		Tags: nostr.Tags{{"sid", sid}, {"ops", "post=30300"}}})
+	require.NoError(t, NewOrbitDBAdapter(single).SaveEvent(ctx, create))
+
+	events := NewMemoryDocumentStore("events")
+	causality := NewMemoryDocumentStore("causality")
+	stats := NewMemoryDocumentStore("stats")
+	migration := NewMigrationStore(single, NewSplitStore(events, causality, stats))
+
+	require.NoError(t, migration.StartBackfill())
+	require.Eventually(t, func() bool {
+		return migration.Status().Phase == MigrationPhaseBackfilled
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, migration.Flip())
+
+	// Writes during the migration reach the split stores too
+	adapter := NewOrbitDBAdapter(migration)
+	post := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000100, Kind: 30300,
+		Tags: nostr.Tags{{"sid", sid}, {"op", "post"}}})
+	require.NoError(t, adapter.SaveEvent(ctx, post))
+
+	docTypes := func(db *MemoryDocumentStore) map[string]bool {
+		types := make(map[string]bool)
+		docs, err := db.Query(ctx, func(interface{}) (bool, error) { return true, nil })
+		require.NoError(t, err)
+		for _, doc := range docs {
+			types[doc.(map[string]interface{})["doc_type"].(string)] = true
+		}
+		return types
+	}
+	assert.Equal(t, map[string]bool{DocTypeNostrEvent: true}, docTypes(events))
+	assert.Equal(t, map[string]bool{DocTypeCausality: true, DocTypeCausalityEvents: true, DocTypeProcessedEvent: true}, docTypes(causality))
+	assert.True(t, docTypes(stats)["user_stats"])
+	assert.False(t, docTypes(stats)[DocTypeNostrEvent])
+
+	// After the migration the split stores serve the adapter on their own
+	adapter = NewOrbitDBAdapter(NewSplitStore(events, causality, stats))
+	event, err := adapter.GetEventByID(ctx, post.ID)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+
+	counter, err := adapter.GetCausalityKey(ctx, sid, 30300)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), counter)
+
+	userStats, err := adapter.GetUserStats(ctx, testPubKey("alice"))
+	require.NoError(t, err)
+	require.NotNil(t, userStats)
+	assert.Equal(t, uint64(1), userStats.TotalStats[30300])
+
+	// Rebuilding deletes derived documents from whichever store holds them
+	result, err := adapter.RebuildDerivedData(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Events)
+	assert.Equal(t, 0, result.Failures)
+}
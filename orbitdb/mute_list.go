@@ -0,0 +1,217 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeMuteList identifies NIP-51 mute and ban list documents
+const DocTypeMuteList = "mute_list"
+
+// NIP-51 list kinds holding muted users: the mute list of a user, and the named sets whose d
+// tag is one of MuteSetNames
+const (
+	MuteListKind = 10000
+	MuteSetKind  = 30000
+)
+
+// MuteSetNames are the d tags of the kind 30000 sets that mute their users
+var MuteSetNames = []string{"mute", "ban"}
+
+// MuteList is the latest version of a mute list or mute set of a user
+type MuteList struct {
+	ID        string   `json:"id"`         // Document ID, format: mute_list:<pubkey>:<kind>:<d tag>
+	DocType   string   `json:"doc_type"`   // Document type, fixed as "mute_list"
+	PubKey    string   `json:"pubkey"`     // Public key of the list's author
+	Kind      int      `json:"kind"`       // 10000 or 30000
+	Name      string   `json:"name"`       // d tag of a kind 30000 set, empty for kind 10000
+	Muted     []string `json:"muted"`      // Public keys from the p tags, sorted
+	EventID   string   `json:"event_id"`   // ID of the event the list comes from
+	CreatedAt int64    `json:"created_at"` // Event timestamp
+	Updated   int64    `json:"updated"`    // Update timestamp
+}
+
+// MuteListManager maintains the mute lists of every user. Only the lists of the configured
+// moderators are enforced, so the moderators can change without a rebuild.
+type MuteListManager struct {
+	db iface.DocumentStore
+}
+
+// NewMuteListManager creates a new MuteListManager
+func NewMuteListManager(db iface.DocumentStore) *MuteListManager {
+	return &MuteListManager{db: db}
+}
+
+// muteListDocID returns the document key of a list of a user
+func muteListDocID(pubKey string, kind int, name string) string {
+	return DocTypeMuteList + ":" + pubKey + ":" + strconv.Itoa(kind) + ":" + name
+}
+
+// muteListAddress returns the kind and name of the mute list an event replaces, false if
+// the event isn't a mute list
+func muteListAddress(event *nostr.Event) (int, string, bool) {
+	switch event.Kind {
+	case MuteListKind:
+		return event.Kind, "", true
+	case MuteSetKind:
+		var name string
+		if tag := event.Tags.GetFirst([]string{"d", ""}); tag != nil {
+			name = tag.Value()
+		}
+		return event.Kind, name, containsString(MuteSetNames, name)
+	}
+	return 0, "", false
+}
+
+// UpdateFromEvent stores a mute list. Lists are replaceable, so the newest event wins, ties
+// broken by the lowest ID as in NIP-01.
+func (mm *MuteListManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	kind, name, ok := muteListAddress(event)
+	if !ok {
+		return nil
+	}
+
+	existing, err := mm.getMuteList(ctx, muteListDocID(event.PubKey, kind, name))
+	if err != nil {
+		return err
+	}
+	created := int64(event.CreatedAt)
+	if existing != nil && existing.EventID != event.ID &&
+		(existing.CreatedAt > created || existing.CreatedAt == created && existing.EventID < event.ID) {
+		return nil
+	}
+
+	muted := []string{}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "p" && tag[1] != "" {
+			muted = append(muted, tag[1])
+		}
+	}
+	sort.Strings(muted)
+
+	return mm.saveMuteList(ctx, &MuteList{
+		ID:        muteListDocID(event.PubKey, kind, name),
+		DocType:   DocTypeMuteList,
+		PubKey:    event.PubKey,
+		Kind:      kind,
+		Name:      name,
+		Muted:     compactStrings(muted),
+		EventID:   event.ID,
+		CreatedAt: created,
+	})
+}
+
+// RemoveEvent removes a mute list whose event was deleted
+func (mm *MuteListManager) RemoveEvent(ctx context.Context, event *nostr.Event) error {
+	kind, name, ok := muteListAddress(event)
+	if !ok {
+		return nil
+	}
+	list, err := mm.getMuteList(ctx, muteListDocID(event.PubKey, kind, name))
+	if err != nil || list == nil || list.EventID != event.ID {
+		return err
+	}
+	_, err = mm.db.Delete(ctx, list.ID)
+	return err
+}
+
+// MutedBy returns the users muted by any of the given users' mute lists and mute sets
+func (mm *MuteListManager) MutedBy(ctx context.Context, moderators []string) (map[string]bool, error) {
+	muted := make(map[string]bool)
+	for _, moderator := range moderators {
+		keys := []string{muteListDocID(moderator, MuteListKind, "")}
+		for _, name := range MuteSetNames {
+			keys = append(keys, muteListDocID(moderator, MuteSetKind, name))
+		}
+		for _, key := range keys {
+			list, err := mm.getMuteList(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			if list == nil {
+				continue
+			}
+			for _, pubKey := range list.Muted {
+				muted[pubKey] = true
+			}
+		}
+	}
+	return muted, nil
+}
+
+// getMuteList retrieves a mute list by document key, nil if it doesn't exist
+func (mm *MuteListManager) getMuteList(ctx context.Context, key string) (*MuteList, error) {
+	docs, err := mm.db.Get(ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeMuteList {
+			continue
+		}
+		return docToMuteList(docMap)
+	}
+
+	return nil, nil
+}
+
+// Helper function: parse a mute list document
+func docToMuteList(docMap map[string]interface{}) (*MuteList, error) {
+	// Convert document to JSON and parse into struct
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var list MuteList
+	if err := json.Unmarshal(jsonData, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// saveMuteList saves a mute list document
+func (mm *MuteListManager) saveMuteList(ctx context.Context, list *MuteList) error {
+	list.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            list.ID,
+		"id":             list.ID,
+		"doc_type":       DocTypeMuteList,
+		"schema_version": schemaVersion(DocTypeMuteList),
+		"pubkey":         list.PubKey,
+		"kind":           list.Kind,
+		"name":           list.Name,
+		"muted":          list.Muted,
+		"event_id":       list.EventID,
+		"created_at":     list.CreatedAt,
+		"updated":        list.Updated,
+	}
+
+	_, err := mm.db.Put(ctx, doc)
+	return err
+}
+
+// SetModerators sets the users whose NIP-51 mute lists, and kind 30000 sets named in
+// MuteSetNames, hide authors from queries made with WithMuteFilter. Must be called before
+// the adapter is shared.
+func (a *OrbitDBAdapter) SetModerators(pubKeys []string) {
+	a.moderators = pubKeys
+}
+
+// MutedAuthors returns the users muted by the moderators
+func (a *OrbitDBAdapter) MutedAuthors(ctx context.Context) (map[string]bool, error) {
+	return a.muteListMgr.MutedBy(ctx, a.moderators)
+}
@@ -0,0 +1,53 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that the mute lists of moderators hide authors from filtered queries
+func TestMuteLists(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("mutes"))
+	alice, spammer, troll := testPubKey("alice"), testPubKey("spammer"), testPubKey("troll")
+	adapter.SetModerators([]string{testPubKey("mod")})
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 1, Content: "note-1"}),
+		signAs(t, "spammer", &nostr.Event{CreatedAt: 1700000100, Kind: 1, Content: "note-2"}),
+		signAs(t, "troll", &nostr.Event{CreatedAt: 1700000200, Kind: 1, Content: "note-3"}),
+		signAs(t, "mod", &nostr.Event{CreatedAt: 1700000000, Kind: MuteListKind, Tags: nostr.Tags{{"p", spammer}}}),
+		signAs(t, "mod", &nostr.Event{CreatedAt: 1700000000, Kind: MuteSetKind, Tags: nostr.Tags{{"d", "ban"}, {"p", troll}}}),
+		signAs(t, "mod", &nostr.Event{CreatedAt: 1700000000, Kind: MuteSetKind, Tags: nostr.Tags{{"d", "friends"}, {"p", alice}}}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: MuteListKind, Tags: nostr.Tags{{"p", testPubKey("bob")}}}),
+	}))
+
+	muted, err := adapter.MutedAuthors(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{spammer: true, troll: true}, muted, "only mute and ban lists of moderators count")
+
+	notes := nostr.Filter{Kinds: []int{1}}
+	count, err := adapter.CountEvents(ctx, notes)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count, "queries without the filter keep muted authors")
+
+	filtered := WithMuteFilter(ctx)
+	count, err = adapter.CountEvents(filtered, notes)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	notes.Limit = 1
+	cursor, err := adapter.OpenEventCursor(filtered, notes)
+	require.NoError(t, err)
+	event, err := cursor.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "note-1", event.Content, "muted events don't take up the limit")
+
+	// A newer list replaces the old one
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "mod", &nostr.Event{CreatedAt: 1700000500, Kind: MuteListKind})))
+	muted, err = adapter.MutedAuthors(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{troll: true}, muted)
+}
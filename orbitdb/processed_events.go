@@ -0,0 +1,166 @@
+package orbitdb
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+)
+
+// DocTypeProcessedEvent identifies the markers of events whose derived data was updated
+const DocTypeProcessedEvent = "processed_event"
+
+// Bloom filter dimensions: 2^20 bits (128 KiB) and 4 probes keep false positives below 1%
+// for about 100,000 events per filter, beyond which more lookups reach the marker documents
+const (
+	processedFilterBits   = 1 << 20
+	processedFilterProbes = 4
+)
+
+// ProcessedEvents records which events a derived data manager has already applied, so
+// reprocessing an event, e.g. after a retried or repeated save, is a no-op. Markers are
+// persisted as documents; a bloom filter answers for most new events without reading them.
+type ProcessedEvents struct {
+	db    iface.DocumentStore
+	scope string // Manager the markers belong to, e.g. "user_stats"
+
+	mu     sync.Mutex
+	bits   []uint64 // Bloom filter of the marked event IDs, nil until loaded from the markers
+	loaded bool
+}
+
+// NewProcessedEvents creates the processed-event markers of a manager
+func NewProcessedEvents(db iface.DocumentStore, scope string) *ProcessedEvents {
+	return &ProcessedEvents{db: db, scope: scope}
+}
+
+// processedEventDocID returns the document key of an event's marker
+func (p *ProcessedEvents) processedEventDocID(eventID string) string {
+	return DocTypeProcessedEvent + ":" + p.scope + ":" + eventID
+}
+
+// Seen reports whether the event was marked as processed
+func (p *ProcessedEvents) Seen(ctx context.Context, eventID string) (bool, error) {
+	maybe, err := p.mayContain(ctx, eventID)
+	if err != nil || !maybe {
+		return false, err
+	}
+
+	// The filter may report false positives, the marker is authoritative
+	docs, err := p.db.Get(ctx, p.processedEventDocID(eventID), nil)
+	if err != nil {
+		return false, err
+	}
+	for _, doc := range docs {
+		if docMap, ok := doc.(map[string]interface{}); ok && docMap["doc_type"] == DocTypeProcessedEvent {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Mark records that the event was processed. The documents of the update it marks are
+// written along with the marker in a single operation, so a failed write leaves neither:
+// a retried update is applied once, never twice or skipped.
+func (p *ProcessedEvents) Mark(ctx context.Context, eventID string, docs ...interface{}) error {
+	marker := map[string]interface{}{
+		"_id":            p.processedEventDocID(eventID),
+		"id":             p.processedEventDocID(eventID),
+		"doc_type":       DocTypeProcessedEvent,
+		"schema_version": schemaVersion(DocTypeProcessedEvent),
+		"scope":          p.scope,
+		"event_id":       eventID,
+		"processed":      time.Now().Unix(),
+	}
+	if _, err := p.db.PutAll(ctx, append(docs, marker)); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.loaded {
+		p.add(eventID)
+	}
+	return nil
+}
+
+// Forget deletes the marker of an event, e.g. once the event was removed for good. The
+// filter keeps its bits, which only cost a marker lookup. Returns false if there was none.
+func (p *ProcessedEvents) Forget(ctx context.Context, eventID string) (bool, error) {
+	docs, err := p.db.Get(ctx, p.processedEventDocID(eventID), nil)
+	if err != nil || len(docs) == 0 {
+		return false, err
+	}
+	if _, err := p.db.Delete(ctx, p.processedEventDocID(eventID)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Reset forgets the loaded filter, which is reloaded from the markers on the next lookup.
+// Called after the markers are removed, e.g. by a rebuild.
+func (p *ProcessedEvents) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bits = nil
+	p.loaded = false
+}
+
+// mayContain checks the bloom filter, loading it from the persisted markers on first use.
+// Markers replicated from other nodes after the filter was loaded are only seen once the
+// filter is reset.
+func (p *ProcessedEvents) mayContain(ctx context.Context, eventID string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.loaded {
+		p.bits = make([]uint64, processedFilterBits/64)
+		_, err := queryDocuments(ctx, p.db, func(doc interface{}) (bool, error) {
+			docMap, ok := doc.(map[string]interface{})
+			if !ok || docMap["doc_type"] != DocTypeProcessedEvent || docMap["scope"] != p.scope {
+				return false, nil
+			}
+			if id, ok := docMap["event_id"].(string); ok {
+				p.add(id)
+			}
+			// Scan without collecting documents
+			return false, nil
+		})
+		if err != nil {
+			p.bits = nil
+			return false, err
+		}
+		p.loaded = true
+	}
+
+	for _, bit := range processedFilterPositions(eventID) {
+		if p.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// add sets the filter bits of an event ID. The caller holds p.mu.
+func (p *ProcessedEvents) add(eventID string) {
+	for _, bit := range processedFilterPositions(eventID) {
+		p.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// processedFilterPositions returns the filter bits of an event ID, derived from one 64-bit
+// hash split into two by double hashing
+func processedFilterPositions(eventID string) [processedFilterProbes]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(eventID))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+
+	var positions [processedFilterProbes]uint64
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % processedFilterBits
+	}
+	return positions
+}
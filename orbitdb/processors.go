@@ -0,0 +1,162 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-orbit-db/stores"
+	"berty.tech/go-orbit-db/stores/operation"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// EventSource tells how an event reached the node
+type EventSource string
+
+// Event sources
+const (
+	EventSourceSaved      EventSource = "saved"      // Saved through the adapter
+	EventSourceReplicated EventSource = "replicated" // Replicated from a peer
+)
+
+// EventProcessor processes an event of the kinds it is registered for, like the managers
+// updating causality and user statistics. Errors are logged and don't affect the event or the
+// other processors.
+type EventProcessor func(ctx context.Context, event *nostr.Event, source EventSource) error
+
+// registeredProcessor is an event processor with the kinds it is registered for
+type registeredProcessor struct {
+	name  string
+	kinds []int // Empty for every kind
+	fn    EventProcessor
+}
+
+// matches reports whether the processor is registered for an event's kind
+func (p *registeredProcessor) matches(event *nostr.Event) bool {
+	return len(p.kinds) == 0 || slices.Contains(p.kinds, event.Kind)
+}
+
+// run runs the processor, turning a panic into an error so it can't take the writer or the
+// derived data worker down
+func (p *registeredProcessor) run(ctx context.Context, event *nostr.Event, source EventSource) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("processor %s panicked: %v", p.name, recovered)
+		}
+	}()
+	return p.fn(ctx, event, source)
+}
+
+// RegisterProcessor attaches a processor run on the saved and replicated events of the given
+// kinds, every kind if kinds is empty. Saved events are processed after the built-in derived
+// data updates, with their retries and in the background when they are asynchronous;
+// replicated events once WatchReplicatedEvents is called. Processors run in registration
+// order. Must be called before the adapter is used.
+func (a *OrbitDBAdapter) RegisterProcessor(kinds []int, fn EventProcessor) {
+	a.processors = append(a.processors, &registeredProcessor{
+		name:  fmt.Sprintf("processor %d", len(a.processors)+1),
+		kinds: kinds,
+		fn:    fn,
+	})
+}
+
+// processorSteps returns the derived data steps running the registered processors on a saved event
+func (a *OrbitDBAdapter) processorSteps() []derivedStep {
+	steps := make([]derivedStep, 0, len(a.processors))
+	for _, p := range a.processors {
+		steps = append(steps, derivedStep{p.name, func(ctx context.Context, event *nostr.Event) error {
+			if !p.matches(event) {
+				return nil
+			}
+			return p.run(ctx, event, EventSourceSaved)
+		}})
+	}
+	return steps
+}
+
+// WatchReplicatedEvents runs the registered processors on the events replicated into the
+// database of bus until ctx is done. Built-in derived data replicates with the documents and
+// isn't updated again.
+func (a *OrbitDBAdapter) WatchReplicatedEvents(ctx context.Context, bus event.Bus) error {
+	if len(a.processors) == 0 {
+		return nil
+	}
+
+	sub, err := bus.Subscribe(new(stores.EventReplicated))
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to replicated entries: %w", err)
+	}
+
+	go func() {
+		defer sub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+				for _, replicated := range ReplicatedEvents(evt) {
+					a.processReplicated(ctx, replicated)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// processReplicated runs the registered processors on a replicated event
+func (a *OrbitDBAdapter) processReplicated(ctx context.Context, event *nostr.Event) {
+	for _, p := range a.processors {
+		if !p.matches(event) {
+			continue
+		}
+		if err := p.run(ctx, event, EventSourceReplicated); err != nil {
+			zap.L().Warn("Failed to process replicated event", zap.String("processor", p.name), zap.String("event", event.ID), zap.Error(err))
+		}
+	}
+}
+
+// ReplicatedEvents returns the nostr events written by the entries of a store's replication
+// event, stores.EventReplicated, in entry order
+func ReplicatedEvents(evt interface{}) []*nostr.Event {
+	var entries []ipfslog.Entry
+	switch evt := evt.(type) {
+	case stores.EventReplicated:
+		entries = evt.Entries
+	case *stores.EventReplicated:
+		entries = evt.Entries
+	}
+
+	var events []*nostr.Event
+	for _, entry := range entries {
+		op, err := operation.ParseOperation(entry)
+		if err != nil {
+			continue
+		}
+		var values [][]byte
+		switch op.GetOperation() {
+		case "PUT":
+			values = [][]byte{op.GetValue()}
+		case "PUTALL":
+			for _, doc := range op.GetDocs() {
+				values = append(values, doc.GetValue())
+			}
+		}
+		for _, value := range values {
+			var doc map[string]interface{}
+			if err := json.Unmarshal(value, &doc); err != nil {
+				continue
+			}
+			if event, ok := EventFromDocument(doc); ok {
+				events = append(events, event)
+			}
+		}
+	}
+	return events
+}
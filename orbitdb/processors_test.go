@@ -0,0 +1,51 @@
+package orbitdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that processors run in order on the events of their kinds, isolated from each
+// other's failures
+func TestRegisterProcessor(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("processors"))
+
+	var calls []string
+	adapter.RegisterProcessor(nil, func(ctx context.Context, event *nostr.Event, source EventSource) error {
+		calls = append(calls, "panicking "+event.Content)
+		panic("boom")
+	})
+	adapter.RegisterProcessor([]int{30300}, func(ctx context.Context, event *nostr.Event, source EventSource) error {
+		calls = append(calls, "posts "+event.Content+" "+string(source))
+		return errors.New("unavailable")
+	})
+	adapter.RegisterProcessor([]int{30200, 30300}, func(ctx context.Context, event *nostr.Event, source EventSource) error {
+		// Built-in derived data of saved events is updated first
+		if source == EventSourceSaved {
+			stats, err := adapter.GetUserStats(ctx, event.PubKey)
+			require.NoError(t, err)
+			require.NotNil(t, stats)
+		}
+		calls = append(calls, "members "+event.Content+" "+string(source))
+		return nil
+	})
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000f1"
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "member", &nostr.Event{CreatedAt: 1700000000, Kind: 30200,
+		Tags: nostr.Tags{{"sid", sid}}, Content: "join"})))
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "member", &nostr.Event{CreatedAt: 1700000100, Kind: 30300,
+		Tags: nostr.Tags{{"sid", sid}, {"op", "post"}}, Content: "post"})))
+	adapter.processReplicated(ctx, signAs(t, "peer", &nostr.Event{Kind: 30300, Content: "replica"}))
+
+	assert.Equal(t, []string{
+		"panicking join", "members join saved",
+		"panicking post", "posts post saved", "members post saved",
+		"panicking replica", "posts replica replicated", "members replica replicated",
+	}, calls)
+}
@@ -0,0 +1,395 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeProposal identifies proposal documents
+const DocTypeProposal = "proposal"
+
+// ProposalKind is the kind of proposal-creation events. Events of other kinds with op
+// "propose" are recognized as proposals as well.
+const ProposalKind = 30301
+
+// Proposal statuses
+const (
+	ProposalOpen     = "open"     // Accepting votes
+	ProposalPassed   = "passed"   // Deadline passed with quorum and more yes than no votes
+	ProposalRejected = "rejected" // Deadline passed with quorum and no more yes than no votes
+	ProposalExpired  = "expired"  // Deadline passed without quorum
+)
+
+// Proposal is a governance proposal of a subspace with its vote tallies
+type Proposal struct {
+	ID         string `json:"id"`                  // Document ID, format: proposal:<proposal id>
+	DocType    string `json:"doc_type"`            // Document type, fixed as "proposal"
+	ProposalID string `json:"proposal_id"`         // ID of the proposal event
+	SubspaceID string `json:"subspace_id"`         // Subspace of the proposal
+	Proposer   string `json:"proposer,omitempty"`  // Public key of the proposer, empty until the proposal event is seen
+	Content    string `json:"content,omitempty"`   // Proposal content
+	CreatedAt  int64  `json:"created_at"`          // Proposal event timestamp
+	Quorum     uint64 `json:"quorum,omitempty"`    // Votes needed for the outcome to count, from the quorum tag
+	Deadline   int64  `json:"deadline,omitempty"`  // End of voting, unix seconds from the deadline tag, 0 for none
+	Status     string `json:"status"`              // open|passed|rejected|expired
+	YesVotes   uint64 `json:"yes_votes"`           // Number of yes votes
+	NoVotes    uint64 `json:"no_votes"`            // Number of no votes
+	TotalVotes uint64 `json:"total_votes"`         // Number of votes, including other values
+	ClosedAt   int64  `json:"closed_at,omitempty"` // Deadline the proposal closed at
+	Updated    int64  `json:"updated"`             // Update timestamp
+}
+
+// ProposalManager maintains proposal documents from proposal-creation and vote events
+type ProposalManager struct {
+	db    iface.DocumentStore
+	votes *VoteManager
+}
+
+// NewProposalManager creates a new ProposalManager
+func NewProposalManager(db iface.DocumentStore) *ProposalManager {
+	return &ProposalManager{db: db, votes: NewVoteManager(db)}
+}
+
+// proposalDocID returns the document key of a proposal
+func proposalDocID(proposalID string) string {
+	return DocTypeProposal + ":" + proposalID
+}
+
+// isProposalEvent reports whether an event creates a proposal
+func isProposalEvent(event *nostr.Event) bool {
+	if event.Kind == ProposalKind {
+		return true
+	}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "op" {
+			return tag[1] == "propose"
+		}
+	}
+	return false
+}
+
+// statusAt returns the status of the proposal at a point in time
+func (p *Proposal) statusAt(now int64) string {
+	if p.Deadline == 0 || now < p.Deadline {
+		return ProposalOpen
+	}
+	if p.TotalVotes < p.Quorum {
+		return ProposalExpired
+	}
+	if p.YesVotes > p.NoVotes {
+		return ProposalPassed
+	}
+	return ProposalRejected
+}
+
+// refreshStatus updates the status from the clock, closing proposals whose deadline passed
+func (p *Proposal) refreshStatus(now int64) {
+	p.Status = p.statusAt(now)
+	if p.Status != ProposalOpen {
+		p.ClosedAt = p.Deadline
+	}
+}
+
+// awaitingClose reports whether a stored proposal is open with a deadline. Such proposals
+// stay stored open until CloseDueProposals closes them, so closing is reported once.
+func (p *Proposal) awaitingClose() bool {
+	return p.Status == ProposalOpen && p.Deadline != 0
+}
+
+// UpdateFromEvent updates the proposal a proposal-creation or vote event belongs to.
+// Tallies are counted from the votes recorded by the VoteManager, so replays and repeat
+// votes don't inflate them. Proposals first seen after their deadline are stored closed;
+// open ones are left for CloseDueProposals to close.
+func (pm *ProposalManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	var proposalID string
+	switch {
+	case isProposalEvent(event):
+		proposalID = event.ID
+	default:
+		if proposalID = voteProposal(event); proposalID == "" {
+			return nil
+		}
+		// Recording is idempotent, the vote may already be recorded with the user statistics
+		if _, err := pm.votes.RecordVote(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	proposal, err := pm.getStoredProposal(ctx, proposalID)
+	if err != nil {
+		return err
+	}
+	if proposal == nil {
+		// Votes may replicate before their proposal
+		proposal = &Proposal{
+			ID:         proposalDocID(proposalID),
+			DocType:    DocTypeProposal,
+			ProposalID: proposalID,
+		}
+	}
+	// Checked before the creation event sets the deadline, a proposal stored without one
+	// is closed here if it arrives after its deadline
+	awaiting := proposal.awaitingClose()
+
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" && proposal.SubspaceID == "" {
+			proposal.SubspaceID = tag[1]
+		}
+	}
+
+	if proposalID == event.ID {
+		proposal.Proposer = event.PubKey
+		proposal.Content = event.Content
+		proposal.CreatedAt = int64(event.CreatedAt)
+		for _, tag := range event.Tags {
+			if len(tag) < 2 {
+				continue
+			}
+			switch tag[0] {
+			case "quorum":
+				if quorum, err := strconv.ParseUint(tag[1], 10, 64); err == nil {
+					proposal.Quorum = quorum
+				}
+			case "deadline":
+				if deadline, err := strconv.ParseInt(tag[1], 10, 64); err == nil {
+					proposal.Deadline = deadline
+				}
+			}
+		}
+	}
+
+	if err := pm.tally(ctx, proposal); err != nil {
+		return err
+	}
+	if !awaiting {
+		proposal.refreshStatus(int64(nostr.Now()))
+	}
+	return pm.saveProposal(ctx, proposal)
+}
+
+// Recount re-tallies a proposal after its recorded votes changed, e.g. a vote was deleted
+func (pm *ProposalManager) Recount(ctx context.Context, proposalID string) error {
+	proposal, err := pm.getStoredProposal(ctx, proposalID)
+	if err != nil || proposal == nil {
+		return err
+	}
+
+	awaiting := proposal.awaitingClose()
+	if err := pm.tally(ctx, proposal); err != nil {
+		return err
+	}
+	if !awaiting {
+		proposal.refreshStatus(int64(nostr.Now()))
+	}
+	return pm.saveProposal(ctx, proposal)
+}
+
+// CloseDueProposals closes the proposals stored open whose deadline passed, with their final
+// tallies, and returns them. Each proposal is returned by the call that closes it.
+func (pm *ProposalManager) CloseDueProposals(ctx context.Context) ([]*Proposal, error) {
+	docs, err := queryDocuments(ctx, pm.db, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		docType, _ := docMap["doc_type"].(string)
+		status, _ := docMap["status"].(string)
+		return docType == DocTypeProposal && status == ProposalOpen, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := int64(nostr.Now())
+	var closed []*Proposal
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		proposal, err := docToProposal(docMap)
+		if err != nil {
+			return closed, err
+		}
+		if !proposal.awaitingClose() || now < proposal.Deadline {
+			continue
+		}
+
+		if err := pm.tally(ctx, proposal); err != nil {
+			return closed, err
+		}
+		proposal.refreshStatus(now)
+		if err := pm.saveProposal(ctx, proposal); err != nil {
+			return closed, err
+		}
+		closed = append(closed, proposal)
+	}
+	return closed, nil
+}
+
+// tally counts the recorded votes on a proposal, ignoring votes cast after its deadline
+func (pm *ProposalManager) tally(ctx context.Context, proposal *Proposal) error {
+	votes, err := pm.votes.GetProposalVotes(ctx, proposal.ProposalID)
+	if err != nil {
+		return err
+	}
+
+	proposal.YesVotes, proposal.NoVotes, proposal.TotalVotes = 0, 0, 0
+	if votes == nil {
+		return nil
+	}
+	for _, vote := range votes.Votes {
+		if proposal.Deadline != 0 && vote.Created > proposal.Deadline {
+			continue
+		}
+		proposal.TotalVotes++
+		switch vote.Value {
+		case "yes":
+			proposal.YesVotes++
+		case "no":
+			proposal.NoVotes++
+		}
+	}
+	return nil
+}
+
+// GetProposal retrieves a proposal, nil if it doesn't exist. The status reflects the
+// current time, so proposals read after their deadline are closed.
+func (pm *ProposalManager) GetProposal(ctx context.Context, proposalID string) (*Proposal, error) {
+	proposal, err := pm.getStoredProposal(ctx, proposalID)
+	if err != nil || proposal == nil {
+		return nil, err
+	}
+	proposal.refreshStatus(int64(nostr.Now()))
+	return proposal, nil
+}
+
+// getStoredProposal retrieves a proposal with its status as stored, nil if it doesn't exist
+func (pm *ProposalManager) getStoredProposal(ctx context.Context, proposalID string) (*Proposal, error) {
+	docs, err := pm.db.Get(ctx, proposalDocID(proposalID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeProposal {
+			continue
+		}
+
+		return docToProposal(docMap)
+	}
+
+	return nil, nil
+}
+
+// ListSubspaceProposals retrieves the proposals of a subspace, newest first. A non-empty
+// status only returns proposals with that status.
+func (pm *ProposalManager) ListSubspaceProposals(ctx context.Context, subspaceID, status string) ([]*Proposal, error) {
+	docs, err := queryDocuments(ctx, pm.db, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		docType, _ := docMap["doc_type"].(string)
+		sid, _ := docMap["subspace_id"].(string)
+		return docType == DocTypeProposal && sid == subspaceID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := int64(nostr.Now())
+	proposals := make([]*Proposal, 0, len(docs))
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		proposal, err := docToProposal(docMap)
+		if err != nil {
+			return nil, err
+		}
+		proposal.refreshStatus(now)
+		if status != "" && proposal.Status != status {
+			continue
+		}
+		proposals = append(proposals, proposal)
+	}
+
+	sort.Slice(proposals, func(i, j int) bool {
+		if proposals[i].CreatedAt != proposals[j].CreatedAt {
+			return proposals[i].CreatedAt > proposals[j].CreatedAt
+		}
+		return proposals[i].ProposalID < proposals[j].ProposalID
+	})
+	return proposals, nil
+}
+
+// Helper function: parse a proposal document
+func docToProposal(docMap map[string]interface{}) (*Proposal, error) {
+	// Convert document to JSON and parse into struct
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var proposal Proposal
+	if err := json.Unmarshal(jsonData, &proposal); err != nil {
+		return nil, err
+	}
+	return &proposal, nil
+}
+
+// saveProposal saves a proposal document
+func (pm *ProposalManager) saveProposal(ctx context.Context, proposal *Proposal) error {
+	proposal.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            proposal.ID,
+		"id":             proposal.ID,
+		"doc_type":       DocTypeProposal,
+		"schema_version": schemaVersion(DocTypeProposal),
+		"proposal_id":    proposal.ProposalID,
+		"subspace_id":    proposal.SubspaceID,
+		"proposer":       proposal.Proposer,
+		"content":        proposal.Content,
+		"created_at":     proposal.CreatedAt,
+		"quorum":         proposal.Quorum,
+		"deadline":       proposal.Deadline,
+		"status":         proposal.Status,
+		"yes_votes":      proposal.YesVotes,
+		"no_votes":       proposal.NoVotes,
+		"total_votes":    proposal.TotalVotes,
+		"closed_at":      proposal.ClosedAt,
+		"updated":        proposal.Updated,
+	}
+
+	_, err := pm.db.Put(ctx, doc)
+	return err
+}
+
+// GetProposal retrieves a proposal with its tallies
+func (a *OrbitDBAdapter) GetProposal(ctx context.Context, proposalID string) (*Proposal, error) {
+	return a.proposalMgr.GetProposal(ctx, proposalID)
+}
+
+// ListSubspaceProposals retrieves the proposals of a subspace, newest first
+func (a *OrbitDBAdapter) ListSubspaceProposals(ctx context.Context, subspaceID, status string) ([]*Proposal, error) {
+	return a.proposalMgr.ListSubspaceProposals(ctx, subspaceID, status)
+}
+
+// CloseDueProposals closes the open proposals whose deadline passed and returns them
+func (a *OrbitDBAdapter) CloseDueProposals(ctx context.Context) ([]*Proposal, error) {
+	return a.proposalMgr.CloseDueProposals(ctx)
+}
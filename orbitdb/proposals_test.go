@@ -0,0 +1,86 @@
+package orbitdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that proposals are tallied from votes, including votes replicated before the proposal
+func TestProposalLifecycle(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("proposals"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000c1"
+	vote := func(voter string, proposal *nostr.Event, value string, createdAt nostr.Timestamp) *nostr.Event {
+		return signAs(t, voter, &nostr.Event{Kind: 30302, CreatedAt: createdAt,
+			Tags: nostr.Tags{{"sid", sid}, {"op", "vote"}, {"proposal_id", proposal.ID}, {"vote", value}}})
+	}
+	propose := func(content string, createdAt, deadline nostr.Timestamp, quorum int) *nostr.Event {
+		return signAs(t, "proposer", &nostr.Event{Kind: ProposalKind, CreatedAt: createdAt, Content: content,
+			Tags: nostr.Tags{{"sid", sid}, {"op", "propose"}, {"quorum", strconv.Itoa(quorum)}, {"deadline", strconv.FormatInt(int64(deadline), 10)}}})
+	}
+
+	// A vote replicated ahead of its proposal is counted once the proposal arrives
+	closedProposal := propose("closed", 900, 2000, 2)
+	require.NoError(t, adapter.SaveEvent(ctx, vote("alice", closedProposal, "yes", 1000)))
+	require.NoError(t, adapter.SaveEvent(ctx, closedProposal))
+	require.NoError(t, adapter.SaveEvent(ctx, vote("bob", closedProposal, "no", 1500)))
+	require.NoError(t, adapter.SaveEvent(ctx, vote("carol", closedProposal, "yes", 2500)))
+
+	closed, err := adapter.GetProposal(ctx, closedProposal.ID)
+	require.NoError(t, err)
+	require.NotNil(t, closed)
+	assert.Equal(t, testPubKey("proposer"), closed.Proposer)
+	assert.Equal(t, uint64(2), closed.TotalVotes, "votes after the deadline are not counted")
+	assert.Equal(t, uint64(1), closed.YesVotes)
+	assert.Equal(t, uint64(1), closed.NoVotes)
+	assert.Equal(t, ProposalRejected, closed.Status)
+	assert.Equal(t, int64(2000), closed.ClosedAt)
+
+	open := nostr.Now() + 3600
+	openProposal := propose("open", open-7200, open, 1)
+	openVote := vote("alice", openProposal, "yes", open-3600)
+	require.NoError(t, adapter.SaveEvent(ctx, openProposal))
+	require.NoError(t, adapter.SaveEvent(ctx, openVote))
+
+	proposals, err := adapter.ListSubspaceProposals(ctx, sid, "")
+	require.NoError(t, err)
+	require.Len(t, proposals, 2)
+	assert.Equal(t, openProposal.ID, proposals[0].ProposalID)
+	assert.Equal(t, ProposalOpen, proposals[0].Status)
+	assert.Equal(t, uint64(1), proposals[0].YesVotes)
+
+	proposals, err = adapter.ListSubspaceProposals(ctx, sid, ProposalRejected)
+	require.NoError(t, err)
+	require.Len(t, proposals, 1)
+	assert.Equal(t, closedProposal.ID, proposals[0].ProposalID)
+
+	// Deleting a vote removes it from the tally
+	require.NoError(t, adapter.DeleteEvent(ctx, openVote))
+	proposal, err := adapter.GetProposal(ctx, openProposal.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), proposal.TotalVotes)
+
+	// Proposals stored open are closed once their deadline passed, by a single call
+	proposal, err = adapter.proposalMgr.getStoredProposal(ctx, openProposal.ID)
+	require.NoError(t, err)
+	proposal.Deadline = int64(nostr.Now()) - 1
+	require.NoError(t, adapter.proposalMgr.saveProposal(ctx, proposal))
+	require.NoError(t, adapter.SaveEvent(ctx, vote("bob", openProposal, "yes", nostr.Now()+10)))
+
+	due, err := adapter.CloseDueProposals(ctx)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, openProposal.ID, due[0].ProposalID)
+	assert.Equal(t, ProposalExpired, due[0].Status, "the vote after the deadline doesn't count towards the quorum")
+	assert.Equal(t, proposal.Deadline, due[0].ClosedAt)
+
+	due, err = adapter.CloseDueProposals(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
@@ -0,0 +1,263 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeQuarantinedEvent identifies causally stale events held for inspection
+const DocTypeQuarantinedEvent = "quarantined_event"
+
+// Handling of causally stale events, see EnableStaleEventCheck
+const (
+	StaleEventsAccept     = "accept"     // Save stale events like any other
+	StaleEventsReject     = "reject"     // Refuse stale events
+	StaleEventsQuarantine = "quarantine" // Hold stale events in quarantine documents instead of saving them
+)
+
+// StaleKey is a causality key an event carries a counter for that is behind the subspace
+type StaleKey struct {
+	Key     uint32 `json:"key"`     // Causality key ID
+	Counter uint64 `json:"counter"` // Counter carried by the event
+	Current uint64 `json:"current"` // Current counter of the subspace
+}
+
+// StaleEventError is returned by SaveEvent for events whose counters are behind the
+// subspace's current Lamport counters
+type StaleEventError struct {
+	EventID     string      `json:"event_id"`    // Stale event ID
+	SubspaceID  string      `json:"subspace_id"` // Subspace of the event
+	Keys        []*StaleKey `json:"keys"`        // Keys the event is behind on
+	Quarantined bool        `json:"quarantined"` // Whether the event was quarantined instead of rejected
+}
+
+func (e *StaleEventError) Error() string {
+	keys := make([]string, 0, len(e.Keys))
+	for _, key := range e.Keys {
+		keys = append(keys, fmt.Sprintf("%d: %d < %d", key.Key, key.Counter, key.Current))
+	}
+	return fmt.Sprintf("event %s is causally stale in subspace %s (%s)", e.EventID, e.SubspaceID, strings.Join(keys, ", "))
+}
+
+// QuarantinedEvent is a causally stale event held for inspection
+type QuarantinedEvent struct {
+	ID          string       `json:"id"`          // Document ID, format: quarantine:<event id>
+	DocType     string       `json:"doc_type"`    // Document type, fixed as "quarantined_event"
+	SubspaceID  string       `json:"subspace_id"` // Subspace of the event
+	Event       *nostr.Event `json:"event"`       // The event as received
+	Keys        []*StaleKey  `json:"keys"`        // Keys the event was behind on
+	Quarantined int64        `json:"quarantined"` // Quarantine timestamp
+}
+
+// QuarantineManager manages quarantined event documents
+type QuarantineManager struct {
+	db iface.DocumentStore
+}
+
+// NewQuarantineManager creates a new QuarantineManager
+func NewQuarantineManager(db iface.DocumentStore) *QuarantineManager {
+	return &QuarantineManager{db: db}
+}
+
+// quarantineDocID returns the document key of a quarantined event, keeping it apart from saved events
+func quarantineDocID(eventID string) string {
+	return "quarantine:" + eventID
+}
+
+// parseCounterTags extracts the counters an event claims per causality key.
+// Tag formats: ["causal", "<key id>", "<counter>"] for any key, and ["counter", "<counter>"]
+// for the key the op tag resolves to.
+func parseCounterTags(event *nostr.Event) (map[uint32]uint64, uint64, bool) {
+	causal := make(map[uint32]uint64)
+	var (
+		opCounter  uint64
+		hasCounter bool
+	)
+	for _, tag := range event.Tags {
+		switch {
+		case len(tag) >= 3 && tag[0] == "causal":
+			key, err := strconv.ParseUint(tag[1], 10, 32)
+			if err != nil {
+				continue
+			}
+			counter, err := strconv.ParseUint(tag[2], 10, 64)
+			if err != nil {
+				continue
+			}
+			causal[uint32(key)] = counter
+		case len(tag) >= 2 && tag[0] == "counter":
+			counter, err := strconv.ParseUint(tag[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			opCounter, hasCounter = counter, true
+		}
+	}
+	return causal, opCounter, hasCounter
+}
+
+// CheckStaleness compares the counters an event carries with the current counters of its
+// subspace. Returns nil if the event carries no counters or none of them is behind.
+func (cm *CausalityManager) CheckStaleness(ctx context.Context, event *nostr.Event) (*StaleEventError, error) {
+	causal, opCounter, hasCounter := parseCounterTags(event)
+	if len(causal) == 0 && !hasCounter {
+		return nil, nil
+	}
+
+	var subspaceID string
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" {
+			subspaceID = tag[1]
+			break
+		}
+	}
+	if subspaceID == "" || !IsValidSubspaceID(subspaceID) {
+		return nil, nil
+	}
+
+	causality, err := cm.GetSubspaceCausality(ctx, subspaceID)
+	if err != nil || causality == nil {
+		return nil, err
+	}
+
+	if hasCounter {
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "op" {
+				if keyID, ok := causality.resolveOp(tag[1], event.Kind); ok {
+					if _, explicit := causal[keyID]; !explicit {
+						causal[keyID] = opCounter
+					}
+				}
+				break
+			}
+		}
+	}
+
+	stale := &StaleEventError{EventID: event.ID, SubspaceID: subspaceID}
+	for keyID, counter := range causal {
+		current, exists := causality.Keys[keyID]
+		if exists && counter < current {
+			stale.Keys = append(stale.Keys, &StaleKey{Key: keyID, Counter: counter, Current: current})
+		}
+	}
+	if len(stale.Keys) == 0 {
+		return nil, nil
+	}
+	sort.Slice(stale.Keys, func(i, j int) bool { return stale.Keys[i].Key < stale.Keys[j].Key })
+	return stale, nil
+}
+
+// QuarantineEvent holds a stale event for inspection
+func (qm *QuarantineManager) QuarantineEvent(ctx context.Context, event *nostr.Event, stale *StaleEventError) error {
+	doc := map[string]interface{}{
+		"_id":            quarantineDocID(event.ID),
+		"id":             quarantineDocID(event.ID),
+		"doc_type":       DocTypeQuarantinedEvent,
+		"schema_version": schemaVersion(DocTypeQuarantinedEvent),
+		"subspace_id":    stale.SubspaceID,
+		"event":          event,
+		"keys":           stale.Keys,
+		"quarantined":    int64(nostr.Now()),
+	}
+
+	_, err := qm.db.Put(ctx, doc)
+	return err
+}
+
+// ListQuarantinedEvents retrieves all quarantined events, oldest first
+func (qm *QuarantineManager) ListQuarantinedEvents(ctx context.Context) ([]*QuarantinedEvent, error) {
+	docs, err := queryDocuments(ctx, qm.db, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		docType, ok := docMap["doc_type"].(string)
+		return ok && docType == DocTypeQuarantinedEvent, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*QuarantinedEvent, 0, len(docs))
+	for _, doc := range docs {
+		// Convert document to JSON and parse into struct
+		jsonData, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		var quarantined QuarantinedEvent
+		if err := json.Unmarshal(jsonData, &quarantined); err != nil {
+			return nil, err
+		}
+		events = append(events, &quarantined)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Quarantined != events[j].Quarantined {
+			return events[i].Quarantined < events[j].Quarantined
+		}
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+// DeleteQuarantinedEvent discards a quarantined event. Returns false if it doesn't exist.
+func (qm *QuarantineManager) DeleteQuarantinedEvent(ctx context.Context, eventID string) (bool, error) {
+	docs, err := qm.db.Get(ctx, quarantineDocID(eventID), nil)
+	if err != nil || len(docs) == 0 {
+		return false, err
+	}
+
+	_, err = qm.db.Delete(ctx, quarantineDocID(eventID))
+	return err == nil, err
+}
+
+// EnableStaleEventCheck makes saves, replacements, imports and backfills check the counters
+// carried by events against their subspace, rejecting or quarantining stale events depending
+// on mode. The check runs after the access rules, so events the subspace refuses are never
+// quarantined. Replicated events are not checked. Must be called before the adapter is shared.
+func (a *OrbitDBAdapter) EnableStaleEventCheck(mode string) {
+	if mode == StaleEventsAccept {
+		mode = ""
+	}
+	a.staleEvents = mode
+}
+
+// checkStaleness returns a *StaleEventError for stale events unless they are accepted,
+// quarantining them first in quarantine mode
+func (a *OrbitDBAdapter) checkStaleness(ctx context.Context, event *nostr.Event) error {
+	if a.staleEvents == "" {
+		return nil
+	}
+
+	stale, err := a.causalityMgr.CheckStaleness(ctx, event)
+	if err != nil || stale == nil {
+		return err
+	}
+
+	if a.staleEvents == StaleEventsQuarantine {
+		if err := a.quarantineMgr.QuarantineEvent(ctx, event, stale); err != nil {
+			return fmt.Errorf("failed to quarantine event %s: %w", event.ID, err)
+		}
+		stale.Quarantined = true
+	}
+	return stale
+}
+
+// ListQuarantinedEvents retrieves all quarantined events, oldest first
+func (a *OrbitDBAdapter) ListQuarantinedEvents(ctx context.Context) ([]*QuarantinedEvent, error) {
+	return a.quarantineMgr.ListQuarantinedEvents(ctx)
+}
+
+// DeleteQuarantinedEvent discards a quarantined event
+func (a *OrbitDBAdapter) DeleteQuarantinedEvent(ctx context.Context, eventID string) (bool, error) {
+	return a.quarantineMgr.DeleteQuarantinedEvent(ctx, eventID)
+}
@@ -0,0 +1,117 @@
+package orbitdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staleFixtures creates a subspace whose post key is at counter 2
+func staleFixtures(t *testing.T, adapter *OrbitDBAdapter) string {
+	subspaceID := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+	ctx := context.Background()
+	events := []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{Kind: 30100, Tags: nostr.Tags{{"sid", subspaceID}, {"ops", "post=1,vote=2"}}}),
+		signAs(t, "alice", &nostr.Event{Kind: 30300, Tags: nostr.Tags{{"sid", subspaceID}, {"op", "post"}, {"counter", "1"}}}),
+		signAs(t, "alice", &nostr.Event{Kind: 30300, Tags: nostr.Tags{{"sid", subspaceID}, {"op", "post"}, {"causal", "1", "1"}}}),
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+	return subspaceID
+}
+
+// Test that stale events are rejected without being saved
+func TestSaveEventRejectsStaleEvents(t *testing.T) {
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("stale"))
+	adapter.EnableStaleEventCheck(StaleEventsReject)
+	ctx := context.Background()
+	subspaceID := staleFixtures(t, adapter)
+
+	stale := signAs(t, "bob", &nostr.Event{Kind: 30300, Tags: nostr.Tags{{"sid", subspaceID}, {"op", "post"}, {"counter", "1"}}})
+	err := adapter.SaveEvent(ctx, stale)
+	var staleErr *StaleEventError
+	require.True(t, errors.As(err, &staleErr))
+	assert.False(t, staleErr.Quarantined)
+	assert.Equal(t, []*StaleKey{{Key: 1, Counter: 1, Current: 2}}, staleErr.Keys)
+
+	saved, err := adapter.GetEventByID(ctx, stale.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, saved)
+
+	// Counters that are current, and keys the event has no counter for, are accepted
+	current := signAs(t, "bob", &nostr.Event{Kind: 30302, Tags: nostr.Tags{{"sid", subspaceID}, {"op", "vote"}, {"causal", "1", "2"}}})
+	assert.NoError(t, adapter.SaveEvent(ctx, current))
+}
+
+// Test that replacing an event applies the same staleness check as saving it
+func TestReplaceEventRejectsStaleEvents(t *testing.T) {
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("stale-replace"))
+	adapter.EnableStaleEventCheck(StaleEventsReject)
+	ctx := context.Background()
+	subspaceID := staleFixtures(t, adapter)
+
+	stale := signAs(t, "alice", &nostr.Event{Kind: 30300, Content: "edited", Tags: nostr.Tags{{"sid", subspaceID}, {"op", "post"}, {"counter", "1"}}})
+	var staleErr *StaleEventError
+	require.True(t, errors.As(adapter.ReplaceEvent(ctx, stale), &staleErr))
+	assert.Equal(t, []*StaleKey{{Key: 1, Counter: 1, Current: 2}}, staleErr.Keys)
+
+	saved, err := adapter.GetEventByID(ctx, stale.ID)
+	require.NoError(t, err)
+	assert.Nil(t, saved, "the stale replacement is not written")
+
+	current := signAs(t, "alice", &nostr.Event{Kind: 30300, Content: "edited", Tags: nostr.Tags{{"sid", subspaceID}, {"op", "post"}, {"causal", "1", "2"}}})
+	assert.NoError(t, adapter.ReplaceEvent(ctx, current))
+}
+
+// Test that stale events are held in quarantine in quarantine mode
+func TestSaveEventQuarantinesStaleEvents(t *testing.T) {
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("quarantine"))
+	adapter.EnableStaleEventCheck(StaleEventsQuarantine)
+	ctx := context.Background()
+	subspaceID := staleFixtures(t, adapter)
+
+	stale := signAs(t, "bob", &nostr.Event{Kind: 30300, Tags: nostr.Tags{{"sid", subspaceID}, {"causal", "1", "0"}}})
+	err := adapter.SaveEvent(ctx, stale)
+	var staleErr *StaleEventError
+	require.True(t, errors.As(err, &staleErr))
+	assert.True(t, staleErr.Quarantined)
+
+	quarantined, err := adapter.ListQuarantinedEvents(ctx)
+	assert.NoError(t, err)
+	require.Len(t, quarantined, 1)
+	assert.Equal(t, stale.ID, quarantined[0].Event.ID)
+	assert.Equal(t, subspaceID, quarantined[0].SubspaceID)
+
+	deleted, err := adapter.DeleteQuarantinedEvent(ctx, stale.ID)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	quarantined, err = adapter.ListQuarantinedEvents(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, quarantined)
+}
+
+// Test that events refused by the subspace are rejected before the staleness check, not
+// quarantined
+func TestStaleEventCheckAfterAccess(t *testing.T) {
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("quarantine-access"))
+	adapter.EnableStaleEventCheck(StaleEventsQuarantine)
+	ctx := context.Background()
+	subspaceID := staleFixtures(t, adapter)
+	require.NoError(t, adapter.BanFromSubspace(ctx, subspaceID, testPubKey("mallory"), ModerationEntry{By: testPubKey("alice"), At: 1700000000}))
+
+	stale := func(content string) *nostr.Event {
+		return signAs(t, "mallory", &nostr.Event{Kind: 30300, Content: content, Tags: nostr.Tags{{"sid", subspaceID}, {"causal", "1", "0"}}})
+	}
+	assert.ErrorIs(t, adapter.SaveEvent(ctx, stale("save")), ErrWriteForbidden)
+	assert.ErrorIs(t, adapter.ReplaceEvent(ctx, stale("replace")), ErrWriteForbidden)
+	assert.ErrorIs(t, adapter.SaveEvents(ctx, []*nostr.Event{stale("batch")}), ErrWriteForbidden)
+
+	quarantined, err := adapter.ListQuarantinedEvents(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, quarantined)
+}
@@ -0,0 +1,116 @@
+package orbitdb
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+)
+
+// ScanReport records whether the event scans of a request were cut short by the query
+// timeout and returned partial results, and whether a streamed query failed after it
+// started. Attach one to the request context with WithScanReport.
+type ScanReport struct {
+	truncated atomic.Bool
+	err       atomic.Pointer[error]
+}
+
+// Truncated reports whether a scan returned partial results
+func (r *ScanReport) Truncated() bool {
+	return r.truncated.Load()
+}
+
+// Err returns the error that ended a streamed query before all its results were sent,
+// nil if none did. Queries ended by the cancellation of their context are not reported.
+func (r *ScanReport) Err() error {
+	if err := r.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// reportScanError records the error that ended a streamed query on the ScanReport of ctx
+func reportScanError(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	if report, ok := ctx.Value(scanReportKey{}).(*ScanReport); ok {
+		report.err.CompareAndSwap(nil, &err)
+	}
+}
+
+// scanReportKey is the context key of the ScanReport of a request
+type scanReportKey struct{}
+
+// partialScanKey is the context key marking scans that may return partial results
+type partialScanKey struct{}
+
+// WithScanReport returns a context carrying a new ScanReport. Event scans of an adapter with
+// partial results enabled return the events matched before the query timeout instead of
+// failing, if their context carries a report to flag it in.
+func WithScanReport(ctx context.Context) (context.Context, *ScanReport) {
+	report := &ScanReport{}
+	return context.WithValue(ctx, scanReportKey{}, report), report
+}
+
+// SetQueryTimeout bounds every event scan and subspace user scan by timeout, 0 for no bound
+// besides the caller's context. Scans over the timeout fail with context.DeadlineExceeded,
+// or with partial set return what they matched so far when the caller attached a ScanReport.
+// Must be called before the adapter is shared.
+func (a *OrbitDBAdapter) SetQueryTimeout(timeout time.Duration, partial bool) {
+	a.queryTimeout = timeout
+	a.partialResults = partial
+}
+
+// scanContext bounds ctx by the query timeout for a scan. With partial set, the scan may
+// return partial results if partial results are enabled.
+func (a *OrbitDBAdapter) scanContext(ctx context.Context, partial bool) (context.Context, context.CancelFunc) {
+	if partial && a.partialResults {
+		if report, ok := ctx.Value(scanReportKey{}).(*ScanReport); ok {
+			ctx = context.WithValue(ctx, partialScanKey{}, report)
+		}
+	}
+	if a.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, a.queryTimeout)
+}
+
+// errScanTruncated stops a scan that returns partial results
+var errScanTruncated = errors.New("scan truncated")
+
+// queryDocuments runs a document query that stops once ctx is done: the stores call the
+// filter for every document without checking ctx themselves. A scan over its deadline
+// returns the documents matched so far if its context allows partial results, and fails
+// with the context error otherwise.
+func queryDocuments(ctx context.Context, db iface.DocumentStore, filter func(doc interface{}) (bool, error)) ([]interface{}, error) {
+	var matched []interface{}
+	docs, err := db.Query(ctx, func(doc interface{}) (bool, error) {
+		if ctx.Err() != nil {
+			return false, scanStopped(ctx)
+		}
+		ok, err := filter(doc)
+		if ok {
+			matched = append(matched, doc)
+		}
+		return ok, err
+	})
+	if errors.Is(err, errScanTruncated) {
+		return matched, nil
+	}
+	return docs, err
+}
+
+// scanStopped returns the error stopping a queryDocuments filter once ctx is done:
+// errScanTruncated after flagging the report if the scan may return partial results, the
+// context error otherwise
+func scanStopped(ctx context.Context) error {
+	err := ctx.Err()
+	if report, ok := ctx.Value(partialScanKey{}).(*ScanReport); ok && errors.Is(err, context.DeadlineExceeded) {
+		report.truncated.Store(true)
+		return errScanTruncated
+	}
+	return err
+}
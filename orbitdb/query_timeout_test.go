@@ -0,0 +1,60 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that scans stop at their deadline, failing or returning partial results
+func TestQueryTimeout(t *testing.T) {
+	db := NewMemoryDocumentStore("query-timeout")
+	adapter := NewOrbitDBAdapter(db)
+	for _, content := range []string{"a", "b", "c"} {
+		require.NoError(t, adapter.SaveEvent(context.Background(), signAs(t, "alice", &nostr.Event{Content: content, CreatedAt: 1700000000, Kind: 1})))
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err := adapter.CountEvents(expired, nostr.Filter{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Partial results need both the adapter setting and a report to flag them in
+	adapter.SetQueryTimeout(time.Minute, true)
+	_, err = adapter.CountEvents(expired, nostr.Filter{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	ctx, scan := WithScanReport(expired)
+	count, err := adapter.CountEvents(ctx, nostr.Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.True(t, scan.Truncated())
+
+	// Subspace user pages are never partial
+	_, _, err = adapter.QueryUsersBySubspace(ctx, "0x00", SubspaceUserQuery{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Cancelled scans fail whatever the setting
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	ctx, scan = WithScanReport(cancelled)
+	_, err = adapter.CountEvents(ctx, nostr.Filter{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, scan.Truncated())
+
+	// A scan over the deadline keeps the documents matched in time
+	ctx, scan = WithScanReport(context.Background())
+	ctx, cancel = context.WithTimeout(context.WithValue(ctx, partialScanKey{}, scan), 50*time.Millisecond)
+	defer cancel()
+	docs, err := queryDocuments(ctx, db, func(doc interface{}) (bool, error) {
+		time.Sleep(100 * time.Millisecond)
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, docs, 1)
+	assert.True(t, scan.Truncated())
+}
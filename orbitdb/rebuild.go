@@ -0,0 +1,161 @@
+package orbitdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// RebuildResult summarizes a rebuild of derived data
+type RebuildResult struct {
+	Events       int    `json:"events"`               // Events replayed
+	Deleted      int    `json:"deleted"`              // Derived documents removed before the replay
+	Failures     int    `json:"failures"`             // Events whose derived data failed to update
+	LastError    string `json:"last_error,omitempty"` // Last update error
+	DurationMsec int64  `json:"duration_ms"`          // Duration of the rebuild
+}
+
+// RebuildDerivedData regenerates the user_stats, causality, causality_events, leaderboard,
+// proposal, subspace_meta, subspace_activity, activity_histogram and processed_event documents
+// from scratch by removing them, along with any causality counters kept outside the documents,
+// and replaying every nostr_event document in chronological order.
+// Events saved while the rebuild runs may be counted twice, so writes should be paused.
+func (a *OrbitDBAdapter) RebuildDerivedData(ctx context.Context) (*RebuildResult, error) {
+	start := time.Now()
+	result := &RebuildResult{}
+	defer a.cache.clear()
+
+	// Queued updates would land on top of the rebuilt documents
+	if err := a.FlushDerivedData(ctx); err != nil {
+		return nil, err
+	}
+
+	var (
+		events  []*nostr.Event
+		derived []string
+	)
+	queryFn := func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+
+		switch docMap["doc_type"] {
+		case DocTypeNostrEvent:
+			events = append(events, docToEvent(docMap))
+		case DocTypeCausality, DocTypeCausalityEvents, "user_stats", DocTypeLeaderboard, DocTypeProposalVotes, DocTypeProposal, DocTypeSubspaceMeta, DocTypeSubspaceActivity,
+			DocTypeUserProfile, DocTypeFollowList, DocTypeFollowers, DocTypeMuteList, DocTypeSubspaceStats, DocTypeUserDailyStats,
+			DocTypeActivityHistogram, DocTypeProcessedEvent:
+			if key, ok := docMap["_id"].(string); ok {
+				derived = append(derived, key)
+			}
+		}
+		return false, nil
+	}
+
+	// Scan without collecting documents
+	if _, err := queryDocuments(ctx, a.db, queryFn); err != nil {
+		return nil, err
+	}
+
+	for _, key := range derived {
+		if _, err := a.db.Delete(ctx, key); err != nil {
+			return result, fmt.Errorf("failed to delete derived document %s: %w", key, err)
+		}
+		result.Deleted++
+	}
+	if counters := a.causalityMgr.counters; counters != nil {
+		if err := counters.Clear(ctx); err != nil {
+			return result, err
+		}
+	}
+	a.causalityMgr.processed.Reset()
+	a.userStatsMgr.processed.Reset()
+	a.subspaceStatsMgr.processed.Reset()
+
+	// Replay in the order the events were created, ties broken by ID for a stable result
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].CreatedAt != events[j].CreatedAt {
+			return events[i].CreatedAt < events[j].CreatedAt
+		}
+		return events[i].ID < events[j].ID
+	})
+
+	for _, event := range events {
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		default:
+		}
+
+		failed := false
+		if err := a.causalityMgr.UpdateFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild causality", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if err := a.userStatsMgr.UpdateUserStatsFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild user statistics", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if err := a.leaderboardMgr.UpdateFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild leaderboards", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if err := a.proposalMgr.UpdateFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild proposals", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if err := a.subspaceMetaMgr.UpdateFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild subspace metadata", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if err := a.userProfileMgr.UpdateFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild user profiles", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if err := a.followGraphMgr.UpdateFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild follow graph", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if err := a.muteListMgr.UpdateFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild mute lists", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if err := a.subspaceActivityMgr.UpdateFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild subspace activity", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if err := a.subspaceStatsMgr.UpdateFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild subspace statistics", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if err := a.activityHistogramMgr.UpdateFromEvent(ctx, event); err != nil {
+			zap.L().Warn("Failed to rebuild activity histograms", zap.String("event", event.ID), zap.Error(err))
+			result.LastError = err.Error()
+			failed = true
+		}
+		if failed {
+			result.Failures++
+		}
+		result.Events++
+	}
+
+	result.DurationMsec = time.Since(start).Milliseconds()
+	zap.L().Info("Rebuilt derived data", zap.Int("events", result.Events), zap.Int("deleted", result.Deleted),
+		zap.Int("failures", result.Failures))
+	return result, nil
+}
@@ -0,0 +1,194 @@
+package orbitdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that a rebuild replaces corrupted derived data with data replayed from the events
+func TestRebuildDerivedData(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDocumentStore("rebuild")
+	adapter := NewOrbitDBAdapter(db)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000b2"
+	// Saved out of order; the rebuild replays them by created_at
+	events := []*nostr.Event{
+		signAs(t, "member", &nostr.Event{CreatedAt: 1700000200, Kind: 30302,
+			Tags: nostr.Tags{{"sid", sid}, {"op", "vote"}, {"vote", "yes"}}}),
+		signAs(t, "creator", &nostr.Event{CreatedAt: 1700000000, Kind: 30100,
+			Tags: nostr.Tags{{"sid", sid}, {"ops", "vote=30302"}}}),
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+
+	// Corrupt the derived data
+	member := testPubKey("member")
+	_, err := db.Put(ctx, map[string]interface{}{
+		"_id":         member,
+		"id":          member,
+		"doc_type":    "user_stats",
+		"total_stats": map[string]interface{}{"30302": 42},
+	})
+	require.NoError(t, err)
+	_, err = db.Put(ctx, map[string]interface{}{
+		"_id":         "0x00000000000000000000000000000000000000000000000000000000000000c3",
+		"doc_type":    DocTypeCausality,
+		"subspace_id": "0x00000000000000000000000000000000000000000000000000000000000000c3",
+	})
+	require.NoError(t, err)
+
+	result, err := adapter.RebuildDerivedData(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Events)
+	// causality x2, causality_events, user_stats x2, leaderboard x2, subspace_meta, subspace_stats,
+	// user_daily_stats x2, activity_histogram x3 and processed_event x6; the events are too old
+	// for subspace_activity
+	assert.Equal(t, 20, result.Deleted)
+	assert.Equal(t, 0, result.Failures)
+
+	stats, err := adapter.GetUserStats(ctx, member)
+	require.NoError(t, err)
+	require.NotNil(t, stats)
+	assert.Equal(t, uint64(1), stats.TotalStats[30302])
+
+	// The vote is replayed after the creation event, so its key is counted
+	counter, err := adapter.GetCausalityKey(ctx, sid, 30302)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), counter)
+
+	// Causality of subspaces without events is gone
+	orphan, err := adapter.GetSubspaceCausality(ctx, "0x00000000000000000000000000000000000000000000000000000000000000c3")
+	require.NoError(t, err)
+	assert.Nil(t, orphan)
+}
+
+// Test that derived data updated on the background queue is complete once flushed
+func TestAsyncDerivedData(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("async-derived"))
+	adapter.EnableAsyncDerivedData(DerivedDataOptions{QueueSize: 16, MaxRetries: 1})
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000b3"
+	events := []*nostr.Event{
+		signAs(t, "creator", &nostr.Event{CreatedAt: 1700000000, Kind: 30100,
+			Tags: nostr.Tags{{"sid", sid}, {"ops", "vote=30302"}}}),
+		signAs(t, "member", &nostr.Event{CreatedAt: 1700000200, Kind: 30302,
+			Tags: nostr.Tags{{"sid", sid}, {"op", "vote"}, {"vote", "yes"}}}),
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+	require.NoError(t, adapter.FlushDerivedData(ctx))
+
+	stats := adapter.DerivedDataStats()
+	assert.True(t, stats.Async)
+	assert.Equal(t, int64(0), stats.Pending)
+	assert.Equal(t, uint64(2), stats.Processed)
+	assert.Equal(t, uint64(0), stats.Failed)
+
+	userStats, err := adapter.GetUserStats(ctx, testPubKey("member"))
+	require.NoError(t, err)
+	require.NotNil(t, userStats)
+	assert.Equal(t, uint64(1), userStats.TotalStats[30302])
+}
+
+// Test that a full derived data queue holds writes back instead of updating beside the worker
+func TestAsyncDerivedDataFullQueue(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("full-queue"))
+	// No worker drains this queue
+	adapter.derived = newDerivedQueue(DerivedDataOptions{QueueSize: 1})
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 1})))
+
+	timeout, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	second := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000100, Kind: 1})
+	err := adapter.SaveEvent(timeout, second)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	stored, err := adapter.GetEventByID(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Nil(t, stored, "a refused write stores nothing")
+	userStats, err := adapter.GetUserStats(ctx, testPubKey("alice"))
+	require.NoError(t, err)
+	assert.Nil(t, userStats, "updates wait for the worker")
+
+	stats := adapter.DerivedDataStats()
+	assert.Equal(t, int64(1), stats.Pending)
+	assert.Equal(t, uint64(1), stats.Waited)
+}
+
+// Test that writes are checked against the access data of the writes before them while the
+// other derived data waits in the queue
+func TestAsyncDerivedDataAccessSteps(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("async-access"))
+	// No worker drains this queue
+	adapter.derived = newDerivedQueue(DerivedDataOptions{QueueSize: 16})
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000b4"
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30100,
+		Tags: nostr.Tags{{"sid", sid}, {"access", SubspaceAccessInviteOnly}}})))
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "alice", &nostr.Event{CreatedAt: 1700000100, Kind: 30303,
+		Tags: nostr.Tags{{"sid", sid}, {"p", testPubKey("bob")}}})))
+
+	post := signAs(t, "mallory", &nostr.Event{CreatedAt: 1700000200, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}})
+	assert.ErrorIs(t, adapter.SaveEvent(ctx, post), ErrWriteForbidden)
+
+	vote := signAs(t, "bob", &nostr.Event{CreatedAt: 1700000300, Kind: 30302, Tags: nostr.Tags{{"sid", sid}, {"proposal_id", "p"}, {"vote", "yes"}}})
+	revote := signAs(t, "bob", &nostr.Event{CreatedAt: 1700000400, Kind: 30302, Tags: nostr.Tags{{"sid", sid}, {"proposal_id", "p"}, {"vote", "no"}}})
+	require.NoError(t, adapter.SaveEvent(ctx, vote))
+	assert.ErrorIs(t, adapter.SaveEvent(ctx, revote), ErrDuplicateVote)
+
+	userStats, err := adapter.GetUserStats(ctx, testPubKey("bob"))
+	require.NoError(t, err)
+	assert.Nil(t, userStats, "the other updates wait for the worker")
+	assert.Equal(t, int64(3), adapter.DerivedDataStats().Pending)
+
+	// The worker counts the vote recorded with the access steps
+	go adapter.runDerivedQueue(adapter.derived)
+	require.NoError(t, adapter.FlushDerivedData(ctx))
+	adapter.CloseDerivedData()
+	userStats, err = adapter.GetUserStats(ctx, testPubKey("bob"))
+	require.NoError(t, err)
+	require.NotNil(t, userStats)
+	assert.Equal(t, uint64(1), userStats.TotalStats[30302])
+}
+
+// Test that closing the derived data queue stops the worker in the middle of its retries
+func TestCloseDerivedData(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("close-derived"))
+	started := make(chan struct{}, 1)
+	adapter.RegisterProcessor(nil, func(ctx context.Context, event *nostr.Event, source EventSource) error {
+		started <- struct{}{}
+		return errors.New("unavailable")
+	})
+	adapter.EnableAsyncDerivedData(DerivedDataOptions{QueueSize: 1, MaxRetries: 3, RetryBackoff: time.Hour})
+
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 1})))
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		adapter.CloseDerivedData()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the worker kept waiting to retry")
+	}
+
+	stats := adapter.DerivedDataStats()
+	assert.Equal(t, uint64(0), stats.Retries)
+	assert.Equal(t, uint64(1), stats.Failed)
+}
@@ -0,0 +1,223 @@
+package orbitdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+const (
+	// backfillPageSize is the number of events requested from a relay per query
+	backfillPageSize = 500
+	// backfillPageTimeout bounds the wait for a relay to answer a query
+	backfillPageTimeout = 30 * time.Second
+)
+
+// ErrInvalidRelay is returned when a relay to backfill from isn't a ws:// or wss:// URL
+var ErrInvalidRelay = errors.New("invalid relay url")
+
+// RelayBackfillResult describes the events pulled from one relay
+type RelayBackfillResult struct {
+	Relay      string `json:"relay"`           // Relay URL
+	Received   int    `json:"received"`        // Events the relay sent
+	Saved      int    `json:"saved"`           // New events saved
+	Duplicates int    `json:"duplicates"`      // Events already stored, or sent by an earlier relay
+	Invalid    int    `json:"invalid"`         // Events with a bad id or signature, or refused like SaveEvent would
+	Error      string `json:"error,omitempty"` // Why the relay's history is incomplete
+}
+
+// BackfillReport summarizes a backfill from external relays
+type BackfillReport struct {
+	Relays       []*RelayBackfillResult `json:"relays"`      // Per-relay results, in request order
+	Received     int                    `json:"received"`    // Events the relays sent
+	Saved        int                    `json:"saved"`       // New events saved
+	Duplicates   int                    `json:"duplicates"`  // Events already stored or sent twice
+	Invalid      int                    `json:"invalid"`     // Events failing verification
+	DurationMsec int64                  `json:"duration_ms"` // Time the backfill took
+}
+
+// Failed returns the number of relays whose history is incomplete
+func (r *BackfillReport) Failed() int {
+	failed := 0
+	for _, relay := range r.Relays {
+		if relay.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// BackfillFromRelays connects to external Nostr relays as a client, pulls the historical
+// events matching filters page by page, newest first, and saves those with a valid signature
+// with the batch path, which applies the same checks as SaveEvent. Events of invite-only
+// subspaces are refused if the invite admitting their author comes on a later, older page. A relay failing is recorded in its result and the
+// next relay is tried; only store errors and cancellation stop the backfill.
+func (a *OrbitDBAdapter) BackfillFromRelays(ctx context.Context, relays []string, filters nostr.Filters) (*BackfillReport, error) {
+	if len(relays) == 0 {
+		return nil, fmt.Errorf("%w: no relays to backfill from", ErrInvalidRelay)
+	}
+	for _, relay := range relays {
+		if parsed, err := url.Parse(relay); err != nil || (parsed.Scheme != "ws" && parsed.Scheme != "wss") || parsed.Host == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRelay, relay)
+		}
+	}
+	if len(filters) == 0 {
+		filters = nostr.Filters{{}}
+	}
+
+	start := time.Now()
+	report := &BackfillReport{Relays: make([]*RelayBackfillResult, 0, len(relays))}
+	seen := make(map[string]bool)
+	var err error
+	for _, relay := range relays {
+		result := &RelayBackfillResult{Relay: relay}
+		report.Relays = append(report.Relays, result)
+
+		err = a.backfillRelay(ctx, relay, filters, seen, result)
+		var relayErr *relayError
+		if errors.As(err, &relayErr) {
+			result.Error = err.Error()
+			zap.L().Warn("Relay backfill incomplete", zap.String("relay", relay), zap.Error(err))
+			err = nil
+		}
+		if err != nil {
+			result.Error = err.Error()
+			break
+		}
+		zap.L().Info("Backfilled from relay", zap.String("relay", relay), zap.Int("received", result.Received),
+			zap.Int("saved", result.Saved), zap.Int("invalid", result.Invalid))
+	}
+
+	for _, result := range report.Relays {
+		report.Received += result.Received
+		report.Saved += result.Saved
+		report.Duplicates += result.Duplicates
+		report.Invalid += result.Invalid
+	}
+	report.DurationMsec = time.Since(start).Milliseconds()
+	return report, err
+}
+
+// relayError marks failures of a relay, as opposed to failures of the local store
+type relayError struct {
+	err error
+}
+
+func (e *relayError) Error() string { return e.err.Error() }
+func (e *relayError) Unwrap() error { return e.err }
+
+// backfillRelay pulls the events matching each filter from one relay
+func (a *OrbitDBAdapter) backfillRelay(ctx context.Context, relayURL string, filters nostr.Filters, seen map[string]bool, result *RelayBackfillResult) error {
+	relay, err := nostr.RelayConnect(ctx, relayURL)
+	if err != nil {
+		return &relayError{fmt.Errorf("failed to connect: %w", err)}
+	}
+	defer relay.Close()
+
+	for _, filter := range filters {
+		if err := a.backfillFilter(ctx, relay, filter, seen, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillFilter pages through the events of a relay matching filter, moving until back to
+// the oldest event of each page. until is inclusive, so pages overlap on that timestamp and
+// events sharing it across a page boundary aren't lost; paging stops when a page brings no
+// new events or filter.Limit events were received.
+func (a *OrbitDBAdapter) backfillFilter(ctx context.Context, relay *nostr.Relay, filter nostr.Filter, seen map[string]bool, result *RelayBackfillResult) error {
+	paged := make(map[string]bool)
+	page := filter
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page.Limit = backfillPageSize
+		if filter.Limit > 0 && filter.Limit-len(paged) < page.Limit {
+			page.Limit = filter.Limit - len(paged)
+		}
+
+		queryCtx, cancel := context.WithTimeout(ctx, backfillPageTimeout)
+		events, err := relay.QuerySync(queryCtx, page)
+		cancel()
+		if err != nil {
+			return &relayError{fmt.Errorf("query failed: %w", err)}
+		}
+		if !relay.IsConnected() {
+			return &relayError{fmt.Errorf("connection closed")}
+		}
+
+		fresh := make([]*nostr.Event, 0, len(events))
+		var oldest nostr.Timestamp
+		for _, event := range events {
+			if event == nil || paged[event.ID] {
+				continue
+			}
+			paged[event.ID] = true
+			fresh = append(fresh, event)
+			if oldest == 0 || event.CreatedAt < oldest {
+				oldest = event.CreatedAt
+			}
+		}
+		if len(fresh) == 0 {
+			return nil
+		}
+		result.Received += len(fresh)
+
+		if err := a.saveBackfilled(ctx, fresh, seen, result); err != nil {
+			return err
+		}
+		if (filter.Limit > 0 && len(paged) >= filter.Limit) || (filter.Since != nil && oldest <= *filter.Since) {
+			return nil
+		}
+		page.Until = &oldest
+	}
+}
+
+// saveBackfilled verifies events pulled from a relay and saves the new ones with the batch
+// path, oldest first so that create and invite events are saved before the events they admit
+func (a *OrbitDBAdapter) saveBackfilled(ctx context.Context, events []*nostr.Event, seen map[string]bool, result *RelayBackfillResult) error {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt < events[j].CreatedAt
+	})
+
+	batch := make([]*nostr.Event, 0, len(events))
+	for _, event := range events {
+		if ok, err := event.CheckSignature(); err != nil || !ok || event.GetID() != event.ID {
+			result.Invalid++
+			continue
+		}
+		if seen[event.ID] {
+			result.Duplicates++
+			continue
+		}
+		seen[event.ID] = true
+
+		stored, err := a.eventStored(ctx, event.ID)
+		if err != nil {
+			return err
+		}
+		if stored {
+			result.Duplicates++
+			continue
+		}
+		batch = append(batch, event)
+	}
+
+	saved, err := a.saveEvents(ctx, batch, func(event *nostr.Event, err error) error {
+		result.Invalid++
+		return nil
+	})
+	result.Saved += saved
+	if err != nil {
+		return fmt.Errorf("failed to save backfilled events: %w", err)
+	}
+	return nil
+}
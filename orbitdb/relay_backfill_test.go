@@ -0,0 +1,64 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that backfilled events are verified and saved once
+func TestSaveBackfilled(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("backfill"))
+	adapter.SetEventPolicies(NewPolicyChain(&KindsPolicy{Allowed: []int{1}}))
+
+	key := nostr.GeneratePrivateKey()
+	sign := func(kind int, content string) *nostr.Event {
+		event := &nostr.Event{CreatedAt: 1700000000, Kind: kind, Tags: nostr.Tags{}, Content: content}
+		require.NoError(t, event.Sign(key))
+		return event
+	}
+	note, stored, dm := sign(1, "note"), sign(1, "stored"), sign(4, "dm")
+	forged := sign(1, "original")
+	forged.Content = "forged"
+	require.NoError(t, adapter.SaveEvent(ctx, stored))
+
+	seen := make(map[string]bool)
+	result := &RelayBackfillResult{Relay: "wss://relay.example"}
+	require.NoError(t, adapter.saveBackfilled(ctx, []*nostr.Event{note, stored, dm, forged}, seen, result))
+	assert.Equal(t, 1, result.Saved)
+	assert.Equal(t, 1, result.Duplicates)
+	assert.Equal(t, 2, result.Invalid, "forged events and events refused by the policies aren't saved")
+
+	saved, err := adapter.GetEventByID(ctx, note.ID)
+	require.NoError(t, err)
+	require.NotNil(t, saved)
+	missing, err := adapter.GetEventByID(ctx, forged.ID)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// A second relay sending the same event doesn't save it again
+	again := &RelayBackfillResult{Relay: "wss://other.example"}
+	require.NoError(t, adapter.saveBackfilled(ctx, []*nostr.Event{note}, seen, again))
+	assert.Equal(t, 0, again.Saved)
+	assert.Equal(t, 1, again.Duplicates)
+}
+
+// Test that an unreachable relay is reported without failing the backfill
+func TestBackfillFromRelaysUnreachable(t *testing.T) {
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("backfill-unreachable"))
+
+	report, err := adapter.BackfillFromRelays(context.Background(), []string{"ws://127.0.0.1:1"}, nil)
+	require.NoError(t, err)
+	require.Len(t, report.Relays, 1)
+	assert.NotEmpty(t, report.Relays[0].Error)
+	assert.Equal(t, 1, report.Failed())
+
+	_, err = adapter.BackfillFromRelays(context.Background(), nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidRelay)
+	_, err = adapter.BackfillFromRelays(context.Background(), []string{"https://relay.example"}, nil)
+	assert.ErrorIs(t, err, ErrInvalidRelay)
+}
@@ -0,0 +1,198 @@
+package orbitdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"berty.tech/go-orbit-db/stores"
+	"github.com/libp2p/go-libp2p/core/event"
+)
+
+// StoreReplicationStatus describes the replication of one store
+type StoreReplicationStatus struct {
+	Address        string     `json:"address"`                   // Store address
+	Progress       int        `json:"progress"`                  // Entries replicated in the current replication
+	Max            int        `json:"max"`                       // Entries known to the current replication
+	Queued         int        `json:"queued"`                    // Entries waiting to be fetched from peers
+	Heads          int        `json:"heads"`                     // Heads of the oplog, more than one while writes are concurrent
+	Replicated     int        `json:"replicated"`                // Entries replicated from peers since startup
+	LastReplicated *time.Time `json:"last_replicated,omitempty"` // Time entries were last replicated, nil if none were
+}
+
+// PeerExchangeStats describes the heads exchanged with a peer
+type PeerExchangeStats struct {
+	Peer          string    `json:"peer"`           // Peer ID
+	Exchanges     int       `json:"exchanges"`      // Head exchanges received from the peer
+	HeadsReceived int       `json:"heads_received"` // Heads received from the peer
+	LastExchange  time.Time `json:"last_exchange"`  // Time of the last exchange
+}
+
+// ReplicationStatus describes the replication of the stores backing the adapter
+type ReplicationStatus struct {
+	CaughtUp bool                     `json:"caught_up"` // No entries queued and every replication complete
+	Stores   []StoreReplicationStatus `json:"stores"`    // Stores, empty for in-memory stores
+	Peers    []PeerExchangeStats      `json:"peers"`     // Peers heads were exchanged with, by peer ID
+}
+
+// storeReplication holds the replication events seen for a store
+type storeReplication struct {
+	entries int
+	last    time.Time
+}
+
+// ReplicationMonitor records the replication and head exchange events of OrbitDB event
+// buses. A nil ReplicationMonitor records nothing.
+type ReplicationMonitor struct {
+	mu     sync.Mutex
+	stores map[string]*storeReplication
+	peers  map[string]*PeerExchangeStats
+}
+
+// NewReplicationMonitor creates a replication monitor
+func NewReplicationMonitor() *ReplicationMonitor {
+	return &ReplicationMonitor{
+		stores: make(map[string]*storeReplication),
+		peers:  make(map[string]*PeerExchangeStats),
+	}
+}
+
+// Watch records the replication events of a store's or the OrbitDB instance's event bus
+// until ctx is done
+func (m *ReplicationMonitor) Watch(ctx context.Context, bus event.Bus) error {
+	sub, err := bus.Subscribe([]interface{}{new(stores.EventReplicated), new(iface.EventExchangeHeads)})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to replication events: %w", err)
+	}
+
+	go func() {
+		defer sub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+				m.record(evt, time.Now())
+			}
+		}
+	}()
+	return nil
+}
+
+// record records one event seen at now
+func (m *ReplicationMonitor) record(evt interface{}, now time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch evt := evt.(type) {
+	case stores.EventReplicated:
+		m.replicated(evt.Address.String(), len(evt.Entries), now)
+	case *stores.EventReplicated:
+		m.replicated(evt.Address.String(), len(evt.Entries), now)
+	case iface.EventExchangeHeads:
+		m.exchanged(evt.Peer.String(), evt.Message, now)
+	case *iface.EventExchangeHeads:
+		m.exchanged(evt.Peer.String(), evt.Message, now)
+	}
+}
+
+// replicated records entries replicated into a store
+func (m *ReplicationMonitor) replicated(address string, entries int, now time.Time) {
+	store, ok := m.stores[address]
+	if !ok {
+		store = &storeReplication{}
+		m.stores[address] = store
+	}
+	store.entries += entries
+	store.last = now
+}
+
+// exchanged records heads received from a peer
+func (m *ReplicationMonitor) exchanged(peerID string, message *iface.MessageExchangeHeads, now time.Time) {
+	stats, ok := m.peers[peerID]
+	if !ok {
+		stats = &PeerExchangeStats{Peer: peerID}
+		m.peers[peerID] = stats
+	}
+	stats.Exchanges++
+	if message != nil {
+		stats.HeadsReceived += len(message.Heads)
+	}
+	stats.LastExchange = now
+}
+
+// storeStatus fills in the replication events seen for a store
+func (m *ReplicationMonitor) storeStatus(status *StoreReplicationStatus) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if store, ok := m.stores[status.Address]; ok {
+		last := store.last
+		status.Replicated = store.entries
+		status.LastReplicated = &last
+	}
+}
+
+// peerStats returns the head exchanges by peer ID
+func (m *ReplicationMonitor) peerStats() []PeerExchangeStats {
+	peers := []PeerExchangeStats{}
+	if m == nil {
+		return peers
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stats := range m.peers {
+		peers = append(peers, *stats)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Peer < peers[j].Peer })
+	return peers
+}
+
+// EnableReplicationMonitor reports the replication events recorded by monitor in
+// ReplicationStatus. Must be called before the adapter is used.
+func (a *OrbitDBAdapter) EnableReplicationMonitor(monitor *ReplicationMonitor) {
+	a.replication = monitor
+}
+
+// ReplicationStatus reports the replication progress of every store backing the adapter,
+// so operators can tell whether the node is caught up
+func (a *OrbitDBAdapter) ReplicationStatus() *ReplicationStatus {
+	status := &ReplicationStatus{
+		CaughtUp: true,
+		Stores:   []StoreReplicationStatus{},
+		Peers:    a.replication.peerStats(),
+	}
+
+	for _, store := range a.backingStores() {
+		info := store.ReplicationStatus()
+		storeStatus := StoreReplicationStatus{
+			Address:  store.Address().String(),
+			Progress: info.GetProgress(),
+			Max:      info.GetMax(),
+			Heads:    store.OpLog().Heads().Len(),
+		}
+		if r := store.Replicator(); r != nil {
+			storeStatus.Queued = len(r.GetQueue())
+		}
+		a.replication.storeStatus(&storeStatus)
+
+		if storeStatus.Queued > 0 || storeStatus.Progress < storeStatus.Max {
+			status.CaughtUp = false
+		}
+		status.Stores = append(status.Stores, storeStatus)
+	}
+	return status
+}
@@ -0,0 +1,49 @@
+package orbitdb
+
+import (
+	"testing"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that head exchanges are counted by peer and replicated entries by store
+func TestReplicationMonitor(t *testing.T) {
+	monitor := NewReplicationMonitor()
+	first := time.Unix(1700000000, 0)
+	second := first.Add(time.Minute)
+
+	monitor.record(iface.EventExchangeHeads{Peer: peer.ID("peer-b")}, first)
+	monitor.record(&iface.EventExchangeHeads{Peer: peer.ID("peer-a")}, first)
+	monitor.record(iface.EventExchangeHeads{Peer: peer.ID("peer-b")}, second)
+	monitor.record("unrelated event", second)
+
+	peers := monitor.peerStats()
+	require.Len(t, peers, 2)
+	assert.Equal(t, peer.ID("peer-a").String(), peers[0].Peer)
+	assert.Equal(t, 2, peers[1].Exchanges)
+	assert.Equal(t, second, peers[1].LastExchange)
+
+	monitor.replicated("/orbitdb/events", 3, first)
+	monitor.replicated("/orbitdb/events", 2, second)
+	status := StoreReplicationStatus{Address: "/orbitdb/events"}
+	monitor.storeStatus(&status)
+	assert.Equal(t, 5, status.Replicated)
+	require.NotNil(t, status.LastReplicated)
+	assert.Equal(t, second, *status.LastReplicated)
+
+	idle := StoreReplicationStatus{Address: "/orbitdb/stats"}
+	monitor.storeStatus(&idle)
+	assert.Nil(t, idle.LastReplicated)
+}
+
+// Test that in-memory stores report no stores to catch up with
+func TestReplicationStatusInMemory(t *testing.T) {
+	status := NewOrbitDBAdapter(NewMemoryDocumentStore("replication")).ReplicationStatus()
+	assert.True(t, status.CaughtUp)
+	assert.Empty(t, status.Stores)
+	assert.Empty(t, status.Peers)
+}
@@ -0,0 +1,179 @@
+package orbitdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Reasons events are tombstoned
+const (
+	TombstonePurged   = "purged"    // The author's data was purged
+	TombstoneExpired  = "expired"   // The NIP-40 expiration tag passed
+	TombstoneAged     = "max_age"   // Older than the retention allows
+	TombstoneOverflow = "max_count" // Beyond the newest events of its kind the retention keeps
+)
+
+// RetentionRule limits how long and how many events of a kind are kept. Zero values don't
+// limit.
+type RetentionRule struct {
+	MaxAge   time.Duration `json:"max_age,omitempty"`   // Events older than this are removed
+	MaxCount int           `json:"max_count,omitempty"` // Only the newest MaxCount events are kept
+}
+
+// RetentionPolicy decides which events a retention sweep removes. Events whose NIP-40
+// expiration tag passed are always removed.
+type RetentionPolicy struct {
+	MaxAge time.Duration         `json:"max_age,omitempty"` // Maximum age of events of kinds without a rule, 0 for unlimited
+	Kinds  map[int]RetentionRule `json:"kinds,omitempty"`   // Rules by kind
+}
+
+// RetentionResult describes a retention sweep
+type RetentionResult struct {
+	Started          time.Time `json:"started"`           // Sweep start
+	Scanned          int       `json:"scanned"`           // Events examined
+	Expired          int       `json:"expired"`           // Events removed because their expiration tag passed
+	Aged             int       `json:"aged"`              // Events removed for exceeding the maximum age
+	Overflow         int       `json:"overflow"`          // Events removed beyond the maximum count of their kind
+	MarkersCompacted int       `json:"markers_compacted"` // Processed-event markers of removed events deleted
+	DurationMs       int64     `json:"duration_ms"`       // Sweep duration
+}
+
+// Tombstoned returns the number of events the sweep removed
+func (r *RetentionResult) Tombstoned() int {
+	return r.Expired + r.Aged + r.Overflow
+}
+
+// eventExpiration returns the NIP-40 expiration timestamp of an event, 0 if it has none
+func eventExpiration(event *nostr.Event) int64 {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "expiration" {
+			expiration, err := strconv.ParseInt(tag[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return expiration
+		}
+	}
+	return 0
+}
+
+// checkExpiration returns an error wrapping ErrEventRejected if the NIP-40 expiration of
+// an event already passed, so it isn't saved only to be swept
+func checkExpiration(event *nostr.Event) error {
+	if expiration := eventExpiration(event); expiration > 0 && expiration <= int64(nostr.Now()) {
+		return fmt.Errorf("%w: expiration: event expired at %d", ErrEventRejected, expiration)
+	}
+	return nil
+}
+
+// docExpired reports whether the NIP-40 expiration of a stored event document passed at now
+func docExpired(docMap map[string]interface{}, now int64) bool {
+	tags, _ := docMap["tags"].([]interface{})
+	for _, tag := range tags {
+		tagArray, ok := tag.([]interface{})
+		if !ok || len(tagArray) < 2 || tagArray[0] != "expiration" {
+			continue
+		}
+		value, _ := tagArray[1].(string)
+		expiration, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && expiration > 0 && expiration <= now
+	}
+	return false
+}
+
+// SweepRetention tombstones the events that expired or exceed the retention policy at now,
+// removing their derived data as DeleteEvent does, and compacts the processed-event markers
+// of the removed events. Aggregate statistics keep counting removed events; an event saved
+// again after its removal is counted again.
+func (a *OrbitDBAdapter) SweepRetention(ctx context.Context, policy RetentionPolicy, now time.Time) (*RetentionResult, error) {
+	result := &RetentionResult{Started: time.Now()}
+
+	events, err := a.queryEventDocs(ctx, nostr.Filter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan events: %w", err)
+	}
+	result.Scanned = len(events)
+
+	// Newest first, so the events kept by a maximum count come first within each kind
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].CreatedAt != events[j].CreatedAt {
+			return events[i].CreatedAt > events[j].CreatedAt
+		}
+		return events[i].ID < events[j].ID
+	})
+
+	kept := make(map[int]int)
+	for _, event := range events {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		rule, hasRule := policy.Kinds[event.Kind]
+		maxAge := policy.MaxAge
+		if hasRule {
+			maxAge = rule.MaxAge
+		}
+
+		var reason string
+		switch expiration := eventExpiration(event); {
+		case expiration > 0 && expiration <= now.Unix():
+			reason = TombstoneExpired
+			result.Expired++
+		case maxAge > 0 && now.Sub(event.CreatedAt.Time()) > maxAge:
+			reason = TombstoneAged
+			result.Aged++
+		case rule.MaxCount > 0 && kept[event.Kind] >= rule.MaxCount:
+			reason = TombstoneOverflow
+			result.Overflow++
+		default:
+			kept[event.Kind]++
+			continue
+		}
+
+		compacted, err := a.tombstoneEvent(ctx, event, reason)
+		if err != nil {
+			return result, err
+		}
+		result.MarkersCompacted += compacted
+	}
+
+	if result.Tombstoned() > 0 {
+		a.cache.clear()
+	}
+	result.DurationMs = time.Since(result.Started).Milliseconds()
+	return result, nil
+}
+
+// tombstoneEvent replaces an event by a tombstone, removes the data that belongs to it and
+// deletes its processed-event markers. Returns the number of markers deleted.
+func (a *OrbitDBAdapter) tombstoneEvent(ctx context.Context, event *nostr.Event, reason string) (int, error) {
+	tombstone := map[string]interface{}{
+		"_id":            event.ID,
+		"id":             event.ID,
+		"doc_type":       DocTypeEventTombstone,
+		"schema_version": schemaVersion(DocTypeEventTombstone),
+		"reason":         reason,
+		"tombstoned_at":  time.Now().Unix(),
+	}
+	if _, err := a.db.Put(ctx, tombstone); err != nil {
+		return 0, fmt.Errorf("failed to tombstone event %s: %w", event.ID, err)
+	}
+	a.removeEventData(ctx, event)
+
+	compacted := 0
+	for _, processed := range []*ProcessedEvents{a.userStatsMgr.processed, a.causalityMgr.processed} {
+		removed, err := processed.Forget(ctx, event.ID)
+		if err != nil {
+			return compacted, fmt.Errorf("failed to delete markers of event %s: %w", event.ID, err)
+		}
+		if removed {
+			compacted++
+		}
+	}
+	return compacted, nil
+}
@@ -0,0 +1,89 @@
+package orbitdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that sweeps remove expired events, events past their age and events beyond their count
+func TestSweepRetention(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("retention"))
+
+	now := time.Unix(time.Now().Unix(), 0)
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000f1"
+	ids := make(map[string]string)
+	event := func(name string, kind int, age time.Duration, tags ...nostr.Tag) *nostr.Event {
+		e := signAs(t, "alice", &nostr.Event{
+			Kind: kind, Content: name,
+			CreatedAt: nostr.Timestamp(now.Add(-age).Unix()),
+			Tags:      append(nostr.Tags{{"sid", sid}}, tags...),
+		})
+		ids[name] = e.ID
+		return e
+	}
+	// Events that already expired are refused, those that expire later are stored until swept
+	expired := event("expired", 30300, time.Hour, nostr.Tag{"expiration", strconv.FormatInt(now.Unix()-1, 10)})
+	assert.ErrorIs(t, adapter.SaveEvent(ctx, expired), ErrEventRejected)
+	_, err := adapter.db.Put(ctx, eventToDoc(expired))
+	require.NoError(t, err)
+
+	stored, err := adapter.GetEventByID(ctx, expired.ID)
+	require.NoError(t, err)
+	assert.Nil(t, stored, "expired events aren't served")
+	count, err := adapter.CountEvents(ctx, nostr.Filter{IDs: []string{expired.ID}})
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	events := []*nostr.Event{
+		event("not-expired", 30300, time.Hour, nostr.Tag{"expiration", strconv.FormatInt(now.Unix()+3600, 10)}),
+		event("old-post", 30300, 48*time.Hour),
+		event("old-create", 30100, 48*time.Hour),
+		event("vote-1", 30302, 3*time.Hour),
+		event("vote-2", 30302, 2*time.Hour),
+		event("vote-3", 30302, time.Hour),
+	}
+	for _, e := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, e))
+	}
+
+	policy := RetentionPolicy{
+		Kinds: map[int]RetentionRule{
+			30300: {MaxAge: 24 * time.Hour},
+			30302: {MaxCount: 2},
+		},
+	}
+	result, err := adapter.SweepRetention(ctx, policy, now)
+	require.NoError(t, err)
+	assert.Equal(t, 7, result.Scanned, "expired events are scanned")
+	assert.Equal(t, 1, result.Expired)
+	assert.Equal(t, 1, result.Aged)
+	assert.Equal(t, 1, result.Overflow)
+	assert.Positive(t, result.MarkersCompacted)
+
+	for name, kept := range map[string]bool{
+		"expired": false, "not-expired": true, "old-post": false,
+		"old-create": true, // No rule for the kind and no global maximum age
+		"vote-1":     false, "vote-2": true, "vote-3": true,
+	} {
+		stored, err := adapter.GetEventByID(ctx, ids[name])
+		require.NoError(t, err)
+		assert.Equal(t, kept, stored != nil, name)
+	}
+
+	// Statistics keep counting removed events
+	stats, err := adapter.GetUserStats(ctx, testPubKey("alice"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), stats.TotalStats[30302])
+
+	// A second sweep finds nothing left to remove
+	result, err = adapter.SweepRetention(ctx, policy, now)
+	require.NoError(t, err)
+	assert.Zero(t, result.Tombstoned())
+}
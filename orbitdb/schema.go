@@ -0,0 +1,121 @@
+package orbitdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// schemaMigration upgrades a document of a type to a schema version from the version before it
+type schemaMigration struct {
+	docType string
+	version int                                    // Version documents are upgraded to, 2 or more
+	upgrade func(doc map[string]interface{}) error // Rewrites the document in place
+}
+
+// schemaMigrations are the migrations of every document type, in version order within a type.
+// Documents written before schema versions existed are version 1. A change to the format of a
+// document type adds a migration here, e.g. filling a field UserStats gains for older documents:
+//
+//	{docType: "user_stats", version: 2, upgrade: func(doc map[string]interface{}) error {
+//		doc["new_field"] = 0
+//		return nil
+//	}},
+var schemaMigrations = []schemaMigration{}
+
+// schemaVersion returns the current schema version of a document type, stored in the
+// schema_version field of its documents
+func schemaVersion(docType string) int {
+	version := 1
+	for _, m := range schemaMigrations {
+		if m.docType == docType && m.version > version {
+			version = m.version
+		}
+	}
+	return version
+}
+
+// documentSchemaVersion returns the schema version of a document, 1 if it has none
+func documentSchemaVersion(doc map[string]interface{}) int {
+	if version, ok := docInt64(doc["schema_version"]); ok {
+		return int(version)
+	}
+	return 1
+}
+
+// SchemaMigrationResult reports the documents upgraded by MigrateSchema
+type SchemaMigrationResult struct {
+	Documents    int            `json:"documents"`   // Documents scanned
+	Migrated     map[string]int `json:"migrated"`    // Documents upgraded, by doc_type
+	Newer        map[string]int `json:"newer"`       // Documents written by a newer version, left as is, by doc_type
+	DurationMsec int64          `json:"duration_ms"` // Duration of the migration
+}
+
+// MigrateSchema upgrades the documents older than the current schema version of their type,
+// applying their type's migrations in order. Documents of a newer version than this node knows
+// are counted and left unchanged, so an older node doesn't downgrade them.
+func (a *OrbitDBAdapter) MigrateSchema(ctx context.Context) (*SchemaMigrationResult, error) {
+	start := time.Now()
+	result := &SchemaMigrationResult{Migrated: map[string]int{}, Newer: map[string]int{}}
+	defer a.cache.clear()
+
+	var outdated []map[string]interface{}
+	queryFn := func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		docType, ok := docMap["doc_type"].(string)
+		if !ok {
+			return false, nil
+		}
+
+		result.Documents++
+		switch version, current := documentSchemaVersion(docMap), schemaVersion(docType); {
+		case version < current:
+			outdated = append(outdated, docMap)
+		case version > current:
+			result.Newer[docType]++
+		}
+		return false, nil
+	}
+
+	// Scan without collecting documents
+	if _, err := queryDocuments(ctx, a.db, queryFn); err != nil {
+		return nil, err
+	}
+
+	for _, doc := range outdated {
+		docType := doc["doc_type"].(string)
+		if err := upgradeDocument(doc, docType); err != nil {
+			return result, fmt.Errorf("failed to migrate %s document %v: %w", docType, doc["_id"], err)
+		}
+		if _, err := a.db.Put(ctx, doc); err != nil {
+			return result, fmt.Errorf("failed to save migrated document %v: %w", doc["_id"], err)
+		}
+		result.Migrated[docType]++
+	}
+
+	for docType, count := range result.Newer {
+		zap.L().Warn("Documents written by a newer schema version, upgrade this node",
+			zap.String("doc_type", docType), zap.Int("documents", count), zap.Int("schema_version", schemaVersion(docType)))
+	}
+	result.DurationMsec = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// upgradeDocument applies the migrations of a document's type newer than its version
+func upgradeDocument(doc map[string]interface{}, docType string) error {
+	for _, m := range schemaMigrations {
+		if m.docType != docType || m.version <= documentSchemaVersion(doc) {
+			continue
+		}
+		if err := m.upgrade(doc); err != nil {
+			return err
+		}
+		doc["schema_version"] = m.version
+	}
+	return nil
+}
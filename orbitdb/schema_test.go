@@ -0,0 +1,60 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that documents are written with their schema version and older ones are upgraded
+func TestMigrateSchema(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDocumentStore("schema")
+	adapter := NewOrbitDBAdapter(db)
+
+	note := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 1})
+	require.NoError(t, adapter.SaveEvent(ctx, note))
+	docs, err := db.Get(ctx, note.ID, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, json.Number("1"), docs[0].(map[string]interface{})["schema_version"])
+
+	defer func(migrations []schemaMigration) { schemaMigrations = migrations }(schemaMigrations)
+	schemaMigrations = []schemaMigration{
+		{docType: "user_stats", version: 2, upgrade: func(doc map[string]interface{}) error {
+			doc["badges"] = []interface{}{}
+			return nil
+		}},
+		{docType: "user_stats", version: 3, upgrade: func(doc map[string]interface{}) error {
+			doc["badges"] = append(doc["badges"].([]interface{}), "early")
+			return nil
+		}},
+	}
+	_, err = db.Put(ctx, map[string]interface{}{"_id": "user_stats:bob", "doc_type": "user_stats", "schema_version": 2, "badges": []interface{}{}})
+	require.NoError(t, err)
+	_, err = db.Put(ctx, map[string]interface{}{"_id": "user_stats:carol", "doc_type": "user_stats", "schema_version": 7})
+	require.NoError(t, err)
+
+	result, err := adapter.MigrateSchema(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"user_stats": 2}, result.Migrated, "alice's version 1 statistics and bob's version 2")
+	assert.Equal(t, map[string]int{"user_stats": 1}, result.Newer)
+
+	for _, id := range []string{testPubKey("alice"), "user_stats:bob"} {
+		docs, err := db.Get(ctx, id, nil)
+		require.NoError(t, err)
+		require.Len(t, docs, 1, id)
+		doc := docs[0].(map[string]interface{})
+		assert.Equal(t, 3, documentSchemaVersion(doc), id)
+		assert.Equal(t, []interface{}{"early"}, doc["badges"], id)
+	}
+
+	// Upgraded documents are left alone on the next run
+	result, err = adapter.MigrateSchema(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, result.Migrated)
+}
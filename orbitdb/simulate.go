@@ -0,0 +1,325 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"berty.tech/go-orbit-db/iface"
+	"berty.tech/go-orbit-db/stores/operation"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// SimulationResult describes the derived data an event would produce if it were saved
+type SimulationResult struct {
+	EventID   string               `json:"event_id"`           // ID of the simulated event
+	Changes   []*FieldChange       `json:"changes"`            // Numeric fields that would change, e.g. counters
+	Documents []*SimulatedDocument `json:"documents"`          // Every derived document that would be written
+	Warnings  []string             `json:"warnings,omitempty"` // Processor errors that SaveEvent would only log
+}
+
+// FieldChange represents a change of a numeric field in a derived document
+type FieldChange struct {
+	DocID   string  `json:"doc_id"`   // Document key
+	DocType string  `json:"doc_type"` // Document type
+	Field   string  `json:"field"`    // Dotted field path, e.g. "keys.30302" or "total_stats.30100"
+	Before  float64 `json:"before"`   // Value before the event
+	After   float64 `json:"after"`    // Value after the event
+}
+
+// SimulatedDocument represents a derived document before and after the event
+type SimulatedDocument struct {
+	DocID   string                 `json:"doc_id"`   // Document key
+	DocType string                 `json:"doc_type"` // Document type
+	Before  map[string]interface{} `json:"before"`   // Stored document, nil if it would be created
+	After   map[string]interface{} `json:"after"`    // Document that would be written
+}
+
+// Time fields change on every write and are left out of the change list
+var simulationIgnoredFields = map[string]bool{
+	"created":      true,
+	"updated":      true,
+	"last_updated": true,
+	"timestamp":    true,
+}
+
+// dryRunStore is a DocumentStore that keeps writes in memory on top of the real store.
+// Get sees earlier writes, everything else is read from the underlying store.
+type dryRunStore struct {
+	iface.DocumentStore
+	writes map[string]map[string]interface{}
+	order  []string
+}
+
+// newDryRunStore creates a dry-run view of a document store
+func newDryRunStore(db iface.DocumentStore) *dryRunStore {
+	return &dryRunStore{
+		DocumentStore: db,
+		writes:        make(map[string]map[string]interface{}),
+	}
+}
+
+// Put records the document in memory instead of writing it
+func (s *dryRunStore) Put(ctx context.Context, document interface{}) (operation.Operation, error) {
+	// Round-trip through JSON so reads look the same as reads from the docstore
+	jsonData, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := decodeJSON(jsonData, &doc); err != nil {
+		return nil, err
+	}
+
+	key, ok := doc["_id"].(string)
+	if !ok || key == "" {
+		return nil, fmt.Errorf("document has no _id")
+	}
+
+	if _, exists := s.writes[key]; !exists {
+		s.order = append(s.order, key)
+	}
+	s.writes[key] = doc
+
+	return nil, nil
+}
+
+// PutBatch records the documents in memory instead of writing them
+func (s *dryRunStore) PutBatch(ctx context.Context, values []interface{}) (operation.Operation, error) {
+	for _, value := range values {
+		if _, err := s.Put(ctx, value); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// PutAll records the documents in memory instead of writing them
+func (s *dryRunStore) PutAll(ctx context.Context, values []interface{}) (operation.Operation, error) {
+	return s.PutBatch(ctx, values)
+}
+
+// Get returns the in-memory version of a document if it was written during the simulation
+func (s *dryRunStore) Get(ctx context.Context, key string, opts *iface.DocumentStoreGetOptions) ([]interface{}, error) {
+	if doc, exists := s.writes[key]; exists {
+		return []interface{}{doc}, nil
+	}
+	return s.DocumentStore.Get(ctx, key, opts)
+}
+
+// SimulateEvent runs the derived-data processors against an event without persisting anything
+func (a *OrbitDBAdapter) SimulateEvent(ctx context.Context, event *nostr.Event) (*SimulationResult, error) {
+	if event == nil {
+		return nil, fmt.Errorf("event cannot be nil")
+	}
+
+	dryRun := newDryRunStore(a.db)
+	result := &SimulationResult{
+		EventID:   event.ID,
+		Changes:   []*FieldChange{},
+		Documents: []*SimulatedDocument{},
+	}
+
+	causalityMgr := NewCausalityManager(dryRun)
+	var counters *dryRunCounters
+	if a.causalityMgr.counters != nil {
+		counters = newDryRunCounters(a.causalityMgr.counters)
+		causalityMgr.counters = counters
+	}
+
+	// Run processors in the same order as SaveEvent
+	if err := causalityMgr.UpdateFromEvent(ctx, event); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("causality: %v", err))
+	}
+	if err := NewUserStatsManager(dryRun).UpdateUserStatsFromEvent(ctx, event); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("user statistics: %v", err))
+	}
+	if err := NewXrefManager(dryRun).UpdateFromEvent(ctx, event); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("cross-subspace references: %v", err))
+	}
+
+	for _, key := range dryRun.order {
+		after := dryRun.writes[key]
+		docType, _ := after["doc_type"].(string)
+		if docType == DocTypeProcessedEvent {
+			// Bookkeeping, not derived data
+			continue
+		}
+
+		// Load the stored version of the document
+		var before map[string]interface{}
+		docs, err := a.db.Get(ctx, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			if docMap, ok := doc.(map[string]interface{}); ok {
+				before = docMap
+				break
+			}
+		}
+
+		result.Documents = append(result.Documents, &SimulatedDocument{
+			DocID:   key,
+			DocType: docType,
+			Before:  before,
+			After:   after,
+		})
+		for _, change := range diffNumericFields(key, docType, before, after) {
+			// Counters kept outside the documents are compared below
+			if counters != nil && docType == DocTypeCausality && strings.HasPrefix(change.Field, "keys.") {
+				continue
+			}
+			result.Changes = append(result.Changes, change)
+		}
+	}
+
+	if counters != nil {
+		changes, err := counters.changes(ctx, a.causalityMgr)
+		if err != nil {
+			return nil, err
+		}
+		result.Changes = append(result.Changes, changes...)
+	}
+
+	return result, nil
+}
+
+// dryRunCounters keeps causality counter writes in memory on top of the real counters
+type dryRunCounters struct {
+	CausalityCounters
+	writes map[string]map[uint32]uint64
+}
+
+// newDryRunCounters creates a dry-run view of causality counters
+func newDryRunCounters(counters CausalityCounters) *dryRunCounters {
+	return &dryRunCounters{
+		CausalityCounters: counters,
+		writes:            make(map[string]map[uint32]uint64),
+	}
+}
+
+// Get returns the stored counters with the simulated writes applied
+func (c *dryRunCounters) Get(ctx context.Context, subspaceID string, keyIDs []uint32) (map[uint32]uint64, error) {
+	counters, err := c.CausalityCounters.Get(ctx, subspaceID, keyIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, keyID := range keyIDs {
+		if counter, written := c.writes[subspaceID][keyID]; written {
+			counters[keyID] = counter
+		}
+	}
+	return counters, nil
+}
+
+// Set records the counter in memory instead of writing it
+func (c *dryRunCounters) Set(ctx context.Context, subspaceID string, keyID uint32, value uint64) error {
+	if c.writes[subspaceID] == nil {
+		c.writes[subspaceID] = make(map[uint32]uint64)
+	}
+	c.writes[subspaceID][keyID] = value
+	return nil
+}
+
+// Clear is not simulated
+func (c *dryRunCounters) Clear(ctx context.Context) error {
+	return fmt.Errorf("clearing counters can't be simulated")
+}
+
+// changes reports the simulated counter writes as changes of the causality documents' keys,
+// compared with the counters cm reads, which include those left in the documents
+func (c *dryRunCounters) changes(ctx context.Context, cm *CausalityManager) ([]*FieldChange, error) {
+	var changes []*FieldChange
+	for subspaceID, writes := range c.writes {
+		stored, err := cm.GetAllCausalityKeys(ctx, subspaceID)
+		if err != nil {
+			return nil, err
+		}
+		for keyID, counter := range writes {
+			if stored[keyID] == counter {
+				continue
+			}
+			changes = append(changes, &FieldChange{
+				DocID:   subspaceID,
+				DocType: DocTypeCausality,
+				Field:   fmt.Sprintf("keys.%d", keyID),
+				Before:  float64(stored[keyID]),
+				After:   float64(counter),
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].DocID != changes[j].DocID {
+			return changes[i].DocID < changes[j].DocID
+		}
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+// diffNumericFields compares the numeric leaves of two documents
+func diffNumericFields(docID, docType string, before, after map[string]interface{}) []*FieldChange {
+	beforeValues := make(map[string]float64)
+	afterValues := make(map[string]float64)
+	flattenNumeric("", before, beforeValues)
+	flattenNumeric("", after, afterValues)
+
+	fields := make(map[string]bool)
+	for field := range beforeValues {
+		fields[field] = true
+	}
+	for field := range afterValues {
+		fields[field] = true
+	}
+
+	var changes []*FieldChange
+	for field := range fields {
+		if beforeValues[field] == afterValues[field] {
+			continue
+		}
+		changes = append(changes, &FieldChange{
+			DocID:   docID,
+			DocType: docType,
+			Field:   field,
+			Before:  beforeValues[field],
+			After:   afterValues[field],
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes
+}
+
+// flattenNumeric collects numeric leaves of a JSON value keyed by dotted path
+func flattenNumeric(prefix string, value interface{}, out map[string]float64) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if simulationIgnoredFields[key] {
+				continue
+			}
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenNumeric(path, child, out)
+		}
+	case []interface{}:
+		// Only the length of lists is tracked, e.g. the number of events or members
+		if prefix != "" {
+			out[prefix+".length"] = float64(len(v))
+		}
+	default:
+		if number, ok := docFloat64(v); ok {
+			out[prefix] = number
+		}
+	}
+}
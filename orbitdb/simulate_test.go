@@ -0,0 +1,54 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Test simulating a subspace creation event without persisting it
+func TestSimulateEvent(t *testing.T) {
+	mockDB := new(MockDocumentStore)
+	adapter := NewOrbitDBAdapter(mockDB)
+
+	// Create test event
+	subspaceID := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+	event := &nostr.Event{
+		ID:        "test-event",
+		PubKey:    "test-pubkey",
+		CreatedAt: nostr.Now(),
+		Kind:      30100,
+		Tags: nostr.Tags{
+			{"sid", subspaceID},
+			{"ops", "post=30300,vote=30302"},
+		},
+	}
+
+	// Nothing is stored yet
+	mockDB.On("Get", mock.Anything, mock.Anything, mock.Anything).Return([]interface{}{}, nil)
+	mockDB.On("Query", mock.Anything, mock.Anything).Return([]interface{}{}, nil)
+
+	// Execute test
+	result, err := adapter.SimulateEvent(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-event", result.EventID)
+	assert.Empty(t, result.Warnings)
+	// causality, causality_events, user_stats and user_daily_stats
+	assert.Len(t, result.Documents, 4)
+
+	changes := make(map[string]float64)
+	for _, change := range result.Changes {
+		changes[change.DocID+"|"+change.Field] = change.After
+	}
+	assert.Equal(t, float64(1), changes[subspaceID+"|event_count"])
+	assert.Equal(t, float64(1), changes["causality_events:"+subspaceID+":0|events.length"])
+	assert.Equal(t, float64(1), changes["test-pubkey|total_stats.30100"])
+	assert.Equal(t, float64(1), changes["test-pubkey|subspace_stats."+subspaceID+".30100"])
+	assert.Equal(t, float64(1), changes[userDailyStatsDocID(statsDay(event.CreatedAt), "test-pubkey")+"|total_stats.30100"])
+
+	// Nothing must be written to the real store
+	mockDB.AssertNotCalled(t, "Put", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,107 @@
+package orbitdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"berty.tech/go-orbit-db/stores/basestore"
+	"go.uber.org/zap"
+)
+
+// ErrSnapshotsUnsupported is returned when the adapter's stores can't be snapshotted, such
+// as the in-memory store
+var ErrSnapshotsUnsupported = errors.New("store does not support snapshots")
+
+// StoreSnapshot describes the snapshot of one store
+type StoreSnapshot struct {
+	Address string `json:"address"` // Store address
+	CID     string `json:"cid"`     // CID of the snapshot in IPFS
+	Entries int    `json:"entries"` // Oplog entries the snapshot holds
+}
+
+// SnapshotResult describes a snapshot run
+type SnapshotResult struct {
+	Started    time.Time       `json:"started"`     // Run start
+	Snapshots  []StoreSnapshot `json:"snapshots"`   // Stores snapshotted
+	Skipped    int             `json:"skipped"`     // Stores that didn't grow enough since their last snapshot
+	DurationMs int64           `json:"duration_ms"` // Run duration
+}
+
+// backingStores returns the OrbitDB stores backing the adapter, nil for in-memory stores,
+// which can't be snapshotted or replicated
+func (a *OrbitDBAdapter) backingStores() []iface.Store {
+	stores := storesOf(a.db)
+	if counters, ok := a.causalityMgr.counters.(*KeyValueCounters); ok {
+		stores = append(stores, counters.kv)
+	}
+	return stores
+}
+
+// storesOf returns the OrbitDB stores behind a document store
+func storesOf(db iface.DocumentStore) []iface.Store {
+	switch db := db.(type) {
+	case *SplitStore:
+		var stores []iface.Store
+		for _, sub := range db.all() {
+			stores = append(stores, storesOf(sub)...)
+		}
+		return stores
+	case *MigrationStore:
+		return append(storesOf(db.DocumentStore), storesOf(db.newDB)...)
+	case *MemoryDocumentStore:
+		return nil
+	default:
+		return []iface.Store{db}
+	}
+}
+
+// Compact snapshots every store backing the adapter, so it can be loaded on startup without
+// replaying the oplog
+func (a *OrbitDBAdapter) Compact(ctx context.Context) (*SnapshotResult, error) {
+	return a.snapshot(ctx, 0)
+}
+
+// SnapshotIfGrown snapshots the stores whose oplog grew by at least entries since their last
+// snapshot by this adapter. Stores not yet snapshotted by this adapter are compared to an
+// empty oplog.
+func (a *OrbitDBAdapter) SnapshotIfGrown(ctx context.Context, entries int) (*SnapshotResult, error) {
+	return a.snapshot(ctx, entries)
+}
+
+// snapshot snapshots the stores that grew by at least minGrowth entries
+func (a *OrbitDBAdapter) snapshot(ctx context.Context, minGrowth int) (*SnapshotResult, error) {
+	stores := a.backingStores()
+	if len(stores) == 0 {
+		return nil, ErrSnapshotsUnsupported
+	}
+
+	a.snapshotMu.Lock()
+	defer a.snapshotMu.Unlock()
+	if a.snapshotted == nil {
+		a.snapshotted = make(map[string]int)
+	}
+
+	result := &SnapshotResult{Started: time.Now(), Snapshots: []StoreSnapshot{}}
+	for _, store := range stores {
+		address := store.Address().String()
+		entries := store.OpLog().Len()
+		if minGrowth > 0 && entries-a.snapshotted[address] < minGrowth {
+			result.Skipped++
+			continue
+		}
+
+		c, err := basestore.SaveSnapshot(ctx, store)
+		if err != nil {
+			return result, fmt.Errorf("failed to snapshot %s: %w", address, err)
+		}
+		a.snapshotted[address] = entries
+		result.Snapshots = append(result.Snapshots, StoreSnapshot{Address: address, CID: c.String(), Entries: entries})
+		zap.L().Info("Snapshotted store", zap.String("address", address), zap.Int("entries", entries), zap.Stringer("cid", c))
+	}
+
+	result.DurationMs = time.Since(result.Started).Milliseconds()
+	return result, nil
+}
@@ -0,0 +1,21 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that in-memory stores, including split ones, refuse snapshots instead of panicking
+func TestSnapshotsUnsupported(t *testing.T) {
+	ctx := context.Background()
+
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("snapshots"))
+	_, err := adapter.Compact(ctx)
+	assert.ErrorIs(t, err, ErrSnapshotsUnsupported)
+
+	split := NewSplitStore(NewMemoryDocumentStore("events"), NewMemoryDocumentStore("causality"), NewMemoryDocumentStore("stats"))
+	_, err = NewOrbitDBAdapter(split).SnapshotIfGrown(ctx, 100)
+	assert.ErrorIs(t, err, ErrSnapshotsUnsupported)
+}
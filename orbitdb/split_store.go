@@ -0,0 +1,159 @@
+package orbitdb
+
+import (
+	"context"
+
+	"berty.tech/go-orbit-db/iface"
+	"berty.tech/go-orbit-db/stores/operation"
+)
+
+// SplitStore is a DocumentStore that keeps documents in three stores by document type, so
+// scans of one kind of document don't read the others:
+//   - events: nostr events and the tombstones of purged events
+//   - causality: causality counters, their event epochs and processed-event markers
+//   - stats: user statistics and every other derived or auxiliary document
+//
+// Writes are routed by doc_type; reads by key and queries span all three stores. The adapter
+// hands the events, causality and statistics stores directly to the code scanning them.
+// Methods that are not overridden, such as Address and Replicator, use the events store.
+type SplitStore struct {
+	iface.DocumentStore
+	causality iface.DocumentStore
+	stats     iface.DocumentStore
+}
+
+// NewSplitStore combines the events, causality and statistics stores
+func NewSplitStore(events, causality, stats iface.DocumentStore) *SplitStore {
+	return &SplitStore{
+		DocumentStore: events,
+		causality:     causality,
+		stats:         stats,
+	}
+}
+
+// Events returns the store holding nostr events
+func (s *SplitStore) Events() iface.DocumentStore {
+	return s.DocumentStore
+}
+
+// Causality returns the store holding causality documents
+func (s *SplitStore) Causality() iface.DocumentStore {
+	return s.causality
+}
+
+// Stats returns the store holding user statistics and the remaining documents
+func (s *SplitStore) Stats() iface.DocumentStore {
+	return s.stats
+}
+
+// all returns the three stores
+func (s *SplitStore) all() []iface.DocumentStore {
+	return []iface.DocumentStore{s.DocumentStore, s.causality, s.stats}
+}
+
+// storeFor returns the store a document is written to
+func (s *SplitStore) storeFor(document interface{}) iface.DocumentStore {
+	docMap, _ := document.(map[string]interface{})
+	switch docMap["doc_type"] {
+	case DocTypeNostrEvent, DocTypeEventTombstone:
+		return s.DocumentStore
+	case DocTypeCausality, DocTypeCausalityEvents:
+		return s.causality
+	case DocTypeProcessedEvent:
+		if docMap["scope"] == DocTypeCausality {
+			return s.causality
+		}
+	}
+	return s.stats
+}
+
+// Put writes the document to the store of its type
+func (s *SplitStore) Put(ctx context.Context, document interface{}) (operation.Operation, error) {
+	return s.storeFor(document).Put(ctx, document)
+}
+
+// PutBatch writes the documents to the stores of their types, one batch per store
+func (s *SplitStore) PutBatch(ctx context.Context, values []interface{}) (operation.Operation, error) {
+	return s.putGrouped(values, func(db iface.DocumentStore, docs []interface{}) (operation.Operation, error) {
+		return db.PutBatch(ctx, docs)
+	})
+}
+
+// PutAll writes the documents to the stores of their types, one batch per store
+func (s *SplitStore) PutAll(ctx context.Context, values []interface{}) (operation.Operation, error) {
+	return s.putGrouped(values, func(db iface.DocumentStore, docs []interface{}) (operation.Operation, error) {
+		return db.PutAll(ctx, docs)
+	})
+}
+
+// putGrouped groups documents by store and writes each group. Returns the last operation.
+func (s *SplitStore) putGrouped(values []interface{}, write func(iface.DocumentStore, []interface{}) (operation.Operation, error)) (operation.Operation, error) {
+	groups := make(map[iface.DocumentStore][]interface{})
+	for _, value := range values {
+		db := s.storeFor(value)
+		groups[db] = append(groups[db], value)
+	}
+
+	var op operation.Operation
+	for _, db := range s.all() {
+		if len(groups[db]) == 0 {
+			continue
+		}
+		var err error
+		if op, err = write(db, groups[db]); err != nil {
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+// Get reads the key from every store, as keys don't identify their document type
+func (s *SplitStore) Get(ctx context.Context, key string, opts *iface.DocumentStoreGetOptions) ([]interface{}, error) {
+	var docs []interface{}
+	for _, db := range s.all() {
+		found, err := db.Get(ctx, key, opts)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, found...)
+	}
+	return docs, nil
+}
+
+// Delete deletes the key from the stores holding it
+func (s *SplitStore) Delete(ctx context.Context, key string) (operation.Operation, error) {
+	var op operation.Operation
+	deleted := false
+	for _, db := range s.all() {
+		found, err := db.Get(ctx, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			continue
+		}
+		if op, err = db.Delete(ctx, key); err != nil {
+			return nil, err
+		}
+		deleted = true
+	}
+
+	if !deleted {
+		// Reports the missing key like a single store would
+		return s.DocumentStore.Delete(ctx, key)
+	}
+	return op, nil
+}
+
+// Query runs the filter over every store
+func (s *SplitStore) Query(ctx context.Context, filter func(doc interface{}) (bool, error)) ([]interface{}, error) {
+	var docs []interface{}
+	for _, db := range s.all() {
+		found, err := db.Query(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, found...)
+	}
+	return docs, nil
+}
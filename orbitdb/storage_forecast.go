@@ -0,0 +1,291 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Default forecast settings
+const (
+	DefaultForecastWindowDays = 30
+	secondsPerDay             = 24 * 60 * 60
+)
+
+// DefaultForecastHorizons are the projection horizons in days
+var DefaultForecastHorizons = []int{30, 90, 365}
+
+// StorageForecastOptions controls how storage growth is analyzed
+type StorageForecastOptions struct {
+	WindowDays   int   // Number of past days used to measure growth
+	HorizonDays  []int // Days ahead to project usage for
+	DiskBytes    int64 // Measured on-disk size of the data directory, 0 if unknown
+	MaxSubspaces int   // Maximum number of subspaces in the report, 0 for all
+}
+
+// DocTypeSize represents the size and growth of one document type
+type DocTypeSize struct {
+	DocType       string  `json:"doc_type"`        // Document type
+	Documents     int     `json:"documents"`       // Number of documents
+	Bytes         int64   `json:"bytes"`           // Serialized size of the documents
+	DailyGrowth   float64 `json:"daily_growth"`    // Estimated growth in bytes per day
+	GrowthDerived bool    `json:"growth_derived"`  // Growth estimated from event growth rather than measured
+	SharePercent  float64 `json:"share_percent"`   // Share of the total size
+	ProjectedSize []int64 `json:"projected_bytes"` // Projected size per horizon
+}
+
+// SubspaceSize represents the size and growth of the events of one subspace
+type SubspaceSize struct {
+	SubspaceID    string  `json:"subspace_id"`     // Subspace ID
+	Events        int     `json:"events"`          // Number of events
+	Bytes         int64   `json:"bytes"`           // Serialized size of the events
+	WindowEvents  int     `json:"window_events"`   // Events created within the window
+	WindowBytes   int64   `json:"window_bytes"`    // Bytes of events created within the window
+	DailyGrowth   float64 `json:"daily_growth"`    // Growth in bytes per day over the window
+	LastEventAt   int64   `json:"last_event_at"`   // Timestamp of the newest event
+	ProjectedSize []int64 `json:"projected_bytes"` // Projected size per horizon
+}
+
+// StorageRecommendation suggests an action to limit storage growth
+type StorageRecommendation struct {
+	Action     string `json:"action"`                // archive|prune|review
+	SubspaceID string `json:"subspace_id,omitempty"` // Subspace the recommendation applies to
+	DocType    string `json:"doc_type,omitempty"`    // Document type the recommendation applies to
+	Reason     string `json:"reason"`                // Human readable explanation
+	Bytes      int64  `json:"bytes"`                 // Bytes affected
+}
+
+// StorageForecast is a storage compaction report with growth projections
+type StorageForecast struct {
+	GeneratedAt        int64                    `json:"generated_at"`         // Report timestamp
+	WindowDays         int                      `json:"window_days"`          // Growth measurement window
+	HorizonDays        []int                    `json:"horizon_days"`         // Projection horizons
+	TotalDocuments     int                      `json:"total_documents"`      // Number of documents
+	TotalBytes         int64                    `json:"total_bytes"`          // Serialized size of all documents
+	DiskBytes          int64                    `json:"disk_bytes"`           // Measured on-disk size, 0 if unknown
+	OverheadRatio      float64                  `json:"overhead_ratio"`       // Disk bytes per serialized byte, 1 if unknown
+	DailyGrowth        float64                  `json:"daily_growth"`         // Estimated growth in serialized bytes per day
+	ProjectedDisk      []int64                  `json:"projected_disk"`       // Projected on-disk size per horizon
+	DocTypes           []*DocTypeSize           `json:"doc_types"`            // Sizes by document type, largest first
+	Subspaces          []*SubspaceSize          `json:"subspaces"`            // Event sizes by subspace, largest growth first
+	Recommendations    []*StorageRecommendation `json:"recommendations"`      // Suggested actions
+	UnscopedEventBytes int64                    `json:"unscoped_event_bytes"` // Bytes of events without a subspace
+}
+
+// ForecastStorage scans the store, measures growth per doc_type and per subspace and
+// projects future usage
+func (a *OrbitDBAdapter) ForecastStorage(ctx context.Context, opts StorageForecastOptions) (*StorageForecast, error) {
+	if opts.WindowDays <= 0 {
+		opts.WindowDays = DefaultForecastWindowDays
+	}
+	if len(opts.HorizonDays) == 0 {
+		opts.HorizonDays = DefaultForecastHorizons
+	}
+
+	now := time.Now().Unix()
+	windowStart := now - int64(opts.WindowDays)*secondsPerDay
+
+	docTypes := make(map[string]*DocTypeSize)
+	subspaces := make(map[string]*SubspaceSize)
+	forecast := &StorageForecast{
+		GeneratedAt:     now,
+		WindowDays:      opts.WindowDays,
+		HorizonDays:     opts.HorizonDays,
+		DiskBytes:       opts.DiskBytes,
+		OverheadRatio:   1,
+		Recommendations: []*StorageRecommendation{},
+	}
+
+	var eventBytes, eventWindowBytes int64
+	queryFn := func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+
+		data, err := json.Marshal(docMap)
+		if err != nil {
+			return false, nil
+		}
+		size := int64(len(data))
+
+		docType, _ := docMap["doc_type"].(string)
+		if docType == "" {
+			docType = "unknown"
+		}
+		typeSize, exists := docTypes[docType]
+		if !exists {
+			typeSize = &DocTypeSize{DocType: docType}
+			docTypes[docType] = typeSize
+		}
+		typeSize.Documents++
+		typeSize.Bytes += size
+		forecast.TotalDocuments++
+		forecast.TotalBytes += size
+
+		if docType != DocTypeNostrEvent {
+			return false, nil
+		}
+
+		// Events carry their own timestamps, so their growth can be measured
+		createdAt, _ := docInt64(docMap["created_at"])
+		inWindow := createdAt >= windowStart
+		eventBytes += size
+		if inWindow {
+			eventWindowBytes += size
+		}
+
+		subspaceID := docSubspaceID(docMap)
+		if subspaceID == "" {
+			forecast.UnscopedEventBytes += size
+			return false, nil
+		}
+
+		subspace, exists := subspaces[subspaceID]
+		if !exists {
+			subspace = &SubspaceSize{SubspaceID: subspaceID}
+			subspaces[subspaceID] = subspace
+		}
+		subspace.Events++
+		subspace.Bytes += size
+		if createdAt > subspace.LastEventAt {
+			subspace.LastEventAt = createdAt
+		}
+		if inWindow {
+			subspace.WindowEvents++
+			subspace.WindowBytes += size
+		}
+		return false, nil
+	}
+
+	// Scan without collecting documents
+	if _, err := queryDocuments(ctx, a.db, queryFn); err != nil {
+		return nil, err
+	}
+
+	// Measured event growth drives the estimate for derived documents
+	eventDailyGrowth := float64(eventWindowBytes) / float64(opts.WindowDays)
+	for _, typeSize := range docTypes {
+		if typeSize.DocType == DocTypeNostrEvent {
+			typeSize.DailyGrowth = eventDailyGrowth
+		} else if eventBytes > 0 {
+			typeSize.DailyGrowth = eventDailyGrowth * float64(typeSize.Bytes) / float64(eventBytes)
+			typeSize.GrowthDerived = true
+		}
+		if forecast.TotalBytes > 0 {
+			typeSize.SharePercent = 100 * float64(typeSize.Bytes) / float64(forecast.TotalBytes)
+		}
+		typeSize.ProjectedSize = project(typeSize.Bytes, typeSize.DailyGrowth, opts.HorizonDays)
+		forecast.DailyGrowth += typeSize.DailyGrowth
+		forecast.DocTypes = append(forecast.DocTypes, typeSize)
+	}
+	sort.Slice(forecast.DocTypes, func(i, j int) bool {
+		return forecast.DocTypes[i].Bytes > forecast.DocTypes[j].Bytes
+	})
+
+	for _, subspace := range subspaces {
+		subspace.DailyGrowth = float64(subspace.WindowBytes) / float64(opts.WindowDays)
+		subspace.ProjectedSize = project(subspace.Bytes, subspace.DailyGrowth, opts.HorizonDays)
+		forecast.Subspaces = append(forecast.Subspaces, subspace)
+	}
+	sort.Slice(forecast.Subspaces, func(i, j int) bool {
+		if forecast.Subspaces[i].DailyGrowth != forecast.Subspaces[j].DailyGrowth {
+			return forecast.Subspaces[i].DailyGrowth > forecast.Subspaces[j].DailyGrowth
+		}
+		return forecast.Subspaces[i].Bytes > forecast.Subspaces[j].Bytes
+	})
+
+	if opts.DiskBytes > 0 && forecast.TotalBytes > 0 {
+		forecast.OverheadRatio = float64(opts.DiskBytes) / float64(forecast.TotalBytes)
+	}
+	for _, projected := range project(forecast.TotalBytes, forecast.DailyGrowth, opts.HorizonDays) {
+		forecast.ProjectedDisk = append(forecast.ProjectedDisk, int64(float64(projected)*forecast.OverheadRatio))
+	}
+
+	forecast.Recommendations = recommendStorageActions(forecast, eventBytes)
+
+	if opts.MaxSubspaces > 0 && len(forecast.Subspaces) > opts.MaxSubspaces {
+		forecast.Subspaces = forecast.Subspaces[:opts.MaxSubspaces]
+	}
+
+	return forecast, nil
+}
+
+// recommendStorageActions suggests archiving inactive subspaces and reviewing fast-growing ones
+func recommendStorageActions(forecast *StorageForecast, eventBytes int64) []*StorageRecommendation {
+	recommendations := []*StorageRecommendation{}
+	if eventBytes == 0 {
+		return recommendations
+	}
+
+	for _, subspace := range forecast.Subspaces {
+		share := float64(subspace.Bytes) / float64(eventBytes)
+
+		// Inactive subspaces holding a noticeable part of the data can be archived
+		if subspace.WindowEvents == 0 && share >= 0.05 {
+			recommendations = append(recommendations, &StorageRecommendation{
+				Action:     "archive",
+				SubspaceID: subspace.SubspaceID,
+				Reason: fmt.Sprintf("no events in the last %d days, holds %.1f%% of event data",
+					forecast.WindowDays, 100*share),
+				Bytes: subspace.Bytes,
+			})
+			continue
+		}
+
+		// Subspaces dominating growth are candidates for retention limits
+		if forecast.DailyGrowth > 0 && subspace.DailyGrowth/forecast.DailyGrowth >= 0.5 {
+			recommendations = append(recommendations, &StorageRecommendation{
+				Action:     "prune",
+				SubspaceID: subspace.SubspaceID,
+				Reason: fmt.Sprintf("accounts for %.1f%% of daily growth, consider a retention policy",
+					100*subspace.DailyGrowth/forecast.DailyGrowth),
+				Bytes: subspace.WindowBytes,
+			})
+		}
+	}
+
+	// Derived documents growing larger than the events they are built from
+	for _, typeSize := range forecast.DocTypes {
+		if typeSize.DocType != DocTypeNostrEvent && typeSize.Bytes > eventBytes {
+			recommendations = append(recommendations, &StorageRecommendation{
+				Action:  "review",
+				DocType: typeSize.DocType,
+				Reason:  "derived documents are larger than all events, check for unbounded lists",
+				Bytes:   typeSize.Bytes,
+			})
+		}
+	}
+
+	return recommendations
+}
+
+// Helper function: project a size forward with linear growth
+func project(bytes int64, dailyGrowth float64, horizons []int) []int64 {
+	projected := make([]int64, 0, len(horizons))
+	for _, days := range horizons {
+		projected = append(projected, bytes+int64(dailyGrowth*float64(days)))
+	}
+	return projected
+}
+
+// Helper function: get the sid tag of a stored event document
+func docSubspaceID(docMap map[string]interface{}) string {
+	tags, ok := docMap["tags"].([]interface{})
+	if !ok {
+		return ""
+	}
+	for _, tag := range tags {
+		tagArray, ok := tag.([]interface{})
+		if !ok || len(tagArray) < 2 {
+			continue
+		}
+		if name, _ := tagArray[0].(string); name == "sid" {
+			value, _ := tagArray[1].(string)
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test growth measurement and archive recommendations
+func TestForecastStorage(t *testing.T) {
+	mockDB := new(MockDocumentStore)
+	adapter := NewOrbitDBAdapter(mockDB)
+
+	now := time.Now().Unix()
+	eventDoc := func(id, sid string, createdAt int64) map[string]interface{} {
+		return map[string]interface{}{
+			"_id":        id,
+			"created_at": float64(createdAt),
+			"content":    "content",
+			"tags":       []interface{}{[]interface{}{"sid", sid}},
+			"doc_type":   DocTypeNostrEvent,
+		}
+	}
+	docs := []interface{}{
+		eventDoc("active-1", "active", now-3600),
+		eventDoc("active-2", "active", now-7200),
+		eventDoc("inactive-1", "inactive", now-100*secondsPerDay),
+		map[string]interface{}{"_id": "active", "doc_type": DocTypeCausality},
+	}
+
+	// Run the query function against every document like the docstore does
+	mockDB.On("Query", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		queryFn := args.Get(1).(func(doc interface{}) (bool, error))
+		for _, doc := range docs {
+			queryFn(doc)
+		}
+	}).Return([]interface{}{}, nil)
+
+	forecast, err := adapter.ForecastStorage(context.Background(), StorageForecastOptions{
+		WindowDays:  30,
+		HorizonDays: []int{30},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, forecast.TotalDocuments)
+	require.Len(t, forecast.Subspaces, 2)
+	assert.Equal(t, "active", forecast.Subspaces[0].SubspaceID)
+	assert.Equal(t, 2, forecast.Subspaces[0].WindowEvents)
+	assert.Greater(t, forecast.Subspaces[0].DailyGrowth, float64(0))
+	assert.Equal(t, float64(0), forecast.Subspaces[1].DailyGrowth)
+
+	// Projection over 30 days adds the bytes created in the last 30 days
+	assert.InDelta(t, forecast.Subspaces[0].Bytes*2, forecast.Subspaces[0].ProjectedSize[0], 1)
+
+	var archived []string
+	for _, recommendation := range forecast.Recommendations {
+		if recommendation.Action == "archive" {
+			archived = append(archived, recommendation.SubspaceID)
+		}
+	}
+	assert.Equal(t, []string{"inactive"}, archived)
+}
@@ -0,0 +1,74 @@
+package orbitdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// StoreOplog describes the oplog of one store backing the adapter
+type StoreOplog struct {
+	Address string `json:"address"` // Store address
+	Type    string `json:"type"`    // OrbitDB store type, such as docstore or keyvalue
+	Entries int    `json:"entries"` // Oplog entries loaded
+}
+
+// DocTypeCount is the number of documents of one document type
+type DocTypeCount struct {
+	DocType   string `json:"doc_type"`
+	Documents int    `json:"documents"`
+}
+
+// StoreStatus describes the databases backing the adapter and what they hold
+type StoreStatus struct {
+	Databases      DatabaseInfo   `json:"databases"`       // Database addresses
+	Stores         []StoreOplog   `json:"stores"`          // Stores with their oplog, empty for in-memory stores
+	Documents      []DocTypeCount `json:"documents"`       // Documents by doc_type, most numerous first
+	TotalDocuments int            `json:"total_documents"` // Documents of every type
+}
+
+// StoreStatus describes the stores backing the adapter and counts their documents by
+// doc_type, scanning every document
+func (a *OrbitDBAdapter) StoreStatus(ctx context.Context) (*StoreStatus, error) {
+	status := &StoreStatus{
+		Databases: a.Databases(),
+		Stores:    []StoreOplog{},
+		Documents: []DocTypeCount{},
+	}
+	for _, store := range a.backingStores() {
+		status.Stores = append(status.Stores, StoreOplog{
+			Address: store.Address().String(),
+			Type:    store.Type(),
+			Entries: store.OpLog().Len(),
+		})
+	}
+
+	counts := make(map[string]int)
+	_, err := queryDocuments(ctx, a.db, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		docType, _ := docMap["doc_type"].(string)
+		if docType == "" {
+			docType = "unknown"
+		}
+		counts[docType]++
+		status.TotalDocuments++
+		return false, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	for docType, n := range counts {
+		status.Documents = append(status.Documents, DocTypeCount{DocType: docType, Documents: n})
+	}
+	sort.Slice(status.Documents, func(i, j int) bool {
+		if status.Documents[i].Documents != status.Documents[j].Documents {
+			return status.Documents[i].Documents > status.Documents[j].Documents
+		}
+		return status.Documents[i].DocType < status.Documents[j].DocType
+	})
+	return status, nil
+}
@@ -0,0 +1,301 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeSubspaceActivity identifies subspace activity counter documents
+const DocTypeSubspaceActivity = "subspace_activity"
+
+// SubspaceActivityRetention is how long activity is counted for, the longest ranking window
+const SubspaceActivityRetention = 7 * 24 * time.Hour
+
+// Subspace activity metrics, also the sort_by values of the top subspaces endpoint
+const (
+	SubspaceActivityEvents = "events"
+	SubspaceActivityUsers  = "users"
+	SubspaceActivityVotes  = "votes"
+)
+
+// activityBucketSeconds is the granularity of activity counters
+const activityBucketSeconds = int64(time.Hour / time.Second)
+
+// ActivityBucket counts the activity of a subspace in one hour
+type ActivityBucket struct {
+	Events uint64   `json:"events"` // Number of events
+	Votes  uint64   `json:"votes"`  // Number of vote events
+	Users  []string `json:"users"`  // Distinct authors of the events
+}
+
+// SubspaceActivity holds the hourly activity counters of a subspace within the retention
+type SubspaceActivity struct {
+	ID         string                    `json:"id"`          // Document ID, format: subspace_activity:<subspace id>
+	DocType    string                    `json:"doc_type"`    // Document type, fixed as "subspace_activity"
+	SubspaceID string                    `json:"subspace_id"` // Subspace ID
+	Buckets    map[int64]*ActivityBucket `json:"buckets"`     // Counters by start of the hour, unix seconds
+	LastActive int64                     `json:"last_active"` // Timestamp of the newest event counted
+	Updated    int64                     `json:"updated"`     // Update timestamp
+}
+
+// SubspaceRanking is one ranked subspace with its activity within the ranking window
+type SubspaceRanking struct {
+	SubspaceID string `json:"subspace_id"`    // Subspace ID
+	Name       string `json:"name,omitempty"` // Subspace name, if its metadata is known
+	Events     uint64 `json:"events"`         // Number of events in the window
+	Users      int    `json:"users"`          // Number of distinct active users in the window
+	Votes      uint64 `json:"votes"`          // Number of votes in the window
+	LastActive int64  `json:"last_active"`    // Timestamp of the newest event counted
+}
+
+// SubspaceActivityManager maintains per-subspace activity counters as events arrive, so
+// subspaces can be ranked by recent activity without scanning events
+type SubspaceActivityManager struct {
+	db iface.DocumentStore
+}
+
+// NewSubspaceActivityManager creates a new SubspaceActivityManager
+func NewSubspaceActivityManager(db iface.DocumentStore) *SubspaceActivityManager {
+	return &SubspaceActivityManager{db: db}
+}
+
+// subspaceActivityDocID returns the document key of the activity of a subspace
+func subspaceActivityDocID(subspaceID string) string {
+	return DocTypeSubspaceActivity + ":" + subspaceID
+}
+
+// IsSubspaceActivityMetric reports whether metric is a known subspace activity metric
+func IsSubspaceActivityMetric(metric string) bool {
+	switch metric {
+	case SubspaceActivityEvents, SubspaceActivityUsers, SubspaceActivityVotes:
+		return true
+	}
+	return false
+}
+
+// UpdateFromEvent counts an event in the hour it was created. Events older than the
+// retention are not counted, and expired hours are dropped.
+func (am *SubspaceActivityManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	var subspaceID string
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" {
+			subspaceID = tag[1]
+			break
+		}
+	}
+	if subspaceID == "" {
+		return nil
+	}
+
+	now := int64(nostr.Now())
+	cutoff := now - int64(SubspaceActivityRetention/time.Second)
+	created := int64(event.CreatedAt)
+	if created < cutoff {
+		return nil
+	}
+
+	activity, err := am.GetSubspaceActivity(ctx, subspaceID)
+	if err != nil {
+		return err
+	}
+	if activity == nil {
+		activity = &SubspaceActivity{
+			ID:         subspaceActivityDocID(subspaceID),
+			DocType:    DocTypeSubspaceActivity,
+			SubspaceID: subspaceID,
+			Buckets:    make(map[int64]*ActivityBucket),
+		}
+	}
+
+	hour := created - created%activityBucketSeconds
+	bucket, exists := activity.Buckets[hour]
+	if !exists {
+		bucket = &ActivityBucket{Users: []string{}}
+		activity.Buckets[hour] = bucket
+	}
+	bucket.Events++
+	if event.Kind == 30302 {
+		bucket.Votes++
+	}
+	if !containsString(bucket.Users, event.PubKey) {
+		bucket.Users = append(bucket.Users, event.PubKey)
+	}
+	if created > activity.LastActive {
+		activity.LastActive = created
+	}
+
+	// Drop hours that ended before the retention
+	for start := range activity.Buckets {
+		if start+activityBucketSeconds <= cutoff {
+			delete(activity.Buckets, start)
+		}
+	}
+
+	return am.saveSubspaceActivity(ctx, activity)
+}
+
+// GetSubspaceActivity retrieves the activity counters of a subspace, nil if it had none
+func (am *SubspaceActivityManager) GetSubspaceActivity(ctx context.Context, subspaceID string) (*SubspaceActivity, error) {
+	docs, err := am.db.Get(ctx, subspaceActivityDocID(subspaceID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeSubspaceActivity {
+			continue
+		}
+		return docToSubspaceActivity(docMap)
+	}
+
+	return nil, nil
+}
+
+// ranking sums the hours of the activity that overlap the window ending now
+func (a *SubspaceActivity) ranking(since int64) *SubspaceRanking {
+	ranking := &SubspaceRanking{SubspaceID: a.SubspaceID, LastActive: a.LastActive}
+	users := make(map[string]bool)
+	for start, bucket := range a.Buckets {
+		if start+activityBucketSeconds <= since {
+			continue
+		}
+		ranking.Events += bucket.Events
+		ranking.Votes += bucket.Votes
+		for _, user := range bucket.Users {
+			users[user] = true
+		}
+	}
+	ranking.Users = len(users)
+	return ranking
+}
+
+// score returns the value of a metric for the ranking
+func (r *SubspaceRanking) score(metric string) uint64 {
+	switch metric {
+	case SubspaceActivityUsers:
+		return uint64(r.Users)
+	case SubspaceActivityVotes:
+		return r.Votes
+	default:
+		return r.Events
+	}
+}
+
+// TopSubspaces ranks subspaces by a metric over the window ending now, highest first, and
+// returns at most limit subspaces with activity in the window. Windows are counted in
+// whole hours and capped at the retention.
+func (am *SubspaceActivityManager) TopSubspaces(ctx context.Context, window time.Duration, metric string, limit int) ([]*SubspaceRanking, error) {
+	if window > SubspaceActivityRetention {
+		window = SubspaceActivityRetention
+	}
+	since := int64(nostr.Now()) - int64(window/time.Second)
+
+	docs, err := queryDocuments(ctx, am.db, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		docType, _ := docMap["doc_type"].(string)
+		return docType == DocTypeSubspaceActivity, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rankings := make([]*SubspaceRanking, 0, len(docs))
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		activity, err := docToSubspaceActivity(docMap)
+		if err != nil {
+			return nil, err
+		}
+		if ranking := activity.ranking(since); ranking.Events > 0 {
+			rankings = append(rankings, ranking)
+		}
+	}
+
+	sort.Slice(rankings, func(i, j int) bool {
+		si, sj := rankings[i].score(metric), rankings[j].score(metric)
+		if si != sj {
+			return si > sj
+		}
+		if rankings[i].Events != rankings[j].Events {
+			return rankings[i].Events > rankings[j].Events
+		}
+		return rankings[i].SubspaceID < rankings[j].SubspaceID
+	})
+	if limit > 0 && len(rankings) > limit {
+		rankings = rankings[:limit]
+	}
+	return rankings, nil
+}
+
+// Helper function: parse a subspace activity document
+func docToSubspaceActivity(docMap map[string]interface{}) (*SubspaceActivity, error) {
+	// Convert document to JSON and parse into struct
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var activity SubspaceActivity
+	if err := json.Unmarshal(jsonData, &activity); err != nil {
+		return nil, err
+	}
+	if activity.Buckets == nil {
+		activity.Buckets = make(map[int64]*ActivityBucket)
+	}
+	return &activity, nil
+}
+
+// saveSubspaceActivity saves a subspace activity document
+func (am *SubspaceActivityManager) saveSubspaceActivity(ctx context.Context, activity *SubspaceActivity) error {
+	activity.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            activity.ID,
+		"id":             activity.ID,
+		"doc_type":       DocTypeSubspaceActivity,
+		"schema_version": schemaVersion(DocTypeSubspaceActivity),
+		"subspace_id":    activity.SubspaceID,
+		"buckets":        activity.Buckets,
+		"last_active":    activity.LastActive,
+		"updated":        activity.Updated,
+	}
+
+	_, err := am.db.Put(ctx, doc)
+	return err
+}
+
+// TopSubspaces ranks subspaces by recent activity, naming those whose metadata is known
+func (a *OrbitDBAdapter) TopSubspaces(ctx context.Context, window time.Duration, metric string, limit int) ([]*SubspaceRanking, error) {
+	rankings, err := a.subspaceActivityMgr.TopSubspaces(ctx, window, metric, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ranking := range rankings {
+		meta, err := a.subspaceMetaMgr.GetSubspaceMeta(ctx, ranking.SubspaceID)
+		if err != nil {
+			return nil, err
+		}
+		if meta != nil {
+			ranking.Name = meta.Name
+		}
+	}
+	return rankings, nil
+}
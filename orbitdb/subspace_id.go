@@ -0,0 +1,93 @@
+package orbitdb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Subspace ID formats
+const (
+	SubspaceIDFormatHex   = "hex"   // 0x-prefixed 64-character hex string, the cRelay default
+	SubspaceIDFormatUUID  = "uuid"  // Canonical 8-4-4-4-12 hex UUID
+	SubspaceIDFormatCID   = "cid"   // IPFS content identifier
+	SubspaceIDFormatRegex = "regex" // Any ID matching a configured regular expression
+)
+
+// SubspaceIDValidator reports whether sid is a valid subspace ID
+type SubspaceIDValidator func(sid string) bool
+
+// subspaceIDValidator validates subspace IDs everywhere in the package. It is set once
+// at startup, before the store is used.
+var subspaceIDValidator SubspaceIDValidator = isHexSubspaceID
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// IsValidSubspaceID checks if subspace ID is valid
+func IsValidSubspaceID(sid string) bool {
+	return subspaceIDValidator(sid)
+}
+
+// SetSubspaceIDValidator replaces the subspace ID validator, nil restores the hex default.
+// It must be called before the store is used.
+func SetSubspaceIDValidator(validator SubspaceIDValidator) {
+	if validator == nil {
+		validator = isHexSubspaceID
+	}
+	subspaceIDValidator = validator
+}
+
+// NewSubspaceIDValidator returns the validator of a subspace ID format. pattern is the
+// regular expression of the regex format and is ignored otherwise; it must match whole IDs.
+func NewSubspaceIDValidator(format, pattern string) (SubspaceIDValidator, error) {
+	switch format {
+	case "", SubspaceIDFormatHex:
+		return isHexSubspaceID, nil
+	case SubspaceIDFormatUUID:
+		return uuidPattern.MatchString, nil
+	case SubspaceIDFormatCID:
+		return isCIDSubspaceID, nil
+	case SubspaceIDFormatRegex:
+		if pattern == "" {
+			return nil, fmt.Errorf("a pattern is required for the regex subspace ID format")
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid subspace ID pattern: %w", err)
+		}
+		return re.MatchString, nil
+	default:
+		return nil, fmt.Errorf("unknown subspace ID format: %s", format)
+	}
+}
+
+// isHexSubspaceID checks for a 0x-prefixed 64-character hex string
+func isHexSubspaceID(sid string) bool {
+	if len(sid) != 66 { // 0x + 64 hex chars
+		return false
+	}
+
+	if !strings.HasPrefix(sid, "0x") {
+		return false
+	}
+
+	for _, c := range sid[2:] {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isCIDSubspaceID checks for a string-encoded CID. Document keys are built from subspace
+// IDs, so CIDs containing separators used in keys are rejected.
+func isCIDSubspaceID(sid string) bool {
+	if strings.ContainsAny(sid, ":/") {
+		return false
+	}
+	_, err := cid.Decode(sid)
+	return err == nil
+}
@@ -0,0 +1,334 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeSubspaceMeta identifies subspace metadata documents
+const DocTypeSubspaceMeta = "subspace_meta"
+
+// SubspaceAccessInviteOnly is the access tag value of subspaces that only their creator,
+// moderators, members and the users they invite may write to. A user is invited by a kind
+// 30303 event signed by someone who may write, naming the invitee in a p tag; the
+// inviter_addr tag of an invitee's own event is a claim, not proof of an invitation.
+const SubspaceAccessInviteOnly = "invite-only"
+
+// ErrWriteForbidden is returned when an event's author may not write to its subspace
+var ErrWriteForbidden = errors.New("author may not write to this subspace")
+
+// SubspaceMeta is the human-readable identity of a subspace, parsed from its create event
+type SubspaceMeta struct {
+	ID            string            `json:"id"`                    // Document ID, format: subspace_meta:<subspace id>
+	DocType       string            `json:"doc_type"`              // Document type, fixed as "subspace_meta"
+	SubspaceID    string            `json:"subspace_id"`           // Subspace ID
+	Name          string            `json:"name"`                  // Name from the subspace_name tag
+	Description   string            `json:"description,omitempty"` // Description from the description tag
+	Rules         []string          `json:"rules,omitempty"`       // Rules from the rules tags, in tag order
+	Ops           map[string]uint32 `json:"ops,omitempty"`         // Op names declared in the ops tag to causality keys
+	Access        string            `json:"access,omitempty"`      // Access from the access tag, "invite-only" or empty for open
+	Moderators    []string          `json:"moderators,omitempty"`  // Public keys from the moderator tags
+	Members       []string          `json:"members,omitempty"`     // Public keys from the member tags
+	Invited       []string          `json:"invited,omitempty"`     // Public keys invited into an invite-only subspace
+	Creator       string            `json:"creator"`               // Public key of the creator
+	CreateEventID string            `json:"create_event_id"`       // ID of the create event the metadata comes from
+	CreatedAt     int64             `json:"created_at"`            // Create event timestamp
+	Updated       int64             `json:"updated"`               // Update timestamp
+}
+
+// SubspaceMetaManager maintains subspace metadata documents from kind 30100 events
+type SubspaceMetaManager struct {
+	db iface.DocumentStore
+}
+
+// NewSubspaceMetaManager creates a new SubspaceMetaManager
+func NewSubspaceMetaManager(db iface.DocumentStore) *SubspaceMetaManager {
+	return &SubspaceMetaManager{db: db}
+}
+
+// subspaceMetaDocID returns the document key of the metadata of a subspace
+func subspaceMetaDocID(subspaceID string) string {
+	return DocTypeSubspaceMeta + ":" + subspaceID
+}
+
+// UpdateFromEvent stores the metadata of a subspace-create event. When several create
+// events replicate for one subspace the earliest wins, so every node keeps the same one.
+// Invite events signed by users who may write admit the invitees of their p tags into
+// invite-only subspaces.
+func (sm *SubspaceMetaManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	if event.Kind == 30303 {
+		return sm.recordInvite(ctx, event)
+	}
+	if event.Kind != 30100 {
+		return nil
+	}
+
+	meta := &SubspaceMeta{
+		DocType:       DocTypeSubspaceMeta,
+		Creator:       event.PubKey,
+		CreateEventID: event.ID,
+		CreatedAt:     int64(event.CreatedAt),
+	}
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "sid":
+			if meta.SubspaceID == "" {
+				meta.SubspaceID = tag[1]
+			}
+		case "subspace_name":
+			meta.Name = tag[1]
+		case "description":
+			meta.Description = tag[1]
+		case "rules":
+			meta.Rules = append(meta.Rules, tag[1])
+		case "ops":
+			meta.Ops = parseOpsTag(tag[1])
+		case "access":
+			meta.Access = tag[1]
+		case "moderator":
+			meta.Moderators = append(meta.Moderators, tag[1])
+		case "member":
+			meta.Members = append(meta.Members, tag[1])
+		}
+	}
+	if meta.SubspaceID == "" {
+		return nil
+	}
+	meta.ID = subspaceMetaDocID(meta.SubspaceID)
+
+	existing, err := sm.GetSubspaceMeta(ctx, meta.SubspaceID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.CreateEventID != event.ID &&
+		(existing.CreatedAt < meta.CreatedAt || existing.CreatedAt == meta.CreatedAt && existing.CreateEventID < meta.CreateEventID) {
+		return nil
+	}
+	if existing != nil {
+		// Invitations don't come from the create event
+		meta.Invited = existing.Invited
+	}
+
+	return sm.saveSubspaceMeta(ctx, meta)
+}
+
+// Restricted reports whether only some users may write to the subspace: it is invite-only
+// or its create event lists moderators or members
+func (m *SubspaceMeta) Restricted() bool {
+	return m.Access == SubspaceAccessInviteOnly || len(m.Moderators) > 0 || len(m.Members) > 0
+}
+
+// CanWrite reports whether a user may write events to the subspace
+func (m *SubspaceMeta) CanWrite(pubKey string) bool {
+	if !m.Restricted() || pubKey == m.Creator {
+		return true
+	}
+	return containsString(m.Moderators, pubKey) || containsString(m.Members, pubKey) || containsString(m.Invited, pubKey)
+}
+
+// eventInvitees returns the public keys of the p tags of an invite event
+func eventInvitees(event *nostr.Event) []string {
+	var invitees []string
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "p" && tag[1] != "" {
+			invitees = append(invitees, tag[1])
+		}
+	}
+	return invitees
+}
+
+// CheckWrite returns ErrWriteForbidden if the author of the event may not write to its
+// subspace. Events of unknown subspaces are allowed. Invitees may write once an invite
+// event signed by a user who may write named them.
+func (sm *SubspaceMetaManager) CheckWrite(ctx context.Context, event *nostr.Event) error {
+	subspaceID := eventSubspaceID(event)
+	if subspaceID == "" {
+		return nil
+	}
+
+	meta, err := sm.GetSubspaceMeta(ctx, subspaceID)
+	if err != nil || meta == nil || meta.CanWrite(event.PubKey) {
+		return err
+	}
+	return fmt.Errorf("%w: %s in subspace %s", ErrWriteForbidden, event.PubKey, subspaceID)
+}
+
+// recordInvite adds the invitees named by the p tags of an invite event to the invited
+// users of an invite-only subspace if the event's signer may write to it
+func (sm *SubspaceMetaManager) recordInvite(ctx context.Context, event *nostr.Event) error {
+	subspaceID := eventSubspaceID(event)
+	if subspaceID == "" {
+		return nil
+	}
+
+	meta, err := sm.GetSubspaceMeta(ctx, subspaceID)
+	if err != nil || meta == nil || meta.Access != SubspaceAccessInviteOnly || !meta.CanWrite(event.PubKey) {
+		return err
+	}
+
+	added := false
+	for _, invitee := range eventInvitees(event) {
+		if !meta.CanWrite(invitee) {
+			meta.Invited = append(meta.Invited, invitee)
+			added = true
+		}
+	}
+	if !added {
+		return nil
+	}
+	return sm.saveSubspaceMeta(ctx, meta)
+}
+
+// eventSubspaceID returns the first sid tag of an event
+func eventSubspaceID(event *nostr.Event) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// RemoveEvent removes the metadata of a subspace whose create event was deleted
+func (sm *SubspaceMetaManager) RemoveEvent(ctx context.Context, event *nostr.Event) error {
+	if event.Kind != 30100 {
+		return nil
+	}
+
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "sid" {
+			continue
+		}
+		meta, err := sm.GetSubspaceMeta(ctx, tag[1])
+		if err != nil || meta == nil || meta.CreateEventID != event.ID {
+			return err
+		}
+		_, err = sm.db.Delete(ctx, meta.ID)
+		return err
+	}
+	return nil
+}
+
+// GetSubspaceMeta retrieves the metadata of a subspace, nil if it doesn't exist
+func (sm *SubspaceMetaManager) GetSubspaceMeta(ctx context.Context, subspaceID string) (*SubspaceMeta, error) {
+	docs, err := sm.db.Get(ctx, subspaceMetaDocID(subspaceID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeSubspaceMeta {
+			continue
+		}
+		return docToSubspaceMeta(docMap)
+	}
+
+	return nil, nil
+}
+
+// FindSubspacesByName retrieves the metadata of subspaces with a name, compared
+// case-insensitively, oldest first
+func (sm *SubspaceMetaManager) FindSubspacesByName(ctx context.Context, name string) ([]*SubspaceMeta, error) {
+	docs, err := queryDocuments(ctx, sm.db, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		docType, _ := docMap["doc_type"].(string)
+		docName, _ := docMap["name"].(string)
+		return docType == DocTypeSubspaceMeta && strings.EqualFold(docName, name), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metas := make([]*SubspaceMeta, 0, len(docs))
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		meta, err := docToSubspaceMeta(docMap)
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, meta)
+	}
+
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].CreatedAt != metas[j].CreatedAt {
+			return metas[i].CreatedAt < metas[j].CreatedAt
+		}
+		return metas[i].SubspaceID < metas[j].SubspaceID
+	})
+	return metas, nil
+}
+
+// Helper function: parse a subspace metadata document
+func docToSubspaceMeta(docMap map[string]interface{}) (*SubspaceMeta, error) {
+	// Convert document to JSON and parse into struct
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta SubspaceMeta
+	if err := json.Unmarshal(jsonData, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// saveSubspaceMeta saves a subspace metadata document
+func (sm *SubspaceMetaManager) saveSubspaceMeta(ctx context.Context, meta *SubspaceMeta) error {
+	meta.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":             meta.ID,
+		"id":              meta.ID,
+		"doc_type":        DocTypeSubspaceMeta,
+		"schema_version":  schemaVersion(DocTypeSubspaceMeta),
+		"subspace_id":     meta.SubspaceID,
+		"name":            meta.Name,
+		"description":     meta.Description,
+		"rules":           meta.Rules,
+		"ops":             meta.Ops,
+		"access":          meta.Access,
+		"moderators":      meta.Moderators,
+		"members":         meta.Members,
+		"invited":         meta.Invited,
+		"creator":         meta.Creator,
+		"create_event_id": meta.CreateEventID,
+		"created_at":      meta.CreatedAt,
+		"updated":         meta.Updated,
+	}
+
+	_, err := sm.db.Put(ctx, doc)
+	return err
+}
+
+// GetSubspaceMeta retrieves the name, description, rules and ops of a subspace
+func (a *OrbitDBAdapter) GetSubspaceMeta(ctx context.Context, subspaceID string) (*SubspaceMeta, error) {
+	return a.subspaceMetaMgr.GetSubspaceMeta(ctx, subspaceID)
+}
+
+// FindSubspacesByName retrieves the metadata of subspaces with a name
+func (a *OrbitDBAdapter) FindSubspacesByName(ctx context.Context, name string) ([]*SubspaceMeta, error) {
+	return a.subspaceMetaMgr.FindSubspacesByName(ctx, name)
+}
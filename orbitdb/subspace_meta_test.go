@@ -0,0 +1,159 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubspaceMetaFromCreateEvent(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("subspace-meta"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000d1"
+	create := signAs(t, "alice", &nostr.Event{
+		CreatedAt: 1700000000,
+		Kind:      30100,
+		Tags: nostr.Tags{
+			{"sid", sid},
+			{"subspace_name", "Builders"},
+			{"description", "people who build"},
+			{"rules", "be kind"},
+			{"rules", "no spam"},
+			{"ops", "post=30300,vote=30302"},
+		},
+	})
+	require.NoError(t, adapter.SaveEvent(ctx, create))
+
+	meta, err := adapter.GetSubspaceMeta(ctx, sid)
+	require.NoError(t, err)
+	require.NotNil(t, meta)
+	assert.Equal(t, "Builders", meta.Name)
+	assert.Equal(t, "people who build", meta.Description)
+	assert.Equal(t, []string{"be kind", "no spam"}, meta.Rules)
+	assert.Equal(t, map[string]uint32{"post": 30300, "vote": 30302}, meta.Ops)
+	assert.Equal(t, testPubKey("alice"), meta.Creator)
+
+	// A later create event for the same subspace doesn't replace the original
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "mallory", &nostr.Event{
+		CreatedAt: 1700000100, Kind: 30100,
+		Tags: nostr.Tags{{"sid", sid}, {"subspace_name", "Hijacked"}},
+	})))
+	meta, err = adapter.GetSubspaceMeta(ctx, sid)
+	require.NoError(t, err)
+	assert.Equal(t, "Builders", meta.Name)
+
+	found, err := adapter.FindSubspacesByName(ctx, "builders")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, sid, found[0].SubspaceID)
+
+	found, err = adapter.FindSubspacesByName(ctx, "Hijacked")
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	require.NoError(t, adapter.DeleteEvent(ctx, create))
+	meta, err = adapter.GetSubspaceMeta(ctx, sid)
+	require.NoError(t, err)
+	assert.Nil(t, meta, "metadata is removed with its create event")
+}
+
+func TestSubspaceWriteAccess(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("subspace-access"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000d2"
+	post := func(content, author string) *nostr.Event {
+		return signAs(t, author, &nostr.Event{CreatedAt: 1700000100, Kind: 30300, Content: content, Tags: nostr.Tags{{"sid", sid}}})
+	}
+	invite := func(inviter, invitee string) *nostr.Event {
+		return signAs(t, inviter, &nostr.Event{
+			CreatedAt: 1700000050, Kind: 30303,
+			Tags: nostr.Tags{{"sid", sid}, {"p", testPubKey(invitee)}},
+		})
+	}
+	accept := func(invitee, inviter string) *nostr.Event {
+		return signAs(t, invitee, &nostr.Event{
+			CreatedAt: 1700000060, Kind: 30303,
+			Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", testPubKey(inviter)}},
+		})
+	}
+
+	// Subspaces without an access list are open
+	assert.NoError(t, adapter.SaveEvent(ctx, post("open-post", "mallory")))
+
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "alice", &nostr.Event{
+		CreatedAt: 1700000000, Kind: 30100,
+		Tags: nostr.Tags{
+			{"sid", sid},
+			{"subspace_name", "Council"},
+			{"access", "invite-only"},
+			{"moderator", testPubKey("bob")},
+			{"member", testPubKey("carol")},
+		},
+	})))
+
+	assert.NoError(t, adapter.SaveEvent(ctx, post("creator-post", "alice")))
+	assert.NoError(t, adapter.SaveEvent(ctx, post("moderator-post", "bob")))
+	assert.NoError(t, adapter.SaveEvent(ctx, post("member-post", "carol")))
+	assert.ErrorIs(t, adapter.SaveEvent(ctx, post("outsider-post", "mallory")), ErrWriteForbidden)
+
+	// Claiming a member's key without their signature isn't enough either
+	forged := post("forged-post", "mallory")
+	forged.PubKey = testPubKey("carol")
+	assert.ErrorIs(t, adapter.SaveEvent(ctx, forged), ErrEventRejected)
+
+	// Invitations must be signed by users who may write; naming one as inviter isn't enough
+	assert.ErrorIs(t, adapter.SaveEvent(ctx, invite("mallory", "eve")), ErrWriteForbidden)
+	assert.ErrorIs(t, adapter.SaveEvent(ctx, accept("mallory", "alice")), ErrWriteForbidden)
+	assert.ErrorIs(t, adapter.SaveEvent(ctx, post("forger-post", "mallory")), ErrWriteForbidden)
+
+	require.NoError(t, adapter.SaveEvent(ctx, invite("carol", "dave")))
+	assert.NoError(t, adapter.SaveEvent(ctx, accept("dave", "carol")))
+	assert.NoError(t, adapter.SaveEvent(ctx, post("invitee-post", "dave")))
+
+	meta, err := adapter.GetSubspaceMeta(ctx, sid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{testPubKey("bob")}, meta.Moderators)
+	assert.Equal(t, []string{testPubKey("carol")}, meta.Members)
+	assert.Equal(t, []string{testPubKey("dave")}, meta.Invited)
+}
+
+// Test that batches are checked like single events, against the events before them
+func TestSaveEventsWriteAccess(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("subspace-batch-access"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000d3"
+	create := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30100, Tags: nostr.Tags{{"sid", sid}, {"access", SubspaceAccessInviteOnly}}})
+	invite := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000100, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"p", testPubKey("bob")}}})
+	bobPost := signAs(t, "bob", &nostr.Event{CreatedAt: 1700000200, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}})
+	vote := signAs(t, "bob", &nostr.Event{CreatedAt: 1700000300, Kind: 30302, Tags: nostr.Tags{{"sid", sid}, {"proposal_id", "p"}, {"vote", "yes"}}})
+	revote := signAs(t, "bob", &nostr.Event{CreatedAt: 1700000400, Kind: 30302, Tags: nostr.Tags{{"sid", sid}, {"proposal_id", "p"}, {"vote", "no"}}})
+	after := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000500, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}})
+	err := adapter.SaveEvents(ctx, []*nostr.Event{create, invite, bobPost, vote, revote, after})
+	assert.ErrorIs(t, err, ErrDuplicateVote)
+
+	for name, event := range map[string]*nostr.Event{"create": create, "invite": invite, "bob-post": bobPost, "vote": vote} {
+		stored, err := adapter.GetEventByID(ctx, event.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, stored, "%s is saved before the refused event", name)
+	}
+	for name, event := range map[string]*nostr.Event{"revote": revote, "after": after} {
+		stored, err := adapter.GetEventByID(ctx, event.ID)
+		require.NoError(t, err)
+		assert.Nil(t, stored, "%s is not saved", name)
+	}
+
+	malloryPost := signAs(t, "mallory", &nostr.Event{CreatedAt: 1700000600, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}})
+	err = adapter.SaveEvents(ctx, []*nostr.Event{malloryPost})
+	assert.ErrorIs(t, err, ErrWriteForbidden)
+
+	// Replacing an event goes through the same checks
+	assert.ErrorIs(t, adapter.ReplaceEvent(ctx, malloryPost), ErrWriteForbidden)
+	assert.ErrorIs(t, adapter.ReplaceEvent(ctx, revote), ErrDuplicateVote)
+	require.NoError(t, adapter.ReplaceEvent(ctx, signAs(t, "bob", &nostr.Event{CreatedAt: 1700000200, Kind: 30300, Content: "edited", Tags: nostr.Tags{{"sid", sid}}})))
+}
@@ -0,0 +1,243 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeSubspaceModeration identifies the moderation documents of subspaces. They are
+// written by subspace operators through the API, not derived from events, so rebuilds keep them.
+const DocTypeSubspaceModeration = "subspace_moderation"
+
+// ModerationEntry records a moderation action
+type ModerationEntry struct {
+	By     string `json:"by"`               // Public key of the operator who took the action
+	Reason string `json:"reason,omitempty"` // Reason given by the operator
+	At     int64  `json:"at"`               // Timestamp of the action
+}
+
+// SubspaceModeration holds the users banned from a subspace and the events hidden in it
+type SubspaceModeration struct {
+	ID         string                      `json:"id"`          // Document ID, format: subspace_moderation:<subspace id>
+	DocType    string                      `json:"doc_type"`    // Document type, fixed as "subspace_moderation"
+	SubspaceID string                      `json:"subspace_id"` // Subspace ID
+	Banned     map[string]*ModerationEntry `json:"banned"`      // Banned users by public key
+	Hidden     map[string]*ModerationEntry `json:"hidden"`      // Hidden events by ID
+	Updated    int64                       `json:"updated"`     // Update timestamp
+}
+
+// excludes reports whether the moderation leaves an event of the subspace out of queries
+func (m *SubspaceModeration) excludes(eventID, pubKey string) bool {
+	return m.Banned[pubKey] != nil || m.Hidden[eventID] != nil
+}
+
+// SubspaceModerationManager maintains the moderation documents of subspaces
+type SubspaceModerationManager struct {
+	db iface.DocumentStore
+}
+
+// NewSubspaceModerationManager creates a new SubspaceModerationManager
+func NewSubspaceModerationManager(db iface.DocumentStore) *SubspaceModerationManager {
+	return &SubspaceModerationManager{db: db}
+}
+
+// subspaceModerationDocID returns the document key of the moderation of a subspace
+func subspaceModerationDocID(subspaceID string) string {
+	return DocTypeSubspaceModeration + ":" + subspaceID
+}
+
+// CheckWrite refuses events of users banned from their subspace
+func (mm *SubspaceModerationManager) CheckWrite(ctx context.Context, event *nostr.Event) error {
+	subspaceID := eventSubspaceID(event)
+	if subspaceID == "" {
+		return nil
+	}
+	moderation, err := mm.GetSubspaceModeration(ctx, subspaceID)
+	if err != nil || moderation == nil {
+		return err
+	}
+	if moderation.Banned[event.PubKey] != nil {
+		return fmt.Errorf("%w: %s is banned from subspace %s", ErrWriteForbidden, event.PubKey, subspaceID)
+	}
+	return nil
+}
+
+// GetSubspaceModeration retrieves the moderation of a subspace, nil if it has none
+func (mm *SubspaceModerationManager) GetSubspaceModeration(ctx context.Context, subspaceID string) (*SubspaceModeration, error) {
+	docs, err := mm.db.Get(ctx, subspaceModerationDocID(subspaceID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeSubspaceModeration {
+			continue
+		}
+		return docToSubspaceModeration(docMap)
+	}
+
+	return nil, nil
+}
+
+// allSubspaceModeration retrieves the moderation of every moderated subspace, by subspace ID.
+// Only the document keys are scanned.
+func (mm *SubspaceModerationManager) allSubspaceModeration(ctx context.Context) (map[string]*SubspaceModeration, error) {
+	docs, err := mm.db.Get(ctx, DocTypeSubspaceModeration+":", &iface.DocumentStoreGetOptions{PartialMatches: true})
+	if err != nil {
+		return nil, err
+	}
+
+	moderation := make(map[string]*SubspaceModeration)
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok || docMap["doc_type"] != DocTypeSubspaceModeration {
+			continue
+		}
+		m, err := docToSubspaceModeration(docMap)
+		if err != nil {
+			return nil, err
+		}
+		if len(m.Banned) > 0 || len(m.Hidden) > 0 {
+			moderation[m.SubspaceID] = m
+		}
+	}
+	return moderation, nil
+}
+
+// update applies a change to the moderation of a subspace and saves it if the change
+// reports it changed something
+func (mm *SubspaceModerationManager) update(ctx context.Context, subspaceID string, change func(m *SubspaceModeration) bool) (bool, error) {
+	moderation, err := mm.GetSubspaceModeration(ctx, subspaceID)
+	if err != nil {
+		return false, err
+	}
+	if moderation == nil {
+		moderation = &SubspaceModeration{
+			ID:         subspaceModerationDocID(subspaceID),
+			DocType:    DocTypeSubspaceModeration,
+			SubspaceID: subspaceID,
+			Banned:     make(map[string]*ModerationEntry),
+			Hidden:     make(map[string]*ModerationEntry),
+		}
+	}
+	if !change(moderation) {
+		return false, nil
+	}
+	return true, mm.saveSubspaceModeration(ctx, moderation)
+}
+
+// Ban bans a user from a subspace, replacing an earlier ban of the user
+func (mm *SubspaceModerationManager) Ban(ctx context.Context, subspaceID, pubKey string, entry ModerationEntry) error {
+	_, err := mm.update(ctx, subspaceID, func(m *SubspaceModeration) bool {
+		m.Banned[pubKey] = &entry
+		return true
+	})
+	return err
+}
+
+// Unban lifts the ban of a user from a subspace. Returns false if the user wasn't banned.
+func (mm *SubspaceModerationManager) Unban(ctx context.Context, subspaceID, pubKey string) (bool, error) {
+	return mm.update(ctx, subspaceID, func(m *SubspaceModeration) bool {
+		if m.Banned[pubKey] == nil {
+			return false
+		}
+		delete(m.Banned, pubKey)
+		return true
+	})
+}
+
+// Hide hides an event of a subspace from queries, replacing an earlier hiding of the event
+func (mm *SubspaceModerationManager) Hide(ctx context.Context, subspaceID, eventID string, entry ModerationEntry) error {
+	_, err := mm.update(ctx, subspaceID, func(m *SubspaceModeration) bool {
+		m.Hidden[eventID] = &entry
+		return true
+	})
+	return err
+}
+
+// Unhide shows a hidden event of a subspace again. Returns false if the event wasn't hidden.
+func (mm *SubspaceModerationManager) Unhide(ctx context.Context, subspaceID, eventID string) (bool, error) {
+	return mm.update(ctx, subspaceID, func(m *SubspaceModeration) bool {
+		if m.Hidden[eventID] == nil {
+			return false
+		}
+		delete(m.Hidden, eventID)
+		return true
+	})
+}
+
+// Helper function: parse a subspace moderation document
+func docToSubspaceModeration(docMap map[string]interface{}) (*SubspaceModeration, error) {
+	// Convert document to JSON and parse into struct
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var moderation SubspaceModeration
+	if err := json.Unmarshal(jsonData, &moderation); err != nil {
+		return nil, err
+	}
+	if moderation.Banned == nil {
+		moderation.Banned = make(map[string]*ModerationEntry)
+	}
+	if moderation.Hidden == nil {
+		moderation.Hidden = make(map[string]*ModerationEntry)
+	}
+	return &moderation, nil
+}
+
+// saveSubspaceModeration saves a subspace moderation document
+func (mm *SubspaceModerationManager) saveSubspaceModeration(ctx context.Context, moderation *SubspaceModeration) error {
+	moderation.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            moderation.ID,
+		"id":             moderation.ID,
+		"doc_type":       DocTypeSubspaceModeration,
+		"schema_version": schemaVersion(DocTypeSubspaceModeration),
+		"subspace_id":    moderation.SubspaceID,
+		"banned":         moderation.Banned,
+		"hidden":         moderation.Hidden,
+		"updated":        moderation.Updated,
+	}
+
+	_, err := mm.db.Put(ctx, doc)
+	return err
+}
+
+// GetSubspaceModeration retrieves the users banned from a subspace and the events hidden in it
+func (a *OrbitDBAdapter) GetSubspaceModeration(ctx context.Context, subspaceID string) (*SubspaceModeration, error) {
+	return a.subspaceModerationMgr.GetSubspaceModeration(ctx, subspaceID)
+}
+
+// BanFromSubspace bans a user from a subspace: their events are refused and left out of
+// moderated queries
+func (a *OrbitDBAdapter) BanFromSubspace(ctx context.Context, subspaceID, pubKey string, entry ModerationEntry) error {
+	return a.subspaceModerationMgr.Ban(ctx, subspaceID, pubKey, entry)
+}
+
+// UnbanFromSubspace lifts the ban of a user from a subspace, false if they weren't banned
+func (a *OrbitDBAdapter) UnbanFromSubspace(ctx context.Context, subspaceID, pubKey string) (bool, error) {
+	return a.subspaceModerationMgr.Unban(ctx, subspaceID, pubKey)
+}
+
+// HideSubspaceEvent hides an event of a subspace from moderated queries
+func (a *OrbitDBAdapter) HideSubspaceEvent(ctx context.Context, subspaceID, eventID string, entry ModerationEntry) error {
+	return a.subspaceModerationMgr.Hide(ctx, subspaceID, eventID, entry)
+}
+
+// UnhideSubspaceEvent shows a hidden event of a subspace again, false if it wasn't hidden
+func (a *OrbitDBAdapter) UnhideSubspaceEvent(ctx context.Context, subspaceID, eventID string) (bool, error) {
+	return a.subspaceModerationMgr.Unhide(ctx, subspaceID, eventID)
+}
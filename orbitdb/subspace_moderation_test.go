@@ -0,0 +1,75 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that bans refuse writes and that bans and hidden events are left out of moderated queries
+func TestSubspaceModeration(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("moderation"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000e1"
+	post1 := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}})
+	post2 := signAs(t, "bob", &nostr.Event{CreatedAt: 1700000100, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}})
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		post1,
+		post2,
+		signAs(t, "spammer", &nostr.Event{CreatedAt: 1700000200, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "spammer", &nostr.Event{CreatedAt: 1700000300, Kind: 30300, Tags: nostr.Tags{{"sid", "0xother"}}}),
+	}))
+
+	spammer, mod := testPubKey("spammer"), testPubKey("mod")
+	require.NoError(t, adapter.BanFromSubspace(ctx, sid, spammer, ModerationEntry{By: mod, Reason: "spam", At: 1700000400}))
+	require.NoError(t, adapter.HideSubspaceEvent(ctx, sid, post1.ID, ModerationEntry{By: mod, At: 1700000400}))
+
+	moderation, err := adapter.GetSubspaceModeration(ctx, sid)
+	require.NoError(t, err)
+	require.NotNil(t, moderation)
+	assert.Equal(t, "spam", moderation.Banned[spammer].Reason)
+	assert.NotNil(t, moderation.Hidden[post1.ID])
+
+	// Banned users may no longer write to the subspace, but still elsewhere
+	post4 := signAs(t, "spammer", &nostr.Event{CreatedAt: 1700000500, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}})
+	err = adapter.SaveEvent(ctx, post4)
+	assert.ErrorIs(t, err, ErrWriteForbidden)
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "spammer", &nostr.Event{CreatedAt: 1700000500, Kind: 30300, Tags: nostr.Tags{{"sid", "0xother"}}})))
+
+	posts := nostr.Filter{Kinds: []int{30300}}
+	count, err := adapter.CountEvents(ctx, posts)
+	require.NoError(t, err)
+	assert.Equal(t, 5, count, "queries without moderation keep every event")
+
+	moderated := WithSubspaceModeration(ctx)
+	count, err = adapter.CountEvents(moderated, posts)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	posts.Limit = 1
+	posts.Tags = nostr.TagMap{"sid": []string{sid}}
+	cursor, err := adapter.OpenEventCursor(moderated, posts)
+	require.NoError(t, err)
+	event, err := cursor.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, post2.ID, event.ID, "moderated events don't take up the limit")
+
+	// Lifting the ban and showing the event again restores them
+	unbanned, err := adapter.UnbanFromSubspace(ctx, sid, spammer)
+	require.NoError(t, err)
+	assert.True(t, unbanned)
+	unbanned, err = adapter.UnbanFromSubspace(ctx, sid, spammer)
+	require.NoError(t, err)
+	assert.False(t, unbanned)
+	unhidden, err := adapter.UnhideSubspaceEvent(ctx, sid, post1.ID)
+	require.NoError(t, err)
+	assert.True(t, unhidden)
+
+	exclusion, err := adapter.QueryExclusion(moderated)
+	require.NoError(t, err)
+	assert.Nil(t, exclusion, "nothing is left out once the moderation is lifted")
+	require.NoError(t, adapter.SaveEvent(ctx, post4))
+}
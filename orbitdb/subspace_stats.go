@@ -0,0 +1,198 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeSubspaceStats identifies subspace aggregate statistics documents
+const DocTypeSubspaceStats = "subspace_stats"
+
+// SubspaceVoteTotals counts the votes cast in a subspace
+type SubspaceVoteTotals struct {
+	Total uint64 `json:"total"` // Number of vote events
+	Yes   uint64 `json:"yes"`   // Number of yes votes
+	No    uint64 `json:"no"`    // Number of no votes
+}
+
+// SubspaceStats holds the all-time aggregates of a subspace. Unlike SubspaceActivity they
+// don't expire; like user statistics they aren't decremented when events are deleted, a
+// rebuild recounts them.
+type SubspaceStats struct {
+	ID            string             `json:"id"`              // Document ID, format: subspace_stats:<subspace id>
+	DocType       string             `json:"doc_type"`        // Document type, fixed as "subspace_stats"
+	SubspaceID    string             `json:"subspace_id"`     // Subspace ID
+	TotalEvents   uint64             `json:"total_events"`    // Number of events
+	EventsByKind  map[uint32]uint64  `json:"events_by_kind"`  // Number of events by kind
+	Users         []string           `json:"users,omitempty"` // Distinct authors of the events, sorted
+	UniqueUsers   int                `json:"unique_users"`    // Number of distinct authors
+	Votes         SubspaceVoteTotals `json:"votes"`           // Votes cast in the subspace
+	Invites       uint64             `json:"invites"`         // Number of accepted invitations
+	FirstActivity int64              `json:"first_activity"`  // Timestamp of the oldest event counted
+	LastActivity  int64              `json:"last_activity"`   // Timestamp of the newest event counted
+	Updated       int64              `json:"updated"`         // Update timestamp
+}
+
+// SubspaceStatsManager maintains the aggregate statistics of subspaces as events arrive,
+// so they can be summarized without scanning the subspace's users or events
+type SubspaceStatsManager struct {
+	db        iface.DocumentStore
+	processed *ProcessedEvents // Counts each event once
+}
+
+// NewSubspaceStatsManager creates a new SubspaceStatsManager
+func NewSubspaceStatsManager(db iface.DocumentStore) *SubspaceStatsManager {
+	return &SubspaceStatsManager{db: db, processed: NewProcessedEvents(db, DocTypeSubspaceStats)}
+}
+
+// subspaceStatsDocID returns the document key of the statistics of a subspace
+func subspaceStatsDocID(subspaceID string) string {
+	return DocTypeSubspaceStats + ":" + subspaceID
+}
+
+// UpdateFromEvent counts an event in the statistics of its subspace. Events already counted
+// are skipped.
+func (sm *SubspaceStatsManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	subspaceID := eventSubspaceID(event)
+	if subspaceID == "" {
+		return nil
+	}
+
+	seen, err := sm.processed.Seen(ctx, event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check processed event: %w", err)
+	}
+	if seen {
+		return nil
+	}
+
+	stats, err := sm.GetSubspaceStats(ctx, subspaceID)
+	if err != nil {
+		return err
+	}
+	if stats == nil {
+		stats = &SubspaceStats{
+			ID:           subspaceStatsDocID(subspaceID),
+			DocType:      DocTypeSubspaceStats,
+			SubspaceID:   subspaceID,
+			EventsByKind: make(map[uint32]uint64),
+			Users:        []string{},
+		}
+	}
+
+	stats.TotalEvents++
+	stats.EventsByKind[uint32(event.Kind)]++
+	if pos := sort.SearchStrings(stats.Users, event.PubKey); pos == len(stats.Users) || stats.Users[pos] != event.PubKey {
+		stats.Users = append(stats.Users, "")
+		copy(stats.Users[pos+1:], stats.Users[pos:])
+		stats.Users[pos] = event.PubKey
+	}
+	stats.UniqueUsers = len(stats.Users)
+
+	switch event.Kind {
+	case 30302: // Vote
+		stats.Votes.Total++
+		if tag := event.Tags.GetFirst([]string{"vote", ""}); tag != nil {
+			switch tag.Value() {
+			case "yes":
+				stats.Votes.Yes++
+			case "no":
+				stats.Votes.No++
+			}
+		}
+	case 30303: // Invite
+		stats.Invites++
+	}
+
+	created := int64(event.CreatedAt)
+	if stats.FirstActivity == 0 || created < stats.FirstActivity {
+		stats.FirstActivity = created
+	}
+	if created > stats.LastActivity {
+		stats.LastActivity = created
+	}
+
+	return sm.processed.Mark(ctx, event.ID, subspaceStatsDoc(stats))
+}
+
+// GetSubspaceStats retrieves the statistics of a subspace, nil if it has no events
+func (sm *SubspaceStatsManager) GetSubspaceStats(ctx context.Context, subspaceID string) (*SubspaceStats, error) {
+	docs, err := sm.db.Get(ctx, subspaceStatsDocID(subspaceID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeSubspaceStats {
+			continue
+		}
+		return docToSubspaceStats(docMap)
+	}
+
+	return nil, nil
+}
+
+// Helper function: parse a subspace statistics document
+func docToSubspaceStats(docMap map[string]interface{}) (*SubspaceStats, error) {
+	// Convert document to JSON and parse into struct
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats SubspaceStats
+	if err := json.Unmarshal(jsonData, &stats); err != nil {
+		return nil, err
+	}
+	if stats.EventsByKind == nil {
+		stats.EventsByKind = make(map[uint32]uint64)
+	}
+	if stats.Users == nil {
+		stats.Users = []string{}
+	}
+	return &stats, nil
+}
+
+// saveSubspaceStats saves a subspace statistics document
+func (sm *SubspaceStatsManager) saveSubspaceStats(ctx context.Context, stats *SubspaceStats) error {
+	_, err := sm.db.Put(ctx, subspaceStatsDoc(stats))
+	return err
+}
+
+// subspaceStatsDoc stamps the statistics of a subspace and returns their document
+func subspaceStatsDoc(stats *SubspaceStats) map[string]interface{} {
+	stats.Updated = int64(nostr.Now())
+
+	return map[string]interface{}{
+		"_id":            stats.ID,
+		"id":             stats.ID,
+		"doc_type":       DocTypeSubspaceStats,
+		"schema_version": schemaVersion(DocTypeSubspaceStats),
+		"subspace_id":    stats.SubspaceID,
+		"total_events":   stats.TotalEvents,
+		"events_by_kind": stats.EventsByKind,
+		"users":          stats.Users,
+		"unique_users":   stats.UniqueUsers,
+		"votes":          stats.Votes,
+		"invites":        stats.Invites,
+		"first_activity": stats.FirstActivity,
+		"last_activity":  stats.LastActivity,
+		"updated":        stats.Updated,
+	}
+}
+
+// GetSubspaceStats retrieves the aggregate statistics of a subspace
+func (a *OrbitDBAdapter) GetSubspaceStats(ctx context.Context, subspaceID string) (*SubspaceStats, error) {
+	return a.subspaceStatsMgr.GetSubspaceStats(ctx, subspaceID)
+}
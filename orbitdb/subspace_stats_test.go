@@ -0,0 +1,53 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that subspace statistics aggregate events, users, votes and invites as events arrive
+func TestSubspaceStats(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("subspace-stats"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000a7"
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30100, Tags: nostr.Tags{{"sid", sid}, {"subspace_name", "Stats"}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000100, Kind: 30200, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000300, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000400, Kind: 30302, Tags: nostr.Tags{{"sid", sid}, {"proposal_id", "p"}, {"vote", "yes"}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000500, Kind: 30302, Tags: nostr.Tags{{"sid", sid}, {"proposal_id", "p"}, {"vote", "no"}}}),
+		signAs(t, "carol", &nostr.Event{CreatedAt: 1700000200, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", testPubKey("alice")}}}),
+		signAs(t, "dave", &nostr.Event{CreatedAt: 1600000000, Kind: 30300, Tags: nostr.Tags{{"sid", "0xother"}}}),
+		signAs(t, "erin", &nostr.Event{CreatedAt: 1700000600, Kind: 1}),
+	}))
+
+	stats, err := adapter.GetSubspaceStats(ctx, sid)
+	require.NoError(t, err)
+	require.NotNil(t, stats)
+	assert.Equal(t, uint64(6), stats.TotalEvents)
+	assert.Equal(t, map[uint32]uint64{30100: 1, 30200: 1, 30300: 1, 30302: 2, 30303: 1}, stats.EventsByKind)
+	assert.Equal(t, 3, stats.UniqueUsers)
+	assert.Equal(t, testPubKeys("alice", "bob", "carol"), stats.Users)
+	assert.Equal(t, SubspaceVoteTotals{Total: 2, Yes: 1, No: 1}, stats.Votes)
+	assert.Equal(t, uint64(1), stats.Invites)
+	assert.Equal(t, int64(1700000000), stats.FirstActivity)
+	assert.Equal(t, int64(1700000500), stats.LastActivity)
+
+	// A rebuild recounts each event once
+	_, err = adapter.RebuildDerivedData(ctx)
+	require.NoError(t, err)
+	rebuilt, err := adapter.GetSubspaceStats(ctx, sid)
+	require.NoError(t, err)
+	require.NotNil(t, rebuilt)
+	assert.Equal(t, stats.TotalEvents, rebuilt.TotalEvents)
+	assert.Equal(t, stats.EventsByKind, rebuilt.EventsByKind)
+
+	missing, err := adapter.GetSubspaceStats(ctx, "0xunknown")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
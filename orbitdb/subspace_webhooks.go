@@ -0,0 +1,182 @@
+package orbitdb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeSubspaceWebhooks identifies the webhook configuration document of a subspace
+const DocTypeSubspaceWebhooks = "subspace_webhooks"
+
+// SubspaceWebhook is a webhook receiving notifications about one subspace
+type SubspaceWebhook struct {
+	ID            string   `json:"id"`                       // Webhook ID
+	URL           string   `json:"url"`                      // Delivery URL
+	Secret        string   `json:"secret,omitempty"`         // HMAC-SHA256 signing secret, kept on the registering node only
+	Events        []string `json:"events"`                   // Payload types to deliver, empty for all
+	VoteThreshold uint64   `json:"vote_threshold,omitempty"` // Votes on a proposal that trigger a threshold notification, 0 for none
+	Created       int64    `json:"created"`                  // Registration timestamp
+}
+
+// SubspaceWebhooks holds all webhooks of a subspace in one document, so they are loaded
+// with a single lookup for every saved event
+type SubspaceWebhooks struct {
+	ID         string             `json:"id"`          // Document ID, format: subspace_webhooks:<subspace id>
+	DocType    string             `json:"doc_type"`    // Document type, fixed as "subspace_webhooks"
+	SubspaceID string             `json:"subspace_id"` // Subspace ID
+	Webhooks   []*SubspaceWebhook `json:"webhooks"`    // Registered webhooks
+	Updated    int64              `json:"updated"`     // Update timestamp
+}
+
+// SubspaceWebhookManager manages per-subspace webhook configuration documents. Secrets are
+// kept in the node's WebhookSecrets, not in the replicated documents.
+type SubspaceWebhookManager struct {
+	db      iface.DocumentStore
+	secrets *WebhookSecrets
+}
+
+// NewSubspaceWebhookManager creates a new SubspaceWebhookManager
+func NewSubspaceWebhookManager(db iface.DocumentStore, secrets *WebhookSecrets) *SubspaceWebhookManager {
+	return &SubspaceWebhookManager{db: db, secrets: secrets}
+}
+
+// SubspaceWebhooksDocID returns the document ID of a subspace's webhooks
+func SubspaceWebhooksDocID(subspaceID string) string {
+	return DocTypeSubspaceWebhooks + ":" + subspaceID
+}
+
+// ListSubspaceWebhooks retrieves the webhooks registered for a subspace. Secret is only set
+// on the webhooks registered on this node.
+func (wm *SubspaceWebhookManager) ListSubspaceWebhooks(ctx context.Context, subspaceID string) ([]*SubspaceWebhook, error) {
+	webhooks, err := wm.getSubspaceWebhooks(ctx, subspaceID)
+	if err != nil || webhooks == nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks.Webhooks {
+		webhook.Secret = wm.secrets.Get(webhook.ID)
+	}
+	return webhooks.Webhooks, nil
+}
+
+// AddSubspaceWebhook registers a webhook for a subspace, assigning its ID and creation time
+func (wm *SubspaceWebhookManager) AddSubspaceWebhook(ctx context.Context, subspaceID string, webhook *SubspaceWebhook) error {
+	if !IsValidSubspaceID(subspaceID) {
+		return fmt.Errorf("invalid subspace ID format: %s", subspaceID)
+	}
+	if webhook == nil {
+		return fmt.Errorf("webhook cannot be nil")
+	}
+
+	webhooks, err := wm.getSubspaceWebhooks(ctx, subspaceID)
+	if err != nil {
+		return err
+	}
+	if webhooks == nil {
+		webhooks = &SubspaceWebhooks{
+			ID:         SubspaceWebhooksDocID(subspaceID),
+			DocType:    DocTypeSubspaceWebhooks,
+			SubspaceID: subspaceID,
+		}
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	webhook.ID = hex.EncodeToString(id)
+	webhook.Created = int64(nostr.Now())
+
+	if err := wm.secrets.Set(webhook.ID, webhook.Secret); err != nil {
+		return fmt.Errorf("failed to store webhook secret: %w", err)
+	}
+	webhooks.Webhooks = append(webhooks.Webhooks, webhook)
+	return wm.saveSubspaceWebhooks(ctx, webhooks)
+}
+
+// DeleteSubspaceWebhook removes a webhook of a subspace. Returns false if it doesn't exist.
+func (wm *SubspaceWebhookManager) DeleteSubspaceWebhook(ctx context.Context, subspaceID, webhookID string) (bool, error) {
+	if !IsValidSubspaceID(subspaceID) {
+		return false, fmt.Errorf("invalid subspace ID format: %s", subspaceID)
+	}
+
+	webhooks, err := wm.getSubspaceWebhooks(ctx, subspaceID)
+	if err != nil || webhooks == nil {
+		return false, err
+	}
+
+	for i, webhook := range webhooks.Webhooks {
+		if webhook.ID == webhookID {
+			webhooks.Webhooks = append(webhooks.Webhooks[:i], webhooks.Webhooks[i+1:]...)
+			if err := wm.saveSubspaceWebhooks(ctx, webhooks); err != nil {
+				return false, err
+			}
+			return true, wm.secrets.Delete(webhookID)
+		}
+	}
+	return false, nil
+}
+
+// getSubspaceWebhooks retrieves the webhook document of a subspace, nil if none exists
+func (wm *SubspaceWebhookManager) getSubspaceWebhooks(ctx context.Context, subspaceID string) (*SubspaceWebhooks, error) {
+	docs, err := wm.db.Get(ctx, SubspaceWebhooksDocID(subspaceID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeSubspaceWebhooks {
+			continue
+		}
+
+		// Convert document to JSON and parse into struct
+		jsonData, err := json.Marshal(docMap)
+		if err != nil {
+			return nil, err
+		}
+
+		var webhooks SubspaceWebhooks
+		if err := json.Unmarshal(jsonData, &webhooks); err != nil {
+			return nil, err
+		}
+		return &webhooks, nil
+	}
+
+	return nil, nil
+}
+
+// saveSubspaceWebhooks saves the webhook document of a subspace, without the secrets
+func (wm *SubspaceWebhookManager) saveSubspaceWebhooks(ctx context.Context, webhooks *SubspaceWebhooks) error {
+	webhooks.Updated = int64(nostr.Now())
+
+	replicated := make([]*SubspaceWebhook, 0, len(webhooks.Webhooks))
+	for _, webhook := range webhooks.Webhooks {
+		copied := *webhook
+		copied.Secret = ""
+		replicated = append(replicated, &copied)
+	}
+
+	doc := map[string]interface{}{
+		"_id":            webhooks.ID,
+		"id":             webhooks.ID,
+		"doc_type":       DocTypeSubspaceWebhooks,
+		"schema_version": schemaVersion(DocTypeSubspaceWebhooks),
+		"subspace_id":    webhooks.SubspaceID,
+		"webhooks":       replicated,
+		"updated":        webhooks.Updated,
+	}
+
+	_, err := wm.db.Put(ctx, doc)
+	return err
+}
@@ -0,0 +1,170 @@
+package orbitdb
+
+import (
+	"context"
+	"sort"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Bounds of thread reconstruction
+const (
+	DefaultThreadDepth = 10   // Reply levels below the root returned by default
+	MaxThreadDepth     = 50   // Most reply levels below the root, and ancestors followed to find it
+	MaxThreadEvents    = 1000 // Most events in a thread
+)
+
+// ThreadNode is an event of a thread with its replies
+type ThreadNode struct {
+	Event   *nostr.Event  `json:"event"`   // The event
+	Depth   int           `json:"depth"`   // Reply level, 0 for the root
+	Replies []*ThreadNode `json:"replies"` // Direct replies, oldest first, ties by ID
+}
+
+// EventThread is the reply tree containing an event
+type EventThread struct {
+	EventID       string      `json:"event_id"`                 // Requested event
+	RootID        string      `json:"root_id"`                  // Oldest stored ancestor of the requested event
+	MissingParent string      `json:"missing_parent,omitempty"` // Event the root replies to, if it isn't stored
+	Root          *ThreadNode `json:"root"`                     // Reply tree from the root
+	Events        int         `json:"events"`                   // Events in the tree
+	Truncated     bool        `json:"truncated"`                // Whether replies were left out by the depth or size bound
+}
+
+// threadParent returns the event an event replies to, empty if it replies to none: the NIP-10
+// "reply" e tag, else the first causal parent tag, else the "root" e tag, else the last
+// unmarked e tag
+func threadParent(event *nostr.Event) string {
+	var root, unmarked string
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "e" || tag[1] == "" {
+			continue
+		}
+		marker := ""
+		if len(tag) >= 4 {
+			marker = tag[3]
+		}
+		switch marker {
+		case "reply":
+			return tag[1]
+		case "root":
+			root = tag[1]
+		case "":
+			unmarked = tag[1]
+		}
+	}
+	if parents := parseParentTags(event); len(parents) > 0 {
+		return parents[0]
+	}
+	if root != "" {
+		return root
+	}
+	return unmarked
+}
+
+// getEventThread reconstructs the thread of an event: the e and parent references of the
+// event are followed up to its root, then the replies below the root are collected level by
+// level, up to depth levels (DefaultThreadDepth if 0, at most MaxThreadDepth) and
+// MaxThreadEvents events. Each level is one scan. Returns nil if the event doesn't exist.
+func (a *OrbitDBAdapter) getEventThread(ctx context.Context, eventID string, depth int) (*EventThread, error) {
+	if depth <= 0 {
+		depth = DefaultThreadDepth
+	}
+	depth = min(depth, MaxThreadDepth)
+
+	event, err := a.GetEventByID(ctx, eventID)
+	if err != nil || event == nil {
+		return nil, err
+	}
+	thread := &EventThread{EventID: eventID}
+
+	// Follow the references up to the oldest stored ancestor
+	root := event
+	seen := map[string]bool{root.ID: true}
+	for range MaxThreadDepth {
+		parentID := threadParent(root)
+		if parentID == "" || seen[parentID] {
+			break
+		}
+		parent, err := a.GetEventByID(ctx, parentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			thread.MissingParent = parentID
+			break
+		}
+		root = parent
+		seen[root.ID] = true
+	}
+	thread.RootID = root.ID
+	thread.Root = &ThreadNode{Event: root, Replies: []*ThreadNode{}}
+	thread.Events = 1
+
+	// Collect the replies a level at a time
+	seen = map[string]bool{root.ID: true}
+	level := map[string]*ThreadNode{root.ID: thread.Root}
+	for d := 1; len(level) > 0; d++ {
+		ids := make([]string, 0, len(level))
+		for id := range level {
+			ids = append(ids, id)
+		}
+		replies, err := a.queryReplies(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		next := make(map[string]*ThreadNode)
+		for _, reply := range replies {
+			if seen[reply.ID] {
+				continue
+			}
+			if d > depth || thread.Events >= MaxThreadEvents {
+				thread.Truncated = true
+				break
+			}
+			seen[reply.ID] = true
+			node := &ThreadNode{Event: reply, Depth: d, Replies: []*ThreadNode{}}
+			parent := level[threadParent(reply)]
+			parent.Replies = append(parent.Replies, node)
+			next[reply.ID] = node
+			thread.Events++
+		}
+		level = next
+	}
+	return thread, nil
+}
+
+// queryReplies returns the events replying to one of the given events, oldest first, ties by ID
+func (a *OrbitDBAdapter) queryReplies(ctx context.Context, parentIDs []string) ([]*nostr.Event, error) {
+	byE := nostr.Filter{Tags: nostr.TagMap{"e": parentIDs}}
+	byParent := nostr.Filter{Tags: nostr.TagMap{"parent": parentIDs}}
+	parents := make(map[string]bool, len(parentIDs))
+	for _, id := range parentIDs {
+		parents[id] = true
+	}
+
+	var replies []*nostr.Event
+	_, err := queryDocuments(ctx, a.events, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok || !(matchesFilter(docMap, byE) || matchesFilter(docMap, byParent)) {
+			return false, nil
+		}
+		// Replies further down also reference the root, they are collected on their level
+		if event := docToEvent(docMap); parents[threadParent(event)] {
+			replies = append(replies, event)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(replies, func(i, j int) bool {
+		if replies[i].CreatedAt != replies[j].CreatedAt {
+			return replies[i].CreatedAt < replies[j].CreatedAt
+		}
+		return replies[i].ID < replies[j].ID
+	})
+	return replies, nil
+}
@@ -0,0 +1,59 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that a thread is rebuilt from the root its references lead to, whatever event is asked for
+func TestGetEventThread(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("thread"))
+	root := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 1})
+	b := signAs(t, "bob", &nostr.Event{CreatedAt: 1700000200, Kind: 1, Tags: nostr.Tags{{"e", root.ID, "", "root"}}})
+	a := signAs(t, "carol", &nostr.Event{CreatedAt: 1700000100, Kind: 1, Tags: nostr.Tags{{"e", root.ID}}})
+	// Replies to a reply reference the root as well
+	a1 := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000300, Kind: 1, Tags: nostr.Tags{{"e", root.ID, "", "root"}, {"e", a.ID, "", "reply"}}})
+	a1x := signAs(t, "bob", &nostr.Event{CreatedAt: 1700000400, Kind: 30300, Tags: nostr.Tags{{"parent", a1.ID}}})
+	other := signAs(t, "bob", &nostr.Event{CreatedAt: 1700000500, Kind: 1, Tags: nostr.Tags{{"e", "unknown"}}})
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{root, b, a, a1, a1x, other}))
+
+	thread, err := adapter.GetEventThread(ctx, a1x.ID, 0)
+	require.NoError(t, err)
+	require.NotNil(t, thread)
+	assert.Equal(t, root.ID, thread.RootID)
+	assert.Empty(t, thread.MissingParent)
+	assert.Equal(t, 5, thread.Events)
+	assert.False(t, thread.Truncated)
+
+	replies := thread.Root.Replies
+	require.Len(t, replies, 2)
+	assert.Equal(t, a.ID, replies[0].Event.ID, "oldest first")
+	assert.Equal(t, b.ID, replies[1].Event.ID)
+	require.Len(t, replies[0].Replies, 1)
+	reply := replies[0].Replies[0]
+	assert.Equal(t, a1.ID, reply.Event.ID)
+	assert.Equal(t, 2, reply.Depth)
+	require.Len(t, reply.Replies, 1)
+	assert.Equal(t, a1x.ID, reply.Replies[0].Event.ID)
+
+	// The depth bound leaves out deeper replies
+	thread, err = adapter.GetEventThread(ctx, root.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, thread.Events)
+	assert.True(t, thread.Truncated)
+
+	// Threads whose root replies to an unknown event start at the oldest stored event
+	thread, err = adapter.GetEventThread(ctx, other.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, other.ID, thread.RootID)
+	assert.Equal(t, "unknown", thread.MissingParent)
+
+	thread, err = adapter.GetEventThread(ctx, "missing", 0)
+	require.NoError(t, err)
+	assert.Nil(t, thread)
+}
@@ -0,0 +1,42 @@
+package orbitdb
+
+import (
+	"context"
+
+	"github.com/nbd-wtf/go-nostr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the adapter's spans
+const tracerName = "github.com/hetu-project/cRelay-crdt-db/orbitdb"
+
+// startSpan starts a span of the storage pipeline as a child of the span in ctx. Spans go to
+// the global tracer provider, the one OrbitDB stores are opened with, so they nest with the
+// spans of the stores' own operations.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, recording err as its failure
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// eventAttributes describes an event on a span
+func eventAttributes(event *nostr.Event) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("nostr.event.id", event.ID),
+		attribute.Int("nostr.event.kind", event.Kind),
+	}
+	if subspaceID := eventSubspaceID(event); subspaceID != "" {
+		attrs = append(attrs, attribute.String("crelay.subspace", subspaceID))
+	}
+	return attrs
+}
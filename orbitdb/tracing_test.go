@@ -0,0 +1,45 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Test that a write is traced with the derived data updates it triggers as children
+func TestTraceSaveEvent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "POST /api/events")
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("tracing"))
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000c3"
+	event := signAs(t, "creator", &nostr.Event{CreatedAt: 1700000000, Kind: 30100,
+		Tags: nostr.Tags{{"sid", sid}, {"ops", "vote=30302"}}})
+	require.NoError(t, adapter.SaveEvent(ctx, event))
+	parent.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	save, ok := spans["orbitdb.SaveEvent"]
+	require.True(t, ok)
+	assert.Equal(t, parent.SpanContext().SpanID(), save.Parent().SpanID())
+	assert.Contains(t, save.Attributes(), eventAttributes(event)[0])
+
+	for _, name := range []string{"orbitdb.derived causality", "orbitdb.derived user statistics"} {
+		step, ok := spans[name]
+		require.True(t, ok, name)
+		assert.Equal(t, save.SpanContext().SpanID(), step.Parent().SpanID(), name)
+	}
+}
@@ -0,0 +1,173 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeAPIUsage identifies daily API usage documents
+const DocTypeAPIUsage = "api_usage"
+
+// APIUsage represents the usage of one API key during one day
+type APIUsage struct {
+	ID            string `json:"id"`             // Document ID, format: usage:<day>:<key id>
+	DocType       string `json:"doc_type"`       // Document type, fixed as "api_usage"
+	Day           string `json:"day"`            // UTC day, format: YYYY-MM-DD
+	KeyID         string `json:"key_id"`         // Hashed API key identifier
+	Requests      uint64 `json:"requests"`       // Number of requests
+	EventsWritten uint64 `json:"events_written"` // Number of events saved
+	BytesServed   uint64 `json:"bytes_served"`   // Number of response bytes written
+	Updated       int64  `json:"updated"`        // Update timestamp
+}
+
+// UsageManager manages API usage documents
+type UsageManager struct {
+	db iface.DocumentStore
+}
+
+// NewUsageManager creates a new UsageManager
+func NewUsageManager(db iface.DocumentStore) *UsageManager {
+	return &UsageManager{db: db}
+}
+
+// UsageDocID returns the document ID of a key's usage on a day
+func UsageDocID(day, keyID string) string {
+	return "usage:" + day + ":" + keyID
+}
+
+// GetUsage retrieves the usage of a key on a day, nil if none was recorded
+func (um *UsageManager) GetUsage(ctx context.Context, day, keyID string) (*APIUsage, error) {
+	docs, err := um.db.Get(ctx, UsageDocID(day, keyID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeAPIUsage {
+			continue
+		}
+
+		return decodeUsage(docMap)
+	}
+
+	return nil, nil
+}
+
+// AddUsage adds the counters of delta to the stored usage of its key and day
+func (um *UsageManager) AddUsage(ctx context.Context, delta *APIUsage) error {
+	if delta == nil {
+		return fmt.Errorf("usage cannot be nil")
+	}
+
+	usage, err := um.GetUsage(ctx, delta.Day, delta.KeyID)
+	if err != nil {
+		return err
+	}
+
+	if usage == nil {
+		usage = &APIUsage{
+			ID:      UsageDocID(delta.Day, delta.KeyID),
+			DocType: DocTypeAPIUsage,
+			Day:     delta.Day,
+			KeyID:   delta.KeyID,
+		}
+	}
+
+	usage.Requests += delta.Requests
+	usage.EventsWritten += delta.EventsWritten
+	usage.BytesServed += delta.BytesServed
+	usage.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            usage.ID,
+		"id":             usage.ID,
+		"doc_type":       DocTypeAPIUsage,
+		"schema_version": schemaVersion(DocTypeAPIUsage),
+		"day":            usage.Day,
+		"key_id":         usage.KeyID,
+		"requests":       usage.Requests,
+		"events_written": usage.EventsWritten,
+		"bytes_served":   usage.BytesServed,
+		"updated":        usage.Updated,
+	}
+
+	_, err = um.db.Put(ctx, doc)
+	return err
+}
+
+// QueryUsage queries usage documents within a day range (inclusive, empty for unbounded),
+// optionally restricted to one key, ordered by day and key
+func (um *UsageManager) QueryUsage(ctx context.Context, from, to, keyID string) ([]*APIUsage, error) {
+	var results []*APIUsage
+
+	queryFn := func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeAPIUsage {
+			return false, nil
+		}
+
+		day, _ := docMap["day"].(string)
+		if (from != "" && day < from) || (to != "" && day > to) {
+			return false, nil
+		}
+
+		if keyID != "" {
+			if id, _ := docMap["key_id"].(string); id != keyID {
+				return false, nil
+			}
+		}
+
+		usage, err := decodeUsage(docMap)
+		if err != nil {
+			return false, nil
+		}
+
+		results = append(results, usage)
+		return true, nil
+	}
+
+	// Execute query
+	if _, err := queryDocuments(ctx, um.db, queryFn); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Day != results[j].Day {
+			return results[i].Day < results[j].Day
+		}
+		return results[i].KeyID < results[j].KeyID
+	})
+
+	return results, nil
+}
+
+// Helper function: convert a usage document into a struct
+func decodeUsage(docMap map[string]interface{}) (*APIUsage, error) {
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage APIUsage
+	if err := json.Unmarshal(jsonData, &usage); err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
@@ -0,0 +1,368 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeUserDailyStats identifies the documents counting the activity of a user on one day
+const DocTypeUserDailyStats = "user_daily_stats"
+
+// MaxUserStatsRange is the longest period user statistics can be summed over
+const MaxUserStatsRange = MaxDailyActivityRange
+
+// UserDailyStats counts the activity of a user on one UTC day, the daily shard of UserStats
+type UserDailyStats struct {
+	ID              string                       `json:"id"`                         // Document ID, format: user_daily_stats:<day>:<user id>
+	DocType         string                       `json:"doc_type"`                   // Document type, fixed as "user_daily_stats"
+	UserID          string                       `json:"user_id"`                    // User ID
+	Day             string                       `json:"day"`                        // UTC day, format: 2006-01-02
+	TotalStats      map[uint32]uint64            `json:"total_stats"`                // Events by kind
+	SubspaceStats   map[string]map[uint32]uint64 `json:"subspace_stats"`             // Events by subspace and kind
+	VoteStats       *VoteStats                   `json:"vote_stats,omitempty"`       // Votes counted on the day
+	SubspaceInvited map[string]uint64            `json:"subspace_invited,omitempty"` // Invitations credited on the day, by subspace
+	Updated         int64                        `json:"updated"`                    // Update timestamp
+}
+
+// UserDailyStatsManager maintains the daily statistics of users. The documents of a day
+// share a key prefix, so windowed rankings read one prefix per day instead of every user.
+type UserDailyStatsManager struct {
+	db iface.DocumentStore
+}
+
+// NewUserDailyStatsManager creates a new UserDailyStatsManager
+func NewUserDailyStatsManager(db iface.DocumentStore) *UserDailyStatsManager {
+	return &UserDailyStatsManager{db: db}
+}
+
+// userDailyStatsDocID returns the document key of the statistics of a user on a day
+func userDailyStatsDocID(day, userID string) string {
+	return DocTypeUserDailyStats + ":" + day + ":" + userID
+}
+
+// statsDay returns the UTC day of a timestamp as used in daily statistics keys
+func statsDay(timestamp nostr.Timestamp) string {
+	return timestamp.Time().UTC().Format(time.DateOnly)
+}
+
+// update applies a change to the statistics of a user on a day and saves them
+func (dm *UserDailyStatsManager) update(ctx context.Context, userID, day string, change func(daily *UserDailyStats)) error {
+	daily, err := dm.changeDay(ctx, userID, day, change)
+	if err != nil {
+		return err
+	}
+	return dm.saveDay(ctx, daily)
+}
+
+// changeDay applies a change to the statistics of a user on a day without saving them
+func (dm *UserDailyStatsManager) changeDay(ctx context.Context, userID, day string, change func(daily *UserDailyStats)) (*UserDailyStats, error) {
+	daily, err := dm.getDay(ctx, userDailyStatsDocID(day, userID))
+	if err != nil {
+		return nil, err
+	}
+	if daily == nil {
+		daily = &UserDailyStats{
+			ID:            userDailyStatsDocID(day, userID),
+			DocType:       DocTypeUserDailyStats,
+			UserID:        userID,
+			Day:           day,
+			TotalStats:    make(map[uint32]uint64),
+			SubspaceStats: make(map[string]map[uint32]uint64),
+		}
+	}
+	change(daily)
+	return daily, nil
+}
+
+// recordEvent counts an event of a user on the day it was created and returns the document
+// of the day, for the caller to write with the rest of the update. vote is the yes or no of
+// a counted vote, empty for other events and votes that weren't counted.
+func (dm *UserDailyStatsManager) recordEvent(ctx context.Context, event *nostr.Event, subspaceID string, voteCounted bool, vote string) (map[string]interface{}, error) {
+	daily, err := dm.changeDay(ctx, event.PubKey, statsDay(event.CreatedAt), func(daily *UserDailyStats) {
+		kind := uint32(event.Kind)
+		daily.TotalStats[kind]++
+		if subspaceID == "" {
+			return
+		}
+		if daily.SubspaceStats[subspaceID] == nil {
+			daily.SubspaceStats[subspaceID] = make(map[uint32]uint64)
+		}
+		daily.SubspaceStats[subspaceID][kind]++
+
+		if !voteCounted {
+			return
+		}
+		if daily.VoteStats == nil {
+			daily.VoteStats = &VoteStats{SubspaceVotes: make(map[string]*SubspaceVoteStats)}
+		}
+		if daily.VoteStats.SubspaceVotes[subspaceID] == nil {
+			daily.VoteStats.SubspaceVotes[subspaceID] = &SubspaceVoteStats{}
+		}
+		daily.VoteStats.TotalVotes++
+		daily.VoteStats.SubspaceVotes[subspaceID].TotalVotes++
+		switch vote {
+		case "yes":
+			daily.VoteStats.YesVotes++
+			daily.VoteStats.SubspaceVotes[subspaceID].YesVotes++
+		case "no":
+			daily.VoteStats.NoVotes++
+			daily.VoteStats.SubspaceVotes[subspaceID].NoVotes++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userDailyStatsDoc(daily), nil
+}
+
+// removeVote takes a deleted vote out of the statistics of the day it was cast
+func (dm *UserDailyStatsManager) removeVote(ctx context.Context, userID, day, subspaceID, vote string) error {
+	daily, err := dm.getDay(ctx, userDailyStatsDocID(day, userID))
+	if err != nil || daily == nil || daily.VoteStats == nil {
+		return err
+	}
+	daily.VoteStats.uncount(subspaceID, vote)
+	return dm.saveDay(ctx, daily)
+}
+
+// recordInvite credits an inviter with an invitation accepted on a day
+func (dm *UserDailyStatsManager) recordInvite(ctx context.Context, inviterID, subspaceID, day string) error {
+	return dm.update(ctx, inviterID, day, func(daily *UserDailyStats) {
+		if daily.SubspaceInvited == nil {
+			daily.SubspaceInvited = make(map[string]uint64)
+		}
+		daily.SubspaceInvited[subspaceID]++
+	})
+}
+
+// GetUserPeriodStats sums the daily statistics of a user over the UTC days covering
+// [from, to]. The result has the shape of UserStats, without the membership lists; nil if
+// the user had no activity in the period.
+func (dm *UserDailyStatsManager) GetUserPeriodStats(ctx context.Context, userID string, from, to time.Time) (*UserStats, error) {
+	var stats *UserStats
+	for _, day := range statsDays(from, to) {
+		daily, err := dm.getDay(ctx, userDailyStatsDocID(day, userID))
+		if err != nil {
+			return nil, err
+		}
+		if daily != nil {
+			stats = addDailyStats(stats, daily)
+		}
+	}
+	return stats, nil
+}
+
+// QueryPeriodStats sums the daily statistics of every user active over the UTC days
+// covering [from, to]
+func (dm *UserDailyStatsManager) QueryPeriodStats(ctx context.Context, from, to time.Time) ([]*UserStats, error) {
+	byUser := make(map[string]*UserStats)
+	var users []*UserStats
+	for _, day := range statsDays(from, to) {
+		docs, err := dm.db.Get(ctx, userDailyStatsDocID(day, ""), &iface.DocumentStoreGetOptions{PartialMatches: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			docMap, ok := doc.(map[string]interface{})
+			if !ok || docMap["doc_type"] != DocTypeUserDailyStats {
+				continue
+			}
+			daily, err := docToUserDailyStats(docMap)
+			if err != nil {
+				return nil, err
+			}
+			if daily.Day != day {
+				continue
+			}
+			stats, seen := byUser[daily.UserID]
+			byUser[daily.UserID] = addDailyStats(stats, daily)
+			if !seen {
+				users = append(users, byUser[daily.UserID])
+			}
+		}
+	}
+	return users, nil
+}
+
+// DeleteUserDailyStats deletes the daily statistics of a user and returns how many days
+// were deleted
+func (dm *UserDailyStatsManager) DeleteUserDailyStats(ctx context.Context, userID string) (int, error) {
+	docs, err := dm.db.Get(ctx, DocTypeUserDailyStats+":", &iface.DocumentStoreGetOptions{PartialMatches: true})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok || docMap["doc_type"] != DocTypeUserDailyStats || docMap["user_id"] != userID {
+			continue
+		}
+		key, _ := docMap["_id"].(string)
+		if _, err := dm.db.Delete(ctx, key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// statsDays returns the UTC days covering [from, to], oldest first
+func statsDays(from, to time.Time) []string {
+	var days []string
+	from, to = from.UTC(), to.UTC()
+	for day := from.Truncate(24 * time.Hour); !day.After(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(time.DateOnly))
+	}
+	return days
+}
+
+// addDailyStats adds the statistics of a day to a sum, starting one if stats is nil
+func addDailyStats(stats *UserStats, daily *UserDailyStats) *UserStats {
+	if stats == nil {
+		stats = &UserStats{
+			ID:               daily.UserID,
+			DocType:          "user_stats",
+			TotalStats:       make(map[uint32]uint64),
+			SubspaceStats:    make(map[string]map[uint32]uint64),
+			CreatedSubspaces: []string{},
+			JoinedSubspaces:  []string{},
+		}
+	}
+
+	for kind, count := range daily.TotalStats {
+		stats.TotalStats[kind] += count
+	}
+	for subspaceID, kinds := range daily.SubspaceStats {
+		if stats.SubspaceStats[subspaceID] == nil {
+			stats.SubspaceStats[subspaceID] = make(map[uint32]uint64)
+		}
+		for kind, count := range kinds {
+			stats.SubspaceStats[subspaceID][kind] += count
+		}
+	}
+
+	if daily.VoteStats != nil {
+		if stats.VoteStats == nil {
+			stats.VoteStats = &VoteStats{SubspaceVotes: make(map[string]*SubspaceVoteStats)}
+		}
+		stats.VoteStats.TotalVotes += daily.VoteStats.TotalVotes
+		stats.VoteStats.YesVotes += daily.VoteStats.YesVotes
+		stats.VoteStats.NoVotes += daily.VoteStats.NoVotes
+		for subspaceID, votes := range daily.VoteStats.SubspaceVotes {
+			sum := stats.VoteStats.SubspaceVotes[subspaceID]
+			if sum == nil {
+				sum = &SubspaceVoteStats{}
+				stats.VoteStats.SubspaceVotes[subspaceID] = sum
+			}
+			sum.TotalVotes += votes.TotalVotes
+			sum.YesVotes += votes.YesVotes
+			sum.NoVotes += votes.NoVotes
+		}
+	}
+
+	for subspaceID, count := range daily.SubspaceInvited {
+		if stats.InviteStats == nil {
+			stats.InviteStats = &InviteStats{
+				SubspaceInvited: make(map[string]uint64),
+				InvitedUsers:    make(map[string][]*InvitedUserInfo),
+			}
+		}
+		stats.InviteStats.TotalInvited += count
+		stats.InviteStats.SubspaceInvited[subspaceID] += count
+	}
+
+	if daily.Updated > stats.LastUpdated {
+		stats.LastUpdated = daily.Updated
+	}
+	return stats
+}
+
+// getDay retrieves daily statistics by document key, nil if there are none
+func (dm *UserDailyStatsManager) getDay(ctx context.Context, key string) (*UserDailyStats, error) {
+	docs, err := dm.db.Get(ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeUserDailyStats {
+			continue
+		}
+		return docToUserDailyStats(docMap)
+	}
+
+	return nil, nil
+}
+
+// Helper function: parse a daily user statistics document
+func docToUserDailyStats(docMap map[string]interface{}) (*UserDailyStats, error) {
+	// Convert document to JSON and parse into struct
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var daily UserDailyStats
+	if err := json.Unmarshal(jsonData, &daily); err != nil {
+		return nil, err
+	}
+	if daily.TotalStats == nil {
+		daily.TotalStats = make(map[uint32]uint64)
+	}
+	if daily.SubspaceStats == nil {
+		daily.SubspaceStats = make(map[string]map[uint32]uint64)
+	}
+	return &daily, nil
+}
+
+// saveDay saves a daily user statistics document
+func (dm *UserDailyStatsManager) saveDay(ctx context.Context, daily *UserDailyStats) error {
+	_, err := dm.db.Put(ctx, userDailyStatsDoc(daily))
+	return err
+}
+
+// userDailyStatsDoc stamps daily user statistics and returns their document
+func userDailyStatsDoc(daily *UserDailyStats) map[string]interface{} {
+	daily.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            daily.ID,
+		"id":             daily.ID,
+		"doc_type":       DocTypeUserDailyStats,
+		"schema_version": schemaVersion(DocTypeUserDailyStats),
+		"user_id":        daily.UserID,
+		"day":            daily.Day,
+		"total_stats":    daily.TotalStats,
+		"subspace_stats": daily.SubspaceStats,
+		"updated":        daily.Updated,
+	}
+	if daily.VoteStats != nil {
+		doc["vote_stats"] = daily.VoteStats
+	}
+	if len(daily.SubspaceInvited) > 0 {
+		doc["subspace_invited"] = daily.SubspaceInvited
+	}
+	return doc
+}
+
+// GetUserPeriodStats retrieves the statistics of a user summed over the days covering [from, to]
+func (a *OrbitDBAdapter) GetUserPeriodStats(ctx context.Context, userID string, from, to time.Time) (*UserStats, error) {
+	return a.userStatsMgr.daily.GetUserPeriodStats(ctx, userID, from, to)
+}
+
+// QueryPeriodStats retrieves the statistics of the users active over the days covering
+// [from, to], summed per user
+func (a *OrbitDBAdapter) QueryPeriodStats(ctx context.Context, from, to time.Time) ([]*UserStats, error) {
+	return a.userStatsMgr.daily.QueryPeriodStats(ctx, from, to)
+}
@@ -0,0 +1,66 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that user statistics can be summed over a date range from their daily shards
+func TestUserPeriodStats(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("daily-stats"))
+
+	day := func(d int) nostr.Timestamp {
+		return nostr.Timestamp(time.Date(2024, 3, d, 12, 0, 0, 0, time.UTC).Unix())
+	}
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000b2"
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: day(1), Kind: 30100, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: day(4), Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: day(5), Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: day(5), Kind: 30302, Tags: nostr.Tags{{"sid", sid}, {"proposal_id", "p"}, {"vote", "yes"}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: day(5), Kind: 30200, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: day(6), Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", testPubKey("alice")}}}),
+	}))
+
+	week := func(from, to int) (time.Time, time.Time) {
+		return day(from).Time(), day(to).Time()
+	}
+
+	alice, bob := testPubKey("alice"), testPubKey("bob")
+	from, to := week(4, 10)
+	stats, err := adapter.GetUserPeriodStats(ctx, alice, from, to)
+	require.NoError(t, err)
+	require.NotNil(t, stats)
+	assert.Equal(t, map[uint32]uint64{30300: 2, 30302: 1}, stats.TotalStats, "the create event is outside the period")
+	assert.Equal(t, uint64(2), stats.SubspaceStats[sid][30300])
+	require.NotNil(t, stats.VoteStats)
+	assert.Equal(t, uint64(1), stats.VoteStats.YesVotes)
+	require.NotNil(t, stats.InviteStats)
+	assert.Equal(t, uint64(1), stats.InviteStats.SubspaceInvited[sid], "invites are credited to the inviter on the day they were accepted")
+
+	from, to = week(1, 3)
+	stats, err = adapter.GetUserPeriodStats(ctx, bob, from, to)
+	require.NoError(t, err)
+	assert.Nil(t, stats)
+
+	// Windowed rankings sum every user active in the period
+	from, to = week(5, 5)
+	users, err := adapter.QueryPeriodStats(ctx, from, to)
+	require.NoError(t, err)
+	totals := map[string]uint64{}
+	for _, user := range users {
+		totals[user.ID] = UserScore(user, LeaderboardTotalEvents, "")
+	}
+	assert.Equal(t, map[string]uint64{alice: 2, bob: 1}, totals)
+
+	// Purging a user deletes their daily statistics
+	report, err := adapter.PurgeUser(ctx, alice)
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.DailyStatsRemoved)
+}
@@ -0,0 +1,206 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeUserProfile identifies user profile documents
+const DocTypeUserProfile = "user_profile"
+
+// UserProfile is the metadata a user published in their latest kind 0 event
+type UserProfile struct {
+	ID          string `json:"id"`                     // Document ID, format: user_profile:<pubkey>
+	DocType     string `json:"doc_type"`               // Document type, fixed as "user_profile"
+	PubKey      string `json:"pubkey"`                 // Public key of the user
+	Name        string `json:"name,omitempty"`         // name of the metadata
+	DisplayName string `json:"display_name,omitempty"` // display_name of the metadata
+	Picture     string `json:"picture,omitempty"`      // picture URL of the metadata
+	NIP05       string `json:"nip05,omitempty"`        // NIP-05 identifier of the metadata
+	EventID     string `json:"event_id"`               // ID of the kind 0 event the profile comes from
+	CreatedAt   int64  `json:"created_at"`             // Kind 0 event timestamp
+	Updated     int64  `json:"updated"`                // Update timestamp
+}
+
+// Label returns the name to show for the user: the display name, else the name
+func (p *UserProfile) Label() string {
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+	return p.Name
+}
+
+// UserProfileManager maintains user profile documents from kind 0 events
+type UserProfileManager struct {
+	db iface.DocumentStore
+}
+
+// NewUserProfileManager creates a new UserProfileManager
+func NewUserProfileManager(db iface.DocumentStore) *UserProfileManager {
+	return &UserProfileManager{db: db}
+}
+
+// userProfileDocID returns the document key of the profile of a user
+func userProfileDocID(pubKey string) string {
+	return DocTypeUserProfile + ":" + pubKey
+}
+
+// UpdateFromEvent stores the profile of a kind 0 event. Kind 0 is replaceable, so the
+// newest event wins, ties broken by the lowest ID as in NIP-01. Events whose content isn't
+// a JSON object are ignored.
+func (pm *UserProfileManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	if event.Kind != nostr.KindSetMetadata {
+		return nil
+	}
+
+	var metadata struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+		Picture     string `json:"picture"`
+		NIP05       string `json:"nip05"`
+	}
+	if err := json.Unmarshal([]byte(event.Content), &metadata); err != nil {
+		return nil
+	}
+
+	existing, err := pm.GetUserProfile(ctx, event.PubKey)
+	if err != nil {
+		return err
+	}
+	created := int64(event.CreatedAt)
+	if existing != nil && existing.EventID != event.ID &&
+		(existing.CreatedAt > created || existing.CreatedAt == created && existing.EventID < event.ID) {
+		return nil
+	}
+
+	return pm.saveUserProfile(ctx, &UserProfile{
+		ID:          userProfileDocID(event.PubKey),
+		DocType:     DocTypeUserProfile,
+		PubKey:      event.PubKey,
+		Name:        metadata.Name,
+		DisplayName: metadata.DisplayName,
+		Picture:     metadata.Picture,
+		NIP05:       metadata.NIP05,
+		EventID:     event.ID,
+		CreatedAt:   created,
+	})
+}
+
+// RemoveEvent removes the profile of a user whose kind 0 event was deleted. Older kind 0
+// events of the user come back on the next rebuild.
+func (pm *UserProfileManager) RemoveEvent(ctx context.Context, event *nostr.Event) error {
+	if event.Kind != nostr.KindSetMetadata {
+		return nil
+	}
+	profile, err := pm.GetUserProfile(ctx, event.PubKey)
+	if err != nil || profile == nil || profile.EventID != event.ID {
+		return err
+	}
+	_, err = pm.db.Delete(ctx, profile.ID)
+	return err
+}
+
+// DeleteUserProfile deletes the profile of a user. Returns false if there was none.
+func (pm *UserProfileManager) DeleteUserProfile(ctx context.Context, pubKey string) (bool, error) {
+	profile, err := pm.GetUserProfile(ctx, pubKey)
+	if err != nil || profile == nil {
+		return false, err
+	}
+	if _, err := pm.db.Delete(ctx, profile.ID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetUserProfile retrieves the profile of a user, nil if they published none
+func (pm *UserProfileManager) GetUserProfile(ctx context.Context, pubKey string) (*UserProfile, error) {
+	docs, err := pm.db.Get(ctx, userProfileDocID(pubKey), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeUserProfile {
+			continue
+		}
+		return docToUserProfile(docMap)
+	}
+
+	return nil, nil
+}
+
+// GetUserProfiles retrieves the profiles of several users by public key. Users without a
+// profile are left out.
+func (pm *UserProfileManager) GetUserProfiles(ctx context.Context, pubKeys []string) (map[string]*UserProfile, error) {
+	profiles := make(map[string]*UserProfile, len(pubKeys))
+	for _, pubKey := range pubKeys {
+		if _, done := profiles[pubKey]; done {
+			continue
+		}
+		profile, err := pm.GetUserProfile(ctx, pubKey)
+		if err != nil {
+			return nil, err
+		}
+		if profile != nil {
+			profiles[pubKey] = profile
+		}
+	}
+	return profiles, nil
+}
+
+// Helper function: parse a user profile document
+func docToUserProfile(docMap map[string]interface{}) (*UserProfile, error) {
+	// Convert document to JSON and parse into struct
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile UserProfile
+	if err := json.Unmarshal(jsonData, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// saveUserProfile saves a user profile document
+func (pm *UserProfileManager) saveUserProfile(ctx context.Context, profile *UserProfile) error {
+	profile.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            profile.ID,
+		"id":             profile.ID,
+		"doc_type":       DocTypeUserProfile,
+		"schema_version": schemaVersion(DocTypeUserProfile),
+		"pubkey":         profile.PubKey,
+		"name":           profile.Name,
+		"display_name":   profile.DisplayName,
+		"picture":        profile.Picture,
+		"nip05":          profile.NIP05,
+		"event_id":       profile.EventID,
+		"created_at":     profile.CreatedAt,
+		"updated":        profile.Updated,
+	}
+
+	_, err := pm.db.Put(ctx, doc)
+	return err
+}
+
+// GetUserProfile retrieves the profile a user published in kind 0 metadata
+func (a *OrbitDBAdapter) GetUserProfile(ctx context.Context, pubKey string) (*UserProfile, error) {
+	return a.userProfileMgr.GetUserProfile(ctx, pubKey)
+}
+
+// GetUserProfiles retrieves the profiles of several users, by public key
+func (a *OrbitDBAdapter) GetUserProfiles(ctx context.Context, pubKeys []string) (map[string]*UserProfile, error) {
+	return a.userProfileMgr.GetUserProfiles(ctx, pubKeys)
+}
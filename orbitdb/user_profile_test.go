@@ -0,0 +1,44 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that the latest kind 0 event of a user becomes their profile
+func TestUserProfile(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("profiles"))
+	latest := signAs(t, "alice", &nostr.Event{CreatedAt: 1700000100, Kind: 0, Content: `{"name":"alice","display_name":"Alice","picture":"https://example.com/a.png","nip05":"alice@example.com"}`})
+	require.NoError(t, adapter.SaveEvents(ctx, []*nostr.Event{
+		latest,
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 0, Content: `{"name":"old"}`}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000000, Kind: 0, Content: `not json`}),
+		signAs(t, "carol", &nostr.Event{CreatedAt: 1700000000, Kind: 1, Content: `{"name":"carol"}`}),
+	}))
+
+	alice := testPubKey("alice")
+	profile, err := adapter.GetUserProfile(ctx, alice)
+	require.NoError(t, err)
+	require.NotNil(t, profile)
+	assert.Equal(t, latest.ID, profile.EventID, "older events don't replace the profile")
+	assert.Equal(t, "Alice", profile.Label())
+	assert.Equal(t, "https://example.com/a.png", profile.Picture)
+	assert.Equal(t, "alice@example.com", profile.NIP05)
+
+	profiles, err := adapter.GetUserProfiles(ctx, testPubKeys("alice", "bob", "carol"))
+	require.NoError(t, err)
+	assert.Len(t, profiles, 1, "invalid metadata and other kinds make no profile")
+
+	// Deleting the event the profile comes from removes the profile
+	event, err := adapter.GetEventByID(ctx, latest.ID)
+	require.NoError(t, err)
+	require.NoError(t, adapter.DeleteEvent(ctx, event))
+	profile, err = adapter.GetUserProfile(ctx, alice)
+	require.NoError(t, err)
+	assert.Nil(t, profile)
+}
@@ -0,0 +1,311 @@
+package orbitdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// DocTypeEventTombstone identifies the documents replacing purged events. A tombstone keeps
+// the event ID, so the purge replicates as an overwrite, and nothing else of the event.
+const DocTypeEventTombstone = "event_tombstone"
+
+// UserPurgeReport describes the data removed by a user purge
+type UserPurgeReport struct {
+	PubKey                string   `json:"pubkey"`                  // Purged user
+	TombstonedEvents      []string `json:"tombstoned_events"`       // IDs of the user's events replaced by tombstones
+	UserStatsRemoved      bool     `json:"user_stats_removed"`      // Whether the user's statistics document was deleted
+	DailyStatsRemoved     int      `json:"daily_stats_removed"`     // Number of the user's daily statistics documents deleted
+	ProfileRemoved        bool     `json:"profile_removed"`         // Whether the user's profile document was deleted
+	InviteListsScrubbed   []string `json:"invite_lists_scrubbed"`   // Inviters whose invited users no longer list the user
+	SubspacesScrubbed     []string `json:"subspaces_scrubbed"`      // Invite-only subspaces whose invited users no longer list the user
+	LeaderboardsScrubbed  []string `json:"leaderboards_scrubbed"`   // Leaderboards the user was removed from
+	HistogramDaysRemoved  int      `json:"histogram_days_removed"`  // Number of the user's activity histogram days deleted
+	ActivityScrubbed      []string `json:"activity_scrubbed"`       // Subspaces whose activity counters no longer list the user
+	SubspaceStatsScrubbed []string `json:"subspace_stats_scrubbed"` // Subspaces whose statistics no longer list the user
+}
+
+// PurgeUser removes the data of a user: their events are replaced by tombstones, with the
+// derived data of deleted events removed as by DeleteEvent, their statistics, activity
+// histogram and profile are deleted and they are scrubbed from other users' invite lists,
+// subspace invite lists, leaderboards and the active users of subspace activity and
+// statistics. Aggregate counters, such as the inviters' invitation counts, subspace event
+// counts and causality counters, are kept.
+//
+// The purge only rewrites the current documents: the original events and documents remain
+// in the entries of the OrbitDB oplog on IPFS until they are garbage collected.
+func (a *OrbitDBAdapter) PurgeUser(ctx context.Context, pubKey string) (*UserPurgeReport, error) {
+	report := &UserPurgeReport{
+		PubKey:                pubKey,
+		TombstonedEvents:      []string{},
+		InviteListsScrubbed:   []string{},
+		SubspacesScrubbed:     []string{},
+		LeaderboardsScrubbed:  []string{},
+		ActivityScrubbed:      []string{},
+		SubspaceStatsScrubbed: []string{},
+	}
+
+	events, err := a.queryEventDocs(ctx, nostr.Filter{Authors: []string{pubKey}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events of %s: %w", pubKey, err)
+	}
+	for _, event := range events {
+		if _, err := a.tombstoneEvent(ctx, event, TombstonePurged); err != nil {
+			return nil, err
+		}
+		report.TombstonedEvents = append(report.TombstonedEvents, event.ID)
+	}
+
+	if report.UserStatsRemoved, err = a.userStatsMgr.DeleteUserStats(ctx, pubKey); err != nil {
+		return nil, fmt.Errorf("failed to delete statistics of %s: %w", pubKey, err)
+	}
+	if report.DailyStatsRemoved, err = a.userStatsMgr.daily.DeleteUserDailyStats(ctx, pubKey); err != nil {
+		return nil, fmt.Errorf("failed to delete daily statistics of %s: %w", pubKey, err)
+	}
+	if report.ProfileRemoved, err = a.userProfileMgr.DeleteUserProfile(ctx, pubKey); err != nil {
+		return nil, fmt.Errorf("failed to delete profile of %s: %w", pubKey, err)
+	}
+	if report.InviteListsScrubbed, err = a.userStatsMgr.ScrubInvitee(ctx, pubKey); err != nil {
+		return nil, fmt.Errorf("failed to scrub %s from invite lists: %w", pubKey, err)
+	}
+	if report.SubspacesScrubbed, err = a.subspaceMetaMgr.ScrubInvitee(ctx, pubKey); err != nil {
+		return nil, fmt.Errorf("failed to scrub %s from subspaces: %w", pubKey, err)
+	}
+	if report.LeaderboardsScrubbed, err = a.leaderboardMgr.RemoveUser(ctx, pubKey); err != nil {
+		return nil, fmt.Errorf("failed to remove %s from leaderboards: %w", pubKey, err)
+	}
+	if report.HistogramDaysRemoved, err = a.activityHistogramMgr.DeleteUserHistogram(ctx, pubKey); err != nil {
+		return nil, fmt.Errorf("failed to delete activity histogram of %s: %w", pubKey, err)
+	}
+	if report.ActivityScrubbed, err = a.subspaceActivityMgr.ScrubUser(ctx, pubKey); err != nil {
+		return nil, fmt.Errorf("failed to scrub %s from subspace activity: %w", pubKey, err)
+	}
+	if report.SubspaceStatsScrubbed, err = a.subspaceStatsMgr.ScrubUser(ctx, pubKey); err != nil {
+		return nil, fmt.Errorf("failed to scrub %s from subspace statistics: %w", pubKey, err)
+	}
+
+	a.cache.clear()
+	zap.L().Info("Purged user", zap.String("pubkey", pubKey), zap.Int("tombstoned", len(report.TombstonedEvents)))
+	return report, nil
+}
+
+// queryEventDocs returns the stored events matching filter, in no particular order
+func (a *OrbitDBAdapter) queryEventDocs(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	var events []*nostr.Event
+	_, err := queryDocuments(ctx, a.events, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		if ok && matchesEventFilter(docMap, filter) {
+			events = append(events, docToEvent(docMap))
+		}
+		// Collected above
+		return false, nil
+	})
+	return events, err
+}
+
+// DeleteUserStats deletes the statistics of a user. Returns false if there were none.
+func (um *UserStatsManager) DeleteUserStats(ctx context.Context, userID string) (bool, error) {
+	stats, err := um.GetUserStats(ctx, userID)
+	if err != nil || stats == nil {
+		return false, err
+	}
+	_, err = um.db.Delete(ctx, userID)
+	um.cache.invalidate(userID)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ScrubInvitee removes a user from the invited users of every inviter and returns the
+// inviters changed. Invitation counts are kept.
+func (um *UserStatsManager) ScrubInvitee(ctx context.Context, userID string) ([]string, error) {
+	inviters, err := um.QueryUserStats(ctx, func(stats *UserStats) bool {
+		return stats.ID != userID && invitedIn(stats, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scrubbed := []string{}
+	for _, inviter := range inviters {
+		for subspaceID, invited := range inviter.InviteStats.InvitedUsers {
+			kept := invited[:0]
+			for _, info := range invited {
+				if info.UserID != userID {
+					kept = append(kept, info)
+				}
+			}
+			inviter.InviteStats.InvitedUsers[subspaceID] = kept
+		}
+		inviter.LastUpdated = time.Now().Unix()
+		if err := um.saveUserStats(ctx, inviter); err != nil {
+			return nil, err
+		}
+		scrubbed = append(scrubbed, inviter.ID)
+	}
+	return scrubbed, nil
+}
+
+// invitedIn reports whether the inviter lists the user as invited in any subspace
+func invitedIn(stats *UserStats, userID string) bool {
+	if stats.InviteStats == nil {
+		return false
+	}
+	for _, invited := range stats.InviteStats.InvitedUsers {
+		for _, info := range invited {
+			if info.UserID == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ScrubInvitee removes a user from the invited users of invite-only subspaces and returns
+// the subspaces changed
+func (sm *SubspaceMetaManager) ScrubInvitee(ctx context.Context, pubKey string) ([]string, error) {
+	docs, err := queryDocuments(ctx, sm.db, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		return ok && docMap["doc_type"] == DocTypeSubspaceMeta, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scrubbed := []string{}
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		meta, err := docToSubspaceMeta(docMap)
+		if err != nil {
+			return nil, err
+		}
+		if !containsString(meta.Invited, pubKey) {
+			continue
+		}
+
+		kept := meta.Invited[:0]
+		for _, invited := range meta.Invited {
+			if invited != pubKey {
+				kept = append(kept, invited)
+			}
+		}
+		meta.Invited = kept
+		if err := sm.saveSubspaceMeta(ctx, meta); err != nil {
+			return nil, err
+		}
+		scrubbed = append(scrubbed, meta.SubspaceID)
+	}
+	return scrubbed, nil
+}
+
+// DeleteUserHistogram deletes the activity histogram days of a user and returns how many
+// were deleted
+func (hm *ActivityHistogramManager) DeleteUserHistogram(ctx context.Context, pubKey string) (int, error) {
+	docs, err := hm.db.Get(ctx, activityHistogramDocID(ActivityScopeUser, pubKey, ""), &iface.DocumentStoreGetOptions{PartialMatches: true})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok || docMap["doc_type"] != DocTypeActivityHistogram || docMap["scope"] != ActivityScopeUser || docMap["owner"] != pubKey {
+			continue
+		}
+		key, _ := docMap["_id"].(string)
+		if _, err := hm.db.Delete(ctx, key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// ScrubUser removes a user from the active users of every subspace's activity buckets and
+// returns the subspaces changed. Event and vote counts are kept.
+func (am *SubspaceActivityManager) ScrubUser(ctx context.Context, pubKey string) ([]string, error) {
+	docs, err := queryDocuments(ctx, am.db, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		return ok && docMap["doc_type"] == DocTypeSubspaceActivity, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scrubbed := []string{}
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		activity, err := docToSubspaceActivity(docMap)
+		if err != nil {
+			return nil, err
+		}
+
+		changed := false
+		for _, bucket := range activity.Buckets {
+			kept := bucket.Users[:0]
+			for _, user := range bucket.Users {
+				if user != pubKey {
+					kept = append(kept, user)
+				}
+			}
+			changed = changed || len(kept) != len(bucket.Users)
+			bucket.Users = kept
+		}
+		if !changed {
+			continue
+		}
+		if err := am.saveSubspaceActivity(ctx, activity); err != nil {
+			return nil, err
+		}
+		scrubbed = append(scrubbed, activity.SubspaceID)
+	}
+	return scrubbed, nil
+}
+
+// ScrubUser removes a user from the distinct authors of every subspace's statistics and
+// returns the subspaces changed. Event, vote and invitation counts are kept.
+func (sm *SubspaceStatsManager) ScrubUser(ctx context.Context, pubKey string) ([]string, error) {
+	docs, err := queryDocuments(ctx, sm.db, func(doc interface{}) (bool, error) {
+		docMap, ok := doc.(map[string]interface{})
+		return ok && docMap["doc_type"] == DocTypeSubspaceStats, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scrubbed := []string{}
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		stats, err := docToSubspaceStats(docMap)
+		if err != nil {
+			return nil, err
+		}
+
+		pos := sort.SearchStrings(stats.Users, pubKey)
+		if pos == len(stats.Users) || stats.Users[pos] != pubKey {
+			continue
+		}
+		stats.Users = append(stats.Users[:pos], stats.Users[pos+1:]...)
+		stats.UniqueUsers = len(stats.Users)
+		if err := sm.saveSubspaceStats(ctx, stats); err != nil {
+			return nil, err
+		}
+		scrubbed = append(scrubbed, stats.SubspaceID)
+	}
+	return scrubbed, nil
+}
@@ -0,0 +1,74 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that purging a user tombstones their events and scrubs them from derived data
+func TestPurgeUser(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("purge"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000e1"
+	alice, bob := testPubKey("alice"), testPubKey("bob")
+	events := []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30100, Tags: nostr.Tags{{"sid", sid}, {"subspace_name", "Purge"}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000100, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", alice}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000200, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: nostr.Now(), Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+	bobEvents := []string{events[1].ID, events[2].ID, events[3].ID}
+
+	report, err := adapter.PurgeUser(ctx, bob)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, bobEvents, report.TombstonedEvents)
+	assert.True(t, report.UserStatsRemoved)
+	assert.Equal(t, []string{alice}, report.InviteListsScrubbed)
+	assert.ElementsMatch(t, []string{leaderboardID(""), leaderboardID(sid)}, report.LeaderboardsScrubbed)
+	assert.Equal(t, 2, report.HistogramDaysRemoved)
+	assert.Equal(t, []string{sid}, report.ActivityScrubbed)
+	assert.Equal(t, []string{sid}, report.SubspaceStatsScrubbed)
+
+	for _, id := range bobEvents {
+		event, err := adapter.GetEventByID(ctx, id)
+		require.NoError(t, err)
+		assert.Nil(t, event, "event %s is tombstoned", id)
+	}
+	remaining, err := adapter.CountEvents(ctx, nostr.Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, remaining)
+
+	stats, err := adapter.GetUserStats(ctx, bob)
+	require.NoError(t, err)
+	assert.Nil(t, stats)
+
+	inviter, err := adapter.GetUserStats(ctx, alice)
+	require.NoError(t, err)
+	assert.Empty(t, inviter.InviteStats.InvitedUsers[sid])
+	assert.Equal(t, uint64(1), inviter.InviteStats.TotalInvited, "invitation counts are kept")
+
+	leaderboard, err := adapter.GetLeaderboard(ctx, sid)
+	require.NoError(t, err)
+	for _, entry := range leaderboard.Rankings[LeaderboardTotalEvents] {
+		assert.NotEqual(t, bob, entry.UserID)
+	}
+
+	subspaceStats, err := adapter.GetSubspaceStats(ctx, sid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{alice}, subspaceStats.Users)
+	assert.Equal(t, uint64(4), subspaceStats.TotalEvents, "event counts are kept")
+
+	activity, err := adapter.subspaceActivityMgr.GetSubspaceActivity(ctx, sid)
+	require.NoError(t, err)
+	for _, bucket := range activity.Buckets {
+		assert.NotContains(t, bucket.Users, bob)
+	}
+}
@@ -3,25 +3,28 @@ package orbitdb
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"sort"
 	"time"
 
 	"berty.tech/go-orbit-db/iface"
 	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
 )
 
 // UserStats represents user statistics data
 type UserStats struct {
-	ID               string                       `json:"id"`                     // User ID, which is the user's ETH address
-	DocType          string                       `json:"doc_type"`               // Document type, fixed as "user_stats"
-	TotalStats       map[uint32]uint64            `json:"total_stats"`            // Overall statistics for various operations
-	SubspaceStats    map[string]map[uint32]uint64 `json:"subspace_stats"`         // Statistics for each subspace
-	CreatedSubspaces []string                     `json:"created_subspaces"`      // List of subspace IDs created by the user
-	JoinedSubspaces  []string                     `json:"joined_subspaces"`       // List of subspace IDs joined by the user
-	VoteStats        *VoteStats                   `json:"vote_stats,omitempty"`   // Voting statistics
-	InviteStats      *InviteStats                 `json:"invite_stats,omitempty"` // Invitation statistics
-	LastUpdated      int64                        `json:"last_updated"`           // Last update time
+	ID               string                       `json:"id"`                        // User ID, which is the user's ETH address
+	DocType          string                       `json:"doc_type"`                  // Document type, fixed as "user_stats"
+	TotalStats       map[uint32]uint64            `json:"total_stats"`               // Overall statistics for various operations
+	SubspaceStats    map[string]map[uint32]uint64 `json:"subspace_stats"`            // Statistics for each subspace
+	CreatedSubspaces []string                     `json:"created_subspaces"`         // List of subspace IDs created by the user
+	JoinedSubspaces  []string                     `json:"joined_subspaces"`          // List of subspace IDs joined by the user
+	JoinTimestamps   map[string]int64             `json:"join_timestamps,omitempty"` // Timestamp of the first create or join event per subspace
+	VoteStats        *VoteStats                   `json:"vote_stats,omitempty"`      // Voting statistics
+	InviteStats      *InviteStats                 `json:"invite_stats,omitempty"`    // Invitation statistics
+	LastUpdated      int64                        `json:"last_updated"`              // Last update time
 }
 
 // VoteStats represents voting-related statistics
@@ -55,16 +58,30 @@ type InvitedUserInfo struct {
 
 // UserStatsManager manages user statistics
 type UserStatsManager struct {
-	db iface.DocumentStore
+	db        iface.DocumentStore
+	votes     *VoteManager           // Counts each user's vote on a proposal once
+	processed *ProcessedEvents       // Counts each event once
+	daily     *UserDailyStatsManager // Daily shards of the statistics, for date ranges
+	cache     *userStatsCache        // nil unless EnableUserStatsCache was called
 }
 
 // NewUserStatsManager creates a new UserStatsManager
 func NewUserStatsManager(db iface.DocumentStore) *UserStatsManager {
-	return &UserStatsManager{db: db}
+	return &UserStatsManager{
+		db:        db,
+		votes:     NewVoteManager(db),
+		processed: NewProcessedEvents(db, "user_stats"),
+		daily:     NewUserDailyStatsManager(db),
+	}
 }
 
 // GetUserStats retrieves user statistics
 func (um *UserStatsManager) GetUserStats(ctx context.Context, userID string) (*UserStats, error) {
+	if stats, ok := um.cache.get(userID); ok {
+		return stats, nil
+	}
+	generation := um.cache.begin()
+
 	// Query user data
 	docs, err := um.db.Get(ctx, userID, nil)
 	if err != nil {
@@ -73,6 +90,7 @@ func (um *UserStatsManager) GetUserStats(ctx context.Context, userID string) (*U
 
 	// If not found, return nil
 	if len(docs) == 0 {
+		um.cache.put(userID, nil, generation)
 		return nil, nil
 	}
 
@@ -94,6 +112,7 @@ func (um *UserStatsManager) GetUserStats(ctx context.Context, userID string) (*U
 	}
 
 	if userStatsDoc == nil {
+		um.cache.put(userID, nil, generation)
 		return nil, nil
 	}
 
@@ -108,15 +127,66 @@ func (um *UserStatsManager) GetUserStats(ctx context.Context, userID string) (*U
 		return nil, err
 	}
 
+	um.cache.put(userID, &userStats, generation)
 	return &userStats, nil
 }
 
-// UpdateUserStatsFromEvent updates user statistics from an event
+// GetUserStatsBatch retrieves the statistics of several users by ID. Users without
+// statistics are left out.
+func (um *UserStatsManager) GetUserStatsBatch(ctx context.Context, userIDs []string) (map[string]*UserStats, error) {
+	stats := make(map[string]*UserStats, len(userIDs))
+	for _, userID := range userIDs {
+		if _, done := stats[userID]; done {
+			continue
+		}
+		userStats, err := um.GetUserStats(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if userStats != nil {
+			stats[userID] = userStats
+		}
+	}
+	return stats, nil
+}
+
+// decodeUserStats returns the statistics of a user statistics document, from the cache if
+// they are cached there
+func (um *UserStatsManager) decodeUserStats(docMap map[string]interface{}, generation uint64) (*UserStats, bool) {
+	id, _ := docMap["_id"].(string)
+	if stats, ok := um.cache.get(id); ok && stats != nil {
+		return stats, true
+	}
+
+	jsonData, err := json.Marshal(docMap)
+	if err != nil {
+		return nil, false
+	}
+
+	var userStats UserStats
+	if err := json.Unmarshal(jsonData, &userStats); err != nil {
+		return nil, false
+	}
+
+	um.cache.put(id, &userStats, generation)
+	return &userStats, true
+}
+
+// UpdateUserStatsFromEvent updates user statistics from an event. Events already counted
+// are skipped.
 func (um *UserStatsManager) UpdateUserStatsFromEvent(ctx context.Context, event *nostr.Event) error {
 	if event == nil {
 		return fmt.Errorf("event cannot be nil")
 	}
 
+	seen, err := um.processed.Seen(ctx, event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check processed event: %w", err)
+	}
+	if seen {
+		return nil
+	}
+
 	// Get existing user statistics
 	userID := event.PubKey
 	stats, err := um.GetUserStats(ctx, userID)
@@ -156,6 +226,10 @@ func (um *UserStatsManager) UpdateUserStatsFromEvent(ctx context.Context, event
 		}
 	}
 
+	// The vote counted, if the event is a vote that is counted
+	var voteCounted bool
+	var voteValue string
+
 	// If subspace ID exists, update subspace-related statistics
 	if subspaceID != "" {
 		// Ensure subspace statistics exist
@@ -171,14 +245,27 @@ func (um *UserStatsManager) UpdateUserStatsFromEvent(ctx context.Context, event
 			if !containsString(stats.CreatedSubspaces, subspaceID) {
 				stats.CreatedSubspaces = append(stats.CreatedSubspaces, subspaceID)
 			}
+			// Creators are members from creation
+			stats.recordJoin(subspaceID, int64(event.CreatedAt))
 
 		case 30200: // Join subspace
 			// Add subspace to joined subspaces list
 			if !containsString(stats.JoinedSubspaces, subspaceID) {
 				stats.JoinedSubspaces = append(stats.JoinedSubspaces, subspaceID)
 			}
+			stats.recordJoin(subspaceID, int64(event.CreatedAt))
 
 		case 30302: // Vote
+			// Only the first vote of a user on a proposal is counted
+			counted, err := um.votes.RecordVote(ctx, event)
+			if err != nil {
+				return fmt.Errorf("failed to record vote: %w", err)
+			}
+			if !counted {
+				break
+			}
+			voteCounted = true
+
 			// Initialize vote statistics
 			if stats.VoteStats == nil {
 				stats.VoteStats = &VoteStats{
@@ -199,7 +286,7 @@ func (um *UserStatsManager) UpdateUserStatsFromEvent(ctx context.Context, event
 			// Check vote type (yes/no)
 			for _, tag := range event.Tags {
 				if len(tag) >= 2 && tag[0] == "vote" {
-					voteValue := tag[1]
+					voteValue = tag[1]
 					if voteValue == "yes" {
 						stats.VoteStats.YesVotes++
 						stats.VoteStats.SubspaceVotes[subspaceID].YesVotes++
@@ -225,15 +312,61 @@ func (um *UserStatsManager) UpdateUserStatsFromEvent(ctx context.Context, event
 				// The inviter is another user, the current user is the invitee
 				// Need to update inviter's statistics
 				err = um.updateInviterStats(ctx, inviterAddr, userID, subspaceID, now)
-				if err != nil {
-					log.Printf("Failed to update inviter statistics: %v", err)
+				if errors.Is(err, ErrInviteNotCredited) {
+					zap.L().Warn("Invite not credited", zap.Error(err))
+				} else if err != nil {
+					zap.L().Error("Failed to update inviter statistics", zap.String("inviter", inviterAddr), zap.Error(err))
+				} else if err := um.daily.recordInvite(ctx, inviterAddr, subspaceID, statsDay(event.CreatedAt)); err != nil {
+					return fmt.Errorf("failed to update daily inviter statistics: %w", err)
 				}
 			}
 		}
 	}
 
-	// Save updated statistics
-	return um.saveUserStats(ctx, stats)
+	// Count the event on the day it was created too, for date-range statistics
+	daily, err := um.daily.recordEvent(ctx, event, subspaceID, voteCounted, voteValue)
+	if err != nil {
+		return fmt.Errorf("failed to update daily statistics: %w", err)
+	}
+
+	// Save updated statistics along with the marker
+	err = um.processed.Mark(ctx, event.ID, userStatsDoc(stats), daily)
+	um.cache.invalidate(stats.ID)
+	return err
+}
+
+// recordJoin keeps the earliest membership timestamp of a subspace. Events may replicate
+// out of order, so a later-arriving older join replaces a newer one.
+func (stats *UserStats) recordJoin(subspaceID string, timestamp int64) {
+	if stats.JoinTimestamps == nil {
+		stats.JoinTimestamps = make(map[string]int64)
+	}
+	if joined, exists := stats.JoinTimestamps[subspaceID]; !exists || timestamp < joined {
+		stats.JoinTimestamps[subspaceID] = timestamp
+	}
+}
+
+// ErrInviteNotCredited is returned when an accepted invitation fails verification and the
+// inviter is not credited
+var ErrInviteNotCredited = errors.New("invite not credited")
+
+// verifyInvite checks that the inviter is a member of the subspace, having created or
+// joined it, and wasn't credited for the invitee in the subspace before
+func verifyInvite(inviterStats *UserStats, inviterID, invitedID, subspaceID string) error {
+	if inviterID == invitedID {
+		return fmt.Errorf("%w: %s invited themselves to subspace %s", ErrInviteNotCredited, invitedID, subspaceID)
+	}
+	if !containsString(inviterStats.CreatedSubspaces, subspaceID) && !containsString(inviterStats.JoinedSubspaces, subspaceID) {
+		return fmt.Errorf("%w: inviter %s is not a member of subspace %s", ErrInviteNotCredited, inviterID, subspaceID)
+	}
+	if inviterStats.InviteStats != nil {
+		for _, invited := range inviterStats.InviteStats.InvitedUsers[subspaceID] {
+			if invited.UserID == invitedID {
+				return fmt.Errorf("%w: %s was already credited for inviting %s to subspace %s", ErrInviteNotCredited, inviterID, invitedID, subspaceID)
+			}
+		}
+	}
+	return nil
 }
 
 // Update inviter's invitation statistics
@@ -244,15 +377,14 @@ func (um *UserStatsManager) updateInviterStats(ctx context.Context, inviterID, i
 		return err
 	}
 
-	// If not found, create new statistics
+	// Users without statistics never created or joined a subspace
 	if inviterStats == nil {
-		inviterStats = &UserStats{
-			ID:            inviterID,
-			DocType:       "user_stats",
-			TotalStats:    make(map[uint32]uint64),
-			SubspaceStats: make(map[string]map[uint32]uint64),
-			LastUpdated:   timestamp,
-		}
+		return fmt.Errorf("%w: inviter %s is not a member of subspace %s", ErrInviteNotCredited, inviterID, subspaceID)
+	}
+
+	// Only members of the subspace can invite, and each invitee is credited once
+	if err := verifyInvite(inviterStats, inviterID, invitedID, subspaceID); err != nil {
+		return err
 	}
 
 	// Initialize invitation statistics
@@ -286,10 +418,18 @@ func (um *UserStatsManager) updateInviterStats(ctx context.Context, inviterID, i
 
 // Save user statistics
 func (um *UserStatsManager) saveUserStats(ctx context.Context, stats *UserStats) error {
+	_, err := um.db.Put(ctx, userStatsDoc(stats))
+	um.cache.invalidate(stats.ID)
+	return err
+}
+
+// userStatsDoc returns the document of user statistics
+func userStatsDoc(stats *UserStats) map[string]interface{} {
 	doc := map[string]interface{}{
 		"_id":               stats.ID,
 		"id":                stats.ID,
 		"doc_type":          stats.DocType,
+		"schema_version":    schemaVersion(stats.DocType),
 		"total_stats":       stats.TotalStats,
 		"subspace_stats":    stats.SubspaceStats,
 		"created_subspaces": stats.CreatedSubspaces,
@@ -297,6 +437,10 @@ func (um *UserStatsManager) saveUserStats(ctx context.Context, stats *UserStats)
 		"last_updated":      stats.LastUpdated,
 	}
 
+	if len(stats.JoinTimestamps) > 0 {
+		doc["join_timestamps"] = stats.JoinTimestamps
+	}
+
 	if stats.VoteStats != nil {
 		doc["vote_stats"] = stats.VoteStats
 	}
@@ -304,14 +448,21 @@ func (um *UserStatsManager) saveUserStats(ctx context.Context, stats *UserStats)
 	if stats.InviteStats != nil {
 		doc["invite_stats"] = stats.InviteStats
 	}
+	return doc
+}
 
-	_, err := um.db.Put(ctx, doc)
-	return err
+// SubspaceUserQuery selects a page of the users of a subspace
+type SubspaceUserQuery struct {
+	Limit       int    // Maximum number of users, 0 for all
+	Cursor      string // Return users after this user ID, the next cursor of the previous page
+	ActiveSince int64  // Only users whose statistics were updated at or after this timestamp, 0 for all
 }
 
-// QueryUsersBySubspace queries all users in a specific subspace
-func (um *UserStatsManager) QueryUsersBySubspace(ctx context.Context, subspaceID string) ([]*UserStats, error) {
+// QueryUsersBySubspace queries the users in a specific subspace ordered by user ID. It returns
+// one page of users and the cursor of the next page, empty when there are no more users.
+func (um *UserStatsManager) QueryUsersBySubspace(ctx context.Context, subspaceID string, query SubspaceUserQuery) ([]*UserStats, string, error) {
 	var results []*UserStats
+	generation := um.cache.begin()
 
 	queryFn := func(doc interface{}) (bool, error) {
 		docMap, ok := doc.(map[string]interface{})
@@ -325,24 +476,27 @@ func (um *UserStatsManager) QueryUsersBySubspace(ctx context.Context, subspaceID
 			return false, nil
 		}
 
+		// Skip users on previous pages
+		if id, _ := docMap["_id"].(string); query.Cursor != "" && id <= query.Cursor {
+			return false, nil
+		}
+
 		// Check if it contains the specified subspace
 		joinedSubspaces, ok := docMap["joined_subspaces"].([]interface{})
 		if ok {
 			for _, sid := range joinedSubspaces {
 				if sidStr, ok := sid.(string); ok && sidStr == subspaceID {
-					// Convert document to JSON
-					jsonData, err := json.Marshal(docMap)
-					if err != nil {
+					userStats, ok := um.decodeUserStats(docMap, generation)
+					if !ok {
 						return false, nil
 					}
 
-					var userStats UserStats
-					if err := json.Unmarshal(jsonData, &userStats); err != nil {
+					if query.ActiveSince > 0 && userStats.LastUpdated < query.ActiveSince {
 						return false, nil
 					}
 
-					results = append(results, &userStats)
-					return true, nil
+					results = append(results, userStats)
+					return false, nil
 				}
 			}
 		}
@@ -350,15 +504,28 @@ func (um *UserStatsManager) QueryUsersBySubspace(ctx context.Context, subspaceID
 		return false, nil
 	}
 
-	// Execute query
-	um.db.Query(ctx, queryFn)
+	// Scan without collecting documents
+	if _, err := queryDocuments(ctx, um.db, queryFn); err != nil {
+		return nil, "", err
+	}
 
-	return results, nil
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+
+	var nextCursor string
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+		nextCursor = results[len(results)-1].ID
+	}
+
+	return results, nextCursor, nil
 }
 
 // QueryUserStats queries user statistics based on conditions
 func (um *UserStatsManager) QueryUserStats(ctx context.Context, filter func(*UserStats) bool) ([]*UserStats, error) {
 	var results []*UserStats
+	generation := um.cache.begin()
 
 	queryFn := func(doc interface{}) (bool, error) {
 		docMap, ok := doc.(map[string]interface{})
@@ -372,27 +539,23 @@ func (um *UserStatsManager) QueryUserStats(ctx context.Context, filter func(*Use
 			return false, nil
 		}
 
-		// Convert document to JSON
-		jsonData, err := json.Marshal(docMap)
-		if err != nil {
-			return false, nil
-		}
-
-		var userStats UserStats
-		if err := json.Unmarshal(jsonData, &userStats); err != nil {
+		userStats, ok := um.decodeUserStats(docMap, generation)
+		if !ok {
 			return false, nil
 		}
 
 		// Apply filter
-		if filter == nil || filter(&userStats) {
-			results = append(results, &userStats)
+		if filter == nil || filter(userStats) {
+			results = append(results, userStats)
 		}
 
 		return true, nil
 	}
 
 	// Execute query
-	um.db.Query(ctx, queryFn)
+	if _, err := queryDocuments(ctx, um.db, queryFn); err != nil {
+		return nil, err
+	}
 
 	return results, nil
 }
@@ -0,0 +1,281 @@
+package orbitdb
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	"berty.tech/go-orbit-db/stores"
+	"berty.tech/go-orbit-db/stores/operation"
+)
+
+// userStatsCache keeps the decoded statistics of the most recently used users. Entries are
+// dropped when the user's statistics document is written, locally or by replication, so
+// reads never see older statistics than the store. A nil userStatsCache caches nothing.
+type userStatsCache struct {
+	mu         sync.Mutex
+	size       int
+	order      *list.List               // Least recently used at the back
+	entries    map[string]*list.Element // Elements by user ID, holding a *cachedUserStats
+	generation uint64                   // Incremented by each invalidation
+	stats      UserStatsCacheStats
+}
+
+// cachedUserStats is a cached user, stats is nil if the user has no statistics
+type cachedUserStats struct {
+	userID string
+	stats  *UserStats
+}
+
+// UserStatsCacheStats describes the user statistics cache
+type UserStatsCacheStats struct {
+	Size          int    `json:"size"`          // Users cached
+	Capacity      int    `json:"capacity"`      // Maximum users cached
+	Hits          uint64 `json:"hits"`          // Reads answered from the cache
+	Misses        uint64 `json:"misses"`        // Reads decoding the statistics document
+	Invalidations uint64 `json:"invalidations"` // Entries dropped because the statistics were written
+}
+
+// newUserStatsCache creates a cache of up to size users
+func newUserStatsCache(size int) *userStatsCache {
+	return &userStatsCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// begin returns the generation to pass to put with statistics read from the store after it
+func (c *userStatsCache) begin() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// get returns a copy of the cached statistics of a user, ok is false on a miss
+func (c *userStatsCache) get(userID string) (stats *UserStats, ok bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, exists := c.entries[userID]
+	if !exists {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedUserStats).stats.clone(), true
+}
+
+// put caches a copy of the statistics of a user read at generation. Statistics read before
+// an invalidation may be outdated and are not cached.
+func (c *userStatsCache) put(userID string, stats *UserStats, generation uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if elem, exists := c.entries[userID]; exists {
+		elem.Value.(*cachedUserStats).stats = stats.clone()
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[userID] = c.order.PushFront(&cachedUserStats{userID: userID, stats: stats.clone()})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedUserStats).userID)
+	}
+}
+
+// invalidate drops the entries of users whose statistics were written
+func (c *userStatsCache) invalidate(userIDs ...string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, userID := range userIDs {
+		if elem, exists := c.entries[userID]; exists {
+			c.order.Remove(elem)
+			delete(c.entries, userID)
+			c.stats.Invalidations++
+		}
+	}
+}
+
+// snapshot returns the cache statistics
+func (c *userStatsCache) snapshot() UserStatsCacheStats {
+	if c == nil {
+		return UserStatsCacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.order.Len()
+	stats.Capacity = c.size
+	return stats
+}
+
+// clone returns a deep copy of the statistics, so cached statistics can't be changed by
+// callers updating theirs
+func (stats *UserStats) clone() *UserStats {
+	if stats == nil {
+		return nil
+	}
+
+	clone := *stats
+	clone.TotalStats = cloneCounts(stats.TotalStats)
+	if stats.SubspaceStats != nil {
+		clone.SubspaceStats = make(map[string]map[uint32]uint64, len(stats.SubspaceStats))
+		for subspaceID, counts := range stats.SubspaceStats {
+			clone.SubspaceStats[subspaceID] = cloneCounts(counts)
+		}
+	}
+	clone.CreatedSubspaces = cloneStrings(stats.CreatedSubspaces)
+	clone.JoinedSubspaces = cloneStrings(stats.JoinedSubspaces)
+	if stats.JoinTimestamps != nil {
+		clone.JoinTimestamps = make(map[string]int64, len(stats.JoinTimestamps))
+		for subspaceID, timestamp := range stats.JoinTimestamps {
+			clone.JoinTimestamps[subspaceID] = timestamp
+		}
+	}
+	if stats.VoteStats != nil {
+		votes := *stats.VoteStats
+		if votes.SubspaceVotes != nil {
+			votes.SubspaceVotes = make(map[string]*SubspaceVoteStats, len(stats.VoteStats.SubspaceVotes))
+			for subspaceID, subspaceVotes := range stats.VoteStats.SubspaceVotes {
+				if subspaceVotes != nil {
+					copied := *subspaceVotes
+					subspaceVotes = &copied
+				}
+				votes.SubspaceVotes[subspaceID] = subspaceVotes
+			}
+		}
+		clone.VoteStats = &votes
+	}
+	if stats.InviteStats != nil {
+		invites := *stats.InviteStats
+		if invites.SubspaceInvited != nil {
+			invites.SubspaceInvited = make(map[string]uint64, len(stats.InviteStats.SubspaceInvited))
+			for subspaceID, count := range stats.InviteStats.SubspaceInvited {
+				invites.SubspaceInvited[subspaceID] = count
+			}
+		}
+		if invites.InvitedUsers != nil {
+			invites.InvitedUsers = make(map[string][]*InvitedUserInfo, len(stats.InviteStats.InvitedUsers))
+			for subspaceID, users := range stats.InviteStats.InvitedUsers {
+				copied := make([]*InvitedUserInfo, len(users))
+				for i, user := range users {
+					if user != nil {
+						info := *user
+						user = &info
+					}
+					copied[i] = user
+				}
+				invites.InvitedUsers[subspaceID] = copied
+			}
+		}
+		clone.InviteStats = &invites
+	}
+	return &clone
+}
+
+// cloneCounts copies operation counts
+func cloneCounts(counts map[uint32]uint64) map[uint32]uint64 {
+	if counts == nil {
+		return nil
+	}
+	clone := make(map[uint32]uint64, len(counts))
+	for op, count := range counts {
+		clone[op] = count
+	}
+	return clone
+}
+
+// cloneStrings copies a slice, keeping empty slices non-nil so they still encode as []
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(values)), values...)
+}
+
+// writtenKeys returns the document keys written or deleted by oplog entries
+func writtenKeys(entries []ipfslog.Entry) []string {
+	var keys []string
+	for _, entry := range entries {
+		op, err := operation.ParseOperation(entry)
+		if err != nil {
+			continue
+		}
+		if key := op.GetKey(); key != nil && *key != "" {
+			keys = append(keys, *key)
+		}
+		for _, doc := range op.GetDocs() {
+			keys = append(keys, doc.GetKey())
+		}
+	}
+	return keys
+}
+
+// EnableUserStatsCache caches the statistics of up to size users read through the adapter.
+// Entries are invalidated when the statistics are written through the adapter or by other
+// code paths and peers, as seen on the event buses of the statistics stores until ctx is
+// done. Must be called before the adapter is shared.
+func (a *OrbitDBAdapter) EnableUserStatsCache(ctx context.Context, size int) error {
+	cache := newUserStatsCache(size)
+	for _, store := range storesOf(a.userStatsMgr.db) {
+		sub, err := store.EventBus().Subscribe([]interface{}{new(stores.EventWrite), new(stores.EventReplicated)})
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to user statistics writes: %w", err)
+		}
+
+		go func() {
+			defer sub.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case evt, ok := <-sub.Out():
+					if !ok {
+						return
+					}
+					switch evt := evt.(type) {
+					case stores.EventWrite:
+						cache.invalidate(writtenKeys([]ipfslog.Entry{evt.Entry})...)
+					case *stores.EventWrite:
+						cache.invalidate(writtenKeys([]ipfslog.Entry{evt.Entry})...)
+					case stores.EventReplicated:
+						cache.invalidate(writtenKeys(evt.Entries)...)
+					case *stores.EventReplicated:
+						cache.invalidate(writtenKeys(evt.Entries)...)
+					}
+				}
+			}
+		}()
+	}
+	a.userStatsMgr.cache = cache
+	return nil
+}
+
+// UserStatsCacheStats returns the state of the user statistics cache, zero if it is disabled
+func (a *OrbitDBAdapter) UserStatsCacheStats() UserStatsCacheStats {
+	return a.userStatsMgr.cache.snapshot()
+}
@@ -0,0 +1,75 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that the least recently used users are evicted and outdated reads are not cached
+func TestUserStatsCacheEviction(t *testing.T) {
+	cache := newUserStatsCache(2)
+	cache.put("user-a", &UserStats{ID: "user-a"}, cache.begin())
+	cache.put("user-b", &UserStats{ID: "user-b"}, cache.begin())
+	_, ok := cache.get("user-a")
+	require.True(t, ok)
+	cache.put("user-c", &UserStats{ID: "user-c"}, cache.begin())
+
+	_, ok = cache.get("user-b")
+	assert.False(t, ok, "least recently used user is evicted")
+	_, ok = cache.get("user-a")
+	assert.True(t, ok)
+
+	generation := cache.begin()
+	cache.invalidate("user-d")
+	cache.put("user-d", &UserStats{ID: "user-d"}, generation)
+	_, ok = cache.get("user-d")
+	assert.False(t, ok, "statistics read before an invalidation are not cached")
+
+	stats := cache.snapshot()
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+}
+
+// Test that cached statistics are copies, reloaded after the user's statistics are written
+func TestUserStatsCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	manager := NewUserStatsManager(NewMemoryDocumentStore("user-stats-cache"))
+	manager.cache = newUserStatsCache(10)
+
+	stats, err := manager.GetUserStats(ctx, "user-a")
+	require.NoError(t, err)
+	assert.Nil(t, stats)
+
+	require.NoError(t, manager.saveUserStats(ctx, &UserStats{
+		ID:              "user-a",
+		DocType:         "user_stats",
+		TotalStats:      map[uint32]uint64{1: 1},
+		JoinedSubspaces: []string{"subspace-1"},
+	}))
+	stats, err = manager.GetUserStats(ctx, "user-a")
+	require.NoError(t, err)
+	require.NotNil(t, stats, "saving invalidates the cached miss")
+
+	stats.TotalStats[1] = 5
+	stats.JoinedSubspaces[0] = "changed"
+	cached, err := manager.GetUserStats(ctx, "user-a")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), cached.TotalStats[1], "callers can't change cached statistics")
+	assert.Equal(t, []string{"subspace-1"}, cached.JoinedSubspaces)
+
+	require.NoError(t, manager.saveUserStats(ctx, stats))
+	cached, err = manager.GetUserStats(ctx, "user-a")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), cached.TotalStats[1])
+
+	deleted, err := manager.DeleteUserStats(ctx, "user-a")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	cached, err = manager.GetUserStats(ctx, "user-a")
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+}
@@ -0,0 +1,358 @@
+package orbitdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"berty.tech/go-orbit-db/stores/operation"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that subspace users are paged by ID and filtered by activity
+func TestQueryUsersBySubspacePages(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDocumentStore("subspace-users")
+	manager := NewUserStatsManager(db)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000a1"
+	users := []struct {
+		id       string
+		updated  int64
+		subspace string
+	}{
+		{"user-c", 1700000300, sid},
+		{"user-a", 1700000100, sid},
+		{"user-d", 1700000400, sid},
+		{"user-b", 1700000200, "0x00000000000000000000000000000000000000000000000000000000000000a2"},
+		{"user-e", 1700000500, sid},
+	}
+	for _, user := range users {
+		_, err := db.Put(ctx, map[string]interface{}{
+			"_id":              user.id,
+			"id":               user.id,
+			"doc_type":         "user_stats",
+			"joined_subspaces": []interface{}{user.subspace},
+			"last_updated":     user.updated,
+		})
+		require.NoError(t, err)
+	}
+
+	var ids []string
+	var pages int
+	query := SubspaceUserQuery{Limit: 2}
+	for {
+		page, next, err := manager.QueryUsersBySubspace(ctx, sid, query)
+		require.NoError(t, err)
+		for _, user := range page {
+			ids = append(ids, user.ID)
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		query.Cursor = next
+	}
+	assert.Equal(t, []string{"user-a", "user-c", "user-d", "user-e"}, ids)
+	assert.Equal(t, 2, pages)
+
+	active, next, err := manager.QueryUsersBySubspace(ctx, sid, SubspaceUserQuery{ActiveSince: 1700000300})
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	require.Len(t, active, 3)
+	assert.Equal(t, "user-c", active[0].ID)
+}
+
+// Test that each user's vote on a proposal is counted once
+func TestOneVotePerUserPerProposal(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("proposal-votes"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000b1"
+	vote := func(proposal, value string) *nostr.Event {
+		return signAs(t, "voter", &nostr.Event{Kind: 30302, CreatedAt: 1700000000,
+			Tags: nostr.Tags{{"sid", sid}, {"op", "vote"}, {"proposal_id", proposal}, {"vote", value}}})
+	}
+
+	yes, no := vote("proposal-a", "yes"), vote("proposal-a", "no")
+	require.NoError(t, adapter.SaveEvent(ctx, yes))
+	assert.ErrorIs(t, adapter.SaveEvent(ctx, no), ErrDuplicateVote)
+	require.NoError(t, adapter.SaveEvent(ctx, vote("proposal-b", "no")))
+
+	// Re-saving a recorded vote is not counted again
+	require.NoError(t, adapter.SaveEvent(ctx, yes))
+
+	voter := testPubKey("voter")
+	stats, err := adapter.GetUserStats(ctx, voter)
+	require.NoError(t, err)
+	require.NotNil(t, stats.VoteStats)
+	assert.Equal(t, uint64(2), stats.VoteStats.TotalVotes)
+	assert.Equal(t, uint64(1), stats.VoteStats.YesVotes)
+	assert.Equal(t, uint64(1), stats.VoteStats.NoVotes)
+
+	votes, err := adapter.voteMgr.GetProposalVotes(ctx, "proposal-a")
+	require.NoError(t, err)
+	require.Contains(t, votes.Votes, voter)
+	assert.Equal(t, yes.ID, votes.Votes[voter].EventID)
+	assert.Equal(t, sid, votes.SubspaceID)
+
+	// Deleting the vote allows voting again, and only the new vote is counted
+	require.NoError(t, adapter.DeleteEvent(ctx, yes))
+	require.NoError(t, adapter.SaveEvent(ctx, no))
+
+	stats, err = adapter.GetUserStats(ctx, voter)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), stats.VoteStats.TotalVotes)
+	assert.Equal(t, uint64(0), stats.VoteStats.YesVotes)
+	assert.Equal(t, uint64(2), stats.VoteStats.NoVotes)
+	assert.Equal(t, uint64(2), stats.VoteStats.SubspaceVotes[sid].TotalVotes)
+
+	day := time.Unix(1700000000, 0)
+	period, err := adapter.GetUserPeriodStats(ctx, voter, day, day)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), period.VoteStats.TotalVotes)
+	assert.Equal(t, uint64(0), period.VoteStats.YesVotes)
+}
+
+// Test that inviters are only credited for members and only once per invitee
+func TestInviteVerification(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("invites"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000b2"
+	events := []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30100, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000100, Kind: 30200, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "carol", &nostr.Event{CreatedAt: 1700000200, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", testPubKey("bob")}}}),
+		signAs(t, "carol", &nostr.Event{CreatedAt: 1700000300, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", testPubKey("bob")}}}),
+		signAs(t, "dave", &nostr.Event{CreatedAt: 1700000400, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", testPubKey("mallory")}}}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000500, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", testPubKey("alice")}}}),
+		signAs(t, "erin", &nostr.Event{CreatedAt: 1700000600, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", testPubKey("alice")}}}),
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+
+	bob, err := adapter.GetUserStats(ctx, testPubKey("bob"))
+	require.NoError(t, err)
+	require.NotNil(t, bob.InviteStats)
+	assert.Equal(t, uint64(1), bob.InviteStats.TotalInvited, "a repeat invite of the same user is not credited")
+
+	mallory, err := adapter.GetUserStats(ctx, testPubKey("mallory"))
+	require.NoError(t, err)
+	assert.Nil(t, mallory, "non-members are not credited")
+
+	alice, err := adapter.GetUserStats(ctx, testPubKey("alice"))
+	require.NoError(t, err)
+	require.NotNil(t, alice.InviteStats)
+	assert.Equal(t, uint64(1), alice.InviteStats.TotalInvited, "self-invites are not credited")
+	assert.Equal(t, testPubKey("erin"), alice.InviteStats.InvitedUsers[sid][0].UserID)
+}
+
+func TestInviteGraphAndTree(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("invite-graph"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000b3"
+	alice, bob := testPubKey("alice"), testPubKey("bob")
+	events := []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30100, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000100, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", alice}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000150, Kind: 30200, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "carol", &nostr.Event{CreatedAt: 1700000200, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", bob}}}),
+		signAs(t, "dave", &nostr.Event{CreatedAt: 1700000300, Kind: 30303, Tags: nostr.Tags{{"sid", sid}, {"inviter_addr", alice}}}),
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+
+	graph, err := adapter.GetSubspaceInviteGraph(ctx, sid)
+	require.NoError(t, err)
+	assert.Equal(t, testPubKeys("alice", "bob", "carol", "dave"), graph.Users)
+	require.Len(t, graph.Edges, 3)
+	var edge *InviteEdge
+	for _, e := range graph.Edges {
+		if e.Invitee == bob {
+			edge = e
+		}
+	}
+	require.NotNil(t, edge)
+	assert.Equal(t, InviteEdge{Inviter: alice, Invitee: bob, SubspaceID: sid, Timestamp: edge.Timestamp}, *edge)
+
+	tree, err := adapter.GetInviteTree(ctx, alice, 1)
+	require.NoError(t, err)
+	require.Len(t, tree.Invited, 2)
+	assert.Empty(t, tree.Invited[0].Invited, "depth 1 stops below the root's invitees")
+
+	tree, err = adapter.GetInviteTree(ctx, alice, 2)
+	require.NoError(t, err)
+	var bobNode *InviteTreeNode
+	for _, node := range tree.Invited {
+		if node.UserID == bob {
+			bobNode = node
+		}
+	}
+	require.NotNil(t, bobNode)
+	require.Len(t, bobNode.Invited, 1)
+	assert.Equal(t, testPubKey("carol"), bobNode.Invited[0].UserID)
+
+	empty, err := adapter.GetSubspaceInviteGraph(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, empty.Edges)
+}
+
+func TestActivityHistogram(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("activity"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000f1"
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) nostr.Timestamp { return nostr.Timestamp(day.Add(d).Unix()) }
+	events := []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: at(time.Hour + time.Minute), Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: at(time.Hour + 30*time.Minute), Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: at(3 * time.Hour), Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "alice", &nostr.Event{CreatedAt: at(26 * time.Hour), Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+
+	daily, err := adapter.GetActivityHistogram(ctx, ActivityScopeUser, testPubKey("alice"), GranularityDay, day, day.Add(72*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, daily, 4)
+	assert.Equal(t, day.Unix(), daily[0].Start)
+	assert.Equal(t, []uint64{2, 1, 0, 0}, []uint64{daily[0].Count, daily[1].Count, daily[2].Count, daily[3].Count})
+
+	hourly, err := adapter.GetActivityHistogram(ctx, ActivityScopeSubspace, sid, GranularityHour, day, day.Add(4*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, hourly, 5)
+	assert.Equal(t, []uint64{0, 2, 0, 1, 0}, []uint64{hourly[0].Count, hourly[1].Count, hourly[2].Count, hourly[3].Count, hourly[4].Count})
+}
+
+func TestJoinTimestamps(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewOrbitDBAdapter(NewMemoryDocumentStore("join-times"))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000f2"
+	events := []*nostr.Event{
+		signAs(t, "alice", &nostr.Event{CreatedAt: 1700000000, Kind: 30100, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000500, Kind: 30200, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000200, Kind: 30200, Tags: nostr.Tags{{"sid", sid}}}),
+		signAs(t, "bob", &nostr.Event{CreatedAt: 1700000100, Kind: 30300, Tags: nostr.Tags{{"sid", sid}}}),
+	}
+	for _, event := range events {
+		require.NoError(t, adapter.SaveEvent(ctx, event))
+	}
+
+	alice, err := adapter.GetUserStats(ctx, testPubKey("alice"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000000), alice.JoinTimestamps[sid], "creators are members from creation")
+
+	bob, err := adapter.GetUserStats(ctx, testPubKey("bob"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000200), bob.JoinTimestamps[sid], "the earliest join event wins, whatever the arrival order")
+}
+
+// Test that reprocessing an event doesn't count it twice, also after a restart
+func TestReprocessedEventsCountedOnce(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDocumentStore("processed-events")
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000f3"
+	create := &nostr.Event{ID: "create", PubKey: "alice", CreatedAt: 1700000000, Kind: 30100,
+		Tags: nostr.Tags{{"sid", sid}, {"ops", "post=30300"}}}
+	post := &nostr.Event{ID: "post", PubKey: "alice", CreatedAt: 1700000100, Kind: 30300,
+		Tags: nostr.Tags{{"sid", sid}, {"op", "post"}}}
+
+	causality := NewCausalityManager(db)
+	userStats := NewUserStatsManager(db)
+	for _, event := range []*nostr.Event{create, post, post} {
+		require.NoError(t, causality.UpdateFromEvent(ctx, event))
+		require.NoError(t, userStats.UpdateUserStatsFromEvent(ctx, event))
+	}
+
+	// Fresh managers load the markers persisted by the previous ones
+	causality = NewCausalityManager(db)
+	userStats = NewUserStatsManager(db)
+	require.NoError(t, causality.UpdateFromEvent(ctx, post))
+	require.NoError(t, userStats.UpdateUserStatsFromEvent(ctx, post))
+
+	counter, err := causality.GetCausalityKey(ctx, sid, 30300)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), counter)
+
+	stats, err := userStats.GetUserStats(ctx, "alice")
+	require.NoError(t, err)
+	require.NotNil(t, stats)
+	assert.Equal(t, uint64(1), stats.TotalStats[30300])
+	assert.Equal(t, uint64(1), stats.SubspaceStats[sid][30300])
+}
+
+// failingMarkStore is a memory store failing the next write of a processed-event marker once
+// armed
+type failingMarkStore struct {
+	*MemoryDocumentStore
+	armed bool
+}
+
+func (s *failingMarkStore) Put(ctx context.Context, document interface{}) (operation.Operation, error) {
+	return s.PutAll(ctx, []interface{}{document})
+}
+
+func (s *failingMarkStore) PutAll(ctx context.Context, values []interface{}) (operation.Operation, error) {
+	for _, value := range values {
+		if doc, ok := value.(map[string]interface{}); ok && doc["doc_type"] == DocTypeProcessedEvent && s.armed {
+			s.armed = false
+			return nil, errors.New("store unavailable")
+		}
+	}
+	return s.MemoryDocumentStore.PutAll(ctx, values)
+}
+
+// Test that an update whose marker fails to be written is not applied, so retrying it counts
+// the event once
+func TestFailedMarkRetriedOnce(t *testing.T) {
+	ctx := context.Background()
+	db := &failingMarkStore{MemoryDocumentStore: NewMemoryDocumentStore("failed-mark")}
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000f4"
+	create := &nostr.Event{ID: "create", PubKey: "alice", CreatedAt: 1700000000, Kind: 30100,
+		Tags: nostr.Tags{{"sid", sid}, {"ops", "post=30300"}}}
+	post := &nostr.Event{ID: "post", PubKey: "alice", CreatedAt: 1700000100, Kind: 30300,
+		Tags: nostr.Tags{{"sid", sid}, {"op", "post"}}}
+
+	causality := NewCausalityManager(db)
+	userStats := NewUserStatsManager(db)
+	subspaceStats := NewSubspaceStatsManager(db)
+	require.NoError(t, causality.UpdateFromEvent(ctx, create))
+	require.NoError(t, userStats.UpdateUserStatsFromEvent(ctx, create))
+	require.NoError(t, subspaceStats.UpdateFromEvent(ctx, create))
+
+	for _, update := range []func(context.Context, *nostr.Event) error{
+		causality.UpdateFromEvent, userStats.UpdateUserStatsFromEvent, subspaceStats.UpdateFromEvent,
+	} {
+		db.armed = true
+		assert.Error(t, update(ctx, post))
+		require.NoError(t, update(ctx, post))
+	}
+
+	stats, err := userStats.GetUserStats(ctx, "alice")
+	require.NoError(t, err)
+	require.NotNil(t, stats)
+	assert.Equal(t, uint64(1), stats.TotalStats[30300])
+	daily, err := userStats.daily.getDay(ctx, userDailyStatsDocID(statsDay(post.CreatedAt), "alice"))
+	require.NoError(t, err)
+	require.NotNil(t, daily)
+	assert.Equal(t, uint64(1), daily.TotalStats[30300])
+	subspace, err := subspaceStats.GetSubspaceStats(ctx, sid)
+	require.NoError(t, err)
+	require.NotNil(t, subspace)
+	assert.Equal(t, uint64(2), subspace.TotalEvents)
+	keys, err := causality.GetAllCausalityKeys(ctx, sid)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), keys[30300])
+}
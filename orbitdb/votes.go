@@ -0,0 +1,268 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeProposalVotes identifies the documents recording who voted on a proposal
+const DocTypeProposalVotes = "proposal_votes"
+
+// ErrDuplicateVote is returned when a user votes again on a proposal
+var ErrDuplicateVote = errors.New("user has already voted on this proposal")
+
+// ProposalVote is the vote of one user on a proposal
+type ProposalVote struct {
+	EventID string `json:"event_id"`        // Vote event ID
+	Value   string `json:"value,omitempty"` // Value of the vote tag, e.g. "yes" or "no"
+	Created int64  `json:"created"`         // Vote event creation timestamp
+}
+
+// ProposalVotes records the votes on a proposal, one per user
+type ProposalVotes struct {
+	ID         string                   `json:"id"`          // Document ID, format: proposal_votes:<proposal id>
+	DocType    string                   `json:"doc_type"`    // Document type, fixed as "proposal_votes"
+	ProposalID string                   `json:"proposal_id"` // Proposal ID from the proposal_id tag
+	SubspaceID string                   `json:"subspace_id"` // Subspace of the proposal
+	Votes      map[string]*ProposalVote `json:"votes"`       // Votes by voter public key
+	Updated    int64                    `json:"updated"`     // Update timestamp
+}
+
+// VoteManager tracks votes per user and proposal so each user is counted once
+type VoteManager struct {
+	db iface.DocumentStore
+}
+
+// NewVoteManager creates a new VoteManager
+func NewVoteManager(db iface.DocumentStore) *VoteManager {
+	return &VoteManager{db: db}
+}
+
+// proposalVotesDocID returns the document key of a proposal's votes
+func proposalVotesDocID(proposalID string) string {
+	return DocTypeProposalVotes + ":" + proposalID
+}
+
+// voteProposal returns the proposal a vote event is cast on, empty for other events and
+// for votes without a proposal_id tag, which can't be tracked
+func voteProposal(event *nostr.Event) string {
+	if event.Kind != 30302 {
+		return ""
+	}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "proposal_id" {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// CheckVote returns ErrDuplicateVote if the event is a vote by a user who already voted on
+// the proposal with another event
+func (vm *VoteManager) CheckVote(ctx context.Context, event *nostr.Event) error {
+	proposalID := voteProposal(event)
+	if proposalID == "" {
+		return nil
+	}
+
+	votes, err := vm.GetProposalVotes(ctx, proposalID)
+	if err != nil || votes == nil {
+		return err
+	}
+	if vote, exists := votes.Votes[event.PubKey]; exists && vote.EventID != event.ID {
+		return ErrDuplicateVote
+	}
+	return nil
+}
+
+// RecordVote records a vote event. Returns true if it is the user's first vote on the
+// proposal and should be counted, false if the user's vote was already recorded with
+// another event. Recording an event again returns true, as the vote is recorded with the
+// access steps before the user statistics count it once.
+// Events that aren't trackable votes are always counted.
+func (vm *VoteManager) RecordVote(ctx context.Context, event *nostr.Event) (bool, error) {
+	proposalID := voteProposal(event)
+	if proposalID == "" {
+		return true, nil
+	}
+
+	votes, err := vm.GetProposalVotes(ctx, proposalID)
+	if err != nil {
+		return false, err
+	}
+	if votes == nil {
+		votes = &ProposalVotes{
+			ID:         proposalVotesDocID(proposalID),
+			DocType:    DocTypeProposalVotes,
+			ProposalID: proposalID,
+			Votes:      make(map[string]*ProposalVote),
+		}
+	}
+	if vote, exists := votes.Votes[event.PubKey]; exists {
+		return vote.EventID == event.ID, nil
+	}
+
+	if votes.SubspaceID == "" {
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "sid" {
+				votes.SubspaceID = tag[1]
+				break
+			}
+		}
+	}
+
+	vote := &ProposalVote{EventID: event.ID, Created: int64(event.CreatedAt)}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "vote" {
+			vote.Value = tag[1]
+			break
+		}
+	}
+	votes.Votes[event.PubKey] = vote
+	return true, vm.saveProposalVotes(ctx, votes)
+}
+
+// UpdateFromEvent records the vote of a vote event
+func (vm *VoteManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	_, err := vm.RecordVote(ctx, event)
+	return err
+}
+
+// RemoveVote forgets a deleted vote event, so its author may vote again. Returns false if
+// the event wasn't the recorded vote of its author.
+func (vm *VoteManager) RemoveVote(ctx context.Context, event *nostr.Event) (bool, error) {
+	proposalID := voteProposal(event)
+	if proposalID == "" {
+		return false, nil
+	}
+
+	votes, err := vm.GetProposalVotes(ctx, proposalID)
+	if err != nil || votes == nil {
+		return false, err
+	}
+	if vote, exists := votes.Votes[event.PubKey]; !exists || vote.EventID != event.ID {
+		return false, nil
+	}
+
+	delete(votes.Votes, event.PubKey)
+	return true, vm.saveProposalVotes(ctx, votes)
+}
+
+// RemoveVote forgets a deleted vote event and takes it out of the vote statistics of its
+// author, so a vote cast after the deletion counts once. Other statistics keep counting the
+// event until a rebuild.
+func (um *UserStatsManager) RemoveVote(ctx context.Context, event *nostr.Event) error {
+	removed, err := um.votes.RemoveVote(ctx, event)
+	if err != nil || !removed {
+		return err
+	}
+
+	subspaceID := eventSubspaceID(event)
+	var vote string
+	if tag := event.Tags.GetFirst([]string{"vote", ""}); tag != nil {
+		vote = tag.Value()
+	}
+
+	stats, err := um.GetUserStats(ctx, event.PubKey)
+	if err != nil {
+		return err
+	}
+	if stats != nil && stats.VoteStats != nil {
+		stats.VoteStats.uncount(subspaceID, vote)
+		stats.LastUpdated = time.Now().Unix()
+		if err := um.saveUserStats(ctx, stats); err != nil {
+			return err
+		}
+	}
+	return um.daily.removeVote(ctx, event.PubKey, statsDay(event.CreatedAt), subspaceID, vote)
+}
+
+// uncount takes a vote in a subspace out of the statistics
+func (s *VoteStats) uncount(subspaceID, vote string) {
+	decrement := func(counter *uint64) {
+		if *counter > 0 {
+			*counter--
+		}
+	}
+
+	decrement(&s.TotalVotes)
+	switch vote {
+	case "yes":
+		decrement(&s.YesVotes)
+	case "no":
+		decrement(&s.NoVotes)
+	}
+
+	subspace := s.SubspaceVotes[subspaceID]
+	if subspace == nil {
+		return
+	}
+	decrement(&subspace.TotalVotes)
+	switch vote {
+	case "yes":
+		decrement(&subspace.YesVotes)
+	case "no":
+		decrement(&subspace.NoVotes)
+	}
+}
+
+// GetProposalVotes retrieves the votes recorded for a proposal, nil if there are none
+func (vm *VoteManager) GetProposalVotes(ctx context.Context, proposalID string) (*ProposalVotes, error) {
+	docs, err := vm.db.Get(ctx, proposalVotesDocID(proposalID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeProposalVotes {
+			continue
+		}
+
+		// Convert document to JSON and parse into struct
+		jsonData, err := json.Marshal(docMap)
+		if err != nil {
+			return nil, err
+		}
+
+		var votes ProposalVotes
+		if err := json.Unmarshal(jsonData, &votes); err != nil {
+			return nil, err
+		}
+		if votes.Votes == nil {
+			votes.Votes = make(map[string]*ProposalVote)
+		}
+		return &votes, nil
+	}
+
+	return nil, nil
+}
+
+// saveProposalVotes saves the votes document of a proposal
+func (vm *VoteManager) saveProposalVotes(ctx context.Context, votes *ProposalVotes) error {
+	votes.Updated = int64(nostr.Now())
+
+	doc := map[string]interface{}{
+		"_id":            votes.ID,
+		"id":             votes.ID,
+		"doc_type":       DocTypeProposalVotes,
+		"schema_version": schemaVersion(DocTypeProposalVotes),
+		"proposal_id":    votes.ProposalID,
+		"subspace_id":    votes.SubspaceID,
+		"votes":          votes.Votes,
+		"updated":        votes.Updated,
+	}
+
+	_, err := vm.db.Put(ctx, doc)
+	return err
+}
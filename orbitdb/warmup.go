@@ -0,0 +1,186 @@
+package orbitdb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"go.uber.org/zap"
+)
+
+// readCache keeps recently read subspace causality and leaderboards in memory. Entries
+// written through the adapter are invalidated immediately; changes replicated from peers
+// become visible when the entry expires. A nil readCache caches nothing.
+type readCache struct {
+	mu           sync.Mutex
+	ttl          time.Duration
+	causality    map[string]*cachedCausality
+	leaderboards map[string]*cachedLeaderboard
+}
+
+// cachedCausality is the cached causality of a subspace, nil if it doesn't exist
+type cachedCausality struct {
+	causality *SubspaceCausality
+	expires   time.Time
+}
+
+// cachedLeaderboard is a cached leaderboard, nil if it has not been built yet
+type cachedLeaderboard struct {
+	leaderboard *Leaderboard
+	expires     time.Time
+}
+
+// newReadCache creates a cache whose entries live for ttl
+func newReadCache(ttl time.Duration) *readCache {
+	return &readCache{
+		ttl:          ttl,
+		causality:    make(map[string]*cachedCausality),
+		leaderboards: make(map[string]*cachedLeaderboard),
+	}
+}
+
+// getCausality returns the cached causality of a subspace, ok is false on a miss
+func (c *readCache) getCausality(subspaceID string) (causality *SubspaceCausality, ok bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, exists := c.causality[subspaceID]
+	if !exists || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.causality, true
+}
+
+// putCausality caches the causality of a subspace
+func (c *readCache) putCausality(subspaceID string, causality *SubspaceCausality) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.causality[subspaceID] = &cachedCausality{causality: causality, expires: time.Now().Add(c.ttl)}
+}
+
+// getLeaderboard returns a cached leaderboard, ok is false on a miss
+func (c *readCache) getLeaderboard(subspaceID string) (leaderboard *Leaderboard, ok bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, exists := c.leaderboards[subspaceID]
+	if !exists || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.leaderboard, true
+}
+
+// putLeaderboard caches a leaderboard
+func (c *readCache) putLeaderboard(subspaceID string, leaderboard *Leaderboard) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leaderboards[subspaceID] = &cachedLeaderboard{leaderboard: leaderboard, expires: time.Now().Add(c.ttl)}
+}
+
+// invalidateEvent drops the entries an event may change: the causality and leaderboard
+// of its subspace and the global leaderboard
+func (c *readCache) invalidateEvent(event *nostr.Event) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.leaderboards, "")
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" {
+			delete(c.causality, tag[1])
+			delete(c.leaderboards, tag[1])
+		}
+	}
+}
+
+// clear drops all entries
+func (c *readCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.causality = make(map[string]*cachedCausality)
+	c.leaderboards = make(map[string]*cachedLeaderboard)
+}
+
+// EnableReadCache caches subspace causality and leaderboards read through the adapter for
+// ttl. Must be called before the adapter is shared.
+func (a *OrbitDBAdapter) EnableReadCache(ttl time.Duration) {
+	a.cache = newReadCache(ttl)
+}
+
+// WarmupResult summarizes a warm-up
+type WarmupResult struct {
+	Subspaces    int    `json:"subspaces"`            // Subspaces whose causality was preloaded
+	Leaderboards int    `json:"leaderboards"`         // Leaderboards preloaded, including the global one
+	Failures     int    `json:"failures"`             // Documents that failed to load
+	LastError    string `json:"last_error,omitempty"` // Last load error
+	DurationMsec int64  `json:"duration_ms"`          // Duration of the warm-up
+}
+
+// WarmUp preloads the global leaderboard and the causality and leaderboards of the given
+// subspaces, hottest first, into the read cache. Loading stops early when ctx is done.
+// Without a read cache this only touches the documents.
+func (a *OrbitDBAdapter) WarmUp(ctx context.Context, subspaceIDs []string) (*WarmupResult, error) {
+	start := time.Now()
+	result := &WarmupResult{}
+
+	fail := func(what string, err error) {
+		zap.L().Warn("Failed to preload", zap.String("document", what), zap.Error(err))
+		result.LastError = err.Error()
+		result.Failures++
+	}
+
+	if leaderboard, err := a.GetLeaderboard(ctx, ""); err != nil {
+		fail("global leaderboard", err)
+	} else if leaderboard != nil {
+		result.Leaderboards++
+	}
+
+	for _, subspaceID := range subspaceIDs {
+		select {
+		case <-ctx.Done():
+			result.DurationMsec = time.Since(start).Milliseconds()
+			return result, ctx.Err()
+		default:
+		}
+
+		if !IsValidSubspaceID(subspaceID) {
+			continue
+		}
+		if causality, err := a.GetSubspaceCausality(ctx, subspaceID); err != nil {
+			fail("causality of subspace "+subspaceID, err)
+		} else if causality != nil {
+			result.Subspaces++
+		}
+		if leaderboard, err := a.GetLeaderboard(ctx, subspaceID); err != nil {
+			fail("leaderboard of subspace "+subspaceID, err)
+		} else if leaderboard != nil {
+			result.Leaderboards++
+		}
+	}
+
+	result.DurationMsec = time.Since(start).Milliseconds()
+	zap.L().Info("Warmed up", zap.Int("subspaces", result.Subspaces), zap.Int("leaderboards", result.Leaderboards),
+		zap.Int64("duration_ms", result.DurationMsec), zap.Int("failures", result.Failures))
+	return result, nil
+}
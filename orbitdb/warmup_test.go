@@ -0,0 +1,44 @@
+package orbitdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that warmed up documents are served from the cache until an event changes them
+func TestWarmUpCachesUntilInvalidated(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDocumentStore("warmup")
+	adapter := NewOrbitDBAdapter(db)
+	adapter.EnableReadCache(time.Minute)
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000d4"
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "creator", &nostr.Event{CreatedAt: 1700000000, Kind: 30100,
+		Tags: nostr.Tags{{"sid", sid}, {"ops", "post=30300"}}})))
+
+	result, err := adapter.WarmUp(ctx, []string{sid, "not-a-subspace"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Subspaces)
+	assert.Equal(t, 2, result.Leaderboards)
+	assert.Equal(t, 0, result.Failures)
+
+	// Changes that bypass the adapter, like replicated ones, are hidden by the cache
+	_, err = db.Delete(ctx, sid)
+	require.NoError(t, err)
+	causality, err := adapter.GetSubspaceCausality(ctx, sid)
+	require.NoError(t, err)
+	assert.NotNil(t, causality)
+
+	// Saving an event of the subspace drops its entries
+	require.NoError(t, adapter.SaveEvent(ctx, signAs(t, "member", &nostr.Event{CreatedAt: 1700000100, Kind: 30300,
+		Tags: nostr.Tags{{"sid", sid}, {"op", "post"}}})))
+	leaderboard, err := adapter.GetLeaderboard(ctx, sid)
+	require.NoError(t, err)
+	require.NotNil(t, leaderboard)
+	assert.Len(t, leaderboard.Rankings[LeaderboardTotalEvents], 2)
+}
@@ -0,0 +1,95 @@
+package orbitdb
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// WebhookSecretsFile is the file, in the OrbitDB directory, keeping the webhook signing
+// secrets of a node
+const WebhookSecretsFile = "webhook_secrets.json"
+
+// WebhookSecrets keeps the signing secrets of webhooks on this node only. Webhook documents
+// replicate to every peer, so they never hold the secret: only the node a webhook was
+// registered on can sign its deliveries, and only that node delivers it.
+type WebhookSecrets struct {
+	mu      sync.Mutex
+	path    string            // File the secrets are saved to, empty to keep them in memory
+	secrets map[string]string // Secrets by webhook ID
+}
+
+// NewWebhookSecrets creates an empty set of secrets kept in memory
+func NewWebhookSecrets() *WebhookSecrets {
+	return &WebhookSecrets{secrets: make(map[string]string)}
+}
+
+// Load reads the secrets saved in path and saves later changes there. A missing file yields
+// no secrets.
+func (s *WebhookSecrets) Load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	secrets := make(map[string]string)
+	if err == nil {
+		if err := json.Unmarshal(data, &secrets); err != nil {
+			return err
+		}
+	}
+	s.path, s.secrets = path, secrets
+	return nil
+}
+
+// Get returns the secret of a webhook, empty if it wasn't registered on this node
+func (s *WebhookSecrets) Get(webhookID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.secrets[webhookID]
+}
+
+// Set stores the secret of a webhook
+func (s *WebhookSecrets) Set(webhookID, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[webhookID] = secret
+	return s.save()
+}
+
+// Delete removes the secret of a webhook
+func (s *WebhookSecrets) Delete(webhookID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.secrets[webhookID]; !ok {
+		return nil
+	}
+	delete(s.secrets, webhookID)
+	return s.save()
+}
+
+// save writes the secrets to their file, replacing it atomically. The caller holds s.mu.
+func (s *WebhookSecrets) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// EnableWebhookSecretsFile keeps the webhook signing secrets in path instead of memory, so
+// webhooks registered on this node survive a restart
+func (a *OrbitDBAdapter) EnableWebhookSecretsFile(path string) error {
+	return a.webhookSecrets.Load(path)
+}
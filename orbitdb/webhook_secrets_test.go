@@ -0,0 +1,54 @@
+package orbitdb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that webhook secrets stay on the registering node instead of the replicated documents
+func TestWebhookSecretsStayLocal(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDocumentStore("webhook-secrets")
+	path := filepath.Join(t.TempDir(), WebhookSecretsFile)
+	local := NewOrbitDBAdapter(db)
+	require.NoError(t, local.EnableWebhookSecretsFile(path))
+
+	sid := "0x00000000000000000000000000000000000000000000000000000000000000e4"
+	hook := &SubspaceWebhook{URL: "https://hooks.example/x", Secret: "s3cret"}
+	require.NoError(t, local.AddSubspaceWebhook(ctx, sid, hook))
+
+	docs, err := db.Get(ctx, SubspaceWebhooksDocID(sid), nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.NotContains(t, docs[0].(map[string]interface{})["webhooks"].([]interface{})[0], "secret")
+
+	webhooks, err := local.ListSubspaceWebhooks(ctx, sid)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	assert.Equal(t, "s3cret", webhooks[0].Secret)
+
+	// A peer reading the same documents sees the webhook without its secret
+	peer := NewOrbitDBAdapter(db)
+	webhooks, err = peer.ListSubspaceWebhooks(ctx, sid)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	assert.Empty(t, webhooks[0].Secret)
+
+	// The secret survives a restart of the registering node
+	restarted := NewOrbitDBAdapter(db)
+	require.NoError(t, restarted.EnableWebhookSecretsFile(path))
+	webhooks, err = restarted.ListSubspaceWebhooks(ctx, sid)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", webhooks[0].Secret)
+
+	_, err = restarted.DeleteSubspaceWebhook(ctx, "not-a-subspace", hook.ID)
+	assert.Error(t, err)
+	deleted, err := restarted.DeleteSubspaceWebhook(ctx, sid, hook.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Empty(t, restarted.webhookSecrets.Get(hook.ID))
+}
@@ -0,0 +1,140 @@
+package orbitdb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeWebhookSubscription identifies the document of one webhook subscription
+const DocTypeWebhookSubscription = "webhook_subscription"
+
+// WebhookSubscription is a webhook receiving the saved and replicated events matching a filter
+type WebhookSubscription struct {
+	ID      string       `json:"id"`               // Subscription ID
+	URL     string       `json:"url"`              // Delivery URL
+	Secret  string       `json:"secret,omitempty"` // HMAC-SHA256 signing secret, kept on the registering node only
+	Filter  nostr.Filter `json:"filter"`           // Events delivered; limit is ignored
+	Created int64        `json:"created"`          // Registration timestamp
+}
+
+// Matches reports whether an event is delivered to the subscription
+func (s *WebhookSubscription) Matches(event *nostr.Event) bool {
+	return s.Filter.Matches(event)
+}
+
+// WebhookSubscriptionManager manages the webhook subscriptions. Each subscription is its own
+// document, so subscriptions added concurrently on different nodes are all kept. Secrets are
+// kept in the node's WebhookSecrets, not in the replicated documents.
+type WebhookSubscriptionManager struct {
+	db      iface.DocumentStore
+	secrets *WebhookSecrets
+}
+
+// NewWebhookSubscriptionManager creates a new WebhookSubscriptionManager
+func NewWebhookSubscriptionManager(db iface.DocumentStore, secrets *WebhookSecrets) *WebhookSubscriptionManager {
+	return &WebhookSubscriptionManager{db: db, secrets: secrets}
+}
+
+// webhookSubscriptionDocID returns the document ID of a webhook subscription
+func webhookSubscriptionDocID(subscriptionID string) string {
+	return DocTypeWebhookSubscription + ":" + subscriptionID
+}
+
+// ListWebhookSubscriptions retrieves every webhook subscription, oldest first. Secret is only
+// set on the subscriptions registered on this node.
+func (sm *WebhookSubscriptionManager) ListWebhookSubscriptions(ctx context.Context) ([]*WebhookSubscription, error) {
+	docs, err := sm.db.Get(ctx, DocTypeWebhookSubscription+":", &iface.DocumentStoreGetOptions{PartialMatches: true})
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]*WebhookSubscription, 0, len(docs))
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeWebhookSubscription {
+			continue
+		}
+
+		// Convert document to JSON and parse into struct
+		jsonData, err := json.Marshal(docMap["subscription"])
+		if err != nil {
+			return nil, err
+		}
+
+		var subscription WebhookSubscription
+		if err := json.Unmarshal(jsonData, &subscription); err != nil {
+			return nil, err
+		}
+		subscription.Secret = sm.secrets.Get(subscription.ID)
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].Created != subscriptions[j].Created {
+			return subscriptions[i].Created < subscriptions[j].Created
+		}
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+	return subscriptions, nil
+}
+
+// AddWebhookSubscription registers a webhook subscription, assigning its ID and creation time
+func (sm *WebhookSubscriptionManager) AddWebhookSubscription(ctx context.Context, subscription *WebhookSubscription) error {
+	if subscription == nil {
+		return fmt.Errorf("subscription cannot be nil")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	subscription.ID = hex.EncodeToString(id)
+	subscription.Created = int64(nostr.Now())
+
+	if err := sm.secrets.Set(subscription.ID, subscription.Secret); err != nil {
+		return fmt.Errorf("failed to store webhook secret: %w", err)
+	}
+
+	replicated := *subscription
+	replicated.Secret = ""
+	docID := webhookSubscriptionDocID(subscription.ID)
+	doc := map[string]interface{}{
+		"_id":            docID,
+		"id":             docID,
+		"doc_type":       DocTypeWebhookSubscription,
+		"schema_version": schemaVersion(DocTypeWebhookSubscription),
+		"subscription":   &replicated,
+		"updated":        subscription.Created,
+	}
+
+	_, err := sm.db.Put(ctx, doc)
+	return err
+}
+
+// DeleteWebhookSubscription removes a webhook subscription. Returns false if it doesn't exist.
+func (sm *WebhookSubscriptionManager) DeleteWebhookSubscription(ctx context.Context, subscriptionID string) (bool, error) {
+	docs, err := sm.db.Get(ctx, webhookSubscriptionDocID(subscriptionID), nil)
+	if err != nil {
+		return false, err
+	}
+	if len(docs) == 0 {
+		return false, nil
+	}
+
+	if _, err := sm.db.Delete(ctx, webhookSubscriptionDocID(subscriptionID)); err != nil {
+		return false, err
+	}
+	return true, sm.secrets.Delete(subscriptionID)
+}
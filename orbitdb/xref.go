@@ -0,0 +1,193 @@
+package orbitdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DocTypeXref identifies cross-subspace reference index documents
+const DocTypeXref = "xref"
+
+// XrefLink represents one end of a cross-subspace reference
+type XrefLink struct {
+	EventID    string `json:"event_id"`              // Referenced or referencing event ID
+	SubspaceID string `json:"subspace_id,omitempty"` // Subspace the event belongs to
+}
+
+// EventXrefs represents the cross-subspace references of an event
+type EventXrefs struct {
+	ID         string      `json:"id"`                    // Event ID
+	DocType    string      `json:"doc_type"`              // Document type, fixed as "xref"
+	SubspaceID string      `json:"subspace_id,omitempty"` // Subspace of the event, if known
+	Outgoing   []*XrefLink `json:"outgoing"`              // Events this event references
+	Incoming   []*XrefLink `json:"incoming"`              // Events referencing this event
+	Updated    int64       `json:"updated"`               // Update timestamp
+}
+
+// XrefManager manages cross-subspace references
+type XrefManager struct {
+	db iface.DocumentStore
+}
+
+// NewXrefManager creates a new XrefManager
+func NewXrefManager(db iface.DocumentStore) *XrefManager {
+	return &XrefManager{db: db}
+}
+
+// xrefDocID returns the document key of an event's xref index, keeping it apart from the event itself
+func xrefDocID(eventID string) string {
+	return DocTypeXref + ":" + eventID
+}
+
+// parseXrefTags extracts xref tags from an event
+// Tag format: ["xref", "<event id>", "<subspace id>"], the subspace ID being optional
+func parseXrefTags(event *nostr.Event) []*XrefLink {
+	var links []*XrefLink
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "xref" || tag[1] == "" {
+			continue
+		}
+
+		link := &XrefLink{EventID: tag[1]}
+		if len(tag) >= 3 {
+			link.SubspaceID = tag[2]
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// GetEventXrefs retrieves the cross-subspace references of an event
+func (xm *XrefManager) GetEventXrefs(ctx context.Context, eventID string) (*EventXrefs, error) {
+	docs, err := xm.db.Get(ctx, xrefDocID(eventID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range docs {
+		docMap, ok := doc.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		docType, ok := docMap["doc_type"].(string)
+		if !ok || docType != DocTypeXref {
+			continue
+		}
+
+		// Convert document to JSON and parse into struct
+		jsonData, err := json.Marshal(docMap)
+		if err != nil {
+			return nil, err
+		}
+
+		var xrefs EventXrefs
+		if err := json.Unmarshal(jsonData, &xrefs); err != nil {
+			return nil, err
+		}
+
+		return &xrefs, nil
+	}
+
+	// No references recorded yet
+	return &EventXrefs{
+		ID:       eventID,
+		DocType:  DocTypeXref,
+		Outgoing: []*XrefLink{},
+		Incoming: []*XrefLink{},
+	}, nil
+}
+
+// UpdateFromEvent indexes the xref tags of an event in both directions
+func (xm *XrefManager) UpdateFromEvent(ctx context.Context, event *nostr.Event) error {
+	if event == nil {
+		return fmt.Errorf("event cannot be nil")
+	}
+
+	links := parseXrefTags(event)
+	if len(links) == 0 {
+		// No cross-subspace references to handle
+		return nil
+	}
+
+	var subspaceID string
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "sid" {
+			subspaceID = tag[1]
+			break
+		}
+	}
+
+	now := int64(nostr.Now())
+
+	// Record outgoing references on the source event
+	source, err := xm.GetEventXrefs(ctx, event.ID)
+	if err != nil {
+		return err
+	}
+	source.SubspaceID = subspaceID
+	for _, link := range links {
+		if !containsXrefLink(source.Outgoing, link.EventID) {
+			source.Outgoing = append(source.Outgoing, link)
+		}
+	}
+	source.Updated = now
+	if err := xm.saveEventXrefs(ctx, source); err != nil {
+		return err
+	}
+
+	// Record incoming references on each target event
+	for _, link := range links {
+		target, err := xm.GetEventXrefs(ctx, link.EventID)
+		if err != nil {
+			return err
+		}
+		if target.SubspaceID == "" {
+			target.SubspaceID = link.SubspaceID
+		}
+		if containsXrefLink(target.Incoming, event.ID) {
+			continue
+		}
+		target.Incoming = append(target.Incoming, &XrefLink{
+			EventID:    event.ID,
+			SubspaceID: subspaceID,
+		})
+		target.Updated = now
+		if err := xm.saveEventXrefs(ctx, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save an xref index document
+func (xm *XrefManager) saveEventXrefs(ctx context.Context, xrefs *EventXrefs) error {
+	doc := map[string]interface{}{
+		"_id":            xrefDocID(xrefs.ID),
+		"id":             xrefs.ID,
+		"doc_type":       DocTypeXref,
+		"schema_version": schemaVersion(DocTypeXref),
+		"subspace_id":    xrefs.SubspaceID,
+		"outgoing":       xrefs.Outgoing,
+		"incoming":       xrefs.Incoming,
+		"updated":        xrefs.Updated,
+	}
+
+	_, err := xm.db.Put(ctx, doc)
+	return err
+}
+
+// Helper function: check if a link list already references an event
+func containsXrefLink(links []*XrefLink, eventID string) bool {
+	for _, link := range links {
+		if link.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}